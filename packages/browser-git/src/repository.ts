@@ -230,6 +230,8 @@ export interface AddOptions {
 export interface CommitOptions {
   /** Amend the previous commit */
   amend?: boolean;
+  /** Amend even if the commit was already pushed to a remote */
+  force?: boolean;
   /** Allow empty commit */
   allowEmpty?: boolean;
   /** Override author */
@@ -1,4 +1,4 @@
-module github.com/nseba/browser-git/git-core
+module github.com/nseba/browser-git/packages/git-core
 
 go 1.21
 
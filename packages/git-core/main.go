@@ -3,14 +3,23 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall/js"
 	"time"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
-	"github.com/nseba/browser-git/git-core/pkg/index"
-	"github.com/nseba/browser-git/git-core/pkg/object"
-	"github.com/nseba/browser-git/git-core/pkg/repository"
+	"github.com/nseba/browser-git/packages/git-core/pkg/auth"
+	"github.com/nseba/browser-git/packages/git-core/pkg/diff"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/repository"
 )
 
 // Version information
@@ -26,37 +35,138 @@ func main() {
 	js.Global().Set("gitCore", js.ValueOf(map[string]interface{}{
 		"version": js.FuncOf(getVersion),
 		"hash": js.ValueOf(map[string]interface{}{
-			"sha1":     js.FuncOf(hashSHA1),
-			"sha256":   js.FuncOf(hashSHA256),
-			"hashBlob": js.FuncOf(hashBlob),
+			"sha1":         js.FuncOf(hashSHA1),
+			"sha256":       js.FuncOf(hashSHA256),
+			"hashBlob":     js.FuncOf(hashBlob),
+			"createHasher": js.FuncOf(createHasher),
 		}),
 		"object": js.ValueOf(map[string]interface{}{
-			"createBlob":   js.FuncOf(createBlob),
-			"createTree":   js.FuncOf(createTree),
-			"createCommit": js.FuncOf(createCommit),
-			"createTag":    js.FuncOf(createTag),
-			"parseObject":  js.FuncOf(parseObject),
-			"compress":     js.FuncOf(compressObject),
-			"decompress":   js.FuncOf(decompressObject),
+			"createBlob":       js.FuncOf(createBlob),
+			"createTree":       js.FuncOf(createTree),
+			"createCommit":     js.FuncOf(createCommit),
+			"createTag":        js.FuncOf(createTag),
+			"parseObject":      js.FuncOf(parseObject),
+			"compress":         js.FuncOf(compressObject),
+			"decompress":       js.FuncOf(decompressObject),
+			"compressStream":   js.FuncOf(compressStream),
+			"decompressStream": js.FuncOf(decompressStream),
+		}),
+		"storage": js.ValueOf(map[string]interface{}{
+			"onEvicted":            js.FuncOf(storageOnEvicted),
+			"onCorruptionDetected": js.FuncOf(storageOnCorruptionDetected),
+			"runScheduledFsck":     js.FuncOf(runScheduledFsck),
+			"subscribe":            js.FuncOf(subscribeEvents),
+			"unsubscribe":          js.FuncOf(unsubscribeEvents),
+		}),
+		"trailers": js.ValueOf(map[string]interface{}{
+			"parse":     js.FuncOf(parseTrailers),
+			"interpret": js.FuncOf(interpretTrailers),
+		}),
+		"hooks": js.ValueOf(map[string]interface{}{
+			"register":   js.FuncOf(registerHook),
+			"unregister": js.FuncOf(unregisterHook),
 		}),
 		"repository": js.ValueOf(map[string]interface{}{
-			"init":          js.FuncOf(initRepository),
-			"open":          js.FuncOf(openRepository),
-			"isRepository":  js.FuncOf(isRepository),
-			"find":          js.FuncOf(findRepository),
-			"add":           js.FuncOf(addFiles),
-			"commit":        js.FuncOf(createCommitFromIndex),
-			"status":        js.FuncOf(getStatus),
-			"listBranches":  js.FuncOf(listBranches),
-			"createBranch":  js.FuncOf(createBranch),
-			"deleteBranch":  js.FuncOf(deleteBranch),
-			"renameBranch":  js.FuncOf(renameBranch),
-			"currentBranch": js.FuncOf(currentBranch),
-			"checkout":      js.FuncOf(checkout),
-			"checkoutFile":  js.FuncOf(checkoutFile),
-			"log":           js.FuncOf(getLog),
-			"getCommit":     js.FuncOf(getCommitByHash),
-			"blame":         js.FuncOf(getBlame),
+			"init":                  js.FuncOf(initRepository),
+			"open":                  js.FuncOf(openRepository),
+			"isRepository":          js.FuncOf(isRepository),
+			"find":                  js.FuncOf(findRepository),
+			"add":                   js.FuncOf(addFiles),
+			"commit":                js.FuncOf(createCommitFromIndex),
+			"status":                js.FuncOf(getStatus),
+			"listBranches":          js.FuncOf(listBranches),
+			"createBranch":          js.FuncOf(createBranch),
+			"deleteBranch":          js.FuncOf(deleteBranch),
+			"renameBranch":          js.FuncOf(renameBranch),
+			"currentBranch":         js.FuncOf(currentBranch),
+			"checkout":              js.FuncOf(checkout),
+			"checkoutFile":          js.FuncOf(checkoutFile),
+			"checkoutPaths":         js.FuncOf(checkoutPaths),
+			"verifyCheckout":        js.FuncOf(verifyCheckout),
+			"sparseCheckoutSet":     js.FuncOf(sparseCheckoutSet),
+			"sparseCheckoutList":    js.FuncOf(sparseCheckoutList),
+			"sparseCheckoutDisable": js.FuncOf(sparseCheckoutDisable),
+			"log":                   js.FuncOf(getLog),
+			"logGraph":              js.FuncOf(logGraph),
+			"logIterator":           js.FuncOf(logIterator),
+			"logNextPage":           js.FuncOf(logNextPage),
+			"logIteratorClose":      js.FuncOf(logIteratorClose),
+			"commitsInRange":        js.FuncOf(commitsInRange),
+			"revList":               js.FuncOf(revList),
+			"getCommit":             js.FuncOf(getCommitByHash),
+			"blame":                 js.FuncOf(getBlame),
+			"operationState":        js.FuncOf(operationState),
+			"bundleCreate":          js.FuncOf(bundleCreate),
+			"unbundle":              js.FuncOf(unbundle),
+			"reflog":                js.FuncOf(getReflog),
+			"undo":                  js.FuncOf(undo),
+			"redo":                  js.FuncOf(redo),
+			"archive":               js.FuncOf(archive),
+			"prepareCommit":         js.FuncOf(prepareCommit),
+			"fsck":                  js.FuncOf(fsck),
+			"exportRefs":            js.FuncOf(exportRefs),
+			"importRefs":            js.FuncOf(importRefs),
+			"updateRefs":            js.FuncOf(updateRefs),
+			"symbolicRef":           js.FuncOf(symbolicRef),
+			"remoteDefaultBranch":   js.FuncOf(remoteDefaultBranch),
+			"listRefs":              js.FuncOf(listRefs),
+			"recoverBranch":         js.FuncOf(recoverBranch),
+			"fetchHead":             js.FuncOf(fetchHead),
+			"setNamespace":          js.FuncOf(setNamespace),
+			"push":                  js.FuncOf(push),
+			"gc":                    js.FuncOf(gc),
+			"stats":                 js.FuncOf(stats),
+			"clean":                 js.FuncOf(clean),
+			"remove":                js.FuncOf(remove),
+			"move":                  js.FuncOf(move),
+			"restore":               js.FuncOf(restore),
+			"clone":                 js.FuncOf(clone),
+			"show":                  js.FuncOf(show),
+			"showFile":              js.FuncOf(showFile),
+			"objectInfo":            js.FuncOf(objectInfo),
+			"readObject":            js.FuncOf(readObject),
+			"batchObjectInfo":       js.FuncOf(batchObjectInfo),
+			"batchReadObject":       js.FuncOf(batchReadObject),
+			"listTree":              js.FuncOf(listTree),
+			"listIndexFiles":        js.FuncOf(listIndexFiles),
+			"checkIgnore":           js.FuncOf(checkIgnore),
+			"grep":                  js.FuncOf(grep),
+			"shortlog":              js.FuncOf(shortlog),
+			"formatPatch":           js.FuncOf(formatPatch),
+			"am":                    js.FuncOf(am),
+			"cherry":                js.FuncOf(cherry),
+			"nameRev":               js.FuncOf(nameRev),
+			"diffTrees":             js.FuncOf(diffTrees),
+			"diffIndexToWorktree":   js.FuncOf(diffIndexToWorktree),
+			"diffHeadToIndex":       js.FuncOf(diffHeadToIndex),
+			"diffHeadToWorktree":    js.FuncOf(diffHeadToWorktree),
+			"intralineDiff":         js.FuncOf(intralineDiff),
+			"bisectStart":           js.FuncOf(bisectStart),
+			"bisectGood":            js.FuncOf(bisectGood),
+			"bisectBad":             js.FuncOf(bisectBad),
+			"bisectSkip":            js.FuncOf(bisectSkip),
+			"bisectReset":           js.FuncOf(bisectReset),
+			"addNote":               js.FuncOf(addNote),
+			"readNote":              js.FuncOf(readNote),
+			"removeNote":            js.FuncOf(removeNote),
+			"listNotes":             js.FuncOf(listNotes),
+			"replaceObject":         js.FuncOf(replaceObject),
+			"graftCommit":           js.FuncOf(graftCommit),
+			"deleteReplacement":     js.FuncOf(deleteReplacement),
+			"listReplacements":      js.FuncOf(listReplacements),
+			"createTag":             js.FuncOf(createRepositoryTag),
+			"verifyCommit":          js.FuncOf(verifyCommit),
+			"verifyTag":             js.FuncOf(verifyTag),
+			"branchesContaining":    js.FuncOf(branchesContaining),
+			"tagsContaining":        js.FuncOf(tagsContaining),
+			"aheadBehind":           js.FuncOf(aheadBehind),
+			"setUpstream":           js.FuncOf(setUpstream),
+			"unsetUpstream":         js.FuncOf(unsetUpstream),
+			"getUpstream":           js.FuncOf(getUpstream),
+			"forEachRef":            js.FuncOf(forEachRef),
+		}),
+		"remote": js.ValueOf(map[string]interface{}{
+			"lsRemote": js.FuncOf(lsRemote),
 		}),
 	}))
 
@@ -254,6 +364,84 @@ func hashBlob(this js.Value, args []js.Value) interface{} {
 	return js.ValueOf(h.String())
 }
 
+// createHasher creates an incremental hasher for data supplied in chunks
+// Args: algorithm (optional, default: "sha1"), options (optional: { objectType, size })
+// Passing size (and optionally objectType, default "blob") prepends the Git
+// object header, so the result matches hashBlob over the whole content.
+// Returns: { update(chunk), finalize(), dispose() } or { error }
+func createHasher(this js.Value, args []js.Value) interface{} {
+	// Get algorithm (default to SHA-1)
+	algo := hash.SHA1
+	if len(args) >= 1 && args[0].Type() == js.TypeString {
+		parsed, err := hash.ParseAlgorithm(args[0].String())
+		if err != nil {
+			return jsError(err.Error())
+		}
+		algo = parsed
+	}
+
+	hasher, err := hash.NewHasher(algo)
+	if err != nil {
+		return jsError(err.Error())
+	}
+
+	// Parse options
+	ih := hash.NewIncrementalHasher(hasher)
+	if len(args) >= 2 && args[1].Type() == js.TypeObject {
+		optsJS := args[1]
+		if !optsJS.Get("size").IsUndefined() {
+			objectType := "blob"
+			if !optsJS.Get("objectType").IsUndefined() {
+				objectType = optsJS.Get("objectType").String()
+			}
+
+			ih, err = hash.NewObjectHasher(hasher, objectType, int64(optsJS.Get("size").Float()))
+			if err != nil {
+				return jsError(err.Error())
+			}
+		}
+	}
+
+	var update, finalize, dispose js.Func
+	release := func() {
+		update.Release()
+		finalize.Release()
+		dispose.Release()
+	}
+
+	update = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 1 {
+			return jsError("missing chunk argument")
+		}
+		if _, err := ih.Write(jsValueToBytes(args[0])); err != nil {
+			return jsError(err.Error())
+		}
+		return js.ValueOf(map[string]interface{}{
+			"written": ih.Written(),
+		})
+	})
+
+	finalize = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		h, err := ih.Sum()
+		if err != nil {
+			return jsError(err.Error())
+		}
+		release()
+		return js.ValueOf(h.String())
+	})
+
+	dispose = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		release()
+		return nil
+	})
+
+	return js.ValueOf(map[string]interface{}{
+		"update":   update,
+		"finalize": finalize,
+		"dispose":  dispose,
+	})
+}
+
 // jsValueToBytes converts a JS value to bytes
 // Handles both strings and Uint8Array
 func jsValueToBytes(val js.Value) []byte {
@@ -295,7 +483,8 @@ func createBlob(this js.Value, args []js.Value) interface{} {
 }
 
 // createTree creates a tree object
-// Args: entries (array of {mode, name, hash})
+// Args: entries (array of {mode, name, hash}); mode is a canonical string
+// such as "100644" or "040000" (numeric file modes are still accepted)
 // Returns: { type, size, hash } or { error }
 func createTree(this js.Value, args []js.Value) interface{} {
 	if len(args) < 1 {
@@ -321,7 +510,10 @@ func createTree(this js.Value, args []js.Value) interface{} {
 			return jsError("each entry must have mode, name, and hash")
 		}
 
-		mode := object.FileMode(modeJS.Int())
+		mode, err := jsToFileMode(modeJS)
+		if err != nil {
+			return jsError(fmt.Sprintf("entry %d: %s", i, err.Error()))
+		}
 		name := nameJS.String()
 		hashStr := hashJS.String()
 
@@ -528,23 +720,400 @@ func decompressObject(this js.Value, args []js.Value) interface{} {
 	return dst
 }
 
+// compressStream creates a TransformStream that zlib-compresses its input
+// Args: none
+// Returns: TransformStream ({ readable, writable }) or { error }
+func compressStream(this js.Value, args []js.Value) interface{} {
+	return newTransformStream(object.NewStreamCompressor())
+}
+
+// decompressStream creates a TransformStream that zlib-decompresses its input
+// Args: none
+// Returns: TransformStream ({ readable, writable }) or { error }
+func decompressStream(this js.Value, args []js.Value) interface{} {
+	return newTransformStream(object.NewStreamDecompressor())
+}
+
+// streamCodec is an incremental byte transform such as a stream compressor
+type streamCodec interface {
+	Write(p []byte) ([]byte, error)
+	Close() ([]byte, error)
+	Abort()
+}
+
+// newTransformStream wraps a codec in a JS TransformStream of Uint8Array chunks
+func newTransformStream(codec streamCodec) interface{} {
+	ctor := js.Global().Get("TransformStream")
+	if ctor.IsUndefined() {
+		return jsError("TransformStream is not supported in this environment")
+	}
+
+	var transform, flush, cancel js.Func
+	var releaseOnce sync.Once
+	release := func() {
+		releaseOnce.Do(func() {
+			transform.Release()
+			flush.Release()
+			cancel.Release()
+		})
+	}
+
+	// enqueue passes output downstream, failing the stream on error
+	enqueue := func(controller js.Value, out []byte, err error) {
+		if err != nil {
+			controller.Call("error", js.Global().Get("Error").New(err.Error()))
+			return
+		}
+		if len(out) > 0 {
+			chunk := js.Global().Get("Uint8Array").New(len(out))
+			js.CopyBytesToJS(chunk, out)
+			controller.Call("enqueue", chunk)
+		}
+	}
+
+	transform = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		out, err := codec.Write(jsValueToBytes(args[0]))
+		enqueue(args[1], out, err)
+		if err != nil {
+			codec.Abort()
+			release()
+		}
+		return nil
+	})
+
+	flush = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		out, err := codec.Close()
+		enqueue(args[0], out, err)
+		release()
+		return nil
+	})
+
+	// cancel runs when the readable side is cancelled or the writable side
+	// aborted, so neither flush nor an erroring transform will follow
+	cancel = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		codec.Abort()
+		release()
+		return nil
+	})
+
+	return ctor.New(map[string]interface{}{
+		"transform": transform,
+		"flush":     flush,
+		"cancel":    cancel,
+	})
+}
+
+// storageOnEvicted notifies a repository that its storage evicted objects
+// Args: repoPath (string), hashes (array of hex strings, optional - empty means unknown)
+// Returns: { success, fsck } or { error }
+func storageOnEvicted(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repoPath := args[0].String()
+
+	// Parse hashes array
+	var hashes []hash.Hash
+	if len(args) >= 2 && args[1].Type() == js.TypeObject {
+		length := args[1].Get("length").Int()
+		for i := 0; i < length; i++ {
+			h, err := hash.ParseHash(args[1].Index(i).String())
+			if err != nil {
+				return jsError("invalid hash: " + err.Error())
+			}
+			hashes = append(hashes, h)
+		}
+	}
+
+	// Open repository
+	repo, err := repository.Open(repoPath)
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	report, err := repo.OnStorageEvicted(hashes)
+	if err != nil {
+		return jsError("failed to handle eviction: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"fsck":    fsckReportToJS(report),
+	})
+}
+
+// storageOnCorruptionDetected notifies a repository that stored data is corrupt
+// Args: repoPath (string), hash (hex string, optional), message (string, optional)
+// Returns: { success, fsck } or { error }
+func storageOnCorruptionDetected(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repoPath := args[0].String()
+
+	var h hash.Hash
+	if len(args) >= 2 && args[1].Type() == js.TypeString && args[1].String() != "" {
+		parsed, err := hash.ParseHash(args[1].String())
+		if err != nil {
+			return jsError("invalid hash: " + err.Error())
+		}
+		h = parsed
+	}
+
+	message := "storage corruption detected"
+	if len(args) >= 3 && args[2].Type() == js.TypeString {
+		message = args[2].String()
+	}
+
+	// Open repository
+	repo, err := repository.Open(repoPath)
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	report, err := repo.OnCorruptionDetected(h, message)
+	if err != nil {
+		return jsError("failed to handle corruption: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"fsck":    fsckReportToJS(report),
+	})
+}
+
+// runScheduledFsck runs any queued object verification
+// Args: repoPath (string)
+// Returns: { success, fsck } or { error }
+func runScheduledFsck(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repoPath := args[0].String()
+
+	// Open repository
+	repo, err := repository.Open(repoPath)
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	report, err := repo.RunScheduledFsck()
+	if err != nil {
+		return jsError("failed to run fsck: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"fsck":    fsckReportToJS(report),
+	})
+}
+
+// subscribeEvents registers a callback for repository events
+// Args: callback (function receiving { type, gitDir, objects[], message, fsck })
+// Returns: { success, id } or { error }
+func subscribeEvents(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 || args[0].Type() != js.TypeFunction {
+		return jsError("missing callback argument")
+	}
+
+	callback := args[0]
+	id := repository.DefaultEventBus.Subscribe(func(event repository.Event) {
+		objects := make([]string, len(event.Objects))
+		for i, h := range event.Objects {
+			objects[i] = h.String()
+		}
+
+		callback.Invoke(map[string]interface{}{
+			"type":    string(event.Type),
+			"gitDir":  event.GitDir,
+			"objects": stringsToJS(objects),
+			"message": event.Message,
+			"fsck":    fsckReportToJS(event.Fsck),
+		})
+	})
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"id":      id,
+	})
+}
+
+// unsubscribeEvents removes a callback registered with subscribe
+// Args: id (number)
+// Returns: { success } or { error }
+func unsubscribeEvents(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing id argument")
+	}
+
+	repository.DefaultEventBus.Unsubscribe(args[0].Int())
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// registerHook registers a callback for a hook point such as pre-commit
+// Args: name (string), callback (function receiving { hook, gitDir, workTree, args[], stdin })
+// The callback vetoes pre-commit, commit-msg and pre-push by returning
+// false or a message string, or by throwing. It must return synchronously.
+// Returns: { success, id } or { error }
+func registerHook(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 || args[1].Type() != js.TypeFunction {
+		return jsError("missing name or callback arguments")
+	}
+
+	name, callback := repository.HookName(args[0].String()), args[1]
+	id := repository.DefaultHooks.Register(name, func(inv *repository.HookInvocation) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%v", r)
+			}
+		}()
+
+		result := callback.Invoke(map[string]interface{}{
+			"hook":     string(inv.Name),
+			"gitDir":   inv.GitDir,
+			"workTree": inv.WorkTree,
+			"args":     stringsToJS(inv.Args),
+			"stdin":    inv.Stdin,
+		})
+		switch {
+		case result.Type() == js.TypeObject && result.Get("then").Type() == js.TypeFunction:
+			return fmt.Errorf("hook must return synchronously, not a Promise")
+		case result.Type() == js.TypeBoolean && !result.Bool():
+			return fmt.Errorf("hook returned false")
+		case result.Type() == js.TypeString && result.String() != "":
+			return fmt.Errorf("%s", result.String())
+		}
+		return nil
+	})
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"id":      id,
+	})
+}
+
+// unregisterHook removes a hook callback
+// Args: id (number from registerHook)
+// Returns: { success } or { error }
+func unregisterHook(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing id argument")
+	}
+
+	repository.DefaultHooks.Unregister(args[0].Int())
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// fsckReportToJS converts an fsck report, which may be nil, to a JS value
+func fsckReportToJS(report *repository.FsckReport) interface{} {
+	if report == nil {
+		return nil
+	}
+
+	missing := make([]string, len(report.Missing))
+	for i, h := range report.Missing {
+		missing[i] = h.String()
+	}
+	corrupt := make([]string, len(report.Corrupt))
+	for i, h := range report.Corrupt {
+		corrupt[i] = h.String()
+	}
+	malformed := make([]string, len(report.Malformed))
+	for i, h := range report.Malformed {
+		malformed[i] = h.String()
+	}
+	dangling := make([]string, len(report.Dangling))
+	for i, h := range report.Dangling {
+		dangling[i] = h.String()
+	}
+
+	issues := make([]interface{}, len(report.Issues))
+	for i, issue := range report.Issues {
+		entry := map[string]interface{}{
+			"kind":    string(issue.Kind),
+			"type":    string(issue.Type),
+			"ref":     issue.Ref,
+			"message": issue.Message,
+		}
+		if issue.Hash != nil {
+			entry["hash"] = issue.Hash.String()
+		}
+		if issue.Referrer != nil {
+			entry["referrer"] = issue.Referrer.String()
+		}
+		issues[i] = entry
+	}
+
+	return map[string]interface{}{
+		"ok":         report.OK(),
+		"checked":    report.Checked,
+		"missing":    stringsToJS(missing),
+		"corrupt":    stringsToJS(corrupt),
+		"brokenRefs": stringsToJS(report.BrokenRefs),
+		"malformed":  stringsToJS(malformed),
+		"dangling":   stringsToJS(dangling),
+		"issues":     issues,
+	}
+}
+
 // Helper functions
 
+// jsToFileMode converts a tree entry mode from JS. Strings must be canonical
+// modes like "100644". Numbers may be the mode value itself (0o100644) or
+// its octal digits written as a decimal literal (100644).
+func jsToFileMode(v js.Value) (object.FileMode, error) {
+	switch v.Type() {
+	case js.TypeString:
+		return object.ParseFileMode(v.String())
+	case js.TypeNumber:
+		n := v.Int()
+		if n >= 0 && object.IsValidMode(object.FileMode(n)) {
+			return object.FileMode(n), nil
+		}
+		return object.ParseFileMode(strconv.Itoa(n))
+	default:
+		return 0, fmt.Errorf("mode must be a string such as \"100644\"")
+	}
+}
+
 func jsError(msg string) js.Value {
 	return js.ValueOf(map[string]interface{}{
 		"error": msg,
 	})
 }
 
+// stringsToJS converts a string slice to a value accepted by js.ValueOf
+func stringsToJS(values []string) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, v := range values {
+		result[i] = v
+	}
+	return result
+}
+
 func parseSignature(val js.Value) object.Signature {
 	name := val.Get("name").String()
 	email := val.Get("email").String()
-	timestamp := val.Get("timestamp").Int()
+
+	// The timestamp is optional and defaults to now
+	when := time.Now().UTC()
+	if !val.Get("timestamp").IsUndefined() {
+		when = time.Unix(int64(val.Get("timestamp").Int()), 0).UTC()
+	}
 
 	return object.Signature{
 		Name:  name,
 		Email: email,
-		When:  time.Unix(int64(timestamp), 0).UTC(),
+		When:  when,
 	}
 }
 
@@ -593,6 +1162,9 @@ func serializeObjectToJS(obj object.Object) js.Value {
 		}
 
 		result["message"] = o.Message
+		if o.GPGSignature != "" {
+			result["signature"] = o.GPGSignature
+		}
 
 	case *object.Tag:
 		result["target"] = o.Target.String()
@@ -604,6 +1176,9 @@ func serializeObjectToJS(obj object.Object) js.Value {
 			"timestamp": o.Tagger.When.Unix(),
 		}
 		result["message"] = o.Message
+		if o.GPGSignature != "" {
+			result["signature"] = o.GPGSignature
+		}
 	}
 
 	return js.ValueOf(result)
@@ -652,6 +1227,12 @@ func addFiles(this js.Value, args []js.Value) interface{} {
 		return jsError("failed to open repository: " + err.Error())
 	}
 
+	// Restrict additions to the sparse-checkout cone
+	opts.Sparse, err = repo.SparseCheckout()
+	if err != nil {
+		return jsError("failed to load sparse-checkout: " + err.Error())
+	}
+
 	// Load index
 	indexPath := filepath.Join(repo.GitDir, "index")
 	idx, err := index.Load(indexPath)
@@ -665,6 +1246,11 @@ func addFiles(this js.Value, args []js.Value) interface{} {
 		return jsError("failed to add files: " + err.Error())
 	}
 
+	// Store the staged content so it can be restored before it is committed
+	if err := idx.WriteBlobs(workTreePath, repo.ObjectDB); err != nil {
+		return jsError("failed to write blobs: " + err.Error())
+	}
+
 	// Save index
 	if err := idx.Save(indexPath); err != nil {
 		return jsError("failed to save index: " + err.Error())
@@ -677,9 +1263,21 @@ func addFiles(this js.Value, args []js.Value) interface{} {
 }
 
 // createCommitFromIndex creates a commit from the index
-// Args: repoPath (string), message (string), options (optional: { author: {name, email}, committer: {name, email} })
-// Returns: { success, commitHash } or { error }
+// Args: repoPath (string), message (string), options (optional: { author: {name, email}, committer: {name, email}, amend, force, allowEmpty, noVerify, signOff, signer, branch })
+// signer is called with the payload to sign (Uint8Array) and returns the
+// armored signature, or a Promise of it. On a detached HEAD, branch names a
+// branch to create at the new commit and put HEAD on; without it the
+// result carries a warning that the commit is on no branch.
+// Returns: { success, commitHash, branch?, detached?, warning? } or { error }, as a Promise when a signer is given
 func createCommitFromIndex(this js.Value, args []js.Value) interface{} {
+	if len(args) >= 3 && hasSigner(args[2]) {
+		return newPromise(func() interface{} { return commitFromIndex(args) })
+	}
+	return commitFromIndex(args)
+}
+
+// commitFromIndex implements createCommitFromIndex
+func commitFromIndex(args []js.Value) interface{} {
 	if len(args) < 2 {
 		return jsError("missing repoPath or message arguments")
 	}
@@ -693,23 +1291,48 @@ func createCommitFromIndex(this js.Value, args []js.Value) interface{} {
 		return jsError("failed to open repository: " + err.Error())
 	}
 
-	// Load index
-	indexPath := filepath.Join(repo.GitDir, "index")
-	idx, err := index.Load(indexPath)
-	if err != nil {
-		return jsError("failed to load index: " + err.Error())
-	}
-
 	// Parse options
 	var author, committer object.Signature
 	userName, userEmail := repo.Config.GetUser()
+	amend, allowEmpty, noVerify, signOff := false, false, false, false
+	branch := ""
+	var signer object.Signer
+	amendOpts := repository.DefaultAmendOptions()
+	amendOpts.Message = message
 
 	if len(args) >= 3 && args[2].Type() == js.TypeObject {
 		optsJS := args[2]
 
+		if !optsJS.Get("amend").IsUndefined() {
+			amend = optsJS.Get("amend").Bool()
+		}
+		if !optsJS.Get("force").IsUndefined() {
+			amendOpts.Force = optsJS.Get("force").Bool()
+		}
+		if !optsJS.Get("allowEmpty").IsUndefined() {
+			allowEmpty = optsJS.Get("allowEmpty").Bool()
+			amendOpts.AllowEmpty = allowEmpty
+		}
+		if !optsJS.Get("noVerify").IsUndefined() {
+			noVerify = optsJS.Get("noVerify").Bool()
+			amendOpts.NoVerify = noVerify
+		}
+		if !optsJS.Get("signOff").IsUndefined() {
+			signOff = optsJS.Get("signOff").Bool()
+			amendOpts.SignOff = signOff
+		}
+		if v := optsJS.Get("branch"); v.Type() == js.TypeString {
+			branch = v.String()
+		}
+		if hasSigner(optsJS) {
+			signer = jsSigner(optsJS.Get("signer"))
+			amendOpts.Signer = signer
+		}
+
 		// Parse author
 		if !optsJS.Get("author").IsUndefined() {
 			author = parseSignature(optsJS.Get("author"))
+			amendOpts.Author = &author
 		} else {
 			author = index.DefaultSignature(userName, userEmail)
 		}
@@ -717,6 +1340,7 @@ func createCommitFromIndex(this js.Value, args []js.Value) interface{} {
 		// Parse committer
 		if !optsJS.Get("committer").IsUndefined() {
 			committer = parseSignature(optsJS.Get("committer"))
+			amendOpts.Committer = &committer
 		} else {
 			committer = index.DefaultSignature(userName, userEmail)
 		}
@@ -725,13 +1349,60 @@ func createCommitFromIndex(this js.Value, args []js.Value) interface{} {
 		committer = index.DefaultSignature(userName, userEmail)
 	}
 
-	// Get parent commit
-	parents, err := index.GetParentCommit(repo)
+	// An amended commit replaces HEAD, keeping its parents and author.
+	// Rewriting a commit that was already pushed is refused unless forced.
+	if amend {
+		amended, err := repo.AmendCommit(amendOpts)
+		if err != nil {
+			return jsError("failed to amend: " + err.Error())
+		}
+
+		result := map[string]interface{}{
+			"success":    true,
+			"commitHash": amended.Commit.String(),
+		}
+		if amended.Warning != "" {
+			result["warning"] = amended.Warning
+		}
+		return js.ValueOf(result)
+	}
+
+	// Check the branch to keep a detached commit on before committing
+	detached, err := repo.DetachedHEAD()
 	if err != nil {
-		parents = nil // Initial commit has no parents
+		return jsError("failed to read HEAD: " + err.Error())
+	}
+	if detached != nil && branch != "" && repo.BranchExists(branch) {
+		return jsError("failed to commit: branch " + branch + " already exists")
 	}
 
-	// Write blobs to object database
+	if signOff {
+		if message, err = repository.AddSignOff(message, committer); err != nil {
+			return jsError("failed to commit: " + err.Error())
+		}
+	}
+
+	// Hooks may veto the commit or edit its message
+	if !noVerify {
+		if message, err = repo.RunCommitHooks(message); err != nil {
+			return jsError("failed to commit: " + err.Error())
+		}
+	}
+
+	// Load the index once hooks have had their chance to stage changes
+	indexPath := filepath.Join(repo.GitDir, "index")
+	idx, err := index.Load(indexPath)
+	if err != nil {
+		return jsError("failed to load index: " + err.Error())
+	}
+
+	// Get parent commit
+	parents, err := index.GetParentCommit(repo)
+	if err != nil {
+		parents = nil // Initial commit has no parents
+	}
+
+	// Write blobs to object database
 	workTreePath := repo.WorkTree()
 	if err := idx.WriteBlobs(workTreePath, repo.ObjectDB); err != nil {
 		return jsError("failed to write blobs: " + err.Error())
@@ -739,10 +1410,12 @@ func createCommitFromIndex(this js.Value, args []js.Value) interface{} {
 
 	// Create commit
 	commitOpts := index.CommitOptions{
-		Message:   message,
-		Author:    author,
-		Committer: committer,
-		Parents:   parents,
+		Message:    message,
+		Author:     author,
+		Committer:  committer,
+		Parents:    parents,
+		AllowEmpty: allowEmpty,
+		Signer:     signer,
 	}
 
 	commitHash, err := idx.CreateCommit(repo.Hasher, repo.ObjectDB, commitOpts)
@@ -750,29 +1423,37 @@ func createCommitFromIndex(this js.Value, args []js.Value) interface{} {
 		return jsError("failed to create commit: " + err.Error())
 	}
 
-	// Update HEAD
-	currentBranch, err := repo.CurrentBranch()
-	if err != nil {
-		// Detached HEAD - update HEAD directly
-		if err := repo.SetHEAD(commitHash.String()); err != nil {
-			return jsError("failed to update HEAD: " + err.Error())
-		}
-	} else {
-		// Update branch reference
-		if err := repo.UpdateRef("refs/heads/"+currentBranch, commitHash); err != nil {
-			return jsError("failed to update branch: " + err.Error())
-		}
+	// Update the current branch, or HEAD directly when detached
+	reflogKind := "commit"
+	if len(parents) == 0 {
+		reflogKind = "commit (initial)"
+	}
+	subject, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	if err := repo.UpdateHEAD(commitHash, reflogKind+": "+subject); err != nil {
+		return jsError("failed to update HEAD: " + err.Error())
 	}
 
-	return js.ValueOf(map[string]interface{}{
+	result := map[string]interface{}{
 		"success":    true,
 		"commitHash": commitHash.String(),
-	})
+	}
+	if detached != nil {
+		if branch != "" {
+			if err := repo.AttachHEAD(branch); err != nil {
+				return jsError("failed to create branch: " + err.Error())
+			}
+			result["branch"] = branch
+		} else {
+			result["detached"] = true
+			result["warning"] = repo.DetachedHEADWarning()
+		}
+	}
+	return js.ValueOf(result)
 }
 
 // getStatus gets the status of the repository
-// Args: repoPath (string), options (optional: { includeUntracked, includeIgnored })
-// Returns: { untracked[], modified[], staged[], deleted[], added[], isClean } or { error }
+// Args: repoPath (string), options (optional: { includeUntracked, includeIgnored, renames, porcelain: "v2" })
+// Returns: { head, branch, detached, detachedAt, upstream, ahead, behind, operation, untracked[], modified[], staged[], deleted[], added[], conflicted[], isClean, porcelain? } or { error } - detachedAt is the short hash of a detached HEAD
 func getStatus(this js.Value, args []js.Value) interface{} {
 	if len(args) < 1 {
 		return jsError("missing repoPath argument")
@@ -786,15 +1467,9 @@ func getStatus(this js.Value, args []js.Value) interface{} {
 		return jsError("failed to open repository: " + err.Error())
 	}
 
-	// Load index
-	indexPath := filepath.Join(repo.GitDir, "index")
-	idx, err := index.Load(indexPath)
-	if err != nil {
-		return jsError("failed to load index: " + err.Error())
-	}
-
 	// Parse options
 	opts := index.DefaultStatusOptions()
+	porcelain := ""
 	if len(args) >= 2 && args[1].Type() == js.TypeObject {
 		optsJS := args[1]
 		if !optsJS.Get("includeUntracked").IsUndefined() {
@@ -803,49 +1478,67 @@ func getStatus(this js.Value, args []js.Value) interface{} {
 		if !optsJS.Get("includeIgnored").IsUndefined() {
 			opts.IncludeIgnored = optsJS.Get("includeIgnored").Bool()
 		}
-	}
-
-	// Get HEAD commit
-	var headCommit *object.Commit
-	headStr, err := repo.HEAD()
-	if err == nil {
-		// Try to resolve HEAD
-		var commitHash hash.Hash
-		if headStr[:5] == "ref: " {
-			// Symbolic ref
-			refName := headStr[5:]
-			commitHash, err = repo.ResolveRef(refName)
-		} else {
-			// Direct hash
-			commitHash, err = hash.ParseHash(headStr)
+		if !optsJS.Get("renames").IsUndefined() {
+			opts.Renames = optsJS.Get("renames").Bool()
 		}
-
-		if err == nil {
-			// Load commit
-			obj, err := repo.ObjectDB.Get(commitHash)
-			if err == nil {
-				headCommit, _ = obj.(*object.Commit)
+		if v := optsJS.Get("porcelain"); !v.IsUndefined() && v.Type() != js.TypeNull {
+			if porcelain = v.String(); porcelain != "v2" {
+				return jsError("unsupported porcelain format: " + porcelain)
+			}
+			// git status reports renames in porcelain output by default
+			if optsJS.Get("renames").IsUndefined() {
+				opts.Renames = true
 			}
 		}
 	}
 
-	// Get status
-	workTreePath := repo.WorkTree()
-	status, err := index.GetStatus(workTreePath, idx, headCommit, repo.ObjectDB, opts)
+	// Get status, including the branch and upstream headers
+	status, err := repo.Status(opts)
 	if err != nil {
 		return jsError("failed to get status: " + err.Error())
 	}
 
-	return js.ValueOf(map[string]interface{}{
+	var head, detachedAt interface{}
+	if status.Head != nil {
+		head = status.Head.String()
+		if status.Detached {
+			detachedAt = status.Head.String()[:7]
+		}
+	}
+	var upstream interface{}
+	if status.Upstream != nil {
+		upstream = map[string]interface{}{
+			"remote":      status.Upstream.Remote,
+			"merge":       status.Upstream.Merge,
+			"trackingRef": status.Upstream.TrackingRef(),
+			"gone":        status.UpstreamGone,
+		}
+	}
+
+	result := map[string]interface{}{
 		"success":    true,
-		"untracked":  status.Untracked,
-		"modified":   status.Modified,
-		"staged":     status.Staged,
-		"deleted":    status.Deleted,
-		"added":      status.Added,
+		"head":       head,
+		"branch":     status.Branch,
+		"detached":   status.Detached,
+		"detachedAt": detachedAt,
+		"upstream":   upstream,
+		"ahead":      status.Ahead,
+		"behind":     status.Behind,
+		"operation":  string(status.Operation.Operation),
+		"untracked":  stringsToJS(status.Untracked),
+		"modified":   stringsToJS(status.Modified),
+		"staged":     stringsToJS(status.Staged),
+		"deleted":    stringsToJS(status.Deleted),
+		"added":      stringsToJS(status.Added),
 		"isClean":    status.IsClean(),
+		"conflicted": stringsToJS(status.Conflicted),
 		"hasChanges": status.HasChanges(),
-	})
+	}
+	if porcelain != "" {
+		result["porcelain"] = status.PorcelainV2()
+	}
+
+	return js.ValueOf(result)
 }
 
 // listBranches lists all branches in the repository
@@ -878,7 +1571,7 @@ func listBranches(this js.Value, args []js.Value) interface{} {
 
 	return js.ValueOf(map[string]interface{}{
 		"success":       true,
-		"branches":      branches,
+		"branches":      stringsToJS(branches),
 		"currentBranch": currentBranch,
 	})
 }
@@ -1000,9 +1693,10 @@ func renameBranch(this js.Value, args []js.Value) interface{} {
 	})
 }
 
-// currentBranch returns the current branch
+// currentBranch returns the current branch, or the commit a detached HEAD
+// is at
 // Args: repoPath (string)
-// Returns: { success, branchName } or { error, detached: true }
+// Returns: { success, branchName, detached, head?, detachedAt? } or { error } - branchName is empty and head and detachedAt (the short hash) are set when detached
 func currentBranch(this js.Value, args []js.Value) interface{} {
 	if len(args) < 1 {
 		return jsError("missing repoPath argument")
@@ -1018,24 +1712,33 @@ func currentBranch(this js.Value, args []js.Value) interface{} {
 
 	// Get current branch
 	branchName, err := repo.CurrentBranch()
-	if err != nil {
-		// Detached HEAD
+	if errors.Is(err, repository.ErrDetachedHEAD) {
+		head, err := repo.DetachedHEAD()
+		if err != nil {
+			return jsError("failed to read HEAD: " + err.Error())
+		}
 		return js.ValueOf(map[string]interface{}{
-			"success":  false,
-			"detached": true,
-			"error":    err.Error(),
+			"success":    true,
+			"branchName": "",
+			"detached":   true,
+			"head":       head.String(),
+			"detachedAt": head.String()[:7],
 		})
 	}
+	if err != nil {
+		return jsError("failed to read current branch: " + err.Error())
+	}
 
 	return js.ValueOf(map[string]interface{}{
 		"success":    true,
 		"branchName": branchName,
+		"detached":   false,
 	})
 }
 
 // checkout checks out a branch or commit
 // Args: repoPath (string), target (string), options (optional: { force, createBranch, detach })
-// Returns: { success, target, detached } or { error }
+// Returns: { success, target, detached, detachedAt? } or { error } - target may be any revision, such as a tag or HEAD~2, which detaches HEAD
 func checkout(this js.Value, args []js.Value) interface{} {
 	if len(args) < 2 {
 		return jsError("missing repoPath or target arguments")
@@ -1071,17 +1774,19 @@ func checkout(this js.Value, args []js.Value) interface{} {
 	}
 
 	// Check if result is detached
-	isDetached := false
-	_, err = repo.CurrentBranch()
+	head, err := repo.DetachedHEAD()
 	if err != nil {
-		isDetached = true
+		return jsError("failed to read HEAD: " + err.Error())
 	}
-
-	return js.ValueOf(map[string]interface{}{
+	result := map[string]interface{}{
 		"success":  true,
 		"target":   target,
-		"detached": isDetached,
-	})
+		"detached": head != nil,
+	}
+	if head != nil {
+		result["detachedAt"] = head.String()[:7]
+	}
+	return js.ValueOf(result)
 }
 
 // checkoutFile checks out a single file from the index
@@ -1112,9 +1817,136 @@ func checkoutFile(this js.Value, args []js.Value) interface{} {
 	})
 }
 
+// verifyCheckout compares the worktree against HEAD's tree
+// Args: repoPath (string)
+// Returns: { success, clean, modified[], missing[], untracked[] } or { error }
+func verifyCheckout(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repoPath := args[0].String()
+
+	// Open repository
+	repo, err := repository.Open(repoPath)
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	// Verify checkout
+	result, err := repo.VerifyCheckout()
+	if err != nil {
+		return jsError("failed to verify checkout: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success":   true,
+		"clean":     result.Clean,
+		"modified":  stringsToJS(result.Modified),
+		"missing":   stringsToJS(result.Missing),
+		"untracked": stringsToJS(result.Untracked),
+	})
+}
+
+// sparseCheckoutSet enables cone-mode sparse-checkout for a set of directories
+// Args: repoPath (string), directories (array of strings)
+// Returns: { success, directories[] } or { error }
+func sparseCheckoutSet(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing repoPath or directories arguments")
+	}
+
+	repoPath := args[0].String()
+	dirsJS := args[1]
+
+	// Parse directories array
+	if dirsJS.Type() != js.TypeObject || dirsJS.Get("length").IsUndefined() {
+		return jsError("directories must be an array")
+	}
+
+	length := dirsJS.Get("length").Int()
+	dirs := make([]string, length)
+	for i := 0; i < length; i++ {
+		dirs[i] = dirsJS.Index(i).String()
+	}
+
+	// Open repository
+	repo, err := repository.Open(repoPath)
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	if err := repo.SetSparseCheckout(dirs); err != nil {
+		return jsError("failed to set sparse-checkout: " + err.Error())
+	}
+
+	return sparseCheckoutList(this, args[:1])
+}
+
+// sparseCheckoutList returns the active sparse-checkout directories
+// Args: repoPath (string)
+// Returns: { success, enabled, directories[] } or { error }
+func sparseCheckoutList(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repoPath := args[0].String()
+
+	// Open repository
+	repo, err := repository.Open(repoPath)
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	sparse, err := repo.SparseCheckout()
+	if err != nil {
+		return jsError("failed to load sparse-checkout: " + err.Error())
+	}
+
+	if sparse == nil {
+		return js.ValueOf(map[string]interface{}{
+			"success":     true,
+			"enabled":     false,
+			"directories": []interface{}{},
+		})
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success":     true,
+		"enabled":     true,
+		"directories": stringsToJS(sparse.Directories()),
+	})
+}
+
+// sparseCheckoutDisable turns sparse-checkout off and restores all files
+// Args: repoPath (string)
+// Returns: { success } or { error }
+func sparseCheckoutDisable(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repoPath := args[0].String()
+
+	// Open repository
+	repo, err := repository.Open(repoPath)
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	if err := repo.DisableSparseCheckout(); err != nil {
+		return jsError("failed to disable sparse-checkout: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+	})
+}
+
 // getLog returns commit history
-// Args: repoPath (string), ref (string, optional - defaults to HEAD), options (optional: { maxCount, author, since, until, format, graph })
-// Returns: { success, commits[] } or { error }
+// Args: repoPath (string), ref (string, optional - defaults to HEAD), options (optional: { maxCount, author, committer, grep, allMatch, invertGrep, ignoreCase, fixedStrings, path, follow, since, until, format, order, graph, notesRef, useMailmap })
+// Returns: { success, commits[] } or { error }; commits have formatted text when a format is given
 func getLog(this js.Value, args []js.Value) interface{} {
 	if len(args) < 1 {
 		return jsError("missing repoPath argument")
@@ -1136,32 +1968,10 @@ func getLog(this js.Value, args []js.Value) interface{} {
 
 	// Parse options
 	opts := repository.DefaultLogOptions()
+	formatted := false
 	if len(args) >= 3 && args[2].Type() == js.TypeObject {
-		optsJS := args[2]
-
-		if !optsJS.Get("maxCount").IsUndefined() {
-			opts.MaxCount = optsJS.Get("maxCount").Int()
-		}
-		if !optsJS.Get("author").IsUndefined() {
-			opts.Author = optsJS.Get("author").String()
-		}
-		if !optsJS.Get("format").IsUndefined() {
-			formatStr := optsJS.Get("format").String()
-			switch formatStr {
-			case "oneline":
-				opts.Format = repository.LogFormatOneline
-			case "short":
-				opts.Format = repository.LogFormatShort
-			default:
-				opts.Format = repository.LogFormatFull
-			}
-		}
-		if !optsJS.Get("graph").IsUndefined() {
-			opts.Graph = optsJS.Get("graph").Bool()
-		}
-		if !optsJS.Get("all").IsUndefined() {
-			opts.All = optsJS.Get("all").Bool()
-		}
+		opts = parseLogOptions(args[2])
+		formatted = !args[2].Get("format").IsUndefined()
 	}
 
 	// Get log
@@ -1173,21 +1983,7 @@ func getLog(this js.Value, args []js.Value) interface{} {
 	// Convert entries to JS
 	jsEntries := make([]interface{}, len(entries))
 	for i, entry := range entries {
-		jsEntries[i] = map[string]interface{}{
-			"hash":    entry.Hash.String(),
-			"author":  entry.Commit.Author.Name,
-			"email":   entry.Commit.Author.Email,
-			"date":    entry.Commit.Author.When.Unix(),
-			"message": entry.Commit.Message,
-			"parents": func() []interface{} {
-				parents := make([]interface{}, len(entry.Parents))
-				for j, p := range entry.Parents {
-					parents[j] = p.String()
-				}
-				return parents
-			}(),
-			"refs": entry.Refs,
-		}
+		jsEntries[i] = logEntryToJS(entry, opts, formatted)
 	}
 
 	return js.ValueOf(map[string]interface{}{
@@ -1247,7 +2043,8 @@ func getCommitByHash(this js.Value, args []js.Value) interface{} {
 }
 
 // getBlame returns line-by-line history for a file
-// Args: repoPath (string), path (string), ref (string, optional - defaults to HEAD), options (optional: { startLine, endLine })
+// Args: repoPath (string), path (string), ref (string, optional - defaults to HEAD), options (optional: { startLine, endLine, useMailmap, detectMoves, moveScore, copyLevel, copyScore, onProgress })
+// onProgress is called with the lines of each commit as soon as they are attributed to it
 // Returns: { success, lines[] } or { error }
 func getBlame(this js.Value, args []js.Value) interface{} {
 	if len(args) < 2 {
@@ -1310,6 +2107,26 @@ func getBlame(this js.Value, args []js.Value) interface{} {
 		if !optsJS.Get("endLine").IsUndefined() {
 			opts.EndLine = optsJS.Get("endLine").Int()
 		}
+		if !optsJS.Get("useMailmap").IsUndefined() {
+			opts.UseMailmap = optsJS.Get("useMailmap").Bool()
+		}
+		if !optsJS.Get("detectMoves").IsUndefined() {
+			opts.DetectMoves = optsJS.Get("detectMoves").Bool()
+		}
+		if !optsJS.Get("moveScore").IsUndefined() {
+			opts.MoveScore = optsJS.Get("moveScore").Int()
+		}
+		if !optsJS.Get("copyLevel").IsUndefined() {
+			opts.CopyLevel = optsJS.Get("copyLevel").Int()
+		}
+		if !optsJS.Get("copyScore").IsUndefined() {
+			opts.CopyScore = optsJS.Get("copyScore").Int()
+		}
+		if onProgress := optsJS.Get("onProgress"); onProgress.Type() == js.TypeFunction {
+			opts.IncrementalCallback = func(lines []*repository.BlameLine) {
+				onProgress.Invoke(blameLinesToJS(lines))
+			}
+		}
 	}
 
 	// Get blame
@@ -1318,12 +2135,21 @@ func getBlame(this js.Value, args []js.Value) interface{} {
 		return jsError("failed to get blame: " + err.Error())
 	}
 
-	// Convert to JS
-	jsLines := make([]interface{}, len(blameLines))
-	for i, line := range blameLines {
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"lines":   blameLinesToJS(blameLines),
+	})
+}
+
+// blameLinesToJS converts blame lines to JS objects
+func blameLinesToJS(lines []*repository.BlameLine) []interface{} {
+	jsLines := make([]interface{}, len(lines))
+	for i, line := range lines {
 		jsLines[i] = map[string]interface{}{
-			"lineNumber": line.LineNumber,
-			"content":    line.Content,
+			"lineNumber":         line.LineNumber,
+			"originalLineNumber": line.OriginalLineNumber,
+			"path":               line.Path,
+			"content":            line.Content,
 			"commit": map[string]interface{}{
 				"hash":    line.CommitHash.String(),
 				"author":  line.Commit.Author.Name,
@@ -1333,9 +2159,3583 @@ func getBlame(this js.Value, args []js.Value) interface{} {
 			},
 		}
 	}
+	return jsLines
+}
+
+// operationState reports the multi-step operation in progress
+// Args: repoPath (string)
+// Returns: { success, operation, inProgress, step, total, remaining, head, branch, conflicts[], continuations[] } or { error }
+func operationState(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	state, err := repo.OperationState()
+	if err != nil {
+		return jsError("failed to read operation state: " + err.Error())
+	}
+
+	head := ""
+	if state.Head != nil {
+		head = state.Head.String()
+	}
+
+	continuations := make([]string, len(state.Continuations))
+	for i, c := range state.Continuations {
+		continuations[i] = string(c)
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success":       true,
+		"operation":     string(state.Operation),
+		"inProgress":    state.InProgress(),
+		"step":          state.Step,
+		"total":         state.Total,
+		"remaining":     state.Remaining,
+		"head":          head,
+		"branch":        state.Branch,
+		"conflicts":     stringsToJS(state.Conflicts),
+		"continuations": stringsToJS(continuations),
+	})
+}
+
+// bundleCreate writes a bundle file with the given refs and their history
+// Args: repoPath (string), refs (string[]), bundlePath (string)
+// Returns: { success } or { error }
+func bundleCreate(this js.Value, args []js.Value) interface{} {
+	if len(args) < 3 {
+		return jsError("missing arguments: repoPath, refs, bundlePath")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	refs := make([]string, args[1].Length())
+	for i := range refs {
+		refs[i] = args[1].Index(i).String()
+	}
+
+	if err := repo.BundleCreate(refs, args[2].String()); err != nil {
+		return jsError("failed to create bundle: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// unbundle stores the objects from a bundle file without updating refs
+// Args: repoPath (string), bundlePath (string)
+// Returns: { success, refs: [{ name, hash }] } or { error }
+func unbundle(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing arguments: repoPath, bundlePath")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	refs, err := repo.Unbundle(args[1].String())
+	if err != nil {
+		return jsError("failed to unbundle: " + err.Error())
+	}
+
+	refList := make([]interface{}, len(refs))
+	for i, ref := range refs {
+		refList[i] = map[string]interface{}{
+			"name": ref.Name,
+			"hash": ref.Hash,
+		}
+	}
 
 	return js.ValueOf(map[string]interface{}{
 		"success": true,
-		"lines":   jsLines,
+		"refs":    refList,
+	})
+}
+
+// getReflog returns the reflog of a ref, newest entry first
+// Args: repoPath (string), ref (optional string, default "HEAD")
+// Returns: { success, entries: [{ old, new, name, email, timestamp, message }] } or { error }
+func getReflog(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	ref := "HEAD"
+	if len(args) >= 2 && args[1].Type() == js.TypeString {
+		ref = args[1].String()
+	}
+
+	entries, err := repo.Reflog(ref)
+	if err != nil {
+		return jsError("failed to read reflog: " + err.Error())
+	}
+
+	entryList := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		entryList[i] = map[string]interface{}{
+			"old":       entry.Old.String(),
+			"new":       entry.New.String(),
+			"name":      entry.Committer.Name,
+			"email":     entry.Committer.Email,
+			"timestamp": entry.Committer.When.Unix(),
+			"message":   entry.Message,
+		}
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"entries": entryList,
+	})
+}
+
+// undo reverts the last ref-moving operation, or aborts one in progress
+// Args: repoPath (string), options (optional: { dryRun, force })
+// Returns: { success, ref, from, to, abort, step, description } or { error }
+func undo(this js.Value, args []js.Value) interface{} {
+	return runUndoAction(args, func(repo *repository.Repository, opts repository.UndoOptions) (*repository.UndoAction, error) {
+		return repo.Undo(opts)
+	})
+}
+
+// redo re-applies the most recent undo
+// Args: repoPath (string), options (optional: { dryRun, force })
+// Returns: { success, ref, from, to, abort, step, description } or { error }
+func redo(this js.Value, args []js.Value) interface{} {
+	return runUndoAction(args, func(repo *repository.Repository, opts repository.UndoOptions) (*repository.UndoAction, error) {
+		return repo.Redo(opts)
+	})
+}
+
+// runUndoAction parses undo options, runs an undo or redo and converts the result
+func runUndoAction(args []js.Value, run func(*repository.Repository, repository.UndoOptions) (*repository.UndoAction, error)) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	opts := repository.DefaultUndoOptions()
+	if len(args) >= 2 && args[1].Type() == js.TypeObject {
+		optsJS := args[1]
+		if !optsJS.Get("dryRun").IsUndefined() {
+			opts.DryRun = optsJS.Get("dryRun").Bool()
+		}
+		if !optsJS.Get("force").IsUndefined() {
+			opts.Force = optsJS.Get("force").Bool()
+		}
+	}
+
+	action, err := run(repo, opts)
+	if err != nil {
+		return jsError(err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success":     true,
+		"ref":         action.Ref,
+		"from":        action.From.String(),
+		"to":          action.To.String(),
+		"abort":       string(action.Abort),
+		"step":        action.Step,
+		"description": action.Description,
+	})
+}
+
+// archive exports a snapshot of a commit or tree as a tar, tar.gz or zip file
+// Args: repoPath (string), commitish (string), format ("tar" | "tar.gz" | "zip"), prefix (optional string)
+// Returns: Uint8Array or { error }
+func archive(this js.Value, args []js.Value) interface{} {
+	if len(args) < 3 {
+		return jsError("missing arguments: repoPath, commitish, format")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	prefix := ""
+	if len(args) >= 4 && args[3].Type() == js.TypeString {
+		prefix = args[3].String()
+	}
+
+	var buf bytes.Buffer
+	if err := repo.Archive(args[1].String(), repository.ArchiveFormat(args[2].String()), prefix, &buf); err != nil {
+		return jsError("failed to create archive: " + err.Error())
+	}
+
+	dst := js.Global().Get("Uint8Array").New(buf.Len())
+	js.CopyBytesToJS(dst, buf.Bytes())
+	return dst
+}
+
+// prepareCommit describes the commit that would be created from the index,
+// for populating commit dialogs
+// Args: repoPath (string), options (optional object: { verbose, includeUntracked })
+// Returns: { success, branch, head, parents, merging, files, insertions, deletions, diffStat, conflicts, unmerged, notStaged, untracked, template } or { error }
+func prepareCommit(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	opts := repository.DefaultPrepareCommitOptions()
+	if len(args) >= 2 && args[1].Type() == js.TypeObject {
+		optsJS := args[1]
+		if !optsJS.Get("verbose").IsUndefined() {
+			opts.Verbose = optsJS.Get("verbose").Bool()
+		}
+		if !optsJS.Get("includeUntracked").IsUndefined() {
+			opts.IncludeUntracked = optsJS.Get("includeUntracked").Bool()
+		}
+	}
+
+	prep, err := repo.PrepareCommit(opts)
+	if err != nil {
+		return jsError("failed to prepare commit: " + err.Error())
+	}
+
+	hashString := func(h hash.Hash) string {
+		if h == nil {
+			return ""
+		}
+		return h.String()
+	}
+
+	parents := make([]interface{}, len(prep.Parents))
+	for i, parent := range prep.Parents {
+		parents[i] = parent.String()
+	}
+
+	files := make([]interface{}, len(prep.Files))
+	for i, file := range prep.Files {
+		files[i] = map[string]interface{}{
+			"path":       file.Path,
+			"change":     string(file.Change),
+			"oldHash":    hashString(file.OldHash),
+			"newHash":    hashString(file.NewHash),
+			"insertions": file.Insertions,
+			"deletions":  file.Deletions,
+			"binary":     file.Binary,
+		}
+	}
+
+	notStaged := make([]interface{}, len(prep.NotStaged))
+	for i, file := range prep.NotStaged {
+		notStaged[i] = map[string]interface{}{
+			"path":   file.Path,
+			"change": string(file.Change),
+		}
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success":    true,
+		"branch":     prep.Branch,
+		"head":       hashString(prep.Head),
+		"parents":    parents,
+		"merging":    prep.Merging,
+		"files":      files,
+		"insertions": prep.Insertions,
+		"deletions":  prep.Deletions,
+		"diffStat":   prep.DiffStat(),
+		"conflicts":  stringsToJS(prep.Conflicts),
+		"unmerged":   stringsToJS(prep.Unmerged),
+		"notStaged":  notStaged,
+		"untracked":  stringsToJS(prep.Untracked),
+		"template":   prep.Template,
+	})
+}
+
+// fsck verifies object hashes, parsing, ref targets and connectivity
+// Args: repoPath (string), options (optional object: { connectivity, dangling, reflogs })
+// Returns: { success, fsck } or { error }
+func fsck(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	opts := repository.DefaultFsckOptions()
+	if len(args) >= 2 && args[1].Type() == js.TypeObject {
+		optsJS := args[1]
+		if !optsJS.Get("connectivity").IsUndefined() {
+			opts.Connectivity = optsJS.Get("connectivity").Bool()
+		}
+		if !optsJS.Get("dangling").IsUndefined() {
+			opts.Dangling = optsJS.Get("dangling").Bool()
+		}
+		if !optsJS.Get("reflogs").IsUndefined() {
+			opts.Reflogs = optsJS.Get("reflogs").Bool()
+		}
+	}
+
+	report, err := repo.Fsck(opts)
+	if err != nil {
+		return jsError("failed to run fsck: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"fsck":    fsckReportToJS(report),
+	})
+}
+
+// exportRefs captures HEAD and all refs as a JSON document
+// Args: repoPath (string)
+// Returns: { success, snapshot (JSON string) } or { error }
+func exportRefs(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	snapshot, err := repo.ExportRefs()
+	if err != nil {
+		return jsError("failed to export refs: " + err.Error())
+	}
+	data, err := snapshot.Marshal()
+	if err != nil {
+		return jsError(err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success":  true,
+		"snapshot": string(data),
+	})
+}
+
+// importRefs applies a JSON document written by exportRefs
+// Args: repoPath (string), snapshot (JSON string), options (optional object: { prune, updateHead, allowMissing })
+// Returns: { success, updated[], deleted[], headUpdated } or { error }
+func importRefs(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing arguments: repoPath, snapshot")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	snapshot, err := repository.ParseRefSnapshot([]byte(args[1].String()))
+	if err != nil {
+		return jsError(err.Error())
+	}
+
+	opts := repository.DefaultImportRefsOptions()
+	if len(args) >= 3 && args[2].Type() == js.TypeObject {
+		optsJS := args[2]
+		if !optsJS.Get("prune").IsUndefined() {
+			opts.Prune = optsJS.Get("prune").Bool()
+		}
+		if !optsJS.Get("updateHead").IsUndefined() {
+			opts.UpdateHEAD = optsJS.Get("updateHead").Bool()
+		}
+		if !optsJS.Get("allowMissing").IsUndefined() {
+			opts.AllowMissing = optsJS.Get("allowMissing").Bool()
+		}
+	}
+
+	result, err := repo.ImportRefs(snapshot, opts)
+	if err != nil {
+		return jsError("failed to import refs: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success":     true,
+		"updated":     stringsToJS(result.Updated),
+		"deleted":     stringsToJS(result.Deleted),
+		"headUpdated": result.HeadUpdated,
+	})
+}
+
+// gc expires reflogs, prunes unreachable objects and optionally repacks
+// Args: repoPath (string), options (optional object: { reflogExpireDays, reflogExpireUnreachableDays, pruneExpireDays, repack, dryRun })
+// Returns: { success, reflogEntriesExpired, pruned[], packPath, packed, loosened, looseObjects } or { error }
+func gc(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing argument: repoPath")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	opts := repository.DefaultGCOptions()
+	if len(args) >= 2 && args[1].Type() == js.TypeObject {
+		optsJS := args[1]
+		day := 24 * time.Hour
+		if !optsJS.Get("reflogExpireDays").IsUndefined() {
+			opts.ReflogExpire = time.Duration(optsJS.Get("reflogExpireDays").Float() * float64(day))
+		}
+		if !optsJS.Get("reflogExpireUnreachableDays").IsUndefined() {
+			opts.ReflogExpireUnreachable = time.Duration(optsJS.Get("reflogExpireUnreachableDays").Float() * float64(day))
+		}
+		if !optsJS.Get("pruneExpireDays").IsUndefined() {
+			opts.PruneExpire = time.Duration(optsJS.Get("pruneExpireDays").Float() * float64(day))
+		}
+		if !optsJS.Get("repack").IsUndefined() {
+			opts.Repack = optsJS.Get("repack").Bool()
+		}
+		if !optsJS.Get("dryRun").IsUndefined() {
+			opts.DryRun = optsJS.Get("dryRun").Bool()
+		}
+	}
+
+	result, err := repo.GC(opts)
+	if err != nil {
+		return jsError("failed to run gc: " + err.Error())
+	}
+
+	pruned := make([]interface{}, len(result.Pruned))
+	for i, h := range result.Pruned {
+		pruned[i] = h.String()
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success":              true,
+		"reflogEntriesExpired": result.ReflogEntriesExpired,
+		"pruned":               pruned,
+		"packPath":             result.PackPath,
+		"packed":               result.Packed,
+		"loosened":             result.Loosened,
+		"looseObjects":         result.LooseObjects,
+	})
+}
+
+// stats reports object counts, storage size and ref counts
+// Args: repoPath (string)
+// Returns: { success, looseObjects, looseSize, inPack, packs, packSize, totalSize, branches, remoteBranches, tags, otherRefs } or { error }
+func stats(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing argument: repoPath")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	result, err := repo.Stats()
+	if err != nil {
+		return jsError("failed to get stats: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success":        true,
+		"looseObjects":   result.LooseObjects,
+		"looseSize":      result.LooseSize,
+		"inPack":         result.InPack,
+		"packs":          result.Packs,
+		"packSize":       result.PackSize,
+		"totalSize":      result.TotalSize,
+		"branches":       result.Branches,
+		"remoteBranches": result.RemoteBranches,
+		"tags":           result.Tags,
+		"otherRefs":      result.OtherRefs,
+	})
+}
+
+// clean removes untracked files from the worktree, listing them only by default
+// Args: repoPath (string), options (optional object: { dryRun, directories, ignored, onlyIgnored })
+// Returns: { success, removed[], dryRun } or { error }
+func clean(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing argument: repoPath")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	opts := repository.DefaultCleanOptions()
+	if len(args) >= 2 && args[1].Type() == js.TypeObject {
+		optsJS := args[1]
+		if !optsJS.Get("dryRun").IsUndefined() {
+			opts.DryRun = optsJS.Get("dryRun").Bool()
+		}
+		if !optsJS.Get("directories").IsUndefined() {
+			opts.Directories = optsJS.Get("directories").Bool()
+		}
+		if !optsJS.Get("ignored").IsUndefined() {
+			opts.Ignored = optsJS.Get("ignored").Bool()
+		}
+		if !optsJS.Get("onlyIgnored").IsUndefined() {
+			opts.OnlyIgnored = optsJS.Get("onlyIgnored").Bool()
+		}
+	}
+
+	result, err := repo.Clean(opts)
+	if err != nil {
+		return jsError("failed to clean: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"removed": stringsToJS(result.Removed),
+		"dryRun":  result.DryRun,
+	})
+}
+
+// remove removes files from the index and the worktree, like git rm
+// Args: repoPath (string), paths (string[]), options (optional object: { cached, force, recursive, ignoreUnmatch, dryRun })
+// Returns: { success, removed[] } or { error }
+func remove(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing repoPath or paths arguments")
+	}
+
+	pathsJS := args[1]
+	if pathsJS.Type() != js.TypeObject || pathsJS.Get("length").IsUndefined() {
+		return jsError("paths must be an array")
+	}
+	paths := make([]string, pathsJS.Get("length").Int())
+	for i := range paths {
+		paths[i] = pathsJS.Index(i).String()
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	opts := repository.DefaultRemoveOptions()
+	if len(args) >= 3 && args[2].Type() == js.TypeObject {
+		optsJS := args[2]
+		if !optsJS.Get("cached").IsUndefined() {
+			opts.Cached = optsJS.Get("cached").Bool()
+		}
+		if !optsJS.Get("force").IsUndefined() {
+			opts.Force = optsJS.Get("force").Bool()
+		}
+		if !optsJS.Get("recursive").IsUndefined() {
+			opts.Recursive = optsJS.Get("recursive").Bool()
+		}
+		if !optsJS.Get("ignoreUnmatch").IsUndefined() {
+			opts.IgnoreUnmatch = optsJS.Get("ignoreUnmatch").Bool()
+		}
+		if !optsJS.Get("dryRun").IsUndefined() {
+			opts.DryRun = optsJS.Get("dryRun").Bool()
+		}
+	}
+
+	result, err := repo.Remove(paths, opts)
+	if err != nil {
+		return jsError("failed to remove files: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"removed": stringsToJS(result.Removed),
+	})
+}
+
+// move renames a tracked file or directory in the worktree and the index, like git mv
+// Args: repoPath (string), source (string), destination (string)
+// Returns: { success, source, destination, moved[{ from, to }] } or { error }
+func move(this js.Value, args []js.Value) interface{} {
+	if len(args) < 3 {
+		return jsError("missing repoPath, source or destination arguments")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	result, err := repo.Move(args[1].String(), args[2].String())
+	if err != nil {
+		return jsError("failed to move: " + err.Error())
+	}
+
+	moved := make([]interface{}, len(result.Moved))
+	for i, m := range result.Moved {
+		moved[i] = map[string]interface{}{
+			"from": m.From,
+			"to":   m.To,
+		}
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success":     true,
+		"source":      result.Source,
+		"destination": result.Destination,
+		"moved":       moved,
+	})
+}
+
+// newPromise runs fn on its own goroutine and returns a Promise resolved
+// with its result. Bindings that do network I/O must use it, since a
+// blocking call inside a js.FuncOf callback deadlocks the event loop.
+func newPromise(fn func() interface{}) interface{} {
+	var executor js.Func
+	executor = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		resolve := args[0]
+		go func() {
+			defer executor.Release()
+			resolve.Invoke(fn())
+		}()
+		return nil
+	})
+	return js.Global().Get("Promise").New(executor)
+}
+
+// hasSigner reports whether a binding's options carry a signer function
+func hasSigner(optsJS js.Value) bool {
+	return optsJS.Type() == js.TypeObject && optsJS.Get("signer").Type() == js.TypeFunction
+}
+
+// jsSigner adapts a JS signer, called with the payload as a Uint8Array and
+// returning the signature or a Promise of it, to object.Signer. It blocks
+// while a Promise settles, so it must only be used inside newPromise.
+func jsSigner(fn js.Value) object.Signer {
+	return object.SignerFunc(func(payload []byte) (signature string, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("signer failed: %v", r)
+			}
+		}()
+
+		data := js.Global().Get("Uint8Array").New(len(payload))
+		js.CopyBytesToJS(data, payload)
+		result, err := awaitJS(fn.Invoke(data))
+		if err != nil {
+			return "", fmt.Errorf("signer failed: %w", err)
+		}
+		if result.Type() != js.TypeString {
+			return "", fmt.Errorf("signer must return a string, got %s", result.Type())
+		}
+		return result.String(), nil
+	})
+}
+
+// awaitJS waits for a Promise, or any thenable, to settle. Other values
+// are returned as they are.
+func awaitJS(value js.Value) (js.Value, error) {
+	if value.Type() != js.TypeObject || value.Get("then").Type() != js.TypeFunction {
+		return value, nil
+	}
+
+	done := make(chan struct{})
+	var result js.Value
+	var err error
+	onFulfilled := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) > 0 {
+			result = args[0]
+		}
+		close(done)
+		return nil
+	})
+	defer onFulfilled.Release()
+	onRejected := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		reason := "promise rejected"
+		if len(args) > 0 {
+			reason = js.Global().Get("String").Invoke(args[0]).String()
+		}
+		err = fmt.Errorf("%s", reason)
+		close(done)
+		return nil
+	})
+	defer onRejected.Release()
+
+	value.Call("then", onFulfilled, onRejected)
+	<-done
+	return result, err
+}
+
+// clone clones a remote repository, a local repository or a bundle
+// Args: repoURL (string), path (string), options (optional object: { bare, depth, branch, filter, mirror, remote, bundleURI, onProgress })
+// Returns: Promise of { success, path, gitDir, branch, branchSource } or { error }
+func clone(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing url or path arguments")
+	}
+
+	url := args[0].String()
+	path := args[1].String()
+
+	opts := repository.DefaultCloneOptions()
+	if len(args) >= 3 && args[2].Type() == js.TypeObject {
+		optsJS := args[2]
+		if !optsJS.Get("bare").IsUndefined() {
+			opts.Bare = optsJS.Get("bare").Bool()
+		}
+		if !optsJS.Get("depth").IsUndefined() {
+			opts.Depth = optsJS.Get("depth").Int()
+		}
+		if !optsJS.Get("branch").IsUndefined() {
+			opts.Branch = optsJS.Get("branch").String()
+		}
+		if !optsJS.Get("filter").IsUndefined() {
+			opts.Filter = optsJS.Get("filter").String()
+		}
+		if !optsJS.Get("mirror").IsUndefined() {
+			opts.Mirror = optsJS.Get("mirror").Bool()
+		}
+		if !optsJS.Get("remote").IsUndefined() {
+			opts.Remote = optsJS.Get("remote").String()
+		}
+		if !optsJS.Get("bundleURI").IsUndefined() {
+			opts.BundleURI = optsJS.Get("bundleURI").String()
+		}
+		if onProgress := optsJS.Get("onProgress"); onProgress.Type() == js.TypeFunction {
+			opts.ProgressCallback = func(message string) {
+				onProgress.Invoke(message)
+			}
+		}
+	}
+
+	return newPromise(func() interface{} {
+		result, err := repository.CloneWithResult(url, path, opts)
+		if err != nil {
+			return jsError("failed to clone: " + err.Error())
+		}
+
+		return js.ValueOf(map[string]interface{}{
+			"success":      true,
+			"path":         result.Repository.Path,
+			"gitDir":       result.Repository.GitDir,
+			"branch":       result.Branch,
+			"branchSource": string(result.BranchSource),
+		})
+	})
+}
+
+// show returns a commit with its diff against its first parent, like git show
+// Args: repoPath (string), rev (string, optional - defaults to HEAD)
+// Returns: { success, commit: { hash, tree, parents, author, committer, message }, parent, files[], patch, stat } or { error }
+func show(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	rev := "HEAD"
+	if len(args) >= 2 && args[1].Type() == js.TypeString {
+		rev = args[1].String()
+	}
+
+	result, err := repo.Show(rev)
+	if err != nil {
+		return jsError("failed to show " + rev + ": " + err.Error())
+	}
+
+	commit := result.Commit
+	parents := make([]interface{}, len(commit.Parents))
+	for i, p := range commit.Parents {
+		parents[i] = p.String()
+	}
+
+	parent := ""
+	if result.Parent != nil {
+		parent = result.Parent.String()
+	}
+
+	files := make([]interface{}, len(result.Files))
+	for i, file := range result.Files {
+		files[i] = fileDiffToJS(file)
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"commit": map[string]interface{}{
+			"hash":    result.Hash.String(),
+			"tree":    commit.Tree.String(),
+			"parents": parents,
+			"author": map[string]interface{}{
+				"name":      commit.Author.Name,
+				"email":     commit.Author.Email,
+				"timestamp": commit.Author.When.Unix(),
+			},
+			"committer": map[string]interface{}{
+				"name":      commit.Committer.Name,
+				"email":     commit.Committer.Email,
+				"timestamp": commit.Committer.When.Unix(),
+			},
+			"message": commit.Message,
+		},
+		"parent": parent,
+		"files":  files,
+		"patch":  result.Patch,
+		"stat":   diffStatToJS(repository.NewDiffStat(result.Files, repository.DefaultDiffStatOptions())),
+	})
+}
+
+// fileDiffToJS converts a file diff to a JS object
+func fileDiffToJS(file repository.FileDiff) map[string]interface{} {
+	hashString := func(h hash.Hash) string {
+		if h == nil {
+			return ""
+		}
+		return h.String()
+	}
+
+	hunks := make([]interface{}, len(file.Hunks))
+	for i, hunk := range file.Hunks {
+		hunkJS := map[string]interface{}{
+			"header":   hunk.Header(),
+			"oldStart": hunk.OldStart,
+			"oldLines": hunk.OldLines,
+			"newStart": hunk.NewStart,
+			"newLines": hunk.NewLines,
+			"lines":    stringsToJS(hunk.Lines),
+		}
+		if hunk.Highlights != nil {
+			highlights := make([]interface{}, len(hunk.Highlights))
+			for j, spans := range hunk.Highlights {
+				text := hunk.Lines[j][1:]
+				spansJS := make([]interface{}, len(spans))
+				for k, span := range spans {
+					spansJS[k] = []interface{}{jsStringIndex(text, span.Start), jsStringIndex(text, span.End)}
+				}
+				highlights[j] = spansJS
+			}
+			hunkJS["highlights"] = highlights
+		}
+		hunks[i] = hunkJS
+	}
+
+	return map[string]interface{}{
+		"path":       file.Path,
+		"oldPath":    file.OldPath,
+		"change":     string(file.Change),
+		"oldHash":    hashString(file.OldHash),
+		"newHash":    hashString(file.NewHash),
+		"oldMode":    fmt.Sprintf("%06o", uint32(file.OldMode)),
+		"newMode":    fmt.Sprintf("%06o", uint32(file.NewMode)),
+		"binary":     file.Binary,
+		"insertions": file.Insertions,
+		"deletions":  file.Deletions,
+		"oldSize":    file.OldSize,
+		"newSize":    file.NewSize,
+		"hunks":      hunks,
+		"similarity": file.Similarity,
+	}
+}
+
+// jsStringIndex converts a byte offset in s to the index JS uses for the
+// same position, which counts UTF-16 code units
+func jsStringIndex(s string, offset int) int {
+	index := 0
+	for _, r := range s[:offset] {
+		index++
+		if r >= 0x10000 {
+			index++ // surrogate pair
+		}
+	}
+	return index
+}
+
+// showFile returns the content of a file at a revision, like git show rev:path
+// Args: repoPath (string), rev (string), path (string)
+// Returns: Uint8Array or { error }
+func showFile(this js.Value, args []js.Value) interface{} {
+	if len(args) < 3 {
+		return jsError("missing arguments: repoPath, rev, path")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	content, err := repo.ShowFile(args[1].String(), args[2].String())
+	if err != nil {
+		return jsError("failed to show file: " + err.Error())
+	}
+
+	dst := js.Global().Get("Uint8Array").New(len(content))
+	js.CopyBytesToJS(dst, content)
+	return dst
+}
+
+// objectInfo returns an object's type and size, like git cat-file -t and -s
+// Args: repoPath (string), object (string - hash or revision)
+// Returns: { success, hash, type, size } or { error }
+func objectInfo(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing arguments: repoPath, object")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	h, err := repo.ResolveRevision(args[1].String())
+	if err != nil {
+		return jsError("failed to resolve " + args[1].String() + ": " + err.Error())
+	}
+
+	info, err := repo.ObjectInfo(h)
+	if err != nil {
+		return jsError("failed to read object info: " + err.Error())
+	}
+
+	result := objectInfoToJS(*info)
+	result["success"] = true
+	return js.ValueOf(result)
+}
+
+// readObject returns an object's type and content, like git cat-file <type>
+// Args: repoPath (string), object (string - hash or revision)
+// Returns: { success, hash, type, size, content: Uint8Array } or { error }
+func readObject(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing arguments: repoPath, object")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	h, err := repo.ResolveRevision(args[1].String())
+	if err != nil {
+		return jsError("failed to resolve " + args[1].String() + ": " + err.Error())
+	}
+
+	obj, err := repo.ReadObject(h)
+	if err != nil {
+		return jsError("failed to read object: " + err.Error())
+	}
+
+	result := rawObjectToJS(*obj)
+	result["success"] = true
+	return js.ValueOf(result)
+}
+
+// batchObjectInfo returns the type and size of several objects, like
+// git cat-file --batch-check. Names that don't resolve to an object are
+// reported as missing.
+// Args: repoPath (string), objects (string[] - hashes or revisions)
+// Returns: { success, objects: [{ name, hash, type, size, missing }] } or { error }
+func batchObjectInfo(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing arguments: repoPath, objects")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	names, hashes := resolveObjectNames(repo, args[1])
+	var resolved []hash.Hash
+	for _, h := range hashes {
+		if h != nil {
+			resolved = append(resolved, h)
+		}
+	}
+	infos, err := repo.BatchObjectInfo(resolved)
+	if err != nil {
+		return jsError("failed to read object info: " + err.Error())
+	}
+
+	objects := make([]interface{}, len(names))
+	next := 0
+	for i, name := range names {
+		entry := map[string]interface{}{"missing": true}
+		if hashes[i] != nil {
+			entry = objectInfoToJS(infos[next])
+			next++
+		}
+		entry["name"] = name
+		objects[i] = entry
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"objects": objects,
+	})
+}
+
+// batchReadObject returns the type and content of several objects, like
+// git cat-file --batch. Names that don't resolve to an object are reported
+// as missing.
+// Args: repoPath (string), objects (string[] - hashes or revisions)
+// Returns: { success, objects: [{ name, hash, type, size, content, missing }] } or { error }
+func batchReadObject(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing arguments: repoPath, objects")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	names, hashes := resolveObjectNames(repo, args[1])
+	var resolved []hash.Hash
+	for _, h := range hashes {
+		if h != nil {
+			resolved = append(resolved, h)
+		}
+	}
+	raws, err := repo.BatchReadObject(resolved)
+	if err != nil {
+		return jsError("failed to read objects: " + err.Error())
+	}
+
+	objects := make([]interface{}, len(names))
+	next := 0
+	for i, name := range names {
+		entry := map[string]interface{}{"missing": true}
+		if hashes[i] != nil {
+			entry = rawObjectToJS(raws[next])
+			next++
+		}
+		entry["name"] = name
+		objects[i] = entry
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"objects": objects,
+	})
+}
+
+// resolveObjectNames resolves a JS array of object names. Names that don't
+// resolve are left as a nil hash.
+func resolveObjectNames(repo *repository.Repository, namesJS js.Value) ([]string, []hash.Hash) {
+	length := namesJS.Length()
+	names := make([]string, length)
+	hashes := make([]hash.Hash, length)
+	for i := 0; i < length; i++ {
+		names[i] = namesJS.Index(i).String()
+		if h, err := repo.ResolveRevision(names[i]); err == nil {
+			hashes[i] = h
+		}
+	}
+	return names, hashes
+}
+
+// objectInfoToJS converts object info to a JS object
+func objectInfoToJS(info repository.ObjectInfo) map[string]interface{} {
+	if info.Missing {
+		return map[string]interface{}{
+			"hash":    info.Hash.String(),
+			"missing": true,
+		}
+	}
+	return map[string]interface{}{
+		"hash":    info.Hash.String(),
+		"type":    string(info.Type),
+		"size":    info.Size,
+		"missing": false,
+	}
+}
+
+// rawObjectToJS converts a raw object to a JS object with its content as a Uint8Array
+func rawObjectToJS(obj repository.RawObject) map[string]interface{} {
+	result := objectInfoToJS(obj.ObjectInfo)
+	if !obj.Missing {
+		content := js.Global().Get("Uint8Array").New(len(obj.Content))
+		js.CopyBytesToJS(content, obj.Content)
+		result["content"] = content
+	}
+	return result
+}
+
+// listTree lists the entries of a tree-ish, like git ls-tree
+// Args: repoPath (string), treeish (string, optional - defaults to HEAD), options (object, optional - { recursive, showTrees, sizes, paths })
+// Returns: { success, entries: [{ path, mode, type, hash, size }] } or { error }
+func listTree(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	treeish := "HEAD"
+	if len(args) >= 2 && args[1].Type() == js.TypeString {
+		treeish = args[1].String()
+	}
+
+	opts := repository.DefaultListTreeOptions()
+	if len(args) >= 3 && args[2].Type() == js.TypeObject {
+		optsJS := args[2]
+		if !optsJS.Get("recursive").IsUndefined() {
+			opts.Recursive = optsJS.Get("recursive").Bool()
+		}
+		if !optsJS.Get("showTrees").IsUndefined() {
+			opts.ShowTrees = optsJS.Get("showTrees").Bool()
+		}
+		if !optsJS.Get("sizes").IsUndefined() {
+			opts.Sizes = optsJS.Get("sizes").Bool()
+		}
+		if pathsJS := optsJS.Get("paths"); !pathsJS.IsUndefined() {
+			for i := 0; i < pathsJS.Length(); i++ {
+				opts.Paths = append(opts.Paths, pathsJS.Index(i).String())
+			}
+		}
+	}
+
+	entries, err := repo.ListTree(treeish, opts)
+	if err != nil {
+		return jsError("failed to list tree: " + err.Error())
+	}
+
+	result := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		result[i] = map[string]interface{}{
+			"path": entry.Path,
+			"mode": entry.Mode.String(),
+			"type": string(entry.Type),
+			"hash": entry.Hash.String(),
+			"size": entry.Size,
+		}
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"entries": result,
+	})
+}
+
+// listIndexFiles lists files in the index and working tree, like git ls-files
+// Args: repoPath (string), options (object, optional - { cached, deleted, modified, unmerged, others, ignored, paths })
+// Returns: { success, files: [{ path, status, mode, hash, stage }] } or { error }
+func listIndexFiles(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	opts := repository.ListIndexFilesOptions{}
+	if len(args) >= 2 && args[1].Type() == js.TypeObject {
+		optsJS := args[1]
+		flags := map[string]*bool{
+			"cached":   &opts.Cached,
+			"deleted":  &opts.Deleted,
+			"modified": &opts.Modified,
+			"unmerged": &opts.Unmerged,
+			"others":   &opts.Others,
+			"ignored":  &opts.Ignored,
+		}
+		for name, flag := range flags {
+			if !optsJS.Get(name).IsUndefined() {
+				*flag = optsJS.Get(name).Bool()
+			}
+		}
+		if pathsJS := optsJS.Get("paths"); !pathsJS.IsUndefined() {
+			for i := 0; i < pathsJS.Length(); i++ {
+				opts.Paths = append(opts.Paths, pathsJS.Index(i).String())
+			}
+		}
+	}
+
+	files, err := repo.ListIndexFiles(opts)
+	if err != nil {
+		return jsError("failed to list files: " + err.Error())
+	}
+
+	result := make([]interface{}, len(files))
+	for i, file := range files {
+		entry := map[string]interface{}{
+			"path":   file.Path,
+			"status": string(file.Status),
+		}
+		if file.Hash != nil {
+			entry["mode"] = file.Mode.String()
+			entry["hash"] = file.Hash.String()
+			entry["stage"] = file.Stage
+		}
+		result[i] = entry
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"files":   result,
+	})
+}
+
+// lsRemote lists the refs of a remote, like git ls-remote. With repoPath,
+// remote may name a configured remote; otherwise it is a URL.
+// Args: remote (string - URL, path or remote name), options (object, optional - { repoPath, heads, tags, auth: { username, password } | { token } })
+// Returns: Promise<{ success, refs: [{ name, hash, peeled, target }] } | { error }>
+func lsRemote(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing remote argument")
+	}
+
+	remote := args[0].String()
+	repoPath := ""
+	opts := repository.DefaultLsRemoteOptions()
+	if len(args) >= 2 && args[1].Type() == js.TypeObject {
+		optsJS := args[1]
+		if !optsJS.Get("repoPath").IsUndefined() {
+			repoPath = optsJS.Get("repoPath").String()
+		}
+		if !optsJS.Get("heads").IsUndefined() {
+			opts.Heads = optsJS.Get("heads").Bool()
+		}
+		if !optsJS.Get("tags").IsUndefined() {
+			opts.Tags = optsJS.Get("tags").Bool()
+		}
+		if authJS := optsJS.Get("auth"); authJS.Type() == js.TypeObject {
+			if !authJS.Get("token").IsUndefined() {
+				opts.AuthProvider = auth.NewTokenAuthProvider(authJS.Get("token").String())
+			} else if !authJS.Get("username").IsUndefined() {
+				opts.AuthProvider = auth.NewBasicAuthProvider(authJS.Get("username").String(), authJS.Get("password").String())
+			}
+		}
+	}
+
+	return newPromise(func() interface{} {
+		var refs []repository.RemoteRef
+		if repoPath != "" {
+			repo, err := repository.Open(repoPath)
+			if err != nil {
+				return jsError("failed to open repository: " + err.Error())
+			}
+			refs, err = repo.LsRemote(remote, opts)
+			if err != nil {
+				return jsError("failed to list remote refs: " + err.Error())
+			}
+		} else {
+			var err error
+			refs, err = repository.LsRemote(remote, opts)
+			if err != nil {
+				return jsError("failed to list remote refs: " + err.Error())
+			}
+		}
+
+		result := make([]interface{}, len(refs))
+		for i, ref := range refs {
+			entry := map[string]interface{}{
+				"name": ref.Name,
+				"hash": ref.Hash.String(),
+			}
+			if ref.Peeled != nil {
+				entry["peeled"] = ref.Peeled.String()
+			}
+			if ref.Target != "" {
+				entry["target"] = ref.Target
+			}
+			result[i] = entry
+		}
+
+		return js.ValueOf(map[string]interface{}{
+			"success": true,
+			"refs":    result,
+		})
+	})
+}
+
+// checkIgnore reports whether paths are ignored and which pattern decided it,
+// like git check-ignore -v --non-matching
+// Args: repoPath (string), paths (string | string[])
+// Returns: { success, results: [{ path, ignored, pattern, source, line }] } or { error }
+func checkIgnore(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing arguments: repoPath, paths")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	var paths []string
+	if args[1].Type() == js.TypeString {
+		paths = []string{args[1].String()}
+	} else {
+		for i := 0; i < args[1].Length(); i++ {
+			paths = append(paths, args[1].Index(i).String())
+		}
+	}
+
+	gitignore, err := index.LoadGitignore(repo.WorkTree())
+	if err != nil {
+		return jsError("failed to load ignore rules: " + err.Error())
+	}
+
+	results := make([]interface{}, len(paths))
+	for i, path := range paths {
+		result := map[string]interface{}{
+			"path":    path,
+			"ignored": false,
+		}
+		if match := gitignore.CheckIgnore(path); match != nil {
+			result["ignored"] = match.Ignored
+			result["pattern"] = match.Pattern
+			result["source"] = match.Source
+			result["line"] = match.Line
+		}
+		results[i] = result
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"results": results,
+	})
+}
+
+// grep searches file contents for a regular expression, like git grep
+// Args: repoPath (string), pattern (string), options (object, optional - { rev, ignoreCase, fixedStrings, invertMatch, paths, maxCount })
+// Omitting rev searches the tracked files in the working tree.
+// Returns: { success, matches: [{ path, line, column, text }] } or { error }
+func grep(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing arguments: repoPath, pattern")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	rev := ""
+	opts := repository.DefaultGrepOptions()
+	if len(args) >= 3 && args[2].Type() == js.TypeObject {
+		optsJS := args[2]
+		if !optsJS.Get("rev").IsUndefined() {
+			rev = optsJS.Get("rev").String()
+		}
+		if !optsJS.Get("ignoreCase").IsUndefined() {
+			opts.IgnoreCase = optsJS.Get("ignoreCase").Bool()
+		}
+		if !optsJS.Get("fixedStrings").IsUndefined() {
+			opts.FixedStrings = optsJS.Get("fixedStrings").Bool()
+		}
+		if !optsJS.Get("invertMatch").IsUndefined() {
+			opts.InvertMatch = optsJS.Get("invertMatch").Bool()
+		}
+		if !optsJS.Get("maxCount").IsUndefined() {
+			opts.MaxCount = optsJS.Get("maxCount").Int()
+		}
+		if pathsJS := optsJS.Get("paths"); !pathsJS.IsUndefined() {
+			for i := 0; i < pathsJS.Length(); i++ {
+				opts.Paths = append(opts.Paths, pathsJS.Index(i).String())
+			}
+		}
+	}
+
+	matches, err := repo.Grep(args[1].String(), rev, opts)
+	if err != nil {
+		return jsError("failed to grep: " + err.Error())
+	}
+
+	result := make([]interface{}, len(matches))
+	for i, match := range matches {
+		result[i] = map[string]interface{}{
+			"path":   match.Path,
+			"line":   match.Line,
+			"column": match.Column,
+			"text":   match.Text,
+		}
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"matches": result,
+	})
+}
+
+// shortlog counts commits per contributor, like git shortlog
+// Args: repoPath (string), range (string, optional - "A..B", "A...B" or a revision, defaults to HEAD), options (object, optional - { email, committer, noMerges, sortByCount })
+// Returns: { success, authors: [{ name, email, count, subjects }] } or { error }
+func shortlog(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	revRange := ""
+	if len(args) >= 2 && args[1].Type() == js.TypeString {
+		revRange = args[1].String()
+	}
+
+	opts := repository.DefaultShortlogOptions()
+	if len(args) >= 3 && args[2].Type() == js.TypeObject {
+		optsJS := args[2]
+		if !optsJS.Get("email").IsUndefined() {
+			opts.Email = optsJS.Get("email").Bool()
+		}
+		if !optsJS.Get("committer").IsUndefined() {
+			opts.Committer = optsJS.Get("committer").Bool()
+		}
+		if !optsJS.Get("noMerges").IsUndefined() {
+			opts.NoMerges = optsJS.Get("noMerges").Bool()
+		}
+		if !optsJS.Get("sortByCount").IsUndefined() {
+			opts.SortByCount = optsJS.Get("sortByCount").Bool()
+		}
+	}
+
+	entries, err := repo.Shortlog(revRange, opts)
+	if err != nil {
+		return jsError("failed to summarise history: " + err.Error())
+	}
+
+	authors := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		authors[i] = map[string]interface{}{
+			"name":     entry.Name,
+			"email":    entry.Email,
+			"count":    entry.Count,
+			"subjects": stringsToJS(entry.Subjects),
+		}
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"authors": authors,
+	})
+}
+
+// bisectStart starts a bisect session, like git bisect start
+// Args: repoPath (string), bad (string, optional), good (string[], optional)
+// Returns: { success, next?, remaining, steps, firstBad? } or { error }
+func bisectStart(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	bad := ""
+	if len(args) >= 2 && args[1].Type() == js.TypeString {
+		bad = args[1].String()
+	}
+
+	var good []string
+	if len(args) >= 3 && args[2].Type() == js.TypeObject {
+		for i := 0; i < args[2].Length(); i++ {
+			good = append(good, args[2].Index(i).String())
+		}
+	}
+
+	result, err := repo.BisectStart(bad, good)
+	if err != nil {
+		return jsError("failed to start bisecting: " + err.Error())
+	}
+	return bisectResultToJS(result)
+}
+
+// bisectGood marks a commit as good and checks out the next one to test
+// Args: repoPath (string), rev (string, optional - defaults to HEAD)
+// Returns: { success, next?, remaining, steps, firstBad? } or { error }
+func bisectGood(this js.Value, args []js.Value) interface{} {
+	return runBisectStep(args, func(repo *repository.Repository, rev string) (*repository.BisectResult, error) {
+		return repo.BisectGood(rev)
+	})
+}
+
+// bisectBad marks a commit as bad and checks out the next one to test
+// Args: repoPath (string), rev (string, optional - defaults to HEAD)
+// Returns: { success, next?, remaining, steps, firstBad? } or { error }
+func bisectBad(this js.Value, args []js.Value) interface{} {
+	return runBisectStep(args, func(repo *repository.Repository, rev string) (*repository.BisectResult, error) {
+		return repo.BisectBad(rev)
+	})
+}
+
+// bisectSkip marks a commit that can't be tested and checks out another
+// Args: repoPath (string), rev (string, optional - defaults to HEAD)
+// Returns: { success, next?, remaining, steps, firstBad? } or { error }
+func bisectSkip(this js.Value, args []js.Value) interface{} {
+	return runBisectStep(args, func(repo *repository.Repository, rev string) (*repository.BisectResult, error) {
+		return repo.BisectSkip(rev)
+	})
+}
+
+// bisectReset ends the bisect session and returns to where it started
+// Args: repoPath (string)
+// Returns: { success } or { error }
+func bisectReset(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	if err := repo.BisectReset(); err != nil {
+		return jsError("failed to reset bisect: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// runBisectStep opens the repository, records a verdict and converts the result
+func runBisectStep(args []js.Value, mark func(*repository.Repository, string) (*repository.BisectResult, error)) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	rev := ""
+	if len(args) >= 2 && args[1].Type() == js.TypeString {
+		rev = args[1].String()
+	}
+
+	result, err := mark(repo, rev)
+	if err != nil {
+		return jsError(err.Error())
+	}
+	return bisectResultToJS(result)
+}
+
+// bisectResultToJS converts a bisect step result to a JavaScript object
+func bisectResultToJS(result *repository.BisectResult) interface{} {
+	value := map[string]interface{}{
+		"success":   true,
+		"remaining": result.Remaining,
+		"steps":     result.Steps,
+	}
+	if result.Next != nil {
+		value["next"] = result.Next.String()
+	}
+	if result.FirstBad != nil {
+		value["firstBad"] = result.FirstBad.String()
+	}
+	return js.ValueOf(value)
+}
+
+// addNote attaches a note to an object, like git notes add
+// Args: repoPath (string), rev (string), message (string), options (object, optional - { ref, force, append })
+// Returns: { success, commit } or { error }
+func addNote(this js.Value, args []js.Value) interface{} {
+	if len(args) < 3 {
+		return jsError("missing arguments: repoPath, rev, message")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	opts := repository.DefaultNoteOptions()
+	if len(args) >= 4 && args[3].Type() == js.TypeObject {
+		optsJS := args[3]
+		if optsJS.Get("ref").Type() == js.TypeString {
+			opts.Ref = optsJS.Get("ref").String()
+		}
+		if !optsJS.Get("force").IsUndefined() {
+			opts.Force = optsJS.Get("force").Bool()
+		}
+		if !optsJS.Get("append").IsUndefined() {
+			opts.Append = optsJS.Get("append").Bool()
+		}
+	}
+
+	commit, err := repo.AddNote(args[1].String(), args[2].String(), opts)
+	if err != nil {
+		return jsError("failed to add note: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"commit":  commit.String(),
+	})
+}
+
+// readNote returns the note attached to an object, like git notes show
+// Args: repoPath (string), rev (string), ref (string, optional - defaults to refs/notes/commits)
+// Returns: { success, note } or { error }
+func readNote(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing arguments: repoPath, rev")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	ref := ""
+	if len(args) >= 3 && args[2].Type() == js.TypeString {
+		ref = args[2].String()
+	}
+
+	note, err := repo.ReadNote(args[1].String(), ref)
+	if err != nil {
+		return jsError(err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"note":    note,
+	})
+}
+
+// removeNote removes the note attached to an object, like git notes remove
+// Args: repoPath (string), rev (string), ref (string, optional - defaults to refs/notes/commits)
+// Returns: { success, commit } or { error }
+func removeNote(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing arguments: repoPath, rev")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	ref := ""
+	if len(args) >= 3 && args[2].Type() == js.TypeString {
+		ref = args[2].String()
+	}
+
+	commit, err := repo.RemoveNote(args[1].String(), ref)
+	if err != nil {
+		return jsError("failed to remove note: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"commit":  commit.String(),
+	})
+}
+
+// listNotes lists the notes in a notes ref, like git notes list
+// Args: repoPath (string), ref (string, optional - defaults to refs/notes/commits)
+// Returns: { success, notes: [{ object, blob }] } or { error }
+func listNotes(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	ref := ""
+	if len(args) >= 2 && args[1].Type() == js.TypeString {
+		ref = args[1].String()
+	}
+
+	notes, err := repo.ListNotes(ref)
+	if err != nil {
+		return jsError("failed to list notes: " + err.Error())
+	}
+
+	result := make([]interface{}, len(notes))
+	for i, note := range notes {
+		result[i] = map[string]interface{}{
+			"object": note.Object.String(),
+			"blob":   note.Blob.String(),
+		}
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"notes":   result,
+	})
+}
+
+// replaceObject makes reads of one object return another, like git replace
+// Args: repoPath (string), original (string), replacement (string), options (object, optional - { force })
+// Returns: { success } or { error }
+func replaceObject(this js.Value, args []js.Value) interface{} {
+	if len(args) < 3 {
+		return jsError("missing arguments: repoPath, original, replacement")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	force := false
+	if len(args) >= 4 && args[3].Type() == js.TypeObject && !args[3].Get("force").IsUndefined() {
+		force = args[3].Get("force").Bool()
+	}
+
+	if err := repo.ReplaceObject(args[1].String(), args[2].String(), force); err != nil {
+		return jsError("failed to replace object: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// graftCommit replaces a commit with a copy that has other parents, like
+// git replace --graft
+// Args: repoPath (string), rev (string), parents (string[]), options (object, optional - { force })
+// Returns: { success, replacement } or { error }
+func graftCommit(this js.Value, args []js.Value) interface{} {
+	if len(args) < 3 {
+		return jsError("missing arguments: repoPath, rev, parents")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	parents := []string{}
+	for i := 0; i < args[2].Length(); i++ {
+		parents = append(parents, args[2].Index(i).String())
+	}
+
+	force := false
+	if len(args) >= 4 && args[3].Type() == js.TypeObject && !args[3].Get("force").IsUndefined() {
+		force = args[3].Get("force").Bool()
+	}
+
+	replacement, err := repo.GraftCommit(args[1].String(), parents, force)
+	if err != nil {
+		return jsError("failed to graft commit: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success":     true,
+		"replacement": replacement.String(),
+	})
+}
+
+// deleteReplacement removes an object's replacement, like git replace -d
+// Args: repoPath (string), original (string)
+// Returns: { success } or { error }
+func deleteReplacement(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing arguments: repoPath, original")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	if err := repo.DeleteReplacement(args[1].String()); err != nil {
+		return jsError("failed to delete replacement: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// listReplacements lists replace refs, like git replace -l
+// Args: repoPath (string)
+// Returns: { success, replacements: [{ original, replacement }] } or { error }
+func listReplacements(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	replacements, err := repo.ListReplacements()
+	if err != nil {
+		return jsError("failed to list replacements: " + err.Error())
+	}
+
+	result := make([]interface{}, len(replacements))
+	for i, r := range replacements {
+		result[i] = map[string]interface{}{
+			"original":    r.Original.String(),
+			"replacement": r.Replacement.String(),
+		}
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success":      true,
+		"replacements": result,
+	})
+}
+
+// createRepositoryTag creates a tag ref, like git tag
+// Args: repoPath (string), name (string), rev (optional string, default HEAD), options (optional: { message, tagger: {name, email, timestamp}, force, signer })
+// A message or a signer makes an annotated tag. signer is called with the
+// payload to sign (Uint8Array) and returns the armored signature, or a
+// Promise of it.
+// Returns: { success, name, target } or { error }, as a Promise when a signer is given
+func createRepositoryTag(this js.Value, args []js.Value) interface{} {
+	if len(args) >= 4 && hasSigner(args[3]) {
+		return newPromise(func() interface{} { return tagRepository(args) })
+	}
+	return tagRepository(args)
+}
+
+// tagRepository implements createRepositoryTag
+func tagRepository(args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing repoPath or name arguments")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	name := args[1].String()
+	rev := ""
+	if len(args) >= 3 && args[2].Type() == js.TypeString {
+		rev = args[2].String()
+	}
+
+	opts := repository.DefaultTagOptions()
+	if len(args) >= 4 && args[3].Type() == js.TypeObject {
+		optsJS := args[3]
+		if !optsJS.Get("message").IsUndefined() {
+			opts.Message = optsJS.Get("message").String()
+		}
+		if !optsJS.Get("tagger").IsUndefined() {
+			tagger := parseSignature(optsJS.Get("tagger"))
+			opts.Tagger = &tagger
+		}
+		if !optsJS.Get("force").IsUndefined() {
+			opts.Force = optsJS.Get("force").Bool()
+		}
+		if hasSigner(optsJS) {
+			opts.Signer = jsSigner(optsJS.Get("signer"))
+		}
+	}
+
+	target, err := repo.CreateTag(name, rev, opts)
+	if err != nil {
+		return jsError("failed to create tag: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"name":    name,
+		"target":  target.String(),
+	})
+}
+
+// verifyCommit checks a commit's signature, like git verify-commit
+// Args: repoPath (string), rev (string), verifier (function)
+// verifier is called with the signed payload (Uint8Array) and the
+// signature (string) and returns { valid, signer, keyId, trust }, or a
+// Promise of it
+// Returns: Promise of { success, object, signed, status, format?, signature?, valid?, signer?, keyId?, trust? } or { error }
+func verifyCommit(this js.Value, args []js.Value) interface{} {
+	return runVerify(args, (*repository.Repository).VerifyCommit)
+}
+
+// verifyTag checks an annotated tag's signature, like git verify-tag
+// Args: repoPath (string), rev (string), verifier (function), as for verifyCommit
+// Returns: Promise of { success, object, signed, status, format?, signature?, valid?, signer?, keyId?, trust? } or { error }
+func verifyTag(this js.Value, args []js.Value) interface{} {
+	return runVerify(args, (*repository.Repository).VerifyTag)
+}
+
+// runVerify runs a signature check with a JS verifier. The verifier may
+// return a Promise, so the check runs inside newPromise.
+func runVerify(args []js.Value, verify func(*repository.Repository, string, object.Verifier) (*repository.SignatureCheck, error)) interface{} {
+	if len(args) < 3 || args[2].Type() != js.TypeFunction {
+		return jsError("missing repoPath, rev or verifier arguments")
+	}
+
+	repoPath, rev, verifier := args[0].String(), args[1].String(), jsVerifier(args[2])
+	return newPromise(func() interface{} {
+		repo, err := repository.Open(repoPath)
+		if err != nil {
+			return jsError("failed to open repository: " + err.Error())
+		}
+
+		check, err := verify(repo, rev, verifier)
+		if err != nil {
+			return jsError("failed to verify: " + err.Error())
+		}
+
+		result := map[string]interface{}{
+			"success": true,
+			"object":  check.Object.String(),
+			"signed":  check.Signed,
+			"status":  check.Status(),
+		}
+		if check.Signed {
+			result["format"] = check.Format
+			result["signature"] = check.Signature
+			result["valid"] = check.Valid
+			result["signer"] = check.Signer
+			result["keyId"] = check.KeyID
+			result["trust"] = check.Trust
+		}
+		return js.ValueOf(result)
+	})
+}
+
+// jsVerifier adapts a JS verifier, called with the payload as a
+// Uint8Array and the signature, to object.Verifier. Like jsSigner it
+// blocks while a Promise settles.
+func jsVerifier(fn js.Value) object.Verifier {
+	return object.VerifierFunc(func(payload []byte, signature string) (verification object.Verification, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("verifier failed: %v", r)
+			}
+		}()
+
+		data := js.Global().Get("Uint8Array").New(len(payload))
+		js.CopyBytesToJS(data, payload)
+		result, err := awaitJS(fn.Invoke(data, signature))
+		if err != nil {
+			return verification, fmt.Errorf("verifier failed: %w", err)
+		}
+		if result.Type() != js.TypeObject {
+			return verification, fmt.Errorf("verifier must return an object, got %s", result.Type())
+		}
+
+		verification.Valid = result.Get("valid").Truthy()
+		if v := result.Get("signer"); v.Type() == js.TypeString {
+			verification.Signer = v.String()
+		}
+		if v := result.Get("keyId"); v.Type() == js.TypeString {
+			verification.KeyID = v.String()
+		}
+		if v := result.Get("trust"); v.Type() == js.TypeString {
+			verification.Trust = v.String()
+		}
+		return verification, nil
+	})
+}
+
+// parseTrailers parses the trailers at the end of a commit message, like
+// git interpret-trailers --parse
+// Args: message (string)
+// Returns: { success, trailers: [{ key, value }] } or { error }
+func parseTrailers(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing message argument")
+	}
+
+	trailers := repository.ParseTrailers(args[0].String())
+	result := make([]interface{}, len(trailers))
+	for i, t := range trailers {
+		result[i] = map[string]interface{}{
+			"key":   t.Key,
+			"value": t.Value,
+		}
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success":  true,
+		"trailers": result,
+	})
+}
+
+// interpretTrailers adds trailers to a commit message, like git
+// interpret-trailers --trailer
+// Args: message (string), trailers ([{ key, value }]), options (optional: { ifExists: "addIfDifferentNeighbor" | "addIfDifferent" | "add" | "replace" | "doNothing" })
+// Returns: { success, message } or { error }
+func interpretTrailers(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 || args[1].Type() != js.TypeObject {
+		return jsError("missing message or trailers arguments")
+	}
+
+	trailersJS := args[1]
+	trailers := make([]repository.Trailer, trailersJS.Length())
+	for i := range trailers {
+		trailers[i] = repository.Trailer{
+			Key:   trailersJS.Index(i).Get("key").String(),
+			Value: trailersJS.Index(i).Get("value").String(),
+		}
+	}
+
+	var ifExists repository.TrailerIfExists
+	if len(args) >= 3 && args[2].Type() == js.TypeObject && !args[2].Get("ifExists").IsUndefined() {
+		ifExists = repository.TrailerIfExists(args[2].Get("ifExists").String())
+	}
+
+	message, err := repository.AddTrailers(args[0].String(), trailers, ifExists)
+	if err != nil {
+		return jsError("failed to add trailers: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"message": message,
+	})
+}
+
+// branchesContaining lists the local branches whose history includes a
+// commit, like git branch --contains
+// Args: repoPath (string), rev (string)
+// Returns: { success, branches[] } or { error }
+func branchesContaining(this js.Value, args []js.Value) interface{} {
+	return refsContaining(args, "branches", (*repository.Repository).BranchesContaining)
+}
+
+// tagsContaining lists the tags whose history includes a commit, like git
+// tag --contains
+// Args: repoPath (string), rev (string)
+// Returns: { success, tags[] } or { error }
+func tagsContaining(this js.Value, args []js.Value) interface{} {
+	return refsContaining(args, "tags", (*repository.Repository).TagsContaining)
+}
+
+// refsContaining is the shared body of branchesContaining and
+// tagsContaining
+func refsContaining(args []js.Value, key string, list func(*repository.Repository, string) ([]string, error)) interface{} {
+	if len(args) < 2 {
+		return jsError("missing repoPath or rev arguments")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	names, err := list(repo, args[1].String())
+	if err != nil {
+		return jsError("failed to list " + key + ": " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		key:       stringsToJS(names),
+	})
+}
+
+// aheadBehind counts the commits on local that upstream lacks and the
+// commits on upstream that local lacks
+// Args: repoPath (string), local (string), upstream (string)
+// Returns: { success, ahead, behind } or { error }
+func aheadBehind(this js.Value, args []js.Value) interface{} {
+	if len(args) < 3 {
+		return jsError("missing repoPath, local or upstream arguments")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	ahead, behind, err := repo.AheadBehind(args[1].String(), args[2].String())
+	if err != nil {
+		return jsError("failed to count commits: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"ahead":   ahead,
+		"behind":  behind,
+	})
+}
+
+// setUpstream makes a local branch track a branch on a remote, like git
+// branch --set-upstream-to
+// Args: repoPath (string), branch (string), remote (string, "." for a local branch), remoteBranch (string)
+// Returns: { success } or { error }
+func setUpstream(this js.Value, args []js.Value) interface{} {
+	if len(args) < 4 {
+		return jsError("missing repoPath, branch, remote or remoteBranch arguments")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	if err := repo.SetUpstream(args[1].String(), args[2].String(), args[3].String()); err != nil {
+		return jsError("failed to set upstream: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// unsetUpstream stops a local branch from tracking an upstream
+// Args: repoPath (string), branch (string)
+// Returns: { success } or { error }
+func unsetUpstream(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing repoPath or branch arguments")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	if err := repo.UnsetUpstream(args[1].String()); err != nil {
+		return jsError("failed to unset upstream: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// getUpstream returns the upstream a local branch tracks
+// Args: repoPath (string), branch (string)
+// Returns: { success, upstream: { remote, merge, trackingRef } | null } or { error }
+func getUpstream(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing repoPath or branch arguments")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	upstream, err := repo.GetUpstream(args[1].String())
+	if err != nil {
+		return jsError("failed to get upstream: " + err.Error())
+	}
+
+	var result interface{}
+	if upstream != nil {
+		result = map[string]interface{}{
+			"remote":      upstream.Remote,
+			"merge":       upstream.Merge,
+			"trackingRef": upstream.TrackingRef(),
+		}
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success":  true,
+		"upstream": result,
+	})
+}
+
+// forEachRef lists refs with their fields formatted, like git for-each-ref
+// Args: repoPath (string), options (optional: { patterns: string[], sort: string[], format, count })
+// Returns: { success, refs: [{ name, hash, output }] } or { error }
+func forEachRef(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	opts := repository.DefaultForEachRefOptions()
+	if len(args) >= 2 && args[1].Type() == js.TypeObject {
+		optsJS := args[1]
+		if patternsJS := optsJS.Get("patterns"); patternsJS.Type() == js.TypeObject {
+			opts.Patterns = make([]string, patternsJS.Length())
+			for i := range opts.Patterns {
+				opts.Patterns[i] = patternsJS.Index(i).String()
+			}
+		}
+		if sortJS := optsJS.Get("sort"); sortJS.Type() == js.TypeObject {
+			opts.Sort = make([]string, sortJS.Length())
+			for i := range opts.Sort {
+				opts.Sort[i] = sortJS.Index(i).String()
+			}
+		}
+		if !optsJS.Get("format").IsUndefined() {
+			opts.Format = optsJS.Get("format").String()
+		}
+		if !optsJS.Get("count").IsUndefined() {
+			opts.Count = optsJS.Get("count").Int()
+		}
+	}
+
+	refs, err := repo.ForEachRef(opts)
+	if err != nil {
+		return jsError("failed to list refs: " + err.Error())
+	}
+
+	result := make([]interface{}, len(refs))
+	for i, ref := range refs {
+		result[i] = map[string]interface{}{
+			"name":   ref.Name,
+			"hash":   ref.Hash.String(),
+			"output": ref.Output,
+		}
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"refs":    result,
+	})
+}
+
+// restore restores files in the worktree and/or the index, like git restore
+// Args: repoPath (string), paths (string[]), options (optional object: { source, staged, worktree })
+// Returns: { success, restored[], removed[] } or { error }
+func restore(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing repoPath or paths arguments")
+	}
+
+	pathsJS := args[1]
+	if pathsJS.Type() != js.TypeObject || pathsJS.Get("length").IsUndefined() {
+		return jsError("paths must be an array")
+	}
+	paths := make([]string, pathsJS.Get("length").Int())
+	for i := range paths {
+		paths[i] = pathsJS.Index(i).String()
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	opts := repository.DefaultRestoreOptions()
+	if len(args) >= 3 && args[2].Type() == js.TypeObject {
+		optsJS := args[2]
+		if v := optsJS.Get("source"); v.Type() == js.TypeString {
+			opts.Source = v.String()
+		}
+		if !optsJS.Get("staged").IsUndefined() {
+			opts.Staged = optsJS.Get("staged").Bool()
+			// Like git restore --staged, only the index is restored
+			// unless the worktree is asked for too
+			opts.Worktree = false
+		}
+		if !optsJS.Get("worktree").IsUndefined() {
+			opts.Worktree = optsJS.Get("worktree").Bool()
+		}
+	}
+
+	result, err := repo.Restore(paths, opts)
+	if err != nil {
+		return jsError("failed to restore files: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success":  true,
+		"restored": stringsToJS(result.Restored),
+		"removed":  stringsToJS(result.Removed),
+	})
+}
+
+// checkoutPaths checks paths out of a revision into the index and the
+// worktree without moving HEAD, like git checkout <rev> -- <paths>
+// Args: repoPath (string), rev (string, empty for the index), paths (string[])
+// Returns: { success, restored[] } or { error }
+func checkoutPaths(this js.Value, args []js.Value) interface{} {
+	if len(args) < 3 {
+		return jsError("missing arguments: repoPath, rev, paths")
+	}
+
+	pathsJS := args[2]
+	if pathsJS.Type() != js.TypeObject || pathsJS.Get("length").IsUndefined() {
+		return jsError("paths must be an array")
+	}
+	paths := make([]string, pathsJS.Get("length").Int())
+	for i := range paths {
+		paths[i] = pathsJS.Index(i).String()
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	rev := ""
+	if args[1].Type() == js.TypeString {
+		rev = args[1].String()
+	}
+
+	result, err := repo.CheckoutPaths(rev, paths)
+	if err != nil {
+		return jsError("failed to checkout paths: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success":  true,
+		"restored": stringsToJS(result.Restored),
+	})
+}
+
+// formatPatch formats the commits in a range as mbox emails, like git format-patch
+// Args: repoPath (string), range (string - "A..B", or a revision for the commits since it), options (object, optional - { subjectPrefix, numbered, signature })
+// Returns: { success, patches: [{ commit, filename, content }], mbox } or { error }
+func formatPatch(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing arguments: repoPath, range")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	opts := repository.DefaultFormatPatchOptions()
+	if len(args) >= 3 && args[2].Type() == js.TypeObject {
+		optsJS := args[2]
+		if v := optsJS.Get("subjectPrefix"); v.Type() == js.TypeString {
+			opts.SubjectPrefix = v.String()
+		}
+		if v := optsJS.Get("numbered"); !v.IsUndefined() {
+			opts.Numbered = v.Bool()
+		}
+		if v := optsJS.Get("signature"); v.Type() == js.TypeString {
+			opts.Signature = v.String()
+		}
+	}
+
+	patches, err := repo.FormatPatch(args[1].String(), opts)
+	if err != nil {
+		return jsError("failed to format patches: " + err.Error())
+	}
+
+	result := make([]interface{}, len(patches))
+	var mbox strings.Builder
+	for i, patch := range patches {
+		result[i] = map[string]interface{}{
+			"commit":   patch.Commit.String(),
+			"filename": patch.Filename,
+			"content":  patch.Content,
+		}
+		mbox.WriteString(patch.Content)
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"patches": result,
+		"mbox":    mbox.String(),
+	})
+}
+
+// am applies a mailbox of patches as commits, like git am
+// Args: repoPath (string), mbox (string), options (object, optional - { signOff })
+// Returns: { success, commits[] } or { error }
+func am(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing arguments: repoPath, mbox")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	opts := repository.DefaultAmOptions()
+	if len(args) >= 3 && args[2].Type() == js.TypeObject {
+		if v := args[2].Get("signOff"); !v.IsUndefined() {
+			opts.SignOff = v.Bool()
+		}
+	}
+
+	result, err := repo.Am(args[1].String(), opts)
+	if err != nil {
+		return jsError("failed to apply patches: " + err.Error())
+	}
+
+	commits := make([]string, len(result.Commits))
+	for i, h := range result.Commits {
+		commits[i] = h.String()
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"commits": stringsToJS(commits),
+	})
+}
+
+// cherry lists the commits on head that are not on upstream and whether
+// upstream already has an equivalent change, like git cherry
+// Args: repoPath (string), upstream (string, optional - defaults to the branch's upstream), head (string, optional - defaults to HEAD)
+// Returns: { success, commits: [{ commit, subject, applied, patchId }] } or { error }
+func cherry(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	upstream, head := "", ""
+	if len(args) >= 2 && args[1].Type() == js.TypeString {
+		upstream = args[1].String()
+	}
+	if len(args) >= 3 && args[2].Type() == js.TypeString {
+		head = args[2].String()
+	}
+
+	entries, err := repo.Cherry(upstream, head)
+	if err != nil {
+		return jsError("failed to compare commits: " + err.Error())
+	}
+
+	result := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		result[i] = map[string]interface{}{
+			"commit":  entry.Commit.String(),
+			"subject": entry.Subject,
+			"applied": entry.Applied,
+			"patchId": entry.PatchID.String(),
+		}
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"commits": result,
+	})
+}
+
+// nameRev names commits relative to the refs that reach them, like git name-rev
+// Args: repoPath (string), revs (string[]), options (object, optional - { tags, refs, exclude })
+// Returns: { success, names: { <rev>: name } } or { error }; unnamed commits map to null
+func nameRev(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing arguments: repoPath, revs")
+	}
+
+	revsJS := args[1]
+	if revsJS.Type() != js.TypeObject || revsJS.Get("length").IsUndefined() {
+		return jsError("revs must be an array")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	opts := repository.DefaultNameRevOptions()
+	if len(args) >= 3 && args[2].Type() == js.TypeObject {
+		optsJS := args[2]
+		if v := optsJS.Get("tags"); !v.IsUndefined() {
+			opts.Tags = v.Bool()
+		}
+		if refsJS := optsJS.Get("refs"); refsJS.Type() == js.TypeObject {
+			opts.Refs = make([]string, refsJS.Length())
+			for i := range opts.Refs {
+				opts.Refs[i] = refsJS.Index(i).String()
+			}
+		}
+		if excludeJS := optsJS.Get("exclude"); excludeJS.Type() == js.TypeObject {
+			opts.Exclude = make([]string, excludeJS.Length())
+			for i := range opts.Exclude {
+				opts.Exclude[i] = excludeJS.Index(i).String()
+			}
+		}
+	}
+
+	revs := make([]string, revsJS.Get("length").Int())
+	hashes := make([]hash.Hash, len(revs))
+	for i := range revs {
+		revs[i] = revsJS.Index(i).String()
+		if hashes[i], err = repo.ResolveRevision(revs[i]); err != nil {
+			return jsError("failed to resolve " + revs[i] + ": " + err.Error())
+		}
+	}
+
+	names, err := repo.NameRevs(hashes, opts)
+	if err != nil {
+		return jsError("failed to name revisions: " + err.Error())
+	}
+
+	result := make(map[string]interface{}, len(revs))
+	for i, rev := range revs {
+		if name, ok := names[hashes[i].String()]; ok {
+			result[rev] = name
+		} else {
+			result[rev] = nil
+		}
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"names":   result,
+	})
+}
+
+// parseDiffOptions reads line diff options from a JS object on top of opts
+// Keys: algorithm, context, ignoreAllSpace, ignoreSpaceChange, ignoreSpaceAtEol, indentHeuristic, highlight ("word" or "char")
+func parseDiffOptions(val js.Value, opts diff.Options) (diff.Options, error) {
+	if v := val.Get("algorithm"); v.Type() == js.TypeString {
+		algorithm, err := diff.ParseAlgorithm(v.String())
+		if err != nil {
+			return opts, err
+		}
+		opts.Algorithm = algorithm
+	}
+	if v := val.Get("context"); !v.IsUndefined() {
+		opts.Context = v.Int()
+	}
+	if v := val.Get("ignoreAllSpace"); !v.IsUndefined() {
+		opts.IgnoreAllSpace = v.Bool()
+	}
+	if v := val.Get("ignoreSpaceChange"); !v.IsUndefined() {
+		opts.IgnoreSpaceChange = v.Bool()
+	}
+	if v := val.Get("ignoreSpaceAtEol"); !v.IsUndefined() {
+		opts.IgnoreSpaceAtEOL = v.Bool()
+	}
+	if v := val.Get("indentHeuristic"); !v.IsUndefined() {
+		opts.IndentHeuristic = v.Bool()
+	}
+	if v := val.Get("highlight"); v.Type() == js.TypeString {
+		unit, err := diff.ParseUnit(v.String())
+		if err != nil {
+			return opts, err
+		}
+		opts.Highlight = unit
+	}
+	return opts, nil
+}
+
+// parseRepoDiffOptions reads file diff options from a JS object on top of opts
+// Keys: renames, renameThreshold, renameLimit, copies, copiesHarder, copyThreshold, hunks, binaryPatches, and the keys read by parseDiffOptions
+func parseRepoDiffOptions(val js.Value, opts repository.DiffOptions) (repository.DiffOptions, error) {
+	if val.Type() != js.TypeObject {
+		return opts, nil
+	}
+	if v := val.Get("renames"); !v.IsUndefined() {
+		opts.Renames = v.Bool()
+	}
+	if v := val.Get("renameThreshold"); !v.IsUndefined() {
+		opts.RenameThreshold = v.Int()
+	}
+	if v := val.Get("renameLimit"); !v.IsUndefined() {
+		opts.RenameLimit = v.Int()
+	}
+	if v := val.Get("copies"); !v.IsUndefined() {
+		opts.Copies = v.Bool()
+	}
+	if v := val.Get("copiesHarder"); !v.IsUndefined() {
+		opts.CopiesHarder = v.Bool()
+	}
+	if v := val.Get("copyThreshold"); !v.IsUndefined() {
+		opts.CopyThreshold = v.Int()
+	}
+	if v := val.Get("hunks"); !v.IsUndefined() {
+		opts.Hunks = v.Bool()
+	}
+	if v := val.Get("binaryPatches"); !v.IsUndefined() {
+		opts.BinaryPatches = v.Bool()
+	}
+	var err error
+	opts.LineDiff, err = parseDiffOptions(val, opts.LineDiff)
+	return opts, err
+}
+
+// fileDiffsToJS builds the { success, files, patch, stat } result of the diff bindings.
+// Hunks and the patch are left out unless withHunks is set, and stat unless statOpts is set.
+func fileDiffsToJS(files []repository.FileDiff, withHunks bool, statOpts *repository.DiffStatOptions) interface{} {
+	result := map[string]interface{}{"success": true}
+	if statOpts != nil {
+		result["stat"] = diffStatToJS(repository.NewDiffStat(files, *statOpts))
+	}
+
+	var patch strings.Builder
+	filesJS := make([]interface{}, len(files))
+	for i := range files {
+		if withHunks {
+			patch.WriteString(files[i].Patch())
+		} else {
+			files[i].Hunks = nil
+		}
+		filesJS[i] = fileDiffToJS(files[i])
+	}
+
+	result["files"] = filesJS
+	result["patch"] = patch.String()
+	return js.ValueOf(result)
+}
+
+// parseDiffStatOptions reads the stat key of a diff binding's options: true for the
+// default layout, or { width, nameWidth, graphWidth }. It returns nil when no stat
+// is asked for.
+func parseDiffStatOptions(val js.Value) *repository.DiffStatOptions {
+	if val.Type() != js.TypeObject {
+		return nil
+	}
+	opts := repository.DefaultDiffStatOptions()
+	switch stat := val.Get("stat"); stat.Type() {
+	case js.TypeBoolean:
+		if !stat.Bool() {
+			return nil
+		}
+	case js.TypeObject:
+		if v := stat.Get("width"); !v.IsUndefined() {
+			opts.Width = v.Int()
+		}
+		if v := stat.Get("nameWidth"); !v.IsUndefined() {
+			opts.NameWidth = v.Int()
+		}
+		if v := stat.Get("graphWidth"); !v.IsUndefined() {
+			opts.GraphWidth = v.Int()
+		}
+	default:
+		return nil
+	}
+	return &opts
+}
+
+// diffStatToJS converts a diffstat to a JS object
+func diffStatToJS(stat *repository.DiffStat) map[string]interface{} {
+	files := make([]interface{}, len(stat.Files))
+	for i, file := range stat.Files {
+		files[i] = map[string]interface{}{
+			"path":       file.Path,
+			"oldPath":    file.OldPath,
+			"name":       file.Name,
+			"insertions": file.Insertions,
+			"deletions":  file.Deletions,
+			"binary":     file.Binary,
+			"oldSize":    file.OldSize,
+			"newSize":    file.NewSize,
+			"plus":       file.Plus,
+			"minus":      file.Minus,
+		}
+	}
+
+	return map[string]interface{}{
+		"files":      files,
+		"insertions": stat.Insertions,
+		"deletions":  stat.Deletions,
+		"summary":    stat.Summary(),
+		"text":       stat.String(),
+		"numstat":    stat.Numstat(),
+	}
+}
+
+// diffTrees lists the files that differ between two trees, like git diff-tree -r
+// Args: repoPath (string), a (string - tree-ish, "" for the empty tree), b (string - tree-ish, "" for the empty tree),
+// options (object, optional - { renames, renameThreshold, renameLimit, copies, copiesHarder, copyThreshold, hunks, binaryPatches, stat, algorithm, context, ignoreAllSpace, ignoreSpaceChange, ignoreSpaceAtEol, indentHeuristic, highlight })
+// Returns: { success, files: [...], patch, stat } or { error }; patch is "" unless hunks is set.
+// stat (true or { width, nameWidth, graphWidth }) adds { files, insertions, deletions, summary, text, numstat }.
+// With highlight, each hunk has highlights: per line, the [start, end] string indexes of the changed parts after the prefix
+func diffTrees(this js.Value, args []js.Value) interface{} {
+	if len(args) < 3 {
+		return jsError("missing arguments: repoPath, a, b")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	opts := repository.DefaultDiffOptions()
+	var statOpts *repository.DiffStatOptions
+	if len(args) >= 4 {
+		if opts, err = parseRepoDiffOptions(args[3], opts); err != nil {
+			return jsError(err.Error())
+		}
+		statOpts = parseDiffStatOptions(args[3])
+	}
+	withHunks := opts.Hunks
+	opts.Hunks = withHunks || statOpts != nil
+
+	trees := make([]hash.Hash, 2)
+	for i, arg := range args[1:3] {
+		if arg.Type() != js.TypeString || arg.String() == "" {
+			continue
+		}
+		if trees[i], err = repo.ResolveRevision(arg.String()); err != nil {
+			return jsError("failed to resolve " + arg.String() + ": " + err.Error())
+		}
+	}
+
+	files, err := repo.DiffTrees(trees[0], trees[1], opts)
+	if err != nil {
+		return jsError("failed to diff trees: " + err.Error())
+	}
+
+	return fileDiffsToJS(files, withHunks, statOpts)
+}
+
+// diffIndexToWorktree lists the unstaged changes in the work tree, like git diff
+// Args: repoPath (string), options (object, optional - same as diffTrees, but hunks defaults to true)
+// Returns: { success, files: [...], patch, stat } or { error }
+func diffIndexToWorktree(this js.Value, args []js.Value) interface{} {
+	return diffWorkingState(args, (*repository.Repository).DiffIndexToWorktree)
+}
+
+// diffHeadToIndex lists the changes staged for the next commit, like git diff --cached
+// Args: repoPath (string), options (object, optional - same as diffTrees, but hunks defaults to true)
+// Returns: { success, files: [...], patch, stat } or { error }
+func diffHeadToIndex(this js.Value, args []js.Value) interface{} {
+	return diffWorkingState(args, (*repository.Repository).DiffHeadToIndex)
+}
+
+// diffHeadToWorktree lists the changes in the work tree since the last commit, like git diff HEAD
+// Args: repoPath (string), options (object, optional - same as diffTrees, but hunks defaults to true)
+// Returns: { success, files: [...], patch, stat } or { error }
+func diffHeadToWorktree(this js.Value, args []js.Value) interface{} {
+	return diffWorkingState(args, (*repository.Repository).DiffHeadToWorktree)
+}
+
+// diffWorkingState runs one of the index and work tree diffs for a binding
+func diffWorkingState(args []js.Value, diffFn func(*repository.Repository, repository.DiffOptions) ([]repository.FileDiff, error)) interface{} {
+	if len(args) < 1 {
+		return jsError("missing argument: repoPath")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	opts := repository.DefaultDiffOptions()
+	opts.Hunks = true
+	var statOpts *repository.DiffStatOptions
+	if len(args) >= 2 {
+		if opts, err = parseRepoDiffOptions(args[1], opts); err != nil {
+			return jsError(err.Error())
+		}
+		statOpts = parseDiffStatOptions(args[1])
+	}
+	withHunks := opts.Hunks
+	opts.Hunks = withHunks || statOpts != nil
+
+	files, err := diffFn(repo, opts)
+	if err != nil {
+		return jsError("failed to diff: " + err.Error())
+	}
+	return fileDiffsToJS(files, withHunks, statOpts)
+}
+
+// intralineDiff compares two lines word by word or character by character
+// Args: a (string), b (string), unit (string, optional - "word" (default) or "char")
+// Returns: { success, segments: [{ op, text }] } or { error }; op is " " for kept text, "-" for deleted and "+" for inserted
+func intralineDiff(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing arguments: a, b")
+	}
+
+	unit := diff.Word
+	if len(args) >= 3 && args[2].Type() == js.TypeString && args[2].String() != "" {
+		var err error
+		if unit, err = diff.ParseUnit(args[2].String()); err != nil {
+			return jsError(err.Error())
+		}
+	}
+
+	segments := diff.Intraline(args[0].String(), args[1].String(), unit)
+	segmentsJS := make([]interface{}, len(segments))
+	for i, segment := range segments {
+		segmentsJS[i] = map[string]interface{}{
+			"op":   string(segment.Op),
+			"text": segment.Text,
+		}
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success":  true,
+		"segments": segmentsJS,
+	})
+}
+
+// parseLogOptions reads the log options shared by log and logGraph
+func parseLogOptions(optsJS js.Value) repository.LogOptions {
+	opts := repository.DefaultLogOptions()
+	if !optsJS.Get("maxCount").IsUndefined() {
+		opts.MaxCount = optsJS.Get("maxCount").Int()
+	}
+	if !optsJS.Get("author").IsUndefined() {
+		opts.Author = optsJS.Get("author").String()
+	}
+	if !optsJS.Get("committer").IsUndefined() {
+		opts.Committer = optsJS.Get("committer").String()
+	}
+	// A message pattern or an array of them
+	if grepJS := optsJS.Get("grep"); grepJS.Type() == js.TypeString {
+		opts.Grep = []string{grepJS.String()}
+	} else if !grepJS.IsUndefined() {
+		for i := 0; i < grepJS.Length(); i++ {
+			opts.Grep = append(opts.Grep, grepJS.Index(i).String())
+		}
+	}
+	if !optsJS.Get("allMatch").IsUndefined() {
+		opts.AllMatch = optsJS.Get("allMatch").Bool()
+	}
+	if !optsJS.Get("invertGrep").IsUndefined() {
+		opts.InvertGrep = optsJS.Get("invertGrep").Bool()
+	}
+	if !optsJS.Get("ignoreCase").IsUndefined() {
+		opts.RegexpIgnoreCase = optsJS.Get("ignoreCase").Bool()
+	}
+	if !optsJS.Get("fixedStrings").IsUndefined() {
+		opts.FixedStrings = optsJS.Get("fixedStrings").Bool()
+	}
+	if !optsJS.Get("path").IsUndefined() {
+		opts.Path = optsJS.Get("path").String()
+	}
+	if !optsJS.Get("follow").IsUndefined() {
+		opts.Follow = optsJS.Get("follow").Bool()
+	}
+	// A named format or a pretty format string such as "format:%h %s"
+	if !optsJS.Get("format").IsUndefined() {
+		opts.Format = repository.LogFormat(optsJS.Get("format").String())
+	}
+	if !optsJS.Get("order").IsUndefined() {
+		switch optsJS.Get("order").String() {
+		case "date":
+			opts.Order = repository.LogOrderDate
+		case "topo":
+			opts.Order = repository.LogOrderTopo
+		default:
+			opts.Order = repository.LogOrderDefault
+		}
+	}
+	if !optsJS.Get("graph").IsUndefined() {
+		opts.Graph = optsJS.Get("graph").Bool()
+	}
+	if !optsJS.Get("all").IsUndefined() {
+		opts.All = optsJS.Get("all").Bool()
+	}
+	// A notes ref name, or false to leave notes out
+	if notesJS := optsJS.Get("notesRef"); notesJS.Type() == js.TypeString {
+		opts.NotesRef = notesJS.String()
+	} else if notesJS.Type() == js.TypeBoolean && !notesJS.Bool() {
+		opts.NotesRef = ""
+	}
+	if !optsJS.Get("useMailmap").IsUndefined() {
+		opts.UseMailmap = optsJS.Get("useMailmap").Bool()
+	}
+	return opts
+}
+
+// logEntryToJS converts a log entry to JS. With Follow it adds the name
+// the followed file has in the commit, and with formatted the entry in
+// the options' format.
+func logEntryToJS(entry *repository.LogEntry, opts repository.LogOptions, formatted bool) map[string]interface{} {
+	parents := make([]interface{}, len(entry.Parents))
+	for i, p := range entry.Parents {
+		parents[i] = p.String()
+	}
+	jsEntry := map[string]interface{}{
+		"hash":    entry.Hash.String(),
+		"author":  entry.Commit.Author.Name,
+		"email":   entry.Commit.Author.Email,
+		"date":    entry.Commit.Author.When.Unix(),
+		"message": entry.Commit.Message,
+		"parents": parents,
+		"refs":    stringsToJS(entry.Refs),
+		"notes":   entry.Notes,
+	}
+	if opts.Follow {
+		jsEntry["path"] = entry.Path
+	}
+	if formatted {
+		jsEntry["formatted"] = repository.FormatLogEntry(entry, opts.Format)
+	}
+	return jsEntry
+}
+
+// logGraph returns commit history laid out in lanes for drawing a graph
+// Args: repoPath (string), ref (string, optional - defaults to HEAD), options (optional: the options of log)
+// Returns: { success, rows[]: { commit, column, columns, parents[], edges[]: { from, to, parent } } } or { error }
+func logGraph(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	ref := ""
+	if len(args) >= 2 && args[1].Type() == js.TypeString {
+		ref = args[1].String()
+	}
+	opts := repository.DefaultLogOptions()
+	formatted := false
+	if len(args) >= 3 && args[2].Type() == js.TypeObject {
+		opts = parseLogOptions(args[2])
+		formatted = !args[2].Get("format").IsUndefined()
+	}
+
+	rows, err := repo.LogGraph(ref, opts)
+	if err != nil {
+		return jsError("failed to get log graph: " + err.Error())
+	}
+
+	jsRows := make([]interface{}, len(rows))
+	for i, row := range rows {
+		parents := make([]interface{}, len(row.Parents))
+		for j, p := range row.Parents {
+			parents[j] = p.String()
+		}
+		edges := make([]interface{}, len(row.Edges))
+		for j, edge := range row.Edges {
+			edges[j] = map[string]interface{}{
+				"from":   edge.From,
+				"to":     edge.To,
+				"parent": edge.Parent.String(),
+			}
+		}
+		jsRows[i] = map[string]interface{}{
+			"commit":  logEntryToJS(row.Entry, opts, formatted),
+			"column":  row.Column,
+			"columns": row.Columns,
+			"parents": parents,
+			"edges":   edges,
+		}
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"rows":    jsRows,
+	})
+}
+
+// openLogIterator is a log iterator handed to JavaScript
+type openLogIterator struct {
+	it        *repository.LogIterator
+	opts      repository.LogOptions
+	formatted bool
+}
+
+// logIterators holds the open log iterators by the id handed to JavaScript
+var (
+	logIterators      = make(map[int]*openLogIterator)
+	nextLogIteratorID = 1
+)
+
+// logIterator starts a paginated walk of the commit history
+// Args: repoPath (string), ref (string, optional), options (object, optional)
+// Returns: { success: boolean, id: number }
+func logIterator(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	ref := ""
+	if len(args) >= 2 && args[1].Type() == js.TypeString {
+		ref = args[1].String()
+	}
+	opts := repository.DefaultLogOptions()
+	formatted := false
+	if len(args) >= 3 && args[2].Type() == js.TypeObject {
+		opts = parseLogOptions(args[2])
+		formatted = !args[2].Get("format").IsUndefined()
+	}
+
+	it, err := repo.LogIterator(ref, opts)
+	if err != nil {
+		return jsError("failed to start log: " + err.Error())
+	}
+
+	id := nextLogIteratorID
+	nextLogIteratorID++
+	logIterators[id] = &openLogIterator{it: it, opts: opts, formatted: formatted}
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"id":      id,
+	})
+}
+
+// logNextPage returns the next commits of a log iterator. The iterator is
+// closed once it is done.
+// Args: id (number), count (number, optional, default 50)
+// Returns: { success: boolean, commits: array, done: boolean }
+func logNextPage(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing id argument")
+	}
+	id := args[0].Int()
+	open, ok := logIterators[id]
+	if !ok {
+		return jsError(fmt.Sprintf("unknown log iterator: %d", id))
+	}
+
+	count := 50
+	if len(args) >= 2 && args[1].Type() == js.TypeNumber {
+		count = args[1].Int()
+	}
+
+	entries, err := open.it.NextPage(count)
+	if err != nil {
+		return jsError("failed to get log page: " + err.Error())
+	}
+
+	commits := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		commits[i] = logEntryToJS(entry, open.opts, open.formatted)
+	}
+
+	done := open.it.Done() || len(entries) < count
+	if done {
+		delete(logIterators, id)
+	}
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"commits": commits,
+		"done":    done,
+	})
+}
+
+// logIteratorClose releases a log iterator that is no longer needed
+// Args: id (number)
+// Returns: { success: boolean }
+func logIteratorClose(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing id argument")
+	}
+	delete(logIterators, args[0].Int())
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// commitsInRange returns the commits of a revision range, like git rev-list
+// Args: repoPath (string), specs (string or array of strings - revisions, "^rev", "A..B" or "A...B")
+// Returns: { success, commits[] } where the commits of "A...B" have a side of "left" or "right", or { error }
+func commitsInRange(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	var specs []string
+	if len(args) >= 2 && args[1].Type() == js.TypeString {
+		specs = []string{args[1].String()}
+	} else if len(args) >= 2 && args[1].Type() == js.TypeObject {
+		for i := 0; i < args[1].Length(); i++ {
+			specs = append(specs, args[1].Index(i).String())
+		}
+	}
+
+	entries, err := repo.CommitsInRange(specs...)
+	if err != nil {
+		return jsError("failed to list commits: " + err.Error())
+	}
+
+	commits := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		jsEntry := logEntryToJS(entry, repository.DefaultLogOptions(), false)
+		switch entry.Side {
+		case repository.RangeSideLeft:
+			jsEntry["side"] = "left"
+		case repository.RangeSideRight:
+			jsEntry["side"] = "right"
+		}
+		commits[i] = jsEntry
+	}
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"commits": commits,
+	})
+}
+
+// revList lists the commits of a revision range and the objects they need,
+// like git rev-list --objects
+// Args: repoPath (string), specs (string or array of strings - revisions, "^rev", "A..B" or "A...B"), options (object, optional - { objects, count })
+// Returns: { success, commits[], objects[{ hash, type, path }], commitCount, objectCount } or { error }
+func revList(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	opts := repository.RevListOptions{}
+	if len(args) >= 2 && args[1].Type() == js.TypeString {
+		opts.Specs = []string{args[1].String()}
+	} else if len(args) >= 2 && args[1].Type() == js.TypeObject {
+		for i := 0; i < args[1].Length(); i++ {
+			opts.Specs = append(opts.Specs, args[1].Index(i).String())
+		}
+	}
+	if len(args) >= 3 && args[2].Type() == js.TypeObject {
+		if v := args[2].Get("objects"); v.Type() == js.TypeBoolean {
+			opts.Objects = v.Bool()
+		}
+		if v := args[2].Get("count"); v.Type() == js.TypeBoolean {
+			opts.Count = v.Bool()
+		}
+	}
+
+	list, err := repo.RevList(opts)
+	if err != nil {
+		return jsError("failed to list revisions: " + err.Error())
+	}
+
+	commits := make([]interface{}, len(list.Commits))
+	for i, h := range list.Commits {
+		commits[i] = h.String()
+	}
+	objects := make([]interface{}, len(list.Objects))
+	for i, o := range list.Objects {
+		objects[i] = map[string]interface{}{
+			"hash": o.Hash.String(),
+			"type": string(o.Type),
+			"path": o.Path,
+		}
+	}
+	return js.ValueOf(map[string]interface{}{
+		"success":     true,
+		"commits":     commits,
+		"objects":     objects,
+		"commitCount": list.CommitCount,
+		"objectCount": list.ObjectCount,
+	})
+}
+
+// updateRefs applies ref updates all or none, like git update-ref --stdin.
+// Each ref is locked and its old value checked before any is written.
+// With atomic set to false each update is applied on its own instead, and
+// the refs that could not be updated are reported.
+// Args: repoPath (string), updates (array of { ref, newHash, oldHash, message, delete, verify } - oldHash is optional, all zeros for a ref that must not exist), options (object, optional - { atomic })
+// Returns: { success, failed } or { error } - failed maps refs to errors when not atomic
+func updateRefs(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing arguments: repoPath, updates")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	if len(args) >= 3 && args[2].Type() == js.TypeObject && args[2].Get("atomic").Type() == js.TypeBoolean && !args[2].Get("atomic").Bool() {
+		updates := []repository.RefUpdate{}
+		for i := 0; i < args[1].Length(); i++ {
+			update := args[1].Index(i)
+			if update.Get("verify").Truthy() {
+				return jsError("verify needs an atomic update")
+			}
+			entry := repository.RefUpdate{RefName: update.Get("ref").String()}
+			if v := update.Get("oldHash"); v.Type() == js.TypeString {
+				entry.OldHash = v.String()
+			}
+			if !update.Get("delete").Truthy() {
+				if v := update.Get("newHash"); v.Type() != js.TypeString || v.String() == "" {
+					return jsError("missing new hash for " + entry.RefName)
+				}
+				entry.NewHash = update.Get("newHash").String()
+			}
+			updates = append(updates, entry)
+		}
+
+		failed := map[string]interface{}{}
+		err := repo.UpdateRefs(updates, false)
+		var updateErr *repository.RefUpdateError
+		if errors.As(err, &updateErr) {
+			for ref, reason := range updateErr.Failed {
+				failed[ref] = reason.Error()
+			}
+		} else if err != nil {
+			return jsError("failed to update refs: " + err.Error())
+		}
+		return js.ValueOf(map[string]interface{}{
+			"success": len(failed) == 0,
+			"failed":  failed,
+		})
+	}
+
+	parseHash := func(v js.Value) (hash.Hash, error) {
+		if v.Type() != js.TypeString || v.String() == "" {
+			return nil, nil
+		}
+		return hash.ParseHash(v.String())
+	}
+
+	tx := repo.BeginRefTx()
+	for i := 0; i < args[1].Length(); i++ {
+		update := args[1].Index(i)
+		ref := update.Get("ref").String()
+		oldHash, err := parseHash(update.Get("oldHash"))
+		if err != nil {
+			return jsError("invalid old hash for " + ref + ": " + err.Error())
+		}
+		switch {
+		case update.Get("delete").Truthy():
+			err = tx.Delete(ref, oldHash)
+		case update.Get("verify").Truthy():
+			err = tx.Verify(ref, oldHash)
+		default:
+			var newHash hash.Hash
+			if newHash, err = parseHash(update.Get("newHash")); err != nil {
+				return jsError("invalid new hash for " + ref + ": " + err.Error())
+			}
+			message := ""
+			if v := update.Get("message"); v.Type() == js.TypeString {
+				message = v.String()
+			}
+			err = tx.Update(ref, newHash, oldHash, message)
+		}
+		if err != nil {
+			return jsError(err.Error())
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return jsError("failed to update refs: " + err.Error())
+	}
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// symbolicRef reads, sets or deletes a symbolic ref, like git symbolic-ref
+// Args: repoPath (string), name (string - HEAD or a full ref name), target (string, optional - the ref to point name at), options (object, optional - { delete })
+// Returns: { success, target } or { error }
+func symbolicRef(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing arguments: repoPath, name")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	name := args[1].String()
+	if len(args) >= 4 && args[3].Type() == js.TypeObject && args[3].Get("delete").Truthy() {
+		if err := repo.DeleteSymbolicRef(name); err != nil {
+			return jsError("failed to delete symbolic ref: " + err.Error())
+		}
+		return js.ValueOf(map[string]interface{}{
+			"success": true,
+		})
+	}
+
+	if len(args) >= 3 && args[2].Type() == js.TypeString {
+		if err := repo.SetSymbolicRef(name, args[2].String()); err != nil {
+			return jsError("failed to set symbolic ref: " + err.Error())
+		}
+	}
+
+	target, err := repo.SymbolicRef(name)
+	if err != nil {
+		return jsError(err.Error())
+	}
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"target":  target,
+	})
+}
+
+// remoteDefaultBranch returns the default branch recorded for a remote at
+// clone or fetch time, without contacting it
+// Args: repoPath (string), remote (string, optional - defaults to "origin")
+// Returns: { success, branch } or { error }
+func remoteDefaultBranch(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	remote := "origin"
+	if len(args) >= 2 && args[1].Type() == js.TypeString {
+		remote = args[1].String()
+	}
+
+	branch, err := repo.RemoteDefaultBranch(remote)
+	if err != nil {
+		return jsError(err.Error())
+	}
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"branch":  branch,
+	})
+}
+
+// listRefs lists local refs matching prefixes or glob patterns, with their
+// values. With onRef each ref is passed to it as it is read instead of
+// being collected, and returning false from it stops the listing.
+// Args: repoPath (string), patterns (string or array of strings, optional - e.g. "refs/heads/" or "refs/tags/v1.*"), options (object, optional - { peel, onRef })
+// Returns: { success, refs: [{ name, hash, peeled, target }] }, { success, count } with onRef, or { error }
+func listRefs(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	opts := repository.WalkRefsOptions{}
+	if len(args) >= 2 && args[1].Type() == js.TypeString {
+		opts.Patterns = []string{args[1].String()}
+	} else if len(args) >= 2 && args[1].Type() == js.TypeObject {
+		for i := 0; i < args[1].Length(); i++ {
+			opts.Patterns = append(opts.Patterns, args[1].Index(i).String())
+		}
+	}
+	onRef := js.Undefined()
+	if len(args) >= 3 && args[2].Type() == js.TypeObject {
+		opts.Peel = args[2].Get("peel").Truthy()
+		if v := args[2].Get("onRef"); v.Type() == js.TypeFunction {
+			onRef = v
+		}
+	}
+
+	errStop := errors.New("stopped")
+	refs := make([]interface{}, 0)
+	count := 0
+	err = repo.WalkRefs(opts, func(ref repository.Ref) error {
+		entry := map[string]interface{}{
+			"name": ref.Name,
+			"hash": ref.Hash.String(),
+		}
+		if ref.Peeled != nil {
+			entry["peeled"] = ref.Peeled.String()
+		}
+		if ref.Target != "" {
+			entry["target"] = ref.Target
+		}
+		count++
+		if onRef.IsUndefined() {
+			refs = append(refs, entry)
+			return nil
+		}
+		if result := onRef.Invoke(js.ValueOf(entry)); result.Type() == js.TypeBoolean && !result.Bool() {
+			return errStop
+		}
+		return nil
+	})
+	if err != nil && err != errStop {
+		return jsError("failed to list refs: " + err.Error())
+	}
+
+	if !onRef.IsUndefined() {
+		return js.ValueOf(map[string]interface{}{
+			"success": true,
+			"count":   count,
+		})
+	}
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"refs":    refs,
+	})
+}
+
+// recoverBranch recreates a deleted branch from the reflog
+// Args: repoPath (string), name (string)
+// Returns: { success, branchName, hash } or { error }
+func recoverBranch(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing repoPath or name arguments")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	branchName := args[1].String()
+	h, err := repo.RecoverBranch(branchName)
+	if err != nil {
+		return jsError("failed to recover branch: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success":    true,
+		"branchName": branchName,
+		"hash":       h.String(),
+	})
+}
+
+// fetchHead reads the refs the last fetch recorded in FETCH_HEAD
+// Args: repoPath (string)
+// Returns: { success, entries: [{ hash, ref, url, description, notForMerge }] } or { error } - entries marked for merging come first
+func fetchHead(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	entries, err := repo.FetchHead()
+	if err != nil {
+		return jsError(err.Error())
+	}
+
+	result := make([]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, map[string]interface{}{
+			"hash":        entry.Hash.String(),
+			"ref":         entry.Ref,
+			"url":         entry.URL,
+			"description": entry.Description(),
+			"notForMerge": entry.NotForMerge,
+		})
+	}
+	return js.ValueOf(map[string]interface{}{
+		"success": true,
+		"entries": result,
+	})
+}
+
+// setNamespace switches later calls to the refs of a namespace, so one
+// object store can host several repositories; "" returns to the top-level
+// refs, as with GIT_NAMESPACE
+// Args: repoPath (string), namespace (string)
+// Returns: { success, namespace } or { error }
+func setNamespace(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return jsError("missing arguments: repoPath and namespace required")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	if err := repo.SetNamespace(args[1].String()); err != nil {
+		return jsError(err.Error())
+	}
+	// Every binding opens the repository anew, which reads GIT_NAMESPACE
+	if err := os.Setenv("GIT_NAMESPACE", repo.Namespace); err != nil {
+		return jsError("failed to set namespace: " + err.Error())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"success":   true,
+		"namespace": repo.Namespace,
+	})
+}
+
+// push pushes to a remote, reporting what the remote did with each ref so
+// a rejected branch and the reason for it can be shown
+// Args: repoPath (string), options (optional object: { remote, refSpecs, force, noVerify, setUpstream, verifyObjects, onProgress })
+// Returns: Promise of { success, upToDate, unpackStatus, refs[], messages[], error, trackingError } or { error }
+func push(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return jsError("missing repoPath argument")
+	}
+
+	repo, err := repository.Open(args[0].String())
+	if err != nil {
+		return jsError("failed to open repository: " + err.Error())
+	}
+
+	opts := repository.DefaultPushOptions()
+	if len(args) >= 2 && args[1].Type() == js.TypeObject {
+		optsJS := args[1]
+		if !optsJS.Get("remote").IsUndefined() {
+			opts.Remote = optsJS.Get("remote").String()
+		}
+		if refSpecsJS := optsJS.Get("refSpecs"); !refSpecsJS.IsUndefined() {
+			for i := 0; i < refSpecsJS.Length(); i++ {
+				opts.RefSpecs = append(opts.RefSpecs, refSpecsJS.Index(i).String())
+			}
+		}
+		if !optsJS.Get("force").IsUndefined() {
+			opts.Force = optsJS.Get("force").Bool()
+		}
+		if !optsJS.Get("noVerify").IsUndefined() {
+			opts.NoVerify = optsJS.Get("noVerify").Bool()
+		}
+		if !optsJS.Get("setUpstream").IsUndefined() {
+			opts.SetUpstream = optsJS.Get("setUpstream").Bool()
+		}
+		if !optsJS.Get("verifyObjects").IsUndefined() {
+			opts.VerifyObjects = optsJS.Get("verifyObjects").Bool()
+		}
+		if onProgress := optsJS.Get("onProgress"); onProgress.Type() == js.TypeFunction {
+			opts.ProgressCallback = func(message string) {
+				onProgress.Invoke(message)
+			}
+		}
+	}
+
+	return newPromise(func() interface{} {
+		result, err := repo.PushWithResult(opts)
+		if err != nil {
+			return jsError("failed to push: " + err.Error())
+		}
+
+		refs := make([]interface{}, len(result.Refs))
+		for i, ref := range result.Refs {
+			refs[i] = map[string]interface{}{
+				"localRef":     ref.LocalRef,
+				"remoteRef":    ref.RemoteRef,
+				"oldHash":      ref.OldHash,
+				"newHash":      ref.NewHash,
+				"ok":           ref.OK,
+				"message":      ref.Message,
+				"rewrittenRef": ref.RewrittenRef,
+				"forcedUpdate": ref.ForcedUpdate,
+			}
+		}
+
+		// A refused ref fails the push, but every ref's result is kept. A
+		// remote tracking branch left behind does not fail it.
+		response := map[string]interface{}{
+			"success":      true,
+			"upToDate":     result.UpToDate,
+			"unpackStatus": result.UnpackStatus,
+			"refs":         refs,
+			"messages":     stringsToJS(result.Messages),
+		}
+		if err := result.Err(); err != nil {
+			response["success"] = false
+			response["error"] = "failed to push: " + err.Error()
+		}
+		if result.TrackingError != nil {
+			response["trackingError"] = result.TrackingError.Error()
+		}
+		return js.ValueOf(response)
 	})
 }
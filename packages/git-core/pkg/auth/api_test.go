@@ -0,0 +1,23 @@
+package auth
+
+import "net/http"
+
+// The frozen API listed in the package documentation. These assignments
+// stop compiling if one of the signatures changes.
+var (
+	_ AuthProvider = (*NoneAuthProvider)(nil)
+	_ AuthProvider = (*BasicAuthProvider)(nil)
+	_ AuthProvider = (*TokenAuthProvider)(nil)
+	_ AuthProvider = (*OAuthProvider)(nil)
+	_ AuthProvider = (*CustomAuthProvider)(nil)
+
+	_ func(AuthProvider) AuthMethod           = AuthProvider.GetMethod
+	_ func(AuthProvider, *http.Request) error = AuthProvider.ApplyAuth
+	_ func(AuthProvider) error                = AuthProvider.ValidateCredentials
+
+	_ func(*AuthConfig) (AuthProvider, error)                                = NewAuthProvider
+	_ func(string, string) *BasicAuthProvider                                = NewBasicAuthProvider
+	_ func(string) *TokenAuthProvider                                        = NewTokenAuthProvider
+	_ func(string, string) *OAuthProvider                                    = NewOAuthProvider
+	_ func(map[string]string, func(*http.Request) error) *CustomAuthProvider = NewCustomAuthProvider
+)
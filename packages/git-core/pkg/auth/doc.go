@@ -0,0 +1,21 @@
+// Package auth provides the authentication applied to smart HTTP requests:
+// HTTP Basic, bearer tokens, OAuth access tokens and custom headers.
+//
+// Providers are created directly or from an [AuthConfig]:
+//
+//	provider, err := auth.NewAuthProvider(&auth.AuthConfig{
+//		Method: auth.AuthMethodToken,
+//		Token:  token,
+//	})
+//
+// # Stability
+//
+// The following are frozen: they keep their names and signatures for all
+// v0.x and v1 releases. Everything else may change in a minor release.
+//
+//   - the [AuthProvider] interface
+//   - [AuthMethod] and its AuthMethod* constants
+//   - [AuthConfig] and [NewAuthProvider]
+//   - [NewBasicAuthProvider], [NewTokenAuthProvider], [NewOAuthProvider]
+//     and [NewCustomAuthProvider]
+package auth
@@ -0,0 +1,30 @@
+package auth_test
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/auth"
+)
+
+// Authenticate smart HTTP requests with a personal access token
+func ExampleNewAuthProvider() {
+	provider, err := auth.NewAuthProvider(&auth.AuthConfig{
+		Method: auth.AuthMethodToken,
+		Token:  "ghp_example",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", "https://example.com/repo.git/info/refs", nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := provider.ApplyAuth(req); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(req.Header.Get("Authorization"))
+	// Output: Bearer ghp_example
+}
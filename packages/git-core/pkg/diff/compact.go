@@ -0,0 +1,321 @@
+package diff
+
+// Weights of the indent heuristic, as tuned for Git's xdiff
+const (
+	maxIndent                       = 200
+	maxBlanks                       = 20
+	startOfFilePenalty              = 1
+	endOfFilePenalty                = 21
+	totalBlankWeight                = -30
+	postBlankWeight                 = 6
+	relativeIndentPenalty           = -4
+	relativeIndentWithBlankPenalty  = 10
+	relativeOutdentPenalty          = 24
+	relativeOutdentWithBlankPenalty = 17
+	relativeDedentPenalty           = 23
+	relativeDedentWithBlankPenalty  = 17
+	indentWeight                    = 60
+	indentHeuristicMaxSliding       = 100
+)
+
+// group is a run of changed lines [start, end), which may be empty
+type group struct {
+	start, end int
+}
+
+// changes is one text's lines and changed flags, as walked by compact
+type changes struct {
+	lines   []int
+	changed []bool
+}
+
+// isChanged reports whether line i changed; lines outside the text have not
+func (c *changes) isChanged(i int) bool {
+	return i >= 0 && i < len(c.changed) && c.changed[i]
+}
+
+// first returns the group at the start of the text
+func (c *changes) first() group {
+	g := group{}
+	for c.isChanged(g.end) {
+		g.end++
+	}
+	return g
+}
+
+// next moves g to the following group, reporting false at the end
+func (c *changes) next(g *group) bool {
+	if g.end == len(c.changed) {
+		return false
+	}
+	g.start = g.end + 1
+	g.end = g.start
+	for c.isChanged(g.end) {
+		g.end++
+	}
+	return true
+}
+
+// previous moves g to the preceding group, reporting false at the start
+func (c *changes) previous(g *group) bool {
+	if g.start == 0 {
+		return false
+	}
+	g.end = g.start - 1
+	g.start = g.end
+	for c.isChanged(g.start - 1) {
+		g.start--
+	}
+	return true
+}
+
+// slideDown moves a non-empty group one line down when the line after it
+// equals its first line, merging any group it runs into
+func (c *changes) slideDown(g *group) bool {
+	if g.end < len(c.lines) && c.lines[g.start] == c.lines[g.end] {
+		c.changed[g.start] = false
+		c.changed[g.end] = true
+		g.start++
+		g.end++
+		for c.isChanged(g.end) {
+			g.end++
+		}
+		return true
+	}
+	return false
+}
+
+// slideUp moves a non-empty group one line up when the line before it
+// equals its last line, merging any group it runs into
+func (c *changes) slideUp(g *group) bool {
+	if g.start > 0 && c.lines[g.start-1] == c.lines[g.end-1] {
+		g.start--
+		g.end--
+		c.changed[g.start] = true
+		c.changed[g.end] = false
+		for c.isChanged(g.start - 1) {
+			g.start--
+		}
+		return true
+	}
+	return false
+}
+
+// compact slides each run of changes in one text to where it reads best,
+// like Git's xdl_change_compact. A run of changes whose first and last
+// lines are equal, such as an added function followed by a blank line,
+// can be placed in several spots. Runs are merged when they touch, lined
+// up with changes in the other text where possible, and otherwise placed
+// by the indent heuristic or as low as they go.
+func (d *differ) compact(lines []int, text []string, changed, otherChanged []bool) {
+	c := &changes{lines: lines, changed: changed}
+	other := &changes{changed: otherChanged}
+	g, og := c.first(), other.first()
+
+	for {
+		if g.end != g.start {
+			var earliestEnd, endMatchingOther, size int
+			for {
+				size = g.end - g.start
+				endMatchingOther = -1
+
+				for c.slideUp(&g) {
+					other.previous(&og)
+				}
+				earliestEnd = g.end
+				if og.end > og.start {
+					endMatchingOther = g.end
+				}
+
+				for c.slideDown(&g) {
+					other.next(&og)
+					if og.end > og.start {
+						endMatchingOther = g.end
+					}
+				}
+
+				// Sliding merged groups; slide the larger one again
+				if size == g.end-g.start {
+					break
+				}
+			}
+
+			switch {
+			case g.end == earliestEnd:
+				// The group cannot move
+			case endMatchingOther != -1:
+				// Line up with the last change in the other text it can
+				for og.end == og.start {
+					c.slideUp(&g)
+					other.previous(&og)
+				}
+			case d.opts.IndentHeuristic:
+				shift := earliestEnd
+				if g.end-size-1 > shift {
+					shift = g.end - size - 1
+				}
+				if g.end-indentHeuristicMaxSliding > shift {
+					shift = g.end - indentHeuristicMaxSliding
+				}
+				bestShift := -1
+				var best splitScore
+				for ; shift <= g.end; shift++ {
+					score := splitScore{}
+					score.add(measureSplit(text, shift))
+					score.add(measureSplit(text, shift-size))
+					if bestShift == -1 || score.compare(best) <= 0 {
+						best = score
+						bestShift = shift
+					}
+				}
+				for g.end > bestShift {
+					c.slideUp(&g)
+					other.previous(&og)
+				}
+			}
+		}
+
+		if !c.next(&g) {
+			return
+		}
+		other.next(&og)
+	}
+}
+
+// splitMeasurement describes the lines around a split between two lines
+type splitMeasurement struct {
+	// endOfFile is set when the split is at the end of the text
+	endOfFile bool
+	// indent is the indent of the line after the split, or -1 if it is blank
+	indent int
+	// preBlank counts the blank lines just before the split
+	preBlank int
+	// preIndent is the indent of the nearest non-blank line before the
+	// split, or -1 if there is none
+	preIndent int
+	// postBlank counts the blank lines after the line after the split
+	postBlank int
+	// postIndent is the indent of the nearest non-blank line after the line
+	// after the split, or -1 if there is none
+	postIndent int
+}
+
+// measureSplit measures the split before line i
+func measureSplit(text []string, i int) splitMeasurement {
+	m := splitMeasurement{indent: -1, preIndent: -1, postIndent: -1}
+	if i >= len(text) {
+		m.endOfFile = true
+	} else {
+		m.indent = lineIndent(text[i])
+	}
+
+	for j := i - 1; j >= 0; j-- {
+		if m.preIndent = lineIndent(text[j]); m.preIndent != -1 {
+			break
+		}
+		m.preBlank++
+		if m.preBlank == maxBlanks {
+			m.preIndent = 0
+			break
+		}
+	}
+
+	for j := i + 1; j < len(text); j++ {
+		if m.postIndent = lineIndent(text[j]); m.postIndent != -1 {
+			break
+		}
+		m.postBlank++
+		if m.postBlank == maxBlanks {
+			m.postIndent = 0
+			break
+		}
+	}
+	return m
+}
+
+// lineIndent returns the width of a line's indentation, with tabs
+// reaching the next multiple of eight, or -1 for a blank line
+func lineIndent(line string) int {
+	indent := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ' ':
+			indent++
+		case '\t':
+			indent += 8 - indent%8
+		case '\n', '\r', '\v', '\f':
+			// Other whitespace does not indent
+		default:
+			return indent
+		}
+		if indent >= maxIndent {
+			return maxIndent
+		}
+	}
+	return -1
+}
+
+// splitScore rates the two splits around a group; lower is better
+type splitScore struct {
+	effectiveIndent int
+	penalty         int
+}
+
+// add adds the score of one split
+func (s *splitScore) add(m splitMeasurement) {
+	if m.preIndent == -1 && m.preBlank == 0 {
+		s.penalty += startOfFilePenalty
+	}
+	if m.endOfFile {
+		s.penalty += endOfFilePenalty
+	}
+
+	postBlank := 0
+	if m.indent == -1 {
+		postBlank = 1 + m.postBlank
+	}
+	totalBlank := m.preBlank + postBlank
+	s.penalty += totalBlankWeight * totalBlank
+	s.penalty += postBlankWeight * postBlank
+
+	indent := m.indent
+	if indent == -1 {
+		indent = m.postIndent
+	}
+	anyBlanks := totalBlank != 0
+	s.effectiveIndent += indent
+
+	switch {
+	case indent == -1, m.preIndent == -1, indent == m.preIndent:
+		// No adjustment
+	case indent > m.preIndent:
+		if anyBlanks {
+			s.penalty += relativeIndentWithBlankPenalty
+		} else {
+			s.penalty += relativeIndentPenalty
+		}
+	case m.postIndent != -1 && m.postIndent > indent:
+		if anyBlanks {
+			s.penalty += relativeOutdentWithBlankPenalty
+		} else {
+			s.penalty += relativeOutdentPenalty
+		}
+	default:
+		if anyBlanks {
+			s.penalty += relativeDedentWithBlankPenalty
+		} else {
+			s.penalty += relativeDedentPenalty
+		}
+	}
+}
+
+// compare returns a negative number when s is better than other
+func (s splitScore) compare(other splitScore) int {
+	cmp := 0
+	if s.effectiveIndent > other.effectiveIndent {
+		cmp = 1
+	} else if s.effectiveIndent < other.effectiveIndent {
+		cmp = -1
+	}
+	return indentWeight*cmp + s.penalty - other.penalty
+}
@@ -0,0 +1,227 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Algorithm selects how the changes between two texts are found
+type Algorithm string
+
+const (
+	// Myers finds a minimal edit script, settling for a close one on large
+	// inputs. It is Git's default.
+	Myers Algorithm = "myers"
+	// Histogram anchors the diff on lines that occur rarely, which keeps
+	// moved blocks and repeated lines such as braces better aligned
+	Histogram Algorithm = "histogram"
+)
+
+// ParseAlgorithm parses an algorithm name as used by git diff
+// --diff-algorithm. Patience is accepted as histogram, which extends it.
+func ParseAlgorithm(s string) (Algorithm, error) {
+	switch strings.ToLower(s) {
+	case "", "myers", "default", "minimal":
+		return Myers, nil
+	case "histogram", "patience":
+		return Histogram, nil
+	default:
+		return "", fmt.Errorf("unknown diff algorithm: %s", s)
+	}
+}
+
+// Options contains options for computing a diff
+type Options struct {
+	// Algorithm is the diff algorithm to use
+	Algorithm Algorithm
+	// Context is the number of unchanged lines shown around each change
+	Context int
+	// IgnoreAllSpace compares lines with all whitespace removed (git diff -w)
+	IgnoreAllSpace bool
+	// IgnoreSpaceChange treats runs of whitespace as one space and ignores
+	// whitespace at the end of lines (git diff -b)
+	IgnoreSpaceChange bool
+	// IgnoreSpaceAtEOL ignores whitespace at the end of lines
+	IgnoreSpaceAtEOL bool
+	// IndentHeuristic places ambiguous changes where the indentation and
+	// blank lines suggest they belong, like Git does by default
+	IndentHeuristic bool
+	// Highlight marks the changed words or characters of replaced lines
+	// in hunks, like contrib's diff-highlight. Empty leaves them unmarked.
+	Highlight Unit
+}
+
+// DefaultOptions returns default diff options
+func DefaultOptions() Options {
+	return Options{
+		Algorithm:         Myers,
+		Context:           3,
+		IgnoreAllSpace:    false,
+		IgnoreSpaceChange: false,
+		IgnoreSpaceAtEOL:  false,
+		IndentHeuristic:   true,
+		Highlight:         "",
+	}
+}
+
+// Op is the kind of an edit
+type Op byte
+
+const (
+	// Equal keeps a line
+	Equal Op = ' '
+	// Delete removes a line of the old text
+	Delete Op = '-'
+	// Insert adds a line of the new text
+	Insert Op = '+'
+)
+
+// Edit is one step of an edit script
+type Edit struct {
+	Op Op
+	// OldIndex is the line's index in the old text, or -1 for an insert
+	OldIndex int
+	// NewIndex is the line's index in the new text, or -1 for a delete
+	NewIndex int
+	// Line is the line's text. Equal lines are taken from the new text,
+	// which matters when whitespace is ignored.
+	Line string
+}
+
+// SplitLines splits content into lines that keep their newlines. Only the
+// last line can lack one.
+func SplitLines(content []byte) []string {
+	lines := []string{}
+	for len(content) > 0 {
+		end := bytes.IndexByte(content, '\n') + 1
+		if end == 0 {
+			end = len(content)
+		}
+		lines = append(lines, string(content[:end]))
+		content = content[end:]
+	}
+	return lines
+}
+
+// Lines returns the edit script turning the lines of a into the lines of b.
+// Within each run of changes, deletions come before insertions.
+func Lines(a, b []string, opts Options) []Edit {
+	d := newDiffer(a, b, opts)
+	d.run()
+
+	edits := make([]Edit, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && d.changedA[i]:
+			edits = append(edits, Edit{Op: Delete, OldIndex: i, NewIndex: -1, Line: a[i]})
+			i++
+		case j < len(b) && d.changedB[j]:
+			edits = append(edits, Edit{Op: Insert, OldIndex: -1, NewIndex: j, Line: b[j]})
+			j++
+		default:
+			edits = append(edits, Edit{Op: Equal, OldIndex: i, NewIndex: j, Line: b[j]})
+			i++
+			j++
+		}
+	}
+	return edits
+}
+
+// differ holds the state of one diff: the lines of both texts as numbers
+// that are equal when the lines compare equal, and which lines changed
+type differ struct {
+	opts     Options
+	textA    []string
+	textB    []string
+	a, b     []int
+	changedA []bool
+	changedB []bool
+}
+
+// newDiffer numbers the lines of a and b under the whitespace options
+func newDiffer(a, b []string, opts Options) *differ {
+	d := &differ{
+		opts:     opts,
+		textA:    a,
+		textB:    b,
+		a:        make([]int, len(a)),
+		b:        make([]int, len(b)),
+		changedA: make([]bool, len(a)),
+		changedB: make([]bool, len(b)),
+	}
+
+	ids := make(map[string]int)
+	number := func(line string) int {
+		key := normalizeLine(line, opts)
+		id, ok := ids[key]
+		if !ok {
+			id = len(ids)
+			ids[key] = id
+		}
+		return id
+	}
+	for i, line := range a {
+		d.a[i] = number(line)
+	}
+	for i, line := range b {
+		d.b[i] = number(line)
+	}
+	return d
+}
+
+// run marks the changed lines of both texts
+func (d *differ) run() {
+	if d.opts.Algorithm == Histogram {
+		d.histogram(0, len(d.a), 0, len(d.b))
+	} else {
+		d.myers(0, len(d.a), 0, len(d.b))
+	}
+
+	d.compact(d.a, d.textA, d.changedA, d.changedB)
+	d.compact(d.b, d.textB, d.changedB, d.changedA)
+}
+
+// markChanged marks a[alo:ahi] as deleted and b[blo:bhi] as inserted
+func (d *differ) markChanged(alo, ahi, blo, bhi int) {
+	for i := alo; i < ahi; i++ {
+		d.changedA[i] = true
+	}
+	for i := blo; i < bhi; i++ {
+		d.changedB[i] = true
+	}
+}
+
+// normalizeLine returns the form of a line that is compared under the
+// whitespace options
+func normalizeLine(line string, opts Options) string {
+	switch {
+	case opts.IgnoreAllSpace:
+		return strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, line)
+	case opts.IgnoreSpaceChange:
+		var b strings.Builder
+		space := false
+		for _, r := range strings.TrimRightFunc(line, unicode.IsSpace) {
+			if unicode.IsSpace(r) {
+				space = true
+				continue
+			}
+			if space {
+				b.WriteByte(' ')
+				space = false
+			}
+			b.WriteRune(r)
+		}
+		return b.String()
+	case opts.IgnoreSpaceAtEOL:
+		return strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+	return line
+}
@@ -0,0 +1,233 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+// unified formats hunks the way git diff prints them, without file headers
+func unified(hunks []Hunk) string {
+	var b strings.Builder
+	for _, hunk := range hunks {
+		b.WriteString(hunk.Header() + "\n")
+		for _, line := range hunk.Lines {
+			b.WriteString(line)
+			if !strings.HasSuffix(line, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+// The expected output of each case is what git diff --no-index prints
+func TestHunks(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		opts     func(*Options)
+		want     string
+	}{
+		{
+			name: "identical",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			want: "",
+		},
+		{
+			name: "added file",
+			old:  "",
+			new:  "a\nb\n",
+			want: "@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "deleted file",
+			old:  "a\n",
+			new:  "",
+			want: "@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			name: "change with context",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n",
+			new:  "1\n2\n3\n4\nfive\n6\n7\n8\n",
+			want: "@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "close changes share a hunk",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n",
+			new:  "one\n2\n3\n4\n5\n6\n7\neight\n",
+			want: "@@ -1,8 +1,8 @@\n-1\n+one\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+eight\n",
+		},
+		{
+			name: "distant changes are split",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			new:  "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			want: "@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+		{
+			name: "zero context",
+			old:  "a\nb\nc\n",
+			new:  "a\nB\nc\n",
+			opts: func(o *Options) { o.Context = 0 },
+			want: "@@ -2 +2 @@\n-b\n+B\n",
+		},
+		{
+			name: "missing newline at end",
+			old:  "a\nb",
+			new:  "a\nb\n",
+			want: "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			name: "myers",
+			old:  "c\nb\na\n",
+			new:  "{\nb\nb\nc\n",
+			want: "@@ -1,3 +1,4 @@\n-c\n+{\n+b\n b\n-a\n+c\n",
+		},
+		{
+			name: "histogram",
+			old:  "c\nb\na\n",
+			new:  "{\nb\nb\nc\n",
+			opts: func(o *Options) { o.Algorithm = Histogram },
+			want: "@@ -1,3 +1,4 @@\n-c\n+{\n b\n-a\n+b\n+c\n",
+		},
+		{
+			name: "indent heuristic",
+			old:  "\n\tif y {\n\treturn 1\n",
+			new:  "\n\tif y {\n\t}\n\tif y {\n\treturn 1\n",
+			want: "@@ -1,3 +1,5 @@\n \n+\tif y {\n+\t}\n \tif y {\n \treturn 1\n",
+		},
+		{
+			name: "no indent heuristic",
+			old:  "\n\tif y {\n\treturn 1\n",
+			new:  "\n\tif y {\n\t}\n\tif y {\n\treturn 1\n",
+			opts: func(o *Options) { o.IndentHeuristic = false },
+			want: "@@ -1,3 +1,5 @@\n \n \tif y {\n+\t}\n+\tif y {\n \treturn 1\n",
+		},
+		{
+			name: "whitespace counts by default",
+			old:  "one\ntwo  words\nthree \n",
+			new:  "one\ntwo words\nthree\n",
+			want: "@@ -1,3 +1,3 @@\n one\n-two  words\n-three \n+two words\n+three\n",
+		},
+		{
+			name: "ignore all space",
+			old:  "one\ntwo  words\nthree \n",
+			new:  "one\ntwowords\nthree\n",
+			opts: func(o *Options) { o.IgnoreAllSpace = true },
+			want: "",
+		},
+		{
+			name: "ignore space change",
+			old:  "one\ntwo  words\nthree \n",
+			new:  "one\ntwo words\nthree\n",
+			opts: func(o *Options) { o.IgnoreSpaceChange = true },
+			want: "",
+		},
+		{
+			name: "ignore space change keeps added space",
+			old:  "twowords\n",
+			new:  "two words\n",
+			opts: func(o *Options) { o.IgnoreSpaceChange = true },
+			want: "@@ -1 +1 @@\n-twowords\n+two words\n",
+		},
+		{
+			name: "ignore space at eol",
+			old:  "one\ntwo  words\nthree \n",
+			new:  "one\ntwo words\nthree\n",
+			opts: func(o *Options) { o.IgnoreSpaceAtEOL = true },
+			want: "@@ -1,3 +1,3 @@\n one\n-two  words\n+two words\n three\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			if tt.opts != nil {
+				tt.opts(&opts)
+			}
+			got := unified(Hunks(SplitLines([]byte(tt.old)), SplitLines([]byte(tt.new)), opts))
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLines(t *testing.T) {
+	edits := Lines([]string{"a\n", "b\n", "c\n"}, []string{"a\n", "x\n", "c\n", "d\n"}, DefaultOptions())
+	want := []Edit{
+		{Op: Equal, OldIndex: 0, NewIndex: 0, Line: "a\n"},
+		{Op: Delete, OldIndex: 1, NewIndex: -1, Line: "b\n"},
+		{Op: Insert, OldIndex: -1, NewIndex: 1, Line: "x\n"},
+		{Op: Equal, OldIndex: 2, NewIndex: 2, Line: "c\n"},
+		{Op: Insert, OldIndex: -1, NewIndex: 3, Line: "d\n"},
+	}
+	if len(edits) != len(want) {
+		t.Fatalf("expected %d edits, got %v", len(want), edits)
+	}
+	for i := range want {
+		if edits[i] != want[i] {
+			t.Errorf("edit %d: expected %+v, got %+v", i, want[i], edits[i])
+		}
+	}
+}
+
+// Both algorithms must produce an edit script that turns a into b,
+// including on inputs large enough to hit the Myers cost limits
+func TestLinesReproducesNewText(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 3000; i++ {
+		a = append(a, string(rune('a'+i*7%13))+"\n")
+		if i%5 != 0 {
+			b = append(b, string(rune('a'+i*11%17))+"\n")
+		}
+	}
+
+	for _, algorithm := range []Algorithm{Myers, Histogram} {
+		opts := DefaultOptions()
+		opts.Algorithm = algorithm
+
+		var oldText, newText []string
+		for _, edit := range Lines(a, b, opts) {
+			if edit.Op != Insert {
+				oldText = append(oldText, a[edit.OldIndex])
+			}
+			if edit.Op != Delete {
+				newText = append(newText, b[edit.NewIndex])
+			}
+		}
+		if strings.Join(oldText, "") != strings.Join(a, "") || strings.Join(newText, "") != strings.Join(b, "") {
+			t.Errorf("%s: edit script does not turn a into b", algorithm)
+		}
+	}
+}
+
+func TestParseAlgorithm(t *testing.T) {
+	tests := map[string]Algorithm{
+		"":          Myers,
+		"myers":     Myers,
+		"minimal":   Myers,
+		"histogram": Histogram,
+		"Patience":  Histogram,
+	}
+	for name, want := range tests {
+		got, err := ParseAlgorithm(name)
+		if err != nil || got != want {
+			t.Errorf("ParseAlgorithm(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+
+	if _, err := ParseAlgorithm("bogus"); err == nil {
+		t.Error("expected an error for an unknown algorithm")
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	lines := SplitLines([]byte("a\n\nb"))
+	if len(lines) != 3 || lines[0] != "a\n" || lines[1] != "\n" || lines[2] != "b" {
+		t.Errorf("unexpected lines: %q", lines)
+	}
+	if lines := SplitLines(nil); len(lines) != 0 {
+		t.Errorf("expected no lines, got %q", lines)
+	}
+}
@@ -0,0 +1,19 @@
+// Package diff computes line diffs between two versions of a text and
+// groups them into unified diff hunks.
+//
+// [Lines] returns the edit script turning one list of lines into another
+// and [Hunks] groups it into hunks with context, as git diff prints them:
+//
+//	hunks := diff.Hunks(diff.SplitLines(old), diff.SplitLines(new), diff.DefaultOptions())
+//
+// Both Myers' algorithm and Git's histogram algorithm are available, and
+// changes can be made to ignore whitespace. Like Git, changes that could
+// be placed at several positions are slid to the one that reads best.
+//
+// [Intraline] compares two lines word by word or character by character,
+// and hunks can mark the changed parts of replaced lines for display.
+//
+// The repository package uses it for show and format-patch output.
+// Calling it directly is experimental: its API may change in a minor
+// release.
+package diff
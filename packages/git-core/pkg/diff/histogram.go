@@ -0,0 +1,94 @@
+package diff
+
+// maxChainLength is the most times a line may occur in the old text and
+// still anchor a histogram diff; ranges without a rarer common line are
+// diffed with Myers' algorithm instead
+const maxChainLength = 64
+
+// histogram marks the changes between a[alo:ahi] and b[blo:bhi] using
+// Git's histogram algorithm. It finds the longest common run of lines
+// built around the rarest lines of a, keeps it, and diffs the ranges
+// before and after it.
+func (d *differ) histogram(alo, ahi, blo, bhi int) {
+	for {
+		if alo == ahi || blo == bhi {
+			d.markChanged(alo, ahi, blo, bhi)
+			return
+		}
+
+		// Where each line of the old range occurs, in order
+		occurrences := make(map[int][]int)
+		for i := alo; i < ahi; i++ {
+			occurrences[d.a[i]] = append(occurrences[d.a[i]], i)
+		}
+		count := func(i int) int {
+			return len(occurrences[d.a[i]])
+		}
+
+		// The best run found so far, with inclusive ends, and the fewest
+		// occurrences of any line in it
+		found, hasCommon := false, false
+		var bestAs, bestAe, bestBs, bestBe int
+		bestCount := maxChainLength + 1
+
+		for bi := blo; bi < bhi; {
+			next := bi + 1
+			positions := occurrences[d.b[bi]]
+			if len(positions) == 0 {
+				bi = next
+				continue
+			}
+			hasCommon = true
+			if len(positions) > bestCount {
+				bi = next
+				continue
+			}
+
+			for p := 0; p < len(positions); {
+				as, bs := positions[p], bi
+				ae, be := as, bs
+				rc := len(positions)
+				for as > alo && bs > blo && d.a[as-1] == d.b[bs-1] {
+					as--
+					bs--
+					if c := count(as); rc > 1 && c < rc {
+						rc = c
+					}
+				}
+				for ae+1 < ahi && be+1 < bhi && d.a[ae+1] == d.b[be+1] {
+					ae++
+					be++
+					if c := count(ae); rc > 1 && c < rc {
+						rc = c
+					}
+				}
+				if next <= be {
+					next = be + 1
+				}
+				if bestAe-bestAs < ae-as || rc < bestCount {
+					found = true
+					bestAs, bestAe, bestBs, bestBe = as, ae, bs, be
+					bestCount = rc
+				}
+
+				// Continue with the next occurrence past this run
+				for p < len(positions) && positions[p] <= ae {
+					p++
+				}
+			}
+			bi = next
+		}
+
+		if hasCommon && bestCount > maxChainLength {
+			d.myers(alo, ahi, blo, bhi)
+			return
+		}
+		if !found {
+			d.markChanged(alo, ahi, blo, bhi)
+			return
+		}
+
+		d.histogram(alo, bestAs, blo, bestBs)
+		alo, blo = bestAe+1, bestBe+1
+	}
+}
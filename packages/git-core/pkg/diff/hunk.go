@@ -0,0 +1,119 @@
+package diff
+
+import "fmt"
+
+// Hunk is one hunk of a unified diff
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	// Lines are prefixed with ' ', '-' or '+' and keep their line endings
+	Lines []string
+	// Highlights are the changed parts of each line, relative to the text
+	// after its prefix. They are only filled when Options.Highlight is
+	// set, and are nil for lines without intra-line changes.
+	Highlights [][]Span
+}
+
+// Header returns the hunk's @@ line
+func (h *Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+}
+
+// hunkRange formats a hunk range, omitting a count of one like diff does
+func hunkRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// Hunks returns the changes between a and b grouped into unified diff
+// hunks with opts.Context unchanged lines around each change. Changes
+// closer than twice the context share a hunk. With opts.Highlight set,
+// the changes within replaced lines are marked too.
+func Hunks(a, b []string, opts Options) []Hunk {
+	hunks := HunksFromEdits(Lines(a, b, opts), opts.Context)
+	if opts.Highlight != "" {
+		for i := range hunks {
+			hunks[i].highlight(opts.Highlight)
+		}
+	}
+	return hunks
+}
+
+// HunksFromEdits groups an edit script into hunks with the given number
+// of context lines
+func HunksFromEdits(edits []Edit, context int) []Hunk {
+	if context < 0 {
+		context = 0
+	}
+	hunks := []Hunk{}
+
+	i := 0
+	oldLine, newLine := 0, 0
+	for i < len(edits) {
+		// Skip to the next change
+		if edits[i].Op == Equal {
+			i++
+			oldLine++
+			newLine++
+			continue
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		hunk := Hunk{
+			OldStart: oldLine - (i - start) + 1,
+			NewStart: newLine - (i - start) + 1,
+		}
+
+		// Extend the hunk while changes are within 2*context of each other
+		end := i
+		for j := i; j < len(edits); j++ {
+			if edits[j].Op != Equal {
+				end = j
+			} else if j-end > 2*context {
+				break
+			}
+		}
+		stop := end + context + 1
+		if stop > len(edits) {
+			stop = len(edits)
+		}
+
+		for j := start; j < stop; j++ {
+			edit := edits[j]
+			hunk.Lines = append(hunk.Lines, string(edit.Op)+edit.Line)
+			if edit.Op != Insert {
+				hunk.OldLines++
+			}
+			if edit.Op != Delete {
+				hunk.NewLines++
+			}
+		}
+		for j := i; j < stop; j++ {
+			if edits[j].Op != Insert {
+				oldLine++
+			}
+			if edits[j].Op != Delete {
+				newLine++
+			}
+		}
+
+		// An empty side starts at the line before the hunk, as in diff
+		if hunk.OldLines == 0 {
+			hunk.OldStart--
+		}
+		if hunk.NewLines == 0 {
+			hunk.NewStart--
+		}
+		hunks = append(hunks, hunk)
+		i = stop
+	}
+
+	return hunks
+}
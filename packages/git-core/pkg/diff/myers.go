@@ -0,0 +1,376 @@
+package diff
+
+import "math"
+
+// Limits of the Myers search, as in Git's xdiff. Past them the search
+// settles for a good split rather than a minimal one, which keeps large
+// diffs fast.
+const (
+	maxCostMin   = 256
+	heurMinCost  = 256
+	snakeCount   = 20
+	kHeur        = 4
+	maxEqLimit   = 1024
+	simscanWidth = 100
+	kpdisRun     = 4
+)
+
+// myersState is a Myers diff of two ranges, run on the lines worth
+// matching: lines with no counterpart in the other range, and lines in
+// long runs of such lines, are marked changed up front
+type myersState struct {
+	d        *differ
+	ha1, ha2 []int
+	// rindex maps positions in ha1 and ha2 back to line indexes
+	rindex1, rindex2 []int
+	// kvdf and kvdb hold the furthest forward and backward reach on each
+	// diagonal, offset by kOffset
+	kvdf, kvdb []int
+	kOffset    int
+	maxCost    int
+}
+
+// myers marks the changes between a[alo:ahi] and b[blo:bhi] using Myers'
+// linear space algorithm with Git's xdiff heuristics, giving the same
+// result as git diff
+func (d *differ) myers(alo, ahi, blo, bhi int) {
+	countA := make(map[int]int)
+	countB := make(map[int]int)
+	for i := alo; i < ahi; i++ {
+		countA[d.a[i]]++
+	}
+	for i := blo; i < bhi; i++ {
+		countB[d.b[i]]++
+	}
+
+	// Matching lines at either end are unchanged
+	start, lim := 0, ahi-alo
+	if bhi-blo < lim {
+		lim = bhi - blo
+	}
+	for start < lim && d.a[alo+start] == d.b[blo+start] {
+		start++
+	}
+	end := 0
+	for end < lim-start && d.a[ahi-1-end] == d.b[bhi-1-end] {
+		end++
+	}
+
+	s := &myersState{d: d}
+	s.ha1, s.rindex1 = cleanupRecords(d.a, d.changedA, alo+start, ahi-end, ahi-alo, countB)
+	s.ha2, s.rindex2 = cleanupRecords(d.b, d.changedB, blo+start, bhi-end, bhi-blo, countA)
+
+	diagonals := len(s.ha1) + len(s.ha2) + 3
+	s.kvdf = make([]int, diagonals+1)
+	s.kvdb = make([]int, diagonals+1)
+	s.kOffset = len(s.ha2) + 1
+	s.maxCost = bogoSqrt(diagonals)
+	if s.maxCost < maxCostMin {
+		s.maxCost = maxCostMin
+	}
+
+	s.compare(0, len(s.ha1), 0, len(s.ha2), false)
+}
+
+// cleanupRecords returns the lines of lines[start:end] worth matching and
+// their indexes, marking the others changed. otherCount counts each line
+// in the other range, and total is the size of this range.
+func cleanupRecords(lines []int, changed []bool, start, end, total int, otherCount map[int]int) ([]int, []int) {
+	limit := bogoSqrt(total)
+	if limit > maxEqLimit {
+		limit = maxEqLimit
+	}
+
+	// 0: no match, 1: some matches, 2: many matches
+	dis := make([]byte, end-start)
+	for i := start; i < end; i++ {
+		switch n := otherCount[lines[i]]; {
+		case n == 0:
+			dis[i-start] = 0
+		case n >= limit:
+			dis[i-start] = 2
+		default:
+			dis[i-start] = 1
+		}
+	}
+
+	var ha, rindex []int
+	for i := start; i < end; i++ {
+		k := i - start
+		if dis[k] == 1 || dis[k] == 2 && !cleanMultiMatch(dis, k) {
+			ha = append(ha, lines[i])
+			rindex = append(rindex, i)
+		} else {
+			changed[i] = true
+		}
+	}
+	return ha, rindex
+}
+
+// cleanMultiMatch reports whether a line with many matches should be
+// discarded because it sits within a run of lines that have none
+func cleanMultiMatch(dis []byte, i int) bool {
+	s, e := 0, len(dis)-1
+	if i-s > simscanWidth {
+		s = i - simscanWidth
+	}
+	if e-i > simscanWidth {
+		e = i + simscanWidth
+	}
+
+	noMatchBefore, multiBefore := 0, 1
+	for r := 1; i-r >= s; r++ {
+		if dis[i-r] == 0 {
+			noMatchBefore++
+		} else if dis[i-r] == 2 {
+			multiBefore++
+		} else {
+			break
+		}
+	}
+	if noMatchBefore == 0 {
+		return false
+	}
+
+	noMatchAfter, multiAfter := 0, 1
+	for r := 1; i+r <= e; r++ {
+		if dis[i+r] == 0 {
+			noMatchAfter++
+		} else if dis[i+r] == 2 {
+			multiAfter++
+		} else {
+			break
+		}
+	}
+	if noMatchAfter == 0 {
+		return false
+	}
+
+	noMatch := noMatchBefore + noMatchAfter
+	multi := multiBefore + multiAfter
+	return multi*kpdisRun < multi+noMatch
+}
+
+// bogoSqrt returns a power of two close to the square root of n
+func bogoSqrt(n int) int {
+	i := 1
+	for ; n > 0; n >>= 2 {
+		i <<= 1
+	}
+	return i
+}
+
+// compare marks the changes between ha1[off1:lim1] and ha2[off2:lim2] by
+// splitting them on a middle snake
+func (s *myersState) compare(off1, lim1, off2, lim2 int, needMin bool) {
+	for off1 < lim1 && off2 < lim2 && s.ha1[off1] == s.ha2[off2] {
+		off1++
+		off2++
+	}
+	for off1 < lim1 && off2 < lim2 && s.ha1[lim1-1] == s.ha2[lim2-1] {
+		lim1--
+		lim2--
+	}
+
+	switch {
+	case off1 == lim1:
+		for ; off2 < lim2; off2++ {
+			s.d.changedB[s.rindex2[off2]] = true
+		}
+	case off2 == lim2:
+		for ; off1 < lim1; off1++ {
+			s.d.changedA[s.rindex1[off1]] = true
+		}
+	default:
+		i1, i2, minLo, minHi := s.split(off1, lim1, off2, lim2, needMin)
+		s.compare(off1, i1, off2, i2, minLo)
+		s.compare(i1, lim1, i2, lim2, minHi)
+	}
+}
+
+// split finds where to divide the ranges: the middle of a shortest edit
+// path, or a good enough point once the search gets expensive. It also
+// reports whether each half must be diffed minimally.
+func (s *myersState) split(off1, lim1, off2, lim2 int, needMin bool) (int, int, bool, bool) {
+	ha1, ha2 := s.ha1, s.ha2
+	kvdf := func(k int) *int { return &s.kvdf[k+s.kOffset] }
+	kvdb := func(k int) *int { return &s.kvdb[k+s.kOffset] }
+
+	dmin, dmax := off1-lim2, lim1-off2
+	fmid, bmid := off1-off2, lim1-lim2
+	odd := (fmid-bmid)&1 != 0
+	fmin, fmax := fmid, fmid
+	bmin, bmax := bmid, bmid
+
+	*kvdf(fmid) = off1
+	*kvdb(bmid) = lim1
+
+	for ec := 1; ; ec++ {
+		gotSnake := false
+
+		// Widen the forward diagonals by one, guarding the new edges
+		if fmin > dmin {
+			fmin--
+			*kvdf(fmin - 1) = -1
+		} else {
+			fmin++
+		}
+		if fmax < dmax {
+			fmax++
+			*kvdf(fmax + 1) = -1
+		} else {
+			fmax--
+		}
+
+		for d := fmax; d >= fmin; d -= 2 {
+			var i1 int
+			if *kvdf(d - 1) >= *kvdf(d + 1) {
+				i1 = *kvdf(d - 1) + 1
+			} else {
+				i1 = *kvdf(d + 1)
+			}
+			prev1 := i1
+			i2 := i1 - d
+			for i1 < lim1 && i2 < lim2 && ha1[i1] == ha2[i2] {
+				i1++
+				i2++
+			}
+			if i1-prev1 > snakeCount {
+				gotSnake = true
+			}
+			*kvdf(d) = i1
+			if odd && bmin <= d && d <= bmax && *kvdb(d) <= i1 {
+				return i1, i2, true, true
+			}
+		}
+
+		// Widen the backward diagonals by one
+		if bmin > dmin {
+			bmin--
+			*kvdb(bmin - 1) = math.MaxInt
+		} else {
+			bmin++
+		}
+		if bmax < dmax {
+			bmax++
+			*kvdb(bmax + 1) = math.MaxInt
+		} else {
+			bmax--
+		}
+
+		for d := bmax; d >= bmin; d -= 2 {
+			var i1 int
+			if *kvdb(d - 1) < *kvdb(d + 1) {
+				i1 = *kvdb(d - 1)
+			} else {
+				i1 = *kvdb(d + 1) - 1
+			}
+			prev1 := i1
+			i2 := i1 - d
+			for i1 > off1 && i2 > off2 && ha1[i1-1] == ha2[i2-1] {
+				i1--
+				i2--
+			}
+			if prev1-i1 > snakeCount {
+				gotSnake = true
+			}
+			*kvdb(d) = i1
+			if !odd && fmin <= d && d <= fmax && i1 <= *kvdf(d) {
+				return i1, i2, true, true
+			}
+		}
+
+		if needMin {
+			continue
+		}
+
+		// Past the heuristic threshold, split at a long snake that has
+		// made good progress towards a corner
+		if gotSnake && ec > heurMinCost {
+			best, bestI1, bestI2 := 0, 0, 0
+			for d := fmax; d >= fmin; d -= 2 {
+				dd := d - fmid
+				if dd < 0 {
+					dd = -dd
+				}
+				i1 := *kvdf(d)
+				i2 := i1 - d
+				v := (i1 - off1) + (i2 - off2) - dd
+				if v > kHeur*ec && v > best &&
+					off1+snakeCount <= i1 && i1 < lim1 &&
+					off2+snakeCount <= i2 && i2 < lim2 {
+					for k := 1; ha1[i1-k] == ha2[i2-k]; k++ {
+						if k == snakeCount {
+							best, bestI1, bestI2 = v, i1, i2
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return bestI1, bestI2, true, false
+			}
+
+			for d := bmax; d >= bmin; d -= 2 {
+				dd := d - bmid
+				if dd < 0 {
+					dd = -dd
+				}
+				i1 := *kvdb(d)
+				i2 := i1 - d
+				v := (lim1 - i1) + (lim2 - i2) - dd
+				if v > kHeur*ec && v > best &&
+					off1 < i1 && i1 <= lim1-snakeCount &&
+					off2 < i2 && i2 <= lim2-snakeCount {
+					for k := 0; ha1[i1+k] == ha2[i2+k]; k++ {
+						if k == snakeCount-1 {
+							best, bestI1, bestI2 = v, i1, i2
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return bestI1, bestI2, false, true
+			}
+		}
+
+		// Enough: split at the furthest point either search reached
+		if ec >= s.maxCost {
+			fbest, fbest1 := -1, -1
+			for d := fmax; d >= fmin; d -= 2 {
+				i1 := *kvdf(d)
+				if i1 > lim1 {
+					i1 = lim1
+				}
+				i2 := i1 - d
+				if lim2 < i2 {
+					i1, i2 = lim2+d, lim2
+				}
+				if fbest < i1+i2 {
+					fbest, fbest1 = i1+i2, i1
+				}
+			}
+
+			bbest, bbest1 := math.MaxInt, math.MaxInt
+			for d := bmax; d >= bmin; d -= 2 {
+				i1 := *kvdb(d)
+				if i1 < off1 {
+					i1 = off1
+				}
+				i2 := i1 - d
+				if i2 < off2 {
+					i1, i2 = off2+d, off2
+				}
+				if i1+i2 < bbest {
+					bbest, bbest1 = i1+i2, i1
+				}
+			}
+
+			if (lim1+lim2)-bbest < fbest-(off1+off2) {
+				return fbest1, fbest - fbest1, true, false
+			}
+			return bbest1, bbest - bbest1, false, true
+		}
+	}
+}
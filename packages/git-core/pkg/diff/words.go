@@ -0,0 +1,158 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Unit is what intra-line diffs compare
+type Unit string
+
+const (
+	// Word compares runs of letters, digits and underscores, runs of
+	// whitespace and single punctuation characters
+	Word Unit = "word"
+	// Char compares single characters
+	Char Unit = "char"
+)
+
+// ParseUnit parses an intra-line diff unit. An empty string is no unit.
+func ParseUnit(s string) (Unit, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return "", nil
+	case "word", "words":
+		return Word, nil
+	case "char", "chars", "character":
+		return Char, nil
+	default:
+		return "", fmt.Errorf("unknown intra-line diff unit: %s", s)
+	}
+}
+
+// Segment is a run of text that was kept, deleted or inserted
+type Segment struct {
+	Op   Op
+	Text string
+}
+
+// Span is a range of bytes in a line, from Start up to End
+type Span struct {
+	Start int
+	End   int
+}
+
+// Intraline returns the segments turning a into b, compared by unit. The
+// Equal and Delete segments make up a, the Equal and Insert ones make up b.
+func Intraline(a, b string, unit Unit) []Segment {
+	edits := Lines(tokenize(a, unit), tokenize(b, unit), Options{Algorithm: Myers})
+
+	segments := []Segment{}
+	for _, edit := range edits {
+		if n := len(segments); n > 0 && segments[n-1].Op == edit.Op {
+			segments[n-1].Text += edit.Line
+			continue
+		}
+		segments = append(segments, Segment{Op: edit.Op, Text: edit.Line})
+	}
+	return segments
+}
+
+// tokenize splits s into the units Intraline compares
+func tokenize(s string, unit Unit) []string {
+	tokens := []string{}
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		if unit != Char {
+			var in func(rune) bool
+			switch {
+			case isWordRune(r):
+				in = isWordRune
+			case unicode.IsSpace(r):
+				in = unicode.IsSpace
+			}
+			for in != nil && size < len(s) {
+				next, n := utf8.DecodeRuneInString(s[size:])
+				if !in(next) {
+					break
+				}
+				size += n
+			}
+		}
+		tokens = append(tokens, s[:size])
+		s = s[size:]
+	}
+	return tokens
+}
+
+// isWordRune reports whether r is part of a word
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// highlight fills h.Highlights the way diff-highlight marks changes: each
+// run of deleted lines followed by as many inserted lines is paired line
+// by line, and the parts of a pair that differ are marked, unless the
+// pair has nothing but whitespace in common
+func (h *Hunk) highlight(unit Unit) {
+	h.Highlights = make([][]Span, len(h.Lines))
+	for i := 0; i < len(h.Lines); {
+		dels := i
+		for dels < len(h.Lines) && h.Lines[dels][0] == '-' {
+			dels++
+		}
+		ins := dels
+		for ins < len(h.Lines) && h.Lines[ins][0] == '+' {
+			ins++
+		}
+		if dels == i {
+			i++
+			continue
+		}
+		if dels-i == ins-dels {
+			for j := 0; j < dels-i; j++ {
+				h.Highlights[i+j], h.Highlights[dels+j] = highlightPair(h.Lines[i+j], h.Lines[dels+j], unit)
+			}
+		}
+		i = ins
+	}
+}
+
+// highlightPair returns the changed spans of a deleted and an inserted
+// hunk line, relative to the text after their prefix
+func highlightPair(oldLine, newLine string, unit Unit) ([]Span, []Span) {
+	trim := func(line string) string {
+		return strings.TrimSuffix(strings.TrimSuffix(line[1:], "\n"), "\r")
+	}
+	segments := Intraline(trim(oldLine), trim(newLine), unit)
+
+	shared := false
+	for _, segment := range segments {
+		if segment.Op == Equal && strings.TrimSpace(segment.Text) != "" {
+			shared = true
+		}
+	}
+	if !shared {
+		return nil, nil
+	}
+
+	var oldSpans, newSpans []Span
+	oldPos, newPos := 0, 0
+	for _, segment := range segments {
+		n := len(segment.Text)
+		switch segment.Op {
+		case Delete:
+			oldSpans = append(oldSpans, Span{Start: oldPos, End: oldPos + n})
+			oldPos += n
+		case Insert:
+			newSpans = append(newSpans, Span{Start: newPos, End: newPos + n})
+			newPos += n
+		default:
+			oldPos += n
+			newPos += n
+		}
+	}
+	return oldSpans, newSpans
+}
@@ -0,0 +1,153 @@
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// marked renders segments as [-deleted-]{+inserted+}, like git diff
+// --word-diff=plain
+func marked(segments []Segment) string {
+	var b strings.Builder
+	for _, segment := range segments {
+		switch segment.Op {
+		case Delete:
+			b.WriteString("[-" + segment.Text + "-]")
+		case Insert:
+			b.WriteString("{+" + segment.Text + "+}")
+		default:
+			b.WriteString(segment.Text)
+		}
+	}
+	return b.String()
+}
+
+func TestIntraline(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		unit Unit
+		want string
+	}{
+		{
+			name: "changed word",
+			a:    "return foo(bar, baz)",
+			b:    "return foo(bar, qux)",
+			unit: Word,
+			want: "return foo(bar, [-baz-]{+qux+})",
+		},
+		{
+			name: "added argument",
+			a:    "call(a)",
+			b:    "call(a, b)",
+			unit: Word,
+			want: "call(a{+, b+})",
+		},
+		{
+			name: "words are not split",
+			a:    "colour = 1",
+			b:    "color = 1",
+			unit: Word,
+			want: "[-colour-]{+color+} = 1",
+		},
+		{
+			name: "characters",
+			a:    "colour = 1",
+			b:    "color = 1",
+			unit: Char,
+			want: "colo[-u-]r = 1",
+		},
+		{
+			name: "multibyte characters stay whole",
+			a:    "naïve",
+			b:    "naive",
+			unit: Char,
+			want: "na[-ï-]{+i+}ve",
+		},
+		{
+			name: "identical",
+			a:    "same",
+			b:    "same",
+			unit: Word,
+			want: "same",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segments := Intraline(tt.a, tt.b, tt.unit)
+			if got := marked(segments); got != tt.want {
+				t.Errorf("Intraline = %q, want %q", got, tt.want)
+			}
+
+			// The segments rebuild both texts
+			var a, b strings.Builder
+			for _, segment := range segments {
+				if segment.Op != Insert {
+					a.WriteString(segment.Text)
+				}
+				if segment.Op != Delete {
+					b.WriteString(segment.Text)
+				}
+			}
+			if a.String() != tt.a || b.String() != tt.b {
+				t.Errorf("Segments rebuild %q and %q", a.String(), b.String())
+			}
+		})
+	}
+}
+
+func TestHunksHighlight(t *testing.T) {
+	old := "keep\nx := compute(a)\ny := 1\nold line\n"
+	new := "keep\nx := compute(b)\ny := 2\nsomething else\nadded\n"
+	opts := DefaultOptions()
+	opts.Highlight = Word
+	hunks := Hunks(SplitLines([]byte(old)), SplitLines([]byte(new)), opts)
+	if len(hunks) != 1 {
+		t.Fatalf("Expected one hunk, got %d", len(hunks))
+	}
+
+	// The three deleted lines are followed by four inserted ones, so they
+	// are not paired
+	if hunks[0].Highlights == nil || len(hunks[0].Highlights) != len(hunks[0].Lines) {
+		t.Fatalf("Expected a highlight entry per line, got %v", hunks[0].Highlights)
+	}
+	for i, spans := range hunks[0].Highlights {
+		if spans != nil {
+			t.Errorf("Unexpected highlights on %q: %v", hunks[0].Lines[i], spans)
+		}
+	}
+
+	new = "keep\nx := compute(b)\ny := 2\nsomething else\n"
+	hunks = Hunks(SplitLines([]byte(old)), SplitLines([]byte(new)), opts)
+	expected := [][]Span{
+		nil,
+		{{Start: 13, End: 14}},
+		{{Start: 5, End: 6}},
+		nil,
+		{{Start: 13, End: 14}},
+		{{Start: 5, End: 6}},
+		nil,
+	}
+	// The replaced last line has nothing but a space in common
+	if !reflect.DeepEqual(hunks[0].Highlights, expected) {
+		t.Errorf("Highlights = %v, want %v for %q", hunks[0].Highlights, expected, hunks[0].Lines)
+	}
+
+	// Without a unit nothing is marked
+	if hunks := Hunks(SplitLines([]byte(old)), SplitLines([]byte(new)), DefaultOptions()); hunks[0].Highlights != nil {
+		t.Errorf("Expected no highlights, got %v", hunks[0].Highlights)
+	}
+}
+
+func TestParseUnit(t *testing.T) {
+	for input, want := range map[string]Unit{"": "", "word": Word, "Chars": Char} {
+		if got, err := ParseUnit(input); err != nil || got != want {
+			t.Errorf("ParseUnit(%q) = %q, %v", input, got, err)
+		}
+	}
+	if _, err := ParseUnit("line"); err == nil {
+		t.Error("Expected an error for an unknown unit")
+	}
+}
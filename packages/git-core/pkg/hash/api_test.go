@@ -0,0 +1,18 @@
+package hash
+
+// The frozen API listed in the package documentation. These assignments
+// stop compiling if one of the signatures changes.
+var (
+	_ Algorithm = SHA1
+	_ Algorithm = SHA256
+
+	_ func(Algorithm) (Hasher, error)   = NewHasher
+	_ func(string) (Hash, error)        = ParseHash
+	_ func(Hasher, string, []byte) Hash = HashObject
+	_ func(Hasher, []byte) Hash         = HashBlob
+
+	_ func(Hash) string     = Hash.String
+	_ func(Hash) []byte     = Hash.Bytes
+	_ func(Hash, Hash) bool = Hash.Equals
+	_ func(Hash) bool       = Hash.IsZero
+)
@@ -0,0 +1,21 @@
+// Package hash implements the SHA-1 and SHA-256 object hashing used by Git.
+//
+// A [Hasher] computes raw digests for one algorithm. [HashObject] and its
+// per-type helpers prepend the Git object header, so
+//
+//	hasher, _ := hash.NewHasher(hash.SHA1)
+//	id := hash.HashBlob(hasher, []byte("hello\n"))
+//
+// gives the same id as git hash-object. [IncrementalHasher] hashes content
+// supplied in chunks.
+//
+// # Stability
+//
+// The following are frozen: they keep their names and signatures for all
+// v0.x and v1 releases. Everything else may change in a minor release.
+//
+//   - [Hash] and its String, Bytes, Equals and IsZero methods
+//   - [Algorithm], [SHA1] and [SHA256]
+//   - the [Hasher] interface
+//   - [NewHasher], [ParseHash], [HashObject] and [HashBlob]
+package hash
@@ -0,0 +1,37 @@
+package hash_test
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// Hash file content the way git hash-object does
+func ExampleHashBlob() {
+	hasher, err := hash.NewHasher(hash.SHA1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(hash.HashBlob(hasher, []byte("hello\n")))
+	// Output: ce013625030ba8dba906f756967f9e9ca394464a
+}
+
+// Hash content supplied in chunks
+func ExampleNewObjectHasher() {
+	chunks := [][]byte{[]byte("hel"), []byte("lo\n")}
+
+	h, err := hash.NewObjectHasher(hash.NewSHA1(), "blob", 6)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, chunk := range chunks {
+		h.Write(chunk)
+	}
+	sum, err := h.Sum()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(sum)
+	// Output: ce013625030ba8dba906f756967f9e9ca394464a
+}
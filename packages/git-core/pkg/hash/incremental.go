@@ -0,0 +1,72 @@
+package hash
+
+import (
+	"fmt"
+	"hash"
+)
+
+// IncrementalHasher computes a hash over data supplied in chunks.
+// In object mode the Git object header is written up front, so the
+// content size must be known in advance and is checked by Sum.
+type IncrementalHasher struct {
+	h        hash.Hash
+	size     int64
+	written  int64
+	object   bool
+	finished bool
+}
+
+// NewIncrementalHasher creates a hasher for raw data
+func NewIncrementalHasher(hasher Hasher) *IncrementalHasher {
+	return &IncrementalHasher{
+		h: hasher.New(),
+	}
+}
+
+// NewObjectHasher creates a hasher for a Git object of the given type and size.
+// The result matches HashObject over the complete content.
+func NewObjectHasher(hasher Hasher, objectType string, size int64) (*IncrementalHasher, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("invalid object size: %d", size)
+	}
+
+	ih := &IncrementalHasher{
+		h:      hasher.New(),
+		size:   size,
+		object: true,
+	}
+	fmt.Fprintf(ih.h, "%s %d\x00", objectType, size)
+
+	return ih, nil
+}
+
+// Write adds a chunk of data to the hash
+func (ih *IncrementalHasher) Write(p []byte) (int, error) {
+	if ih.finished {
+		return 0, fmt.Errorf("hasher already finalized")
+	}
+	if ih.object && ih.written+int64(len(p)) > ih.size {
+		return 0, fmt.Errorf("content exceeds declared size of %d bytes", ih.size)
+	}
+
+	ih.written += int64(len(p))
+	return ih.h.Write(p)
+}
+
+// Written returns the number of content bytes hashed so far
+func (ih *IncrementalHasher) Written() int64 {
+	return ih.written
+}
+
+// Sum finalizes the hash. The hasher cannot be written to afterwards.
+func (ih *IncrementalHasher) Sum() (Hash, error) {
+	if ih.finished {
+		return nil, fmt.Errorf("hasher already finalized")
+	}
+	if ih.object && ih.written != ih.size {
+		return nil, fmt.Errorf("content size mismatch: declared %d bytes, got %d", ih.size, ih.written)
+	}
+
+	ih.finished = true
+	return Hash(ih.h.Sum(nil)), nil
+}
@@ -0,0 +1,70 @@
+package hash
+
+import (
+	"testing"
+)
+
+// TestIncrementalHasher tests chunked hashing of raw data
+func TestIncrementalHasher(t *testing.T) {
+	for _, hasher := range []Hasher{NewSHA1(), NewSHA256()} {
+		ih := NewIncrementalHasher(hasher)
+		ih.Write([]byte("hello "))
+		ih.Write([]byte("world"))
+
+		h, err := ih.Sum()
+		if err != nil {
+			t.Fatalf("Sum failed: %v", err)
+		}
+		if !h.Equals(hasher.HashString(testString)) {
+			t.Errorf("%s: incremental hash %s does not match %s", hasher.Algorithm(), h, hasher.HashString(testString))
+		}
+
+		if _, err := ih.Write([]byte("more")); err == nil {
+			t.Error("Expected write after Sum to fail")
+		}
+	}
+}
+
+// TestObjectHasher tests chunked hashing with a Git object header
+func TestObjectHasher(t *testing.T) {
+	hasher := NewSHA1()
+	content := []byte(testString)
+
+	ih, err := NewObjectHasher(hasher, "blob", int64(len(content)))
+	if err != nil {
+		t.Fatalf("NewObjectHasher failed: %v", err)
+	}
+	for _, b := range content {
+		if _, err := ih.Write([]byte{b}); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	h, err := ih.Sum()
+	if err != nil {
+		t.Fatalf("Sum failed: %v", err)
+	}
+	if !h.Equals(HashBlob(hasher, content)) {
+		t.Errorf("Object hash %s does not match HashBlob %s", h, HashBlob(hasher, content))
+	}
+}
+
+// TestObjectHasherSizeMismatch tests enforcement of the declared size
+func TestObjectHasherSizeMismatch(t *testing.T) {
+	ih, err := NewObjectHasher(NewSHA1(), "blob", 4)
+	if err != nil {
+		t.Fatalf("NewObjectHasher failed: %v", err)
+	}
+	if _, err := ih.Write([]byte("hello")); err == nil {
+		t.Error("Expected write beyond declared size to fail")
+	}
+
+	ih.Write([]byte("abc"))
+	if _, err := ih.Sum(); err == nil {
+		t.Error("Expected Sum with short content to fail")
+	}
+
+	if _, err := NewObjectHasher(NewSHA1(), "blob", -1); err == nil {
+		t.Error("Expected negative size to fail")
+	}
+}
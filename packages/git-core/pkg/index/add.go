@@ -14,6 +14,8 @@ type AddOptions struct {
 	Force bool
 	// UpdateOnly only updates already tracked files
 	UpdateOnly bool
+	// Sparse restricts additions to the sparse-checkout cone (nil adds everything)
+	Sparse *SparseCheckout
 }
 
 // Add adds files to the index
@@ -51,6 +53,11 @@ func (idx *Index) addPath(workTreePath string, path string, gitignore *Gitignore
 		return nil // Skip ignored files
 	}
 
+	// Refuse explicit paths outside the sparse-checkout cone
+	if opts.Sparse != nil && !opts.Sparse.Includes(path) {
+		return fmt.Errorf("path %s is outside the sparse-checkout definition", path)
+	}
+
 	// Check if update-only mode
 	if opts.UpdateOnly && !idx.HasEntry(path) {
 		return nil // Skip untracked files in update-only mode
@@ -80,11 +87,6 @@ func (idx *Index) addDirectory(workTreePath string, dir string, gitignore *Gitig
 			return filepath.SkipDir
 		}
 
-		// Skip directories themselves
-		if d.IsDir() {
-			return nil
-		}
-
 		// Get relative path
 		relPath, err := filepath.Rel(workTreePath, path)
 		if err != nil {
@@ -94,6 +96,19 @@ func (idx *Index) addDirectory(workTreePath string, dir string, gitignore *Gitig
 		// Convert to forward slashes
 		relPath = filepath.ToSlash(relPath)
 
+		// Skip directories themselves, and whole subtrees outside the sparse cone
+		if d.IsDir() {
+			if opts.Sparse != nil && !opts.Sparse.IncludesDir(relPath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Skip files outside the sparse-checkout cone
+		if opts.Sparse != nil && !opts.Sparse.Includes(relPath) {
+			return nil
+		}
+
 		// Check if file should be ignored
 		if !opts.Force && gitignore.Match(relPath) {
 			return nil
@@ -0,0 +1,26 @@
+package index
+
+import (
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// The frozen API listed in the package documentation. These assignments
+// stop compiling if one of the signatures changes.
+var (
+	_ func() *Index                = NewIndex
+	_ func(string) (*Index, error) = Load
+
+	_ func(*Index, string, []string, AddOptions) error                             = (*Index).Add
+	_ func(*Index, *Entry)                                                         = (*Index).AddEntry
+	_ func(*Index, string) (*Entry, bool)                                          = (*Index).GetEntry
+	_ func(*Index, string) bool                                                    = (*Index).HasEntry
+	_ func(*Index, string) bool                                                    = (*Index).RemoveEntry
+	_ func(*Index, string, object.Database) error                                  = (*Index).WriteBlobs
+	_ func(*Index, hash.Hasher, object.Database) (hash.Hash, error)                = (*Index).BuildTree
+	_ func(*Index, hash.Hasher, object.Database, CommitOptions) (hash.Hash, error) = (*Index).CreateCommit
+	_ func(*Index, string) error                                                   = (*Index).Save
+
+	_ func(string, *Index, *object.Commit, object.Database, StatusOptions) (*Status, error) = GetStatus
+	_ func() StatusOptions                                                                  = DefaultStatusOptions
+)
@@ -1,6 +1,7 @@
 package index
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,16 +9,27 @@ import (
 	"strings"
 	"time"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
-	"github.com/nseba/browser-git/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
 )
 
+// ErrEmptyCommit is returned when a commit would record no changes
+var ErrEmptyCommit = errors.New("nothing to commit")
+
 // CommitOptions contains options for creating a commit
 type CommitOptions struct {
 	Message   string
 	Author    object.Signature
 	Committer object.Signature
 	Parents   []hash.Hash
+
+	// AllowEmpty permits a commit with the same tree as its only parent,
+	// or a root commit of the empty tree, like git commit --allow-empty
+	AllowEmpty bool
+
+	// Signer, when set, signs the commit into its gpgsig header, like
+	// git commit -S
+	Signer object.Signer
 }
 
 // BuildTree builds a tree object from the index entries
@@ -142,6 +154,16 @@ func (idx *Index) CreateCommit(hasher hash.Hasher, objDB object.Database, opts C
 		return nil, fmt.Errorf("failed to build tree: %w", err)
 	}
 
+	if !opts.AllowEmpty {
+		empty, err := isEmptyCommit(hasher, objDB, treeHash, opts.Parents)
+		if err != nil {
+			return nil, err
+		}
+		if empty {
+			return nil, ErrEmptyCommit
+		}
+	}
+
 	// Create commit object
 	commit := object.NewCommit()
 	commit.Tree = treeHash
@@ -155,6 +177,13 @@ func (idx *Index) CreateCommit(hasher hash.Hasher, objDB object.Database, opts C
 		commit.Message += "\n"
 	}
 
+	// Sign the commit before its hash is computed
+	if opts.Signer != nil {
+		if err := commit.Sign(opts.Signer); err != nil {
+			return nil, err
+		}
+	}
+
 	// Compute commit hash
 	if err := commit.ComputeHash(hasher); err != nil {
 		return nil, fmt.Errorf("failed to compute commit hash: %w", err)
@@ -170,6 +199,30 @@ func (idx *Index) CreateCommit(hasher hash.Hasher, objDB object.Database, opts C
 	return commit.Hash(), nil
 }
 
+// isEmptyCommit reports whether a commit of tree on top of parents would
+// record no changes. Merge commits are never empty.
+func isEmptyCommit(hasher hash.Hasher, objDB object.Database, tree hash.Hash, parents []hash.Hash) (bool, error) {
+	switch len(parents) {
+	case 0:
+		return tree.Equals(object.EmptyTreeHash(hasher)), nil
+	case 1:
+		if objDB == nil {
+			return false, nil
+		}
+		obj, err := objDB.Get(parents[0])
+		if err != nil {
+			return false, fmt.Errorf("failed to load parent commit: %w", err)
+		}
+		parent, ok := obj.(*object.Commit)
+		if !ok {
+			return false, fmt.Errorf("parent %s is not a commit", parents[0].String())
+		}
+		return tree.Equals(parent.Tree), nil
+	default:
+		return false, nil
+	}
+}
+
 // WriteBlobs writes all blob objects from the index to the object database
 func (idx *Index) WriteBlobs(workTreePath string, objDB object.Database) error {
 	for _, entry := range idx.Entries {
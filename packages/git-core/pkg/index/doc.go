@@ -0,0 +1,26 @@
+// Package index reads and writes the Git index (the staging area) and
+// builds trees and commits from it.
+//
+// A typical add and commit loads the index, stages paths from the work
+// tree, writes their blobs and records a commit:
+//
+//	idx, err := index.Load(filepath.Join(gitDir, "index"))
+//	err = idx.Add(workTree, []string{"README.md"}, index.AddOptions{})
+//	err = idx.WriteBlobs(workTree, db)
+//	err = idx.Save(filepath.Join(gitDir, "index"))
+//	commit, err := idx.CreateCommit(hasher, db, index.CommitOptions{...})
+//
+// The package also implements .gitignore matching, cone-mode sparse
+// checkout patterns and work tree status.
+//
+// # Stability
+//
+// The following are frozen: they keep their names and signatures for all
+// v0.x and v1 releases. Everything else may change in a minor release.
+//
+//   - [Index], [Entry], [NewIndex] and [Load]
+//   - the Add, AddEntry, GetEntry, HasEntry, RemoveEntry, WriteBlobs,
+//     BuildTree, CreateCommit and Save methods of [Index]
+//   - [AddOptions] and [CommitOptions]
+//   - [GetStatus], [Status], [StatusOptions], [DefaultStatusOptions] and [FileStatus]
+package index
@@ -19,6 +19,22 @@ type pattern struct {
 	dirOnly    bool   // true if pattern ends with /
 	isAbsolute bool   // true if pattern starts with /
 	isRegex    bool   // true if pattern contains special chars
+	text       string // pattern as written in its file
+	source     string // file the pattern came from, empty for built-in patterns
+	line       int    // 1-based line number in source
+}
+
+// IgnoreMatch describes the pattern that decided whether a path is ignored
+type IgnoreMatch struct {
+	// Ignored is false when the deciding pattern is a negation
+	Ignored bool
+	// Pattern is the pattern as written, including any leading !
+	Pattern string
+	// Source is the file the pattern came from, relative to the work tree,
+	// or empty for built-in patterns
+	Source string
+	// Line is the 1-based line number of the pattern in Source
+	Line int
 }
 
 // LoadGitignore loads .gitignore files from the repository
@@ -29,7 +45,7 @@ func LoadGitignore(workTreePath string) (*Gitignore, error) {
 
 	// Load .gitignore from work tree root
 	gitignorePath := filepath.Join(workTreePath, ".gitignore")
-	if err := gi.loadFile(gitignorePath); err != nil && !os.IsNotExist(err) {
+	if err := gi.loadFile(gitignorePath, ".gitignore"); err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
 
@@ -39,8 +55,9 @@ func LoadGitignore(workTreePath string) (*Gitignore, error) {
 	return gi, nil
 }
 
-// loadFile loads patterns from a .gitignore file
-func (gi *Gitignore) loadFile(path string) error {
+// loadFile loads patterns from a .gitignore file, recording source as
+// where each pattern came from
+func (gi *Gitignore) loadFile(path, source string) error {
 	file, err := os.Open(path)
 	if err != nil {
 		return err
@@ -48,7 +65,9 @@ func (gi *Gitignore) loadFile(path string) error {
 	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
+	lineNo := 0
 	for scanner.Scan() {
+		lineNo++
 		line := strings.TrimSpace(scanner.Text())
 
 		// Skip empty lines and comments
@@ -57,6 +76,8 @@ func (gi *Gitignore) loadFile(path string) error {
 		}
 
 		gi.addPattern(line)
+		gi.patterns[len(gi.patterns)-1].source = source
+		gi.patterns[len(gi.patterns)-1].line = lineNo
 	}
 
 	return scanner.Err()
@@ -66,6 +87,7 @@ func (gi *Gitignore) loadFile(path string) error {
 func (gi *Gitignore) addPattern(line string) {
 	p := pattern{
 		pattern: line,
+		text:    line,
 	}
 
 	// Check for negation
@@ -123,6 +145,38 @@ func (gi *Gitignore) Match(path string) bool {
 	return matched
 }
 
+// CheckIgnore reports the pattern that decides whether path is ignored, like
+// git check-ignore -v, or nil when no pattern matches. As in Git, a file
+// inside an ignored directory is ignored by the directory's pattern and
+// can't be re-included.
+func (gi *Gitignore) CheckIgnore(path string) *IgnoreMatch {
+	path = strings.TrimSuffix(filepath.ToSlash(path), "/")
+
+	parts := strings.Split(path, "/")
+	for i := 1; i < len(parts); i++ {
+		if m := gi.lastMatch(strings.Join(parts[:i], "/")); m != nil && m.Ignored {
+			return m
+		}
+	}
+	return gi.lastMatch(path)
+}
+
+// lastMatch returns the last pattern matching path, which takes precedence
+func (gi *Gitignore) lastMatch(path string) *IgnoreMatch {
+	for i := len(gi.patterns) - 1; i >= 0; i-- {
+		p := gi.patterns[i]
+		if gi.matchPattern(path, p) {
+			return &IgnoreMatch{
+				Ignored: !p.negation,
+				Pattern: p.text,
+				Source:  p.source,
+				Line:    p.line,
+			}
+		}
+	}
+	return nil
+}
+
 // matchPattern checks if a path matches a single pattern
 func (gi *Gitignore) matchPattern(path string, p pattern) bool {
 	pattern := p.pattern
@@ -199,6 +253,16 @@ func (gi *Gitignore) matchGlob(path, pattern string) bool {
 	return path == pattern || strings.HasSuffix(path, "/"+pattern) || filepath.Base(path) == pattern
 }
 
+// CheckIgnore loads the work tree's ignore rules and reports the pattern that
+// decides whether path is ignored, or nil when no pattern matches
+func CheckIgnore(workTreePath string, path string) (*IgnoreMatch, error) {
+	gi, err := LoadGitignore(workTreePath)
+	if err != nil {
+		return nil, err
+	}
+	return gi.CheckIgnore(path), nil
+}
+
 // ShouldIgnore checks if a file should be ignored
 func ShouldIgnore(workTreePath string, path string) bool {
 	gi, err := LoadGitignore(workTreePath)
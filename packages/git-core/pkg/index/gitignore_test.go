@@ -306,3 +306,47 @@ func TestGitignoreExactMatch(t *testing.T) {
 		t.Error("expected docs/README.md to match (basename)")
 	}
 }
+
+func TestCheckIgnore(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := `# Logs
+*.log
+!keep.log
+
+build/
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, ".gitignore"), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to create .gitignore: %v", err)
+	}
+
+	tests := []struct {
+		path  string
+		match *IgnoreMatch
+	}{
+		{"debug.log", &IgnoreMatch{Ignored: true, Pattern: "*.log", Source: ".gitignore", Line: 2}},
+		{"keep.log", &IgnoreMatch{Ignored: false, Pattern: "!keep.log", Source: ".gitignore", Line: 3}},
+		{"build", &IgnoreMatch{Ignored: true, Pattern: "build/", Source: ".gitignore", Line: 5}},
+		// A file can't be re-included when its parent directory is ignored
+		{"build/keep.log", &IgnoreMatch{Ignored: true, Pattern: "build/", Source: ".gitignore", Line: 5}},
+		{".git/config", &IgnoreMatch{Ignored: true, Pattern: ".git/"}},
+		{"main.go", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			match, err := CheckIgnore(tmpDir, tt.path)
+			if err != nil {
+				t.Fatalf("CheckIgnore failed: %v", err)
+			}
+			if tt.match == nil {
+				if match != nil {
+					t.Errorf("expected no match, got %+v", match)
+				}
+				return
+			}
+			if match == nil || *match != *tt.match {
+				t.Errorf("expected %+v, got %+v", tt.match, match)
+			}
+		})
+	}
+}
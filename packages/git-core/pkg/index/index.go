@@ -11,7 +11,7 @@ import (
 	"sort"
 	"time"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
 )
 
 // Index represents the Git staging area (index)
@@ -92,10 +92,13 @@ func (idx *Index) HasEntry(path string) bool {
 	return ok
 }
 
-// Sort sorts entries by path (required by Git index format)
+// Sort sorts entries by path, then stage (required by Git index format)
 func (idx *Index) Sort() {
 	sort.Slice(idx.Entries, func(i, j int) bool {
-		return idx.Entries[i].Path < idx.Entries[j].Path
+		if idx.Entries[i].Path != idx.Entries[j].Path {
+			return idx.Entries[i].Path < idx.Entries[j].Path
+		}
+		return idx.Entries[i].StageFlag < idx.Entries[j].StageFlag
 	})
 }
 
@@ -129,19 +132,10 @@ func NewEntryFromFile(path string, workTreePath string) (*Entry, error) {
 	hasher := hash.NewSHA1()
 	blobHash := hash.HashBlob(hasher, content)
 
-	// Determine mode
-	mode := FileModeRegular
-	if info.Mode()&0111 != 0 {
-		mode = FileModeExecutable
-	}
-	if info.Mode()&os.ModeSymlink != 0 {
-		mode = FileModeSymlink
-	}
-
 	entry := &Entry{
 		CTime:     info.ModTime(), // Use ModTime for both for now
 		MTime:     info.ModTime(),
-		Mode:      mode,
+		Mode:      fileInfoMode(info),
 		Size:      uint32(info.Size()),
 		Hash:      blobHash,
 		Path:      filepath.ToSlash(path), // Convert to forward slashes
@@ -151,6 +145,17 @@ func NewEntryFromFile(path string, workTreePath string) (*Entry, error) {
 	return entry, nil
 }
 
+// fileInfoMode returns the index mode for a file's type and permissions
+func fileInfoMode(info os.FileInfo) uint32 {
+	if info.Mode()&os.ModeSymlink != 0 {
+		return FileModeSymlink
+	}
+	if info.Mode()&0111 != 0 {
+		return FileModeExecutable
+	}
+	return FileModeRegular
+}
+
 // IsModified checks if a file has been modified compared to the index entry
 func (e *Entry) IsModified(workTreePath string) (bool, error) {
 	fullPath := filepath.Join(workTreePath, e.Path)
@@ -7,7 +7,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
 )
 
 func TestNewIndex(t *testing.T) {
@@ -1,15 +1,17 @@
-package index
+package index_test
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
-	"github.com/nseba/browser-git/git-core/pkg/object"
-	"github.com/nseba/browser-git/git-core/pkg/repository"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/repository"
 )
 
 // MemoryStorage is a simple in-memory storage for testing
@@ -103,13 +105,13 @@ func TestCompleteAddCommitWorkflow(t *testing.T) {
 
 	// Load index
 	indexPath := filepath.Join(repo.GitDir, "index")
-	idx, err := Load(indexPath)
+	idx, err := index.Load(indexPath)
 	if err != nil {
 		t.Fatalf("failed to load index: %v", err)
 	}
 
 	// Add files to index
-	addOpts := AddOptions{}
+	addOpts := index.AddOptions{}
 	if err := idx.Add(tmpDir, []string{"test1.txt", "test2.txt"}, addOpts); err != nil {
 		t.Fatalf("failed to add files: %v", err)
 	}
@@ -133,10 +135,10 @@ func TestCompleteAddCommitWorkflow(t *testing.T) {
 	}
 
 	// Create commit
-	commitOpts := CommitOptions{
+	commitOpts := index.CommitOptions{
 		Message:   "Initial commit",
-		Author:    DefaultSignature("Test User", "test@example.com"),
-		Committer: DefaultSignature("Test User", "test@example.com"),
+		Author:    index.DefaultSignature("Test User", "test@example.com"),
+		Committer: index.DefaultSignature("Test User", "test@example.com"),
 		Parents:   nil, // Initial commit has no parents
 	}
 
@@ -209,13 +211,13 @@ func TestMultipleCommits(t *testing.T) {
 
 		// Load index
 		indexPath := filepath.Join(repo.GitDir, "index")
-		idx, err := Load(indexPath)
+		idx, err := index.Load(indexPath)
 		if err != nil {
 			t.Fatalf("failed to load index: %v", err)
 		}
 
 		// Add file to index
-		addOpts := AddOptions{}
+		addOpts := index.AddOptions{}
 		if err := idx.Add(tmpDir, []string{fileName}, addOpts); err != nil {
 			t.Fatalf("failed to add file: %v", err)
 		}
@@ -236,10 +238,10 @@ func TestMultipleCommits(t *testing.T) {
 			parents = append(parents, parent)
 		}
 
-		commitOpts := CommitOptions{
+		commitOpts := index.CommitOptions{
 			Message:   message,
-			Author:    DefaultSignature("Test User", "test@example.com"),
-			Committer: DefaultSignature("Test User", "test@example.com"),
+			Author:    index.DefaultSignature("Test User", "test@example.com"),
+			Committer: index.DefaultSignature("Test User", "test@example.com"),
 			Parents:   parents,
 		}
 
@@ -333,13 +335,13 @@ func TestAddCommitWithGitignore(t *testing.T) {
 
 	// Load index
 	indexPath := filepath.Join(repo.GitDir, "index")
-	idx, err := Load(indexPath)
+	idx, err := index.Load(indexPath)
 	if err != nil {
 		t.Fatalf("failed to load index: %v", err)
 	}
 
 	// Add all files
-	addOpts := AddOptions{}
+	addOpts := index.AddOptions{}
 	if err := idx.Add(tmpDir, []string{"."}, addOpts); err != nil {
 		t.Fatalf("failed to add files: %v", err)
 	}
@@ -368,10 +370,10 @@ func TestAddCommitWithGitignore(t *testing.T) {
 	}
 
 	// Create commit
-	commitOpts := CommitOptions{
+	commitOpts := index.CommitOptions{
 		Message:   "Add files with gitignore",
-		Author:    DefaultSignature("Test User", "test@example.com"),
-		Committer: DefaultSignature("Test User", "test@example.com"),
+		Author:    index.DefaultSignature("Test User", "test@example.com"),
+		Committer: index.DefaultSignature("Test User", "test@example.com"),
 		Parents:   nil,
 	}
 
@@ -425,16 +427,16 @@ func TestModifyAndCommit(t *testing.T) {
 	}
 
 	indexPath := filepath.Join(repo.GitDir, "index")
-	idx, _ := Load(indexPath)
+	idx, _ := index.Load(indexPath)
 
-	idx.Add(tmpDir, []string{"test.txt"}, AddOptions{})
+	idx.Add(tmpDir, []string{"test.txt"}, index.AddOptions{})
 	idx.Save(indexPath)
 	idx.WriteBlobs(tmpDir, repo.ObjectDB)
 
-	commit1Opts := CommitOptions{
+	commit1Opts := index.CommitOptions{
 		Message:   "Initial commit",
-		Author:    DefaultSignature("Test User", "test@example.com"),
-		Committer: DefaultSignature("Test User", "test@example.com"),
+		Author:    index.DefaultSignature("Test User", "test@example.com"),
+		Committer: index.DefaultSignature("Test User", "test@example.com"),
 		Parents:   nil,
 	}
 	commit1Hash, _ := idx.CreateCommit(repo.Hasher, repo.ObjectDB, commit1Opts)
@@ -455,15 +457,15 @@ func TestModifyAndCommit(t *testing.T) {
 	}
 
 	// Add modified file
-	idx.Add(tmpDir, []string{"test.txt"}, AddOptions{})
+	idx.Add(tmpDir, []string{"test.txt"}, index.AddOptions{})
 	idx.Save(indexPath)
 	idx.WriteBlobs(tmpDir, repo.ObjectDB)
 
 	// Create second commit
-	commit2Opts := CommitOptions{
+	commit2Opts := index.CommitOptions{
 		Message:   "Modify test.txt",
-		Author:    DefaultSignature("Test User", "test@example.com"),
-		Committer: DefaultSignature("Test User", "test@example.com"),
+		Author:    index.DefaultSignature("Test User", "test@example.com"),
+		Committer: index.DefaultSignature("Test User", "test@example.com"),
 		Parents:   []hash.Hash{commit1Hash},
 	}
 	commit2Hash, _ := idx.CreateCommit(repo.Hasher, repo.ObjectDB, commit2Opts)
@@ -528,9 +530,9 @@ func TestAddCommitWithSubdirectories(t *testing.T) {
 
 	// Load index and add all files
 	indexPath := filepath.Join(repo.GitDir, "index")
-	idx, _ := Load(indexPath)
+	idx, _ := index.Load(indexPath)
 
-	idx.Add(tmpDir, []string{"."}, AddOptions{})
+	idx.Add(tmpDir, []string{"."}, index.AddOptions{})
 
 	// Verify files are in index with correct paths
 	if !idx.HasEntry("root.txt") {
@@ -544,10 +546,10 @@ func TestAddCommitWithSubdirectories(t *testing.T) {
 	idx.WriteBlobs(tmpDir, repo.ObjectDB)
 
 	// Create commit
-	commitOpts := CommitOptions{
+	commitOpts := index.CommitOptions{
 		Message:   "Add nested files",
-		Author:    DefaultSignature("Test User", "test@example.com"),
-		Committer: DefaultSignature("Test User", "test@example.com"),
+		Author:    index.DefaultSignature("Test User", "test@example.com"),
+		Committer: index.DefaultSignature("Test User", "test@example.com"),
 		Parents:   nil,
 	}
 
@@ -583,3 +585,46 @@ func TestAddCommitWithSubdirectories(t *testing.T) {
 		t.Error("expected subdir in root tree")
 	}
 }
+
+// TestCreateCommitAllowEmpty tests that commits without changes need AllowEmpty
+func TestCreateCommitAllowEmpty(t *testing.T) {
+	hasher := hash.NewSHA1()
+	db := object.NewObjectDatabase(NewMemoryStorage(), hasher)
+	idx := index.NewIndex()
+
+	opts := index.CommitOptions{
+		Message:   "Placeholder",
+		Author:    index.DefaultSignature("Test User", "test@example.com"),
+		Committer: index.DefaultSignature("Test User", "test@example.com"),
+	}
+
+	// A root commit of nothing is empty
+	if _, err := idx.CreateCommit(hasher, db, opts); !errors.Is(err, index.ErrEmptyCommit) {
+		t.Fatalf("Expected ErrEmptyCommit, got %v", err)
+	}
+
+	opts.AllowEmpty = true
+	root, err := idx.CreateCommit(hasher, db, opts)
+	if err != nil {
+		t.Fatalf("CreateCommit with AllowEmpty failed: %v", err)
+	}
+	obj, err := db.Get(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree := obj.(*object.Commit).Tree; !tree.Equals(object.EmptyTreeHash(hasher)) {
+		t.Errorf("Expected the empty tree, got %s", tree)
+	}
+
+	// So is a commit with its parent's tree
+	opts.AllowEmpty = false
+	opts.Parents = []hash.Hash{root}
+	if _, err := idx.CreateCommit(hasher, db, opts); !errors.Is(err, index.ErrEmptyCommit) {
+		t.Errorf("Expected ErrEmptyCommit on top of the same tree, got %v", err)
+	}
+
+	opts.AllowEmpty = true
+	if _, err := idx.CreateCommit(hasher, db, opts); err != nil {
+		t.Errorf("CreateCommit with AllowEmpty failed: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package index
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// PorcelainV2 renders the entries as git status --porcelain=v2 records,
+// one per line: changed and renamed files, then unmerged files, then
+// untracked files, each group sorted by path. Branch headers are not
+// included since the index does not know about HEAD.
+func (s *Status) PorcelainV2() string {
+	zero := strings.Repeat("0", 2*hash.NewSHA1().Size())
+	for _, entry := range s.Entries {
+		for _, h := range []hash.Hash{entry.HeadHash, entry.StagedHash} {
+			if h != nil {
+				zero = strings.Repeat("0", 2*len(h))
+			}
+		}
+	}
+	hex := func(h hash.Hash) string {
+		if h == nil {
+			return zero
+		}
+		return h.String()
+	}
+
+	var changed, unmerged, untracked strings.Builder
+	for _, entry := range s.Entries {
+		switch {
+		case entry.IndexStatus == StatusUntracked:
+			fmt.Fprintf(&untracked, "? %s\n", entry.Path)
+
+		case entry.IndexStatus == StatusConflict:
+			base, ours, theirs := entry.Stages[0], entry.Stages[1], entry.Stages[2]
+			fmt.Fprintf(&unmerged, "u %s %s %06o %06o %06o %06o %s %s %s %s\n",
+				unmergedCode(base != nil, ours != nil, theirs != nil),
+				submoduleState(stageMode(base), stageMode(ours), stageMode(theirs), entry.WorkTreeMode),
+				stageMode(base), stageMode(ours), stageMode(theirs), entry.WorkTreeMode,
+				hex(stageHash(base)), hex(stageHash(ours)), hex(stageHash(theirs)), entry.Path)
+
+		default:
+			x, y := porcelainCode(entry.IndexStatus), porcelainCode(entry.WorkStatus)
+			if x == '.' && y == '.' {
+				continue
+			}
+			sub := submoduleState(entry.HeadMode, entry.IndexMode, entry.WorkTreeMode)
+			if entry.IndexStatus == StatusRenamed {
+				fmt.Fprintf(&changed, "2 %c%c %s %06o %06o %06o %s %s R%d %s\t%s\n",
+					x, y, sub, entry.HeadMode, entry.IndexMode, entry.WorkTreeMode,
+					hex(entry.HeadHash), hex(entry.StagedHash), entry.Score, entry.Path, entry.OrigPath)
+				continue
+			}
+			fmt.Fprintf(&changed, "1 %c%c %s %06o %06o %06o %s %s %s\n",
+				x, y, sub, entry.HeadMode, entry.IndexMode, entry.WorkTreeMode,
+				hex(entry.HeadHash), hex(entry.StagedHash), entry.Path)
+		}
+	}
+
+	return changed.String() + unmerged.String() + untracked.String()
+}
+
+// porcelainCode returns the porcelain status letter for one side of an
+// entry, '.' when that side is unchanged
+func porcelainCode(status FileStatus) byte {
+	switch status {
+	case StatusModified, StatusStaged:
+		return 'M'
+	case StatusAdded:
+		return 'A'
+	case StatusDeleted:
+		return 'D'
+	case StatusRenamed:
+		return 'R'
+	default:
+		return '.'
+	}
+}
+
+// unmergedCode returns the two-letter code for an unmerged file from the
+// conflict stages it has
+func unmergedCode(base, ours, theirs bool) string {
+	switch {
+	case base && !ours && !theirs:
+		return "DD"
+	case !base && ours && !theirs:
+		return "AU"
+	case base && ours && !theirs:
+		return "UD"
+	case !base && !ours && theirs:
+		return "UA"
+	case base && !ours && theirs:
+		return "DU"
+	case !base && ours && theirs:
+		return "AA"
+	default:
+		return "UU"
+	}
+}
+
+// submoduleState returns the porcelain submodule field. Submodule work
+// trees are not inspected, so their commit and change flags are '.'.
+func submoduleState(modes ...uint32) string {
+	for _, mode := range modes {
+		if mode == FileModeGitlink {
+			return "S..."
+		}
+	}
+	return "N..."
+}
+
+// stageMode returns the mode of a conflict stage, or 0 if it is absent
+func stageMode(stage *Entry) uint32 {
+	if stage == nil {
+		return 0
+	}
+	return stage.Mode
+}
+
+// stageHash returns the hash of a conflict stage, or nil if it is absent
+func stageHash(stage *Entry) hash.Hash {
+	if stage == nil {
+		return nil
+	}
+	return stage.Hash
+}
@@ -0,0 +1,67 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+func TestPorcelainV2(t *testing.T) {
+	hasher := hash.NewSHA1()
+	blob := func(content string) hash.Hash {
+		return hash.HashBlob(hasher, []byte(content))
+	}
+	zero := "0000000000000000000000000000000000000000"
+
+	status := &Status{
+		Entries: []*FileStatusEntry{
+			{Path: "a.txt", IndexStatus: StatusStaged, WorkStatus: StatusModified, HeadHash: blob("a"), HeadMode: FileModeRegular, StagedHash: blob("b"), IndexMode: FileModeRegular, WorkTreeMode: FileModeRegular},
+			{Path: "clean.txt", IndexStatus: StatusUnmodified, WorkStatus: StatusUnmodified, HeadHash: blob("c"), StagedHash: blob("c")},
+			{Path: "gone.txt", IndexStatus: StatusDeleted, WorkStatus: StatusUnmodified, HeadHash: blob("g"), HeadMode: FileModeRegular},
+			{Path: "lib", IndexStatus: StatusStaged, WorkStatus: StatusUnmodified, HeadHash: blob("1"), HeadMode: FileModeGitlink, StagedHash: blob("2"), IndexMode: FileModeGitlink, WorkTreeMode: FileModeGitlink},
+			{Path: "new name.txt", IndexStatus: StatusRenamed, WorkStatus: StatusUnmodified, HeadHash: blob("r"), HeadMode: FileModeRegular, StagedHash: blob("r"), IndexMode: FileModeRegular, WorkTreeMode: FileModeRegular, OrigPath: "old.txt", Score: 100},
+			{Path: "u.txt", IndexStatus: StatusConflict, WorkStatus: StatusConflict, WorkTreeMode: FileModeRegular, Stages: [3]*Entry{
+				nil,
+				{Mode: FileModeRegular, Hash: blob("ours")},
+				{Mode: FileModeExecutable, Hash: blob("theirs")},
+			}},
+			{Path: "x.txt", IndexStatus: StatusUntracked, WorkStatus: StatusUntracked},
+		},
+	}
+
+	want := "1 MM N... 100644 100644 100644 " + blob("a").String() + " " + blob("b").String() + " a.txt\n" +
+		"1 D. N... 100644 000000 000000 " + blob("g").String() + " " + zero + " gone.txt\n" +
+		"1 M. S... 160000 160000 160000 " + blob("1").String() + " " + blob("2").String() + " lib\n" +
+		"2 R. N... 100644 100644 100644 " + blob("r").String() + " " + blob("r").String() + " R100 new name.txt\told.txt\n" +
+		"u AA N... 000000 100644 100755 100644 " + zero + " " + blob("ours").String() + " " + blob("theirs").String() + " u.txt\n" +
+		"? x.txt\n"
+	if got := status.PorcelainV2(); got != want {
+		t.Errorf("unexpected porcelain output:\n%s\nexpected:\n%s", got, want)
+	}
+}
+
+func TestPairRenames(t *testing.T) {
+	same := hash.HashBlob(hash.NewSHA1(), []byte("same"))
+	other := hash.HashBlob(hash.NewSHA1(), []byte("other"))
+
+	entries := pairRenames([]*FileStatusEntry{
+		{Path: "a.txt", IndexStatus: StatusAdded, StagedHash: same},
+		{Path: "b.txt", IndexStatus: StatusAdded, StagedHash: same},
+		{Path: "c.txt", IndexStatus: StatusAdded, StagedHash: other},
+		{Path: "old.txt", IndexStatus: StatusDeleted, HeadHash: same, HeadMode: FileModeRegular},
+		{Path: "removed.txt", IndexStatus: StatusDeleted, HeadHash: hash.HashBlob(hash.NewSHA1(), []byte("gone"))},
+	})
+
+	if len(entries) != 4 {
+		t.Fatalf("expected the renamed deletion to be dropped, got %d entries", len(entries))
+	}
+	if a := entries[0]; a.IndexStatus != StatusRenamed || a.OrigPath != "old.txt" || a.Score != 100 || a.HeadMode != FileModeRegular {
+		t.Errorf("expected a.txt to be renamed from old.txt, got %+v", a)
+	}
+	if entries[1].IndexStatus != StatusAdded || entries[2].IndexStatus != StatusAdded {
+		t.Error("expected only one addition to pair with the deletion")
+	}
+	if entries[3].Path != "removed.txt" || entries[3].IndexStatus != StatusDeleted {
+		t.Errorf("expected removed.txt to stay deleted, got %+v", entries[3])
+	}
+}
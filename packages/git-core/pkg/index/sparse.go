@@ -0,0 +1,194 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// SparseCheckout holds cone-mode sparse-checkout patterns.
+// Files at the repository root are always included, files inside a
+// listed directory are included recursively, and files directly inside
+// a parent of a listed directory are included too.
+type SparseCheckout struct {
+	recursive map[string]bool // directories included with all descendants
+	parents   map[string]bool // ancestors of recursive directories
+}
+
+// NewSparseCheckout creates cone-mode patterns for the given directories
+func NewSparseCheckout(dirs []string) *SparseCheckout {
+	sc := &SparseCheckout{
+		recursive: make(map[string]bool),
+		parents:   make(map[string]bool),
+	}
+
+	for _, dir := range dirs {
+		dir = strings.Trim(path.Clean("/"+strings.ReplaceAll(dir, "\\", "/")), "/")
+		if dir == "" {
+			continue
+		}
+		sc.recursive[dir] = true
+	}
+
+	// Drop directories already covered by a recursive ancestor
+	for dir := range sc.recursive {
+		for parent := path.Dir(dir); parent != "."; parent = path.Dir(parent) {
+			if sc.recursive[parent] {
+				delete(sc.recursive, dir)
+				break
+			}
+		}
+	}
+
+	for dir := range sc.recursive {
+		for parent := path.Dir(dir); parent != "."; parent = path.Dir(parent) {
+			sc.parents[parent] = true
+		}
+	}
+
+	return sc
+}
+
+// ParseSparseCheckout parses the contents of an info/sparse-checkout file.
+// Only cone-mode patterns (as written by Serialize) are accepted.
+func ParseSparseCheckout(data []byte) (*SparseCheckout, error) {
+	var dirs []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip empty lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		switch {
+		case line == "/*" || line == "!/*/":
+			// Root files are always included
+		case strings.HasPrefix(line, "!/") && strings.HasSuffix(line, "/*/"):
+			// Parent directory exclusion, implied by the recursive entries
+		case strings.HasPrefix(line, "/") && strings.HasSuffix(line, "/") && !strings.ContainsAny(line, "*?[!"):
+			dirs = append(dirs, strings.Trim(line, "/"))
+		default:
+			return nil, fmt.Errorf("pattern %q is not a cone-mode pattern", line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Parent directories appear as "/dir/" followed by "!/dir/*/";
+	// NewSparseCheckout folds them back into their recursive children
+	return NewSparseCheckout(filterParentDirs(dirs)), nil
+}
+
+// LoadSparseCheckout loads sparse-checkout patterns from a file
+func LoadSparseCheckout(filePath string) (*SparseCheckout, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSparseCheckout(data)
+}
+
+// filterParentDirs removes directories that are proper ancestors of another entry
+func filterParentDirs(dirs []string) []string {
+	result := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		isParent := false
+		for _, other := range dirs {
+			if strings.HasPrefix(other, dir+"/") {
+				isParent = true
+				break
+			}
+		}
+		if !isParent {
+			result = append(result, dir)
+		}
+	}
+	return result
+}
+
+// Includes reports whether a file path is inside the sparse-checkout cone
+func (sc *SparseCheckout) Includes(filePath string) bool {
+	filePath = strings.Trim(strings.ReplaceAll(filePath, "\\", "/"), "/")
+
+	dir := path.Dir(filePath)
+	if dir == "." {
+		return true
+	}
+
+	// Files directly inside a parent directory are included
+	if sc.parents[dir] {
+		return true
+	}
+
+	for ; dir != "."; dir = path.Dir(dir) {
+		if sc.recursive[dir] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IncludesDir reports whether any file below a directory can be included,
+// so callers walking the worktree can skip whole subtrees
+func (sc *SparseCheckout) IncludesDir(dirPath string) bool {
+	dirPath = strings.Trim(strings.ReplaceAll(dirPath, "\\", "/"), "/")
+	if dirPath == "" || dirPath == "." {
+		return true
+	}
+	if sc.parents[dirPath] {
+		return true
+	}
+
+	for dir := dirPath; dir != "."; dir = path.Dir(dir) {
+		if sc.recursive[dir] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Directories returns the recursively included directories, sorted
+func (sc *SparseCheckout) Directories() []string {
+	dirs := make([]string, 0, len(sc.recursive))
+	for dir := range sc.recursive {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// Serialize writes the patterns in Git's cone-mode format
+func (sc *SparseCheckout) Serialize() []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("/*\n")
+	buf.WriteString("!/*/\n")
+
+	parents := make([]string, 0, len(sc.parents))
+	for dir := range sc.parents {
+		parents = append(parents, dir)
+	}
+	sort.Strings(parents)
+
+	for _, dir := range parents {
+		fmt.Fprintf(&buf, "/%s/\n", dir)
+		fmt.Fprintf(&buf, "!/%s/*/\n", dir)
+	}
+
+	for _, dir := range sc.Directories() {
+		fmt.Fprintf(&buf, "/%s/\n", dir)
+	}
+
+	return buf.Bytes()
+}
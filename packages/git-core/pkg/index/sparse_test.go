@@ -0,0 +1,104 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSparseCheckoutIncludes(t *testing.T) {
+	sc := NewSparseCheckout([]string{"packages/app", "docs/"})
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"README.md", true},
+		{"packages/package.json", true},
+		{"packages/app/main.go", true},
+		{"packages/app/src/deep/file.go", true},
+		{"packages/lib/lib.go", false},
+		{"docs/guide/intro.md", true},
+		{"vendor/mod/file.go", false},
+	}
+
+	for _, tt := range tests {
+		if got := sc.Includes(tt.path); got != tt.want {
+			t.Errorf("Includes(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	if !sc.IncludesDir("packages") {
+		t.Error("expected parent directory to be included")
+	}
+	if sc.IncludesDir("packages/lib") {
+		t.Error("expected sibling directory to be excluded")
+	}
+}
+
+func TestSparseCheckoutNested(t *testing.T) {
+	sc := NewSparseCheckout([]string{"a", "a/b/c"})
+
+	if dirs := sc.Directories(); !reflect.DeepEqual(dirs, []string{"a"}) {
+		t.Errorf("Directories() = %v, want [a]", dirs)
+	}
+}
+
+func TestSparseCheckoutRoundTrip(t *testing.T) {
+	sc := NewSparseCheckout([]string{"packages/app", "docs"})
+	data := sc.Serialize()
+
+	expected := "/*\n!/*/\n/packages/\n!/packages/*/\n/docs/\n/packages/app/\n"
+	if string(data) != expected {
+		t.Errorf("Serialize() = %q, want %q", data, expected)
+	}
+
+	parsed, err := ParseSparseCheckout(data)
+	if err != nil {
+		t.Fatalf("failed to parse patterns: %v", err)
+	}
+
+	if !reflect.DeepEqual(parsed.Directories(), sc.Directories()) {
+		t.Errorf("round trip directories = %v, want %v", parsed.Directories(), sc.Directories())
+	}
+}
+
+func TestParseSparseCheckoutRejectsNonCone(t *testing.T) {
+	if _, err := ParseSparseCheckout([]byte("/*\n*.log\n")); err == nil {
+		t.Error("expected error for non-cone pattern")
+	}
+}
+
+func TestAddRespectsSparseCheckout(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, file := range []string{"root.txt", "app/main.go", "lib/lib.go"} {
+		fullPath := filepath.Join(tmpDir, file)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(fullPath, []byte(file), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+
+	idx := NewIndex()
+	opts := AddOptions{Sparse: NewSparseCheckout([]string{"app"})}
+
+	if err := idx.Add(tmpDir, []string{"."}, opts); err != nil {
+		t.Fatalf("failed to add files: %v", err)
+	}
+
+	if !idx.HasEntry("root.txt") || !idx.HasEntry("app/main.go") {
+		t.Error("expected files inside the cone to be in index")
+	}
+	if idx.HasEntry("lib/lib.go") {
+		t.Error("expected file outside the cone to be skipped")
+	}
+
+	err := idx.Add(tmpDir, []string{"lib/lib.go"}, opts)
+	if err == nil || !strings.Contains(err.Error(), "sparse-checkout") {
+		t.Errorf("expected sparse-checkout error, got %v", err)
+	}
+}
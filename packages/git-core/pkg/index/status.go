@@ -3,11 +3,13 @@ package index
 import (
 	"fmt"
 	"io/fs"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
-	"github.com/nseba/browser-git/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
 )
 
 // FileStatus represents the status of a file
@@ -56,6 +58,13 @@ type FileStatusEntry struct {
 	WorkStatus   FileStatus // Status in work tree vs index
 	StagedHash   hash.Hash  // Hash in index
 	WorkTreeHash hash.Hash  // Hash in work tree
+	HeadHash     hash.Hash  // Hash in HEAD
+	HeadMode     uint32     // Mode in HEAD (0 if absent)
+	IndexMode    uint32     // Mode in index (0 if absent)
+	WorkTreeMode uint32     // Mode in work tree (0 if absent)
+	OrigPath     string     // Path in HEAD of a renamed file
+	Score        int        // Similarity of a renamed file, in percent
+	Stages       [3]*Entry  // Base, ours and theirs of an unmerged file
 }
 
 // Status represents repository status
@@ -64,14 +73,17 @@ type Status struct {
 	Modified  []string          // Modified files (not staged)
 	Staged    []string          // Staged files (in index)
 	Deleted   []string          // Deleted files
-	Added     []string          // Added files (new in index)
-	Entries   []*FileStatusEntry // Detailed status entries
+	Added      []string           // Added files (new in index)
+	Conflicted []string           // Unmerged files
+	Entries    []*FileStatusEntry // Detailed status entries, sorted by path
 }
 
 // StatusOptions contains options for status computation
 type StatusOptions struct {
-	IncludeUntracked bool // Include untracked files
-	IncludeIgnored   bool // Include ignored files
+	IncludeUntracked bool            // Include untracked files
+	IncludeIgnored   bool            // Include ignored files
+	Sparse           *SparseCheckout // Files outside this cone are not expected in the work tree
+	Renames          bool            // Report staged deletions and additions of the same content as renames
 }
 
 // DefaultStatusOptions returns default status options
@@ -89,8 +101,9 @@ func GetStatus(workTreePath string, idx *Index, headCommit *object.Commit, objDB
 		Modified:  make([]string, 0),
 		Staged:    make([]string, 0),
 		Deleted:   make([]string, 0),
-		Added:     make([]string, 0),
-		Entries:   make([]*FileStatusEntry, 0),
+		Added:      make([]string, 0),
+		Conflicted: make([]string, 0),
+		Entries:    make([]*FileStatusEntry, 0),
 	}
 
 	// Load gitignore
@@ -101,6 +114,7 @@ func GetStatus(workTreePath string, idx *Index, headCommit *object.Commit, objDB
 
 	// Get HEAD tree entries
 	headEntries := make(map[string]hash.Hash)
+	headModes := make(map[string]uint32)
 	if headCommit != nil {
 		tree, err := objDB.Get(headCommit.Tree)
 		if err != nil {
@@ -110,14 +124,22 @@ func GetStatus(workTreePath string, idx *Index, headCommit *object.Commit, objDB
 		if !ok {
 			return nil, fmt.Errorf("HEAD tree is not a tree object")
 		}
-		if err := collectTreeEntries(treeObj, "", objDB, headEntries); err != nil {
+		if err := collectTreeEntries(treeObj, "", objDB, headEntries, headModes); err != nil {
 			return nil, err
 		}
 	}
 
-	// Get index entries
+	// Get index entries, keeping the conflict stages of unmerged files apart
 	indexEntries := make(map[string]*Entry)
+	unmerged := make(map[string]*[3]*Entry)
 	for _, entry := range idx.Entries {
+		if entry.StageFlag > 0 && entry.StageFlag <= 3 {
+			if unmerged[entry.Path] == nil {
+				unmerged[entry.Path] = &[3]*Entry{}
+			}
+			unmerged[entry.Path][entry.StageFlag-1] = entry
+			continue
+		}
 		indexEntries[entry.Path] = entry
 	}
 
@@ -159,13 +181,17 @@ func GetStatus(workTreePath string, idx *Index, headCommit *object.Commit, objDB
 
 	// Process files in HEAD
 	for path, headHash := range headEntries {
-		entry := &FileStatusEntry{Path: path}
+		if unmerged[path] != nil {
+			continue
+		}
+		entry := &FileStatusEntry{Path: path, HeadHash: headHash, HeadMode: headModes[path]}
 		indexEntry, inIndex := indexEntries[path]
 		_, inWorkTree := workTreeFiles[path]
 
 		if inIndex {
 			// File is in HEAD and index
 			entry.StagedHash = indexEntry.Hash
+			entry.IndexMode = indexEntry.Mode
 			if !indexEntry.Hash.Equals(headHash) {
 				// Index differs from HEAD - file is staged
 				entry.IndexStatus = StatusStaged
@@ -176,16 +202,20 @@ func GetStatus(workTreePath string, idx *Index, headCommit *object.Commit, objDB
 
 			if inWorkTree {
 				// Check if work tree differs from index
-				modified, err := indexEntry.IsModified(workTreePath)
+				modified, err := isWorkTreeModified(workTreePath, indexEntry)
 				if err != nil {
 					return nil, err
 				}
+				entry.WorkTreeMode = workTreeMode(workTreePath, path)
 				if modified {
 					entry.WorkStatus = StatusModified
 					status.Modified = append(status.Modified, path)
 				} else {
 					entry.WorkStatus = StatusUnmodified
 				}
+			} else if opts.Sparse != nil && !opts.Sparse.Includes(path) {
+				// Outside the sparse-checkout cone, absence is expected
+				entry.WorkStatus = StatusUnmodified
 			} else {
 				// File deleted in work tree
 				entry.WorkStatus = StatusDeleted
@@ -194,6 +224,7 @@ func GetStatus(workTreePath string, idx *Index, headCommit *object.Commit, objDB
 		} else {
 			// File is in HEAD but not in index - deleted
 			entry.IndexStatus = StatusDeleted
+			entry.WorkStatus = StatusUnmodified
 			if !inWorkTree {
 				status.Deleted = append(status.Deleted, path)
 			}
@@ -208,6 +239,7 @@ func GetStatus(workTreePath string, idx *Index, headCommit *object.Commit, objDB
 			entry := &FileStatusEntry{
 				Path:        path,
 				StagedHash:  indexEntry.Hash,
+				IndexMode:   indexEntry.Mode,
 				IndexStatus: StatusAdded,
 			}
 			status.Added = append(status.Added, path)
@@ -215,16 +247,19 @@ func GetStatus(workTreePath string, idx *Index, headCommit *object.Commit, objDB
 			_, inWorkTree := workTreeFiles[path]
 			if inWorkTree {
 				// Check if work tree differs from index
-				modified, err := indexEntry.IsModified(workTreePath)
+				modified, err := isWorkTreeModified(workTreePath, indexEntry)
 				if err != nil {
 					return nil, err
 				}
+				entry.WorkTreeMode = workTreeMode(workTreePath, path)
 				if modified {
 					entry.WorkStatus = StatusModified
 					status.Modified = append(status.Modified, path)
 				} else {
 					entry.WorkStatus = StatusUnmodified
 				}
+			} else if opts.Sparse != nil && !opts.Sparse.Includes(path) {
+				entry.WorkStatus = StatusUnmodified
 			} else {
 				entry.WorkStatus = StatusDeleted
 				status.Deleted = append(status.Deleted, path)
@@ -234,10 +269,28 @@ func GetStatus(workTreePath string, idx *Index, headCommit *object.Commit, objDB
 		}
 	}
 
+	// Process unmerged files
+	for path, stages := range unmerged {
+		entry := &FileStatusEntry{
+			Path:        path,
+			Status:      StatusConflict,
+			IndexStatus: StatusConflict,
+			WorkStatus:  StatusConflict,
+			HeadHash:    headEntries[path],
+			HeadMode:    headModes[path],
+			Stages:      *stages,
+		}
+		if _, inWorkTree := workTreeFiles[path]; inWorkTree {
+			entry.WorkTreeMode = workTreeMode(workTreePath, path)
+		}
+		status.Conflicted = append(status.Conflicted, path)
+		status.Entries = append(status.Entries, entry)
+	}
+
 	// Process untracked files (in work tree but not in index or HEAD)
 	if opts.IncludeUntracked {
 		for path := range workTreeFiles {
-			if _, inIndex := indexEntries[path]; !inIndex {
+			if _, inIndex := indexEntries[path]; !inIndex && unmerged[path] == nil {
 				if _, inHead := headEntries[path]; !inHead {
 					entry := &FileStatusEntry{
 						Path:        path,
@@ -251,11 +304,76 @@ func GetStatus(workTreePath string, idx *Index, headCommit *object.Commit, objDB
 		}
 	}
 
+	sort.Slice(status.Entries, func(i, j int) bool {
+		return status.Entries[i].Path < status.Entries[j].Path
+	})
+	if opts.Renames {
+		status.Entries = pairRenames(status.Entries)
+	}
+
 	return status, nil
 }
 
+// pairRenames replaces each staged deletion whose content was staged
+// again under a new path with a rename of the added entry. Only exact
+// renames are found, so the score is always 100.
+func pairRenames(entries []*FileStatusEntry) []*FileStatusEntry {
+	added := make(map[string][]*FileStatusEntry)
+	for _, entry := range entries {
+		if entry.IndexStatus == StatusAdded {
+			key := entry.StagedHash.String()
+			added[key] = append(added[key], entry)
+		}
+	}
+
+	paired := make([]*FileStatusEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IndexStatus != StatusDeleted {
+			paired = append(paired, entry)
+			continue
+		}
+		key := entry.HeadHash.String()
+		candidates := added[key]
+		if len(candidates) == 0 {
+			paired = append(paired, entry)
+			continue
+		}
+		rename := candidates[0]
+		added[key] = candidates[1:]
+
+		rename.IndexStatus = StatusRenamed
+		rename.OrigPath = entry.Path
+		rename.Score = 100
+		rename.HeadHash = entry.HeadHash
+		rename.HeadMode = entry.HeadMode
+	}
+	return paired
+}
+
+// isWorkTreeModified checks whether a tracked file differs from its index
+// entry. Submodules are not inspected and count as unmodified.
+func isWorkTreeModified(workTreePath string, entry *Entry) (bool, error) {
+	if entry.Mode == FileModeGitlink {
+		return false, nil
+	}
+	return entry.IsModified(workTreePath)
+}
+
+// workTreeMode returns the index mode of a file in the work tree, or 0
+// if it cannot be read
+func workTreeMode(workTreePath, path string) uint32 {
+	info, err := os.Lstat(filepath.Join(workTreePath, path))
+	if err != nil {
+		return 0
+	}
+	if info.IsDir() {
+		return FileModeGitlink
+	}
+	return fileInfoMode(info)
+}
+
 // collectTreeEntries recursively collects all entries from a tree
-func collectTreeEntries(tree *object.Tree, prefix string, objDB object.Database, entries map[string]hash.Hash) error {
+func collectTreeEntries(tree *object.Tree, prefix string, objDB object.Database, entries map[string]hash.Hash, modes map[string]uint32) error {
 	treeEntries := tree.Entries()
 	for _, entry := range treeEntries {
 		path := entry.Name
@@ -273,12 +391,13 @@ func collectTreeEntries(tree *object.Tree, prefix string, objDB object.Database,
 			if !ok {
 				return fmt.Errorf("subtree %s is not a tree object", path)
 			}
-			if err := collectTreeEntries(subtree, path, objDB, entries); err != nil {
+			if err := collectTreeEntries(subtree, path, objDB, entries, modes); err != nil {
 				return err
 			}
 		} else {
 			// Add file entry
 			entries[path] = entry.Hash
+			modes[path] = uint32(entry.Mode)
 		}
 	}
 	return nil
@@ -290,7 +409,8 @@ func (s *Status) IsClean() bool {
 		len(s.Modified) == 0 &&
 		len(s.Staged) == 0 &&
 		len(s.Deleted) == 0 &&
-		len(s.Added) == 0
+		len(s.Added) == 0 &&
+		len(s.Conflicted) == 0
 }
 
 // HasChanges returns true if there are any changes (staged or unstaged)
@@ -2,83 +2,436 @@ package merge
 
 import (
 	"fmt"
+	"time"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
-	"github.com/nseba/browser-git/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
 )
 
-// FindMergeBase finds the common ancestor (merge base) between two commits
-// using a simple algorithm that traverses both commit histories
+// FindMergeBase finds the best common ancestor (merge base) of two
+// commits: the newest common ancestor that is not an ancestor of another
+// one. It walks the two histories only until they meet instead of walking
+// either to its root.
 func FindMergeBase(db object.Database, commit1Hash, commit2Hash hash.Hash) (hash.Hash, error) {
 	// Handle special case: if commits are the same
 	if commit1Hash.String() == commit2Hash.String() {
 		return commit1Hash, nil
 	}
 
-	// Build ancestry set for commit1
-	commit1Ancestors, err := getAncestors(db, commit1Hash)
+	bases, err := FindMergeBases(db, commit1Hash, commit2Hash)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get ancestors of commit1: %w", err)
+		return nil, err
 	}
 
-	// Traverse commit2 history until we find a commit in commit1's ancestry
-	mergeBase, err := findFirstCommonAncestor(db, commit2Hash, commit1Ancestors)
+	if len(bases) == 0 {
+		return nil, fmt.Errorf("no common ancestor found")
+	}
+
+	return bases[0], nil
+}
+
+// FindMergeBases finds all best common ancestors of two commits, newest
+// first, like git merge-base --all. Unrelated histories have none.
+func FindMergeBases(db object.Database, commit1Hash, commit2Hash hash.Hash) ([]hash.Hash, error) {
+	if commit1Hash.String() == commit2Hash.String() {
+		return []hash.Hash{commit1Hash}, nil
+	}
+
+	walk, err := paintDownToCommon(db, commit1Hash, commit2Hash)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find common ancestor: %w", err)
 	}
 
-	if mergeBase == nil {
-		return nil, fmt.Errorf("no common ancestor found")
+	bases, err := removeRedundant(db, walk.mergeBases())
+	if err != nil {
+		return nil, fmt.Errorf("failed to find common ancestor: %w", err)
+	}
+	return bases, nil
+}
+
+// AheadBehind counts the commits reachable from one but not from two
+// (ahead) and from two but not from one (behind), like git rev-list
+// --left-right --count one...two. It paints both sides down, newest first
+// by committer date, and counts the commits painted by one side only. The
+// walk stops once every commit left to visit is reached from both sides
+// and is older than every commit painted by one side, so it ends where
+// the two histories meet. That bound trusts the dates: if the walk meets
+// a commit dated after one of its children, it counts both histories in
+// full instead.
+func AheadBehind(db object.Database, one, two hash.Hash) (ahead, behind int, err error) {
+	if one.String() == two.String() {
+		return 0, 0, nil
+	}
+
+	flags := make(map[string]paintFlags)
+	visited := make(map[string]paintFlags)
+	commits := make(map[string]*object.Commit)
+	queue := &paintQueue{}
+	skewed := false
+
+	push := func(h hash.Hash, child *object.Commit) error {
+		key := h.String()
+		commit, ok := commits[key]
+		if !ok {
+			var err error
+			if commit, err = loadCommit(db, h); err != nil {
+				return fmt.Errorf("failed to load commit %s: %w", key, err)
+			}
+			commits[key] = commit
+		}
+		if child != nil && commit.Committer.When.After(child.Committer.When) {
+			skewed = true
+		}
+		queue.push(h, commit.Committer.When)
+		return nil
+	}
+
+	flags[one.String()] = reachedFromOne
+	flags[two.String()] = reachedFromTwo
+	if err := push(one, nil); err != nil {
+		return 0, 0, err
+	}
+	if err := push(two, nil); err != nil {
+		return 0, 0, err
+	}
+
+	nonStale := func(h hash.Hash) bool {
+		return flags[h.String()]&reachedFromBoth != reachedFromBoth
+	}
+
+	// Once only commits reached from both sides are queued, no commit
+	// gains one-sided paint and the oldest one-sided commit can only get
+	// newer
+	var oldest time.Time
+	settling, oneSided := false, false
+	for len(queue.items) > 0 && !skewed {
+		if !queue.any(nonStale) {
+			if !settling {
+				settling = true
+				oldest, oneSided = oldestOneSided(flags, commits)
+			}
+			if !oneSided || queue.newest().Before(oldest) {
+				break
+			}
+		}
+
+		current := queue.pop()
+		key := current.String()
+		paint := flags[key]
+		if before, seen := visited[key]; seen && before == paint {
+			continue
+		}
+		visited[key] = paint
+
+		for _, parent := range commits[key].Parents {
+			parentKey := parent.String()
+			if flags[parentKey]|paint == flags[parentKey] {
+				continue
+			}
+			flags[parentKey] |= paint
+			if err := push(parent, commits[key]); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	if skewed {
+		return countAheadBehind(db, one, two)
 	}
 
-	return mergeBase, nil
+	for _, paint := range flags {
+		switch paint & reachedFromBoth {
+		case reachedFromOne:
+			ahead++
+		case reachedFromTwo:
+			behind++
+		}
+	}
+	return ahead, behind, nil
 }
 
-// getAncestors returns a set of all ancestors of a commit (including itself)
-func getAncestors(db object.Database, commitHash hash.Hash) (map[string]bool, error) {
-	ancestors := make(map[string]bool)
-	queue := []hash.Hash{commitHash}
-	visited := make(map[string]bool)
+// oldestOneSided returns the oldest committer date among the commits
+// painted by only one side, and whether there are any
+func oldestOneSided(flags map[string]paintFlags, commits map[string]*object.Commit) (time.Time, bool) {
+	var oldest time.Time
+	found := false
+	for key, paint := range flags {
+		if paint&reachedFromBoth == reachedFromBoth {
+			continue
+		}
+		when := commits[key].Committer.When
+		if !found || when.Before(oldest) {
+			oldest, found = when, true
+		}
+	}
+	return oldest, found
+}
 
-	for len(queue) > 0 {
-		// Dequeue
-		current := queue[0]
-		queue = queue[1:]
+// countAheadBehind counts ahead and behind commits by walking both
+// histories in full
+func countAheadBehind(db object.Database, one, two hash.Hash) (ahead, behind int, err error) {
+	left, err := getAncestors(db, one)
+	if err != nil {
+		return 0, 0, err
+	}
+	right, err := getAncestors(db, two)
+	if err != nil {
+		return 0, 0, err
+	}
 
-		currentStr := current.String()
+	for key := range left {
+		if !right[key] {
+			ahead++
+		}
+	}
+	for key := range right {
+		if !left[key] {
+			behind++
+		}
+	}
+	return ahead, behind, nil
+}
 
-		// Skip if already visited
-		if visited[currentStr] {
+// paintFlags record which sides of a merge-base walk reach a commit
+type paintFlags uint8
+
+const (
+	reachedFromOne paintFlags = 1 << iota
+	reachedFromTwo
+	// paintStale marks ancestors of common ancestors, which are not merge
+	// bases themselves
+	paintStale
+
+	reachedFromBoth = reachedFromOne | reachedFromTwo
+)
+
+// paintWalk is the outcome of paintDownToCommon
+type paintWalk struct {
+	// flags holds the paint of every commit the walk reached
+	flags map[string]paintFlags
+
+	// common are the common ancestors found before any of their
+	// descendants was, newest first
+	common []hash.Hash
+}
+
+// mergeBases returns the common ancestors that are not below another one
+func (w *paintWalk) mergeBases() []hash.Hash {
+	bases := make([]hash.Hash, 0, len(w.common))
+	for _, h := range w.common {
+		if w.flags[h.String()]&paintStale == 0 {
+			bases = append(bases, h)
+		}
+	}
+	return bases
+}
+
+// paintDownToCommon walks from two commits, newest first by committer
+// date, painting each commit with the sides that reach it, as Git's
+// paint_down_to_common does. Paint flows from a commit to its parents, and
+// the walk ends once everything left to visit is below a common ancestor.
+// A commit whose paint changes after it was visited, as when clock skew
+// or equal dates put a parent before its child, is visited again, but the
+// walk may still end before paint reaches every commit it should. Common
+// ancestors found too early are dropped by removeRedundant; the paint of
+// the other commits is not exact and must not be counted.
+func paintDownToCommon(db object.Database, one, two hash.Hash) (*paintWalk, error) {
+	walk := &paintWalk{flags: make(map[string]paintFlags)}
+	queue := &paintQueue{}
+	visited := make(map[string]paintFlags)
+	commits := make(map[string]*object.Commit)
+
+	push := func(h hash.Hash) error {
+		key := h.String()
+		commit, ok := commits[key]
+		if !ok {
+			var err error
+			if commit, err = loadCommit(db, h); err != nil {
+				return fmt.Errorf("failed to load commit %s: %w", key, err)
+			}
+			commits[key] = commit
+		}
+		queue.push(h, commit.Committer.When)
+		return nil
+	}
+
+	walk.flags[one.String()] |= reachedFromOne
+	walk.flags[two.String()] |= reachedFromTwo
+	if err := push(one); err != nil {
+		return nil, err
+	}
+	if one.String() != two.String() {
+		if err := push(two); err != nil {
+			return nil, err
+		}
+	}
+
+	// Entries still worth visiting: not yet known to be common, or
+	// repainted since they were visited
+	interesting := func(h hash.Hash) bool {
+		key := h.String()
+		flags := walk.flags[key]
+		before, seen := visited[key]
+		return flags&paintStale == 0 || (seen && before != flags)
+	}
+
+	for queue.any(interesting) {
+		current := queue.pop()
+		key := current.String()
+		flags := walk.flags[key]
+		if before, seen := visited[key]; seen && before == flags {
 			continue
 		}
-		visited[currentStr] = true
-		ancestors[currentStr] = true
+		visited[key] = flags
 
-		// Load commit
-		commit, err := loadCommit(db, current)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load commit %s: %w", currentStr, err)
+		if flags&(reachedFromBoth|paintStale) == reachedFromBoth {
+			if !containsHash(walk.common, current) {
+				walk.common = append(walk.common, current)
+			}
+			flags |= paintStale
 		}
 
-		// Enqueue parents
-		for _, parent := range commit.Parents {
-			if !visited[parent.String()] {
-				queue = append(queue, parent)
+		for _, parent := range commits[key].Parents {
+			parentKey := parent.String()
+			if walk.flags[parentKey]|flags == walk.flags[parentKey] {
+				continue
+			}
+			walk.flags[parentKey] |= flags
+			if err := push(parent); err != nil {
+				return nil, err
 			}
 		}
 	}
 
-	return ancestors, nil
+	return walk, nil
 }
 
-// findFirstCommonAncestor traverses from startCommit and finds the first commit
-// that exists in the ancestors set
-func findFirstCommonAncestor(
-	db object.Database,
-	startCommit hash.Hash,
-	ancestors map[string]bool,
-) (hash.Hash, error) {
-	queue := []hash.Hash{startCommit}
+// removeRedundant drops the merge base candidates that are ancestors of
+// another candidate
+func removeRedundant(db object.Database, candidates []hash.Hash) ([]hash.Hash, error) {
+	if len(candidates) < 2 {
+		return candidates, nil
+	}
+
+	result := make([]hash.Hash, 0, len(candidates))
+	for i, candidate := range candidates {
+		redundant := false
+		for j, other := range candidates {
+			if i == j {
+				continue
+			}
+			below, err := IsAncestor(db, candidate, other)
+			if err != nil {
+				return nil, err
+			}
+			if below {
+				redundant = true
+				break
+			}
+		}
+		if !redundant {
+			result = append(result, candidate)
+		}
+	}
+
+	return result, nil
+}
+
+// containsHash reports whether hashes includes h
+func containsHash(hashes []hash.Hash, h hash.Hash) bool {
+	for _, other := range hashes {
+		if other.Equals(h) {
+			return true
+		}
+	}
+	return false
+}
+
+// paintQueue is a priority queue of commits, newest committer date first
+// and first in, first out among equal dates
+type paintQueue struct {
+	items []paintItem
+	seq   int
+}
+
+// paintItem is a queued commit
+type paintItem struct {
+	hash hash.Hash
+	when time.Time
+	seq  int
+}
+
+// push queues a commit
+func (q *paintQueue) push(h hash.Hash, when time.Time) {
+	q.seq++
+	q.items = append(q.items, paintItem{hash: h, when: when, seq: q.seq})
+
+	// Sift up
+	i := len(q.items) - 1
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !q.before(i, parent) {
+			break
+		}
+		q.items[i], q.items[parent] = q.items[parent], q.items[i]
+		i = parent
+	}
+}
+
+// pop removes and returns the newest commit
+func (q *paintQueue) pop() hash.Hash {
+	top := q.items[0].hash
+	last := len(q.items) - 1
+	q.items[0] = q.items[last]
+	q.items = q.items[:last]
+
+	// Sift down
+	i := 0
+	for {
+		smallest := i
+		for _, child := range []int{2*i + 1, 2*i + 2} {
+			if child < len(q.items) && q.before(child, smallest) {
+				smallest = child
+			}
+		}
+		if smallest == i {
+			break
+		}
+		q.items[i], q.items[smallest] = q.items[smallest], q.items[i]
+		i = smallest
+	}
+
+	return top
+}
+
+// before orders queue items
+func (q *paintQueue) before(i, j int) bool {
+	a, b := q.items[i], q.items[j]
+	if !a.when.Equal(b.when) {
+		return a.when.After(b.when)
+	}
+	return a.seq < b.seq
+}
+
+// newest returns the committer date of the newest queued commit
+func (q *paintQueue) newest() time.Time {
+	return q.items[0].when
+}
+
+// any reports whether some queued commit satisfies fn
+func (q *paintQueue) any(fn func(hash.Hash) bool) bool {
+	for _, item := range q.items {
+		if fn(item.hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// getAncestors returns a set of all ancestors of a commit (including itself)
+func getAncestors(db object.Database, commitHash hash.Hash) (map[string]bool, error) {
+	ancestors := make(map[string]bool)
+	queue := []hash.Hash{commitHash}
 	visited := make(map[string]bool)
 
 	for len(queue) > 0 {
@@ -93,11 +446,7 @@ func findFirstCommonAncestor(
 			continue
 		}
 		visited[currentStr] = true
-
-		// Check if this commit is in the ancestor set
-		if ancestors[currentStr] {
-			return current, nil
-		}
+		ancestors[currentStr] = true
 
 		// Load commit
 		commit, err := loadCommit(db, current)
@@ -113,7 +462,7 @@ func findFirstCommonAncestor(
 		}
 	}
 
-	return nil, nil
+	return ancestors, nil
 }
 
 // CanFastForward checks if we can do a fast-forward merge from 'from' to 'to'
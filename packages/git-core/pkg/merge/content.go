@@ -45,6 +45,8 @@ func splitLines(content []byte) []string {
 	str := string(content)
 	// Handle both \n and \r\n line endings
 	str = strings.ReplaceAll(str, "\r\n", "\n")
+	// A trailing newline terminates the last line rather than starting a new one
+	str = strings.TrimSuffix(str, "\n")
 	return strings.Split(str, "\n")
 }
 
@@ -0,0 +1,6 @@
+// Package merge implements three-way merges of trees and file content and
+// merge-base discovery.
+//
+// Its result types are returned by repository.Repository.Merge. Calling the
+// package directly is experimental: its API may change in a minor release.
+package merge
@@ -3,11 +3,12 @@ package merge
 import (
 	"bytes"
 	"fmt"
+	"math/rand"
 	"testing"
 	"time"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
-	"github.com/nseba/browser-git/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
 )
 
 // mockDatabase is a simple in-memory object database for testing
@@ -218,6 +219,258 @@ func TestCanFastForward(t *testing.T) {
 	}
 }
 
+// datedHistory builds commits with chosen dates: the nth commit gets
+// date(n)
+type datedHistory struct {
+	t    *testing.T
+	db   *mockDatabase
+	tree hash.Hash
+	date func(n int) time.Time
+	n    int
+}
+
+func (h *datedHistory) commit(message string, parents ...hash.Hash) hash.Hash {
+	h.n++
+	commit := object.NewCommit()
+	commit.Tree = h.tree
+	commit.Parents = parents
+	commit.Author = object.Signature{Name: "Test Author", Email: "test@example.com", When: h.date(h.n)}
+	commit.Committer = commit.Author
+	commit.Message = message
+	commitHash, err := h.db.Put(commit)
+	if err != nil {
+		h.t.Fatalf("Failed to create commit %s: %v", message, err)
+	}
+	return commitHash
+}
+
+// TestAheadBehind tests counting commits on either side of a merge base,
+// with increasing dates and with all dates equal, where the walk cannot
+// rely on dates to visit children first
+func TestAheadBehind(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	dates := map[string]func(int) time.Time{
+		"increasing": func(n int) time.Time { return start.Add(time.Duration(n) * time.Minute) },
+		"equal":      func(int) time.Time { return start },
+	}
+
+	for name, date := range dates {
+		db := newMockDatabase()
+		hasher, _ := hash.NewHasher(hash.SHA1)
+		tree, err := createTestTree(db, hasher, []object.TreeEntry{})
+		if err != nil {
+			t.Fatalf("Failed to create tree: %v", err)
+		}
+		h := &datedHistory{t: t, db: db, tree: tree.Hash(), date: date}
+
+		// R - A - M1 - M2 - M3 - M4 - M5   (one)
+		//      \         /
+		//       T0 ---------------- T1      (two)
+		root := h.commit("R")
+		a := h.commit("A", root)
+		t0 := h.commit("T0", a)
+		m1 := h.commit("M1", a)
+		m2 := h.commit("M2", m1)
+		m3 := h.commit("M3", m2, t0)
+		m4 := h.commit("M4", m3)
+		one := h.commit("M5", m4)
+		two := h.commit("T1", t0)
+
+		ahead, behind, err := AheadBehind(db, one, two)
+		if err != nil {
+			t.Fatalf("%s: AheadBehind failed: %v", name, err)
+		}
+		if ahead != 5 || behind != 1 {
+			t.Errorf("%s: expected 5 ahead and 1 behind, got %d and %d", name, ahead, behind)
+		}
+
+		ahead, behind, err = AheadBehind(db, m2, one)
+		if err != nil {
+			t.Fatalf("%s: AheadBehind failed: %v", name, err)
+		}
+		if ahead != 0 || behind != 4 {
+			t.Errorf("%s: expected 0 ahead and 4 behind, got %d and %d", name, ahead, behind)
+		}
+
+		if ahead, behind, _ := AheadBehind(db, one, one); ahead != 0 || behind != 0 {
+			t.Errorf("%s: expected a commit to be level with itself, got %d and %d", name, ahead, behind)
+		}
+
+		base, err := FindMergeBase(db, one, two)
+		if err != nil {
+			t.Fatalf("%s: FindMergeBase failed: %v", name, err)
+		}
+		if !base.Equals(t0) {
+			t.Errorf("%s: expected merge base T0, got %s", name, base)
+		}
+	}
+}
+
+// TestFindMergeBaseCrissCross tests that a merge base is never an
+// ancestor of another common ancestor
+func TestFindMergeBaseCrissCross(t *testing.T) {
+	db := newMockDatabase()
+	hasher, _ := hash.NewHasher(hash.SHA1)
+	tree, err := createTestTree(db, hasher, []object.TreeEntry{})
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := &datedHistory{t: t, db: db, tree: tree.Hash(), date: func(n int) time.Time {
+		return start.Add(time.Duration(n) * time.Minute)
+	}}
+
+	// P merges Y into X and Q merges X into Y, so both X and Y are best
+	// common ancestors and A, below them, is not
+	a := h.commit("A")
+	x := h.commit("X", a)
+	y := h.commit("Y", a)
+	p := h.commit("P", x, y)
+	q := h.commit("Q", y, x)
+
+	base, err := FindMergeBase(db, p, q)
+	if err != nil {
+		t.Fatalf("FindMergeBase failed: %v", err)
+	}
+	if !base.Equals(x) && !base.Equals(y) {
+		t.Errorf("Expected X or Y as the merge base, got %s", base)
+	}
+
+	unrelated := h.commit("Unrelated")
+	if _, err := FindMergeBase(db, p, unrelated); err == nil {
+		t.Error("Expected an error for unrelated histories")
+	}
+}
+
+// TestAheadBehindStopsWhereHistoriesMeet tests that counting does not
+// walk the shared history below the merge base
+func TestAheadBehindStopsWhereHistoriesMeet(t *testing.T) {
+	db := newMockDatabase()
+	hasher, _ := hash.NewHasher(hash.SHA1)
+	tree, err := createTestTree(db, hasher, []object.TreeEntry{})
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := &datedHistory{t: t, db: db, tree: tree.Hash(), date: func(n int) time.Time {
+		return start.Add(time.Duration(n) * time.Minute)
+	}}
+
+	var shared []hash.Hash
+	for i := 0; i < 20; i++ {
+		var parents []hash.Hash
+		if i > 0 {
+			parents = append(parents, shared[i-1])
+		}
+		shared = append(shared, h.commit(fmt.Sprintf("S%d", i), parents...))
+	}
+	base := shared[len(shared)-1]
+	one := h.commit("L2", h.commit("L1", base))
+	two := h.commit("R3", h.commit("R2", h.commit("R1", base)))
+
+	// Drop the deep history so walking into it fails
+	for _, commit := range shared[:15] {
+		db.Delete(commit)
+	}
+
+	expectAheadBehind(t, "linear", db, one, two, 2, 3)
+}
+
+// TestAheadBehindCrissCross tests counting commits against criss-cross
+// histories whose committer dates are equal or skewed, so the walk visits
+// some parents before their children. The counts are checked against the
+// set differences of the two sides' ancestors.
+func TestAheadBehindCrissCross(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	dates := map[string]func(int) time.Time{
+		"equal": func(int) time.Time { return start },
+		"skewed": func(n int) time.Time {
+			// Every third commit is dated an hour before its parents
+			if n%3 == 0 {
+				return start.Add(time.Duration(n)*time.Minute - time.Hour)
+			}
+			return start.Add(time.Duration(n) * time.Minute)
+		},
+	}
+
+	for name, date := range dates {
+		db := newMockDatabase()
+		hasher, _ := hash.NewHasher(hash.SHA1)
+		tree, err := createTestTree(db, hasher, []object.TreeEntry{})
+		if err != nil {
+			t.Fatalf("Failed to create tree: %v", err)
+		}
+		h := &datedHistory{t: t, db: db, tree: tree.Hash(), date: date}
+
+		// R - A, then X and Y on A; P merges Y into X and Q merges X into
+		// Y, so X and Y are both merge bases of P and Q. P grows to P2 and
+		// Q to Q1.
+		root := h.commit("R")
+		a := h.commit("A", root)
+		x := h.commit("X", a)
+		y := h.commit("Y", a)
+		p := h.commit("P", x, y)
+		q := h.commit("Q", y, x)
+		p1 := h.commit("P1", p)
+		one := h.commit("P2", p1)
+		two := h.commit("Q1", q)
+
+		expectAheadBehind(t, name, db, one, two, 3, 2)
+		expectAheadBehind(t, name, db, p, q, 1, 1)
+		expectAheadBehind(t, name, db, x, two, 0, 3)
+
+		// Random histories made of branches and criss-cross merges
+		rng := rand.New(rand.NewSource(1))
+		commits := []hash.Hash{h.commit("root")}
+		for i := 0; i < 60; i++ {
+			first := commits[len(commits)-1-rng.Intn(min(len(commits), 5))]
+			parents := []hash.Hash{first}
+			if rng.Intn(3) == 0 {
+				second := commits[rng.Intn(len(commits))]
+				if !second.Equals(first) {
+					parents = append(parents, second)
+				}
+			}
+			commits = append(commits, h.commit(fmt.Sprintf("C%d", i), parents...))
+		}
+		for i := 0; i < 200; i++ {
+			one, two := commits[rng.Intn(len(commits))], commits[rng.Intn(len(commits))]
+			left, err := getAncestors(db, one)
+			if err != nil {
+				t.Fatal(err)
+			}
+			right, err := getAncestors(db, two)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ahead, behind := 0, 0
+			for key := range left {
+				if !right[key] {
+					ahead++
+				}
+			}
+			for key := range right {
+				if !left[key] {
+					behind++
+				}
+			}
+			expectAheadBehind(t, name, db, one, two, ahead, behind)
+		}
+	}
+}
+
+// expectAheadBehind checks the counts AheadBehind gives for two commits
+func expectAheadBehind(t *testing.T, name string, db object.Database, one, two hash.Hash, ahead, behind int) {
+	t.Helper()
+	gotAhead, gotBehind, err := AheadBehind(db, one, two)
+	if err != nil {
+		t.Fatalf("%s: AheadBehind failed: %v", name, err)
+	}
+	if gotAhead != ahead || gotBehind != behind {
+		t.Errorf("%s: AheadBehind(%s, %s): expected %d/%d, got %d/%d", name, one, two, ahead, behind, gotAhead, gotBehind)
+	}
+}
+
 // TestMergeContentNoConflict tests content merging without conflicts
 func TestMergeContentNoConflict(t *testing.T) {
 	base := []byte("line 1\nline 2\nline 3\n")
@@ -5,8 +5,8 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
-	"github.com/nseba/browser-git/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
 )
 
 // TreeMerger handles merging of Git trees (directory structures)
@@ -200,10 +200,61 @@ func (tm *TreeMerger) mergeEntry(
 		}, nil
 	}
 
-	// Case 6: Conflict - both sides modified differently or incompatible types
+	// Case 6: Both sides modified the same file - try a line-level merge
+	if base != nil && ours != nil && theirs != nil &&
+		base.Mode != object.ModeDir && ours.Mode != object.ModeDir && theirs.Mode != object.ModeDir {
+
+		merged, err := tm.mergeFileContent(base, ours, theirs)
+		if err != nil {
+			return nil, nil, err
+		}
+		if merged != nil {
+			return nil, merged, nil
+		}
+	}
+
+	// Case 7: Conflict - both sides modified differently or incompatible types
 	return tm.createConflict(base, ours, theirs, path)
 }
 
+// mergeFileContent merges the content of a file changed on both sides
+// Returns nil if the changes overlap and must be reported as a conflict
+func (tm *TreeMerger) mergeFileContent(base, ours, theirs *object.TreeEntry) (*object.TreeEntry, error) {
+	baseContent, err := loadBlobContent(tm.db, base.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load base content: %w", err)
+	}
+
+	ourContent, err := loadBlobContent(tm.db, ours.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load our content: %w", err)
+	}
+
+	theirContent, err := loadBlobContent(tm.db, theirs.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load their content: %w", err)
+	}
+
+	merged, hasConflict, err := MergeContent(baseContent, ourContent, theirContent)
+	if err != nil {
+		return nil, err
+	}
+	if hasConflict {
+		return nil, nil
+	}
+
+	blobHash, err := tm.db.Put(object.NewBlob(merged))
+	if err != nil {
+		return nil, fmt.Errorf("failed to write merged blob: %w", err)
+	}
+
+	return &object.TreeEntry{
+		Mode: ours.Mode,
+		Name: ours.Name,
+		Hash: blobHash,
+	}, nil
+}
+
 // createConflict creates a conflict object for an entry
 func (tm *TreeMerger) createConflict(
 	base, ours, theirs *object.TreeEntry,
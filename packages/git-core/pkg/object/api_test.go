@@ -0,0 +1,45 @@
+package object
+
+import (
+	"io"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// The frozen API listed in the package documentation. These assignments
+// stop compiling if one of the signatures changes.
+var (
+	_ Type = BlobType
+	_ Type = TreeType
+	_ Type = CommitType
+	_ Type = TagType
+
+	_ Object   = (*Blob)(nil)
+	_ Object   = (*Tree)(nil)
+	_ Object   = (*Commit)(nil)
+	_ Object   = (*Tag)(nil)
+	_ Database = (*ObjectDatabase)(nil)
+
+	_ func(Object) Type             = Object.Type
+	_ func(Object) hash.Hash        = Object.Hash
+	_ func(Object, io.Writer) error = Object.Serialize
+
+	_ func(Database, hash.Hash) (Object, error) = Database.Get
+	_ func(Database, Object) (hash.Hash, error) = Database.Put
+	_ func(Database, hash.Hash) bool            = Database.Has
+
+	_ func([]byte) *Blob = NewBlob
+	_ func() *Tree       = NewTree
+	_ func() *Commit     = NewCommit
+	_ func() *Tag        = NewTag
+
+	_ func([]byte) (*Blob, error)        = ParseBlob
+	_ func([]byte) (*Tree, error)        = ParseTree
+	_ func([]byte) (*Commit, error)      = ParseCommit
+	_ func([]byte) (*Tag, error)         = ParseTag
+	_ func(Type, []byte) (Object, error) = ParseObject
+
+	_ func(Storage, hash.Hasher) *ObjectDatabase = NewObjectDatabase
+	_ func([]byte) ([]byte, error)               = Compress
+	_ func([]byte) ([]byte, error)               = Decompress
+)
@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"io"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
 )
 
 // Blob represents a Git blob object (file content)
@@ -8,7 +8,7 @@ import (
 	"strings"
 	"time"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
 )
 
 // Signature represents a Git signature (author or committer)
@@ -16,6 +16,9 @@ type Signature struct {
 	Name  string
 	Email string
 	When  time.Time
+
+	// raw keeps a non-canonical line as parsed so it serializes unchanged
+	raw *rawSignature
 }
 
 // Commit represents a Git commit object
@@ -25,7 +28,10 @@ type Commit struct {
 	Author    Signature
 	Committer Signature
 	Message   string
-	hash      hash.Hash
+	// GPGSignature is the commit's signature, stored in the gpgsig header.
+	// Git keeps OpenPGP and SSH signatures there alike.
+	GPGSignature string
+	hash         hash.Hash
 }
 
 // NewCommit creates a new commit object
@@ -96,6 +102,13 @@ func (c *Commit) Serialize(w io.Writer) error {
 		return err
 	}
 
+	// Write signature header, continued over indented lines
+	if c.GPGSignature != "" {
+		if _, err := fmt.Fprintf(w, "gpgsig %s\n", formatSignatureHeader(c.GPGSignature)); err != nil {
+			return err
+		}
+	}
+
 	// Write empty line before message
 	if _, err := w.Write([]byte("\n")); err != nil {
 		return err
@@ -182,6 +195,14 @@ func ParseCommit(data []byte) (*Commit, error) {
 			}
 			commit.Committer = sig
 
+		case "gpgsig":
+			signature := value + "\n"
+			for i+1 < len(lines) && strings.HasPrefix(lines[i+1], " ") {
+				i++
+				signature += lines[i][1:] + "\n"
+			}
+			commit.GPGSignature = signature
+
 		default:
 			// Ignore unknown headers for forward compatibility
 		}
@@ -197,6 +218,47 @@ func ParseCommit(data []byte) (*Commit, error) {
 	return commit, nil
 }
 
+// SigningPayload returns the content a commit signature covers: the
+// serialized commit without its gpgsig header
+func (c *Commit) SigningPayload() ([]byte, error) {
+	unsigned := *c
+	unsigned.GPGSignature = ""
+	var buf bytes.Buffer
+	if err := unsigned.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Sign signs the commit with signer and stores the signature in the
+// gpgsig header. The hash must be computed again afterwards.
+func (c *Commit) Sign(signer Signer) error {
+	payload, err := c.SigningPayload()
+	if err != nil {
+		return err
+	}
+	signature, err := signer.Sign(payload)
+	if err != nil {
+		return fmt.Errorf("failed to sign commit: %w", err)
+	}
+	if signature == "" {
+		return fmt.Errorf("failed to sign commit: empty signature")
+	}
+	c.GPGSignature = signature
+	return nil
+}
+
+// Validate strictly checks the author and committer lines
+func (c *Commit) Validate() error {
+	if err := c.Author.Validate(); err != nil {
+		return fmt.Errorf("invalid author: %w", err)
+	}
+	if err := c.Committer.Validate(); err != nil {
+		return fmt.Errorf("invalid committer: %w", err)
+	}
+	return nil
+}
+
 // ComputeHash computes and sets the hash of the commit using the given hasher
 func (c *Commit) ComputeHash(hasher hash.Hasher) error {
 	data, err := c.Bytes()
@@ -207,78 +269,94 @@ func (c *Commit) ComputeHash(hasher hash.Hasher) error {
 	return nil
 }
 
-// Format formats a signature as "Name <email> timestamp timezone"
+// Format formats a signature as "Name <email> timestamp timezone".
+// A parsed signature that was not in canonical form is returned exactly
+// as it was read, as long as its fields have not been modified.
 func (s *Signature) Format() string {
+	if s.raw != nil && s.raw.matches(s) {
+		return s.raw.line
+	}
+
 	timestamp := s.When.Unix()
 	_, offset := s.When.Zone()
-	offsetHours := offset / 3600
-	offsetMinutes := (offset % 3600) / 60
-	timezone := fmt.Sprintf("%+03d%02d", offsetHours, offsetMinutes)
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+	timezone := fmt.Sprintf("%c%02d%02d", sign, offset/3600, (offset%3600)/60)
 
 	return fmt.Sprintf("%s <%s> %d %s", s.Name, s.Email, timestamp, timezone)
 }
 
 // ParseSignature parses a signature from a string
 // Format: "Name <email> timestamp timezone"
+// Parsing is lenient so that real-world histories can be read: missing
+// email brackets, a missing date or odd timezone offsets such as
+// "+051800" are accepted and preserved. Use ValidateSignature to flag them.
 func ParseSignature(s string) (Signature, error) {
-	// Find email boundaries
-	emailStart := strings.Index(s, "<")
-	emailEnd := strings.Index(s, ">")
-
-	if emailStart == -1 || emailEnd == -1 || emailEnd <= emailStart {
-		return Signature{}, fmt.Errorf("invalid signature format: missing or malformed email")
+	if strings.ContainsAny(s, "\n\x00") {
+		return Signature{}, fmt.Errorf("invalid signature format: contains line break or null byte")
 	}
 
-	// Parse name (before email)
-	name := strings.TrimSpace(s[:emailStart])
+	var name, email string
+	var dateFields []string
 
-	// Parse email
-	email := s[emailStart+1 : emailEnd]
-
-	// Parse timestamp and timezone (after email)
-	remainder := strings.TrimSpace(s[emailEnd+1:])
-	parts := strings.Fields(remainder)
-
-	if len(parts) < 2 {
-		return Signature{}, fmt.Errorf("invalid signature format: missing timestamp or timezone")
+	// Find email boundaries
+	emailStart := strings.Index(s, "<")
+	emailEnd := -1
+	if emailStart != -1 {
+		if end := strings.Index(s[emailStart:], ">"); end != -1 {
+			emailEnd = emailStart + end
+		}
 	}
 
-	// Parse timestamp
-	timestamp, err := strconv.ParseInt(parts[0], 10, 64)
-	if err != nil {
-		return Signature{}, fmt.Errorf("invalid timestamp: %w", err)
-	}
+	if emailEnd != -1 {
+		name = strings.TrimSpace(s[:emailStart])
+		email = s[emailStart+1 : emailEnd]
+		dateFields = strings.Fields(s[emailEnd+1:])
+	} else {
+		// No email brackets: the date is taken from the trailing fields
+		fields := strings.Fields(s)
+		n := len(fields)
+		for n > 0 && len(fields)-n < 2 && isDateField(fields[n-1]) {
+			n--
+		}
+		dateFields = fields[n:]
 
-	// Parse timezone
-	timezone := parts[1]
-	if len(timezone) != 5 {
-		return Signature{}, fmt.Errorf("invalid timezone format: %s", timezone)
+		if n > 0 && strings.Contains(fields[n-1], "@") {
+			email = strings.Trim(fields[n-1], "<>")
+			n--
+		}
+		name = strings.Join(fields[:n], " ")
 	}
 
-	sign := 1
-	if timezone[0] == '-' {
-		sign = -1
+	// Parse timestamp and timezone, defaulting to the epoch in UTC
+	var timestamp int64
+	if len(dateFields) > 0 {
+		timestamp, _ = strconv.ParseInt(dateFields[0], 10, 64)
 	}
-
-	hours, err := strconv.Atoi(timezone[1:3])
-	if err != nil {
-		return Signature{}, fmt.Errorf("invalid timezone hours: %w", err)
+	offset := 0
+	if len(dateFields) > 1 {
+		offset = parseTimezone(dateFields[1])
 	}
 
-	minutes, err := strconv.Atoi(timezone[3:5])
-	if err != nil {
-		return Signature{}, fmt.Errorf("invalid timezone minutes: %w", err)
+	sig := Signature{
+		Name:  name,
+		Email: email,
+		When:  time.Unix(timestamp, 0).In(time.FixedZone("", offset)),
 	}
 
-	offset := sign * (hours*3600 + minutes*60)
-	location := time.FixedZone("", offset)
-	when := time.Unix(timestamp, 0).In(location)
+	if sig.Format() != s {
+		sig.raw = &rawSignature{
+			line:  s,
+			name:  sig.Name,
+			email: sig.Email,
+			when:  sig.When,
+		}
+	}
 
-	return Signature{
-		Name:  name,
-		Email: email,
-		When:  when,
-	}, nil
+	return sig, nil
 }
 
 // String returns a string representation of the signature
@@ -6,7 +6,7 @@ import (
 	"fmt"
 	"io"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
 )
 
 // Database is the interface for storing and retrieving Git objects
@@ -60,6 +60,40 @@ type Storage interface {
 	Close() error
 }
 
+// RawReader is implemented by storage that can read an object's type and
+// content directly, such as storage holding packed objects, which would
+// otherwise have to be compressed again only for Read
+type RawReader interface {
+	// ReadRaw reads the type and content of an object
+	ReadRaw(h hash.Hash) (Type, []byte, error)
+}
+
+// ReadRaw reads an object's type and content from any storage. Storage
+// that does not implement RawReader is read and decompressed.
+func ReadRaw(r Reader, h hash.Hash) (Type, []byte, error) {
+	if rr, ok := r.(RawReader); ok {
+		return rr.ReadRaw(h)
+	}
+
+	compressed, err := r.Read(h)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := Decompress(compressed)
+	if err != nil {
+		return "", nil, err
+	}
+	header, offset, err := ParseObjectHeader(data)
+	if err != nil {
+		return "", nil, err
+	}
+	content := data[offset:]
+	if int64(len(content)) != header.Size {
+		return "", nil, fmt.Errorf("object size mismatch: expected %d, got %d", header.Size, len(content))
+	}
+	return header.Type, content, nil
+}
+
 // Compress compresses object data using zlib
 func Compress(data []byte) ([]byte, error) {
 	var buf bytes.Buffer
@@ -109,9 +143,34 @@ func NewObjectDatabase(storage Storage, hasher hash.Hasher) *ObjectDatabase {
 
 // Get retrieves an object by its hash
 func (db *ObjectDatabase) Get(h hash.Hash) (Object, error) {
+	// Packed objects are read without a round trip through zlib
+	if rr, ok := db.storage.(RawReader); ok {
+		objType, content, err := rr.ReadRaw(h)
+		if err != nil {
+			if db.isEmptyTree(h) {
+				tree := NewTree()
+				tree.SetHash(h)
+				return tree, nil
+			}
+			return nil, fmt.Errorf("failed to read object: %w", err)
+		}
+
+		obj, err := ParseObject(objType, content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse object: %w", err)
+		}
+		obj.SetHash(h)
+		return obj, nil
+	}
+
 	// Read compressed data from storage
 	compressed, err := db.storage.Read(h)
 	if err != nil {
+		if db.isEmptyTree(h) {
+			tree := NewTree()
+			tree.SetHash(h)
+			return tree, nil
+		}
 		return nil, fmt.Errorf("failed to read object: %w", err)
 	}
 
@@ -135,33 +194,54 @@ func (db *ObjectDatabase) Get(h hash.Hash) (Object, error) {
 
 // Put stores an object and returns its hash
 func (db *ObjectDatabase) Put(obj Object) (hash.Hash, error) {
+	h, _, err := db.put(obj, true)
+	return h, err
+}
+
+// PutNew stores an object unless the database already has it, and
+// reports whether it was written
+func (db *ObjectDatabase) PutNew(obj Object) (hash.Hash, bool, error) {
+	return db.put(obj, false)
+}
+
+// put hashes and stores an object, overwriting an existing copy only if
+// overwrite is set, and reports whether it was written
+func (db *ObjectDatabase) put(obj Object, overwrite bool) (hash.Hash, bool, error) {
 	// Serialize object
 	data, err := serializeObject(obj)
 	if err != nil {
-		return nil, fmt.Errorf("failed to serialize object: %w", err)
+		return nil, false, fmt.Errorf("failed to serialize object: %w", err)
 	}
 
 	// Compute hash
 	h := db.hasher.Hash(data)
 	obj.SetHash(h)
+	if !overwrite && db.Has(h) {
+		return h, false, nil
+	}
 
 	// Compress
 	compressed, err := Compress(data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to compress object: %w", err)
+		return nil, false, fmt.Errorf("failed to compress object: %w", err)
 	}
 
 	// Write to storage
 	if err := db.storage.Write(h, compressed); err != nil {
-		return nil, fmt.Errorf("failed to write object: %w", err)
+		return nil, false, fmt.Errorf("failed to write object: %w", err)
 	}
 
-	return h, nil
+	return h, true, nil
 }
 
-// Has checks if an object exists
+// Has checks if an object exists. The empty tree always does.
 func (db *ObjectDatabase) Has(h hash.Hash) bool {
-	return db.storage.Has(h)
+	return db.storage.Has(h) || db.isEmptyTree(h)
+}
+
+// isEmptyTree reports whether h names the empty tree
+func (db *ObjectDatabase) isEmptyTree(h hash.Hash) bool {
+	return db.hasher != nil && h.Equals(EmptyTreeHash(db.hasher))
 }
 
 // Delete removes an object
@@ -200,19 +280,10 @@ func GetType(data []byte) (Type, error) {
 		}
 	}
 
-	// Parse header to get type
-	headerEnd := bytes.IndexByte(decompressed, 0)
-	if headerEnd == -1 {
-		return "", fmt.Errorf("invalid object: missing null byte in header")
-	}
-
-	header := string(decompressed[:headerEnd])
-	var objType string
-	var size int64
-	_, err := fmt.Sscanf(header, "%s %d", &objType, &size)
+	header, _, err := ParseObjectHeader(decompressed)
 	if err != nil {
-		return "", fmt.Errorf("invalid object header: %w", err)
+		return "", err
 	}
 
-	return ParseType(objType)
+	return header.Type, nil
 }
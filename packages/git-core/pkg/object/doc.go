@@ -0,0 +1,23 @@
+// Package object implements Git's object model: blobs, trees, commits and
+// annotated tags, their serialization and zlib compression, and the
+// object database that stores them.
+//
+// Objects are built with the New* constructors or parsed from their
+// serialized content with the Parse* functions. [ObjectDatabase] stores
+// them through a [Storage] backend, keyed by hash:
+//
+//	db := object.NewObjectDatabase(storage, hasher)
+//	id, err := db.Put(object.NewBlob([]byte("hello\n")))
+//
+// # Stability
+//
+// The following are frozen: they keep their names and signatures for all
+// v0.x and v1 releases. Everything else may change in a minor release.
+//
+//   - the [Object], [Database] and [Storage] interfaces
+//   - [Type] with [BlobType], [TreeType], [CommitType] and [TagType]
+//   - [Blob], [Tree], [TreeEntry], [Commit], [Tag], [Signature] and [FileMode]
+//   - [NewBlob], [NewTree], [NewCommit], [NewTag]
+//   - [ParseBlob], [ParseTree], [ParseCommit], [ParseTag] and [ParseObject]
+//   - [NewObjectDatabase], [Compress] and [Decompress]
+package object
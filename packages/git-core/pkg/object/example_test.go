@@ -0,0 +1,67 @@
+package object_test
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// Build the objects for a one-file commit and compute their hashes
+func ExampleNewCommit() {
+	hasher := hash.NewSHA1()
+
+	blob := object.NewBlob([]byte("hello\n"))
+	if err := blob.ComputeHash(hasher); err != nil {
+		log.Fatal(err)
+	}
+
+	tree := object.NewTree()
+	tree.AddEntryWithMode(object.ModeRegular, "hello.txt", blob.Hash())
+	if err := tree.ComputeHash(hasher); err != nil {
+		log.Fatal(err)
+	}
+
+	author := object.Signature{
+		Name:  "Ada Lovelace",
+		Email: "ada@example.com",
+		When:  time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+	}
+	commit := object.NewCommit()
+	commit.Tree = tree.Hash()
+	commit.Author = author
+	commit.Committer = author
+	commit.Message = "Add hello.txt\n"
+	if err := commit.ComputeHash(hasher); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("blob  ", blob.Hash())
+	fmt.Println("tree  ", tree.Hash())
+	fmt.Println("commit", commit.Hash())
+	// Output:
+	// blob   ce013625030ba8dba906f756967f9e9ca394464a
+	// tree   aaa96ced2d9a1c8e72c56b253a0e2fe78393feb7
+	// commit 786f00519410d885c4ffa876dc7d7bbb60f3f7b5
+}
+
+// Parse a serialized commit
+func ExampleParseCommit() {
+	data := []byte("tree aaa96ced2d9a1c8e72c56b253a0e2fe78393feb7\n" +
+		"author Ada Lovelace <ada@example.com> 1704110400 +0000\n" +
+		"committer Ada Lovelace <ada@example.com> 1704110400 +0000\n" +
+		"\n" +
+		"Add hello.txt\n")
+
+	commit, err := object.ParseCommit(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(commit.Author.Name, commit.Author.When.UTC().Format(time.RFC3339))
+	fmt.Print(commit.Message)
+	// Output:
+	// Ada Lovelace 2024-01-01T12:00:00Z
+	// Add hello.txt
+}
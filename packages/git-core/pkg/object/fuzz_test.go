@@ -0,0 +1,79 @@
+package object
+
+import (
+	"testing"
+)
+
+func FuzzParseCommit(f *testing.F) {
+	f.Add([]byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"parent 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"author A U Thor <author@example.com> 1700000000 +0100\n" +
+		"committer C O Mitter <committer@example.com> 1700000000 -0530\n" +
+		"\nMessage\n"))
+	f.Add([]byte("author <> 99999999999999999999 +99999\n\n"))
+	f.Add([]byte("committer Name <email 1 +0000\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		commit, err := ParseCommit(data)
+		if err != nil {
+			return
+		}
+		// Anything parsed must serialize again
+		if _, err := commit.Bytes(); err != nil {
+			t.Fatalf("Bytes() error on parsed commit: %v", err)
+		}
+	})
+}
+
+func FuzzParseTree(f *testing.F) {
+	tree := NewTree()
+	tree.AddEntry(TreeEntry{Mode: ModeRegular, Name: "file.txt", Hash: make([]byte, 20)})
+	tree.AddEntry(TreeEntry{Mode: ModeDir, Name: "dir", Hash: make([]byte, 20)})
+	data, err := tree.Bytes()
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(data)
+	f.Add([]byte("100644 a\x00short"))
+	f.Add([]byte("777777777777 a\x00"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tree, err := ParseTree(data)
+		if err != nil {
+			return
+		}
+		if _, err := tree.Bytes(); err != nil {
+			t.Fatalf("Bytes() error on parsed tree: %v", err)
+		}
+	})
+}
+
+func FuzzParseTag(f *testing.F) {
+	f.Add([]byte("object 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"type commit\n" +
+		"tag v1.0\n" +
+		"tagger T Agger <tagger@example.com> 1700000000 +0000\n" +
+		"\nRelease\n"))
+	f.Add([]byte("type nope\n\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tag, err := ParseTag(data)
+		if err != nil {
+			return
+		}
+		if _, err := tag.Bytes(); err != nil {
+			t.Fatalf("Bytes() error on parsed tag: %v", err)
+		}
+	})
+}
+
+func FuzzParseObjectWithHeader(f *testing.F) {
+	f.Add([]byte("blob 5\x00hello"))
+	f.Add([]byte("tree 0\x00"))
+	f.Add([]byte("commit 99999999999999999999\x00"))
+	f.Add([]byte("blob -1\x00"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ParseObjectWithHeader(data)
+	})
+}
@@ -0,0 +1,180 @@
+package object
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// maxHeaderLen bounds the header scan: the longest type name, a space,
+// a 64-bit decimal size and the terminating null byte
+const maxHeaderLen = 32
+
+// ObjectHeader holds the type and content size from an object's
+// "<type> <size>\0" header
+type ObjectHeader struct {
+	Type Type
+	Size int64
+}
+
+// HeaderReader is implemented by databases that can read an object's
+// header without decoding its content
+type HeaderReader interface {
+	// GetHeader retrieves the header of an object by its hash
+	GetHeader(h hash.Hash) (ObjectHeader, error)
+}
+
+// ParseObjectHeader parses the header of an uncompressed object and
+// returns it along with the offset at which the content starts
+func ParseObjectHeader(data []byte) (ObjectHeader, int, error) {
+	limit := len(data)
+	if limit > maxHeaderLen {
+		limit = maxHeaderLen
+	}
+
+	headerEnd := bytes.IndexByte(data[:limit], 0)
+	if headerEnd == -1 {
+		return ObjectHeader{}, 0, fmt.Errorf("invalid object: missing null byte in header")
+	}
+
+	header, err := parseHeader(string(data[:headerEnd]))
+	if err != nil {
+		return ObjectHeader{}, 0, err
+	}
+
+	return header, headerEnd + 1, nil
+}
+
+// ReadObjectHeader reads just the header from an uncompressed object
+// stream, leaving the reader positioned at the start of the content
+func ReadObjectHeader(r io.Reader) (ObjectHeader, error) {
+	var buf [maxHeaderLen]byte
+	for i := 0; i < len(buf); i++ {
+		if _, err := io.ReadFull(r, buf[i:i+1]); err != nil {
+			return ObjectHeader{}, fmt.Errorf("failed to read object header: %w", err)
+		}
+		if buf[i] == 0 {
+			return parseHeader(string(buf[:i]))
+		}
+	}
+
+	return ObjectHeader{}, fmt.Errorf("invalid object: missing null byte in header")
+}
+
+// parseHeader parses the "<type> <size>" part of an object header
+func parseHeader(header string) (ObjectHeader, error) {
+	typeName, sizeStr, found := strings.Cut(header, " ")
+	if !found {
+		return ObjectHeader{}, fmt.Errorf("invalid object header: %q", header)
+	}
+
+	objType, err := ParseType(typeName)
+	if err != nil {
+		return ObjectHeader{}, fmt.Errorf("invalid object header: %w", err)
+	}
+
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil || size < 0 {
+		return ObjectHeader{}, fmt.Errorf("invalid object size in header: %q", sizeStr)
+	}
+
+	return ObjectHeader{Type: objType, Size: size}, nil
+}
+
+// GetHeader retrieves an object's header, decompressing only as much
+// data as the header needs
+func (db *ObjectDatabase) GetHeader(h hash.Hash) (ObjectHeader, error) {
+	if rr, ok := db.storage.(RawReader); ok {
+		objType, content, err := rr.ReadRaw(h)
+		if err != nil {
+			if db.isEmptyTree(h) {
+				return ObjectHeader{Type: TreeType, Size: 0}, nil
+			}
+			return ObjectHeader{}, fmt.Errorf("failed to read object: %w", err)
+		}
+		return ObjectHeader{Type: objType, Size: int64(len(content))}, nil
+	}
+
+	compressed, err := db.storage.Read(h)
+	if err != nil {
+		if db.isEmptyTree(h) {
+			return ObjectHeader{Type: TreeType, Size: 0}, nil
+		}
+		return ObjectHeader{}, fmt.Errorf("failed to read object: %w", err)
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return ObjectHeader{}, fmt.Errorf("failed to create decompressor: %w", err)
+	}
+	defer r.Close()
+
+	return ReadObjectHeader(r)
+}
+
+// GetHeader retrieves an object's header from any database. Databases
+// that do not implement HeaderReader fall back to loading the object.
+func GetHeader(db Database, h hash.Hash) (ObjectHeader, error) {
+	if hr, ok := db.(HeaderReader); ok {
+		return hr.GetHeader(h)
+	}
+
+	obj, err := db.Get(h)
+	if err != nil {
+		return ObjectHeader{}, err
+	}
+
+	return ObjectHeader{Type: obj.Type(), Size: obj.Size()}, nil
+}
+
+// LazyObject is an object whose header has been read but whose content
+// is only loaded from the database on first use
+type LazyObject struct {
+	ObjectHeader
+
+	hash hash.Hash
+	db   Database
+	obj  Object
+}
+
+// GetLazy reads an object's header and defers loading its content
+func GetLazy(db Database, h hash.Hash) (*LazyObject, error) {
+	header, err := GetHeader(db, h)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LazyObject{
+		ObjectHeader: header,
+		hash:         h,
+		db:           db,
+	}, nil
+}
+
+// Hash returns the hash of the object
+func (o *LazyObject) Hash() hash.Hash {
+	return o.hash
+}
+
+// Load loads and parses the object content, caching the result
+func (o *LazyObject) Load() (Object, error) {
+	if o.obj != nil {
+		return o.obj, nil
+	}
+
+	obj, err := o.db.Get(o.hash)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Type() != o.Type {
+		return nil, fmt.Errorf("object %s changed type from %s to %s", o.hash.String(), o.Type, obj.Type())
+	}
+
+	o.obj = obj
+	return obj, nil
+}
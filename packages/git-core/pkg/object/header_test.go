@@ -0,0 +1,159 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// mapStorage is a minimal in-memory Storage for database tests
+type mapStorage map[string][]byte
+
+func (s mapStorage) Read(h hash.Hash) ([]byte, error) {
+	data, ok := s[h.String()]
+	if !ok {
+		return nil, fmt.Errorf("object not found: %s", h.String())
+	}
+	return data, nil
+}
+
+func (s mapStorage) Has(h hash.Hash) bool {
+	_, ok := s[h.String()]
+	return ok
+}
+
+func (s mapStorage) Write(h hash.Hash, data []byte) error {
+	s[h.String()] = data
+	return nil
+}
+
+func (s mapStorage) Delete(h hash.Hash) error {
+	delete(s, h.String())
+	return nil
+}
+
+func (s mapStorage) List() ([]hash.Hash, error) {
+	hashes := make([]hash.Hash, 0, len(s))
+	for key := range s {
+		h, err := hash.ParseHash(key)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, h)
+	}
+	return hashes, nil
+}
+
+func (s mapStorage) Close() error {
+	return nil
+}
+
+// TestParseObjectHeader tests parsing headers from raw object data
+func TestParseObjectHeader(t *testing.T) {
+	header, offset, err := ParseObjectHeader([]byte("commit 42\x00tree ..."))
+	if err != nil {
+		t.Fatalf("ParseObjectHeader failed: %v", err)
+	}
+	if header.Type != CommitType || header.Size != 42 {
+		t.Errorf("Unexpected header: %+v", header)
+	}
+	if offset != 10 {
+		t.Errorf("Expected content offset 10, got %d", offset)
+	}
+
+	invalid := []string{
+		"blob 5",
+		"blob\x00hello",
+		"bogus 5\x00hello",
+		"blob -1\x00",
+		"blob five\x00hello",
+		"blob 123456789012345678901234567890\x00",
+	}
+	for _, data := range invalid {
+		if _, _, err := ParseObjectHeader([]byte(data)); err == nil {
+			t.Errorf("Expected error for %q", data)
+		}
+	}
+}
+
+// TestReadObjectHeader tests that only the header is consumed from a stream
+func TestReadObjectHeader(t *testing.T) {
+	r := bytes.NewReader([]byte("blob 11\x00hello world"))
+
+	header, err := ReadObjectHeader(r)
+	if err != nil {
+		t.Fatalf("ReadObjectHeader failed: %v", err)
+	}
+	if header.Type != BlobType || header.Size != 11 {
+		t.Errorf("Unexpected header: %+v", header)
+	}
+	if r.Len() != 11 {
+		t.Errorf("Expected content to remain unread, %d bytes left", r.Len())
+	}
+
+	if _, err := ReadObjectHeader(bytes.NewReader([]byte("blob 11"))); err == nil {
+		t.Error("Expected error for truncated header")
+	}
+}
+
+// TestGetHeaderSkipsContent tests that headers are read without decoding the body
+func TestGetHeaderSkipsContent(t *testing.T) {
+	storage := mapStorage{}
+	db := NewObjectDatabase(storage, hash.NewSHA1())
+
+	content := make([]byte, 256*1024)
+	rand.New(rand.NewSource(1)).Read(content)
+	h, err := db.Put(NewBlob(content))
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	// Truncate the stored data so the full object can no longer be decoded
+	storage[h.String()] = storage[h.String()][:len(storage[h.String()])/2]
+
+	if _, err := db.Get(h); err == nil {
+		t.Fatal("Expected Get to fail on truncated object")
+	}
+
+	header, err := db.GetHeader(h)
+	if err != nil {
+		t.Fatalf("GetHeader failed: %v", err)
+	}
+	if header.Type != BlobType || header.Size != int64(len(content)) {
+		t.Errorf("Unexpected header: %+v", header)
+	}
+}
+
+// TestGetLazy tests deferred loading of object content
+func TestGetLazy(t *testing.T) {
+	db := NewObjectDatabase(mapStorage{}, hash.NewSHA1())
+
+	h, err := db.Put(NewBlob([]byte("lazy content")))
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	lazy, err := GetLazy(db, h)
+	if err != nil {
+		t.Fatalf("GetLazy failed: %v", err)
+	}
+	if lazy.Type != BlobType || lazy.Size != 12 || !lazy.Hash().Equals(h) {
+		t.Errorf("Unexpected lazy object: %+v", lazy.ObjectHeader)
+	}
+
+	obj, err := lazy.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	blob, ok := obj.(*Blob)
+	if !ok || string(blob.Content()) != "lazy content" {
+		t.Errorf("Unexpected loaded object: %v", obj)
+	}
+
+	if _, err := GetLazy(db, hash.NewSHA1().Hash([]byte("missing"))); err == nil {
+		t.Error("Expected error for missing object")
+	}
+}
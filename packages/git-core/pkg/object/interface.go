@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"io"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
 )
 
 // Type represents the type of a Git object
@@ -60,35 +60,18 @@ func ParseObject(objType Type, data []byte) (Object, error) {
 
 // ParseObjectWithHeader parses a Git object from data that includes the header
 func ParseObjectWithHeader(data []byte) (Object, error) {
-	// Parse header: "<type> <size>\0"
-	headerEnd := -1
-	for i := 0; i < len(data); i++ {
-		if data[i] == 0 {
-			headerEnd = i
-			break
-		}
-	}
-
-	if headerEnd == -1 {
-		return nil, fmt.Errorf("invalid object: missing null byte in header")
-	}
-
-	// Parse type and size from header
-	header := string(data[:headerEnd])
-	var objType string
-	var size int64
-	_, err := fmt.Sscanf(header, "%s %d", &objType, &size)
+	header, offset, err := ParseObjectHeader(data)
 	if err != nil {
-		return nil, fmt.Errorf("invalid object header: %w", err)
+		return nil, err
 	}
 
 	// Extract content
-	content := data[headerEnd+1:]
-	if int64(len(content)) != size {
-		return nil, fmt.Errorf("object size mismatch: expected %d, got %d", size, len(content))
+	content := data[offset:]
+	if int64(len(content)) != header.Size {
+		return nil, fmt.Errorf("object size mismatch: expected %d, got %d", header.Size, len(content))
 	}
 
-	return ParseObject(Type(objType), content)
+	return ParseObject(header.Type, content)
 }
 
 // IsValidType checks if a type string is a valid Git object type
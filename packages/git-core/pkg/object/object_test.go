@@ -5,7 +5,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
 )
 
 // TestBlobBasic tests basic blob functionality
@@ -150,6 +150,36 @@ func TestTreeSorting(t *testing.T) {
 	}
 }
 
+// TestEmptyTree tests that the empty tree is always present
+func TestEmptyTree(t *testing.T) {
+	if h := EmptyTreeHash(hash.NewSHA1()); h.String() != "4b825dc642cb6eb9a060e54bf8d69288fbee4904" {
+		t.Errorf("Unexpected SHA-1 empty tree %s", h)
+	}
+	if h := EmptyTreeHash(hash.NewSHA256()); h.String() != "6ef19b41225c5369f1c104d45d8d85efa9b057b53b14b4b9b939dd74decc5321" {
+		t.Errorf("Unexpected SHA-256 empty tree %s", h)
+	}
+
+	db := NewObjectDatabase(mapStorage{}, hash.NewSHA1())
+	empty := EmptyTreeHash(hash.NewSHA1())
+	if !db.Has(empty) {
+		t.Error("Expected the empty tree to be present without being stored")
+	}
+
+	obj, err := db.Get(empty)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	tree, ok := obj.(*Tree)
+	if !ok || len(tree.Entries()) != 0 || !tree.Hash().Equals(empty) {
+		t.Errorf("Expected an empty tree, got %#v", obj)
+	}
+
+	header, err := GetHeader(db, empty)
+	if err != nil || header.Type != TreeType || header.Size != 0 {
+		t.Errorf("Unexpected empty tree header %+v (%v)", header, err)
+	}
+}
+
 // TestCommitBasic tests basic commit functionality
 func TestCommitBasic(t *testing.T) {
 	commit := NewCommit()
@@ -396,3 +426,39 @@ func TestFileModeValidation(t *testing.T) {
 		t.Errorf("Mode %o should be invalid", invalidMode)
 	}
 }
+
+// TestParseFileMode tests parsing canonical mode strings
+func TestParseFileMode(t *testing.T) {
+	tests := map[string]FileMode{
+		"100644": ModeRegular,
+		"100755": ModeExecutable,
+		"040000": ModeDir,
+		"40000":  ModeDir,
+		"120000": ModeSymlink,
+		"160000": ModeGitlink,
+	}
+	for s, expected := range tests {
+		mode, err := ParseFileMode(s)
+		if err != nil {
+			t.Errorf("ParseFileMode(%q) failed: %v", s, err)
+			continue
+		}
+		if mode != expected {
+			t.Errorf("ParseFileMode(%q) = %o, expected %o", s, mode, expected)
+		}
+	}
+
+	for _, s := range []string{"", "0644", "644", "100664", "33188", "100644 ", "abc"} {
+		if _, err := ParseFileMode(s); err == nil {
+			t.Errorf("Expected error for mode %q", s)
+		}
+	}
+
+	// String output round-trips through the parser
+	for _, mode := range []FileMode{ModeDir, ModeRegular, ModeExecutable, ModeSymlink, ModeGitlink} {
+		parsed, err := ParseFileMode(mode.String())
+		if err != nil || parsed != mode {
+			t.Errorf("Mode %s did not round-trip: %o, %v", mode, parsed, err)
+		}
+	}
+}
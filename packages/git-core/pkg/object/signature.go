@@ -0,0 +1,109 @@
+package object
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rawSignature is a signature line as read from an existing object
+type rawSignature struct {
+	line  string
+	name  string
+	email string
+	when  time.Time
+}
+
+// matches reports whether a signature still holds the parsed values
+func (r *rawSignature) matches(s *Signature) bool {
+	if r.name != s.Name || r.email != s.Email || !r.when.Equal(s.When) {
+		return false
+	}
+
+	_, rawOffset := r.when.Zone()
+	_, offset := s.When.Zone()
+	return rawOffset == offset
+}
+
+// isDateField reports whether a field looks like a timestamp or timezone
+func isDateField(field string) bool {
+	digits := strings.TrimLeft(field, "+-")
+	if digits == "" || len(field)-len(digits) > 1 {
+		return false
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTimezone converts a "+hhmm" style offset to seconds east of UTC.
+// Like Git, malformed offsets are read as a plain number of hhmm.
+func parseTimezone(tz string) int {
+	sign := 1
+	switch {
+	case strings.HasPrefix(tz, "-"):
+		sign = -1
+		tz = tz[1:]
+	case strings.HasPrefix(tz, "+"):
+		tz = tz[1:]
+	}
+
+	n, err := strconv.Atoi(tz)
+	if err != nil {
+		return 0
+	}
+
+	return sign * ((n/100)*3600 + (n%100)*60)
+}
+
+// ValidateSignature strictly checks a signature line against the format
+// Git writes, "Name <email> timestamp +hhmm", reporting the first problem
+// found. Objects that fail this check can still be parsed and stored.
+func ValidateSignature(s string) error {
+	emailStart := strings.Index(s, "<")
+	if emailStart == -1 {
+		return fmt.Errorf("missing email")
+	}
+	if strings.Contains(s[:emailStart], ">") {
+		return fmt.Errorf("bad name")
+	}
+	if emailStart == 0 || s[emailStart-1] != ' ' {
+		return fmt.Errorf("missing space before email")
+	}
+
+	end := strings.Index(s[emailStart+1:], ">")
+	if end == -1 || strings.Contains(s[emailStart+1:emailStart+1+end], "<") {
+		return fmt.Errorf("bad email")
+	}
+
+	rest := s[emailStart+end+2:]
+	if !strings.HasPrefix(rest, " ") {
+		return fmt.Errorf("missing space before date")
+	}
+
+	date, tz, found := strings.Cut(rest[1:], " ")
+	if !found || date == "" || !isDateField(date) || strings.ContainsAny(date, "+-") {
+		return fmt.Errorf("bad date")
+	}
+	if len(date) > 1 && date[0] == '0' {
+		return fmt.Errorf("zero-padded date")
+	}
+	if _, err := strconv.ParseInt(date, 10, 64); err != nil {
+		return fmt.Errorf("date overflow")
+	}
+
+	if len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') || !isDateField(tz) {
+		return fmt.Errorf("bad timezone %q", tz)
+	}
+
+	return nil
+}
+
+// Validate strictly checks a parsed signature, as written back out
+func (s *Signature) Validate() error {
+	return ValidateSignature(s.Format())
+}
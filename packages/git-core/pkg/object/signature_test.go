@@ -0,0 +1,146 @@
+package object
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseSignatureLenient tests that real-world signature lines parse and round-trip
+func TestParseSignatureLenient(t *testing.T) {
+	tests := []struct {
+		line   string
+		name   string
+		email  string
+		unix   int64
+		offset int
+	}{
+		{"A U Thor <author@example.com> 1234567890 +0100", "A U Thor", "author@example.com", 1234567890, 3600},
+		{"A U Thor <author@example.com> 1234567890 -0130", "A U Thor", "author@example.com", 1234567890, -5400},
+		{"A U Thor author@example.com 1234567890 +0000", "A U Thor", "author@example.com", 1234567890, 0},
+		{"A U Thor 1234567890 +0000", "A U Thor", "", 1234567890, 0},
+		{"A U Thor <author@example.com> 1234567890 +051800", "A U Thor", "author@example.com", 1234567890, 518 * 3600},
+		{"A U Thor <author@example.com> 1234567890 -0000", "A U Thor", "author@example.com", 1234567890, 0},
+		{"A U Thor <author@example.com>", "A U Thor", "author@example.com", 0, 0},
+		{"A U Thor<author@example.com>  1234567890  +0000", "A U Thor", "author@example.com", 1234567890, 0},
+		{"<> 0 +0000", "", "", 0, 0},
+		{"", "", "", 0, 0},
+	}
+
+	for _, tt := range tests {
+		sig, err := ParseSignature(tt.line)
+		if err != nil {
+			t.Errorf("ParseSignature(%q) failed: %v", tt.line, err)
+			continue
+		}
+
+		_, offset := sig.When.Zone()
+		if sig.Name != tt.name || sig.Email != tt.email || sig.When.Unix() != tt.unix || offset != tt.offset {
+			t.Errorf("ParseSignature(%q) = %q %q %d %d", tt.line, sig.Name, sig.Email, sig.When.Unix(), offset)
+		}
+		if sig.Format() != tt.line {
+			t.Errorf("Format() = %q, expected unchanged %q", sig.Format(), tt.line)
+		}
+	}
+
+	if _, err := ParseSignature("A <a@example.com> 1\n2 +0000"); err == nil {
+		t.Error("Expected error for embedded line break")
+	}
+}
+
+// TestSignatureModifiedAfterParse tests that edited signatures are written canonically
+func TestSignatureModifiedAfterParse(t *testing.T) {
+	sig, err := ParseSignature("A U Thor author@example.com 1234567890 +0000")
+	if err != nil {
+		t.Fatalf("ParseSignature failed: %v", err)
+	}
+
+	sig.Email = "new@example.com"
+	if got := sig.Format(); got != "A U Thor <new@example.com> 1234567890 +0000" {
+		t.Errorf("Format() = %q", got)
+	}
+
+	sig, _ = ParseSignature("A U Thor <author@example.com> 1234567890 +051800")
+	sig.When = sig.When.In(time.UTC)
+	if got := sig.Format(); got != "A U Thor <author@example.com> 1234567890 +0000" {
+		t.Errorf("Format() = %q", got)
+	}
+}
+
+// TestValidateSignature tests strict signature checks
+func TestValidateSignature(t *testing.T) {
+	if err := ValidateSignature("A U Thor <author@example.com> 1234567890 +0100"); err != nil {
+		t.Errorf("Expected valid signature, got %v", err)
+	}
+
+	invalid := map[string]string{
+		"A U Thor author@example.com 1234567890 +0000":             "missing email",
+		"A U Thor<author@example.com> 1234567890 +0000":            "missing space before email",
+		"A > Thor <author@example.com> 1234567890 +0000":           "bad name",
+		"A U Thor <author<@example.com> 1234567890 +0000":          "bad email",
+		"A U Thor <author@example.com>1234567890 +0000":            "missing space before date",
+		"A U Thor <author@example.com> +0000":                      "bad date",
+		"A U Thor <author@example.com> 01234567890 +0000":          "zero-padded date",
+		"A U Thor <author@example.com> 99999999999999999999 +0000": "date overflow",
+		"A U Thor <author@example.com> 1234567890 +051800":         "bad timezone",
+		"A U Thor <author@example.com> 1234567890":                 "bad date",
+	}
+	for line, problem := range invalid {
+		err := ValidateSignature(line)
+		if err == nil || !strings.Contains(err.Error(), problem) {
+			t.Errorf("ValidateSignature(%q) = %v, expected %q", line, err, problem)
+		}
+	}
+}
+
+// TestCommitPreservesSignatureBytes tests that commits with unusual signatures re-serialize unchanged
+func TestCommitPreservesSignatureBytes(t *testing.T) {
+	data := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"author Linus Torvalds torvalds@ppc970.osdl.org 1112911993 -0700\n" +
+		"committer Linus Torvalds <torvalds@ppc970.osdl.org> 1112911993 +051800\n" +
+		"\nInitial revision\n"
+
+	commit, err := ParseCommit([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseCommit failed: %v", err)
+	}
+
+	var buf strings.Builder
+	if err := commit.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	if buf.String() != data {
+		t.Errorf("Serialized commit changed:\n%q\n%q", buf.String(), data)
+	}
+
+	if err := commit.Validate(); err == nil || !strings.Contains(err.Error(), "author") {
+		t.Errorf("Expected invalid author, got %v", err)
+	}
+}
+
+// TestTagWithoutTagger tests that old tags without a tagger line round-trip
+func TestTagWithoutTagger(t *testing.T) {
+	data := "object 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"type tree\n" +
+		"tag v0.1\n" +
+		"\nold tag\n"
+
+	tag, err := ParseTag([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseTag failed: %v", err)
+	}
+	if tag.HasTagger() {
+		t.Error("Tag should have no tagger")
+	}
+
+	var buf strings.Builder
+	if err := tag.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	if buf.String() != data {
+		t.Errorf("Serialized tag changed:\n%q\n%q", buf.String(), data)
+	}
+	if err := tag.Validate(); err != nil {
+		t.Errorf("Tag without tagger should validate, got %v", err)
+	}
+}
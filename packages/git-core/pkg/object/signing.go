@@ -0,0 +1,102 @@
+package object
+
+import "strings"
+
+// Signer produces a detached signature over an object's signing payload,
+// such as an ASCII-armored OpenPGP signature or an SSH signature. The
+// signature is embedded in the object exactly as returned.
+type Signer interface {
+	Sign(payload []byte) (string, error)
+}
+
+// SignerFunc adapts a function to the Signer interface
+type SignerFunc func(payload []byte) (string, error)
+
+// Sign calls f(payload)
+func (f SignerFunc) Sign(payload []byte) (string, error) {
+	return f(payload)
+}
+
+// Verification is a verifier's verdict on a signature
+type Verification struct {
+	// Valid reports whether the signature is good for the payload
+	Valid bool
+	// Signer identifies who made the signature, such as "Name <email>"
+	Signer string
+	// KeyID is the signing key's ID or fingerprint
+	KeyID string
+	// Trust is the verifier's trust in the key, such as "ultimate" or
+	// "undefined". Empty when the verifier has no notion of trust.
+	Trust string
+}
+
+// Verifier checks a detached signature over an object's signing payload.
+// An error means the signature could not be checked at all, such as when
+// the key is unknown; a checked but bad signature is not an error.
+type Verifier interface {
+	Verify(payload []byte, signature string) (Verification, error)
+}
+
+// VerifierFunc adapts a function to the Verifier interface
+type VerifierFunc func(payload []byte, signature string) (Verification, error)
+
+// Verify calls f(payload, signature)
+func (f VerifierFunc) Verify(payload []byte, signature string) (Verification, error) {
+	return f(payload, signature)
+}
+
+// SignatureFormat names the format of a signature by its first line:
+// "openpgp", "x509" or "ssh". Unknown formats return "".
+func SignatureFormat(signature string) string {
+	switch {
+	case strings.HasPrefix(signature, "-----BEGIN PGP SIGNATURE-----"),
+		strings.HasPrefix(signature, "-----BEGIN PGP MESSAGE-----"):
+		return "openpgp"
+	case strings.HasPrefix(signature, "-----BEGIN SIGNED MESSAGE-----"):
+		return "x509"
+	case strings.HasPrefix(signature, "-----BEGIN SSH SIGNATURE-----"):
+		return "ssh"
+	default:
+		return ""
+	}
+}
+
+// signaturePrefixes are the first lines of the signature formats Git
+// recognises at the end of a tag message
+var signaturePrefixes = []string{
+	"-----BEGIN PGP SIGNATURE-----",
+	"-----BEGIN PGP MESSAGE-----",
+	"-----BEGIN SIGNED MESSAGE-----",
+	"-----BEGIN SSH SIGNATURE-----",
+}
+
+// splitSignature splits a tag message from the signature appended to it.
+// Like Git, the signature starts at the last line that opens one of the
+// recognised formats.
+func splitSignature(message string) (string, string) {
+	start := -1
+	for pos := 0; pos < len(message); {
+		line := message[pos:]
+		for _, prefix := range signaturePrefixes {
+			if strings.HasPrefix(line, prefix) {
+				start = pos
+				break
+			}
+		}
+		next := strings.IndexByte(line, '\n')
+		if next == -1 {
+			break
+		}
+		pos += next + 1
+	}
+	if start == -1 {
+		return message, ""
+	}
+	return message[:start], message[start:]
+}
+
+// formatSignatureHeader formats a signature as the value of a multi-line
+// header, with every line after the first indented by a space
+func formatSignatureHeader(signature string) string {
+	return strings.ReplaceAll(strings.TrimSuffix(signature, "\n"), "\n", "\n ")
+}
@@ -0,0 +1,140 @@
+package object
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// testSignature is an armored signature, blank line included, as gpg
+// writes it
+const testSignature = "-----BEGIN PGP SIGNATURE-----\n\niQEzBAABCAAdFiEE\n=abcd\n-----END PGP SIGNATURE-----\n"
+
+// recordingSigner returns testSignature and keeps the payload it signed
+type recordingSigner struct {
+	payload []byte
+}
+
+func (s *recordingSigner) Sign(payload []byte) (string, error) {
+	s.payload = payload
+	return testSignature, nil
+}
+
+// TestSignCommit tests that a signed commit stores its signature in the
+// gpgsig header and round-trips to the same hash
+func TestSignCommit(t *testing.T) {
+	hasher := hash.NewSHA1()
+	commit := NewCommit()
+	commit.Tree = EmptyTreeHash(hasher)
+	commit.Author = Signature{Name: "Alice", Email: "alice@example.com", When: time.Unix(1700000000, 0).UTC()}
+	commit.Committer = commit.Author
+	commit.Message = "Signed\n"
+
+	unsigned, err := commit.SigningPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer := &recordingSigner{}
+	if err := commit.Sign(signer); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if !bytes.Equal(signer.payload, unsigned) {
+		t.Error("Expected the unsigned commit to be signed")
+	}
+
+	var buf bytes.Buffer
+	if err := commit.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "committer Alice <alice@example.com> 1700000000 +0000\n" +
+		"gpgsig -----BEGIN PGP SIGNATURE-----\n \n iQEzBAABCAAdFiEE\n =abcd\n -----END PGP SIGNATURE-----\n" +
+		"\nSigned\n"
+	if !strings.HasSuffix(buf.String(), want) {
+		t.Errorf("Unexpected signed commit:\n%s", buf.String())
+	}
+
+	parsed, err := ParseCommit(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ParseCommit failed: %v", err)
+	}
+	if parsed.GPGSignature != testSignature {
+		t.Errorf("Expected the signature back, got %q", parsed.GPGSignature)
+	}
+	if parsed.Message != "Signed\n" {
+		t.Errorf("Expected the message after the signature, got %q", parsed.Message)
+	}
+	payload, _ := parsed.SigningPayload()
+	if !bytes.Equal(payload, unsigned) {
+		t.Error("Expected the parsed commit's payload to match what was signed")
+	}
+
+	if err := commit.ComputeHash(hasher); err != nil {
+		t.Fatal(err)
+	}
+	if err := parsed.ComputeHash(hasher); err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.Hash().Equals(commit.Hash()) {
+		t.Error("Expected a parsed signed commit to keep its hash")
+	}
+
+	failing := SignerFunc(func([]byte) (string, error) { return "", errors.New("no key") })
+	if err := NewCommit().Sign(failing); err == nil {
+		t.Error("Expected the signer's error")
+	}
+}
+
+// TestSignTag tests that a tag signature follows the message and is split
+// off again when parsed
+func TestSignTag(t *testing.T) {
+	hasher := hash.NewSHA1()
+	tag := NewTag()
+	tag.Target = EmptyTreeHash(hasher)
+	tag.TargetType = TreeType
+	tag.Name = "v1.0"
+	tag.Tagger = Signature{Name: "Alice", Email: "alice@example.com", When: time.Unix(1700000000, 0).UTC()}
+	tag.Message = "Release 1.0"
+
+	signer := &recordingSigner{}
+	if err := tag.Sign(signer); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if !strings.HasSuffix(string(signer.payload), "\n\nRelease 1.0\n") {
+		t.Errorf("Expected the payload to end with the message, got %q", signer.payload)
+	}
+
+	var buf bytes.Buffer
+	if err := tag.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(buf.String(), "\nRelease 1.0\n"+testSignature) {
+		t.Errorf("Unexpected signed tag:\n%s", buf.String())
+	}
+
+	parsed, err := ParseTag(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ParseTag failed: %v", err)
+	}
+	if parsed.Message != "Release 1.0\n" || parsed.GPGSignature != testSignature {
+		t.Errorf("Expected message and signature apart, got %q and %q", parsed.Message, parsed.GPGSignature)
+	}
+	payload, _ := parsed.SigningPayload()
+	if !bytes.Equal(payload, signer.payload) {
+		t.Error("Expected the parsed tag's payload to match what was signed")
+	}
+
+	if err := tag.ComputeHash(hasher); err != nil {
+		t.Fatal(err)
+	}
+	if err := parsed.ComputeHash(hasher); err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.Hash().Equals(tag.Hash()) {
+		t.Error("Expected a parsed signed tag to keep its hash")
+	}
+}
@@ -0,0 +1,175 @@
+package object
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrStreamAborted is returned by a stream codec used after Abort
+var ErrStreamAborted = errors.New("stream aborted")
+
+// StreamCompressor compresses data incrementally with zlib.
+// Each call returns the compressed output produced so far.
+type StreamCompressor struct {
+	buf bytes.Buffer
+	w   *zlib.Writer
+}
+
+// NewStreamCompressor creates a new incremental compressor
+func NewStreamCompressor() *StreamCompressor {
+	c := &StreamCompressor{}
+	c.w = zlib.NewWriter(&c.buf)
+	return c
+}
+
+// Write compresses a chunk and returns any output that is ready
+func (c *StreamCompressor) Write(p []byte) ([]byte, error) {
+	if _, err := c.w.Write(p); err != nil {
+		return nil, fmt.Errorf("failed to compress chunk: %w", err)
+	}
+	return c.take(), nil
+}
+
+// Close finishes the zlib stream and returns the remaining output
+func (c *StreamCompressor) Close() ([]byte, error) {
+	if err := c.w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close compressor: %w", err)
+	}
+	return c.take(), nil
+}
+
+// Abort discards the stream and any buffered output
+func (c *StreamCompressor) Abort() {
+	c.w.Reset(io.Discard)
+	c.buf.Reset()
+}
+
+// take returns and clears the buffered output
+func (c *StreamCompressor) take() []byte {
+	if c.buf.Len() == 0 {
+		return nil
+	}
+	out := make([]byte, c.buf.Len())
+	copy(out, c.buf.Bytes())
+	c.buf.Reset()
+	return out
+}
+
+// StreamDecompressor decompresses zlib data incrementally.
+// Each call returns the decompressed output produced so far.
+type StreamDecompressor struct {
+	pw   *io.PipeWriter
+	done chan struct{}
+
+	mu  sync.Mutex
+	out bytes.Buffer
+	err error
+}
+
+// NewStreamDecompressor creates a new incremental decompressor
+func NewStreamDecompressor() *StreamDecompressor {
+	pr, pw := io.Pipe()
+	d := &StreamDecompressor{
+		pw:   pw,
+		done: make(chan struct{}),
+	}
+	go d.run(pr)
+	return d
+}
+
+// Write feeds a chunk of compressed data and returns any output that is ready
+func (d *StreamDecompressor) Write(p []byte) ([]byte, error) {
+	if _, err := d.pw.Write(p); err != nil {
+		return nil, d.failure(err)
+	}
+	return d.take(), nil
+}
+
+// Close signals the end of input and returns the remaining output.
+// It fails if the compressed stream was truncated.
+func (d *StreamDecompressor) Close() ([]byte, error) {
+	d.pw.Close()
+	<-d.done
+
+	out := d.take()
+	if err := d.failure(nil); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Abort discards the stream and stops the decoding goroutine
+func (d *StreamDecompressor) Abort() {
+	d.pw.CloseWithError(ErrStreamAborted)
+	<-d.done
+}
+
+// run decodes the piped input until the zlib stream ends
+func (d *StreamDecompressor) run(pr *io.PipeReader) {
+	defer close(d.done)
+
+	r, err := zlib.NewReader(pr)
+	if err != nil {
+		d.fail(pr, fmt.Errorf("failed to create decompressor: %w", err))
+		return
+	}
+	defer r.Close()
+
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(chunk)
+		if n > 0 {
+			d.mu.Lock()
+			d.out.Write(chunk[:n])
+			d.mu.Unlock()
+		}
+
+		if err == io.EOF {
+			// Ignore trailing input so writers never block
+			io.Copy(io.Discard, pr)
+			return
+		}
+		if err != nil {
+			d.fail(pr, fmt.Errorf("failed to decompress chunk: %w", err))
+			return
+		}
+	}
+}
+
+// fail records the first error and unblocks pending writes
+func (d *StreamDecompressor) fail(pr *io.PipeReader, err error) {
+	d.mu.Lock()
+	if d.err == nil {
+		d.err = err
+	}
+	d.mu.Unlock()
+	pr.CloseWithError(err)
+}
+
+// failure returns the recorded error, falling back to err
+func (d *StreamDecompressor) failure(err error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return d.err
+	}
+	return err
+}
+
+// take returns and clears the buffered output
+func (d *StreamDecompressor) take() []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.out.Len() == 0 {
+		return nil
+	}
+	out := make([]byte, d.out.Len())
+	copy(out, d.out.Bytes())
+	d.out.Reset()
+	return out
+}
@@ -0,0 +1,105 @@
+package object
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// TestStreamRoundTrip tests chunked compression and decompression
+func TestStreamRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("streaming object payload\n"), 10000)
+
+	compressor := NewStreamCompressor()
+	var compressed bytes.Buffer
+	for i := 0; i < len(data); i += 4096 {
+		end := i + 4096
+		if end > len(data) {
+			end = len(data)
+		}
+		out, err := compressor.Write(data[i:end])
+		if err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		compressed.Write(out)
+	}
+	out, err := compressor.Close()
+	if err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	compressed.Write(out)
+
+	// The stream is readable by the whole-buffer decompressor
+	whole, err := Decompress(compressed.Bytes())
+	if err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	if !bytes.Equal(whole, data) {
+		t.Fatal("Decompressed data does not match input")
+	}
+
+	decompressor := NewStreamDecompressor()
+	var decompressed bytes.Buffer
+	input := compressed.Bytes()
+	for i := 0; i < len(input); i += 100 {
+		end := i + 100
+		if end > len(input) {
+			end = len(input)
+		}
+		out, err := decompressor.Write(input[i:end])
+		if err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		decompressed.Write(out)
+	}
+	out, err = decompressor.Close()
+	if err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	decompressed.Write(out)
+
+	if !bytes.Equal(decompressed.Bytes(), data) {
+		t.Errorf("Streamed output has %d bytes, want %d", decompressed.Len(), len(data))
+	}
+}
+
+// TestStreamDecompressorErrors tests invalid and truncated input
+func TestStreamDecompressorErrors(t *testing.T) {
+	decompressor := NewStreamDecompressor()
+	_, writeErr := decompressor.Write([]byte("not zlib data"))
+	_, closeErr := decompressor.Close()
+	if writeErr == nil && closeErr == nil {
+		t.Error("Expected error for invalid input")
+	}
+
+	compressed, err := Compress([]byte("hello world"))
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	decompressor = NewStreamDecompressor()
+	if _, err := decompressor.Write(compressed[:len(compressed)-4]); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if _, err := decompressor.Close(); err == nil {
+		t.Error("Expected error for truncated input")
+	}
+}
+
+// TestStreamDecompressorAbort tests that an aborted stream stops decoding
+func TestStreamDecompressorAbort(t *testing.T) {
+	compressed, err := Compress([]byte("hello world"))
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	decompressor := NewStreamDecompressor()
+	if _, err := decompressor.Write(compressed[:4]); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	decompressor.Abort()
+
+	if _, err := decompressor.Write(compressed[4:]); !errors.Is(err, ErrStreamAborted) {
+		t.Errorf("Write after Abort error = %v, want %v", err, ErrStreamAborted)
+	}
+}
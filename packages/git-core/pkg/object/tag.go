@@ -6,7 +6,7 @@ import (
 	"io"
 	"strings"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
 )
 
 // Tag represents a Git tag object (annotated tag)
@@ -16,7 +16,9 @@ type Tag struct {
 	Name       string    // Tag name
 	Tagger     Signature // Person who created the tag
 	Message    string    // Tag message
-	hash       hash.Hash
+	// GPGSignature is the tag's signature, which Git appends to the message
+	GPGSignature string
+	hash         hash.Hash
 }
 
 // NewTag creates a new tag object
@@ -63,9 +65,11 @@ func (t *Tag) Serialize(w io.Writer) error {
 		return err
 	}
 
-	// Write tagger line
-	if _, err := fmt.Fprintf(w, "tagger %s\n", t.Tagger.Format()); err != nil {
-		return err
+	// Write tagger line (very old tags have none)
+	if t.HasTagger() {
+		if _, err := fmt.Fprintf(w, "tagger %s\n", t.Tagger.Format()); err != nil {
+			return err
+		}
 	}
 
 	// Write empty line before message
@@ -78,6 +82,11 @@ func (t *Tag) Serialize(w io.Writer) error {
 		return err
 	}
 
+	// Write signature after the message
+	if _, err := w.Write([]byte(t.GPGSignature)); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -159,12 +168,64 @@ func ParseTag(data []byte) (*Tag, error) {
 
 	// Parse message (remaining lines)
 	if i < len(lines) {
-		tag.Message = strings.Join(lines[i:], "\n")
+		tag.Message, tag.GPGSignature = splitSignature(strings.Join(lines[i:], "\n"))
 	}
 
 	return tag, nil
 }
 
+// SigningPayload returns the content a tag signature covers: the
+// serialized tag without its signature
+func (t *Tag) SigningPayload() ([]byte, error) {
+	unsigned := *t
+	unsigned.GPGSignature = ""
+	var buf bytes.Buffer
+	if err := unsigned.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Sign signs the tag with signer and appends the signature to the message.
+// The hash must be computed again afterwards.
+func (t *Tag) Sign(signer Signer) error {
+	if t.Message != "" && !strings.HasSuffix(t.Message, "\n") {
+		t.Message += "\n"
+	}
+	payload, err := t.SigningPayload()
+	if err != nil {
+		return err
+	}
+	signature, err := signer.Sign(payload)
+	if err != nil {
+		return fmt.Errorf("failed to sign tag: %w", err)
+	}
+	if signature == "" {
+		return fmt.Errorf("failed to sign tag: empty signature")
+	}
+	if !strings.HasSuffix(signature, "\n") {
+		signature += "\n"
+	}
+	t.GPGSignature = signature
+	return nil
+}
+
+// HasTagger reports whether the tag records who created it
+func (t *Tag) HasTagger() bool {
+	return t.Tagger.raw != nil || t.Tagger.Name != "" || t.Tagger.Email != "" || !t.Tagger.When.IsZero()
+}
+
+// Validate strictly checks the tagger line, if present
+func (t *Tag) Validate() error {
+	if !t.HasTagger() {
+		return nil
+	}
+	if err := t.Tagger.Validate(); err != nil {
+		return fmt.Errorf("invalid tagger: %w", err)
+	}
+	return nil
+}
+
 // ComputeHash computes and sets the hash of the tag using the given hasher
 func (t *Tag) ComputeHash(hasher hash.Hasher) error {
 	data, err := t.Bytes()
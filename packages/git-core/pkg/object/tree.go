@@ -7,10 +7,13 @@ import (
 	"sort"
 	"strconv"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
 )
 
-// FileMode represents the Unix file mode stored in tree entries
+// FileMode represents the Unix file mode stored in tree entries.
+// Only the five modes below are valid in new trees; their canonical
+// string forms are the six-digit octal values ("100644", "040000", ...).
+// Git itself writes directories as "40000", which is accepted as well.
 type FileMode uint32
 
 const (
@@ -46,6 +49,12 @@ func NewTree() *Tree {
 	}
 }
 
+// EmptyTreeHash returns the hash of the empty tree, which Git treats as
+// present in every repository whether or not it is stored
+func EmptyTreeHash(hasher hash.Hasher) hash.Hash {
+	return hasher.Hash([]byte("tree 0\x00"))
+}
+
 // Type returns the object type (tree)
 func (t *Tree) Type() Type {
 	return TreeType
@@ -265,6 +274,25 @@ func IsValidMode(mode FileMode) bool {
 		mode == ModeSymlink || mode == ModeGitlink
 }
 
+// ParseFileMode parses a canonical octal mode string such as "100644"
+// and rejects anything that is not a valid tree entry mode
+func ParseFileMode(s string) (FileMode, error) {
+	switch s {
+	case "040000", "40000":
+		return ModeDir, nil
+	case "100644":
+		return ModeRegular, nil
+	case "100755":
+		return ModeExecutable, nil
+	case "120000":
+		return ModeSymlink, nil
+	case "160000":
+		return ModeGitlink, nil
+	default:
+		return 0, fmt.Errorf("invalid file mode %q: expected one of 100644, 100755, 040000, 120000, 160000", s)
+	}
+}
+
 // String returns a string representation of the file mode
 func (m FileMode) String() string {
 	return fmt.Sprintf("%06o", m)
@@ -0,0 +1,26 @@
+package protocol
+
+import "io"
+
+// The frozen API listed in the package documentation. These assignments
+// stop compiling if one of the signatures changes.
+var (
+	_ func([]byte) []byte                  = EncodePktLine
+	_ func() []byte                        = EncodeFlushPkt
+	_ func([]byte) ([]byte, []byte, error) = DecodePktLine
+	_ func(io.Reader) *PktLineReader       = NewPktLineReader
+	_ func(io.Writer) *PktLineWriter       = NewPktLineWriter
+
+	_ func(io.Reader) *PackfileReader               = NewPackfileReader
+	_ func(*PackfileReader) (*Packfile, error)      = (*PackfileReader).ReadPackfile
+	_ func(io.Writer) *PackfileWriter               = NewPackfileWriter
+	_ func(*PackfileWriter, []PackfileObject) error = (*PackfileWriter).WritePackfile
+
+	_ func([]byte) (*Delta, error)         = ParseDelta
+	_ func([]byte, *Delta) ([]byte, error) = ApplyDelta
+	_ func([]byte, []byte) *Delta          = CreateDelta
+	_ func(*Delta) ([]byte, error)         = EncodeDelta
+
+	_ func() Limits = DefaultLimits
+	_ error         = (*LimitError)(nil)
+)
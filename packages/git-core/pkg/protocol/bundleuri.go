@@ -0,0 +1,248 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BundleURICapability is advertised by servers that can list bundle URIs
+const BundleURICapability = "bundle-uri"
+
+// BundleList is a list of bundles that can seed a clone
+type BundleList struct {
+	// Mode is "all" if every bundle is needed, or "any" if each bundle
+	// stands alone
+	Mode string
+	// Bundles are the advertised bundles, in creation order when known
+	Bundles []BundleInfo
+}
+
+// BundleInfo describes one advertised bundle
+type BundleInfo struct {
+	// ID is the bundle's identifier in the list
+	ID string
+	// URI is the absolute location of the bundle
+	URI string
+	// CreationToken orders incremental bundles (0 if not given)
+	CreationToken uint64
+}
+
+// ParseBundleList parses a bundle list, either as "key=value" lines from the
+// bundle-uri command or as a config file served at a bundle URI. Relative
+// URIs are resolved against baseURI.
+func ParseBundleList(data []byte, baseURI string) (*BundleList, error) {
+	list := &BundleList{Mode: "all"}
+	bundles := make(map[string]*BundleInfo)
+	order := []string{}
+
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		// Config file sections: [bundle] or [bundle "id"]
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			kind, sub, found := strings.Cut(name, " ")
+			if !strings.EqualFold(kind, "bundle") {
+				section = "-"
+				continue
+			}
+			section = "bundle"
+			if found {
+				section += "." + strings.Trim(strings.TrimSpace(sub), "\"")
+			}
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid bundle list line: %q", line)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if section == "-" {
+			continue
+		}
+		if section != "" {
+			key = section + "." + key
+		}
+
+		if !strings.HasPrefix(key, "bundle.") {
+			continue
+		}
+		key = strings.TrimPrefix(key, "bundle.")
+
+		// Keys without a bundle ID apply to the whole list
+		dot := strings.LastIndex(key, ".")
+		if dot == -1 {
+			switch strings.ToLower(key) {
+			case "version":
+				if value != "1" {
+					return nil, fmt.Errorf("unsupported bundle list version: %s", value)
+				}
+			case "mode":
+				if value != "all" && value != "any" {
+					return nil, fmt.Errorf("unsupported bundle list mode: %s", value)
+				}
+				list.Mode = value
+			}
+			continue
+		}
+
+		id, field := key[:dot], strings.ToLower(key[dot+1:])
+		bundle, ok := bundles[id]
+		if !ok {
+			bundle = &BundleInfo{ID: id}
+			bundles[id] = bundle
+			order = append(order, id)
+		}
+
+		switch field {
+		case "uri":
+			uri, err := resolveBundleURI(baseURI, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid URI for bundle %s: %w", id, err)
+			}
+			bundle.URI = uri
+		case "creationtoken":
+			token, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid creation token for bundle %s: %w", id, err)
+			}
+			bundle.CreationToken = token
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read bundle list: %w", err)
+	}
+
+	for _, id := range order {
+		if bundles[id].URI == "" {
+			return nil, fmt.Errorf("bundle %s has no URI", id)
+		}
+		list.Bundles = append(list.Bundles, *bundles[id])
+	}
+
+	// Incremental bundles must be applied oldest first
+	sort.SliceStable(list.Bundles, func(i, j int) bool {
+		return list.Bundles[i].CreationToken < list.Bundles[j].CreationToken
+	})
+
+	return list, nil
+}
+
+// resolveBundleURI resolves a possibly relative bundle URI
+func resolveBundleURI(baseURI, uri string) (string, error) {
+	ref, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if ref.IsAbs() || baseURI == "" {
+		return uri, nil
+	}
+
+	base, err := url.Parse(baseURI)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// ListBundleURIs asks the server for its bundle list with the protocol v2
+// bundle-uri command
+func (c *Client) ListBundleURIs(repoURL string) (*BundleList, error) {
+	uploadPackURL, err := buildUploadPackURL(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository URL: %w", err)
+	}
+
+	var body bytes.Buffer
+	writer := NewPktLineWriter(&body)
+	writer.WriteString("command=bundle-uri\n")
+	writer.WriteString("agent=" + c.userAgent + "\n")
+	writer.WriteDelimiter()
+	writer.WriteFlush()
+
+	req, err := http.NewRequest("POST", uploadPackURL, &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("Content-Type", "application/x-git-upload-pack-request")
+	req.Header.Set("Accept", "application/x-git-upload-pack-result")
+	req.Header.Set("Git-Protocol", "version=2")
+
+	if err := c.authProvider.ApplyAuth(req); err != nil {
+		return nil, fmt.Errorf("failed to apply authentication: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, WrapProtocolError(err, 0, repoURL)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := c.responseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(respBody)
+		return nil, WrapProtocolError(fmt.Errorf("%s", string(data)), resp.StatusCode, repoURL)
+	}
+
+	lines, err := NewPktLineReader(respBody).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle-uri response: %w", err)
+	}
+
+	var data bytes.Buffer
+	for _, line := range lines {
+		data.Write(bytes.TrimSuffix(line, []byte("\n")))
+		data.WriteByte('\n')
+	}
+
+	return ParseBundleList(data.Bytes(), repoURL)
+}
+
+// DownloadBundle fetches a bundle or bundle list over plain HTTP. Bundle
+// URIs usually point at static hosting, so no credentials are sent.
+func (c *Client) DownloadBundle(uri string) ([]byte, error) {
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, WrapProtocolError(err, 0, uri)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, WrapProtocolError(fmt.Errorf("bundle download failed"), resp.StatusCode, uri)
+	}
+
+	body, err := c.responseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,82 @@
+package protocol
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestParseBundleList tests both bundle list encodings
+func TestParseBundleList(t *testing.T) {
+	commandOutput := "bundle.version=1\nbundle.mode=any\n" +
+		"bundle.new.uri=https://cdn.example.com/new.bundle\nbundle.new.creationToken=20\n" +
+		"bundle.old.uri=old.bundle\nbundle.old.creationToken=10\n"
+
+	list, err := ParseBundleList([]byte(commandOutput), "https://git.example.com/repo.git/")
+	if err != nil {
+		t.Fatalf("ParseBundleList failed: %v", err)
+	}
+	if list.Mode != "any" || len(list.Bundles) != 2 {
+		t.Fatalf("Unexpected list %+v", list)
+	}
+	if list.Bundles[0].ID != "old" || list.Bundles[0].URI != "https://git.example.com/repo.git/old.bundle" {
+		t.Errorf("Expected the oldest bundle first with a resolved URI, got %+v", list.Bundles[0])
+	}
+	if list.Bundles[1].CreationToken != 20 {
+		t.Errorf("Unexpected creation token %d", list.Bundles[1].CreationToken)
+	}
+
+	configFile := "[bundle]\n\tversion = 1\n\tmode = all\n[core]\n\turi = ignored\n[bundle \"base\"]\n\turi = /bundles/base.bundle\n"
+	list, err = ParseBundleList([]byte(configFile), "https://cdn.example.com/lists/list")
+	if err != nil {
+		t.Fatalf("ParseBundleList failed: %v", err)
+	}
+	if list.Mode != "all" || len(list.Bundles) != 1 || list.Bundles[0].URI != "https://cdn.example.com/bundles/base.bundle" {
+		t.Errorf("Unexpected list %+v", list)
+	}
+
+	invalid := []string{
+		"bundle.version=2\n",
+		"bundle.mode=some\n",
+		"bundle.a.creationToken=1\n",
+		"not a key value\n",
+	}
+	for _, data := range invalid {
+		if _, err := ParseBundleList([]byte(data), ""); err == nil {
+			t.Errorf("Expected error parsing %q", data)
+		}
+	}
+}
+
+// TestListBundleURIs tests the bundle-uri command request and response
+func TestListBundleURIs(t *testing.T) {
+	var requestBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requestBody = string(body)
+		if r.Header.Get("Git-Protocol") != "version=2" {
+			t.Errorf("Expected protocol v2 header, got %q", r.Header.Get("Git-Protocol"))
+		}
+
+		writer := NewPktLineWriter(w)
+		writer.WriteString("bundle.version=1\n")
+		writer.WriteString("bundle.mode=all\n")
+		writer.WriteString("bundle.main.uri=https://cdn.example.com/main.bundle\n")
+		writer.WriteFlush()
+	}))
+	defer server.Close()
+
+	list, err := NewClient().ListBundleURIs(server.URL + "/repo.git")
+	if err != nil {
+		t.Fatalf("ListBundleURIs failed: %v", err)
+	}
+
+	if !strings.HasPrefix(requestBody, "0017command=bundle-uri\n") || !strings.HasSuffix(requestBody, "00010000") {
+		t.Errorf("Unexpected request %q", requestBody)
+	}
+	if len(list.Bundles) != 1 || list.Bundles[0].URI != "https://cdn.example.com/main.bundle" {
+		t.Errorf("Unexpected list %+v", list)
+	}
+}
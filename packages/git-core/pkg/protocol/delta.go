@@ -83,22 +83,42 @@ func ParseDelta(data []byte) (*Delta, error) {
 	}, nil
 }
 
-// ApplyDelta applies delta instructions to a base object
+// maxDeltaPrealloc caps the memory reserved up front for a delta result,
+// since the declared target size is untrusted
+const maxDeltaPrealloc = 16 << 20
+
+// ApplyDelta applies delta instructions to a base object, enforcing
+// DefaultLimits
 func ApplyDelta(base []byte, delta *Delta) ([]byte, error) {
+	return ApplyDeltaWithLimits(base, delta, DefaultLimits())
+}
+
+// ApplyDeltaWithLimits applies delta instructions to a base object. The
+// declared target size must be within MaxObjectSize, and applying stops as
+// soon as the result outgrows it.
+func ApplyDeltaWithLimits(base []byte, delta *Delta, limits Limits) ([]byte, error) {
 	// Verify base size matches expected source size
 	if uint64(len(base)) != delta.SourceSize {
 		return nil, fmt.Errorf("base size mismatch: expected %d, got %d",
 			delta.SourceSize, len(base))
 	}
 
+	if max := limits.MaxObjectSize; max > 0 && delta.TargetSize > max {
+		return nil, &LimitError{Limit: "delta target size", Value: delta.TargetSize, Max: max}
+	}
+
 	// Apply all instructions
 	var result bytes.Buffer
-	result.Grow(int(delta.TargetSize))
+	result.Grow(int(min(delta.TargetSize, maxDeltaPrealloc)))
 
 	for i, instruction := range delta.Instructions {
 		if err := instruction.Apply(base, &result); err != nil {
 			return nil, fmt.Errorf("failed to apply instruction %d: %w", i, err)
 		}
+		if uint64(result.Len()) > delta.TargetSize {
+			return nil, fmt.Errorf("result size mismatch: instruction %d exceeds target size %d",
+				i, delta.TargetSize)
+		}
 	}
 
 	// Verify result size matches expected target size
@@ -121,6 +141,9 @@ func readDeltaSize(reader io.ByteReader) (uint64, error) {
 			return 0, err
 		}
 
+		if shift > 63 {
+			return 0, fmt.Errorf("delta size too long")
+		}
 		size |= uint64(b&0x7F) << shift
 		shift += 7
 
@@ -218,53 +241,64 @@ func parseInsertInstruction(reader io.ByteReader, opcode byte) (*InsertInstructi
 // ResolveDelta resolves a delta object given a function to retrieve base objects
 type BaseObjectResolver func(hash string) ([]byte, error)
 
-// ResolveOfsDelta resolves an offset delta
+// ResolveOfsDelta resolves an offset delta, enforcing DefaultLimits
 func ResolveOfsDelta(objects []PackfileObject, deltaIndex int) ([]byte, error) {
-	delta := objects[deltaIndex]
-	if delta.Type != ObjOfsDelta {
+	return ResolveOfsDeltaWithLimits(objects, deltaIndex, DefaultLimits())
+}
+
+// ResolveOfsDeltaWithLimits resolves an offset delta whose base may itself
+// be a delta. The chain is followed iteratively and may be at most
+// MaxDeltaDepth deltas long.
+func ResolveOfsDeltaWithLimits(objects []PackfileObject, deltaIndex int, limits Limits) ([]byte, error) {
+	if deltaIndex < 0 || deltaIndex >= len(objects) {
+		return nil, fmt.Errorf("delta index %d out of range", deltaIndex)
+	}
+	if objects[deltaIndex].Type != ObjOfsDelta {
 		return nil, fmt.Errorf("object is not an offset delta")
 	}
 
-	// Find base object by offset
-	baseIndex := -1
-	for i := 0; i < deltaIndex; i++ {
-		if int64(i) == delta.Offset {
-			baseIndex = i
-			break
+	// Walk down to the first non-delta base, remembering the deltas
+	chain := []int{}
+	current := deltaIndex
+	for objects[current].IsDelta {
+		if objects[current].Type != ObjOfsDelta {
+			return nil, fmt.Errorf("failed to resolve base delta: object is not an offset delta")
 		}
+		if max := limits.MaxDeltaDepth; max > 0 && len(chain) >= max {
+			return nil, &LimitError{Limit: "delta chain depth", Value: uint64(len(chain) + 1), Max: uint64(max)}
+		}
+		chain = append(chain, current)
+
+		// Find base object by its offset in the pack; it always precedes
+		// the delta
+		baseIndex := -1
+		for i := 0; i < current; i++ {
+			if objects[i].PackOffset == objects[current].Offset {
+				baseIndex = i
+				break
+			}
+		}
+		if baseIndex == -1 {
+			return nil, fmt.Errorf("base object not found at offset %d", objects[current].Offset)
+		}
+		current = baseIndex
 	}
 
-	if baseIndex == -1 {
-		return nil, fmt.Errorf("base object not found at offset %d", delta.Offset)
-	}
-
-	// Get base object data (may need to recursively resolve if base is also a delta)
-	var baseData []byte
-	baseObj := objects[baseIndex]
-
-	if baseObj.IsDelta {
-		// Recursively resolve base delta
-		resolved, err := ResolveOfsDelta(objects, baseIndex)
+	// Apply the deltas from the base upwards
+	data := objects[current].Data
+	for i := len(chain) - 1; i >= 0; i-- {
+		parsedDelta, err := ParseDelta(objects[chain[i]].Data)
 		if err != nil {
-			return nil, fmt.Errorf("failed to resolve base delta: %w", err)
+			return nil, fmt.Errorf("failed to parse delta: %w", err)
 		}
-		baseData = resolved
-	} else {
-		baseData = baseObj.Data
-	}
-
-	// Parse and apply delta
-	parsedDelta, err := ParseDelta(delta.Data)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse delta: %w", err)
-	}
 
-	result, err := ApplyDelta(baseData, parsedDelta)
-	if err != nil {
-		return nil, fmt.Errorf("failed to apply delta: %w", err)
+		data, err = ApplyDeltaWithLimits(data, parsedDelta, limits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply delta: %w", err)
+		}
 	}
 
-	return result, nil
+	return data, nil
 }
 
 // ResolveRefDelta resolves a reference delta
@@ -283,81 +317,86 @@ func ResolveRefDelta(deltaData []byte, baseData []byte) ([]byte, error) {
 	return result, nil
 }
 
+const (
+	// deltaBlockSize is the length of the source blocks CreateDelta
+	// indexes, and so the shortest match it copies
+	deltaBlockSize = 16
+	// maxDeltaCandidates bounds how many source blocks with the same
+	// content are tried for a match, keeping repetitive data fast
+	maxDeltaCandidates = 64
+	// maxCopySize is the longest single copy, which git also keeps to so
+	// that older readers understand it
+	maxCopySize = 0x10000
+	// maxInsertSize is the most data one insert instruction carries
+	maxInsertSize = 127
+)
+
 // CreateDelta creates a delta from source to target
-// This uses a simple greedy algorithm to find matching blocks
+// Like git, it indexes the source in fixed-size blocks and looks each
+// position of the target up in the index, extending matches as far as
+// they go in both directions, so it takes time linear in the sizes.
 func CreateDelta(source, target []byte) *Delta {
+	// Index the source blocks by content
+	index := make(map[string][]int)
+	for offset := 0; offset+deltaBlockSize <= len(source); offset += deltaBlockSize {
+		block := string(source[offset : offset+deltaBlockSize])
+		if len(index[block]) < maxDeltaCandidates {
+			index[block] = append(index[block], offset)
+		}
+	}
+
 	instructions := []DeltaInstruction{}
+	insertStart := 0
+	flushInsert := func(end int) {
+		for insertStart < end {
+			size := min(end-insertStart, maxInsertSize)
+			instructions = append(instructions, &InsertInstruction{
+				Data: target[insertStart : insertStart+size],
+			})
+			insertStart += size
+		}
+	}
 
-	// Simple greedy algorithm: for each position in target,
-	// try to find the longest match in source
 	targetPos := 0
-	minMatchLen := 4 // Minimum match length to be worth a copy instruction
-
-	for targetPos < len(target) {
-		bestMatchOffset := -1
-		bestMatchLen := 0
-
-		// Search for matches in source
-		for sourcePos := 0; sourcePos < len(source); sourcePos++ {
-			matchLen := 0
-			for matchLen < len(target)-targetPos &&
-				matchLen < len(source)-sourcePos &&
-				source[sourcePos+matchLen] == target[targetPos+matchLen] {
+	for targetPos+deltaBlockSize <= len(target) {
+		// Find the longest match among the source blocks like this one
+		bestOffset, bestLen := -1, 0
+		for _, offset := range index[string(target[targetPos:targetPos+deltaBlockSize])] {
+			matchLen := deltaBlockSize
+			for offset+matchLen < len(source) && targetPos+matchLen < len(target) &&
+				source[offset+matchLen] == target[targetPos+matchLen] {
 				matchLen++
 			}
-
-			if matchLen > bestMatchLen {
-				bestMatchLen = matchLen
-				bestMatchOffset = sourcePos
+			if matchLen > bestLen {
+				bestOffset, bestLen = offset, matchLen
 			}
 		}
+		if bestOffset < 0 {
+			targetPos++
+			continue
+		}
 
-		// If we found a good match, create a copy instruction
-		if bestMatchLen >= minMatchLen {
+		// Take back the bytes before the match that the source has too
+		for bestOffset > 0 && targetPos > insertStart && source[bestOffset-1] == target[targetPos-1] {
+			bestOffset--
+			targetPos--
+			bestLen++
+		}
+
+		flushInsert(targetPos)
+		for bestLen > 0 {
+			size := min(bestLen, maxCopySize)
 			instructions = append(instructions, &CopyInstruction{
-				Offset: uint64(bestMatchOffset),
-				Size:   uint64(bestMatchLen),
+				Offset: uint64(bestOffset),
+				Size:   uint64(size),
 			})
-			targetPos += bestMatchLen
-		} else {
-			// No good match found, insert the byte(s)
-			// Collect consecutive bytes that don't match
-			insertStart := targetPos
-			for targetPos < len(target) {
-				// Check if there's a match at this position
-				hasMatch := false
-				for sourcePos := 0; sourcePos < len(source); sourcePos++ {
-					matchLen := 0
-					for matchLen < len(target)-targetPos &&
-						matchLen < len(source)-sourcePos &&
-						source[sourcePos+matchLen] == target[targetPos+matchLen] {
-						matchLen++
-					}
-					if matchLen >= minMatchLen {
-						hasMatch = true
-						break
-					}
-				}
-
-				if hasMatch {
-					break
-				}
-
-				targetPos++
-
-				// Git's delta format limits insert size to 127 bytes
-				if targetPos-insertStart >= 127 {
-					break
-				}
-			}
-
-			if targetPos > insertStart {
-				instructions = append(instructions, &InsertInstruction{
-					Data: target[insertStart:targetPos],
-				})
-			}
+			bestOffset += size
+			targetPos += size
+			bestLen -= size
 		}
+		insertStart = targetPos
 	}
+	flushInsert(len(target))
 
 	return &Delta{
 		SourceSize:   uint64(len(source)),
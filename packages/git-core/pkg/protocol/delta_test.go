@@ -2,6 +2,7 @@ package protocol
 
 import (
 	"bytes"
+	"fmt"
 	"testing"
 )
 
@@ -711,6 +712,42 @@ func TestCreateAndEncodeDelta(t *testing.T) {
 	}
 }
 
+// TestCreateDeltaLarge tests that a small edit to a large file makes a
+// small delta, with copies split at the size git readers accept
+func TestCreateDeltaLarge(t *testing.T) {
+	var source bytes.Buffer
+	for i := 0; source.Len() < 1<<20; i++ {
+		fmt.Fprintf(&source, "line %d of a large file\n", i)
+	}
+	target := append([]byte("a new first line\n"), source.Bytes()...)
+	target = append(target, "and a new last line\n"...)
+
+	deltaData, err := CreateAndEncodeDelta(source.Bytes(), target)
+	if err != nil {
+		t.Fatalf("CreateAndEncodeDelta() error: %v", err)
+	}
+	if len(deltaData) > 200 {
+		t.Errorf("delta is %d bytes, want a few copies and inserts", len(deltaData))
+	}
+
+	delta, err := ParseDelta(deltaData)
+	if err != nil {
+		t.Fatalf("ParseDelta() error: %v", err)
+	}
+	for _, instruction := range delta.Instructions {
+		if c, ok := instruction.(*CopyInstruction); ok && c.Size > 0x10000 {
+			t.Errorf("copy of %d bytes exceeds 64KiB", c.Size)
+		}
+	}
+	result, err := ApplyDelta(source.Bytes(), delta)
+	if err != nil {
+		t.Fatalf("ApplyDelta() error: %v", err)
+	}
+	if !bytes.Equal(result, target) {
+		t.Error("round trip changed the target")
+	}
+}
+
 func TestDeltaRoundTrip(t *testing.T) {
 	// Test encoding and decoding a delta
 	source := []byte("This is the original content with some text.")
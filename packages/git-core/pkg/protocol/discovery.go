@@ -7,7 +7,7 @@ import (
 	"net/url"
 	"strings"
 
-	"github.com/nseba/browser-git/git-core/pkg/auth"
+	"github.com/nseba/browser-git/packages/git-core/pkg/auth"
 )
 
 // ServiceType represents the type of Git service
@@ -33,6 +33,7 @@ type DiscoveryResponse struct {
 	Capabilities []string
 	References   []Reference
 	SymRefs      map[string]string // Symbolic references (e.g., HEAD -> refs/heads/main)
+	Version      int               // Protocol version the server answered with (0, 1 or 2)
 }
 
 // Client represents a Git HTTP protocol client
@@ -40,6 +41,7 @@ type Client struct {
 	httpClient   *http.Client
 	userAgent    string
 	authProvider auth.AuthProvider
+	limits       Limits
 }
 
 // NewClient creates a new Git protocol client
@@ -48,6 +50,7 @@ func NewClient() *Client {
 		httpClient:   &http.Client{},
 		userAgent:    "browser-git/0.1.0",
 		authProvider: &auth.NoneAuthProvider{},
+		limits:       DefaultLimits(),
 	}
 }
 
@@ -85,6 +88,25 @@ func (c *Client) GetAuthProvider() auth.AuthProvider {
 	return c.authProvider
 }
 
+// SetLimits sets the limits applied to responses and the packfiles in them
+func (c *Client) SetLimits(limits Limits) {
+	c.limits = limits
+}
+
+// GetLimits returns the limits applied to responses
+func (c *Client) GetLimits() Limits {
+	return c.limits
+}
+
+// responseBody returns the response body capped at MaxResponseSize,
+// refusing responses that declare a larger size up front
+func (c *Client) responseBody(resp *http.Response) (io.Reader, error) {
+	if max := c.limits.MaxResponseSize; max > 0 && resp.ContentLength > max {
+		return nil, &LimitError{Limit: "response size", Value: uint64(resp.ContentLength), Max: uint64(max)}
+	}
+	return newLimitedReader(resp.Body, c.limits.MaxResponseSize, "response size"), nil
+}
+
 // Discover performs the discovery phase and retrieves repository info
 func (c *Client) Discover(repoURL string, service ServiceType) (*DiscoveryResponse, error) {
 	// Construct the info/refs URL
@@ -116,9 +138,14 @@ func (c *Client) Discover(repoURL string, service ServiceType) (*DiscoveryRespon
 	}
 	defer resp.Body.Close()
 
+	respBody, err := c.responseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check status code and handle errors appropriately
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
+		body, _ := io.ReadAll(respBody)
 		err := fmt.Errorf("%s", string(body))
 		// Wrap error with protocol context (handles auth, forbidden, not found, etc.)
 		return nil, WrapProtocolError(err, resp.StatusCode, repoURL)
@@ -132,7 +159,7 @@ func (c *Client) Discover(repoURL string, service ServiceType) (*DiscoveryRespon
 	}
 
 	// Parse the response
-	discovery, err := parseDiscoveryResponse(resp.Body, service)
+	discovery, err := parseDiscoveryResponse(respBody, service)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse discovery response: %w", err)
 	}
@@ -167,7 +194,8 @@ func buildInfoRefsURL(repoURL string, service ServiceType) (string, error) {
 	return u.String(), nil
 }
 
-// parseDiscoveryResponse parses the server's discovery response
+// parseDiscoveryResponse parses the server's discovery response. Protocol
+// v2 servers answer with a capability advertisement and no refs.
 func parseDiscoveryResponse(body io.Reader, service ServiceType) (*DiscoveryResponse, error) {
 	reader := NewPktLineReader(body)
 
@@ -177,6 +205,15 @@ func parseDiscoveryResponse(body io.Reader, service ServiceType) (*DiscoveryResp
 		return nil, fmt.Errorf("failed to read service line: %w", err)
 	}
 
+	// The service line is optional before a v2 advertisement
+	if string(firstLine) == "version 2\n" {
+		lines, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read capabilities: %w", err)
+		}
+		return parseV2Capabilities(lines, service), nil
+	}
+
 	expectedService := fmt.Sprintf("# service=%s\n", service)
 	if string(firstLine) != expectedService {
 		return nil, fmt.Errorf("unexpected service line: %s (expected %s)", string(firstLine), expectedService)
@@ -197,11 +234,23 @@ func parseDiscoveryResponse(body io.Reader, service ServiceType) (*DiscoveryResp
 		return nil, fmt.Errorf("failed to read reference lines: %w", err)
 	}
 
+	version := 0
+	if len(lines) > 0 {
+		switch string(lines[0]) {
+		case "version 2\n":
+			return parseV2Capabilities(lines[1:], service), nil
+		case "version 1\n":
+			version = 1
+			lines = lines[1:]
+		}
+	}
+
 	// Parse references and capabilities
 	response := &DiscoveryResponse{
 		Service:    service,
 		SymRefs:    make(map[string]string),
 		References: []Reference{},
+		Version:    version,
 	}
 
 	for i, line := range lines {
@@ -304,20 +353,102 @@ func parseRefLine(line string) (hash string, refName string, err error) {
 	return hash, refName, nil
 }
 
-// GetDefaultBranch returns the default branch from symbolic references
+// DefaultBranchSource describes how a clone's branch was chosen
+type DefaultBranchSource string
+
+const (
+	// DefaultBranchRequested means the caller named the branch
+	DefaultBranchRequested DefaultBranchSource = "requested"
+	// DefaultBranchSymref means the remote advertised HEAD as a symref
+	DefaultBranchSymref DefaultBranchSource = "symref"
+	// DefaultBranchHead means the branch points to the advertised HEAD commit
+	DefaultBranchHead DefaultBranchSource = "head"
+	// DefaultBranchPreferred means a preferred branch name was found
+	DefaultBranchPreferred DefaultBranchSource = "preferred"
+	// DefaultBranchFirst means the first advertised branch was taken
+	DefaultBranchFirst DefaultBranchSource = "first"
+)
+
+// BranchFallbackOptions configures how the default branch is guessed when
+// the remote does not advertise HEAD as a symref
+type BranchFallbackOptions struct {
+	// Preferred are branch names to try in order, without refs/heads/
+	Preferred []string
+	// FirstBranch falls back to the first advertised branch
+	FirstBranch bool
+}
+
+// DefaultBranchFallbackOptions returns the default fallback: main, then
+// master, then the first branch
+func DefaultBranchFallbackOptions() BranchFallbackOptions {
+	return BranchFallbackOptions{
+		Preferred:   []string{"main", "master"},
+		FirstBranch: true,
+	}
+}
+
+// GetDefaultBranch returns the default branch from symbolic references,
+// falling back to main, master or the first branch
 func (d *DiscoveryResponse) GetDefaultBranch() (string, error) {
+	branch, _, err := d.ResolveDefaultBranch(DefaultBranchFallbackOptions())
+	return branch, err
+}
+
+// ResolveDefaultBranch returns the default branch and how it was chosen.
+// The HEAD symref wins when advertised. Otherwise branches pointing to the
+// advertised HEAD commit are considered first, as Git does, then the
+// preferred names and finally the first branch if allowed.
+func (d *DiscoveryResponse) ResolveDefaultBranch(opts BranchFallbackOptions) (string, DefaultBranchSource, error) {
 	if target, ok := d.SymRefs["HEAD"]; ok {
-		return target, nil
+		return target, DefaultBranchSymref, nil
 	}
 
-	// Fallback: look for common default branches
+	branches := []Reference{}
 	for _, ref := range d.References {
-		if ref.Name == "refs/heads/main" || ref.Name == "refs/heads/master" {
-			return ref.Name, nil
+		if strings.HasPrefix(ref.Name, "refs/heads/") && !strings.HasSuffix(ref.Name, "^{}") {
+			branches = append(branches, ref)
 		}
 	}
+	if len(branches) == 0 {
+		return "", "", fmt.Errorf("no default branch found: remote has no branches")
+	}
 
-	return "", fmt.Errorf("no default branch found")
+	// HEAD is usually advertised even when its symref is not
+	if head, ok := d.GetReference("HEAD"); ok {
+		matching := []Reference{}
+		for _, ref := range branches {
+			if ref.Hash == head.Hash {
+				matching = append(matching, ref)
+			}
+		}
+		if len(matching) > 0 {
+			if name, ok := preferredBranch(matching, opts.Preferred); ok {
+				return name, DefaultBranchHead, nil
+			}
+			return matching[0].Name, DefaultBranchHead, nil
+		}
+	}
+
+	if name, ok := preferredBranch(branches, opts.Preferred); ok {
+		return name, DefaultBranchPreferred, nil
+	}
+	if opts.FirstBranch {
+		return branches[0].Name, DefaultBranchFirst, nil
+	}
+
+	return "", "", fmt.Errorf("no default branch found: remote does not advertise HEAD and has none of %v", opts.Preferred)
+}
+
+// preferredBranch returns the first preferred name present in branches
+func preferredBranch(branches []Reference, preferred []string) (string, bool) {
+	for _, name := range preferred {
+		for _, ref := range branches {
+			if ref.Name == "refs/heads/"+name {
+				return ref.Name, true
+			}
+		}
+	}
+	return "", false
 }
 
 // GetReference finds a reference by name
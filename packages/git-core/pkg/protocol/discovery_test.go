@@ -347,3 +347,108 @@ func encodePktLines(lines ...string) []byte {
 
 	return buf.Bytes()
 }
+
+func TestResolveDefaultBranch(t *testing.T) {
+	const (
+		a = "1111111111111111111111111111111111111111"
+		b = "2222222222222222222222222222222222222222"
+	)
+	branches := func(names ...string) []Reference {
+		refs := []Reference{}
+		for _, name := range names {
+			refs = append(refs, Reference{Name: "refs/heads/" + name, Hash: b})
+		}
+		return refs
+	}
+
+	tests := []struct {
+		name       string
+		symrefs    map[string]string
+		refs       []Reference
+		opts       BranchFallbackOptions
+		wantBranch string
+		wantSource DefaultBranchSource
+		wantErr    bool
+	}{
+		{
+			name:       "symref",
+			symrefs:    map[string]string{"HEAD": "refs/heads/trunk"},
+			refs:       branches("main", "trunk"),
+			opts:       DefaultBranchFallbackOptions(),
+			wantBranch: "refs/heads/trunk",
+			wantSource: DefaultBranchSymref,
+		},
+		{
+			name:       "head commit",
+			refs:       append([]Reference{{Name: "HEAD", Hash: a}, {Name: "refs/heads/dev", Hash: a}}, branches("main")...),
+			opts:       DefaultBranchFallbackOptions(),
+			wantBranch: "refs/heads/dev",
+			wantSource: DefaultBranchHead,
+		},
+		{
+			name:       "head commit prefers names",
+			refs:       append([]Reference{{Name: "HEAD", Hash: b}}, branches("dev", "master", "main")...),
+			opts:       DefaultBranchFallbackOptions(),
+			wantBranch: "refs/heads/main",
+			wantSource: DefaultBranchHead,
+		},
+		{
+			name:       "main before master",
+			refs:       branches("master", "main"),
+			opts:       DefaultBranchFallbackOptions(),
+			wantBranch: "refs/heads/main",
+			wantSource: DefaultBranchPreferred,
+		},
+		{
+			name:       "master",
+			refs:       branches("dev", "master"),
+			opts:       DefaultBranchFallbackOptions(),
+			wantBranch: "refs/heads/master",
+			wantSource: DefaultBranchPreferred,
+		},
+		{
+			name:       "first branch",
+			refs:       append([]Reference{{Name: "refs/tags/v1", Hash: a}}, branches("dev", "release")...),
+			opts:       DefaultBranchFallbackOptions(),
+			wantBranch: "refs/heads/dev",
+			wantSource: DefaultBranchFirst,
+		},
+		{
+			name:       "custom preference",
+			refs:       branches("main", "trunk"),
+			opts:       BranchFallbackOptions{Preferred: []string{"trunk"}},
+			wantBranch: "refs/heads/trunk",
+			wantSource: DefaultBranchPreferred,
+		},
+		{
+			name:    "no first branch",
+			refs:    branches("dev"),
+			opts:    BranchFallbackOptions{Preferred: []string{"main"}},
+			wantErr: true,
+		},
+		{
+			name:    "no branches",
+			refs:    []Reference{{Name: "refs/tags/v1", Hash: a}},
+			opts:    DefaultBranchFallbackOptions(),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			symrefs := tt.symrefs
+			if symrefs == nil {
+				symrefs = map[string]string{}
+			}
+			discovery := &DiscoveryResponse{SymRefs: symrefs, References: tt.refs}
+
+			branch, source, err := discovery.ResolveDefaultBranch(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveDefaultBranch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if branch != tt.wantBranch || source != tt.wantSource {
+				t.Errorf("ResolveDefaultBranch() = %q, %q, want %q, %q", branch, source, tt.wantBranch, tt.wantSource)
+			}
+		})
+	}
+}
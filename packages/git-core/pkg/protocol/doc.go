@@ -0,0 +1,27 @@
+// Package protocol implements the Git smart HTTP protocol: pkt-line
+// framing, reference discovery, fetch negotiation and push, and reading
+// and writing packfiles and deltas. Fetching speaks protocol v2 (ls-refs
+// and the fetch command) with servers that offer it, and v0 otherwise.
+//
+// Everything that parses data from a remote enforces a [Limits] budget, so
+// a hostile server cannot exhaust memory. [DefaultLimits] suits typical
+// repositories.
+//
+// # Stability
+//
+// The wire formats are frozen: they keep their names and signatures for
+// all v0.x and v1 releases.
+//
+//   - [EncodePktLine], [EncodeFlushPkt], [DecodePktLine], [PktLineReader],
+//     [PktLineWriter] and their constructors
+//   - [PackfileReader], [PackfileWriter], [PackfileObject], [Packfile] and
+//     their constructors
+//   - [ParseDelta], [ApplyDelta], [CreateDelta] and [EncodeDelta]
+//   - [Limits], [DefaultLimits] and [LimitError]
+//   - [Reference]
+//
+// The HTTP clients ([Client], [UploadPackClient], [ReceivePackClient]) and
+// the negotiation types are experimental and may change in a minor
+// release. Most programs should use them through
+// the repository package.
+package protocol
@@ -28,6 +28,13 @@ var (
 
 	// ErrNetworkError indicates a network connectivity issue
 	ErrNetworkError = errors.New("network error")
+
+	// ErrLimitExceeded indicates input that exceeded a configured Limits value
+	ErrLimitExceeded = errors.New("limit exceeded")
+
+	// ErrCorruptPack indicates a packfile whose data does not match its
+	// checksums or object IDs
+	ErrCorruptPack = errors.New("corrupt packfile")
 )
 
 // ProtocolError represents a Git protocol error with additional context
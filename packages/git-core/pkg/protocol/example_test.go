@@ -0,0 +1,44 @@
+package protocol_test
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+// Frame and unframe pkt-lines
+func ExampleEncodePktLineString() {
+	data := append(protocol.EncodePktLineString("want 1234\n"), protocol.EncodeFlushPkt()...)
+	fmt.Printf("%q\n", data)
+
+	payload, rest, err := protocol.DecodePktLine(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%q %q\n", payload, rest)
+	// Output:
+	// "000ewant 1234\n0000"
+	// "want 1234\n" "0000"
+}
+
+// Encode a delta and apply it to its base
+func ExampleCreateDelta() {
+	base := []byte("the quick brown fox\n")
+	target := []byte("the quick brown fox jumps\n")
+
+	encoded, err := protocol.EncodeDelta(protocol.CreateDelta(base, target))
+	if err != nil {
+		log.Fatal(err)
+	}
+	delta, err := protocol.ParseDelta(encoded)
+	if err != nil {
+		log.Fatal(err)
+	}
+	result, err := protocol.ApplyDelta(base, delta)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(string(result))
+	// Output: the quick brown fox jumps
+}
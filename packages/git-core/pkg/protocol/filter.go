@@ -0,0 +1,83 @@
+package protocol
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// limitPattern matches a blob:limit size such as "1024", "1k" or "10m"
+var limitPattern = regexp.MustCompile(`^[0-9]+[kKmMgG]?$`)
+
+// ParseFilterSpec parses a partial clone filter-spec such as "blob:none",
+// "blob:limit=1m" or "tree:0" into the form used by NegotiationRequest.Filters:
+// the filter kind maps to its argument ("blob" -> "none").
+// Multiple filters can be given as "combine:<spec>+<spec>".
+func ParseFilterSpec(spec string) (map[string]string, error) {
+	filters := make(map[string]string)
+
+	specs := []string{spec}
+	if strings.HasPrefix(spec, "combine:") {
+		specs = strings.Split(strings.TrimPrefix(spec, "combine:"), "+")
+	}
+
+	for _, part := range specs {
+		part, err := url.PathUnescape(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter-spec %q: %w", spec, err)
+		}
+
+		kind, arg, found := strings.Cut(part, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid filter-spec %q", part)
+		}
+
+		switch kind {
+		case "blob":
+			if arg != "none" && !(strings.HasPrefix(arg, "limit=") && limitPattern.MatchString(strings.TrimPrefix(arg, "limit="))) {
+				return nil, fmt.Errorf("invalid blob filter %q", part)
+			}
+		case "tree":
+			if !limitPattern.MatchString(arg) || strings.ContainsAny(arg, "kKmMgG") {
+				return nil, fmt.Errorf("invalid tree filter %q", part)
+			}
+		case "object":
+			switch arg {
+			case "type=blob", "type=tree", "type=commit", "type=tag":
+			default:
+				return nil, fmt.Errorf("invalid object filter %q", part)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported filter %q", part)
+		}
+
+		if _, exists := filters[kind]; exists {
+			return nil, fmt.Errorf("duplicate %s filter in %q", kind, spec)
+		}
+		filters[kind] = arg
+	}
+
+	return filters, nil
+}
+
+// FormatFilterSpec renders filters as a filter-spec, combining multiple
+// filters in a stable order
+func FormatFilterSpec(filters map[string]string) string {
+	kinds := make([]string, 0, len(filters))
+	for kind := range filters {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	if len(kinds) == 1 {
+		return kinds[0] + ":" + filters[kinds[0]]
+	}
+
+	parts := make([]string, len(kinds))
+	for i, kind := range kinds {
+		parts[i] = url.PathEscape(kind + ":" + filters[kind])
+	}
+	return "combine:" + strings.Join(parts, "+")
+}
@@ -0,0 +1,61 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFilterSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{spec: "blob:none", want: "blob:none"},
+		{spec: "blob:limit=1k", want: "blob:limit=1k"},
+		{spec: "tree:0", want: "tree:0"},
+		{spec: "object:type=commit", want: "object:type=commit"},
+		{spec: "combine:blob:none+tree:1", want: "combine:blob:none+tree:1"},
+		{spec: "blob:limit=lots", wantErr: true},
+		{spec: "tree:1k", wantErr: true},
+		{spec: "sparse:oid=abc", wantErr: true},
+		{spec: "blob", wantErr: true},
+		{spec: "combine:blob:none+blob:limit=1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			filters, err := ParseFilterSpec(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseFilterSpec(%q) expected error", tt.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFilterSpec(%q) unexpected error: %v", tt.spec, err)
+			}
+
+			if got := FormatFilterSpec(filters); got != tt.want {
+				t.Errorf("FormatFilterSpec() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeFilterRequest(t *testing.T) {
+	req := &NegotiationRequest{
+		Wants:   []string{"abc1234567890123456789012345678901234567"},
+		Filters: map[string]string{"blob": "none"},
+		Done:    true,
+	}
+
+	result, err := encodeNegotiationRequest(req)
+	if err != nil {
+		t.Fatalf("encodeNegotiationRequest() error: %v", err)
+	}
+
+	if !strings.Contains(string(result), "0015filter blob:none\n0000") {
+		t.Errorf("encodeNegotiationRequest() = %q, missing filter line", result)
+	}
+}
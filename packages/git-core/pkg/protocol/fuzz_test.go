@@ -0,0 +1,114 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+// fuzzLimits keeps fuzzed packfiles from allocating much memory
+var fuzzLimits = Limits{
+	MaxResponseSize:     1 << 20,
+	MaxObjectSize:       1 << 20,
+	MaxCompressionRatio: 256,
+	MaxUnpackSize:       4 << 20,
+	MaxDeltaDepth:       50,
+}
+
+func FuzzPktLineReader(f *testing.F) {
+	f.Add([]byte("0009hello0000"))
+	f.Add([]byte("000100020000"))
+	f.Add([]byte("0004"))
+	f.Add([]byte("ffff"))
+	f.Add([]byte("-001"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		reader := NewPktLineReader(bytes.NewReader(data))
+		// Each line consumes at least its header, so this always ends
+		for i := 0; i <= len(data)/PktLineHeaderLength; i++ {
+			if _, err := reader.ReadLine(); err != nil {
+				return
+			}
+		}
+		if _, err := reader.ReadLine(); err == nil {
+			t.Fatal("ReadLine() returned a line past the end of the input")
+		}
+	})
+}
+
+func FuzzDecodePktLines(f *testing.F) {
+	f.Add([]byte("0009hello0008abcd0000"))
+	f.Add([]byte("00010002"))
+	f.Add([]byte("0003"))
+	f.Add([]byte("+003"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		lines, err := DecodePktLines(data)
+		if err != nil {
+			return
+		}
+		if len(lines)*PktLineHeaderLength > len(data) {
+			t.Fatalf("decoded %d lines from %d bytes", len(lines), len(data))
+		}
+		for _, line := range lines {
+			if len(line) > PktLineMaxLength-PktLineHeaderLength {
+				t.Fatalf("decoded a %d byte line", len(line))
+			}
+		}
+	})
+}
+
+func FuzzParseDelta(f *testing.F) {
+	base := []byte("the quick brown fox jumps over the lazy dog")
+	for _, target := range []string{"the quick red fox", "", "jumps over the lazy dog, the quick brown fox"} {
+		encoded, err := CreateAndEncodeDelta(base, []byte(target))
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(encoded)
+	}
+	f.Add([]byte{0x2b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+	f.Add([]byte{0x2b, 0x05, 0x80})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		delta, err := ParseDelta(data)
+		if err != nil {
+			return
+		}
+		result, err := ApplyDeltaWithLimits(base, delta, fuzzLimits)
+		if err != nil {
+			return
+		}
+		if uint64(len(result)) != delta.TargetSize {
+			t.Fatalf("result has %d bytes, delta declared %d", len(result), delta.TargetSize)
+		}
+	})
+}
+
+func FuzzPackfileReader(f *testing.F) {
+	var buf bytes.Buffer
+	objects := []PackfileObject{
+		{Type: ObjBlob, Size: 5, Data: []byte("hello")},
+		{Type: ObjCommit, Size: 3, Data: []byte("abc")},
+	}
+	if err := NewPackfileWriter(&buf).WritePackfile(objects); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(buf.Bytes())
+	f.Add(buildPackfileHeader(2, 0))
+	f.Add(append(buildPackfileHeader(2, 1), 0xff, 0xff, 0xff))
+	f.Add(append(buildPackfileHeader(2, 1), 0x65, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		reader := NewPackfileReader(bytes.NewReader(data))
+		reader.SetLimits(fuzzLimits)
+		pack, err := reader.ReadPackfile()
+		if err != nil {
+			return
+		}
+		for i, obj := range pack.Objects {
+			if obj.Type == ObjOfsDelta {
+				ResolveOfsDeltaWithLimits(pack.Objects, i, fuzzLimits)
+			}
+		}
+	})
+}
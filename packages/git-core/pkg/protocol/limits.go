@@ -0,0 +1,172 @@
+package protocol
+
+import (
+	"fmt"
+	"io"
+)
+
+// compressionRatioFloor is the decompressed size below which the
+// compression ratio is not checked, since small objects of repeated
+// content legitimately compress very well
+const compressionRatioFloor = 1 << 20
+
+// maxDeltaDepth is the deepest delta chain Git itself writes
+const maxDeltaDepth = 4095
+
+// Limits caps how much a remote can make the client read and inflate, so a
+// malicious server cannot exhaust the browser tab's memory with huge
+// responses or crafted packfiles. A zero value disables that limit.
+type Limits struct {
+	// MaxResponseSize caps the bytes read from a single HTTP response
+	MaxResponseSize int64
+	// MaxObjectSize caps a packed object's size, both as declared in its
+	// header and after decompression, and the target size of deltas
+	MaxObjectSize uint64
+	// MaxCompressionRatio caps an object's decompressed size relative to
+	// its compressed size, once it exceeds 1 MiB
+	MaxCompressionRatio uint64
+	// MaxUnpackSize caps the total decompressed size of a packfile
+	MaxUnpackSize uint64
+	// MaxDeltaDepth caps the number of deltas in a chain
+	MaxDeltaDepth int
+}
+
+// DefaultLimits returns limits generous enough for real repositories that
+// still fit a browser tab's memory
+func DefaultLimits() Limits {
+	return Limits{
+		MaxResponseSize:     1 << 30,
+		MaxObjectSize:       256 << 20,
+		MaxCompressionRatio: 256,
+		MaxUnpackSize:       1 << 30,
+		MaxDeltaDepth:       maxDeltaDepth,
+	}
+}
+
+// LimitError reports input that exceeded one of the Limits
+type LimitError struct {
+	// Limit names the limit, e.g. "object size"
+	Limit string
+	// Value is the size that was reached or declared
+	Value uint64
+	// Max is the configured limit
+	Max uint64
+}
+
+// Error implements the error interface
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: %s %d exceeds limit of %d", ErrLimitExceeded, e.Limit, e.Value, e.Max)
+}
+
+// Unwrap returns ErrLimitExceeded
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// limitedReader reads from r and fails once more than max bytes are read,
+// instead of silently truncating like io.LimitReader
+type limitedReader struct {
+	r     io.Reader
+	read  int64
+	max   int64
+	limit string
+}
+
+// newLimitedReader returns r unchanged when max is not positive
+func newLimitedReader(r io.Reader, max int64, limit string) io.Reader {
+	if max <= 0 {
+		return r
+	}
+	return &limitedReader{r: r, max: max, limit: limit}
+}
+
+// Read implements io.Reader
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.read > l.max {
+		return 0, &LimitError{Limit: l.limit, Value: uint64(l.read), Max: uint64(l.max)}
+	}
+	// Read one byte past the limit to tell an exact fit from an overrun
+	if remaining := l.max - l.read + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.max {
+		return n, &LimitError{Limit: l.limit, Value: uint64(l.read), Max: uint64(l.max)}
+	}
+	return n, err
+}
+
+// countingReader counts the bytes read through it, and hashes them when
+// sum is set. It is an io.ByteReader so zlib does not wrap it in a buffer
+// and read past a compressed stream.
+type countingReader struct {
+	r     io.Reader
+	count int64
+	sum   io.Writer
+	b     [1]byte
+}
+
+// Read implements io.Reader
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.count += int64(n)
+	if c.sum != nil {
+		c.sum.Write(p[:n])
+	}
+	return n, err
+}
+
+// ReadByte implements io.ByteReader
+func (c *countingReader) ReadByte() (byte, error) {
+	if br, ok := c.r.(io.ByteReader); ok {
+		b, err := br.ReadByte()
+		if err != nil {
+			return b, err
+		}
+		c.b[0] = b
+	} else if _, err := io.ReadFull(c.r, c.b[:]); err != nil {
+		return 0, err
+	}
+	c.count++
+	if c.sum != nil {
+		c.sum.Write(c.b[:])
+	}
+	return c.b[0], nil
+}
+
+// inflateGuard wraps a decompressor and enforces the object size,
+// compression ratio and total unpack size limits while data is produced
+type inflateGuard struct {
+	r        io.Reader
+	source   *countingReader
+	start    int64
+	produced uint64
+	unpacked *uint64
+	limits   Limits
+}
+
+// Read implements io.Reader
+func (g *inflateGuard) Read(p []byte) (int, error) {
+	n, err := g.r.Read(p)
+	g.produced += uint64(n)
+	*g.unpacked += uint64(n)
+
+	if max := g.limits.MaxObjectSize; max > 0 && g.produced > max {
+		return n, &LimitError{Limit: "object size", Value: g.produced, Max: max}
+	}
+	if max := g.limits.MaxUnpackSize; max > 0 && *g.unpacked > max {
+		return n, &LimitError{Limit: "unpack size", Value: *g.unpacked, Max: max}
+	}
+	if max := g.limits.MaxCompressionRatio; max > 0 && g.produced > compressionRatioFloor {
+		compressed := uint64(g.source.count - g.start)
+		if compressed == 0 || g.produced/compressed > max {
+			ratio := g.produced
+			if compressed > 0 {
+				ratio = g.produced / compressed
+			}
+			return n, &LimitError{Limit: "compression ratio", Value: ratio, Max: max}
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,217 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// buildLimitsPackfile writes a packfile of blobs, each declaring the given size
+func buildLimitsPackfile(t *testing.T, declared uint64, blobs ...[]byte) []byte {
+	t.Helper()
+	objects := make([]PackfileObject, len(blobs))
+	for i, data := range blobs {
+		objects[i] = PackfileObject{Type: ObjBlob, Size: declared, Data: data}
+	}
+	var buf bytes.Buffer
+	if err := NewPackfileWriter(&buf).WritePackfile(objects); err != nil {
+		t.Fatalf("WritePackfile() error: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// readWithLimits parses a packfile and returns the limit error, if any
+func readWithLimits(data []byte, limits Limits) (*LimitError, error) {
+	reader := NewPackfileReader(bytes.NewReader(data))
+	reader.SetLimits(limits)
+	_, err := reader.ReadPackfile()
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		return limitErr, err
+	}
+	return nil, err
+}
+
+func TestPackfileLimits(t *testing.T) {
+	bomb := bytes.Repeat([]byte{0}, 4<<20)
+	small := bytes.Repeat([]byte("x"), 600)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		limits    Limits
+		wantLimit string
+	}{
+		{
+			name:      "declared object size",
+			data:      buildLimitsPackfile(t, 2<<20, []byte("tiny")),
+			limits:    Limits{MaxObjectSize: 1 << 20},
+			wantLimit: "object size",
+		},
+		{
+			name:      "inflated object size",
+			data:      buildLimitsPackfile(t, 10, bomb),
+			limits:    Limits{MaxObjectSize: 1 << 20},
+			wantLimit: "object size",
+		},
+		{
+			name:      "compression ratio",
+			data:      buildLimitsPackfile(t, uint64(len(bomb)), bomb),
+			limits:    Limits{MaxCompressionRatio: 256},
+			wantLimit: "compression ratio",
+		},
+		{
+			name:      "unpack size",
+			data:      buildLimitsPackfile(t, uint64(len(small)), small, small),
+			limits:    Limits{MaxUnpackSize: 1000},
+			wantLimit: "unpack size",
+		},
+		{
+			name:   "within limits",
+			data:   buildLimitsPackfile(t, uint64(len(small)), small, small),
+			limits: DefaultLimits(),
+		},
+		{
+			name:   "disabled",
+			data:   buildLimitsPackfile(t, uint64(len(bomb)), bomb),
+			limits: Limits{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limitErr, err := readWithLimits(tt.data, tt.limits)
+			if tt.wantLimit == "" {
+				if err != nil {
+					t.Fatalf("ReadPackfile() error: %v", err)
+				}
+				return
+			}
+			if limitErr == nil || limitErr.Limit != tt.wantLimit {
+				t.Fatalf("ReadPackfile() error = %v, want %s limit", err, tt.wantLimit)
+			}
+			if !errors.Is(err, ErrLimitExceeded) {
+				t.Errorf("error %v does not wrap ErrLimitExceeded", err)
+			}
+		})
+	}
+}
+
+func TestPackfileMalformedSizes(t *testing.T) {
+	// An object size header that never ends
+	data := append(buildPackfileHeader(2, 1), bytes.Repeat([]byte{0xff}, 16)...)
+	if _, err := NewPackfileReader(bytes.NewReader(data)).ReadPackfile(); err == nil {
+		t.Error("Expected an error for an overlong size header")
+	}
+
+	// An offset delta base offset that never ends
+	data = append(buildPackfileHeader(2, 1), 0x60)
+	data = append(data, bytes.Repeat([]byte{0xff}, 16)...)
+	if _, err := NewPackfileReader(bytes.NewReader(data)).ReadPackfile(); err == nil || !strings.Contains(err.Error(), "too long") {
+		t.Errorf("Expected an error for an overlong delta offset, got %v", err)
+	}
+
+	// A huge object count must not be allocated up front
+	data = buildPackfileHeader(2, 0xffffffff)
+	if _, err := NewPackfileReader(bytes.NewReader(data)).ReadPackfile(); err == nil {
+		t.Error("Expected an error for a truncated packfile")
+	}
+}
+
+func TestLimitedReader(t *testing.T) {
+	data, err := io.ReadAll(newLimitedReader(strings.NewReader("12345"), 5, "response size"))
+	if err != nil || string(data) != "12345" {
+		t.Errorf("Exact fit: got %q, %v", data, err)
+	}
+
+	_, err = io.ReadAll(newLimitedReader(strings.NewReader("123456"), 5, "response size"))
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "response size" || limitErr.Max != 5 {
+		t.Errorf("Overrun: got %v", err)
+	}
+}
+
+func TestClientResponseLimit(t *testing.T) {
+	body := strings.Repeat("x", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Streamed responses carry no length, so only the reader can stop them
+		if r.URL.Path == "/chunked" {
+			w.(http.Flusher).Flush()
+		}
+		io.WriteString(w, body)
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.SetLimits(Limits{MaxResponseSize: 100})
+
+	for _, path := range []string{"/sized", "/chunked"} {
+		if _, err := client.DownloadBundle(server.URL + path); !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("%s: expected a limit error, got %v", path, err)
+		}
+	}
+
+	client.SetLimits(DefaultLimits())
+	data, err := client.DownloadBundle(server.URL + "/sized")
+	if err != nil || len(data) != len(body) {
+		t.Errorf("Expected the full body, got %d bytes, %v", len(data), err)
+	}
+}
+
+func TestDeltaLimits(t *testing.T) {
+	base := []byte("hello world")
+
+	// A target larger than the object size limit is refused before applying
+	huge := &Delta{SourceSize: uint64(len(base)), TargetSize: 2 << 20, Instructions: []DeltaInstruction{&CopyInstruction{Offset: 0, Size: 5}}}
+	_, err := ApplyDeltaWithLimits(base, huge, Limits{MaxObjectSize: 1 << 20})
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "delta target size" {
+		t.Errorf("Expected a delta target size error, got %v", err)
+	}
+
+	// Without limits, an absurd declared size must not be allocated
+	absurd := &Delta{SourceSize: uint64(len(base)), TargetSize: 1 << 62}
+	if _, err := ApplyDeltaWithLimits(base, absurd, Limits{}); err == nil {
+		t.Error("Expected a size mismatch error")
+	}
+
+	// Instructions producing more than declared stop at the first overrun
+	copies := make([]DeltaInstruction, 1000)
+	for i := range copies {
+		copies[i] = &CopyInstruction{Offset: 0, Size: uint64(len(base))}
+	}
+	overrun := &Delta{SourceSize: uint64(len(base)), TargetSize: 20, Instructions: copies}
+	if _, err := ApplyDeltaWithLimits(base, overrun, DefaultLimits()); err == nil || !strings.Contains(err.Error(), "instruction 1 exceeds") {
+		t.Errorf("Expected an overrun error at instruction 1, got %v", err)
+	}
+}
+
+func TestDeltaChainDepth(t *testing.T) {
+	// Each delta appends a byte to the object before it
+	objects := []PackfileObject{{Type: ObjBlob, Data: []byte("base")}}
+	expected := "base"
+	for i := 1; i <= 5; i++ {
+		target := expected + "+"
+		encoded, err := EncodeDelta(CreateDelta([]byte(expected), []byte(target)))
+		if err != nil {
+			t.Fatalf("EncodeDelta() error: %v", err)
+		}
+		objects = append(objects, PackfileObject{Type: ObjOfsDelta, IsDelta: true, Offset: int64(i - 1), PackOffset: int64(i), Data: encoded})
+		expected = target
+	}
+
+	data, err := ResolveOfsDeltaWithLimits(objects, 5, Limits{MaxDeltaDepth: 5})
+	if err != nil || string(data) != expected {
+		t.Fatalf("ResolveOfsDeltaWithLimits() = %q, %v, want %q", data, err, expected)
+	}
+
+	_, err = ResolveOfsDeltaWithLimits(objects, 5, Limits{MaxDeltaDepth: 3})
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "delta chain depth" || limitErr.Max != 3 {
+		t.Errorf("Expected a delta chain depth error, got %v", err)
+	}
+}
@@ -10,21 +10,30 @@ import (
 
 // NegotiationRequest represents a client's want/have negotiation request
 type NegotiationRequest struct {
-	Wants        []string          // Commit hashes the client wants
-	Haves        []string          // Commit hashes the client already has
-	Capabilities []string          // Capabilities to request
-	Deepen       int               // Depth for shallow clone (0 for full clone)
-	Filters      map[string]string // Object filters (for partial clones)
-	Done         bool              // Whether negotiation is complete
+	Wants          []string          // Commit hashes the client wants
+	Haves          []string          // Commit hashes the client already has
+	Shallows       []string          // Shallow boundary commits the client already has
+	Capabilities   []string          // Capabilities to request
+	Deepen         int               // Depth for shallow clone (0 for full clone)
+	DeepenRelative bool              // Count Deepen from the current shallow boundary
+	DeepenSince    int64             // Cut history at this Unix timestamp (0 for none)
+	DeepenNot      []string          // Cut history at commits reachable from these refs
+	Filters        map[string]string // Object filters (for partial clones)
+	Done           bool              // Whether negotiation is complete
 }
 
 // NegotiationResponse represents the server's response to negotiation
 type NegotiationResponse struct {
-	ACKs      []ACK  // Acknowledgments from server
-	NAK       bool   // Whether server sent NAK (negative acknowledgment)
-	Packfile  []byte // Packfile data (if negotiation complete)
-	SideBand  bool   // Whether response uses side-band protocol
-	ErrorMsg  string // Error message if any
+	ACKs       []ACK    // Acknowledgments from server
+	NAK        bool     // Whether server sent NAK (negative acknowledgment)
+	Packfile   []byte   // Packfile data (if negotiation complete)
+	Shallows   []string // Commits the server made shallow boundaries
+	Unshallows []string // Former boundaries whose parents are now included
+	SideBand   bool     // Whether response uses side-band protocol
+	ErrorMsg   string   // Error message if any
+	// PackStreamed is set when the packfile went to the client's pack
+	// handler as it arrived, rather than into Packfile
+	PackStreamed bool
 }
 
 // ACKStatus represents the status of an ACK
@@ -49,8 +58,11 @@ type ACK struct {
 
 // UploadPackClient handles the upload-pack protocol (fetch/clone)
 type UploadPackClient struct {
-	client  *Client
-	repoURL string
+	client   *Client
+	repoURL  string
+	version  int
+	progress func(message string)
+	pack     func(pack io.Reader) error
 }
 
 // NewUploadPackClient creates a new upload-pack client
@@ -61,6 +73,26 @@ func NewUploadPackClient(client *Client, repoURL string) *UploadPackClient {
 	}
 }
 
+// SetProtocolVersion selects the protocol the requests are framed in: 2
+// for the v2 fetch command, which needs a server that advertised it, and
+// otherwise v0. Clients start with v0.
+func (u *UploadPackClient) SetProtocolVersion(version int) {
+	u.version = version
+}
+
+// SetProgressCallback sets where the progress and error messages the
+// server sends on the side-band go, one line at a time
+func (u *UploadPackClient) SetProgressCallback(callback func(message string)) {
+	u.progress = callback
+}
+
+// SetPackHandler makes the packfile ending a fetch go to handler as it is
+// received, so it need not be held in memory whole. The handler reads the
+// pack from the response body; the response's Packfile is left empty.
+func (u *UploadPackClient) SetPackHandler(handler func(pack io.Reader) error) {
+	u.pack = handler
+}
+
 // Negotiate performs the want/have negotiation with the server
 func (u *UploadPackClient) Negotiate(req *NegotiationRequest) (*NegotiationResponse, error) {
 	// Build the upload-pack URL
@@ -70,9 +102,14 @@ func (u *UploadPackClient) Negotiate(req *NegotiationRequest) (*NegotiationRespo
 	}
 
 	// Encode the request body
-	requestBody, err := encodeNegotiationRequest(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to encode request: %w", err)
+	var requestBody []byte
+	if u.version == 2 {
+		requestBody = encodeFetchCommand(req)
+	} else {
+		requestBody, err = encodeNegotiationRequest(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
 	}
 
 	// Create the HTTP request
@@ -85,7 +122,9 @@ func (u *UploadPackClient) Negotiate(req *NegotiationRequest) (*NegotiationRespo
 	httpReq.Header.Set("User-Agent", u.client.userAgent)
 	httpReq.Header.Set("Content-Type", "application/x-git-upload-pack-request")
 	httpReq.Header.Set("Accept", "application/x-git-upload-pack-result")
-	httpReq.Header.Set("Git-Protocol", "version=2")
+	if u.version == 2 {
+		httpReq.Header.Set("Git-Protocol", "version=2")
+	}
 
 	// Apply authentication
 	if err := u.client.authProvider.ApplyAuth(httpReq); err != nil {
@@ -99,14 +138,24 @@ func (u *UploadPackClient) Negotiate(req *NegotiationRequest) (*NegotiationRespo
 	}
 	defer resp.Body.Close()
 
+	respBody, err := u.client.responseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
+		body, _ := io.ReadAll(respBody)
 		return nil, fmt.Errorf("negotiation failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
 	// Parse the response
-	negotiationResp, err := parseNegotiationResponse(resp.Body, req.Done, hasSideBandCapability(req.Capabilities))
+	var negotiationResp *NegotiationResponse
+	if u.version == 2 {
+		negotiationResp, err = parseFetchCommandResponse(respBody, u.progress, u.pack)
+	} else {
+		negotiationResp, err = parseNegotiationResponse(respBody, req.Done, hasSideBandCapability(req.Capabilities), req.isShallow(), u.progress, u.pack)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse negotiation response: %w", err)
 	}
@@ -116,14 +165,26 @@ func (u *UploadPackClient) Negotiate(req *NegotiationRequest) (*NegotiationRespo
 
 // FetchPackfile performs a complete negotiation and fetches the packfile
 func (u *UploadPackClient) FetchPackfile(wants []string, haves []string, capabilities []string) ([]byte, error) {
-	// Build negotiation request
-	req := &NegotiationRequest{
+	resp, err := u.Fetch(&NegotiationRequest{
 		Wants:        wants,
 		Haves:        haves,
 		Capabilities: capabilities,
-		Done:         true, // Complete negotiation in one round
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	// Return packfile data
+	return resp.Packfile, nil
+}
+
+// Fetch completes a negotiation in one round and returns the full response,
+// including the shallow boundaries for requests that limit history
+func (u *UploadPackClient) Fetch(req *NegotiationRequest) (*NegotiationResponse, error) {
+	// Complete negotiation in one round
+	req.Done = true
+	req.Capabilities = fetchCapabilities(req)
+
 	// Perform negotiation
 	resp, err := u.Negotiate(req)
 	if err != nil {
@@ -135,8 +196,35 @@ func (u *UploadPackClient) FetchPackfile(wants []string, haves []string, capabil
 		return nil, fmt.Errorf("server error: %s", resp.ErrorMsg)
 	}
 
-	// Return packfile data
-	return resp.Packfile, nil
+	return resp, nil
+}
+
+// fetchCapabilities returns the request's capabilities plus those its
+// history options need
+func fetchCapabilities(req *NegotiationRequest) []string {
+	// Shallow requests need the server to report boundary changes
+	capabilities := append([]string{}, req.Capabilities...)
+	if req.isShallow() && !containsCapability(capabilities, "shallow") {
+		capabilities = append(capabilities, "shallow")
+	}
+	if req.DeepenRelative && !containsCapability(capabilities, "deepen-relative") {
+		capabilities = append(capabilities, "deepen-relative")
+	}
+	if req.DeepenSince > 0 && !containsCapability(capabilities, "deepen-since") {
+		capabilities = append(capabilities, "deepen-since")
+	}
+	if len(req.DeepenNot) > 0 && !containsCapability(capabilities, "deepen-not") {
+		capabilities = append(capabilities, "deepen-not")
+	}
+	if len(req.Filters) > 0 && !containsCapability(capabilities, "filter") {
+		capabilities = append(capabilities, "filter")
+	}
+	return capabilities
+}
+
+// isShallow reports whether the request limits or extends shallow history
+func (req *NegotiationRequest) isShallow() bool {
+	return req.Deepen > 0 || req.DeepenSince > 0 || len(req.DeepenNot) > 0 || len(req.Shallows) > 0
 }
 
 // buildUploadPackURL constructs the upload-pack service URL
@@ -171,6 +259,14 @@ func encodeNegotiationRequest(req *NegotiationRequest) ([]byte, error) {
 		}
 	}
 
+	// Tell the server where our history is cut off
+	for _, shallow := range req.Shallows {
+		line := fmt.Sprintf("shallow %s\n", shallow)
+		if err := writer.WriteString(line); err != nil {
+			return nil, err
+		}
+	}
+
 	// Handle deepen for shallow clones
 	if req.Deepen > 0 {
 		line := fmt.Sprintf("deepen %d\n", req.Deepen)
@@ -179,6 +275,34 @@ func encodeNegotiationRequest(req *NegotiationRequest) ([]byte, error) {
 		}
 	}
 
+	if req.DeepenRelative {
+		if err := writer.WriteString("deepen-relative\n"); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.DeepenSince > 0 {
+		line := fmt.Sprintf("deepen-since %d\n", req.DeepenSince)
+		if err := writer.WriteString(line); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, ref := range req.DeepenNot {
+		line := fmt.Sprintf("deepen-not %s\n", ref)
+		if err := writer.WriteString(line); err != nil {
+			return nil, err
+		}
+	}
+
+	// Ask the server to omit objects for partial clones
+	if len(req.Filters) > 0 {
+		line := fmt.Sprintf("filter %s\n", FormatFilterSpec(req.Filters))
+		if err := writer.WriteString(line); err != nil {
+			return nil, err
+		}
+	}
+
 	// Write flush after wants
 	if err := writer.WriteFlush(); err != nil {
 		return nil, err
@@ -209,8 +333,12 @@ func encodeNegotiationRequest(req *NegotiationRequest) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// parseNegotiationResponse parses the server's negotiation response
-func parseNegotiationResponse(body io.Reader, done bool, sideBand bool) (*NegotiationResponse, error) {
+// parseNegotiationResponse parses the server's negotiation response,
+// passing the server's side-band messages to progress and the packfile to
+// pack if it is set. shallow reports whether the request was shallow, in
+// which case the response opens with a flush-terminated shallow-info
+// section, possibly empty
+func parseNegotiationResponse(body io.Reader, done bool, sideBand bool, shallow bool, progress func(message string), pack func(io.Reader) error) (*NegotiationResponse, error) {
 	reader := NewPktLineReader(body)
 	response := &NegotiationResponse{
 		ACKs:     []ACK{},
@@ -219,10 +347,11 @@ func parseNegotiationResponse(body io.Reader, done bool, sideBand bool) (*Negoti
 
 	// If side-band is enabled, we need to demultiplex the stream
 	if sideBand {
-		return parseSideBandResponse(reader, done)
+		return parseSideBandResponse(reader, done, shallow, progress, pack)
 	}
 
 	// Standard response parsing
+	shallowInfo := shallow
 	for {
 		line, err := reader.ReadLine()
 		if err != nil {
@@ -232,8 +361,13 @@ func parseNegotiationResponse(body io.Reader, done bool, sideBand bool) (*Negoti
 			return nil, fmt.Errorf("failed to read line: %w", err)
 		}
 
-		// Flush packet signals end of ACKs
+		// Flush packet signals end of ACKs, unless it only ended the
+		// shallow-info section that precedes them
 		if line == nil {
+			if shallowInfo {
+				shallowInfo = false
+				continue
+			}
 			break
 		}
 
@@ -241,14 +375,26 @@ func parseNegotiationResponse(body io.Reader, done bool, sideBand bool) (*Negoti
 		lineStr = strings.TrimSuffix(lineStr, "\n")
 
 		// Parse ACK lines
-		if strings.HasPrefix(lineStr, "ACK ") {
+		if parseShallowLine(lineStr, response) {
+			continue
+		} else if strings.HasPrefix(lineStr, "ACK ") {
 			ack, err := parseACKLine(lineStr)
 			if err != nil {
 				return nil, err
 			}
 			response.ACKs = append(response.ACKs, ack)
+
+			// The final ACK after "done" is followed directly by the packfile
+			if done && ack.Status == ACKSingle {
+				break
+			}
 		} else if lineStr == "NAK" {
 			response.NAK = true
+
+			// After "done" the packfile follows without a flush
+			if done {
+				break
+			}
 		} else if strings.HasPrefix(lineStr, "ERR ") {
 			response.ErrorMsg = strings.TrimPrefix(lineStr, "ERR ")
 			return response, nil
@@ -257,26 +403,33 @@ func parseNegotiationResponse(body io.Reader, done bool, sideBand bool) (*Negoti
 
 	// If negotiation is done, read the packfile data
 	if done {
-		packfile, err := io.ReadAll(reader.reader)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read packfile: %w", err)
+		if err := readPackData(reader, response, progress, pack); err != nil {
+			return nil, err
 		}
-		response.Packfile = packfile
 	}
 
 	return response, nil
 }
 
 // parseSideBandResponse parses a side-band multiplexed response
-func parseSideBandResponse(reader *PktLineReader, done bool) (*NegotiationResponse, error) {
+func parseSideBandResponse(reader *PktLineReader, done bool, shallow bool, progress func(message string), pack func(io.Reader) error) (*NegotiationResponse, error) {
 	response := &NegotiationResponse{
 		ACKs:     []ACK{},
 		SideBand: true,
 	}
 
-	var packfileBuf bytes.Buffer
-
+	demux := newSideBandDemuxer(progress)
+	shallowInfo := shallow
 	for {
+		// A server that did not take up side-band sends a raw pack
+		if done && demux.data.Len() == 0 && peekRawPack(reader) {
+			if err := readPackData(reader, response, progress, pack); err != nil {
+				return nil, err
+			}
+			response.SideBand = false
+			return response, nil
+		}
+
 		line, err := reader.ReadLine()
 		if err != nil {
 			if err == io.EOF {
@@ -285,8 +438,12 @@ func parseSideBandResponse(reader *PktLineReader, done bool) (*NegotiationRespon
 			return nil, fmt.Errorf("failed to read side-band line: %w", err)
 		}
 
-		// Flush packet signals end
+		// Flush packet signals end, unless it only ended the shallow-info section
 		if line == nil {
+			if shallowInfo {
+				shallowInfo = false
+				continue
+			}
 			break
 		}
 
@@ -294,28 +451,46 @@ func parseSideBandResponse(reader *PktLineReader, done bool) (*NegotiationRespon
 			continue
 		}
 
-		// First byte is the channel
-		channel := line[0]
-		data := line[1:]
-
-		switch channel {
-		case 1: // Packfile data
-			packfileBuf.Write(data)
-		case 2: // Progress messages (stderr)
-			// Progress messages can be logged or ignored
-			// fmt.Fprintf(os.Stderr, "%s", string(data))
-		case 3: // Error messages
-			response.ErrorMsg = string(data)
+		// Shallow info and ACK/NAK lines precede the multiplexed packfile
+		lineStr := strings.TrimSuffix(string(line), "\n")
+		if parseShallowLine(lineStr, response) {
+			continue
+		}
+		if lineStr == "NAK" {
+			response.NAK = true
+			continue
+		}
+		if strings.HasPrefix(lineStr, "ACK ") {
+			ack, err := parseACKLine(lineStr)
+			if err != nil {
+				return nil, err
+			}
+			response.ACKs = append(response.ACKs, ack)
+			continue
+		}
+		if strings.HasPrefix(lineStr, "ERR ") {
+			response.ErrorMsg = strings.TrimPrefix(lineStr, "ERR ")
 			return response, nil
-		default:
-			return nil, fmt.Errorf("unknown side-band channel: %d", channel)
 		}
-	}
 
-	if done && packfileBuf.Len() > 0 {
-		response.Packfile = packfileBuf.Bytes()
+		// After done, the first multiplexed packet starts the packfile
+		if done {
+			if err := readSideBandPack(reader, line, response, progress, pack); err != nil {
+				return nil, err
+			}
+			return response, nil
+		}
+
+		// First byte is the channel
+		if err := demux.write(line); err != nil {
+			return nil, err
+		}
+		if demux.errorMsg != "" {
+			break
+		}
 	}
 
+	response.ErrorMsg = demux.close()
 	return response, nil
 }
 
@@ -349,6 +524,30 @@ func parseACKLine(line string) (ACK, error) {
 	return ack, nil
 }
 
+// parseShallowLine records a "shallow" or "unshallow" line from the
+// shallow-info section and reports whether the line was one
+func parseShallowLine(line string, response *NegotiationResponse) bool {
+	if strings.HasPrefix(line, "shallow ") {
+		response.Shallows = append(response.Shallows, strings.TrimSpace(strings.TrimPrefix(line, "shallow ")))
+		return true
+	}
+	if strings.HasPrefix(line, "unshallow ") {
+		response.Unshallows = append(response.Unshallows, strings.TrimSpace(strings.TrimPrefix(line, "unshallow ")))
+		return true
+	}
+	return false
+}
+
+// containsCapability checks if a capability list contains a capability
+func containsCapability(capabilities []string, name string) bool {
+	for _, cap := range capabilities {
+		if cap == name {
+			return true
+		}
+	}
+	return false
+}
+
 // hasSideBandCapability checks if side-band capability is requested
 func hasSideBandCapability(capabilities []string) bool {
 	for _, cap := range capabilities {
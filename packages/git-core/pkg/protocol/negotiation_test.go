@@ -64,6 +64,40 @@ func TestEncodeNegotiationRequest(t *testing.T) {
 				"0000" +
 				"0009done\n",
 		},
+		{
+			name: "deepen existing shallow clone",
+			req: &NegotiationRequest{
+				Wants:        []string{"abc1234567890123456789012345678901234567"},
+				Shallows:     []string{"123abc4567890123456789012345678901234567"},
+				Capabilities: []string{"shallow"},
+				Deepen:       2,
+				Done:         true,
+			},
+			expected: "003awant abc1234567890123456789012345678901234567 shallow\n" +
+				"0035shallow 123abc4567890123456789012345678901234567\n" +
+				"000ddeepen 2\n" +
+				"0000" +
+				"0009done\n",
+		},
+		{
+			name: "deepen relative, since and not",
+			req: &NegotiationRequest{
+				Wants:          []string{"abc1234567890123456789012345678901234567"},
+				Capabilities:   []string{"shallow"},
+				Deepen:         3,
+				DeepenRelative: true,
+				DeepenSince:    1700000000,
+				DeepenNot:      []string{"refs/heads/old"},
+				Done:           true,
+			},
+			expected: "003awant abc1234567890123456789012345678901234567 shallow\n" +
+				"000ddeepen 3\n" +
+				"0014deepen-relative\n" +
+				"001cdeepen-since 1700000000\n" +
+				"001edeepen-not refs/heads/old\n" +
+				"0000" +
+				"0009done\n",
+		},
 		{
 			name: "incomplete negotiation",
 			req: &NegotiationRequest{
@@ -225,7 +259,7 @@ func TestParseNegotiationResponse(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			resp, err := parseNegotiationResponse(bytes.NewReader(tt.response), tt.done, tt.sideBand)
+			resp, err := parseNegotiationResponse(bytes.NewReader(tt.response), tt.done, tt.sideBand, false, nil, nil)
 			if err != nil {
 				t.Errorf("parseNegotiationResponse() unexpected error: %v", err)
 				return
@@ -294,7 +328,7 @@ func TestParseSideBandResponse(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			reader := NewPktLineReader(bytes.NewReader(tt.response))
-			resp, err := parseSideBandResponse(reader, tt.done)
+			resp, err := parseSideBandResponse(reader, tt.done, false, nil, nil)
 
 			if err != nil {
 				t.Errorf("parseSideBandResponse() unexpected error: %v", err)
@@ -312,6 +346,104 @@ func TestParseSideBandResponse(t *testing.T) {
 	}
 }
 
+func TestParseShallowResponse(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewPktLineWriter(&buf)
+	writer.WriteString("shallow abc1234567890123456789012345678901234567\n")
+	writer.WriteString("unshallow def4567890123456789012345678901234567890\n")
+	writer.WriteFlush()
+	writer.WriteString("NAK\n")
+	buf.WriteString("PACKdata")
+
+	resp, err := parseNegotiationResponse(bytes.NewReader(buf.Bytes()), true, false, true, nil, nil)
+	if err != nil {
+		t.Fatalf("parseNegotiationResponse() unexpected error: %v", err)
+	}
+
+	if len(resp.Shallows) != 1 || resp.Shallows[0] != "abc1234567890123456789012345678901234567" {
+		t.Errorf("Shallows = %v", resp.Shallows)
+	}
+	if len(resp.Unshallows) != 1 || resp.Unshallows[0] != "def4567890123456789012345678901234567890" {
+		t.Errorf("Unshallows = %v", resp.Unshallows)
+	}
+	if !resp.NAK {
+		t.Error("expected NAK")
+	}
+	if string(resp.Packfile) != "PACKdata" {
+		t.Errorf("Packfile = %q, want %q", resp.Packfile, "PACKdata")
+	}
+}
+
+func TestParseShallowSideBandResponse(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewPktLineWriter(&buf)
+	writer.WriteString("shallow abc1234567890123456789012345678901234567\n")
+	writer.WriteFlush()
+	writer.WriteString("NAK\n")
+	buf.Write(buildSideBandResponse([]sideBandLine{
+		{channel: 1, data: []byte("PACK")},
+	}))
+
+	resp, err := parseNegotiationResponse(bytes.NewReader(buf.Bytes()), true, true, true, nil, nil)
+	if err != nil {
+		t.Fatalf("parseNegotiationResponse() unexpected error: %v", err)
+	}
+
+	if len(resp.Shallows) != 1 {
+		t.Errorf("Shallows = %v, want 1 entry", resp.Shallows)
+	}
+	if string(resp.Packfile) != "PACK" {
+		t.Errorf("Packfile = %q, want %q", resp.Packfile, "PACK")
+	}
+}
+
+func TestParseEmptyShallowInfo(t *testing.T) {
+	for _, sideBand := range []bool{false, true} {
+		var buf bytes.Buffer
+		writer := NewPktLineWriter(&buf)
+		writer.WriteFlush()
+		writer.WriteString("NAK\n")
+		if sideBand {
+			buf.Write(buildSideBandResponse([]sideBandLine{
+				{channel: 1, data: []byte("PACK")},
+			}))
+		} else {
+			buf.WriteString("PACK")
+		}
+
+		resp, err := parseNegotiationResponse(bytes.NewReader(buf.Bytes()), true, sideBand, true, nil, nil)
+		if err != nil {
+			t.Fatalf("parseNegotiationResponse(sideBand=%v) unexpected error: %v", sideBand, err)
+		}
+		if len(resp.Shallows) != 0 || len(resp.Unshallows) != 0 {
+			t.Errorf("sideBand=%v: Shallows = %v, Unshallows = %v, want none", sideBand, resp.Shallows, resp.Unshallows)
+		}
+		if !resp.NAK {
+			t.Errorf("sideBand=%v: expected NAK", sideBand)
+		}
+		if string(resp.Packfile) != "PACK" {
+			t.Errorf("sideBand=%v: Packfile = %q, want %q", sideBand, resp.Packfile, "PACK")
+		}
+	}
+}
+
+func TestParseSideBandErrorLine(t *testing.T) {
+	for _, done := range []bool{false, true} {
+		var buf bytes.Buffer
+		writer := NewPktLineWriter(&buf)
+		writer.WriteString("ERR upload-pack: not our ref abc1234567890123456789012345678901234567\n")
+
+		resp, err := parseNegotiationResponse(bytes.NewReader(buf.Bytes()), done, true, false, nil, nil)
+		if err != nil {
+			t.Fatalf("parseNegotiationResponse(done=%v) unexpected error: %v", done, err)
+		}
+		want := "upload-pack: not our ref abc1234567890123456789012345678901234567"
+		if resp.ErrorMsg != want {
+			t.Errorf("done=%v: ErrorMsg = %q, want %q", done, resp.ErrorMsg, want)
+		}
+	}
+}
+
 func TestHasSideBandCapability(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -0,0 +1,102 @@
+package protocol
+
+import "fmt"
+
+// Negotiator chooses the commits a fetch offers the server as haves. The
+// server acknowledges those it has, so only the history the client is
+// missing needs to be sent.
+type Negotiator interface {
+	// NextHaves returns up to n more commits to offer, or none when the
+	// client has nothing left worth offering
+	NextHaves(n int) []string
+	// Ack records that the server has a commit, and so all its ancestors
+	Ack(hash string)
+}
+
+const (
+	// initialHaveBatch is the number of haves offered in the first round
+	initialHaveBatch = 16
+	// largeHaveBatch is the round size after which rounds grow slower
+	largeHaveBatch = 16384
+	// maxInVain is how many haves may go unacknowledged after the first
+	// common commit before the search for more is given up
+	maxInVain = 256
+)
+
+// nextHaveBatch returns the size of the round after one of n haves:
+// doubling at first, then growing by a tenth, as git does
+func nextHaveBatch(n int) int {
+	if n < largeHaveBatch {
+		return n * 2
+	}
+	return n * 11 / 10
+}
+
+// FetchNegotiated negotiates the common history with the server in rounds
+// before fetching. Each round offers the negotiator's next batch of haves
+// along with every common commit found so far, as a stateless server
+// remembers nothing between requests. Negotiation ends when the server is
+// ready, the haves run out, or too many in a row go unacknowledged; the
+// packfile is then requested with the common commits as haves.
+func (u *UploadPackClient) FetchNegotiated(req *NegotiationRequest, negotiator Negotiator) (*NegotiationResponse, error) {
+	common := []string{}
+	isCommon := make(map[string]bool)
+	batch := initialHaveBatch
+	inVain := 0
+
+	for {
+		haves := negotiator.NextHaves(batch)
+		if len(haves) == 0 {
+			break
+		}
+
+		round := *req
+		round.Haves = append(append([]string{}, common...), haves...)
+		round.Capabilities = fetchCapabilities(req)
+		round.Done = false
+		resp, err := u.Negotiate(&round)
+		if err != nil {
+			return nil, err
+		}
+		if resp.ErrorMsg != "" {
+			return nil, fmt.Errorf("server error: %s", resp.ErrorMsg)
+		}
+
+		// A v2 server that is ready sends the packfile straight away
+		if resp.Packfile != nil || resp.PackStreamed {
+			return resp, nil
+		}
+
+		ready := false
+		acked := false
+		for _, ack := range resp.ACKs {
+			if ack.Status == ACKReady {
+				ready = true
+			}
+			if ack.Hash == "" || isCommon[ack.Hash] {
+				continue
+			}
+			isCommon[ack.Hash] = true
+			common = append(common, ack.Hash)
+			negotiator.Ack(ack.Hash)
+			acked = true
+		}
+		if ready {
+			break
+		}
+
+		if acked {
+			inVain = 0
+		} else {
+			inVain += len(haves)
+		}
+		if len(common) > 0 && inVain > maxInVain {
+			break
+		}
+		batch = nextHaveBatch(batch)
+	}
+
+	final := *req
+	final.Haves = common
+	return u.Fetch(&final)
+}
@@ -0,0 +1,173 @@
+package protocol
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// listNegotiator offers a fixed list of haves in order
+type listNegotiator struct {
+	haves []string
+	acks  []string
+}
+
+func (n *listNegotiator) NextHaves(count int) []string {
+	if count > len(n.haves) {
+		count = len(n.haves)
+	}
+	haves := n.haves[:count]
+	n.haves = n.haves[count:]
+	return haves
+}
+
+func (n *listNegotiator) Ack(hash string) {
+	n.acks = append(n.acks, hash)
+}
+
+// testHave returns the i-th have of a test negotiation
+func testHave(i int) string {
+	return fmt.Sprintf("%040x", i)
+}
+
+// newNegotiationServer serves a v0 upload-pack that has the given haves,
+// acknowledging them with multi_ack_detailed and saying it is ready once
+// it has seen one if ready is set. The request bodies are appended to
+// requests.
+func newNegotiationServer(t *testing.T, has map[string]bool, ready bool, requests *[]string) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*requests = append(*requests, string(body))
+
+		writer := NewPktLineWriter(w)
+		last := ""
+		for _, line := range strings.Split(string(body), "\n") {
+			if i := strings.Index(line, "have "); i >= 0 && has[line[i+5:]] {
+				last = line[i+5:]
+				if !strings.HasSuffix(string(body), "done\n") {
+					writer.WriteString("ACK " + last + " common\n")
+				}
+			}
+		}
+
+		if strings.HasSuffix(string(body), "done\n") {
+			if last != "" {
+				writer.WriteString("ACK " + last + "\n")
+			} else {
+				writer.WriteString("NAK\n")
+			}
+			writer.WriteLine([]byte("\x01PACKdata"))
+			writer.WriteFlush()
+			return
+		}
+		if ready && last != "" {
+			writer.WriteString("ACK " + last + " ready\n")
+		}
+		writer.WriteString("NAK\n")
+	}))
+}
+
+// TestFetchNegotiated tests that haves are offered in growing rounds until
+// the server is ready or stops finding common commits
+func TestFetchNegotiated(t *testing.T) {
+	t.Run("ready", func(t *testing.T) {
+		has := map[string]bool{}
+		haves := []string{}
+		for i := 1; i <= 60; i++ {
+			haves = append(haves, testHave(i))
+			if i >= 20 {
+				has[testHave(i)] = true
+			}
+		}
+
+		var requests []string
+		server := newNegotiationServer(t, has, true, &requests)
+		defer server.Close()
+
+		negotiator := &listNegotiator{haves: haves}
+		client := NewUploadPackClient(NewClient(), server.URL+"/repo.git")
+		resp, err := client.FetchNegotiated(&NegotiationRequest{
+			Wants:        []string{testHave(100)},
+			Capabilities: BuildCapabilities(),
+		}, negotiator)
+		if err != nil {
+			t.Fatalf("FetchNegotiated() error: %v", err)
+		}
+		if string(resp.Packfile) != "PACKdata" {
+			t.Errorf("Packfile = %q", resp.Packfile)
+		}
+
+		// Rounds of 16 and 32 haves, then the request for the pack
+		if len(requests) != 3 {
+			t.Fatalf("Expected 3 requests, got %d: %q", len(requests), requests)
+		}
+		if strings.Count(requests[0], "have ") != 16 || strings.Count(requests[1], "have ") != 32 {
+			t.Errorf("Unexpected rounds %q", requests[:2])
+		}
+		if len(negotiator.acks) != 29 || negotiator.acks[0] != testHave(20) {
+			t.Errorf("Unexpected acks %q", negotiator.acks)
+		}
+
+		// Only the common commits are offered with done
+		final := requests[2]
+		if !strings.HasSuffix(final, "done\n") || strings.Count(final, "have ") != 29 || strings.Contains(final, "have "+testHave(19)) {
+			t.Errorf("Unexpected final request %q", final)
+		}
+	})
+
+	t.Run("in vain", func(t *testing.T) {
+		haves := []string{}
+		for i := 1; i <= 600; i++ {
+			haves = append(haves, testHave(i))
+		}
+
+		var requests []string
+		server := newNegotiationServer(t, map[string]bool{testHave(20): true}, false, &requests)
+		defer server.Close()
+
+		negotiator := &listNegotiator{haves: haves}
+		client := NewUploadPackClient(NewClient(), server.URL+"/repo.git")
+		if _, err := client.FetchNegotiated(&NegotiationRequest{
+			Wants:        []string{testHave(1000)},
+			Capabilities: BuildCapabilities(),
+		}, negotiator); err != nil {
+			t.Fatalf("FetchNegotiated() error: %v", err)
+		}
+
+		// Rounds of 16, 32, 64, 128 and 256 haves: after the common
+		// commit, 448 went unacknowledged
+		if len(requests) != 6 {
+			t.Fatalf("Expected 6 requests, got %d", len(requests))
+		}
+		for _, request := range requests[2:5] {
+			if !strings.Contains(request, "have "+testHave(20)) {
+				t.Error("Expected the common commit to be offered in every later round")
+			}
+		}
+		if strings.Count(requests[5], "have ") != 1 {
+			t.Errorf("Expected only the common commit with done, got %q", requests[5])
+		}
+	})
+
+	t.Run("nothing to offer", func(t *testing.T) {
+		var requests []string
+		server := newNegotiationServer(t, map[string]bool{}, false, &requests)
+		defer server.Close()
+
+		client := NewUploadPackClient(NewClient(), server.URL+"/repo.git")
+		if _, err := client.FetchNegotiated(&NegotiationRequest{
+			Wants:        []string{testHave(1)},
+			Capabilities: BuildCapabilities(),
+		}, &listNegotiator{}); err != nil {
+			t.Fatalf("FetchNegotiated() error: %v", err)
+		}
+		if len(requests) != 1 || !strings.HasSuffix(requests[0], "done\n") {
+			t.Errorf("Expected a single request, got %q", requests)
+		}
+	})
+}
@@ -1,12 +1,15 @@
 package protocol
 
 import (
+	"bufio"
 	"bytes"
 	"compress/zlib"
-	"crypto/sha1"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
 )
 
 // Packfile constants
@@ -20,7 +23,8 @@ const (
 	// PackfileHeaderSize is the size of the packfile header (signature + version + count)
 	PackfileHeaderSize = 12
 
-	// PackfileChecksumSize is the size of the SHA-1 checksum at the end
+	// PackfileChecksumSize is the size of the SHA-1 checksum at the end.
+	// A SHA-256 pack ends with a checksum of its hasher's size instead.
 	PackfileChecksumSize = 20
 )
 
@@ -47,8 +51,9 @@ type PackfileObject struct {
 	Type         uint8  // Object type (1-7)
 	Size         uint64 // Uncompressed size
 	Data         []byte // Decompressed object data
-	Offset       int64  // Offset in packfile (for OFS_DELTA)
-	BaseHash     []byte // Base object hash (for REF_DELTA, 20 bytes)
+	Offset       int64  // Offset of the base object in the packfile (for OFS_DELTA)
+	PackOffset   int64  // Offset of the object's header in the packfile
+	BaseHash     []byte // Base object hash (for REF_DELTA)
 	IsDelta      bool   // Whether this is a delta object
 }
 
@@ -56,22 +61,65 @@ type PackfileObject struct {
 type Packfile struct {
 	Header   PackfileHeader
 	Objects  []PackfileObject
-	Checksum []byte // SHA-1 checksum of packfile
+	Checksum []byte // Trailing checksum of packfile
+
+	hasher hash.Hasher // Hasher the pack was read with
 }
 
-// PackfileReader reads and parses packfiles
+// PackfileReader reads and parses packfiles. It counts the compressed bytes
+// it consumes, so each object's offset, and the offset of an OFS_DELTA's
+// base, is its exact position in the pack.
 type PackfileReader struct {
-	reader   io.Reader
-	offset   int64
+	reader   *countingReader
+	sum      *hash.IncrementalHasher // Checksum of the pack so far, when read from its start
+	hasher   hash.Hasher
+	hashSize int
 	checksum []byte
+	limits   Limits
+	unpacked uint64
 }
 
-// NewPackfileReader creates a new packfile reader
+// NewPackfileReader creates a new packfile reader enforcing DefaultLimits
 func NewPackfileReader(r io.Reader) *PackfileReader {
-	return &PackfileReader{
-		reader: r,
-		offset: 0,
+	return NewPackfileReaderAt(r, 0)
+}
+
+// NewPackfileReaderAt creates a packfile reader for a pack read from the
+// given offset on, so objects are read from the middle of a pack at their
+// offsets in it. A reader that is not an io.ByteReader is buffered, and
+// may then be read past the end of the pack.
+func NewPackfileReaderAt(r io.Reader, offset int64) *PackfileReader {
+	if _, ok := r.(io.ByteReader); !ok {
+		r = bufio.NewReader(r)
 	}
+	reader := &PackfileReader{
+		reader: &countingReader{r: r, count: offset},
+		limits: DefaultLimits(),
+	}
+	reader.SetHasher(hash.NewSHA1())
+	return reader
+}
+
+// SetHasher sets the hash algorithm of the pack's object format, which
+// sizes REF_DELTA base IDs and computes the pack's trailing checksum. It
+// must be set before anything is read.
+func (r *PackfileReader) SetHasher(hasher hash.Hasher) {
+	r.hasher = hasher
+	r.hashSize = hasher.Size()
+	if r.reader.count == 0 {
+		r.sum = hash.NewIncrementalHasher(hasher)
+		r.reader.sum = r.sum
+	}
+}
+
+// Offset returns the offset in the pack of the next byte to be read
+func (r *PackfileReader) Offset() int64 {
+	return r.reader.count
+}
+
+// SetLimits sets the size limits enforced while reading
+func (r *PackfileReader) SetLimits(limits Limits) {
+	r.limits = limits
 }
 
 // ReadPackfile reads and parses a complete packfile
@@ -82,8 +130,9 @@ func (r *PackfileReader) ReadPackfile() (*Packfile, error) {
 		return nil, fmt.Errorf("failed to read packfile header: %w", err)
 	}
 
-	// Read all objects
-	objects := make([]PackfileObject, 0, header.ObjectCount)
+	// Read all objects. The count is untrusted, so it only bounds the
+	// initial allocation rather than sizing it.
+	objects := make([]PackfileObject, 0, min(header.ObjectCount, 4096))
 	for i := uint32(0); i < header.ObjectCount; i++ {
 		obj, err := r.ReadObject()
 		if err != nil {
@@ -93,26 +142,51 @@ func (r *PackfileReader) ReadPackfile() (*Packfile, error) {
 	}
 
 	// Read checksum
-	checksum := make([]byte, PackfileChecksumSize)
-	if _, err := io.ReadFull(r.reader, checksum); err != nil {
-		return nil, fmt.Errorf("failed to read checksum: %w", err)
+	checksum, err := r.ReadChecksum()
+	if err != nil {
+		return nil, err
 	}
 
 	return &Packfile{
 		Header:   *header,
 		Objects:  objects,
 		Checksum: checksum,
+		hasher:   r.hasher,
 	}, nil
 }
 
+// ReadChecksum reads the checksum that ends the packfile, after its
+// objects. When the pack was read from its start, the checksum must match
+// everything read before it, or a *CorruptPackError is returned.
+func (r *PackfileReader) ReadChecksum() ([]byte, error) {
+	offset := r.reader.count
+	var actual hash.Hash
+	if r.sum != nil {
+		// The checksum does not cover itself
+		r.reader.sum = nil
+		sum, err := r.sum.Sum()
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute checksum: %w", err)
+		}
+		actual = sum
+	}
+
+	checksum := make([]byte, r.hashSize)
+	if _, err := io.ReadFull(r.reader, checksum); err != nil {
+		return nil, fmt.Errorf("failed to read checksum: %w", err)
+	}
+	if actual != nil && !bytes.Equal(actual, checksum) {
+		return nil, &CorruptPackError{What: "pack checksum", Offset: offset, Expected: checksum, Actual: actual}
+	}
+	return checksum, nil
+}
+
 // ReadHeader reads the packfile header
 func (r *PackfileReader) ReadHeader() (*PackfileHeader, error) {
 	headerBytes := make([]byte, PackfileHeaderSize)
-	n, err := io.ReadFull(r.reader, headerBytes)
-	if err != nil {
+	if _, err := io.ReadFull(r.reader, headerBytes); err != nil {
 		return nil, err
 	}
-	r.offset += int64(n)
 
 	// Parse signature
 	signature := string(headerBytes[0:4])
@@ -138,7 +212,8 @@ func (r *PackfileReader) ReadHeader() (*PackfileHeader, error) {
 
 // ReadObject reads a single object from the packfile
 func (r *PackfileReader) ReadObject() (*PackfileObject, error) {
-	objOffset := r.offset
+	// OFS_DELTA bases are found back from the object's exact position
+	objOffset := r.reader.count
 
 	// Read type and size header
 	objType, size, err := r.readObjectHeader()
@@ -147,8 +222,9 @@ func (r *PackfileReader) ReadObject() (*PackfileObject, error) {
 	}
 
 	obj := &PackfileObject{
-		Type: objType,
-		Size: size,
+		Type:       objType,
+		Size:       size,
+		PackOffset: objOffset,
 	}
 
 	// Handle different object types
@@ -178,13 +254,11 @@ func (r *PackfileReader) ReadObject() (*PackfileObject, error) {
 		obj.Data = data
 
 	case ObjRefDelta:
-		// Reference delta - read 20-byte SHA-1 of base
-		baseHash := make([]byte, 20)
-		n, err := io.ReadFull(r.reader, baseHash)
-		if err != nil {
+		// Reference delta - read the base's ID
+		baseHash := make([]byte, r.hashSize)
+		if _, err := io.ReadFull(r.reader, baseHash); err != nil {
 			return nil, fmt.Errorf("failed to read ref delta hash: %w", err)
 		}
-		r.offset += int64(n)
 		obj.IsDelta = true
 		obj.BaseHash = baseHash
 
@@ -216,6 +290,9 @@ func (r *PackfileReader) readObjectHeader() (uint8, uint64, error) {
 
 	// Read continuation bytes if MSB is set
 	for firstByte&0x80 != 0 {
+		if shift > 57 {
+			return 0, 0, fmt.Errorf("object size header too long")
+		}
 		b, err := r.readByte()
 		if err != nil {
 			return 0, 0, err
@@ -225,6 +302,11 @@ func (r *PackfileReader) readObjectHeader() (uint8, uint64, error) {
 		firstByte = b
 	}
 
+	// Reject oversized objects before inflating anything
+	if max := r.limits.MaxObjectSize; max > 0 && size > max {
+		return 0, 0, &LimitError{Limit: "object size", Value: size, Max: max}
+	}
+
 	return objType, size, nil
 }
 
@@ -238,6 +320,9 @@ func (r *PackfileReader) readOffsetDeltaOffset() (int64, error) {
 
 	offset := int64(b & 0x7F)
 	for b&0x80 != 0 {
+		if offset > math.MaxInt64>>7-1 {
+			return 0, fmt.Errorf("offset delta offset too long")
+		}
 		b, err = r.readByte()
 		if err != nil {
 			return 0, err
@@ -257,37 +342,45 @@ func (r *PackfileReader) readCompressedData() ([]byte, error) {
 	}
 	defer zlibReader.Close()
 
-	// Read all decompressed data
+	// Read all decompressed data, stopping as soon as a limit is exceeded
+	guard := &inflateGuard{
+		r:        zlibReader,
+		source:   r.reader,
+		start:    r.reader.count,
+		unpacked: &r.unpacked,
+		limits:   r.limits,
+	}
 	var buf bytes.Buffer
-	n, err := io.Copy(&buf, zlibReader)
-	if err != nil {
+	if _, err := io.Copy(&buf, guard); err != nil {
 		return nil, fmt.Errorf("failed to decompress data: %w", err)
 	}
-	r.offset += n // Note: this is compressed size, not exact but close enough
 
 	return buf.Bytes(), nil
 }
 
-// readByte reads a single byte and updates offset
+// readByte reads a single byte
 func (r *PackfileReader) readByte() (byte, error) {
-	b := make([]byte, 1)
-	_, err := io.ReadFull(r.reader, b)
-	if err != nil {
-		return 0, err
-	}
-	r.offset++
-	return b[0], nil
+	return r.reader.ReadByte()
 }
 
-// VerifyChecksum verifies the packfile checksum
+// VerifyChecksum verifies the packfile's checksum against its data, with
+// the hasher it was read with, or SHA-1 for a Packfile made otherwise
 func (p *Packfile) VerifyChecksum(data []byte) error {
-	// Calculate SHA-1 of packfile data (excluding checksum)
-	checksumData := data[:len(data)-PackfileChecksumSize]
-	hash := sha1.Sum(checksumData)
+	hasher := p.hasher
+	if hasher == nil {
+		hasher = hash.NewSHA1()
+	}
+
+	// Calculate the checksum of packfile data (excluding checksum)
+	checksumOffset := len(data) - hasher.Size()
+	if checksumOffset < PackfileHeaderSize {
+		return fmt.Errorf("%w: packfile is too short: %d bytes", ErrCorruptPack, len(data))
+	}
+	sum := hasher.Hash(data[:checksumOffset])
 
 	// Compare with stored checksum
-	if !bytes.Equal(hash[:], p.Checksum) {
-		return fmt.Errorf("checksum mismatch: got %x, expected %x", hash[:], p.Checksum)
+	if !bytes.Equal(sum, p.Checksum) {
+		return &CorruptPackError{What: "pack checksum", Offset: int64(checksumOffset), Expected: p.Checksum, Actual: sum}
 	}
 
 	return nil
@@ -326,7 +419,7 @@ func IsDeltaObject(objType uint8) bool {
 // PackfileWriter writes packfiles
 type PackfileWriter struct {
 	writer   io.Writer
-	hasher   io.Writer // SHA-1 hasher for checksum
+	hasher   hash.Hasher // Hash algorithm of the pack's object format
 	buf      *bytes.Buffer
 	offset   int64
 }
@@ -334,16 +427,21 @@ type PackfileWriter struct {
 // NewPackfileWriter creates a new packfile writer
 func NewPackfileWriter(w io.Writer) *PackfileWriter {
 	buf := &bytes.Buffer{}
-	hasher := sha1.New()
 
 	return &PackfileWriter{
 		writer: w,
-		hasher: hasher,
+		hasher: hash.NewSHA1(),
 		buf:    buf,
 		offset: 0,
 	}
 }
 
+// SetHasher sets the hash algorithm of the pack's object format, which
+// sizes REF_DELTA base IDs and computes the pack's trailing checksum
+func (w *PackfileWriter) SetHasher(hasher hash.Hasher) {
+	w.hasher = hasher
+}
+
 // WritePackfile writes a complete packfile
 func (w *PackfileWriter) WritePackfile(objects []PackfileObject) error {
 	// Write header
@@ -395,6 +493,8 @@ func (w *PackfileWriter) WriteHeader(objectCount uint32) error {
 
 // WriteObject writes a single object to the packfile
 func (w *PackfileWriter) WriteObject(obj *PackfileObject) error {
+	objOffset := w.offset
+
 	// Write object header (type and size)
 	if err := w.writeObjectHeader(obj.Type, obj.Size); err != nil {
 		return fmt.Errorf("failed to write object header: %w", err)
@@ -410,7 +510,7 @@ func (w *PackfileWriter) WriteObject(obj *PackfileObject) error {
 
 	case ObjOfsDelta:
 		// Offset delta - write offset to base
-		if err := w.writeOffsetDeltaOffset(obj.Offset); err != nil {
+		if err := w.writeOffsetDeltaOffset(objOffset - obj.Offset); err != nil {
 			return fmt.Errorf("failed to write offset delta: %w", err)
 		}
 		// Write delta data
@@ -419,9 +519,9 @@ func (w *PackfileWriter) WriteObject(obj *PackfileObject) error {
 		}
 
 	case ObjRefDelta:
-		// Reference delta - write 20-byte SHA-1 of base
-		if len(obj.BaseHash) != 20 {
-			return fmt.Errorf("invalid base hash length: %d (expected 20)", len(obj.BaseHash))
+		// Reference delta - write the base's ID
+		if len(obj.BaseHash) != w.hasher.Size() {
+			return fmt.Errorf("invalid base hash length: %d (expected %d)", len(obj.BaseHash), w.hasher.Size())
 		}
 		n, err := w.buf.Write(obj.BaseHash)
 		if err != nil {
@@ -474,10 +574,9 @@ func (w *PackfileWriter) writeObjectHeader(objType uint8, size uint64) error {
 	return nil
 }
 
-// writeOffsetDeltaOffset writes the offset for OFS_DELTA
-func (w *PackfileWriter) writeOffsetDeltaOffset(offset int64) error {
-	// Convert to positive offset from current position
-	negativeOffset := w.offset - offset
+// writeOffsetDeltaOffset writes the distance from an OFS_DELTA object
+// back to its base
+func (w *PackfileWriter) writeOffsetDeltaOffset(negativeOffset int64) error {
 
 	// Encode using variable-length encoding
 	bytes := []byte{}
@@ -538,13 +637,9 @@ func (w *PackfileWriter) writeByte(b byte) error {
 	return nil
 }
 
-// WriteChecksum writes the SHA-1 checksum of the packfile
+// WriteChecksum writes the checksum of the packfile
 func (w *PackfileWriter) WriteChecksum() error {
-	// The hasher has been computing the checksum as we write
-	// But we need to write the buffered data to it first
-	hasher := sha1.New()
-	hasher.Write(w.buf.Bytes())
-	checksum := hasher.Sum(nil)
+	checksum := w.hasher.Hash(w.buf.Bytes())
 
 	// Write checksum to buffer (not hashed itself)
 	if _, err := w.buf.Write(checksum); err != nil {
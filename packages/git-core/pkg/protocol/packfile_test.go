@@ -5,6 +5,7 @@ import (
 	"compress/zlib"
 	"encoding/binary"
 	"testing"
+	"testing/iotest"
 )
 
 func TestReadPackfileHeader(t *testing.T) {
@@ -779,3 +780,63 @@ func TestPackfileRoundTrip(t *testing.T) {
 		}
 	}
 }
+
+// TestPackfileReaderOffsets tests that objects are read at their exact
+// offsets in the pack, however the pack is read, so offset deltas find
+// their bases
+func TestPackfileReaderOffsets(t *testing.T) {
+	first := bytes.Repeat([]byte("the first object\n"), 50)
+	base := bytes.Repeat([]byte("a line of the base\n"), 50)
+	target := append([]byte("a new first line\n"), base...)
+	delta, err := CreateAndEncodeDelta(base, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The base follows the first object, which compresses to far fewer
+	// bytes than it holds
+	var buf bytes.Buffer
+	objects := []PackfileObject{{Type: ObjBlob, Size: uint64(len(first)), Data: first}}
+	if err := NewPackfileWriter(&buf).WritePackfile(objects); err != nil {
+		t.Fatal(err)
+	}
+	baseOffset := int64(buf.Len() - PackfileChecksumSize)
+	objects = append(objects,
+		PackfileObject{Type: ObjBlob, Size: uint64(len(base)), Data: base},
+		PackfileObject{Type: ObjOfsDelta, Size: uint64(len(delta)), Data: delta, Offset: baseOffset, IsDelta: true},
+	)
+	buf.Reset()
+	if err := NewPackfileWriter(&buf).WritePackfile(objects); err != nil {
+		t.Fatal(err)
+	}
+	pack := buf.Bytes()
+
+	reader := NewPackfileReader(iotest.OneByteReader(bytes.NewReader(pack)))
+	read, err := reader.ReadPackfile()
+	if err != nil {
+		t.Fatalf("ReadPackfile() error: %v", err)
+	}
+	if reader.Offset() != int64(len(pack)) {
+		t.Errorf("Offset() = %d after the checksum, want %d", reader.Offset(), len(pack))
+	}
+	if read.Objects[0].PackOffset != PackfileHeaderSize || read.Objects[1].PackOffset != baseOffset {
+		t.Errorf("PackOffsets = %d, %d, want %d, %d", read.Objects[0].PackOffset, read.Objects[1].PackOffset, PackfileHeaderSize, baseOffset)
+	}
+	if read.Objects[2].Offset != baseOffset {
+		t.Errorf("delta base Offset = %d, want %d", read.Objects[2].Offset, baseOffset)
+	}
+	data, err := ResolveOfsDelta(read.Objects, 2)
+	if err != nil || !bytes.Equal(data, target) {
+		t.Errorf("ResolveOfsDelta() = %q, %v", data, err)
+	}
+
+	// Reading from the middle of the pack gives the same offsets
+	deltaOffset := read.Objects[2].PackOffset
+	obj, err := NewPackfileReaderAt(bytes.NewReader(pack[deltaOffset:]), deltaOffset).ReadObject()
+	if err != nil {
+		t.Fatalf("ReadObject() error: %v", err)
+	}
+	if obj.PackOffset != deltaOffset || obj.Offset != baseOffset {
+		t.Errorf("PackOffset = %d, Offset = %d, want %d, %d", obj.PackOffset, obj.Offset, deltaOffset, baseOffset)
+	}
+}
@@ -0,0 +1,296 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// Pack index constants
+const (
+	// PackIndexSignature is the magic number at the start of a v2 index,
+	// chosen so it cannot be mistaken for a v1 fanout table
+	PackIndexSignature = "\377tOc"
+
+	// PackIndexVersion is the index version written
+	PackIndexVersion = 2
+
+	// packIndexLargeOffset marks a 4-byte offset entry that indexes the
+	// table of 8-byte offsets instead
+	packIndexLargeOffset = 0x80000000
+)
+
+// PackIndexEntry locates one object in a pack
+type PackIndexEntry struct {
+	Hash   []byte // Object ID
+	Offset uint64 // Offset of the object's header in the pack
+	CRC32  uint32 // CRC-32 of the object's bytes in the pack
+}
+
+// PackIndex is the index of a pack: its objects sorted by ID, so one is
+// found with a binary search, as stored in a v2 .idx file
+type PackIndex struct {
+	Entries      []PackIndexEntry // Objects sorted by ID
+	PackChecksum []byte           // Checksum of the indexed pack
+}
+
+// PackBaseLookup returns the type and data of an object a thin pack's
+// deltas are based on, which is not in the pack
+type PackBaseLookup func(id []byte) (objType uint8, data []byte, ok bool)
+
+// IndexPack indexes a packfile like git index-pack: every object is read at
+// its exact offset, deltas are resolved to learn the IDs of the objects
+// they make, and the CRC-32 of each object's packed bytes is kept so it can
+// be checked or copied to another pack without inflating it. The pack must
+// be self-contained; a thin pack's missing bases are an error.
+func IndexPack(data []byte, hasher hash.Hasher, limits Limits) (*PackIndex, error) {
+	return IndexThinPack(data, hasher, limits, nil)
+}
+
+// IndexThinPack indexes a packfile like IndexPack, resolving the deltas
+// whose bases are not in the pack with lookup. The bases found that way
+// are not in the index.
+func IndexThinPack(data []byte, hasher hash.Hasher, limits Limits, lookup PackBaseLookup) (*PackIndex, error) {
+	reader := NewPackfileReader(bytes.NewReader(data))
+	reader.SetHasher(hasher)
+	reader.SetLimits(limits)
+	header, err := reader.ReadHeader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read packfile header: %w", err)
+	}
+
+	// The count is untrusted, so it only bounds the initial allocation
+	count := int(header.ObjectCount)
+	entries := make([]PackIndexEntry, 0, min(count, 4096))
+	objects := make([]*PackfileObject, 0, min(count, 4096))
+	depths := make([]int, 0, min(count, 4096))
+
+	// Deltas waiting for their base, by the base's offset or ID
+	byOffset := make(map[int64][]int)
+	byHash := make(map[string][]int)
+	resolved := []int{}
+
+	for i := 0; i < count; i++ {
+		obj, err := reader.ReadObject()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read object %d: %w", i, err)
+		}
+		entries = append(entries, PackIndexEntry{
+			Offset: uint64(obj.PackOffset),
+			CRC32:  crc32.ChecksumIEEE(data[obj.PackOffset:reader.Offset()]),
+		})
+		objects = append(objects, obj)
+		depths = append(depths, 0)
+
+		switch obj.Type {
+		case ObjOfsDelta:
+			byOffset[obj.Offset] = append(byOffset[obj.Offset], i)
+		case ObjRefDelta:
+			key := string(obj.BaseHash)
+			byHash[key] = append(byHash[key], i)
+		default:
+			resolved = append(resolved, i)
+		}
+	}
+
+	checksum, err := reader.ReadChecksum()
+	if err != nil {
+		return nil, err
+	}
+
+	// apply resolves the deltas based on an object of the given depth
+	remaining := count - len(resolved)
+	apply := func(baseType uint8, baseData []byte, depth int, children []int) error {
+		for _, child := range children {
+			if max := limits.MaxDeltaDepth; max > 0 && depth+1 > max {
+				return &LimitError{Limit: "delta chain depth", Value: uint64(depth + 1), Max: uint64(max)}
+			}
+			delta, err := ParseDelta(objects[child].Data)
+			if err != nil {
+				return fmt.Errorf("failed to parse delta %d: %w", child, err)
+			}
+			result, err := ApplyDeltaWithLimits(baseData, delta, limits)
+			if err != nil {
+				return fmt.Errorf("failed to apply delta %d: %w", child, err)
+			}
+			objects[child].Type = baseType
+			objects[child].Data = result
+			depths[child] = depth + 1
+			resolved = append(resolved, child)
+			remaining--
+		}
+		return nil
+	}
+
+	for {
+		// Hash each resolved object, then resolve the deltas based on it.
+		// An object's data is dropped once its deltas are resolved.
+		for len(resolved) > 0 {
+			i := resolved[len(resolved)-1]
+			resolved = resolved[:len(resolved)-1]
+			base := objects[i]
+			entries[i].Hash = hash.HashObject(hasher, ObjectTypeName(base.Type), base.Data)
+
+			children := append(byOffset[int64(entries[i].Offset)], byHash[string(entries[i].Hash)]...)
+			delete(byOffset, int64(entries[i].Offset))
+			delete(byHash, string(entries[i].Hash))
+			if err := apply(base.Type, base.Data, depths[i], children); err != nil {
+				return nil, err
+			}
+			objects[i] = nil
+		}
+		if remaining == 0 || lookup == nil {
+			break
+		}
+
+		// The deltas left may be based on objects outside a thin pack
+		found := false
+		for key, children := range byHash {
+			baseType, baseData, ok := lookup([]byte(key))
+			if !ok {
+				continue
+			}
+			delete(byHash, key)
+			if err := apply(baseType, baseData, 0, children); err != nil {
+				return nil, err
+			}
+			found = true
+		}
+		if !found {
+			break
+		}
+	}
+
+	if remaining > 0 {
+		for key := range byHash {
+			return nil, fmt.Errorf("failed to resolve delta: base object %x is not in the pack", key)
+		}
+		return nil, fmt.Errorf("failed to resolve %d deltas: base objects are not in the pack", remaining)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].Hash, entries[j].Hash) < 0 })
+	return &PackIndex{Entries: entries, PackChecksum: checksum}, nil
+}
+
+// Find returns the pack offset of the object with the given ID
+func (idx *PackIndex) Find(h []byte) (uint64, bool) {
+	i := sort.Search(len(idx.Entries), func(i int) bool {
+		return bytes.Compare(idx.Entries[i].Hash, h) >= 0
+	})
+	if i < len(idx.Entries) && bytes.Equal(idx.Entries[i].Hash, h) {
+		return idx.Entries[i].Offset, true
+	}
+	return 0, false
+}
+
+// WritePackIndex writes a v2 .idx file: the header, a fanout table counting
+// the IDs up to each first byte, the sorted IDs, their CRC-32s and offsets,
+// the 8-byte offsets that do not fit in 31 bits, and then the pack's
+// checksum and the index's own, both made with the repository's hasher
+func WritePackIndex(w io.Writer, idx *PackIndex, hasher hash.Hasher) error {
+	if len(idx.PackChecksum) != hasher.Size() {
+		return fmt.Errorf("invalid pack checksum in pack index")
+	}
+	sum := hasher.New()
+	out := io.MultiWriter(w, sum)
+
+	var fanout [256]uint32
+	for _, entry := range idx.Entries {
+		if len(entry.Hash) == 0 || len(entry.Hash) != len(idx.Entries[0].Hash) {
+			return fmt.Errorf("invalid object ID %x in pack index", entry.Hash)
+		}
+		fanout[entry.Hash[0]]++
+	}
+	for i := 1; i < len(fanout); i++ {
+		fanout[i] += fanout[i-1]
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(PackIndexSignature)
+	binary.Write(&buf, binary.BigEndian, uint32(PackIndexVersion))
+	binary.Write(&buf, binary.BigEndian, fanout)
+	for _, entry := range idx.Entries {
+		buf.Write(entry.Hash)
+	}
+	for _, entry := range idx.Entries {
+		binary.Write(&buf, binary.BigEndian, entry.CRC32)
+	}
+	large := []uint64{}
+	for _, entry := range idx.Entries {
+		if entry.Offset < packIndexLargeOffset {
+			binary.Write(&buf, binary.BigEndian, uint32(entry.Offset))
+			continue
+		}
+		binary.Write(&buf, binary.BigEndian, uint32(packIndexLargeOffset|len(large)))
+		large = append(large, entry.Offset)
+	}
+	for _, offset := range large {
+		binary.Write(&buf, binary.BigEndian, offset)
+	}
+	buf.Write(idx.PackChecksum)
+
+	if _, err := out.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write pack index: %w", err)
+	}
+	if _, err := w.Write(sum.Sum(nil)); err != nil {
+		return fmt.Errorf("failed to write pack index checksum: %w", err)
+	}
+	return nil
+}
+
+// ReadPackIndex parses a v2 .idx file whose object IDs and checksums were
+// made with hasher, checking its trailing checksum
+func ReadPackIndex(data []byte, hasher hash.Hasher) (*PackIndex, error) {
+	hashSize := hasher.Size()
+	headerSize := 8 + 256*4
+	if len(data) < headerSize+2*hashSize {
+		return nil, fmt.Errorf("pack index is too short: %d bytes", len(data))
+	}
+	if string(data[:4]) != PackIndexSignature {
+		return nil, fmt.Errorf("invalid pack index signature")
+	}
+	if version := binary.BigEndian.Uint32(data[4:8]); version != PackIndexVersion {
+		return nil, fmt.Errorf("unsupported pack index version: %d (expected %d)", version, PackIndexVersion)
+	}
+
+	trailer := len(data) - hashSize
+	if sum := hasher.Hash(data[:trailer]); !bytes.Equal(sum, data[trailer:]) {
+		return nil, fmt.Errorf("pack index checksum mismatch")
+	}
+	trailer -= hashSize
+
+	count := int(binary.BigEndian.Uint32(data[headerSize-4 : headerSize]))
+	ids := headerSize
+	crcs := ids + count*hashSize
+	offsets := crcs + count*4
+	large := offsets + count*4
+	if count < 0 || large > trailer {
+		return nil, fmt.Errorf("pack index is too short for %d objects", count)
+	}
+
+	idx := &PackIndex{
+		Entries:      make([]PackIndexEntry, count),
+		PackChecksum: data[trailer : trailer+hashSize],
+	}
+	for i := range idx.Entries {
+		entry := &idx.Entries[i]
+		entry.Hash = data[ids+i*hashSize : ids+(i+1)*hashSize]
+		entry.CRC32 = binary.BigEndian.Uint32(data[crcs+i*4:])
+		offset := binary.BigEndian.Uint32(data[offsets+i*4:])
+		if offset&packIndexLargeOffset == 0 {
+			entry.Offset = uint64(offset)
+			continue
+		}
+		pos := large + int(offset&^packIndexLargeOffset)*8
+		if pos+8 > trailer {
+			return nil, fmt.Errorf("pack index offset %d is out of range", i)
+		}
+		entry.Offset = binary.BigEndian.Uint64(data[pos:])
+	}
+	return idx, nil
+}
@@ -0,0 +1,186 @@
+package protocol
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// TestIndexPack tests that whole objects and both kinds of delta are
+// indexed under the IDs of the objects they make, at their exact offsets
+func TestIndexPack(t *testing.T) {
+	hasher := hash.NewSHA1()
+	base := []byte(strings.Repeat("a line of the base file\n", 20))
+	middle := append(append([]byte{}, base...), "a line added\n"...)
+	target := append([]byte("a first line\n"), middle...)
+	baseID := hash.HashBlob(hasher, base)
+	middleID := hash.HashBlob(hasher, middle)
+	targetID := hash.HashBlob(hasher, target)
+	toMiddle, err := CreateAndEncodeDelta(base, middle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	toTarget, err := CreateAndEncodeDelta(middle, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The middle version is an offset delta of the base, which is the
+	// first object, and the target a ref delta of the middle one
+	var buf bytes.Buffer
+	err = NewPackfileWriter(&buf).WritePackfile([]PackfileObject{
+		{Type: ObjBlob, Size: uint64(len(base)), Data: base},
+		{Type: ObjRefDelta, Size: uint64(len(toTarget)), Data: toTarget, BaseHash: middleID.Bytes(), IsDelta: true},
+		{Type: ObjOfsDelta, Size: uint64(len(toMiddle)), Data: toMiddle, Offset: PackfileHeaderSize, IsDelta: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pack := buf.Bytes()
+
+	idx, err := IndexPack(pack, hasher, DefaultLimits())
+	if err != nil {
+		t.Fatalf("IndexPack failed: %v", err)
+	}
+	if len(idx.Entries) != 3 || !bytes.Equal(idx.PackChecksum, pack[len(pack)-PackfileChecksumSize:]) {
+		t.Fatalf("Unexpected index %+v", idx)
+	}
+	for i := 1; i < len(idx.Entries); i++ {
+		if bytes.Compare(idx.Entries[i-1].Hash, idx.Entries[i].Hash) >= 0 {
+			t.Error("Expected the entries sorted by ID")
+		}
+	}
+
+	// Each offset leads to an object of the right kind
+	for id, objType := range map[string]uint8{baseID.String(): ObjBlob, targetID.String(): ObjRefDelta, middleID.String(): ObjOfsDelta} {
+		h, _ := hash.ParseHash(id)
+		offset, ok := idx.Find(h)
+		if !ok {
+			t.Fatalf("Object %s is not in the index", id)
+		}
+		obj, err := NewPackfileReader(bytes.NewReader(pack[offset:])).ReadObject()
+		if err != nil || obj.Type != objType {
+			t.Errorf("Object %s at offset %d: type %d, %v", id, offset, obj.Type, err)
+		}
+	}
+	if _, ok := idx.Find(hash.HashBlob(hasher, []byte("absent"))); ok {
+		t.Error("Found an object that is not in the pack")
+	}
+
+	// The .idx file reads back the same
+	var file bytes.Buffer
+	if err := WritePackIndex(&file, idx, hasher); err != nil {
+		t.Fatalf("WritePackIndex failed: %v", err)
+	}
+	read, err := ReadPackIndex(file.Bytes(), hasher)
+	if err != nil {
+		t.Fatalf("ReadPackIndex failed: %v", err)
+	}
+	for i, entry := range read.Entries {
+		want := idx.Entries[i]
+		if !bytes.Equal(entry.Hash, want.Hash) || entry.Offset != want.Offset || entry.CRC32 != want.CRC32 {
+			t.Errorf("Entry %d = %+v, want %+v", i, entry, want)
+		}
+	}
+
+	corrupt := append([]byte{}, file.Bytes()...)
+	corrupt[len(corrupt)/2] ^= 0xff
+	if _, err := ReadPackIndex(corrupt, hasher); err == nil {
+		t.Error("Expected a checksum error for a corrupt index")
+	}
+
+	// A thin pack cannot be indexed
+	buf.Reset()
+	err = NewPackfileWriter(&buf).WritePackfile([]PackfileObject{
+		{Type: ObjRefDelta, Size: uint64(len(toTarget)), Data: toTarget, BaseHash: middleID.Bytes(), IsDelta: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := IndexPack(buf.Bytes(), hasher, DefaultLimits()); err == nil || !strings.Contains(err.Error(), middleID.String()) {
+		t.Errorf("Expected an error naming the missing base, got %v", err)
+	}
+}
+
+// TestPackIndexLargeOffsets tests that offsets past 2 GiB go to the table
+// of 8-byte offsets
+func TestPackIndexLargeOffsets(t *testing.T) {
+	hasher := hash.NewSHA1()
+	idx := &PackIndex{
+		Entries: []PackIndexEntry{
+			{Hash: bytes.Repeat([]byte{0x01}, 20), Offset: 12, CRC32: 1},
+			{Hash: bytes.Repeat([]byte{0x02}, 20), Offset: 5 << 30, CRC32: 2},
+			{Hash: bytes.Repeat([]byte{0xff}, 20), Offset: 1 << 31, CRC32: 3},
+		},
+		PackChecksum: make([]byte, PackfileChecksumSize),
+	}
+	var file bytes.Buffer
+	if err := WritePackIndex(&file, idx, hasher); err != nil {
+		t.Fatalf("WritePackIndex failed: %v", err)
+	}
+	read, err := ReadPackIndex(file.Bytes(), hasher)
+	if err != nil {
+		t.Fatalf("ReadPackIndex failed: %v", err)
+	}
+	for i, entry := range read.Entries {
+		if entry.Offset != idx.Entries[i].Offset || entry.CRC32 != idx.Entries[i].CRC32 {
+			t.Errorf("Entry %d = %+v, want %+v", i, entry, idx.Entries[i])
+		}
+	}
+}
+
+// TestPackIndexSHA256 tests that a SHA-256 pack is indexed with 32-byte
+// checksums and reads back
+func TestPackIndexSHA256(t *testing.T) {
+	hasher := hash.NewSHA256()
+	base := []byte(strings.Repeat("a line of the base file\n", 20))
+	target := append(append([]byte{}, base...), "a line added\n"...)
+	toTarget, err := CreateAndEncodeDelta(base, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	writer := NewPackfileWriter(&buf)
+	writer.SetHasher(hasher)
+	err = writer.WritePackfile([]PackfileObject{
+		{Type: ObjBlob, Size: uint64(len(base)), Data: base},
+		{Type: ObjRefDelta, Size: uint64(len(toTarget)), Data: toTarget, BaseHash: hash.HashBlob(hasher, base).Bytes(), IsDelta: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pack := buf.Bytes()
+
+	idx, err := IndexPack(pack, hasher, DefaultLimits())
+	if err != nil {
+		t.Fatalf("IndexPack failed: %v", err)
+	}
+	if !bytes.Equal(idx.PackChecksum, pack[len(pack)-hasher.Size():]) {
+		t.Errorf("Unexpected pack checksum %x", idx.PackChecksum)
+	}
+
+	var file bytes.Buffer
+	if err := WritePackIndex(&file, idx, hasher); err != nil {
+		t.Fatalf("WritePackIndex failed: %v", err)
+	}
+	read, err := ReadPackIndex(file.Bytes(), hasher)
+	if err != nil {
+		t.Fatalf("ReadPackIndex failed: %v", err)
+	}
+	if !bytes.Equal(read.PackChecksum, idx.PackChecksum) || len(read.Entries) != 2 {
+		t.Fatalf("Unexpected index %+v", read)
+	}
+	for _, content := range [][]byte{base, target} {
+		if _, ok := read.Find(hash.HashBlob(hasher, content)); !ok {
+			t.Errorf("Object %x is not in the index", content[:8])
+		}
+	}
+
+	// A SHA-1 index is not a SHA-256 one
+	if _, err := ReadPackIndex(file.Bytes(), hash.NewSHA1()); err == nil {
+		t.Error("Expected a SHA-256 index to fail as SHA-1")
+	}
+}
@@ -200,8 +200,17 @@ func DecodePktLine(data []byte) (payload []byte, rest []byte, err error) {
 	if length == 0 {
 		return nil, data[PktLineHeaderLength:], nil // Flush packet
 	}
+	if length == 1 {
+		return []byte{0x01}, data[PktLineHeaderLength:], nil // Delimiter packet
+	}
+	if length == 2 {
+		return []byte{0x02}, data[PktLineHeaderLength:], nil // Response end packet
+	}
 
 	// Validate length
+	if length < PktLineHeaderLength || length > PktLineMaxLength {
+		return nil, data, fmt.Errorf("invalid pkt-line length: %d", length)
+	}
 	if int(length) > len(data) {
 		return nil, data, fmt.Errorf("incomplete pkt-line: need %d bytes, have %d", length, len(data))
 	}
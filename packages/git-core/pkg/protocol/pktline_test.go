@@ -83,6 +83,23 @@ func TestDecodePktLine(t *testing.T) {
 			input:        "000a",
 			expectError:  true,
 		},
+		{
+			name:            "delimiter packet",
+			input:           "00010009hello",
+			expectedPayload: "\x01",
+			expectedRest:    "0009hello",
+			expectError:     false,
+		},
+		{
+			name:        "length shorter than header",
+			input:       "0003abc",
+			expectError: true,
+		},
+		{
+			name:        "negative length",
+			input:       "-001abc",
+			expectError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,338 @@
+package protocol
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// LsRefsRequest configures the protocol v2 ls-refs command
+type LsRefsRequest struct {
+	RefPrefixes []string // Only list refs starting with one of these (all refs if empty)
+	Symrefs     bool     // Report the targets of symbolic refs such as HEAD
+	Peel        bool     // Report the objects annotated tags point to
+	Unborn      bool     // Report HEAD's target even if that branch has no commits
+}
+
+// LsRefsResponse contains the refs listed by ls-refs. Peeled tags are
+// listed as extra <tag>^{} references, as in a protocol v0 advertisement.
+type LsRefsResponse struct {
+	References []Reference
+	SymRefs    map[string]string
+}
+
+// v2FetchArguments are the v0 capabilities that protocol v2 sends as
+// arguments of the fetch command instead
+var v2FetchArguments = []string{"thin-pack", "no-progress", "include-tag", "ofs-delta"}
+
+// parseV2Capabilities builds the discovery response of a protocol v2
+// server from its capability advertisement
+func parseV2Capabilities(lines [][]byte, service ServiceType) *DiscoveryResponse {
+	response := &DiscoveryResponse{
+		Service:      service,
+		Capabilities: []string{},
+		References:   []Reference{},
+		SymRefs:      make(map[string]string),
+		Version:      2,
+	}
+	for _, line := range lines {
+		if capability := strings.TrimSuffix(string(line), "\n"); capability != "" {
+			response.Capabilities = append(response.Capabilities, capability)
+		}
+	}
+	return response
+}
+
+// CommandFeatures returns the features a protocol v2 server advertises for
+// a command, such as [shallow filter] for "fetch=shallow filter", and
+// whether it supports the command at all
+func (d *DiscoveryResponse) CommandFeatures(command string) ([]string, bool) {
+	for _, c := range d.Capabilities {
+		if c == command {
+			return []string{}, true
+		}
+		if value, ok := strings.CutPrefix(c, command+"="); ok {
+			return strings.Fields(value), true
+		}
+	}
+	return nil, false
+}
+
+// DiscoverRefs discovers the upload-pack service of a repository with its
+// refs. A protocol v2 server lists them with ls-refs, limited to the refs
+// starting with one of prefixes (all refs if empty), which keeps the
+// advertisement small on large hosts. Older servers always advertise every
+// ref.
+func (c *Client) DiscoverRefs(repoURL string, prefixes []string) (*DiscoveryResponse, error) {
+	discovery, err := c.Discover(repoURL, UploadPackService)
+	if err != nil {
+		return nil, err
+	}
+	if discovery.Version != 2 {
+		return discovery, nil
+	}
+
+	features, ok := discovery.CommandFeatures("ls-refs")
+	if !ok {
+		return nil, fmt.Errorf("server does not support ls-refs")
+	}
+	refs, err := c.LsRefs(repoURL, &LsRefsRequest{
+		RefPrefixes: prefixes,
+		Symrefs:     true,
+		Peel:        true,
+		Unborn:      containsCapability(features, "unborn"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	discovery.References = refs.References
+	discovery.SymRefs = refs.SymRefs
+	return discovery, nil
+}
+
+// LsRefs lists the refs of a protocol v2 server with the ls-refs command
+func (c *Client) LsRefs(repoURL string, req *LsRefsRequest) (*LsRefsResponse, error) {
+	resp, body, err := c.postCommand(repoURL, encodeLsRefsRequest(req, c.userAgent))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	refs, err := parseLsRefsResponse(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ls-refs response: %w", err)
+	}
+	return refs, nil
+}
+
+// postCommand sends a protocol v2 command to the upload-pack service and
+// returns the response with its size-limited body
+func (c *Client) postCommand(repoURL string, body []byte) (*http.Response, io.Reader, error) {
+	uploadPackURL, err := buildUploadPackURL(repoURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid repository URL: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", uploadPackURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("Content-Type", "application/x-git-upload-pack-request")
+	req.Header.Set("Accept", "application/x-git-upload-pack-result")
+	req.Header.Set("Git-Protocol", "version=2")
+
+	if err := c.authProvider.ApplyAuth(req); err != nil {
+		return nil, nil, fmt.Errorf("failed to apply authentication: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, WrapProtocolError(err, 0, repoURL)
+	}
+
+	respBody, err := c.responseBody(resp)
+	if err != nil {
+		resp.Body.Close()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(respBody)
+		resp.Body.Close()
+		return nil, nil, WrapProtocolError(fmt.Errorf("%s", string(data)), resp.StatusCode, repoURL)
+	}
+	return resp, respBody, nil
+}
+
+// encodeCommandRequest frames a protocol v2 command: the command and its
+// capabilities, a delimiter, then the command's arguments
+func encodeCommandRequest(command string, capabilities []string, args []string) []byte {
+	var buf bytes.Buffer
+	writer := NewPktLineWriter(&buf)
+	writer.WriteString("command=" + command + "\n")
+	for _, capability := range capabilities {
+		writer.WriteString(capability + "\n")
+	}
+	writer.WriteDelimiter()
+	for _, arg := range args {
+		writer.WriteString(arg + "\n")
+	}
+	writer.WriteFlush()
+	return buf.Bytes()
+}
+
+// encodeLsRefsRequest encodes an ls-refs command
+func encodeLsRefsRequest(req *LsRefsRequest, agent string) []byte {
+	args := []string{}
+	if req.Peel {
+		args = append(args, "peel")
+	}
+	if req.Symrefs {
+		args = append(args, "symrefs")
+	}
+	if req.Unborn {
+		args = append(args, "unborn")
+	}
+	for _, prefix := range req.RefPrefixes {
+		args = append(args, "ref-prefix "+prefix)
+	}
+	return encodeCommandRequest("ls-refs", []string{"agent=" + agent}, args)
+}
+
+// parseLsRefsResponse parses ls-refs output lines
+// Format: "<hash> <refname> [symref-target:<target>] [peeled:<hash>]",
+// or "unborn <refname> [symref-target:<target>]"
+func parseLsRefsResponse(body io.Reader) (*LsRefsResponse, error) {
+	lines, err := NewPktLineReader(body).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &LsRefsResponse{
+		References: []Reference{},
+		SymRefs:    make(map[string]string),
+	}
+	for _, line := range lines {
+		lineStr := strings.TrimSuffix(string(line), "\n")
+		if msg, ok := strings.CutPrefix(lineStr, "ERR "); ok {
+			return nil, fmt.Errorf("server error: %s", msg)
+		}
+
+		fields := strings.Split(lineStr, " ")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid ls-refs line: %s", lineStr)
+		}
+		name := fields[1]
+		peeled := ""
+		for _, attr := range fields[2:] {
+			if target, ok := strings.CutPrefix(attr, "symref-target:"); ok {
+				response.SymRefs[name] = target
+			} else if h, ok := strings.CutPrefix(attr, "peeled:"); ok {
+				peeled = h
+			}
+		}
+
+		// An unborn HEAD only names the branch it will be on
+		if fields[0] == "unborn" {
+			continue
+		}
+		hash, refName, err := parseRefLine(fields[0] + " " + name)
+		if err != nil {
+			return nil, err
+		}
+		response.References = append(response.References, Reference{Name: refName, Hash: hash})
+		if peeled != "" {
+			response.References = append(response.References, Reference{Name: refName + "^{}", Hash: peeled})
+		}
+	}
+	return response, nil
+}
+
+// encodeFetchCommand encodes a negotiation request as a protocol v2 fetch
+// command. Capabilities that v2 has turned into arguments are sent as
+// such; the rest, like multi_ack and side-band, are implied by v2.
+func encodeFetchCommand(req *NegotiationRequest) []byte {
+	capabilities := []string{}
+	args := []string{}
+	for _, capability := range req.Capabilities {
+		if strings.HasPrefix(capability, "agent=") {
+			capabilities = append(capabilities, capability)
+		} else if containsCapability(v2FetchArguments, capability) {
+			args = append(args, capability)
+		}
+	}
+
+	for _, want := range req.Wants {
+		args = append(args, "want "+want)
+	}
+	for _, have := range req.Haves {
+		args = append(args, "have "+have)
+	}
+	for _, shallow := range req.Shallows {
+		args = append(args, "shallow "+shallow)
+	}
+	if req.Deepen > 0 {
+		args = append(args, fmt.Sprintf("deepen %d", req.Deepen))
+	}
+	if req.DeepenRelative {
+		args = append(args, "deepen-relative")
+	}
+	if req.DeepenSince > 0 {
+		args = append(args, fmt.Sprintf("deepen-since %d", req.DeepenSince))
+	}
+	for _, ref := range req.DeepenNot {
+		args = append(args, "deepen-not "+ref)
+	}
+	if len(req.Filters) > 0 {
+		args = append(args, "filter "+FormatFilterSpec(req.Filters))
+	}
+	if req.Done {
+		args = append(args, "done")
+	}
+
+	return encodeCommandRequest("fetch", capabilities, args)
+}
+
+// parseFetchCommandResponse parses the response to a protocol v2 fetch
+// command. It is made of sections, each starting with its name and ended
+// by a delimiter, or a flush at the end of the response; the packfile
+// section is always multiplexed with side-band-64k, its messages going to
+// progress and the pack to pack if it is set.
+func parseFetchCommandResponse(body io.Reader, progress func(message string), pack func(io.Reader) error) (*NegotiationResponse, error) {
+	reader := NewPktLineReader(body)
+	response := &NegotiationResponse{
+		ACKs:     []ACK{},
+		SideBand: true,
+	}
+
+	section := ""
+	for {
+		line, err := reader.ReadLine()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("failed to read line: %w", err)
+		}
+		if line == nil {
+			break
+		}
+
+		if IsDelimiterPkt(line) {
+			section = ""
+			continue
+		}
+		lineStr := strings.TrimSuffix(string(line), "\n")
+		if msg, ok := strings.CutPrefix(lineStr, "ERR "); ok {
+			response.ErrorMsg = msg
+			return response, nil
+		}
+		if section == "" {
+			section = lineStr
+			if section == "packfile" {
+				if err := readSideBandPack(reader, nil, response, progress, pack); err != nil {
+					return nil, err
+				}
+				return response, nil
+			}
+			continue
+		}
+
+		switch section {
+		case "acknowledgments":
+			if lineStr == "NAK" {
+				response.NAK = true
+			} else if lineStr == "ready" {
+				response.ACKs = append(response.ACKs, ACK{Status: ACKReady})
+			} else if hash, ok := strings.CutPrefix(lineStr, "ACK "); ok {
+				response.ACKs = append(response.ACKs, ACK{Hash: hash, Status: ACKCommon})
+			}
+		case "shallow-info":
+			parseShallowLine(lineStr, response)
+		}
+	}
+
+	return response, nil
+}
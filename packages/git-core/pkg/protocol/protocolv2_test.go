@@ -0,0 +1,201 @@
+package protocol
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestParseV2Discovery tests reading a protocol v2 capability
+// advertisement, with and without the service line
+func TestParseV2Discovery(t *testing.T) {
+	advertisement := []string{"version 2\n", "agent=git/2.43.0\n", "ls-refs=unborn\n", "fetch=shallow filter\n", "server-option\n"}
+	responses := [][]byte{
+		buildMockDiscoveryResponse(append([]string{"# service=git-upload-pack\n"}, advertisement...)...),
+		encodePktLines(advertisement...),
+	}
+
+	for i, response := range responses {
+		discovery, err := parseDiscoveryResponse(bytes.NewReader(response), UploadPackService)
+		if err != nil {
+			t.Fatalf("response %d: parseDiscoveryResponse() error: %v", i, err)
+		}
+		if discovery.Version != 2 || len(discovery.References) != 0 || len(discovery.Capabilities) != 4 {
+			t.Errorf("response %d: unexpected discovery %+v", i, discovery)
+		}
+		if features, ok := discovery.CommandFeatures("fetch"); !ok || strings.Join(features, " ") != "shallow filter" {
+			t.Errorf("response %d: CommandFeatures(fetch) = %v, %v", i, features, ok)
+		}
+		if features, ok := discovery.CommandFeatures("server-option"); !ok || len(features) != 0 {
+			t.Errorf("response %d: CommandFeatures(server-option) = %v, %v", i, features, ok)
+		}
+		if _, ok := discovery.CommandFeatures("object-info"); ok {
+			t.Errorf("response %d: object-info should not be supported", i)
+		}
+	}
+
+	v1 := buildMockDiscoveryResponse(
+		"# service=git-upload-pack\n",
+		"version 1\n",
+		"abc1234567890123456789012345678901234567 refs/heads/main\x00ofs-delta\n",
+	)
+	discovery, err := parseDiscoveryResponse(bytes.NewReader(v1), UploadPackService)
+	if err != nil {
+		t.Fatalf("parseDiscoveryResponse() error: %v", err)
+	}
+	if discovery.Version != 1 || len(discovery.References) != 1 || !discovery.HasCapability("ofs-delta") {
+		t.Errorf("unexpected v1 discovery %+v", discovery)
+	}
+}
+
+// TestDiscoverRefs tests that a v2 server is asked for refs with ls-refs,
+// limited to the given prefixes
+func TestDiscoverRefs(t *testing.T) {
+	var lsRefs string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Git-Protocol") != "version=2" {
+			t.Errorf("Expected protocol v2 header, got %q", r.Header.Get("Git-Protocol"))
+		}
+		writer := NewPktLineWriter(w)
+		if r.Method == "GET" {
+			w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+			writer.WriteString("# service=git-upload-pack\n")
+			writer.WriteFlush()
+			writer.WriteString("version 2\n")
+			writer.WriteString("ls-refs=unborn\n")
+			writer.WriteString("fetch=shallow\n")
+			writer.WriteFlush()
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		lsRefs = string(body)
+		writer.WriteString("1111111111111111111111111111111111111111 HEAD symref-target:refs/heads/main\n")
+		writer.WriteString("1111111111111111111111111111111111111111 refs/heads/main\n")
+		writer.WriteString("2222222222222222222222222222222222222222 refs/tags/v1 peeled:3333333333333333333333333333333333333333\n")
+		writer.WriteFlush()
+	}))
+	defer server.Close()
+
+	discovery, err := NewClient().DiscoverRefs(server.URL+"/repo.git", []string{"HEAD", "refs/heads/"})
+	if err != nil {
+		t.Fatalf("DiscoverRefs failed: %v", err)
+	}
+
+	if !strings.HasPrefix(lsRefs, "0014command=ls-refs\n") ||
+		!strings.Contains(lsRefs, "00010009peel\n000csymrefs\n000bunborn\n") ||
+		!strings.HasSuffix(lsRefs, "0014ref-prefix HEAD\n001bref-prefix refs/heads/\n0000") {
+		t.Errorf("Unexpected ls-refs request %q", lsRefs)
+	}
+	if discovery.Version != 2 || len(discovery.References) != 4 {
+		t.Fatalf("Unexpected discovery %+v", discovery)
+	}
+	if ref, ok := discovery.GetReference("refs/tags/v1^{}"); !ok || ref.Hash != "3333333333333333333333333333333333333333" {
+		t.Errorf("Expected the peeled tag as refs/tags/v1^{}, got %+v", discovery.References)
+	}
+	if branch, err := discovery.GetDefaultBranch(); err != nil || branch != "refs/heads/main" {
+		t.Errorf("GetDefaultBranch() = %q, %v", branch, err)
+	}
+}
+
+// TestParseLsRefsResponse tests unborn refs and errors in ls-refs output
+func TestParseLsRefsResponse(t *testing.T) {
+	body := encodePktLines("unborn HEAD symref-target:refs/heads/trunk\n")
+	refs, err := parseLsRefsResponse(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("parseLsRefsResponse() error: %v", err)
+	}
+	if len(refs.References) != 0 || refs.SymRefs["HEAD"] != "refs/heads/trunk" {
+		t.Errorf("Unexpected response %+v", refs)
+	}
+
+	for _, line := range []string{"ERR access denied\n", "refs/heads/main\n", "abc refs/heads/main\n"} {
+		if _, err := parseLsRefsResponse(bytes.NewReader(encodePktLines(line))); err == nil {
+			t.Errorf("Expected error parsing %q", line)
+		}
+	}
+}
+
+// TestEncodeFetchCommand tests the framing of a v2 fetch request
+func TestEncodeFetchCommand(t *testing.T) {
+	req := &NegotiationRequest{
+		Wants:        []string{"1111111111111111111111111111111111111111"},
+		Haves:        []string{"2222222222222222222222222222222222222222"},
+		Capabilities: append(BuildCapabilities(), "shallow"),
+		Deepen:       3,
+		Filters:      map[string]string{"blob": "none"},
+		Done:         true,
+	}
+
+	lines, err := DecodePktLines(bytes.Split(encodeFetchCommand(req), []byte("0001"))[1])
+	if err != nil {
+		t.Fatalf("DecodePktLines() error: %v", err)
+	}
+	got := []string{}
+	for _, line := range lines {
+		got = append(got, strings.TrimSuffix(string(line), "\n"))
+	}
+	want := []string{
+		"thin-pack",
+		"ofs-delta",
+		"want 1111111111111111111111111111111111111111",
+		"have 2222222222222222222222222222222222222222",
+		"deepen 3",
+		"filter blob:none",
+		"done",
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("fetch arguments = %q, want %q", got, want)
+	}
+
+	header := string(bytes.Split(encodeFetchCommand(req), []byte("0001"))[0])
+	if header != "0012command=fetch\n001cagent=browser-git/0.1.0\n" {
+		t.Errorf("Unexpected command header %q", header)
+	}
+}
+
+// TestParseFetchCommandResponse tests reading the sections of a v2 fetch
+// response
+func TestParseFetchCommandResponse(t *testing.T) {
+	var body bytes.Buffer
+	writer := NewPktLineWriter(&body)
+	writer.WriteString("shallow-info\n")
+	writer.WriteString("shallow 1111111111111111111111111111111111111111\n")
+	writer.WriteDelimiter()
+	writer.WriteString("packfile\n")
+	writer.WriteLine([]byte("\x02Enumerating objects: 3\n"))
+	writer.WriteLine([]byte("\x01PACK"))
+	writer.WriteLine([]byte("\x01data"))
+	writer.WriteFlush()
+
+	resp, err := parseFetchCommandResponse(&body, nil, nil)
+	if err != nil {
+		t.Fatalf("parseFetchCommandResponse() error: %v", err)
+	}
+	if string(resp.Packfile) != "PACKdata" || len(resp.Shallows) != 1 || !resp.SideBand {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+
+	body.Reset()
+	writer.WriteString("acknowledgments\n")
+	writer.WriteString("ACK 2222222222222222222222222222222222222222\n")
+	writer.WriteString("ready\n")
+	writer.WriteDelimiter()
+	writer.WriteString("packfile\n")
+	writer.WriteLine([]byte("\x03upload-pack: out of memory"))
+	writer.WriteFlush()
+
+	resp, err = parseFetchCommandResponse(&body, nil, nil)
+	if err != nil {
+		t.Fatalf("parseFetchCommandResponse() error: %v", err)
+	}
+	if len(resp.ACKs) != 2 || resp.ACKs[0].Status != ACKCommon || resp.ACKs[1].Status != ACKReady {
+		t.Errorf("Unexpected ACKs %+v", resp.ACKs)
+	}
+	if resp.ErrorMsg != "upload-pack: out of memory" {
+		t.Errorf("ErrorMsg = %q", resp.ErrorMsg)
+	}
+}
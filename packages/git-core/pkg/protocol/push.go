@@ -36,12 +36,25 @@ type PushResponse struct {
 type RefUpdateStatus struct {
 	RefName string // Reference name
 	Status  string // "ok" or error message
+
+	// With report-status-v2, the server may report what it did to an
+	// updated ref when that is not what was asked, e.g. with proc-receive
+	RewrittenRef string // Reference actually updated ("option refname")
+	OldHash      string // Hash the reference had ("option old-oid")
+	NewHash      string // Hash the reference has now ("option new-oid")
+	ForcedUpdate bool   // Whether the update was not a fast-forward ("option forced-update")
+}
+
+// OK reports whether the server updated the reference
+func (s RefUpdateStatus) OK() bool {
+	return s.Status == "ok"
 }
 
 // ReceivePackClient handles the receive-pack protocol (push)
 type ReceivePackClient struct {
-	client  *Client
-	repoURL string
+	client   *Client
+	repoURL  string
+	progress func(message string)
 }
 
 // NewReceivePackClient creates a new receive-pack client
@@ -52,7 +65,15 @@ func NewReceivePackClient(client *Client, repoURL string) *ReceivePackClient {
 	}
 }
 
-// Push performs a push operation to the remote repository
+// SetProgressCallback sets where the progress and error messages the
+// server sends on the side-band go, one line at a time
+func (r *ReceivePackClient) SetProgressCallback(callback func(message string)) {
+	r.progress = callback
+}
+
+// Push performs a push operation to the remote repository. A packfile the
+// server could not unpack and the references it refused are reported in
+// the response's UnpackStatus and RefStatuses rather than as an error.
 func (r *ReceivePackClient) Push(req *PushRequest) (*PushResponse, error) {
 	// Build the receive-pack URL
 	receivePackURL, err := buildReceivePackURL(r.repoURL)
@@ -90,29 +111,25 @@ func (r *ReceivePackClient) Push(req *PushRequest) (*PushResponse, error) {
 	}
 	defer resp.Body.Close()
 
+	respBody, err := r.client.responseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
+		body, _ := io.ReadAll(respBody)
 		err := fmt.Errorf("%s", string(body))
 		return nil, WrapProtocolError(err, resp.StatusCode, r.repoURL)
 	}
 
 	// Parse the response
-	pushResp, err := parsePushResponse(resp.Body, req.ReportStatus, hasSideBandCapability(req.Capabilities))
+	pushResp, err := parsePushResponse(respBody, req.ReportStatus, hasSideBandCapability(req.Capabilities), r.progress)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse push response: %w", err)
 	}
-
-	// Check for errors in response
-	if pushResp.UnpackStatus != "ok" {
-		return nil, fmt.Errorf("unpack failed: %s", pushResp.UnpackStatus)
-	}
-
-	// Check for reference update errors
-	for _, refStatus := range pushResp.RefStatuses {
-		if refStatus.Status != "ok" {
-			return nil, fmt.Errorf("failed to update %s: %s", refStatus.RefName, refStatus.Status)
-		}
+	if pushResp.ErrorMsg != "" {
+		return nil, fmt.Errorf("server error: %s", pushResp.ErrorMsg)
 	}
 
 	return pushResp, nil
@@ -163,8 +180,9 @@ func encodePushRequest(req *PushRequest) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// parsePushResponse parses the server's push response
-func parsePushResponse(body io.Reader, reportStatus bool, sideBand bool) (*PushResponse, error) {
+// parsePushResponse parses the server's push response, passing the
+// server's side-band messages to progress
+func parsePushResponse(body io.Reader, reportStatus bool, sideBand bool, progress func(message string)) (*PushResponse, error) {
 	// If no status report requested, consider it successful
 	if !reportStatus {
 		return &PushResponse{
@@ -181,7 +199,7 @@ func parsePushResponse(body io.Reader, reportStatus bool, sideBand bool) (*PushR
 
 	// If side-band is enabled, we need to demultiplex the stream
 	if sideBand {
-		return parseSideBandPushResponse(reader)
+		return parseSideBandPushResponse(reader, progress)
 	}
 
 	// Standard response parsing
@@ -202,40 +220,20 @@ func parsePushResponse(body io.Reader, reportStatus bool, sideBand bool) (*PushR
 		lineStr := string(line)
 		lineStr = strings.TrimSuffix(lineStr, "\n")
 
-		// Parse unpack status (first line)
-		if strings.HasPrefix(lineStr, "unpack ") {
-			response.UnpackStatus = strings.TrimPrefix(lineStr, "unpack ")
-		} else if strings.HasPrefix(lineStr, "ok ") {
-			// Successful reference update
-			refName := strings.TrimPrefix(lineStr, "ok ")
-			response.RefStatuses = append(response.RefStatuses, RefUpdateStatus{
-				RefName: refName,
-				Status:  "ok",
-			})
-		} else if strings.HasPrefix(lineStr, "ng ") {
-			// Failed reference update
-			// Format: "ng <refname> <error-message>"
-			parts := strings.SplitN(strings.TrimPrefix(lineStr, "ng "), " ", 2)
-			if len(parts) >= 2 {
-				response.RefStatuses = append(response.RefStatuses, RefUpdateStatus{
-					RefName: parts[0],
-					Status:  parts[1],
-				})
-			}
-		}
+		parsePushStatusLine(lineStr, response)
 	}
 
 	return response, nil
 }
 
 // parseSideBandPushResponse parses a side-band multiplexed push response
-func parseSideBandPushResponse(reader *PktLineReader) (*PushResponse, error) {
+func parseSideBandPushResponse(reader *PktLineReader, progress func(message string)) (*PushResponse, error) {
 	response := &PushResponse{
 		RefStatuses: []RefUpdateStatus{},
 		SideBand:    true,
 	}
 
-	var statusBuf bytes.Buffer
+	demux := newSideBandDemuxer(progress)
 
 	for {
 		line, err := reader.ReadLine()
@@ -256,58 +254,70 @@ func parseSideBandPushResponse(reader *PktLineReader) (*PushResponse, error) {
 		}
 
 		// First byte is the channel
-		channel := line[0]
-		data := line[1:]
-
-		switch channel {
-		case 1: // Status data
-			statusBuf.Write(data)
-		case 2: // Progress messages (stderr)
-			// Progress messages can be logged or ignored
-			// fmt.Fprintf(os.Stderr, "%s", string(data))
-		case 3: // Error messages
-			response.ErrorMsg = string(data)
+		if err := demux.write(line); err != nil {
+			return nil, err
+		}
+		if demux.errorMsg != "" {
+			response.ErrorMsg = demux.close()
 			return response, nil
-		default:
-			return nil, fmt.Errorf("unknown side-band channel: %d", channel)
 		}
 	}
+	demux.close()
 
-	// Parse status data
-	if statusBuf.Len() > 0 {
-		statusLines := strings.Split(statusBuf.String(), "\n")
-		for _, line := range statusLines {
-			line = strings.TrimSpace(line)
-			if line == "" {
-				continue
-			}
-
-			// Parse unpack status
-			if strings.HasPrefix(line, "unpack ") {
-				response.UnpackStatus = strings.TrimPrefix(line, "unpack ")
-			} else if strings.HasPrefix(line, "ok ") {
-				// Successful reference update
-				refName := strings.TrimPrefix(line, "ok ")
-				response.RefStatuses = append(response.RefStatuses, RefUpdateStatus{
-					RefName: refName,
-					Status:  "ok",
-				})
-			} else if strings.HasPrefix(line, "ng ") {
-				// Failed reference update
-				parts := strings.SplitN(strings.TrimPrefix(line, "ng "), " ", 2)
-				if len(parts) >= 2 {
-					response.RefStatuses = append(response.RefStatuses, RefUpdateStatus{
-						RefName: parts[0],
-						Status:  parts[1],
-					})
-				}
-			}
-		}
+	// The status report is itself pkt-lines inside the data channel,
+	// though some servers send it as plain lines
+	statusLines, err := DecodePktLines(demux.data.Bytes())
+	if err != nil {
+		statusLines = bytes.Split(demux.data.Bytes(), []byte("\n"))
+	}
+	for _, line := range statusLines {
+		parsePushStatusLine(strings.TrimSpace(string(line)), response)
 	}
 
 	return response, nil
 }
 
+// parsePushStatusLine records one line of a push status report
+// Format: "unpack <status>", "ok <refname>" or "ng <refname> <error-message>",
+// and with report-status-v2 "option <key> [<value>]" about the last "ok"
+func parsePushStatusLine(line string, response *PushResponse) {
+	if strings.HasPrefix(line, "option ") {
+		if len(response.RefStatuses) == 0 {
+			return
+		}
+		status := &response.RefStatuses[len(response.RefStatuses)-1]
+		key, value, _ := strings.Cut(strings.TrimPrefix(line, "option "), " ")
+		switch key {
+		case "refname":
+			status.RewrittenRef = value
+		case "old-oid":
+			status.OldHash = value
+		case "new-oid":
+			status.NewHash = value
+		case "forced-update":
+			status.ForcedUpdate = true
+		}
+	} else if strings.HasPrefix(line, "unpack ") {
+		response.UnpackStatus = strings.TrimPrefix(line, "unpack ")
+	} else if strings.HasPrefix(line, "ok ") {
+		// Successful reference update
+		refName := strings.TrimPrefix(line, "ok ")
+		response.RefStatuses = append(response.RefStatuses, RefUpdateStatus{
+			RefName: refName,
+			Status:  "ok",
+		})
+	} else if strings.HasPrefix(line, "ng ") {
+		// Failed reference update
+		parts := strings.SplitN(strings.TrimPrefix(line, "ng "), " ", 2)
+		if len(parts) >= 2 {
+			response.RefStatuses = append(response.RefStatuses, RefUpdateStatus{
+				RefName: parts[0],
+				Status:  parts[1],
+			})
+		}
+	}
+}
+
 // BuildPushCapabilities builds a list of default capabilities for push
 func BuildPushCapabilities() []string {
 	return []string{
@@ -2,6 +2,7 @@ package protocol
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 )
 
@@ -138,8 +139,8 @@ func TestParsePushResponse(t *testing.T) {
 	}{
 		{
 			name: "Successful push with status",
-			responseData: "0030unpack ok\n" +
-				"0019ok refs/heads/main\n" +
+			responseData: "000eunpack ok\n" +
+				"0017ok refs/heads/main\n" +
 				"0000",
 			reportStatus:   true,
 			sideBand:       false,
@@ -149,8 +150,8 @@ func TestParsePushResponse(t *testing.T) {
 		},
 		{
 			name: "Push with failed ref update",
-			responseData: "0030unpack ok\n" +
-				"0033ng refs/heads/main non-fast-forward\n" +
+			responseData: "000eunpack ok\n" +
+				"0028ng refs/heads/main non-fast-forward\n" +
 				"0000",
 			reportStatus:   true,
 			sideBand:       false,
@@ -160,7 +161,7 @@ func TestParsePushResponse(t *testing.T) {
 		},
 		{
 			name: "Push with unpack failure",
-			responseData: "003Dunpack error: disk full\n" +
+			responseData: "001cunpack error: disk full\n" +
 				"0000",
 			reportStatus:   true,
 			sideBand:       false,
@@ -170,9 +171,9 @@ func TestParsePushResponse(t *testing.T) {
 		},
 		{
 			name: "Multiple ref updates",
-			responseData: "0030unpack ok\n" +
-				"0019ok refs/heads/main\n" +
-				"001Cok refs/heads/feature\n" +
+			responseData: "000eunpack ok\n" +
+				"0017ok refs/heads/main\n" +
+				"001aok refs/heads/feature\n" +
 				"0000",
 			reportStatus:   true,
 			sideBand:       false,
@@ -194,7 +195,7 @@ func TestParsePushResponse(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			reader := bytes.NewReader([]byte(tt.responseData))
-			response, err := parsePushResponse(reader, tt.reportStatus, tt.sideBand)
+			response, err := parsePushResponse(reader, tt.reportStatus, tt.sideBand, nil)
 
 			if tt.expectError && err == nil {
 				t.Fatal("expected error but got none")
@@ -273,3 +274,37 @@ func TestBuildPushCapabilities(t *testing.T) {
 		t.Error("expected report-status capability")
 	}
 }
+
+// TestParsePushResponseReportStatusV2 tests that the options of
+// report-status-v2 are recorded on the ref update before them
+func TestParsePushResponseReportStatusV2(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewPktLineWriter(&buf)
+	writer.WriteString("unpack ok\n")
+	writer.WriteString("ok refs/for/main\n")
+	writer.WriteString("option refname refs/changes/01/1/1\n")
+	writer.WriteString("option old-oid " + strings.Repeat("0", 40) + "\n")
+	writer.WriteString("option new-oid " + strings.Repeat("a", 40) + "\n")
+	writer.WriteString("ok refs/heads/main\n")
+	writer.WriteString("option forced-update\n")
+	writer.WriteString("ng refs/heads/topic non-fast-forward\n")
+	writer.WriteFlush()
+
+	response, err := parsePushResponse(&buf, true, false, nil)
+	if err != nil {
+		t.Fatalf("parsePushResponse() unexpected error: %v", err)
+	}
+	if len(response.RefStatuses) != 3 {
+		t.Fatalf("expected 3 ref statuses, got %+v", response.RefStatuses)
+	}
+	rewritten, forced, rejected := response.RefStatuses[0], response.RefStatuses[1], response.RefStatuses[2]
+	if !rewritten.OK() || rewritten.RewrittenRef != "refs/changes/01/1/1" || rewritten.NewHash != strings.Repeat("a", 40) || rewritten.ForcedUpdate {
+		t.Errorf("Unexpected status %+v", rewritten)
+	}
+	if !forced.OK() || !forced.ForcedUpdate || forced.RewrittenRef != "" {
+		t.Errorf("Unexpected status %+v", forced)
+	}
+	if rejected.OK() || rejected.RefName != "refs/heads/topic" || rejected.Status != "non-fast-forward" {
+		t.Errorf("Unexpected status %+v", rejected)
+	}
+}
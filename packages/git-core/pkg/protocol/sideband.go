@@ -0,0 +1,204 @@
+package protocol
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Side-band channels, given by the first byte of each multiplexed pkt-line
+const (
+	// SideBandData carries the packfile or push status
+	SideBandData = 1
+	// SideBandProgress carries progress messages for the user
+	SideBandProgress = 2
+	// SideBandError carries a fatal error message, after which the
+	// server stops
+	SideBandError = 3
+)
+
+// sideBandDemuxer splits side-band-64k packets into the data stream and
+// the remote's messages. Servers split messages across packets and redraw
+// progress with \r, so messages are reported one whole line at a time,
+// prefixed with "remote: " as git prints them.
+type sideBandDemuxer struct {
+	data     bytes.Buffer
+	progress func(message string)
+	pending  string
+	errorMsg string
+}
+
+// newSideBandDemuxer creates a demuxer reporting messages to progress,
+// which may be nil
+func newSideBandDemuxer(progress func(message string)) *sideBandDemuxer {
+	return &sideBandDemuxer{progress: progress}
+}
+
+// write demultiplexes one side-band packet
+func (d *sideBandDemuxer) write(packet []byte) error {
+	if len(packet) == 0 {
+		return nil
+	}
+
+	switch packet[0] {
+	case SideBandData:
+		d.data.Write(packet[1:])
+	case SideBandProgress:
+		d.report(string(packet[1:]))
+	case SideBandError:
+		d.errorMsg += string(packet[1:])
+	default:
+		return fmt.Errorf("unknown side-band channel: %d", packet[0])
+	}
+	return nil
+}
+
+// report passes on the complete lines of a progress message, keeping an
+// unterminated tail for the next packet
+func (d *sideBandDemuxer) report(text string) {
+	text = d.pending + text
+	for {
+		i := strings.IndexAny(text, "\r\n")
+		if i < 0 {
+			break
+		}
+		d.send(text[:i])
+		text = text[i+1:]
+	}
+	d.pending = text
+}
+
+// send reports one message line, skipping blank ones
+func (d *sideBandDemuxer) send(line string) {
+	if d.progress != nil && strings.TrimSpace(line) != "" {
+		d.progress("remote: " + line)
+	}
+}
+
+// close reports a progress message left without a line end, and the
+// error message if the server sent one, which it returns
+func (d *sideBandDemuxer) close() string {
+	d.send(d.pending)
+	d.pending = ""
+
+	msg := strings.TrimRight(d.errorMsg, "\r\n")
+	for _, line := range strings.Split(msg, "\n") {
+		d.send(line)
+	}
+	return msg
+}
+
+// peekRawPack reports whether the response continues with a raw packfile
+// rather than pkt-lines, as from a server that did not take up side-band
+func peekRawPack(reader *PktLineReader) bool {
+	magic, err := reader.reader.Peek(4)
+	return err == nil && string(magic) == "PACK"
+}
+
+// readPackData reads the packfile that ends a fetch response. A server
+// that took up side-band multiplexes it with its messages, which go to
+// progress; otherwise the rest of the response is the pack itself. The
+// pack is streamed to pack if it is set, and read into the response
+// otherwise.
+func readPackData(reader *PktLineReader, response *NegotiationResponse, progress func(message string), pack func(io.Reader) error) error {
+	if _, err := reader.reader.Peek(4); err != nil || peekRawPack(reader) {
+		return receivePack(reader.reader, response, pack)
+	}
+
+	response.SideBand = true
+	return readSideBandPack(reader, nil, response, progress, pack)
+}
+
+// readSideBandPack reads a multiplexed packfile whose first packet, if
+// not nil, has already been read. A fatal error from the server ends the
+// pack and is recorded in the response.
+func readSideBandPack(reader *PktLineReader, first []byte, response *NegotiationResponse, progress func(message string), pack func(io.Reader) error) error {
+	data := &sideBandReader{
+		reader:  reader,
+		demux:   newSideBandDemuxer(progress),
+		pending: first,
+	}
+	err := receivePack(data, response, pack)
+	if err == nil {
+		// Report the messages that follow the end of the pack
+		_, err = io.Copy(io.Discard, data)
+	}
+	response.ErrorMsg = data.demux.close()
+	if response.ErrorMsg != "" {
+		return nil
+	}
+	return err
+}
+
+// receivePack passes a packfile to pack as it arrives, or reads it into
+// the response when pack is nil
+func receivePack(data io.Reader, response *NegotiationResponse, pack func(io.Reader) error) error {
+	if pack != nil {
+		response.PackStreamed = true
+		return pack(data)
+	}
+
+	packfile, err := io.ReadAll(data)
+	if err != nil {
+		return fmt.Errorf("failed to read packfile: %w", err)
+	}
+	if len(packfile) > 0 {
+		response.Packfile = packfile
+	}
+	return nil
+}
+
+// sideBandReader reads the data channel of a side-band stream as the
+// packets arrive, passing the other channels to its demuxer. It ends at a
+// flush, or with an error when the server reports one.
+type sideBandReader struct {
+	reader *PktLineReader
+	demux  *sideBandDemuxer
+	// pending is a packet read but not yet demultiplexed, channel byte
+	// included, and data what is left of the last data packet
+	pending []byte
+	data    []byte
+	err     error
+}
+
+// Read implements io.Reader
+func (s *sideBandReader) Read(p []byte) (int, error) {
+	for {
+		if len(s.data) > 0 {
+			n := copy(p, s.data)
+			s.data = s.data[n:]
+			return n, nil
+		}
+		if len(s.pending) > 0 {
+			if s.pending[0] == SideBandData {
+				s.data = s.pending[1:]
+				s.pending = nil
+				continue
+			}
+			if err := s.demux.write(s.pending); err != nil {
+				s.err = err
+			} else if s.demux.errorMsg != "" {
+				s.err = fmt.Errorf("server error: %s", strings.TrimSpace(s.demux.errorMsg))
+			}
+			s.pending = nil
+		}
+		if s.err != nil {
+			return 0, s.err
+		}
+
+		line, err := s.reader.ReadLine()
+		if err != nil {
+			if err != io.EOF {
+				err = fmt.Errorf("failed to read side-band line: %w", err)
+			}
+			s.err = err
+			continue
+		}
+		if line == nil {
+			s.err = io.EOF
+			continue
+		}
+		s.pending = line
+	}
+}
@@ -0,0 +1,203 @@
+package protocol
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestSideBandDemuxer tests that progress is reported a line at a time
+// even when servers split and redraw it
+func TestSideBandDemuxer(t *testing.T) {
+	var messages []string
+	demux := newSideBandDemuxer(func(message string) {
+		messages = append(messages, message)
+	})
+
+	packets := [][]byte{
+		[]byte("\x02Counting objects:  50% (1/2)\rCounting obj"),
+		[]byte("\x01PACK"),
+		[]byte("\x02ects: 100% (2/2), done.\n"),
+		[]byte("\x01data"),
+		[]byte("\x02Total 2 (delta 0)"),
+	}
+	for _, packet := range packets {
+		if err := demux.write(packet); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	if msg := demux.close(); msg != "" {
+		t.Errorf("close() = %q, want no error", msg)
+	}
+
+	want := []string{
+		"remote: Counting objects:  50% (1/2)",
+		"remote: Counting objects: 100% (2/2), done.",
+		"remote: Total 2 (delta 0)",
+	}
+	if strings.Join(messages, "|") != strings.Join(want, "|") {
+		t.Errorf("messages = %q, want %q", messages, want)
+	}
+	if demux.data.String() != "PACKdata" {
+		t.Errorf("data = %q, want PACKdata", demux.data.String())
+	}
+
+	messages = nil
+	if err := demux.write([]byte("\x03fatal: object is corrupt\n")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if msg := demux.close(); msg != "fatal: object is corrupt" {
+		t.Errorf("close() = %q, want the error message", msg)
+	}
+	if len(messages) != 1 || messages[0] != "remote: fatal: object is corrupt" {
+		t.Errorf("error was not reported: %q", messages)
+	}
+
+	if err := demux.write([]byte("\x05data")); err == nil {
+		t.Error("expected an error for an unknown channel")
+	}
+}
+
+// TestParseNegotiationResponsePackFraming tests that the packfile is read
+// the way the server sent it, whatever was requested
+func TestParseNegotiationResponsePackFraming(t *testing.T) {
+	var messages []string
+	progress := func(message string) {
+		messages = append(messages, message)
+	}
+
+	// Multiplexed although side-band was not requested
+	var buf bytes.Buffer
+	NewPktLineWriter(&buf).WriteString("NAK\n")
+	buf.Write(buildSideBandResponse([]sideBandLine{
+		{channel: 2, data: []byte("Enumerating objects: 3, done.\n")},
+		{channel: 1, data: []byte("PACKdata")},
+	}))
+	resp, err := parseNegotiationResponse(bytes.NewReader(buf.Bytes()), true, false, false, progress, nil)
+	if err != nil {
+		t.Fatalf("parseNegotiationResponse() unexpected error: %v", err)
+	}
+	if string(resp.Packfile) != "PACKdata" || !resp.SideBand {
+		t.Errorf("Packfile = %q, SideBand = %v", resp.Packfile, resp.SideBand)
+	}
+	if len(messages) != 1 || messages[0] != "remote: Enumerating objects: 3, done." {
+		t.Errorf("messages = %q", messages)
+	}
+
+	// A raw pack although side-band was requested
+	buf.Reset()
+	NewPktLineWriter(&buf).WriteString("NAK\n")
+	buf.WriteString("PACKdata")
+	resp, err = parseNegotiationResponse(bytes.NewReader(buf.Bytes()), true, true, false, progress, nil)
+	if err != nil {
+		t.Fatalf("parseNegotiationResponse() unexpected error: %v", err)
+	}
+	if string(resp.Packfile) != "PACKdata" || resp.SideBand || !resp.NAK {
+		t.Errorf("Packfile = %q, SideBand = %v, NAK = %v", resp.Packfile, resp.SideBand, resp.NAK)
+	}
+}
+
+// TestParseNegotiationResponsePackStream tests that a pack handler reads
+// the packfile from the side-band as it arrives, while the messages around
+// it still go to progress
+func TestParseNegotiationResponsePackStream(t *testing.T) {
+	var messages []string
+	progress := func(message string) {
+		messages = append(messages, message)
+	}
+
+	var buf bytes.Buffer
+	NewPktLineWriter(&buf).WriteString("NAK\n")
+	buf.Write(buildSideBandResponse([]sideBandLine{
+		{channel: 1, data: []byte("PACK")},
+		{channel: 2, data: []byte("Receiving objects: 50%\n")},
+		{channel: 1, data: []byte("data")},
+		{channel: 2, data: []byte("Total 2 (delta 0)\n")},
+	}))
+
+	var received []byte
+	resp, err := parseNegotiationResponse(bytes.NewReader(buf.Bytes()), true, true, false, progress, func(pack io.Reader) error {
+		// Read less than a packet at a time
+		chunk := make([]byte, 3)
+		for {
+			n, err := pack.Read(chunk)
+			received = append(received, chunk[:n]...)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		t.Fatalf("parseNegotiationResponse() unexpected error: %v", err)
+	}
+	if string(received) != "PACKdata" || resp.Packfile != nil || !resp.PackStreamed {
+		t.Errorf("received %q, Packfile = %q, PackStreamed = %v", received, resp.Packfile, resp.PackStreamed)
+	}
+	want := []string{"remote: Receiving objects: 50%", "remote: Total 2 (delta 0)"}
+	if strings.Join(messages, "|") != strings.Join(want, "|") {
+		t.Errorf("messages = %q, want %q", messages, want)
+	}
+
+	// A fatal error ends the pack and is reported in the response
+	buf.Reset()
+	NewPktLineWriter(&buf).WriteString("NAK\n")
+	buf.Write(buildSideBandResponse([]sideBandLine{
+		{channel: 1, data: []byte("PACK")},
+		{channel: 3, data: []byte("fatal: object is corrupt\n")},
+	}))
+	var handlerErr error
+	resp, err = parseNegotiationResponse(bytes.NewReader(buf.Bytes()), true, true, false, nil, func(pack io.Reader) error {
+		_, handlerErr = io.ReadAll(pack)
+		return handlerErr
+	})
+	if err != nil {
+		t.Fatalf("parseNegotiationResponse() unexpected error: %v", err)
+	}
+	if handlerErr == nil || resp.ErrorMsg != "fatal: object is corrupt" {
+		t.Errorf("handler error = %v, ErrorMsg = %q", handlerErr, resp.ErrorMsg)
+	}
+}
+
+// TestParseSideBandPushResponse tests that push status is demultiplexed
+// from the remote's messages
+func TestParseSideBandPushResponse(t *testing.T) {
+	var status bytes.Buffer
+	writer := NewPktLineWriter(&status)
+	writer.WriteString("unpack ok\n")
+	writer.WriteString("ok refs/heads/main\n")
+	writer.WriteFlush()
+
+	response := buildSideBandResponse([]sideBandLine{
+		{channel: 2, data: []byte("Resolving deltas: 100% (1/1)\n")},
+		{channel: 1, data: status.Bytes()},
+	})
+
+	var messages []string
+	resp, err := parsePushResponse(bytes.NewReader(response), true, true, func(message string) {
+		messages = append(messages, message)
+	})
+	if err != nil {
+		t.Fatalf("parsePushResponse() unexpected error: %v", err)
+	}
+	if resp.UnpackStatus != "ok" || len(resp.RefStatuses) != 1 || resp.RefStatuses[0].RefName != "refs/heads/main" {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+	if len(messages) != 1 || messages[0] != "remote: Resolving deltas: 100% (1/1)" {
+		t.Errorf("messages = %q", messages)
+	}
+
+	response = buildSideBandResponse([]sideBandLine{
+		{channel: 3, data: []byte("pre-receive hook declined\n")},
+	})
+	resp, err = parsePushResponse(bytes.NewReader(response), true, true, nil)
+	if err != nil {
+		t.Fatalf("parsePushResponse() unexpected error: %v", err)
+	}
+	if resp.ErrorMsg != "pre-receive hook declined" {
+		t.Errorf("ErrorMsg = %q", resp.ErrorMsg)
+	}
+}
@@ -0,0 +1,100 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// CorruptPackError reports packfile data that does not match the checksum
+// or object ID it should have
+type CorruptPackError struct {
+	// What names what did not match, e.g. "pack checksum" or "object"
+	What string
+	// Offset is where in the pack the data is
+	Offset int64
+	// Expected is the recorded checksum or ID, nil for an object that
+	// should not be there
+	Expected []byte
+	// Actual is the checksum or ID of the data, nil for an object that is
+	// missing
+	Actual []byte
+}
+
+// Error implements the error interface
+func (e *CorruptPackError) Error() string {
+	switch {
+	case e.Actual == nil:
+		return fmt.Sprintf("%s: %s %x is missing at offset %d", ErrCorruptPack, e.What, e.Expected, e.Offset)
+	case e.Expected == nil:
+		return fmt.Sprintf("%s: unexpected %s %x at offset %d", ErrCorruptPack, e.What, e.Actual, e.Offset)
+	default:
+		return fmt.Sprintf("%s: %s at offset %d is %x, expected %x", ErrCorruptPack, e.What, e.Offset, e.Actual, e.Expected)
+	}
+}
+
+// Unwrap returns ErrCorruptPack
+func (e *CorruptPackError) Unwrap() error {
+	return ErrCorruptPack
+}
+
+// VerifyPackChecksum checks the checksum that ends a packfile held in
+// memory against the data before it, without reading any object
+func VerifyPackChecksum(data []byte, hasher hash.Hasher) error {
+	offset := len(data) - hasher.Size()
+	if offset < PackfileHeaderSize {
+		return fmt.Errorf("%w: packfile is too short: %d bytes", ErrCorruptPack, len(data))
+	}
+	if sum := hasher.Hash(data[:offset]); !bytes.Equal(sum, data[offset:]) {
+		return &CorruptPackError{What: "pack checksum", Offset: int64(offset), Expected: data[offset:], Actual: sum}
+	}
+	return nil
+}
+
+// VerifyPack checks a packfile against its index like git verify-pack: the
+// pack's checksum must match its data and the index, and every object must
+// be at its indexed offset with its indexed CRC-32 and resolve to its
+// indexed ID. A mismatch is a *CorruptPackError.
+func VerifyPack(data []byte, idx *PackIndex, hasher hash.Hasher, limits Limits) error {
+	if err := VerifyPackChecksum(data, hasher); err != nil {
+		return err
+	}
+	trailer := len(data) - hasher.Size()
+	if !bytes.Equal(idx.PackChecksum, data[trailer:]) {
+		return &CorruptPackError{What: "pack checksum in index", Offset: int64(trailer), Expected: idx.PackChecksum, Actual: data[trailer:]}
+	}
+
+	actual, err := IndexPack(data, hasher, limits)
+	if err != nil {
+		return fmt.Errorf("failed to index pack: %w", err)
+	}
+	found := make(map[uint64]PackIndexEntry, len(actual.Entries))
+	for _, entry := range actual.Entries {
+		found[entry.Offset] = entry
+	}
+
+	for _, entry := range idx.Entries {
+		got, ok := found[entry.Offset]
+		if !ok {
+			return &CorruptPackError{What: "object", Offset: int64(entry.Offset), Expected: entry.Hash}
+		}
+		if !bytes.Equal(got.Hash, entry.Hash) {
+			return &CorruptPackError{What: "object", Offset: int64(entry.Offset), Expected: entry.Hash, Actual: got.Hash}
+		}
+		if got.CRC32 != entry.CRC32 {
+			return &CorruptPackError{
+				What:     "object CRC-32",
+				Offset:   int64(entry.Offset),
+				Expected: binary.BigEndian.AppendUint32(nil, entry.CRC32),
+				Actual:   binary.BigEndian.AppendUint32(nil, got.CRC32),
+			}
+		}
+		delete(found, entry.Offset)
+	}
+	for offset, got := range found {
+		return &CorruptPackError{What: "object", Offset: int64(offset), Actual: got.Hash}
+	}
+	return nil
+}
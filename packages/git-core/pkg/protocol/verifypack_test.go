@@ -0,0 +1,146 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// TestPackChecksumVerified tests that a pack whose checksum does not match
+// its data is reported as corrupt, whether read whole or streamed
+func TestPackChecksumVerified(t *testing.T) {
+	content := []byte(strings.Repeat("some content\n", 10))
+	var buf bytes.Buffer
+	if err := NewPackfileWriter(&buf).WritePackfile([]PackfileObject{{Type: ObjBlob, Size: uint64(len(content)), Data: content}}); err != nil {
+		t.Fatal(err)
+	}
+	pack := buf.Bytes()
+	if err := VerifyPackChecksum(pack, hash.NewSHA1()); err != nil {
+		t.Fatalf("VerifyPackChecksum() error: %v", err)
+	}
+
+	// A changed checksum leaves the objects readable
+	corrupt := append([]byte{}, pack...)
+	corrupt[len(corrupt)-1] ^= 0xff
+	var corruptErr *CorruptPackError
+	err := VerifyPackChecksum(corrupt, hash.NewSHA1())
+	if !errors.As(err, &corruptErr) || corruptErr.What != "pack checksum" || corruptErr.Offset != int64(len(pack)-PackfileChecksumSize) {
+		t.Errorf("Expected a pack checksum error, got %v", err)
+	}
+	if _, err := NewPackfileReader(bytes.NewReader(corrupt)).ReadPackfile(); !errors.Is(err, ErrCorruptPack) {
+		t.Errorf("ReadPackfile() = %v, want a corrupt pack error", err)
+	}
+	if err := VerifyPackChecksum(pack[:20], hash.NewSHA1()); !errors.Is(err, ErrCorruptPack) {
+		t.Errorf("Expected a truncated pack to be corrupt, got %v", err)
+	}
+
+	// A pack of another object format has a longer checksum
+	sha256 := hash.NewSHA256()
+	buf.Reset()
+	writer := NewPackfileWriter(&buf)
+	writer.SetHasher(sha256)
+	if err := writer.WritePackfile([]PackfileObject{{Type: ObjBlob, Size: uint64(len(content)), Data: content}}); err != nil {
+		t.Fatal(err)
+	}
+	reader := NewPackfileReader(bytes.NewReader(buf.Bytes()))
+	reader.SetHasher(sha256)
+	read, err := reader.ReadPackfile()
+	if err != nil || len(read.Checksum) != sha256.Size() {
+		t.Fatalf("ReadPackfile() = %v, %v, want a SHA-256 checksum", read, err)
+	}
+
+	// The parsed pack checks its data with the hasher it was read with
+	if err := read.VerifyChecksum(buf.Bytes()); err != nil {
+		t.Errorf("VerifyChecksum() error: %v", err)
+	}
+	changed := append([]byte{}, buf.Bytes()...)
+	changed[PackfileHeaderSize] ^= 0xff
+	if err := read.VerifyChecksum(changed); !errors.As(err, &corruptErr) || corruptErr.Offset != int64(len(changed)-sha256.Size()) {
+		t.Errorf("Expected a pack checksum error, got %v", err)
+	}
+}
+
+// TestVerifyPack tests that a pack is checked against its index
+func TestVerifyPack(t *testing.T) {
+	hasher := hash.NewSHA1()
+	base := []byte(strings.Repeat("a line of the base file\n", 20))
+	target := append([]byte("a first line\n"), base...)
+	delta, err := CreateAndEncodeDelta(base, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = NewPackfileWriter(&buf).WritePackfile([]PackfileObject{
+		{Type: ObjBlob, Size: uint64(len(base)), Data: base},
+		{Type: ObjOfsDelta, Size: uint64(len(delta)), Data: delta, Offset: PackfileHeaderSize, IsDelta: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pack := buf.Bytes()
+	idx, err := IndexPack(pack, hasher, DefaultLimits())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyPack(pack, idx, hasher, DefaultLimits()); err != nil {
+		t.Fatalf("VerifyPack() error: %v", err)
+	}
+
+	// An index that does not match the pack
+	tests := []struct {
+		name   string
+		modify func(idx *PackIndex)
+		what   string
+	}{
+		{"wrong ID", func(idx *PackIndex) { idx.Entries[0].Hash = hash.HashBlob(hasher, []byte("other")) }, "object"},
+		{"wrong CRC-32", func(idx *PackIndex) { idx.Entries[1].CRC32++ }, "object CRC-32"},
+		{"missing object", func(idx *PackIndex) { idx.Entries = idx.Entries[:1] }, "object"},
+		{"other pack", func(idx *PackIndex) { idx.PackChecksum = make([]byte, PackfileChecksumSize) }, "pack checksum in index"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modified := &PackIndex{Entries: append([]PackIndexEntry{}, idx.Entries...), PackChecksum: idx.PackChecksum}
+			tt.modify(modified)
+			var corruptErr *CorruptPackError
+			if err := VerifyPack(pack, modified, hasher, DefaultLimits()); !errors.As(err, &corruptErr) || corruptErr.What != tt.what {
+				t.Errorf("VerifyPack() = %v, want a %s error", err, tt.what)
+			}
+		})
+	}
+}
+
+// TestIndexThinPack tests that a thin pack's deltas are resolved against
+// the bases found by lookup, which are left out of the index
+func TestIndexThinPack(t *testing.T) {
+	hasher := hash.NewSHA1()
+	base := []byte(strings.Repeat("a line of the base file\n", 20))
+	target := append([]byte("a first line\n"), base...)
+	baseID := hash.HashBlob(hasher, base)
+	delta, err := CreateAndEncodeDelta(base, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = NewPackfileWriter(&buf).WritePackfile([]PackfileObject{
+		{Type: ObjRefDelta, Size: uint64(len(delta)), Data: delta, BaseHash: baseID.Bytes(), IsDelta: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := IndexThinPack(buf.Bytes(), hasher, DefaultLimits(), func(id []byte) (uint8, []byte, bool) {
+		if !bytes.Equal(id, baseID) {
+			return 0, nil, false
+		}
+		return ObjBlob, base, true
+	})
+	if err != nil {
+		t.Fatalf("IndexThinPack() error: %v", err)
+	}
+	if len(idx.Entries) != 1 || !bytes.Equal(idx.Entries[0].Hash, hash.HashBlob(hasher, target)) {
+		t.Errorf("Unexpected index %+v", idx)
+	}
+}
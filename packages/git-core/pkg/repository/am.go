@@ -0,0 +1,606 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/diff"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// mboxSeparator matches the line format-patch starts each message with
+var mboxSeparator = regexp.MustCompile(`^From [0-9a-f]{40,64} ` + mboxFromDate + `$`)
+
+// hunkHeader matches a unified diff hunk header
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// AmOptions contains options for Am
+type AmOptions struct {
+	// SignOff adds a Signed-off-by trailer for the committer
+	SignOff bool
+}
+
+// DefaultAmOptions returns default am options
+func DefaultAmOptions() AmOptions {
+	return AmOptions{
+		SignOff: false,
+	}
+}
+
+// AmResult describes the commits Am created
+type AmResult struct {
+	// Commits are the new commits, oldest first
+	Commits []hash.Hash
+}
+
+// MailPatch is one patch email split into its parts
+type MailPatch struct {
+	Author  object.Signature
+	Message string
+	// Patch is the unified diff from the email's body
+	Patch string
+}
+
+// filePatch is the change a patch makes to one file
+type filePatch struct {
+	oldPath string // empty for a new file
+	newPath string // empty for a deleted file
+	oldMode object.FileMode
+	newMode object.FileMode
+	hunks   []patchHunk
+	// oldHash and newHash are the blob names of the index line, which
+	// binary patches give in full
+	oldHash string
+	newHash string
+	binary  *binaryHunk
+}
+
+// patchHunk is one hunk of a file patch
+type patchHunk struct {
+	oldStart int
+	oldLines []string // context and removed lines, with line endings
+	newLines []string // context and added lines, with line endings
+}
+
+// Am applies a mailbox of patches, such as FormatPatch produces, as
+// commits on top of HEAD, like git am. Each commit keeps the author and
+// message from its email. The patches are applied in memory first, so
+// nothing changes unless all of them apply. The worktree must be clean.
+func (r *Repository) Am(mbox string, opts AmOptions) (*AmResult, error) {
+	if r.IsBare() {
+		return nil, fmt.Errorf("cannot apply patches in a bare repository")
+	}
+
+	mails, err := ParseMailbox(mbox)
+	if err != nil {
+		return nil, err
+	}
+	if len(mails) == 0 {
+		return nil, fmt.Errorf("no patches found")
+	}
+
+	status, err := r.Status(index.DefaultStatusOptions())
+	if err != nil {
+		return nil, err
+	}
+	if status.HasStagedChanges() || status.HasUnstagedChanges() || len(status.Conflicted) > 0 {
+		return nil, fmt.Errorf("your local changes would be overwritten by am; commit or stash them first")
+	}
+
+	files := make(map[string]struct {
+		hash hash.Hash
+		mode object.FileMode
+	})
+	var parent hash.Hash
+	if status.Head != nil {
+		parent = status.Head
+		tree, _, err := r.peelToTree(parent)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load HEAD tree: %w", err)
+		}
+		if err := r.collectTreeFiles(tree, "", files); err != nil {
+			return nil, err
+		}
+	}
+
+	name, email := r.Config.GetUser()
+	committer := object.Signature{Name: name, Email: email, When: time.Now()}
+
+	result := &AmResult{Commits: []hash.Hash{}}
+	var treeHash hash.Hash
+	messages := make([]string, len(mails))
+	for i, mailPatch := range mails {
+		subject, _, _ := strings.Cut(mailPatch.Message, "\n")
+		patches, err := parsePatch(mailPatch.Patch)
+		if err != nil {
+			return nil, fmt.Errorf("patch %d (%s): %w", i+1, subject, err)
+		}
+		for _, patch := range patches {
+			if err := r.applyFilePatch(files, patch, status.Untracked); err != nil {
+				return nil, fmt.Errorf("patch %d (%s) failed: %w", i+1, subject, err)
+			}
+		}
+
+		idx := index.NewIndex()
+		for p, file := range files {
+			idx.Entries = append(idx.Entries, &index.Entry{Path: p, Mode: uint32(file.mode), Hash: file.hash})
+		}
+		idx.Sort()
+		if treeHash, err = idx.BuildTree(r.Hasher, r.ObjectDB); err != nil {
+			return nil, fmt.Errorf("failed to build tree: %w", err)
+		}
+
+		message := mailPatch.Message
+		if opts.SignOff {
+			if message, err = AddSignOff(message, committer); err != nil {
+				return nil, err
+			}
+		}
+
+		commit := object.NewCommit()
+		commit.Tree = treeHash
+		if parent != nil {
+			commit.AddParent(parent)
+		}
+		commit.Author = mailPatch.Author
+		commit.Committer = committer
+		commit.Message = message
+		commitHash, err := r.ObjectDB.Put(commit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store commit: %w", err)
+		}
+		result.Commits = append(result.Commits, commitHash)
+		messages[i] = message
+		parent = commitHash
+	}
+
+	indexPath := filepath.Join(r.GitDir, "index")
+	idx, err := index.Load(indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	if err := r.updateWorkingDirectory(treeHash, idx); err != nil {
+		return nil, fmt.Errorf("failed to update working directory: %w", err)
+	}
+	if err := idx.Save(indexPath); err != nil {
+		return nil, fmt.Errorf("failed to save index: %w", err)
+	}
+
+	for i, commitHash := range result.Commits {
+		if err := r.UpdateHEAD(commitHash, commitReflogMessage("am", messages[i])); err != nil {
+			return nil, fmt.Errorf("failed to update HEAD: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// ParseMailbox splits an mbox into patch emails and reads each one's
+// author, commit message and diff, like git mailsplit and mailinfo. Input
+// without format-patch separators is read as a single email.
+func ParseMailbox(mbox string) ([]*MailPatch, error) {
+	mbox = strings.ReplaceAll(mbox, "\r\n", "\n")
+
+	var messages []string
+	var current strings.Builder
+	started := false
+	for _, line := range strings.SplitAfter(mbox, "\n") {
+		if mboxSeparator.MatchString(strings.TrimSuffix(line, "\n")) {
+			if started {
+				messages = append(messages, current.String())
+			}
+			current.Reset()
+			started = true
+			continue
+		}
+		current.WriteString(line)
+	}
+	if started || strings.TrimSpace(current.String()) != "" {
+		messages = append(messages, current.String())
+	}
+
+	mails := make([]*MailPatch, 0, len(messages))
+	for i, message := range messages {
+		mailPatch, err := parseMailPatch(message)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse email %d: %w", i+1, err)
+		}
+		mails = append(mails, mailPatch)
+	}
+	return mails, nil
+}
+
+// parseMailPatch reads one patch email
+func parseMailPatch(message string) (*MailPatch, error) {
+	msg, err := mail.ReadMessage(strings.NewReader(message))
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid From header: %w", err)
+	}
+	when := time.Now()
+	if date := msg.Header.Get("Date"); date != "" {
+		if when, err = mail.ParseDate(date); err != nil {
+			return nil, fmt.Errorf("invalid Date header: %w", err)
+		}
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Subject header: %w", err)
+	}
+
+	var body io.Reader = msg.Body
+	switch strings.ToLower(msg.Header.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+
+	// The message ends at the "---" line or the first diff, and the patch
+	// starts at the first diff
+	var log strings.Builder
+	patch := ""
+	inLog := true
+	lines := strings.SplitAfter(string(content), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimRight(line, "\n")
+		if strings.HasPrefix(trimmed, "diff --git ") {
+			patch = strings.Join(lines[i:], "")
+			break
+		}
+		if trimmed == "---" {
+			inLog = false
+		}
+		if inLog {
+			log.WriteString(line)
+		}
+	}
+
+	text := cleanPatchSubject(subject)
+	if body := strings.Trim(log.String(), "\n"); body != "" {
+		text += "\n\n" + body
+	}
+
+	return &MailPatch{
+		Author:  object.Signature{Name: from.Name, Email: from.Address, When: when},
+		Message: text + "\n",
+		Patch:   patch,
+	}, nil
+}
+
+// cleanPatchSubject removes the "Re:" and bracketed tags such as
+// "[PATCH 1/2]" that lead an email subject
+func cleanPatchSubject(subject string) string {
+	subject = strings.Join(strings.Fields(subject), " ")
+	for {
+		switch {
+		case strings.HasPrefix(strings.ToLower(subject), "re:"):
+			subject = strings.TrimSpace(subject[3:])
+		case strings.HasPrefix(subject, "["):
+			end := strings.Index(subject, "]")
+			if end < 0 {
+				return subject
+			}
+			subject = strings.TrimSpace(subject[end+1:])
+		default:
+			return subject
+		}
+	}
+}
+
+// parsePatch reads the file patches of a git-style unified diff
+func parsePatch(text string) ([]*filePatch, error) {
+	lines := strings.SplitAfter(text, "\n")
+	var patches []*filePatch
+	var current *filePatch
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSuffix(lines[i], "\n")
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			oldPath, newPath, err := parseDiffGitPaths(strings.TrimPrefix(line, "diff --git "))
+			if err != nil {
+				return nil, err
+			}
+			current = &filePatch{oldPath: oldPath, newPath: newPath}
+			patches = append(patches, current)
+
+		case current == nil:
+			// Text before the first diff
+
+		case strings.HasPrefix(line, "new file mode "):
+			current.oldPath = ""
+			current.newMode = parsePatchMode(line)
+		case strings.HasPrefix(line, "deleted file mode "):
+			current.newPath = ""
+			current.oldMode = parsePatchMode(line)
+		case strings.HasPrefix(line, "old mode "):
+			current.oldMode = parsePatchMode(line)
+		case strings.HasPrefix(line, "new mode "):
+			current.newMode = parsePatchMode(line)
+		case strings.HasPrefix(line, "rename from "), strings.HasPrefix(line, "copy from "):
+			current.oldPath = line[strings.Index(line, "from ")+5:]
+		case strings.HasPrefix(line, "rename to "), strings.HasPrefix(line, "copy to "):
+			current.newPath = line[strings.Index(line, "to ")+3:]
+		case strings.HasPrefix(line, "index "):
+			hashes, _, _ := strings.Cut(strings.TrimPrefix(line, "index "), " ")
+			current.oldHash, current.newHash, _ = strings.Cut(hashes, "..")
+		case strings.HasPrefix(line, "Binary files "):
+			name := current.newPath
+			if name == "" {
+				name = current.oldPath
+			}
+			return nil, fmt.Errorf("cannot apply binary patch to %s without its content", name)
+		case line == "GIT binary patch":
+			if i+1 >= len(lines) {
+				return nil, fmt.Errorf("truncated binary patch")
+			}
+			hunk, next, err := parseBinaryHunk(lines, i+1)
+			if err != nil {
+				return nil, err
+			}
+			current.binary = hunk
+			// The reverse hunk that follows is only checked
+			if next+1 < len(lines) && (strings.HasPrefix(lines[next+1], "literal ") || strings.HasPrefix(lines[next+1], "delta ")) {
+				if _, next, err = parseBinaryHunk(lines, next+1); err != nil {
+					return nil, err
+				}
+			}
+			i = next
+
+		case strings.HasPrefix(line, "@@ "):
+			hunk, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			current.hunks = append(current.hunks, hunk)
+			i = next - 1
+		}
+	}
+
+	if len(patches) == 0 && strings.TrimSpace(text) != "" {
+		return nil, fmt.Errorf("no git diff found")
+	}
+	return patches, nil
+}
+
+// parseDiffGitPaths reads the two paths of a "diff --git a/x b/y" line
+func parseDiffGitPaths(s string) (string, string, error) {
+	if strings.HasPrefix(s, `"`) {
+		return "", "", fmt.Errorf("quoted paths are not supported: %s", s)
+	}
+	// The paths are equal unless the file was renamed, which lets names
+	// containing " b/" be split correctly
+	if len(s)%2 == 1 {
+		half := len(s) / 2
+		a, b := s[:half], s[half+1:]
+		if strings.HasPrefix(a, "a/") && strings.HasPrefix(b, "b/") && a[2:] == b[2:] {
+			return a[2:], b[2:], nil
+		}
+	}
+	i := strings.Index(s, " b/")
+	if !strings.HasPrefix(s, "a/") || i < 0 {
+		return "", "", fmt.Errorf("invalid diff header: diff --git %s", s)
+	}
+	return s[2:i], s[i+3:], nil
+}
+
+// parsePatchMode reads the octal mode at the end of a mode line
+func parsePatchMode(line string) object.FileMode {
+	mode, _ := strconv.ParseUint(line[strings.LastIndex(line, " ")+1:], 8, 32)
+	return object.FileMode(mode)
+}
+
+// parseHunk reads the hunk starting at lines[start] and returns it with
+// the index of the line after it
+func parseHunk(lines []string, start int) (patchHunk, int, error) {
+	header := strings.TrimSuffix(lines[start], "\n")
+	m := hunkHeader.FindStringSubmatch(header)
+	if m == nil {
+		return patchHunk{}, 0, fmt.Errorf("invalid hunk header: %s", header)
+	}
+	count := func(s string) int {
+		if s == "" {
+			return 1
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	hunk := patchHunk{oldStart: count(m[1])}
+	oldCount, newCount := count(m[2]), count(m[4])
+
+	i := start + 1
+	for ; i < len(lines) && (len(hunk.oldLines) < oldCount || len(hunk.newLines) < newCount); i++ {
+		line := lines[i]
+		if line == "" {
+			break
+		}
+		op, text := line[0], line[1:]
+		switch op {
+		case ' ':
+			hunk.oldLines = append(hunk.oldLines, text)
+			hunk.newLines = append(hunk.newLines, text)
+		case '\n':
+			// A context line whose trailing space was stripped in transit
+			hunk.oldLines = append(hunk.oldLines, "\n")
+			hunk.newLines = append(hunk.newLines, "\n")
+		case '-':
+			hunk.oldLines = append(hunk.oldLines, text)
+		case '+':
+			hunk.newLines = append(hunk.newLines, text)
+		default:
+			return patchHunk{}, 0, fmt.Errorf("corrupt patch line: %s", strings.TrimSuffix(line, "\n"))
+		}
+
+		// The marker applies to the line just read
+		if i+1 < len(lines) && strings.HasPrefix(lines[i+1], `\`) {
+			if op != '+' {
+				hunk.oldLines[len(hunk.oldLines)-1] = strings.TrimSuffix(hunk.oldLines[len(hunk.oldLines)-1], "\n")
+			}
+			if op != '-' {
+				hunk.newLines[len(hunk.newLines)-1] = strings.TrimSuffix(hunk.newLines[len(hunk.newLines)-1], "\n")
+			}
+			i++
+		}
+	}
+
+	if len(hunk.oldLines) != oldCount || len(hunk.newLines) != newCount {
+		return patchHunk{}, 0, fmt.Errorf("truncated hunk: %s", header)
+	}
+	return hunk, i, nil
+}
+
+// applyFilePatch applies one file's patch to the files of a tree,
+// storing the new blob. A new file may not replace an untracked one.
+func (r *Repository) applyFilePatch(files map[string]struct {
+	hash hash.Hash
+	mode object.FileMode
+}, patch *filePatch, untracked []string) error {
+	var content []byte
+	mode := object.ModeRegular
+	if patch.oldPath != "" {
+		old, ok := files[patch.oldPath]
+		if !ok {
+			return fmt.Errorf("%s: does not exist in index", patch.oldPath)
+		}
+		data, err := r.readBlobContent(old.hash)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", patch.oldPath, err)
+		}
+		content, mode = data, old.mode
+		if patch.oldMode != 0 && patch.oldMode != old.mode {
+			return fmt.Errorf("%s: wrong type or mode", patch.oldPath)
+		}
+	} else if _, exists := files[patch.newPath]; exists || stringSliceContains(untracked, patch.newPath) {
+		return fmt.Errorf("%s: already exists in working directory", patch.newPath)
+	}
+
+	var err error
+	if patch.binary != nil {
+		content, err = r.applyBinaryPatch(content, patch)
+	} else {
+		content, err = applyHunks(content, patch.hunks)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", patch.newPath, err)
+	}
+
+	if patch.oldPath != "" {
+		delete(files, patch.oldPath)
+	}
+	if patch.newPath == "" {
+		if len(content) > 0 {
+			return fmt.Errorf("%s: removal patch leaves file contents", patch.oldPath)
+		}
+		return nil
+	}
+	if patch.newMode != 0 {
+		mode = patch.newMode
+	}
+
+	blobHash, err := r.ObjectDB.Put(object.NewBlob(content))
+	if err != nil {
+		return fmt.Errorf("failed to store blob for %s: %w", patch.newPath, err)
+	}
+	files[patch.newPath] = struct {
+		hash hash.Hash
+		mode object.FileMode
+	}{hash: blobHash, mode: mode}
+	return nil
+}
+
+// applyBinaryPatch applies a binary patch to content. The full hashes of
+// its index line must match the content before and after.
+func (r *Repository) applyBinaryPatch(content []byte, patch *filePatch) ([]byte, error) {
+	before := hash.HashBlob(r.Hasher, content).String()
+	if len(patch.oldHash) != len(before) || len(patch.newHash) != len(before) {
+		return nil, fmt.Errorf("cannot apply binary patch without full index line")
+	}
+	zero := strings.Repeat("0", len(before))
+	if patch.oldHash != zero && patch.oldHash != before {
+		return nil, fmt.Errorf("binary patch does not apply: the file does not match %s", patch.oldHash)
+	}
+	result, err := patch.binary.apply(content)
+	if err != nil {
+		return nil, err
+	}
+	if patch.newHash != zero && patch.newHash != hash.HashBlob(r.Hasher, result).String() {
+		return nil, fmt.Errorf("binary patch creates the wrong content, expected %s", patch.newHash)
+	}
+	return result, nil
+}
+
+// applyHunks applies hunks in order. Each hunk must match exactly, but may
+// have moved from the line its header names, as with git apply.
+func applyHunks(content []byte, hunks []patchHunk) ([]byte, error) {
+	lines := diff.SplitLines(content)
+	offset, minPos := 0, 0
+
+	for n, hunk := range hunks {
+		expected := hunk.oldStart - 1 + offset
+		if len(hunk.oldLines) == 0 {
+			expected = hunk.oldStart + offset
+		}
+
+		pos := -1
+		for distance := 0; pos < 0 && (expected-distance >= minPos || expected+distance <= len(lines)); distance++ {
+			for _, candidate := range []int{expected - distance, expected + distance} {
+				if candidate >= minPos && candidate+len(hunk.oldLines) <= len(lines) && linesEqual(lines[candidate:candidate+len(hunk.oldLines)], hunk.oldLines) {
+					pos = candidate
+					break
+				}
+			}
+		}
+		if pos < 0 {
+			return nil, fmt.Errorf("patch does not apply at hunk %d", n+1)
+		}
+
+		updated := make([]string, 0, len(lines)-len(hunk.oldLines)+len(hunk.newLines))
+		updated = append(updated, lines[:pos]...)
+		updated = append(updated, hunk.newLines...)
+		updated = append(updated, lines[pos+len(hunk.oldLines):]...)
+		lines = updated
+
+		offset += pos - expected + len(hunk.newLines) - len(hunk.oldLines)
+		minPos = pos + len(hunk.newLines)
+	}
+
+	var b bytes.Buffer
+	for _, line := range lines {
+		b.WriteString(line)
+	}
+	return b.Bytes(), nil
+}
+
+// linesEqual reports whether two line slices are equal
+func linesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
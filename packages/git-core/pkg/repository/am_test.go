@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+)
+
+// TestAmRoundTrip tests applying a format-patch series to another
+// repository with the same starting commit
+func TestAmRoundTrip(t *testing.T) {
+	source, commits := setupUndoRepo(t, "one\ntwo\nthree\nfour\nfive\nsix\nseven\n")
+	commitFileContent(t, source, "one\n2\nthree\nfour\nfive\nsix\n7\n")
+	if err := os.WriteFile(filepath.Join(source.Path, "bin.sh"), []byte("#!/bin/sh\necho hi"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := addFile(source, "bin.sh"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createCommit(source, "Add a script\n\nIt has no trailing newline.\n"); err != nil {
+		t.Fatal(err)
+	}
+	commitAs(t, source, "Zoë Writer", "zoe@example.com", "Rewrite the file", 5)
+
+	patches, err := source.FormatPatch(commits[0].String(), DefaultFormatPatchOptions())
+	if err != nil {
+		t.Fatalf("FormatPatch failed: %v", err)
+	}
+	var mbox strings.Builder
+	for _, patch := range patches {
+		mbox.WriteString(patch.Content)
+	}
+
+	target, _ := setupUndoRepo(t, "one\ntwo\nthree\nfour\nfive\nsix\nseven\n")
+	target.Config.SetUser("Committer", "committer@example.com")
+	opts := DefaultAmOptions()
+	opts.SignOff = true
+	result, err := target.Am(mbox.String(), opts)
+	if err != nil {
+		t.Fatalf("Am failed: %v", err)
+	}
+	if len(result.Commits) != 3 {
+		t.Fatalf("Expected 3 commits, got %d", len(result.Commits))
+	}
+	expectHead(t, target, result.Commits[2], "Rewrite the file\n")
+
+	script, err := os.ReadFile(filepath.Join(target.Path, "bin.sh"))
+	if err != nil || string(script) != "#!/bin/sh\necho hi" {
+		t.Errorf("Unexpected bin.sh %q (%v)", script, err)
+	}
+	sourceHead, _ := source.ResolveHEAD()
+	_, want, err := source.peelToCommit(sourceHead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, got, err := target.peelToCommit(result.Commits[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Tree.Equals(want.Tree) {
+		t.Errorf("Expected tree %s, got %s", want.Tree, got.Tree)
+	}
+	if got.Author.Name != "Zoë Writer" || got.Author.Email != "zoe@example.com" || !got.Author.When.Equal(want.Author.When) {
+		t.Errorf("Expected the original author, got %+v", got.Author)
+	}
+	if got.Committer.Name != "Committer" {
+		t.Errorf("Expected the configured committer, got %+v", got.Committer)
+	}
+
+	_, script2, err := target.peelToCommit(result.Commits[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantMessage := "Add a script\n\nIt has no trailing newline.\n\nSigned-off-by: Committer <committer@example.com>\n"
+	if script2.Message != wantMessage {
+		t.Errorf("Expected message %q, got %q", wantMessage, script2.Message)
+	}
+
+	status, err := target.Status(index.DefaultStatusOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.IsClean() {
+		t.Errorf("Expected a clean worktree after am, got %+v", status.Status)
+	}
+}
+
+// TestAmFailureLeavesHeadUnchanged tests that nothing is committed when a
+// later patch in the series does not apply
+func TestAmFailureLeavesHeadUnchanged(t *testing.T) {
+	source, commits := setupUndoRepo(t, "a\n", "b\n", "c\n")
+	patches, err := source.FormatPatch(commits[0].String(), DefaultFormatPatchOptions())
+	if err != nil {
+		t.Fatalf("FormatPatch failed: %v", err)
+	}
+
+	// The first patch applies, but applying it again does not
+	target, targetCommits := setupUndoRepo(t, "a\n")
+	if _, err := target.Am(patches[0].Content+patches[0].Content, DefaultAmOptions()); err == nil {
+		t.Fatal("Expected the second patch to fail")
+	}
+	expectHead(t, target, targetCommits[0], "a\n")
+
+	if _, err := target.Am("not a patch", DefaultAmOptions()); err == nil {
+		t.Error("Expected an error for input that is not an email")
+	}
+
+	// Local changes block am
+	if err := os.WriteFile(filepath.Join(target.Path, "file.txt"), []byte("local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := target.Am(patches[1].Content, DefaultAmOptions()); err == nil {
+		t.Error("Expected local changes to block am")
+	}
+	expectHead(t, target, targetCommits[0], "local\n")
+}
+
+// TestAmBinaryRoundTrip tests that binary files added, changed and
+// deleted in a series come through as binary patches
+func TestAmBinaryRoundTrip(t *testing.T) {
+	source, commits := setupUndoRepo(t, "text\n")
+	target, _ := setupUndoRepo(t, "text\n")
+
+	image := bytes.Repeat([]byte("\x89PNG\x00image data "), 100)
+	writeBinary := func(name string, content []byte) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(source.Path, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := addFile(source, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeBinary("image.png", image)
+	writeBinary("small.bin", []byte{0, 1, 2})
+	if _, err := createCommit(source, "Add images"); err != nil {
+		t.Fatal(err)
+	}
+	writeBinary("image.png", append(append([]byte{}, image[:500]...), "edited\x00"+string(image[500:])...))
+	if _, err := source.Remove([]string{"small.bin"}, RemoveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createCommit(source, "Edit an image"); err != nil {
+		t.Fatal(err)
+	}
+
+	patches, err := source.FormatPatch(commits[0].String(), DefaultFormatPatchOptions())
+	if err != nil {
+		t.Fatalf("FormatPatch failed: %v", err)
+	}
+	if !strings.Contains(patches[0].Content, "GIT binary patch\nliteral ") || !strings.Contains(patches[1].Content, "GIT binary patch\ndelta ") {
+		t.Errorf("Expected a literal and a delta binary patch, got:\n%s\n%s", patches[0].Content, patches[1].Content)
+	}
+
+	result, err := target.Am(patches[0].Content+patches[1].Content, DefaultAmOptions())
+	if err != nil {
+		t.Fatalf("Am failed: %v", err)
+	}
+	sourceHead, _ := source.ResolveHEAD()
+	_, want, err := source.peelToCommit(sourceHead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, got, err := target.peelToCommit(result.Commits[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Tree.Equals(want.Tree) {
+		t.Errorf("Expected tree %s, got %s", want.Tree, got.Tree)
+	}
+
+	// Without the content a binary change cannot be applied
+	if _, err := parsePatch("diff --git a/x b/x\nindex 1234567..89abcde 100644\nBinary files a/x and b/x differ\n"); err == nil {
+		t.Error("Expected an error for a binary patch without data")
+	}
+}
+
+// TestParseMailbox tests reading patch emails not produced by FormatPatch
+func TestParseMailbox(t *testing.T) {
+	message := "From: =?UTF-8?q?Zo=C3=AB?= <zoe@example.com>\n" +
+		"Date: Tue, 2 Jan 2024 10:00:00 +0100\n" +
+		"Subject: Re: [PATCH v2 3/7] Fix the\n  parser\n" +
+		"Content-Type: text/plain; charset=UTF-8\n" +
+		"Content-Transfer-Encoding: quoted-printable\n" +
+		"\n" +
+		"Caf=C3=A9 input broke it.\n" +
+		"---\n" +
+		" file.txt | 2 +-\n" +
+		"\n" +
+		"diff --git a/file.txt b/file.txt\n"
+
+	mails, err := ParseMailbox(message)
+	if err != nil {
+		t.Fatalf("ParseMailbox failed: %v", err)
+	}
+	if len(mails) != 1 {
+		t.Fatalf("Expected one email, got %d", len(mails))
+	}
+	mail := mails[0]
+	if mail.Author.Name != "Zoë" || mail.Author.Email != "zoe@example.com" || mail.Author.When.Day() != 2 {
+		t.Errorf("Unexpected author %+v", mail.Author)
+	}
+	if mail.Message != "Fix the parser\n\nCafé input broke it.\n" {
+		t.Errorf("Unexpected message %q", mail.Message)
+	}
+	if mail.Patch != "diff --git a/file.txt b/file.txt\n" {
+		t.Errorf("Unexpected patch %q", mail.Patch)
+	}
+}
+
+// TestApplyHunks tests hunks that moved and hunks that no longer match
+func TestApplyHunks(t *testing.T) {
+	patches, err := parsePatch("diff --git a/f b/f\n--- a/f\n+++ b/f\n@@ -2,2 +2,2 @@\n b\n-c\n+C\n@@ -5 +5,2 @@\n e\n+f\n\\ No newline at end of file\n")
+	if err != nil {
+		t.Fatalf("parsePatch failed: %v", err)
+	}
+
+	// Two lines were inserted at the top since the patch was made
+	got, err := applyHunks([]byte("x\ny\na\nb\nc\nd\ne\n"), patches[0].hunks)
+	if err != nil {
+		t.Fatalf("applyHunks failed: %v", err)
+	}
+	if string(got) != "x\ny\na\nb\nC\nd\ne\nf" {
+		t.Errorf("Unexpected result %q", got)
+	}
+
+	if _, err := applyHunks([]byte("a\nb\nX\nd\ne\n"), patches[0].hunks); err == nil {
+		t.Error("Expected a mismatched hunk to fail")
+	}
+}
@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// ErrAmendPublished is returned when amending a commit that has already
+// been pushed, unless the amend is forced
+var ErrAmendPublished = errors.New("commit has already been pushed")
+
+// AmendCheck describes whether amending HEAD would rewrite published history
+type AmendCheck struct {
+	// Commit is the commit that would be replaced
+	Commit hash.Hash
+	// RemoteRefs are the remote-tracking refs that contain Commit
+	RemoteRefs []string
+	// Warning explains the risk when a published commit is amended anyway
+	Warning string
+}
+
+// Published reports whether the commit is contained in a remote-tracking ref
+func (c *AmendCheck) Published() bool {
+	return len(c.RemoteRefs) > 0
+}
+
+// CheckAmend checks whether HEAD is already contained in a remote-tracking
+// branch before it is amended. Amending a published commit fails with
+// ErrAmendPublished unless force is set, in which case the result carries
+// a warning instead.
+func (r *Repository) CheckAmend(force bool) (*AmendCheck, error) {
+	head, err := r.ResolveHEAD()
+	if err != nil {
+		return nil, fmt.Errorf("nothing to amend: %w", err)
+	}
+
+	remoteRefs, err := r.remoteRefsContaining(head)
+	if err != nil {
+		return nil, err
+	}
+
+	check := &AmendCheck{Commit: head, RemoteRefs: remoteRefs}
+	if !check.Published() {
+		return check, nil
+	}
+
+	names := make([]string, len(remoteRefs))
+	for i, ref := range remoteRefs {
+		names[i] = strings.TrimPrefix(ref, "refs/remotes/")
+	}
+	if !force {
+		return nil, fmt.Errorf("%w to %s; amending it rewrites published history (use force to amend anyway)",
+			ErrAmendPublished, strings.Join(names, ", "))
+	}
+
+	check.Warning = fmt.Sprintf("amending %s, which has already been pushed to %s; pushing the amended commit will require a force push",
+		shortHash(head), strings.Join(names, ", "))
+	return check, nil
+}
+
+// remoteRefsContaining returns the remote-tracking refs whose history
+// contains the commit
+func (r *Repository) remoteRefsContaining(h hash.Hash) ([]string, error) {
+	refs, err := r.ListRefs("refs/remotes/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote-tracking refs: %w", err)
+	}
+
+	containing := []string{}
+	for _, ref := range refs {
+		// refs/remotes/<remote>/HEAD only repeats another ref
+		if strings.HasSuffix(ref, "/HEAD") {
+			continue
+		}
+
+		tip, err := r.ResolveRef(ref)
+		if err != nil {
+			continue
+		}
+		contains, err := r.IsAncestor(h, tip)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check %s: %w", ref, err)
+		}
+		if contains {
+			containing = append(containing, ref)
+		}
+	}
+
+	sort.Strings(containing)
+	return containing, nil
+}
+
+// AmendOptions configures AmendCommit
+type AmendOptions struct {
+	// Message replaces the commit message. Empty keeps the old message.
+	Message string
+	// Author replaces the original author, like --author or --reset-author.
+	// Nil keeps the original author and date.
+	Author *object.Signature
+	// Committer records who amended the commit. Nil uses the configured
+	// user at the current time.
+	Committer *object.Signature
+	// Force amends a commit that has already been pushed
+	Force bool
+	// AllowEmpty permits an amend that leaves the commit with no changes
+	AllowEmpty bool
+	// Signer, when set, signs the new commit, like git commit --amend -S
+	Signer object.Signer
+	// NoVerify skips the pre-commit and commit-msg hooks
+	NoVerify bool
+	// SignOff adds the configured user's Signed-off-by trailer, like -s
+	SignOff bool
+}
+
+// DefaultAmendOptions returns default amend options
+func DefaultAmendOptions() AmendOptions {
+	return AmendOptions{
+		Message:    "",
+		Author:     nil,
+		Committer:  nil,
+		Force:      false,
+		AllowEmpty: false,
+		Signer:     nil,
+		NoVerify:   false,
+		SignOff:    false,
+	}
+}
+
+// AmendResult describes an amended commit
+type AmendResult struct {
+	// Commit is the new commit
+	Commit hash.Hash
+	// Replaced is the commit it replaced
+	Replaced hash.Hash
+	// Warning is set when a published commit was amended with Force
+	Warning string
+}
+
+// AmendCommit replaces HEAD with a commit of the index, like git commit
+// --amend. The new commit keeps HEAD's parents, and its author and message
+// unless overridden. The current branch, or HEAD when detached, moves to
+// the new commit with a "commit (amend)" reflog entry.
+func (r *Repository) AmendCommit(opts AmendOptions) (*AmendResult, error) {
+	check, err := r.CheckAmend(opts.Force)
+	if err != nil {
+		return nil, err
+	}
+
+	_, head, err := r.peelToCommit(check.Commit)
+	if err != nil {
+		return nil, err
+	}
+
+	committer := object.Signature{}
+	if opts.Committer != nil {
+		committer = *opts.Committer
+	} else {
+		name, email := r.Config.GetUser()
+		committer = object.Signature{Name: name, Email: email, When: time.Now()}
+	}
+
+	message := opts.Message
+	if message == "" {
+		message = head.Message
+	}
+	if opts.SignOff {
+		if message, err = AddSignOff(message, committer); err != nil {
+			return nil, err
+		}
+	}
+	// Hooks run before the index is read, so they may stage changes
+	if !opts.NoVerify {
+		if message, err = r.RunCommitHooks(message); err != nil {
+			return nil, err
+		}
+	}
+
+	indexPath := filepath.Join(r.GitDir, "index")
+	idx, err := index.Load(indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	if err := idx.WriteBlobs(r.WorkTree(), r.ObjectDB); err != nil {
+		return nil, fmt.Errorf("failed to write blobs: %w", err)
+	}
+
+	// As in Git, an amend may only leave a commit empty if it already was
+	commitOpts := index.CommitOptions{
+		Message:    message,
+		Author:     head.Author,
+		Committer:  committer,
+		Parents:    head.Parents,
+		AllowEmpty: opts.AllowEmpty || r.commitIsEmpty(head),
+		Signer:     opts.Signer,
+	}
+	if opts.Author != nil {
+		commitOpts.Author = *opts.Author
+	}
+
+	commitHash, err := idx.CreateCommit(r.Hasher, r.ObjectDB, commitOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create commit: %w", err)
+	}
+
+	if err := r.UpdateHEAD(commitHash, commitReflogMessage("commit (amend)", commitOpts.Message)); err != nil {
+		return nil, fmt.Errorf("failed to update HEAD: %w", err)
+	}
+
+	return &AmendResult{
+		Commit:   commitHash,
+		Replaced: check.Commit,
+		Warning:  check.Warning,
+	}, nil
+}
+
+// commitIsEmpty reports whether a commit records no changes: its tree is
+// its only parent's, or the empty tree for a root commit
+func (r *Repository) commitIsEmpty(commit *object.Commit) bool {
+	switch len(commit.Parents) {
+	case 0:
+		return commit.Tree.Equals(object.EmptyTreeHash(r.Hasher))
+	case 1:
+		_, parent, err := r.peelToCommit(commit.Parents[0])
+		return err == nil && parent.Tree.Equals(commit.Tree)
+	default:
+		return false
+	}
+}
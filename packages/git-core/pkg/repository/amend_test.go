@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// TestCheckAmend tests that pushed commits are protected from amending
+func TestCheckAmend(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "one", "two")
+
+	// Nothing has been pushed yet
+	check, err := repo.CheckAmend(false)
+	if err != nil {
+		t.Fatalf("CheckAmend failed: %v", err)
+	}
+	if check.Published() || !check.Commit.Equals(commits[1]) {
+		t.Errorf("Unexpected check %+v", check)
+	}
+
+	// The remote has HEAD, recorded both as a branch and as origin/HEAD
+	if err := repo.UpdateRef("refs/remotes/origin/main", commits[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateRef("refs/remotes/origin/HEAD", commits[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateRef("refs/remotes/fork/old", commits[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.CheckAmend(false)
+	if !errors.Is(err, ErrAmendPublished) || !strings.Contains(err.Error(), "origin/main") {
+		t.Errorf("Expected ErrAmendPublished naming origin/main, got %v", err)
+	}
+
+	check, err = repo.CheckAmend(true)
+	if err != nil {
+		t.Fatalf("Forced CheckAmend failed: %v", err)
+	}
+	if len(check.RemoteRefs) != 1 || check.RemoteRefs[0] != "refs/remotes/origin/main" {
+		t.Errorf("Unexpected remote refs %v", check.RemoteRefs)
+	}
+	if !strings.Contains(check.Warning, "force push") {
+		t.Errorf("Expected a warning, got %q", check.Warning)
+	}
+
+	// A new local commit can be amended freely again
+	commitFileContent(t, repo, "three")
+	if _, err := repo.CheckAmend(false); err != nil {
+		t.Errorf("Expected unpushed commit to be amendable, got %v", err)
+	}
+}
+
+// TestAmendCommit tests replacing HEAD with an amended commit
+func TestAmendCommit(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "one", "two")
+
+	// Stage a fix to fold into HEAD
+	if err := os.WriteFile(filepath.Join(repo.Path, "file.txt"), []byte("two, fixed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := addFile(repo, "file.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := repo.AmendCommit(DefaultAmendOptions())
+	if err != nil {
+		t.Fatalf("AmendCommit failed: %v", err)
+	}
+	if !result.Replaced.Equals(commits[1]) || result.Commit.Equals(commits[1]) {
+		t.Errorf("Expected a new commit replacing HEAD, got %+v", result)
+	}
+
+	head, _ := repo.ResolveHEAD()
+	if !head.Equals(result.Commit) {
+		t.Error("Expected the branch to move to the amended commit")
+	}
+
+	amended, _, err := repo.GetCommit(result.Commit.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, _, _ := repo.GetCommit(commits[1].String())
+	if len(amended.Parents) != 1 || !amended.Parents[0].Equals(commits[0]) {
+		t.Error("Expected the amended commit to keep HEAD's parents")
+	}
+	if amended.Message != original.Message {
+		t.Errorf("Expected the message to be kept, got %q", amended.Message)
+	}
+	if amended.Author.Name != "Test User" || !amended.Author.When.Equal(original.Author.When) {
+		t.Errorf("Expected the original author, got %+v", amended.Author)
+	}
+	if content, _ := repo.getFileAtCommit("file.txt", amended); string(content) != "two, fixed" {
+		t.Errorf("Expected the staged fix in the amended tree, got %q", content)
+	}
+
+	entries, err := repo.Reflog("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := entries[0]; last.Message != "commit (amend): Write two" || !last.Old.Equals(commits[1]) {
+		t.Errorf("Unexpected reflog entry %+v", last)
+	}
+
+	// The message and author can be replaced
+	opts := DefaultAmendOptions()
+	opts.Message = "Write two properly"
+	opts.Author = &object.Signature{Name: "Other", Email: "other@example.com", When: original.Author.When}
+	result, err = repo.AmendCommit(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	amended, _, _ = repo.GetCommit(result.Commit.String())
+	if amended.Message != "Write two properly\n" || amended.Author.Name != "Other" {
+		t.Errorf("Expected the new message and author, got %q by %s", amended.Message, amended.Author.Name)
+	}
+}
+
+// TestAmendCommitEmpty tests that an amend can't silently empty a commit
+func TestAmendCommitEmpty(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "one", "two")
+
+	// Stage the parent's content, undoing everything HEAD changed
+	if err := os.WriteFile(filepath.Join(repo.Path, "file.txt"), []byte("one"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := addFile(repo, "file.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.AmendCommit(DefaultAmendOptions()); !errors.Is(err, index.ErrEmptyCommit) {
+		t.Fatalf("Expected ErrEmptyCommit, got %v", err)
+	}
+	if head, _ := repo.ResolveHEAD(); !head.Equals(commits[1]) {
+		t.Error("Expected HEAD to be unchanged")
+	}
+
+	opts := DefaultAmendOptions()
+	opts.AllowEmpty = true
+	if _, err := repo.AmendCommit(opts); err != nil {
+		t.Fatalf("AmendCommit with AllowEmpty failed: %v", err)
+	}
+
+	// An empty commit can be amended again without AllowEmpty
+	opts = DefaultAmendOptions()
+	opts.Message = "Placeholder"
+	if _, err := repo.AmendCommit(opts); err != nil {
+		t.Errorf("Expected an already empty commit to be amendable, got %v", err)
+	}
+}
+
+// TestAmendCommitSigned tests that an amended commit can be signed
+func TestAmendCommitSigned(t *testing.T) {
+	repo, _ := setupUndoRepo(t, "a\n")
+
+	opts := DefaultAmendOptions()
+	opts.Signer = object.SignerFunc(func(payload []byte) (string, error) {
+		return "-----BEGIN SSH SIGNATURE-----\nU1NIU0lH\n-----END SSH SIGNATURE-----\n", nil
+	})
+	result, err := repo.AmendCommit(opts)
+	if err != nil {
+		t.Fatalf("AmendCommit failed: %v", err)
+	}
+
+	commit, _, err := repo.GetCommit(result.Commit.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(commit.GPGSignature, "-----BEGIN SSH SIGNATURE-----\n") {
+		t.Errorf("Expected the amended commit to be signed, got %q", commit.GPGSignature)
+	}
+	if err := commit.ComputeHash(repo.Hasher); err != nil || !commit.Hash().Equals(result.Commit) {
+		t.Error("Expected the stored signed commit to hash to its name")
+	}
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// The frozen API listed in the package documentation. These assignments
+// stop compiling if one of the signatures changes.
+var (
+	_ func(string, InitOptions) error                         = Init
+	_ func(string, InitOptions) (*Repository, error)          = Create
+	_ func(string) (*Repository, error)                       = Open
+	_ func(string) bool                                       = IsRepository
+	_ func(string) (string, error)                            = FindRepository
+	_ func(string, string, CloneOptions) (*Repository, error) = Clone
+	_ func() CloneOptions                                     = DefaultCloneOptions
+	_ func() InitOptions                                      = DefaultInitOptions
+
+	_ func(*Repository) (string, error)            = (*Repository).HEAD
+	_ func(*Repository) (hash.Hash, error)         = (*Repository).ResolveHEAD
+	_ func(*Repository, string) (hash.Hash, error) = (*Repository).ResolveRef
+	_ func(*Repository, string) (hash.Hash, error) = (*Repository).ResolveRevision
+	_ func(*Repository, string, hash.Hash) error   = (*Repository).UpdateRef
+	_ func(*Repository) (string, error)            = (*Repository).CurrentBranch
+	_ func(*Repository) ([]string, error)          = (*Repository).ListBranches
+	_ func(*Repository, string) (hash.Hash, error) = (*Repository).GetBranch
+	_ func(*Repository, string, hash.Hash) error   = (*Repository).CreateBranch
+	_ func(*Repository, string) error              = (*Repository).DeleteBranch
+
+	_ func(*Repository, string, CheckoutOptions) error             = (*Repository).Checkout
+	_ func(*Repository, string, LogOptions) ([]*LogEntry, error)   = (*Repository).Log
+	_ func(*Repository, string) (*object.Commit, hash.Hash, error) = (*Repository).GetCommit
+	_ func(*Repository, string) (*ShowResult, error)               = (*Repository).Show
+	_ func(*Repository, string, string) ([]byte, error)            = (*Repository).ShowFile
+	_ func() CheckoutOptions                                       = DefaultCheckoutOptions
+	_ func() LogOptions                                            = DefaultLogOptions
+)
@@ -0,0 +1,270 @@
+package repository
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// ArchiveFormat is the file format written by Archive
+type ArchiveFormat string
+
+const (
+	// ArchiveTar writes an uncompressed tar file
+	ArchiveTar ArchiveFormat = "tar"
+	// ArchiveTarGz writes a gzip-compressed tar file
+	ArchiveTarGz ArchiveFormat = "tar.gz"
+	// ArchiveZip writes a zip file
+	ArchiveZip ArchiveFormat = "zip"
+)
+
+// archiveWriter writes entries in one archive format
+type archiveWriter interface {
+	writeDir(name string) error
+	writeFile(name string, mode os.FileMode, content []byte) error
+	writeSymlink(name string, target []byte) error
+	Close() error
+}
+
+// Archive writes a snapshot of a commit or tree to w as a tar, tar.gz or
+// zip file, with every path placed under prefix. Contents are streamed
+// from the object database, so no worktree is needed.
+func (r *Repository) Archive(commitish string, format ArchiveFormat, prefix string, w io.Writer) error {
+	h, err := r.ResolveRevision(commitish)
+	if err != nil {
+		return err
+	}
+
+	tree, commit, err := r.peelToTree(h)
+	if err != nil {
+		return err
+	}
+
+	// Like git archive, use the commit time so archives are reproducible
+	mtime := time.Now()
+	commitID := ""
+	if commit != nil {
+		mtime = commit.Committer.When
+		if commitHash, _, err := r.peelToCommit(h); err == nil {
+			commitID = commitHash.String()
+		}
+	}
+
+	var archive archiveWriter
+	switch format {
+	case ArchiveTar:
+		archive, err = newTarArchive(w, mtime, commitID)
+	case ArchiveTarGz:
+		gz := gzip.NewWriter(w)
+		gz.ModTime = mtime
+		var inner archiveWriter
+		inner, err = newTarArchive(gz, mtime, commitID)
+		archive = &gzipArchive{archiveWriter: inner, gz: gz}
+	case ArchiveZip:
+		archive = newZipArchive(w, mtime, commitID)
+	default:
+		return fmt.Errorf("unsupported archive format: %s", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	if prefix != "" && prefix[len(prefix)-1] == '/' {
+		if err := archive.writeDir(prefix); err != nil {
+			return fmt.Errorf("failed to write %s: %w", prefix, err)
+		}
+	}
+
+	if err := r.archiveTree(archive, tree, prefix); err != nil {
+		return err
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return nil
+}
+
+// archiveTree writes a tree's entries, recursing into subtrees
+func (r *Repository) archiveTree(archive archiveWriter, tree *object.Tree, prefix string) error {
+	for _, entry := range tree.Entries() {
+		name := prefix + entry.Name
+
+		switch entry.Mode {
+		case object.ModeDir:
+			if err := archive.writeDir(name + "/"); err != nil {
+				return fmt.Errorf("failed to write %s: %w", name, err)
+			}
+			obj, err := r.ObjectDB.Get(entry.Hash)
+			if err != nil {
+				return fmt.Errorf("failed to load tree %s: %w", name, err)
+			}
+			subtree, ok := obj.(*object.Tree)
+			if !ok {
+				return fmt.Errorf("object for %s is not a tree", name)
+			}
+			if err := r.archiveTree(archive, subtree, name+"/"); err != nil {
+				return err
+			}
+
+		case object.ModeGitlink:
+			// Submodule contents are not part of this repository
+			if err := archive.writeDir(name + "/"); err != nil {
+				return fmt.Errorf("failed to write %s: %w", name, err)
+			}
+
+		default:
+			obj, err := r.ObjectDB.Get(entry.Hash)
+			if err != nil {
+				return fmt.Errorf("failed to load blob %s: %w", name, err)
+			}
+			blob, ok := obj.(*object.Blob)
+			if !ok {
+				return fmt.Errorf("object for %s is not a blob", name)
+			}
+
+			switch entry.Mode {
+			case object.ModeSymlink:
+				err = archive.writeSymlink(name, blob.Content())
+			case object.ModeExecutable:
+				err = archive.writeFile(name, 0775, blob.Content())
+			default:
+				err = archive.writeFile(name, 0664, blob.Content())
+			}
+			if err != nil {
+				return fmt.Errorf("failed to write %s: %w", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// tarArchive writes tar entries
+type tarArchive struct {
+	tw    *tar.Writer
+	mtime time.Time
+}
+
+// newTarArchive starts a tar file, recording the commit ID in a pax
+// global header as git archive does
+func newTarArchive(w io.Writer, mtime time.Time, commitID string) (*tarArchive, error) {
+	archive := &tarArchive{tw: tar.NewWriter(w), mtime: mtime}
+
+	if commitID != "" {
+		header := &tar.Header{
+			Typeflag:   tar.TypeXGlobalHeader,
+			PAXRecords: map[string]string{"comment": commitID},
+		}
+		if err := archive.tw.WriteHeader(header); err != nil {
+			return nil, fmt.Errorf("failed to write pax header: %w", err)
+		}
+	}
+
+	return archive, nil
+}
+
+func (a *tarArchive) writeDir(name string) error {
+	return a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name,
+		Mode:     0775,
+		ModTime:  a.mtime,
+	})
+}
+
+func (a *tarArchive) writeFile(name string, mode os.FileMode, content []byte) error {
+	if err := a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(mode),
+		Size:     int64(len(content)),
+		ModTime:  a.mtime,
+	}); err != nil {
+		return err
+	}
+	_, err := a.tw.Write(content)
+	return err
+}
+
+func (a *tarArchive) writeSymlink(name string, target []byte) error {
+	return a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeSymlink,
+		Name:     name,
+		Linkname: string(target),
+		Mode:     0777,
+		ModTime:  a.mtime,
+	})
+}
+
+func (a *tarArchive) Close() error {
+	return a.tw.Close()
+}
+
+// gzipArchive compresses the output of another archive writer
+type gzipArchive struct {
+	archiveWriter
+	gz *gzip.Writer
+}
+
+func (a *gzipArchive) Close() error {
+	if err := a.archiveWriter.Close(); err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
+
+// zipArchive writes zip entries
+type zipArchive struct {
+	zw    *zip.Writer
+	mtime time.Time
+}
+
+// newZipArchive starts a zip file, using the commit ID as the archive
+// comment as git archive does
+func newZipArchive(w io.Writer, mtime time.Time, commitID string) *zipArchive {
+	archive := &zipArchive{zw: zip.NewWriter(w), mtime: mtime}
+	if commitID != "" {
+		archive.zw.SetComment(commitID)
+	}
+	return archive
+}
+
+func (a *zipArchive) writeDir(name string) error {
+	header := &zip.FileHeader{Name: name, Method: zip.Store, Modified: a.mtime}
+	header.SetMode(os.ModeDir | 0775)
+	_, err := a.zw.CreateHeader(header)
+	return err
+}
+
+func (a *zipArchive) writeFile(name string, mode os.FileMode, content []byte) error {
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: a.mtime}
+	header.SetMode(mode)
+	return a.writeEntry(header, content)
+}
+
+func (a *zipArchive) writeSymlink(name string, target []byte) error {
+	header := &zip.FileHeader{Name: name, Method: zip.Store, Modified: a.mtime}
+	header.SetMode(os.ModeSymlink | 0777)
+	return a.writeEntry(header, target)
+}
+
+// writeEntry writes a zip entry with its content
+func (a *zipArchive) writeEntry(header *zip.FileHeader, content []byte) error {
+	w, err := a.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+func (a *zipArchive) Close() error {
+	return a.zw.Close()
+}
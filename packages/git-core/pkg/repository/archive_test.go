@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// setupArchiveRepo creates a repository whose main branch has a commit with
+// a regular file, an executable, a symlink and a submodule
+func setupArchiveRepo(t *testing.T) (*Repository, hash.Hash, time.Time) {
+	t.Helper()
+
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	put := func(obj object.Object) hash.Hash {
+		h, err := repo.ObjectDB.Put(obj)
+		if err != nil {
+			t.Fatalf("Failed to store object: %v", err)
+		}
+		return h
+	}
+
+	bin := object.NewTree()
+	bin.AddEntryWithMode(object.ModeExecutable, "run.sh", put(object.NewBlobFromString("#!/bin/sh\n")))
+	bin.AddEntryWithMode(object.ModeSymlink, "latest", put(object.NewBlobFromString("run.sh")))
+
+	root := object.NewTree()
+	root.AddEntryWithMode(object.ModeRegular, "README", put(object.NewBlobFromString("hello\n")))
+	root.AddEntryWithMode(object.ModeDir, "bin", put(bin))
+	root.AddEntryWithMode(object.ModeGitlink, "vendor", put(object.NewBlobFromString("placeholder")))
+
+	when := time.Unix(1700000000, 0).UTC()
+	commit := object.NewCommit()
+	commit.Tree = put(root)
+	commit.Author = object.Signature{Name: "Test User", Email: "test@example.com", When: when}
+	commit.Committer = commit.Author
+	commit.Message = "Snapshot\n"
+	commitHash := put(commit)
+
+	if err := repo.UpdateRef("refs/heads/main", commitHash); err != nil {
+		t.Fatal(err)
+	}
+
+	return repo, commitHash, when
+}
+
+// TestArchiveTar tests tar output, including modes, links and the commit comment
+func TestArchiveTar(t *testing.T) {
+	repo, commitHash, when := setupArchiveRepo(t)
+
+	var buf bytes.Buffer
+	if err := repo.Archive("main", ArchiveTar, "snap/", &buf); err != nil {
+		t.Fatalf("Archive failed: %v", err)
+	}
+
+	tr := tar.NewReader(&buf)
+	names := []string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read tar: %v", err)
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			if header.PAXRecords["comment"] != commitHash.String() {
+				t.Errorf("Expected commit comment, got %v", header.PAXRecords)
+			}
+			continue
+		}
+		names = append(names, header.Name)
+
+		if !header.ModTime.Equal(when) {
+			t.Errorf("%s: ModTime = %v, expected %v", header.Name, header.ModTime, when)
+		}
+
+		switch header.Name {
+		case "snap/README":
+			content, _ := io.ReadAll(tr)
+			if string(content) != "hello\n" || header.Mode != 0664 {
+				t.Errorf("README = %q mode %o", content, header.Mode)
+			}
+		case "snap/bin/run.sh":
+			if header.Mode != 0775 {
+				t.Errorf("run.sh mode = %o, expected 0775", header.Mode)
+			}
+		case "snap/bin/latest":
+			if header.Typeflag != tar.TypeSymlink || header.Linkname != "run.sh" {
+				t.Errorf("latest = %c -> %q", header.Typeflag, header.Linkname)
+			}
+		}
+	}
+
+	expected := []string{"snap/", "snap/README", "snap/bin/", "snap/bin/latest", "snap/bin/run.sh", "snap/vendor/"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Entries = %v, expected %v", names, expected)
+	}
+}
+
+// TestArchiveZipAndTarGz tests the compressed formats
+func TestArchiveZipAndTarGz(t *testing.T) {
+	repo, commitHash, _ := setupArchiveRepo(t)
+
+	var buf bytes.Buffer
+	if err := repo.Archive(commitHash.String()[:8], ArchiveZip, "", &buf); err != nil {
+		t.Fatalf("Archive failed: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+	if zr.Comment != commitHash.String() {
+		t.Errorf("Zip comment = %q", zr.Comment)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	if f := files["bin/run.sh"]; f == nil || f.Mode().Perm() != 0775 {
+		t.Errorf("Expected executable bin/run.sh, got %v", f)
+	}
+	if f := files["bin/latest"]; f == nil || f.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Expected symlink bin/latest, got %v", f)
+	}
+	if f := files["README"]; f != nil {
+		rc, _ := f.Open()
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(content) != "hello\n" {
+			t.Errorf("README = %q", content)
+		}
+	} else {
+		t.Error("Missing README")
+	}
+
+	buf.Reset()
+	if err := repo.Archive("HEAD", ArchiveTarGz, "", &buf); err != nil {
+		t.Fatalf("Archive failed: %v", err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("Failed to read gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	if header, err := tr.Next(); err != nil || header.Typeflag != tar.TypeXGlobalHeader {
+		t.Errorf("Expected pax global header first, got %v (%v)", header, err)
+	}
+	header, err := tr.Next()
+	if err != nil || header.Name != "README" {
+		t.Errorf("First entry = %v (%v)", header, err)
+	}
+}
+
+// TestArchiveErrors tests unknown formats and revisions
+func TestArchiveErrors(t *testing.T) {
+	repo, _, _ := setupArchiveRepo(t)
+
+	var buf bytes.Buffer
+	if err := repo.Archive("main", ArchiveFormat("rar"), "", &buf); err == nil {
+		t.Error("Expected error for unsupported format")
+	}
+	if err := repo.Archive("missing", ArchiveTar, "", &buf); err == nil {
+		t.Error("Expected error for unknown revision")
+	}
+}
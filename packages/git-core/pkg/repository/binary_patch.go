@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+// base85Alphabet is the alphabet of Git's base85 encoding
+const base85Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz!#$%&()*+-;<=>?@^_`{|}~"
+
+// binaryLineBytes is the most data one line of a binary patch holds
+const binaryLineBytes = 52
+
+// binaryDeltaMaxWork bounds the product of the sizes of two blobs that a
+// delta is tried between. The delta encoder compares every position of
+// both, so larger pairs are always sent literally.
+const binaryDeltaMaxWork = 1 << 24
+
+// binaryHunk is one direction of a Git binary patch
+type binaryHunk struct {
+	// delta is set when data is a delta against the old content rather
+	// than the new content itself
+	delta bool
+	data  []byte
+}
+
+// encodeBinaryPatch returns the body of a Git binary patch turning
+// oldContent into newContent, the lines after "GIT binary patch". Like
+// git diff --binary, each direction is a delta when that is smaller than
+// the literal content.
+func encodeBinaryPatch(oldContent, newContent []byte) (string, error) {
+	var b strings.Builder
+	for _, pair := range [][2][]byte{{oldContent, newContent}, {newContent, oldContent}} {
+		if err := writeBinaryHunk(&b, pair[0], pair[1]); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+// writeBinaryHunk writes the section of a binary patch that turns from
+// into to
+func writeBinaryHunk(b *strings.Builder, from, to []byte) error {
+	kind, data := "literal", to
+	deflated, err := deflate(to)
+	if err != nil {
+		return err
+	}
+	if len(from) > 0 && len(to) > 0 && len(from)*len(to) <= binaryDeltaMaxWork {
+		delta, err := protocol.CreateAndEncodeDelta(from, to)
+		if err != nil {
+			return fmt.Errorf("failed to create delta: %w", err)
+		}
+		deflatedDelta, err := deflate(delta)
+		if err != nil {
+			return err
+		}
+		if len(deflatedDelta) < len(deflated) {
+			kind, data, deflated = "delta", delta, deflatedDelta
+		}
+	}
+
+	fmt.Fprintf(b, "%s %d\n", kind, len(data))
+	for len(deflated) > 0 {
+		n := len(deflated)
+		if n > binaryLineBytes {
+			n = binaryLineBytes
+		}
+		if n <= 26 {
+			b.WriteByte(byte('A' + n - 1))
+		} else {
+			b.WriteByte(byte('a' + n - 27))
+		}
+		b.WriteString(encodeBase85(deflated[:n]))
+		b.WriteByte('\n')
+		deflated = deflated[n:]
+	}
+	b.WriteByte('\n')
+	return nil
+}
+
+// parseBinaryHunk reads the binary patch section starting at lines[start]
+// and returns it with the index of the line after it
+func parseBinaryHunk(lines []string, start int) (*binaryHunk, int, error) {
+	header := strings.TrimSuffix(lines[start], "\n")
+	kind, sizeText, _ := strings.Cut(header, " ")
+	size, err := strconv.Atoi(sizeText)
+	if (kind != "literal" && kind != "delta") || err != nil {
+		return nil, 0, fmt.Errorf("invalid binary patch header: %s", header)
+	}
+
+	var deflated []byte
+	i := start + 1
+	for ; i < len(lines); i++ {
+		line := strings.TrimSuffix(lines[i], "\n")
+		if line == "" {
+			break
+		}
+		n := 0
+		switch c := line[0]; {
+		case c >= 'A' && c <= 'Z':
+			n = int(c-'A') + 1
+		case c >= 'a' && c <= 'z':
+			n = int(c-'a') + 27
+		}
+		data, err := decodeBase85(line[1:])
+		if n == 0 || err != nil || len(data) < n {
+			return nil, 0, fmt.Errorf("corrupt binary patch line: %s", line)
+		}
+		deflated = append(deflated, data[:n]...)
+	}
+
+	reader, err := zlib.NewReader(bytes.NewReader(deflated))
+	if err != nil {
+		return nil, 0, fmt.Errorf("corrupt binary patch: %w", err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, 0, fmt.Errorf("corrupt binary patch: %w", err)
+	}
+	if len(data) != size {
+		return nil, 0, fmt.Errorf("binary patch holds %d bytes, expected %d", len(data), size)
+	}
+	return &binaryHunk{delta: kind == "delta", data: data}, i, nil
+}
+
+// apply returns the content the hunk turns content into
+func (h *binaryHunk) apply(content []byte) ([]byte, error) {
+	if !h.delta {
+		return h.data, nil
+	}
+	delta, err := protocol.ParseDelta(h.data)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt binary delta: %w", err)
+	}
+	result, err := protocol.ApplyDelta(content, delta)
+	if err != nil {
+		return nil, fmt.Errorf("binary delta does not apply: %w", err)
+	}
+	return result, nil
+}
+
+// deflate compresses data with zlib
+func deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeBase85 encodes data four bytes at a time, padding the last group
+// with zeros, as Git does in binary patches
+func encodeBase85(data []byte) string {
+	var b strings.Builder
+	for len(data) > 0 {
+		var acc uint32
+		for i := 0; i < 4; i++ {
+			acc <<= 8
+			if i < len(data) {
+				acc |= uint32(data[i])
+			}
+		}
+		var group [5]byte
+		for i := 4; i >= 0; i-- {
+			group[i] = base85Alphabet[acc%85]
+			acc /= 85
+		}
+		b.Write(group[:])
+		if len(data) < 4 {
+			break
+		}
+		data = data[4:]
+	}
+	return b.String()
+}
+
+// decodeBase85 decodes groups of five base85 characters into four bytes
+// each
+func decodeBase85(s string) ([]byte, error) {
+	if len(s)%5 != 0 {
+		return nil, fmt.Errorf("base85 data has %d characters", len(s))
+	}
+	data := make([]byte, 0, len(s)/5*4)
+	for ; len(s) > 0; s = s[5:] {
+		var acc uint64
+		for i := 0; i < 5; i++ {
+			digit := strings.IndexByte(base85Alphabet, s[i])
+			if digit < 0 {
+				return nil, fmt.Errorf("invalid base85 character %q", s[i])
+			}
+			acc = acc*85 + uint64(digit)
+		}
+		if acc > 0xffffffff {
+			return nil, fmt.Errorf("base85 group out of range")
+		}
+		data = append(data, byte(acc>>24), byte(acc>>16), byte(acc>>8), byte(acc))
+	}
+	return data, nil
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBase85(t *testing.T) {
+	for _, data := range [][]byte{{}, {0}, {1, 2, 3, 4}, []byte("binary\x00data!")} {
+		encoded := encodeBase85(data)
+		decoded, err := decodeBase85(encoded)
+		if err != nil {
+			t.Fatalf("decodeBase85(%q) failed: %v", encoded, err)
+		}
+		// The last group is padded with zeros
+		if !bytes.Equal(decoded[:len(data)], data) || len(decoded)-len(data) >= 4 {
+			t.Errorf("Round trip of %v gave %v", data, decoded)
+		}
+	}
+	if _, err := decodeBase85("abc"); err == nil {
+		t.Error("Expected an error for a partial group")
+	}
+
+	// An empty file is sent literally
+	var b strings.Builder
+	if err := writeBinaryHunk(&b, []byte("x"), nil); err != nil {
+		t.Fatal(err)
+	}
+	hunk, _, err := parseBinaryHunk(strings.SplitAfter(b.String(), "\n"), 0)
+	if err != nil || !strings.HasPrefix(b.String(), "literal 0\n") || hunk.delta || len(hunk.data) != 0 {
+		t.Errorf("Unexpected empty literal %q (%v)", b.String(), err)
+	}
+}
+
+// The patches were made by git diff --binary
+func TestApplyGitBinaryPatch(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	big := bytes.Repeat(make([]byte, 256), 8)
+	for i := range big {
+		big[i] = byte(i)
+	}
+	bigChanged := append([]byte{}, big...)
+	bigChanged[100] = 7
+
+	tests := []struct {
+		name     string
+		patch    string
+		old, new []byte
+	}{
+		{
+			name: "literal",
+			patch: "diff --git a/bin b/bin\n" +
+				"index 6b9c38a64d7ad44e9cdb5b5abd26481703116e03..0ea8399d345798c70ae19835051c3fc93b0c454a 100644\n" +
+				"GIT binary patch\n" +
+				"literal 12\n" +
+				"TcmYdHN@hq&P2;MltSScp8QTOx\n" +
+				"\n" +
+				"literal 11\n" +
+				"ScmYdHN@hq&P2;MltO5WPnFGrJ\n" +
+				"\n",
+			old: []byte("abc\x00def\nxyz"),
+			new: []byte("abc\x00def\nxyzw"),
+		},
+		{
+			name: "delta",
+			patch: "diff --git a/big b/big\n" +
+				"index e57fd5b4e8e07e39a62591e0851986e97116111c..336d6e04a0b776c7f951e84c0e19b938218c6426 100644\n" +
+				"GIT binary patch\n" +
+				"delta 12\n" +
+				"TcmZn=Xb_l?!pOccbv8Qy7~uoe\n" +
+				"\n" +
+				"delta 10\n" +
+				"RcmZn=Xb@P$$i9e?5daV10&f5S\n" +
+				"\n",
+			old: big,
+			new: bigChanged,
+		},
+		{
+			name: "new file",
+			patch: "diff --git a/new.bin b/new.bin\n" +
+				"new file mode 100644\n" +
+				"index 0000000000000000000000000000000000000000..8352675d67aed6625ece79af41c27fdb4ee2e867\n" +
+				"GIT binary patch\n" +
+				"literal 3\n" +
+				"KcmZQzWC8#H2LJ>B\n" +
+				"\n" +
+				"literal 0\n" +
+				"HcmV?d00001\n" +
+				"\n",
+			new: []byte{0, 1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patches, err := parsePatch(tt.patch)
+			if err != nil {
+				t.Fatalf("parsePatch failed: %v", err)
+			}
+			if len(patches) != 1 || patches[0].binary == nil {
+				t.Fatalf("Expected one binary patch, got %+v", patches)
+			}
+			got, err := repo.applyBinaryPatch(tt.old, patches[0])
+			if err != nil {
+				t.Fatalf("applyBinaryPatch failed: %v", err)
+			}
+			if !bytes.Equal(got, tt.new) {
+				t.Errorf("Got %q, want %q", got, tt.new)
+			}
+
+			// The index line guards against applying to other content
+			if tt.old == nil {
+				return
+			}
+			if _, err := repo.applyBinaryPatch(append(tt.old, 'x'), patches[0]); err == nil {
+				t.Error("Expected an error for the wrong preimage")
+			}
+		})
+	}
+}
+
+func TestEncodeBinaryPatch(t *testing.T) {
+	big := bytes.Repeat([]byte("0123456789abcdef\x00"), 64)
+	changed := append([]byte("prefix"), big...)
+
+	body, err := encodeBinaryPatch(big, changed)
+	if err != nil {
+		t.Fatalf("encodeBinaryPatch failed: %v", err)
+	}
+	// A small change is sent as deltas both ways
+	if !strings.HasPrefix(body, "delta ") || !strings.Contains(body, "\n\ndelta ") {
+		t.Errorf("Expected deltas, got:\n%s", body)
+	}
+
+	lines := strings.SplitAfter(body, "\n")
+	forward, next, err := parseBinaryHunk(lines, 0)
+	if err != nil {
+		t.Fatalf("parseBinaryHunk failed: %v", err)
+	}
+	reverse, _, err := parseBinaryHunk(lines, next+1)
+	if err != nil {
+		t.Fatalf("parseBinaryHunk failed on the reverse hunk: %v", err)
+	}
+	if got, err := forward.apply(big); err != nil || !bytes.Equal(got, changed) {
+		t.Errorf("Forward hunk gave %q (%v)", got, err)
+	}
+	if got, err := reverse.apply(changed); err != nil || !bytes.Equal(got, big) {
+		t.Errorf("Reverse hunk gave %q (%v)", got, err)
+	}
+}
@@ -0,0 +1,377 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// Bisect state, kept in the same files as Git so a session survives a
+// reload and can be continued by other Git tools
+const (
+	bisectStartFile    = "BISECT_START"
+	bisectLogFile      = "BISECT_LOG"
+	bisectTermsFile    = "BISECT_TERMS"
+	bisectExpectedFile = "BISECT_EXPECTED_REV"
+	bisectRefPrefix    = "refs/bisect/"
+	bisectBadRef       = bisectRefPrefix + "bad"
+)
+
+// BisectResult describes a bisect session after a step
+type BisectResult struct {
+	// Next is the commit checked out for testing. It is nil when the first
+	// bad commit has been found, or when a bad commit or any good commits
+	// are still to be marked.
+	Next hash.Hash
+	// Remaining is the number of revisions left to test after Next
+	Remaining int
+	// Steps is roughly how many more steps the session will take
+	Steps int
+	// FirstBad is the first bad commit, once found
+	FirstBad hash.Hash
+}
+
+// Done reports whether the first bad commit has been found
+func (b *BisectResult) Done() bool {
+	return b.FirstBad != nil
+}
+
+// BisectStart starts a bisect session, like git bisect start. bad and good
+// may be given up front; otherwise mark them with BisectBad and BisectGood.
+// The current branch is restored by BisectReset.
+func (r *Repository) BisectStart(bad string, good []string) (*BisectResult, error) {
+	state, err := r.OperationState()
+	if err != nil {
+		return nil, err
+	}
+	if state.InProgress() {
+		return nil, fmt.Errorf("cannot start bisecting: a %s is already in progress", state.Operation)
+	}
+
+	// Remember where to return to: the branch, or the commit when detached
+	start, err := r.CurrentBranch()
+	if err != nil {
+		head, err := r.ResolveHEAD()
+		if err != nil {
+			return nil, fmt.Errorf("cannot bisect without a commit checked out: %w", err)
+		}
+		start = head.String()
+	}
+
+	if err := r.writeStateFile(bisectStartFile, start+"\n"); err != nil {
+		return nil, err
+	}
+	if err := r.writeStateFile(bisectTermsFile, "bad\ngood\n"); err != nil {
+		return nil, err
+	}
+	if err := r.writeStateFile(bisectLogFile, "git bisect start\n"); err != nil {
+		return nil, err
+	}
+
+	if bad != "" {
+		if err := r.markBisect("bad", bad); err != nil {
+			r.clearBisectState()
+			return nil, err
+		}
+	}
+	for _, rev := range good {
+		if err := r.markBisect("good", rev); err != nil {
+			r.clearBisectState()
+			return nil, err
+		}
+	}
+
+	return r.bisectNext()
+}
+
+// BisectBad marks a commit as bad, HEAD when rev is empty, and checks out
+// the next commit to test
+func (r *Repository) BisectBad(rev string) (*BisectResult, error) {
+	return r.bisectMark("bad", rev)
+}
+
+// BisectGood marks a commit as good, HEAD when rev is empty, and checks out
+// the next commit to test
+func (r *Repository) BisectGood(rev string) (*BisectResult, error) {
+	return r.bisectMark("good", rev)
+}
+
+// BisectSkip marks a commit that can't be tested, HEAD when rev is empty,
+// and checks out another commit to test
+func (r *Repository) BisectSkip(rev string) (*BisectResult, error) {
+	return r.bisectMark("skip", rev)
+}
+
+// BisectReset ends the bisect session and checks out the branch or commit
+// that was checked out when it started
+func (r *Repository) BisectReset() error {
+	if !fileExistsIn(r.GitDir, bisectStartFile) {
+		return fmt.Errorf("not bisecting")
+	}
+
+	start := r.readStateLine(bisectStartFile)
+	if start != "" {
+		if err := r.Checkout(start, DefaultCheckoutOptions()); err != nil {
+			return fmt.Errorf("failed to check out %s: %w", start, err)
+		}
+	}
+
+	r.clearBisectState()
+	return nil
+}
+
+// bisectMark records a verdict in a running session and moves on
+func (r *Repository) bisectMark(term, rev string) (*BisectResult, error) {
+	if !fileExistsIn(r.GitDir, bisectStartFile) {
+		return nil, fmt.Errorf("not bisecting")
+	}
+	if rev == "" {
+		rev = "HEAD"
+	}
+	if err := r.markBisect(term, rev); err != nil {
+		return nil, err
+	}
+	return r.bisectNext()
+}
+
+// markBisect writes the ref and log line for a verdict on a commit
+func (r *Repository) markBisect(term, rev string) error {
+	h, err := r.ResolveRevision(rev)
+	if err != nil {
+		return err
+	}
+	h, commit, err := r.peelToCommit(h)
+	if err != nil {
+		return err
+	}
+
+	ref := bisectBadRef
+	if term != "bad" {
+		ref = bisectRefPrefix + term + "-" + h.String()
+	}
+	if err := r.UpdateRef(ref, h); err != nil {
+		return fmt.Errorf("failed to mark %s as %s: %w", shortHash(h), term, err)
+	}
+
+	return r.appendBisectLog(fmt.Sprintf("# %s: [%s] %s\ngit bisect %s %s\n", term, h.String(), commitSubject(commit.Message), term, h.String()))
+}
+
+// bisectNext picks and checks out the next commit to test, or reports the
+// first bad commit when there is nothing left to test
+func (r *Repository) bisectNext() (*BisectResult, error) {
+	result := &BisectResult{}
+
+	bad, _ := r.ResolveRef(bisectBadRef)
+	refs, err := r.ListRefs(bisectRefPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bisect refs: %w", err)
+	}
+	var good []hash.Hash
+	skipped := make(map[string]bool)
+	for _, ref := range refs {
+		name := strings.TrimPrefix(ref, bisectRefPrefix)
+		h, err := r.ResolveRef(ref)
+		if err != nil {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(name, "good-"):
+			good = append(good, h)
+		case strings.HasPrefix(name, "skip-"):
+			skipped[h.String()] = true
+		}
+	}
+
+	// Wait until both ends are known
+	if bad == nil || len(good) == 0 {
+		return result, nil
+	}
+
+	candidates, parents, err := r.bisectCandidates(bad, good)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("bad commit %s is an ancestor of a good commit", shortHash(bad))
+	}
+
+	if len(candidates) == 1 {
+		result.FirstBad = bad
+		_, commit, err := r.peelToCommit(bad)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.appendBisectLog(fmt.Sprintf("# first bad commit: [%s] %s\n", bad.String(), commitSubject(commit.Message))); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	best, weight := bisectMidpoint(candidates, parents, skipped)
+	if best == nil {
+		var untested []string
+		for _, c := range candidates {
+			untested = append(untested, shortHash(c))
+		}
+		return nil, fmt.Errorf("only skipped commits left to test; the first bad commit is one of %s", strings.Join(untested, ", "))
+	}
+
+	if err := r.Checkout(best.String(), CheckoutOptions{Detach: true}); err != nil {
+		return nil, fmt.Errorf("failed to check out %s: %w", shortHash(best), err)
+	}
+	if err := r.writeStateFile(bisectExpectedFile, best.String()+"\n"); err != nil {
+		return nil, err
+	}
+
+	result.Next = best
+	result.Remaining = len(candidates) - weight - 1
+	result.Steps = estimateBisectSteps(len(candidates))
+	return result, nil
+}
+
+// bisectCandidates returns the commits reachable from bad but not from any
+// good commit, newest first, with their parents within that set
+func (r *Repository) bisectCandidates(bad hash.Hash, good []hash.Hash) ([]hash.Hash, map[string][]string, error) {
+	excluded := make(map[string]bool)
+	for _, g := range good {
+		ancestors, err := r.GetAncestors(g)
+		if err != nil {
+			return nil, nil, err
+		}
+		excluded[g.String()] = true
+		for _, a := range ancestors {
+			excluded[a.String()] = true
+		}
+	}
+
+	shallow := r.shallowSet()
+	var candidates []hash.Hash
+	parents := make(map[string][]string)
+	visited := make(map[string]bool)
+	queue := []hash.Hash{bad}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		key := current.String()
+		if visited[key] || excluded[key] {
+			continue
+		}
+		visited[key] = true
+
+		_, commit, err := r.peelToCommit(current)
+		if err != nil {
+			return nil, nil, err
+		}
+		candidates = append(candidates, current)
+
+		if shallow[key] {
+			continue
+		}
+		for _, p := range commit.Parents {
+			if !excluded[p.String()] {
+				parents[key] = append(parents[key], p.String())
+			}
+			queue = append(queue, p)
+		}
+	}
+
+	return candidates, parents, nil
+}
+
+// bisectMidpoint picks the untested, unskipped candidate that splits the
+// candidates most evenly: the one whose count of reachable candidates,
+// itself included, is closest to half. Ties go to the older commit, as in
+// Git. It returns that count too.
+func bisectMidpoint(candidates []hash.Hash, parents map[string][]string, skipped map[string]bool) (hash.Hash, int) {
+	var best hash.Hash
+	bestWeight, bestScore := 0, -1
+
+	// Candidates are newest first
+	for i := len(candidates) - 1; i >= 0; i-- {
+		c := candidates[i]
+		key := c.String()
+		if skipped[key] {
+			continue
+		}
+
+		// Count the candidates reachable from c
+		reached := map[string]bool{key: true}
+		stack := []string{key}
+		for len(stack) > 0 {
+			current := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, p := range parents[current] {
+				if !reached[p] {
+					reached[p] = true
+					stack = append(stack, p)
+				}
+			}
+		}
+
+		weight := len(reached)
+		score := weight
+		if other := len(candidates) - weight; other < score {
+			score = other
+		}
+		if score > bestScore {
+			best, bestWeight, bestScore = c, weight, score
+		}
+	}
+
+	if bestScore <= 0 {
+		// Only the bad commit itself is left untested
+		return nil, 0
+	}
+	return best, bestWeight
+}
+
+// estimateBisectSteps estimates the remaining steps the way Git reports
+// them: about log2 of the candidates, rounded towards the likelier case
+func estimateBisectSteps(all int) int {
+	if all < 3 {
+		return 0
+	}
+	n := 0
+	for 1<<(n+1) <= all {
+		n++
+	}
+	e := 1 << n
+	x := all - e
+	if e < 3*x {
+		return n
+	}
+	return n - 1
+}
+
+// writeStateFile writes a state file relative to GitDir
+func (r *Repository) writeStateFile(name, content string) error {
+	if err := WriteFileInRepo(r.GitDir, name, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// appendBisectLog appends lines to BISECT_LOG
+func (r *Repository) appendBisectLog(lines string) error {
+	f, err := os.OpenFile(filepath.Join(r.GitDir, bisectLogFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", bisectLogFile, err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(lines); err != nil {
+		return fmt.Errorf("failed to write %s: %w", bisectLogFile, err)
+	}
+	return nil
+}
+
+// clearBisectState removes the bisect refs and state files
+func (r *Repository) clearBisectState() {
+	os.RemoveAll(r.refPath(bisectRefPrefix))
+	for _, name := range []string{bisectStartFile, bisectLogFile, bisectTermsFile, bisectExpectedFile} {
+		os.Remove(filepath.Join(r.GitDir, name))
+	}
+}
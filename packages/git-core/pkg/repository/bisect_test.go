@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBisect tests a bisect session over a linear history
+func TestBisect(t *testing.T) {
+	var contents []string
+	for i := 0; i < 10; i++ {
+		contents = append(contents, fmt.Sprintf("%d\n", i))
+	}
+	repo, commits := setupUndoRepo(t, contents...)
+
+	result, err := repo.BisectStart("HEAD", []string{commits[0].String()})
+	if err != nil {
+		t.Fatalf("BisectStart failed: %v", err)
+	}
+
+	// Nine candidates: the midpoint is c4, like Git picks
+	if !result.Next.Equals(commits[4]) {
+		t.Errorf("Expected c4 to be checked out first, got %s", shortHash(result.Next))
+	}
+	if result.Remaining != 4 || result.Steps != 2 {
+		t.Errorf("Expected 4 revisions left in roughly 2 steps, got %d in %d", result.Remaining, result.Steps)
+	}
+	head, _ := repo.ResolveHEAD()
+	if !head.Equals(commits[4]) {
+		t.Errorf("Expected HEAD at c4, got %s", shortHash(head))
+	}
+
+	state, err := repo.OperationState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Operation != OperationBisect {
+		t.Errorf("Expected a bisect in progress, got %q", state.Operation)
+	}
+
+	// c7 introduced the bug
+	const firstBad = 7
+	steps := 0
+	for !result.Done() {
+		if steps++; steps > 10 {
+			t.Fatal("Bisect did not converge")
+		}
+		index := -1
+		for i, c := range commits {
+			if c.Equals(result.Next) {
+				index = i
+			}
+		}
+		if index >= firstBad {
+			result, err = repo.BisectBad("")
+		} else {
+			result, err = repo.BisectGood("")
+		}
+		if err != nil {
+			t.Fatalf("Bisect step failed: %v", err)
+		}
+	}
+	if !result.FirstBad.Equals(commits[firstBad]) {
+		t.Errorf("Expected first bad commit c7, got %s", shortHash(result.FirstBad))
+	}
+
+	log, err := os.ReadFile(filepath.Join(repo.GitDir, "BISECT_LOG"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(log), "# first bad commit: ["+commits[firstBad].String()+"] Write 7") {
+		t.Errorf("Expected the first bad commit in BISECT_LOG, got:\n%s", log)
+	}
+
+	if err := repo.BisectReset(); err != nil {
+		t.Fatalf("BisectReset failed: %v", err)
+	}
+	if branch, err := repo.CurrentBranch(); err != nil || branch != "main" {
+		t.Errorf("Expected to be back on main, got %q (%v)", branch, err)
+	}
+	if _, err := os.Stat(filepath.Join(repo.GitDir, "refs", "bisect")); !os.IsNotExist(err) {
+		t.Error("Expected bisect refs to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(repo.GitDir, "BISECT_START")); !os.IsNotExist(err) {
+		t.Error("Expected BISECT_START to be removed")
+	}
+}
+
+// TestBisectSkip tests that skipped commits aren't offered again
+func TestBisectSkip(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "a\n", "b\n", "c\n", "d\n")
+
+	if _, err := repo.BisectStart("", nil); err != nil {
+		t.Fatalf("BisectStart failed: %v", err)
+	}
+	result, err := repo.BisectBad("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Next != nil || result.Done() {
+		t.Fatal("Expected to wait for a good commit")
+	}
+
+	if result, err = repo.BisectGood(commits[0].String()); err != nil {
+		t.Fatal(err)
+	}
+	first := result.Next
+
+	if result, err = repo.BisectSkip(""); err != nil {
+		t.Fatalf("BisectSkip failed: %v", err)
+	}
+	if result.Next == nil || result.Next.Equals(first) {
+		t.Errorf("Expected a commit other than the skipped %s", shortHash(first))
+	}
+
+	if _, err := repo.BisectSkip(""); err == nil {
+		t.Error("Expected an error once only skipped commits are left")
+	}
+}
+
+// TestBisectUndo tests that undo ends a bisect session
+func TestBisectUndo(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "a\n", "b\n", "c\n")
+
+	if _, err := repo.BisectStart("HEAD", []string{commits[0].String()}); err != nil {
+		t.Fatalf("BisectStart failed: %v", err)
+	}
+	if _, err := repo.BisectStart("HEAD", nil); err == nil {
+		t.Error("Expected an error starting a second session")
+	}
+
+	if _, err := repo.Undo(DefaultUndoOptions()); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	if branch, _ := repo.CurrentBranch(); branch != "main" {
+		t.Errorf("Expected to be back on main, got %q", branch)
+	}
+	if fileExistsIn(repo.GitDir, "BISECT_START") {
+		t.Error("Expected the bisect session to end")
+	}
+}
@@ -0,0 +1,406 @@
+package repository
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/diff"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// blameSuspect is a line of the blamed file whose commit is not known yet
+type blameSuspect struct {
+	// final is the line's index in the blamed file, and line its index in
+	// the version of the file suspected of introducing it
+	final int
+	line  int
+}
+
+// blameOrigin is the version of the blamed file in a commit, and the lines
+// that commit is suspected of introducing
+type blameOrigin struct {
+	hash   hash.Hash
+	commit *object.Commit
+	path   string
+	blob   hash.Hash
+	// lines is the content of the blob, loaded while it is needed
+	lines    []string
+	suspects []blameSuspect
+}
+
+// blamer passes the blame for lines from commits to their parents, newest
+// commit first, like git blame. A line stays with a commit when no parent
+// has it.
+type blamer struct {
+	repo    *Repository
+	opts    BlameOptions
+	mailmap *Mailmap
+	shallow map[string]bool
+
+	queue  *commitQueue
+	queued map[string]bool
+	// origins holds the versions of the file met so far, by commit
+	origins map[string][]*blameOrigin
+
+	// final holds the lines of the blamed file, and result the blame for
+	// those from offset on
+	final  []string
+	result []*BlameLine
+	offset int
+}
+
+// run passes the blame through history until each line has a commit
+func (b *blamer) run() error {
+	for b.queue.len() > 0 {
+		c := b.queue.pop()
+		key := c.hash.String()
+		delete(b.queued, key)
+		for _, o := range b.origins[key] {
+			if len(o.suspects) == 0 {
+				continue
+			}
+			if err := b.passBlame(o); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// passBlame passes the lines an origin has in common with its parents on
+// to them and blames it for the rest
+func (b *blamer) passBlame(o *blameOrigin) error {
+	// Shallow boundaries are grafted as root commits
+	parents := o.commit.Parents
+	if b.shallow[o.hash.String()] {
+		parents = nil
+	}
+
+	// parentOrigins holds each parent's version of the file, or nil
+	parentOrigins := make([]*blameOrigin, len(parents))
+	for i, parent := range parents {
+		po, err := b.parentOrigin(o, parent)
+		if err != nil {
+			return err
+		}
+		if po != nil && po.blob.Equals(o.blob) {
+			// A parent with the same file is given all the lines
+			b.pass(po, o.suspects)
+			o.suspects = nil
+			o.lines = nil
+			return nil
+		}
+		parentOrigins[i] = po
+	}
+
+	for _, po := range parentOrigins {
+		if po != nil && len(o.suspects) > 0 {
+			if err := b.passUnchanged(o, po); err != nil {
+				return err
+			}
+		}
+	}
+
+	if b.opts.DetectMoves || b.opts.CopyLevel > 0 {
+		for _, po := range parentOrigins {
+			if po != nil && len(o.suspects) > 0 {
+				if err := b.passCopies(o, []*blameOrigin{po}, b.opts.MoveScore); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if b.opts.CopyLevel > 0 {
+		for i, parent := range parents {
+			if len(o.suspects) == 0 {
+				break
+			}
+			candidates, err := b.copyCandidates(o, parent, parentOrigins[i])
+			if err != nil {
+				return err
+			}
+			if err := b.passCopies(o, candidates, b.opts.CopyScore); err != nil {
+				return err
+			}
+		}
+	}
+
+	b.blame(o)
+	o.lines = nil
+	return nil
+}
+
+// passUnchanged passes the lines a diff finds unchanged between a parent's
+// version and the origin's on to the parent
+func (b *blamer) passUnchanged(o, po *blameOrigin) error {
+	lines, err := b.load(o)
+	if err != nil {
+		return err
+	}
+	parentLines, err := b.load(po)
+	if err != nil {
+		return err
+	}
+
+	// parentIndex maps the lines of the origin to the same lines of the
+	// parent, or -1
+	parentIndex := make([]int, len(lines))
+	for i := range parentIndex {
+		parentIndex[i] = -1
+	}
+	for _, edit := range diff.Lines(parentLines, lines, diff.DefaultOptions()) {
+		if edit.Op == diff.Equal {
+			parentIndex[edit.NewIndex] = edit.OldIndex
+		}
+	}
+
+	var kept, passed []blameSuspect
+	for _, s := range o.suspects {
+		if i := parentIndex[s.line]; i >= 0 {
+			passed = append(passed, blameSuspect{final: s.final, line: i})
+		} else {
+			kept = append(kept, s)
+		}
+	}
+	o.suspects = kept
+	b.pass(po, passed)
+	// The parent's lines are loaded again when its turn comes
+	po.lines = nil
+	return nil
+}
+
+// pass adds suspects to an origin and queues its commit
+func (b *blamer) pass(o *blameOrigin, suspects []blameSuspect) {
+	if len(suspects) == 0 {
+		return
+	}
+	o.suspects = append(o.suspects, suspects...)
+	if !b.queued[o.hash.String()] {
+		b.queued[o.hash.String()] = true
+		b.queue.push(&logCommit{hash: o.hash, commit: o.commit})
+	}
+}
+
+// blame attributes the remaining suspects of an origin to its commit
+func (b *blamer) blame(o *blameOrigin) {
+	sort.Slice(o.suspects, func(i, j int) bool { return o.suspects[i].final < o.suspects[j].final })
+	lines := make([]*BlameLine, 0, len(o.suspects))
+	for _, s := range o.suspects {
+		line := &BlameLine{
+			LineNumber:         s.final + 1,
+			Content:            strings.TrimSuffix(b.final[s.final], "\n"),
+			Commit:             o.commit,
+			CommitHash:         o.hash,
+			OriginalLineNumber: s.line + 1,
+			Path:               o.path,
+		}
+		b.result[s.final-b.offset] = line
+		lines = append(lines, line)
+	}
+	o.suspects = nil
+	if b.opts.IncrementalCallback != nil && len(lines) > 0 {
+		b.opts.IncrementalCallback(lines)
+	}
+}
+
+// origin returns the version of the file at path in a commit, adding it
+// when it is met for the first time
+func (b *blamer) origin(h hash.Hash, commit *object.Commit, path string, blob hash.Hash) *blameOrigin {
+	for _, o := range b.origins[h.String()] {
+		if o.path == path {
+			return o
+		}
+	}
+	o := &blameOrigin{hash: h, commit: commit, path: path, blob: blob}
+	b.origins[h.String()] = append(b.origins[h.String()], o)
+	return o
+}
+
+// parentOrigin returns a parent's version of the file of an origin, under
+// the name it had before the commit renamed it, or nil when the parent has
+// no such file
+func (b *blamer) parentOrigin(o *blameOrigin, parent hash.Hash) (*blameOrigin, error) {
+	for _, po := range b.origins[parent.String()] {
+		if po.path == o.path {
+			return po, nil
+		}
+	}
+
+	obj, err := b.repo.ObjectDB.Get(parent)
+	if err != nil {
+		return nil, nil // A missing parent has nothing to pass on to
+	}
+	commit, ok := obj.(*object.Commit)
+	if !ok {
+		return nil, nil
+	}
+	path, err := b.repo.renamedFrom(o.commit, parent, o.path, DefaultDiffOptions())
+	if err != nil {
+		return nil, err
+	}
+	entry, err := b.repo.pathEntry(commit.Tree, path)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil || entry.Mode == object.ModeDir || entry.Mode == object.ModeGitlink {
+		return nil, nil
+	}
+	return b.origin(parent, b.mailmap.MapCommit(commit), path, entry.Hash), nil
+}
+
+// copyCandidates returns the versions of other files in a parent that
+// lines of an origin may have been copied from, given the parent's version
+// of the origin's file
+func (b *blamer) copyCandidates(o *blameOrigin, parent hash.Hash, po *blameOrigin) ([]*blameOrigin, error) {
+	tree, parentCommit, err := b.repo.peelToTree(parent)
+	if err != nil {
+		return nil, nil // A missing parent has nothing to pass on to
+	}
+
+	files := make(map[string]treeFile)
+	harder := b.opts.CopyLevel >= 3 || b.opts.CopyLevel == 2 && (po == nil || po.path != o.path)
+	if harder {
+		if err := b.repo.collectTreeFiles(tree, "", files); err != nil {
+			return nil, err
+		}
+	} else {
+		// Only the files the commit modified or deleted
+		changes := []FileDiff{}
+		if err := b.repo.diffTreeEntries(parentCommit.Tree, o.commit.Tree, "", &changes); err != nil {
+			return nil, err
+		}
+		for _, change := range changes {
+			if change.OldHash != nil {
+				files[change.Path] = treeFile{hash: change.OldHash, mode: change.OldMode}
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(files))
+	for path, file := range files {
+		if file.mode == object.ModeGitlink || po != nil && path == po.path {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	commit := b.mailmap.MapCommit(parentCommit)
+	candidates := make([]*blameOrigin, len(paths))
+	for i, path := range paths {
+		candidates[i] = &blameOrigin{hash: parent, commit: commit, path: path, blob: files[path].hash}
+	}
+	return candidates, nil
+}
+
+// passCopies passes blocks of lines of an origin found in candidate
+// versions on to the candidate with the best block, when that block has
+// more than minScore alphanumeric characters. Candidates become origins of
+// the walk only when they are given lines.
+func (b *blamer) passCopies(o *blameOrigin, candidates []*blameOrigin, minScore int) error {
+	lines, err := b.load(o)
+	if err != nil {
+		return err
+	}
+	sort.Slice(o.suspects, func(i, j int) bool { return o.suspects[i].line < o.suspects[j].line })
+
+	// best holds the best block found for each suspect
+	type copyMatch struct {
+		score  int
+		origin *blameOrigin
+		line   int
+	}
+	best := make([]copyMatch, len(o.suspects))
+
+	for _, candidate := range candidates {
+		candidateLines := candidate.lines
+		if candidateLines == nil {
+			content, err := b.repo.readBlobContent(candidate.blob)
+			if err != nil {
+				return err
+			}
+			candidateLines = diff.SplitLines(content)
+		}
+
+		// Each run of suspects on consecutive lines is searched for as a
+		// whole
+		for start := 0; start < len(o.suspects); {
+			end := start + 1
+			for end < len(o.suspects) && o.suspects[end].line == o.suspects[end-1].line+1 {
+				end++
+			}
+			first := o.suspects[start].line
+			run := lines[first : o.suspects[end-1].line+1]
+
+			// blocks are the runs of equal lines the diff finds
+			var block []diff.Edit
+			score := 0
+			flush := func() {
+				if score > minScore {
+					for _, edit := range block {
+						if i := start + edit.NewIndex; score > best[i].score {
+							best[i] = copyMatch{score: score, origin: candidate, line: edit.OldIndex}
+						}
+					}
+				}
+				block, score = block[:0], 0
+			}
+			for _, edit := range diff.Lines(candidateLines, run, diff.DefaultOptions()) {
+				if edit.Op != diff.Equal {
+					flush()
+					continue
+				}
+				if len(block) > 0 && edit.OldIndex != block[len(block)-1].OldIndex+1 {
+					flush()
+				}
+				block = append(block, edit)
+				score += alnumCount(edit.Line)
+			}
+			flush()
+			start = end
+		}
+	}
+
+	passed := make(map[*blameOrigin][]blameSuspect)
+	var kept []blameSuspect
+	for i, s := range o.suspects {
+		if best[i].origin == nil {
+			kept = append(kept, s)
+			continue
+		}
+		passed[best[i].origin] = append(passed[best[i].origin], blameSuspect{final: s.final, line: best[i].line})
+	}
+	o.suspects = kept
+	for _, candidate := range candidates {
+		if suspects := passed[candidate]; len(suspects) > 0 {
+			b.pass(b.origin(candidate.hash, candidate.commit, candidate.path, candidate.blob), suspects)
+		}
+	}
+	return nil
+}
+
+// alnumCount counts the ASCII letters and digits of a line, which is how
+// git blame scores moved and copied blocks
+func alnumCount(line string) int {
+	n := 0
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			n++
+		}
+	}
+	return n
+}
+
+// load returns the lines of an origin's version of the file
+func (b *blamer) load(o *blameOrigin) ([]string, error) {
+	if o.lines == nil {
+		content, err := b.repo.readBlobContent(o.blob)
+		if err != nil {
+			return nil, err
+		}
+		o.lines = diff.SplitLines(content)
+	}
+	return o.lines, nil
+}
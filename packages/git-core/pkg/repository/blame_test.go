@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// TestBlame tests that lines are attributed to the commits that introduced
+// them through a merge, matching git blame on the same history
+func TestBlame(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	a := commitTestTree(t, repo, "A", map[string]string{"f": "a\nb\nc\nd\n"})
+	b := commitTestTree(t, repo, "B", map[string]string{"f": "a\nB\nc\nd\ne\n"}, a)
+	c := commitTestTree(t, repo, "C", map[string]string{"f": "x\na\nb\nc\nd\n"}, a)
+	m := commitTestTree(t, repo, "M", map[string]string{"f": "x\na\nB\nc\nm\nd\ne\n"}, b, c)
+	d := commitTestTree(t, repo, "D", map[string]string{"f": "x\nB\nc\nm\nd\ne\nend\n"}, m)
+
+	blame := func(opts BlameOptions) string {
+		t.Helper()
+		lines, err := repo.Blame("f", d, opts)
+		if err != nil {
+			t.Fatalf("Blame failed: %v", err)
+		}
+		var got []string
+		for _, line := range lines {
+			got = append(got, strings.TrimSpace(line.Commit.Message)+":"+line.Content)
+			if line.OriginalLineNumber == 0 {
+				t.Errorf("line %d has no original line number", line.LineNumber)
+			}
+		}
+		return strings.Join(got, " ")
+	}
+
+	if got, want := blame(DefaultBlameOptions()), "C:x B:B A:c M:m A:d B:e D:end"; got != want {
+		t.Errorf("Blame = %q, want %q", got, want)
+	}
+
+	opts := DefaultBlameOptions()
+	opts.StartLine = 3
+	opts.EndLine = 5
+	if got, want := blame(opts), "A:c M:m A:d"; got != want {
+		t.Errorf("Blame of lines 3-5 = %q, want %q", got, want)
+	}
+
+	// Original line numbers count in the version of the introducing commit
+	lines, err := repo.Blame("f", d, DefaultBlameOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var original []int
+	for _, line := range lines {
+		original = append(original, line.OriginalLineNumber)
+	}
+	if got, want := fmt.Sprint(original), "[1 2 3 5 4 5 7]"; got != want {
+		t.Errorf("original line numbers = %s, want %s", got, want)
+	}
+
+	// Each line is reported once as it is attributed
+	opts = DefaultBlameOptions()
+	reported := make(map[int]string)
+	opts.IncrementalCallback = func(lines []*BlameLine) {
+		for _, line := range lines {
+			if _, ok := reported[line.LineNumber]; ok {
+				t.Errorf("line %d reported twice", line.LineNumber)
+			}
+			reported[line.LineNumber] = strings.TrimSpace(line.Commit.Message)
+		}
+	}
+	blame(opts)
+	if len(reported) != 7 || reported[1] != "C" || reported[7] != "D" {
+		t.Errorf("incremental blame reported %v", reported)
+	}
+
+	if _, err := repo.Blame("f", d, BlameOptions{StartLine: 9}); err == nil {
+		t.Error("expected an error for a start line past the end of the file")
+	}
+}
+
+// TestBlameRenamesAndCopies tests that blame follows renames, and moved and
+// copied lines with DetectMoves and CopyLevel, matching git blame -M and -C
+func TestBlameRenamesAndCopies(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	alpha := func(words ...string) string {
+		var b strings.Builder
+		for _, word := range words {
+			b.WriteString("alpha line " + word + " with words\n")
+		}
+		return b.String()
+	}
+	bravo := "bravo first line of the other file\nbravo second line of the other file\nbravo third line of the other file\n"
+
+	a := commitTestTree(t, repo, "A", map[string]string{"a.txt": alpha("one", "two", "three", "four", "five", "six"), "b.txt": bravo})
+	renamed := strings.Replace(alpha("one", "two", "three", "four", "five", "six"), alpha("four"), "changed line four in rename\n", 1)
+	b := commitTestTree(t, repo, "B", map[string]string{"c.txt": renamed, "b.txt": bravo}, a)
+	moved := alpha("three") + "changed line four in rename\n" + alpha("five", "six", "one", "two")
+	c := commitTestTree(t, repo, "C", map[string]string{"c.txt": moved, "b.txt": bravo}, b)
+	copied := moved + "bravo second line of the other file\nbravo third line of the other file\n"
+	d := commitTestTree(t, repo, "D", map[string]string{"c.txt": copied, "b.txt": "bravo first line of the other file\nbravo new\n"}, c)
+	e := commitTestTree(t, repo, "E", map[string]string{"c.txt": copied, "b.txt": "bravo first line of the other file\nbravo new\n", "d.txt": "short\n" + alpha("five", "six")}, d)
+	f := commitTestTree(t, repo, "F", map[string]string{"c.txt": copied, "b.txt": "bravo first line of the other file\nbravo new\n", "d.txt": "x\n" + alpha("five", "six")}, e)
+	g := commitTestTree(t, repo, "G", map[string]string{"c.txt": copied, "b.txt": "bravo first line of the other file\nbravo new\n", "d.txt": "x\n" + alpha("five", "six", "one", "two")}, f)
+
+	tests := []struct {
+		path      string
+		commit    hash.Hash
+		moves     bool
+		copyLevel int
+		want      string
+	}{
+		{path: "c.txt", commit: g, want: "A:a.txt:3 B:c.txt:4 A:a.txt:5 A:a.txt:6 C:c.txt:5 C:c.txt:6 D:c.txt:7 D:c.txt:8"},
+		{path: "c.txt", commit: g, moves: true, want: "A:a.txt:3 B:c.txt:4 A:a.txt:5 A:a.txt:6 A:a.txt:1 A:a.txt:2 D:c.txt:7 D:c.txt:8"},
+		{path: "c.txt", commit: g, copyLevel: 1, want: "A:a.txt:3 B:c.txt:4 A:a.txt:5 A:a.txt:6 A:a.txt:1 A:a.txt:2 A:b.txt:2 A:b.txt:3"},
+		{path: "d.txt", commit: e, copyLevel: 1, want: "E:d.txt:1 E:d.txt:2 E:d.txt:3"},
+		{path: "d.txt", commit: e, copyLevel: 2, want: "E:d.txt:1 A:a.txt:5 A:a.txt:6"},
+		{path: "d.txt", commit: g, copyLevel: 2, want: "F:d.txt:1 A:a.txt:5 A:a.txt:6 G:d.txt:4 G:d.txt:5"},
+		{path: "d.txt", commit: g, copyLevel: 3, want: "F:d.txt:1 A:a.txt:5 A:a.txt:6 A:a.txt:1 A:a.txt:2"},
+	}
+	for _, tt := range tests {
+		opts := DefaultBlameOptions()
+		opts.DetectMoves = tt.moves
+		opts.CopyLevel = tt.copyLevel
+		lines, err := repo.Blame(tt.path, tt.commit, opts)
+		if err != nil {
+			t.Fatalf("Blame failed: %v", err)
+		}
+		var got []string
+		for _, line := range lines {
+			got = append(got, fmt.Sprintf("%s:%s:%d", strings.TrimSpace(line.Commit.Message), line.Path, line.OriginalLineNumber))
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("Blame %s with moves %v and copy level %d = %q, want %q", tt.path, tt.moves, tt.copyLevel, strings.Join(got, " "), tt.want)
+		}
+	}
+}
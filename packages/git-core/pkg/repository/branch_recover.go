@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// RecoverBranch recreates a deleted branch at the commit it last pointed
+// to and returns that commit. The commit comes from the branch's own
+// reflog or, for a branch deleted before its reflog was kept, from the
+// last HEAD reflog entry checking the branch out or leaving it.
+func (r *Repository) RecoverBranch(name string) (hash.Hash, error) {
+	if r.BranchExists(name) {
+		return nil, fmt.Errorf("branch %s already exists", name)
+	}
+
+	ref := "refs/heads/" + name
+	if err := checkRefName(ref); err != nil {
+		return nil, err
+	}
+
+	tip, err := r.lastBranchTip(name)
+	if err != nil {
+		return nil, err
+	}
+	if tip == nil {
+		return nil, fmt.Errorf("no reflog entry found for branch %s", name)
+	}
+	if !r.ObjectDB.Has(tip) {
+		return nil, fmt.Errorf("cannot recover branch %s: commit %s is no longer in the repository", name, shortHash(tip))
+	}
+
+	tx := r.BeginRefTx()
+	if err := tx.Create(ref, tip, "branch: recovered from reflog"); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to recover branch %s: %w", name, err)
+	}
+	return tip, nil
+}
+
+// lastBranchTip returns the last commit the reflogs record for a branch,
+// or nil when they record none
+func (r *Repository) lastBranchTip(name string) (hash.Hash, error) {
+	entries, err := r.Reflog("refs/heads/" + name)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		// A deletion moves the branch to the zero hash
+		if !entry.New.IsZero() {
+			return entry.New, nil
+		}
+		if !entry.Old.IsZero() {
+			return entry.Old, nil
+		}
+	}
+
+	entries, err = r.Reflog("HEAD")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		moves, ok := strings.CutPrefix(entry.Message, "checkout: moving from ")
+		if !ok {
+			continue
+		}
+		from, to, ok := strings.Cut(moves, " to ")
+		if !ok {
+			continue
+		}
+		if from == name && !entry.Old.IsZero() {
+			return entry.Old, nil
+		}
+		if to == name {
+			return entry.New, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"os"
+	"testing"
+)
+
+// TestRecoverBranch tests bringing back a deleted branch from its own
+// reflog and, without one, from the HEAD reflog
+func TestRecoverBranch(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "one", "two")
+
+	if err := repo.CreateBranch("feature", commits[0]); err != nil {
+		t.Fatalf("Failed to create branch: %v", err)
+	}
+	if err := repo.DeleteBranch("feature"); err != nil {
+		t.Fatalf("Failed to delete branch: %v", err)
+	}
+	if _, err := repo.RecoverBranch("main"); err == nil {
+		t.Error("expected an error recovering a branch that exists")
+	}
+
+	h, err := repo.RecoverBranch("feature")
+	if err != nil {
+		t.Fatalf("RecoverBranch failed: %v", err)
+	}
+	if !h.Equals(commits[0]) {
+		t.Errorf("recovered feature at %s, want %s", h, commits[0])
+	}
+	if tip, err := repo.GetBranch("feature"); err != nil || !tip.Equals(commits[0]) {
+		t.Errorf("feature = %v, %v after recovery", tip, err)
+	}
+	entries, err := repo.Reflog("refs/heads/feature")
+	if err != nil || len(entries) != 2 || entries[0].Message != "branch: recovered from reflog" || entries[1].Message != "branch: deleted" {
+		t.Errorf("feature reflog = %+v, %v", entries, err)
+	}
+
+	// A branch whose own reflog is gone is found through HEAD's checkouts
+	if err := repo.Checkout("feature", DefaultCheckoutOptions()); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	feature := commitFileContent(t, repo, "three")
+	if err := repo.Checkout("main", DefaultCheckoutOptions()); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if err := repo.DeleteBranch("feature"); err != nil {
+		t.Fatalf("Failed to delete branch: %v", err)
+	}
+	if err := os.Remove(repo.reflogPath("refs/heads/feature")); err != nil {
+		t.Fatal(err)
+	}
+	h, err = repo.RecoverBranch("feature")
+	if err != nil {
+		t.Fatalf("RecoverBranch from HEAD reflog failed: %v", err)
+	}
+	if !h.Equals(feature) {
+		t.Errorf("recovered feature at %s, want %s", h, feature)
+	}
+
+	if _, err := repo.RecoverBranch("never-existed"); err == nil {
+		t.Error("expected an error for a branch without reflog entries")
+	}
+}
@@ -0,0 +1,400 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+const (
+	// bundleSignatureV2 starts a version 2 bundle header
+	bundleSignatureV2 = "# v2 git bundle"
+	// bundleSignatureV3 starts a version 3 bundle header, which adds capabilities
+	bundleSignatureV3 = "# v3 git bundle"
+)
+
+// Bundle is a Git bundle: a list of refs and the packfile with their objects
+type Bundle struct {
+	// Prerequisites are commits the receiving repository must already have
+	Prerequisites []hash.Hash
+	// References are the refs recorded in the bundle
+	References []protocol.Reference
+	// Packfile holds the bundled objects
+	Packfile []byte
+}
+
+// ReadBundle reads and parses a bundle file
+func ReadBundle(path string) (*Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	return ParseBundle(data)
+}
+
+// ParseBundle parses a v2 or v3 bundle
+func ParseBundle(data []byte) (*Bundle, error) {
+	reader := bufio.NewReader(bytes.NewReader(data))
+
+	signature, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle: missing header")
+	}
+	signature = strings.TrimSuffix(signature, "\n")
+	if signature != bundleSignatureV2 && signature != bundleSignatureV3 {
+		return nil, fmt.Errorf("invalid bundle signature: %q", signature)
+	}
+
+	bundle := &Bundle{
+		Prerequisites: []hash.Hash{},
+		References:    []protocol.Reference{},
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundle: truncated header")
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			break
+		}
+
+		switch {
+		case strings.HasPrefix(line, "@"):
+			// v3 capabilities; only the default object format is supported
+			if capability, value, _ := strings.Cut(line[1:], "="); capability == "object-format" && value != "sha1" {
+				return nil, fmt.Errorf("unsupported bundle object format: %s", value)
+			}
+
+		case strings.HasPrefix(line, "-"):
+			hashStr, _, _ := strings.Cut(line[1:], " ")
+			h, err := hash.ParseHash(hashStr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid bundle prerequisite %q: %w", line, err)
+			}
+			bundle.Prerequisites = append(bundle.Prerequisites, h)
+
+		default:
+			hashStr, name, found := strings.Cut(line, " ")
+			if !found || name == "" {
+				return nil, fmt.Errorf("invalid bundle reference %q", line)
+			}
+			if _, err := hash.ParseHash(hashStr); err != nil {
+				return nil, fmt.Errorf("invalid bundle reference %q: %w", line, err)
+			}
+			bundle.References = append(bundle.References, protocol.Reference{Name: name, Hash: hashStr})
+		}
+	}
+
+	pack, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle packfile: %w", err)
+	}
+	bundle.Packfile = pack
+
+	return bundle, nil
+}
+
+// IsBundle reports whether a file starts with a bundle signature
+func IsBundle(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return line == bundleSignatureV2 || line == bundleSignatureV3
+}
+
+// BundleCreate writes a bundle containing the given refs and the complete
+// history reachable from them. Refs may be full names, branch or tag names,
+// or "HEAD".
+func (r *Repository) BundleCreate(refs []string, path string) error {
+	if len(refs) == 0 {
+		return fmt.Errorf("no refs to bundle")
+	}
+
+	var header bytes.Buffer
+	header.WriteString(bundleSignatureV2 + "\n")
+
+	tips := make([]hash.Hash, 0, len(refs))
+	for _, ref := range refs {
+		name, h, err := r.resolveBundleRef(ref)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&header, "%s %s\n", h.String(), name)
+		tips = append(tips, h)
+	}
+	header.WriteString("\n")
+
+	list, err := r.RevList(RevListOptions{Include: tips, Objects: true})
+	if err != nil {
+		return fmt.Errorf("failed to collect objects: %w", err)
+	}
+	objects, err := r.loadRevList(list)
+	if err != nil {
+		return fmt.Errorf("failed to collect objects: %w", err)
+	}
+
+	pack, err := r.createPackfileForPush(objects)
+	if err != nil {
+		return fmt.Errorf("failed to create packfile: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(header.Bytes(), pack...), 0644); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	return nil
+}
+
+// Unbundle stores the objects from a bundle and returns its refs.
+// Like git bundle unbundle, no refs are updated.
+func (r *Repository) Unbundle(path string) ([]protocol.Reference, error) {
+	bundle, err := ReadBundle(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.unbundle(bundle); err != nil {
+		return nil, err
+	}
+
+	return bundle.References, nil
+}
+
+// unbundle checks a bundle's prerequisites, stores its objects and
+// returns the number of objects unpacked
+func (r *Repository) unbundle(bundle *Bundle) (int, error) {
+	for _, h := range bundle.Prerequisites {
+		if !r.ObjectDB.Has(h) {
+			return 0, fmt.Errorf("repository lacks prerequisite commit %s", h.String())
+		}
+	}
+
+	count, err := r.unpackPackfile(bundle.Packfile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to unpack bundle: %w", err)
+	}
+
+	for _, ref := range bundle.References {
+		h, err := hash.ParseHash(ref.Hash)
+		if err != nil || !r.ObjectDB.Has(h) {
+			return 0, fmt.Errorf("bundle is missing object %s for %s", ref.Hash, ref.Name)
+		}
+	}
+
+	return count, nil
+}
+
+// resolveBundleRef resolves a ref given to BundleCreate to its full name
+func (r *Repository) resolveBundleRef(ref string) (string, hash.Hash, error) {
+	if ref == "HEAD" {
+		h, err := r.ResolveHEAD()
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to resolve HEAD: %w", err)
+		}
+		return ref, h, nil
+	}
+
+	candidates := []string{ref}
+	if !strings.HasPrefix(ref, "refs/") {
+		candidates = []string{"refs/heads/" + ref, "refs/tags/" + ref}
+	}
+
+	for _, name := range candidates {
+		if h, err := r.ResolveRef(name); err == nil {
+			return name, h, nil
+		}
+	}
+
+	return "", nil, fmt.Errorf("ref not found: %s", ref)
+}
+
+// cloneFromBundle clones the refs stored in a bundle file
+func cloneFromBundle(bundlePath string, path string, opts CloneOptions) (*CloneResult, error) {
+	if opts.Filter != "" {
+		return nil, fmt.Errorf("partial clone filters are not supported for bundles")
+	}
+	if opts.Mirror {
+		opts.Bare = true
+	}
+
+	bundle, err := ReadBundle(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(bundle.Prerequisites) > 0 {
+		return nil, fmt.Errorf("cannot clone from a bundle with prerequisites")
+	}
+
+	absPath, err := filepath.Abs(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve bundle path: %w", err)
+	}
+
+	// Pick the branch to check out: the requested one, or a guess from the
+	// bundled HEAD and branch names, since bundles record no symrefs
+	discovery := &protocol.DiscoveryResponse{
+		SymRefs:    map[string]string{},
+		References: bundle.References,
+	}
+	targetBranch := ""
+	branchSource := protocol.DefaultBranchRequested
+	if opts.Branch != "" {
+		targetBranch = "refs/heads/" + opts.Branch
+		if _, found := discovery.GetReference(targetBranch); !found {
+			return nil, fmt.Errorf("remote branch '%s' not found", opts.Branch)
+		}
+	} else if hasBranches(bundle.References) {
+		branch, source, err := discovery.ResolveDefaultBranch(opts.BranchFallback)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get default branch: %w", err)
+		}
+		targetBranch = branch
+		branchSource = source
+	}
+
+	if err := prepareCloneDir(path); err != nil {
+		return nil, err
+	}
+
+	progress := func(msg string) {
+		if opts.ProgressCallback != nil {
+			opts.ProgressCallback(msg)
+		}
+	}
+	progress("Cloning into '" + path + "'...")
+
+	initOpts := DefaultInitOptions()
+	initOpts.Bare = opts.Bare
+	if targetBranch != "" {
+		initOpts.InitialBranch = strings.TrimPrefix(targetBranch, "refs/heads/")
+	}
+	repo, err := Create(path, initOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize repository: %w", err)
+	}
+	repo.Limits = opts.Limits
+
+	if err := setupRemote(repo, opts.Remote, absPath); err != nil {
+		return nil, fmt.Errorf("failed to setup remote: %w", err)
+	}
+	if opts.Mirror {
+		repo.Config.SetMirrorRemote(opts.Remote)
+		if err := repo.Config.Save(filepath.Join(repo.GitDir, "config")); err != nil {
+			return nil, fmt.Errorf("failed to save config: %w", err)
+		}
+	}
+
+	progress("Unpacking objects...")
+	if _, err := repo.unbundle(bundle); err != nil {
+		return nil, err
+	}
+
+	progress("Creating refs...")
+	updates := []RefUpdate{}
+	if opts.Mirror {
+		for _, ref := range mirrorRefs(discovery) {
+			updates = append(updates, RefUpdate{RefName: ref.Name, NewHash: ref.Hash})
+		}
+	} else {
+		for _, ref := range bundle.References {
+			switch {
+			case strings.HasPrefix(ref.Name, "refs/heads/"):
+				branch := strings.TrimPrefix(ref.Name, "refs/heads/")
+				updates = append(updates, RefUpdate{RefName: fmt.Sprintf("refs/remotes/%s/%s", opts.Remote, branch), NewHash: ref.Hash})
+				if ref.Name == targetBranch {
+					updates = append(updates, RefUpdate{RefName: ref.Name, NewHash: ref.Hash})
+				}
+			case strings.HasPrefix(ref.Name, "refs/tags/"):
+				updates = append(updates, RefUpdate{RefName: ref.Name, NewHash: ref.Hash})
+			}
+		}
+	}
+	if err := repo.UpdateRefs(updates, true); err != nil {
+		return nil, fmt.Errorf("failed to create refs: %w", err)
+	}
+
+	if !opts.Bare && targetBranch != "" {
+		progress("Checking out files...")
+		if err := checkoutBranch(repo, strings.TrimPrefix(targetBranch, "refs/heads/")); err != nil {
+			return nil, fmt.Errorf("failed to checkout branch: %w", err)
+		}
+	}
+
+	progress("Done!")
+	result := &CloneResult{Repository: repo}
+	if targetBranch != "" {
+		result.Branch = strings.TrimPrefix(targetBranch, "refs/heads/")
+		result.BranchSource = branchSource
+	}
+	return result, nil
+}
+
+// hasBranches reports whether any of the refs is a branch
+func hasBranches(refs []protocol.Reference) bool {
+	for _, ref := range refs {
+		if strings.HasPrefix(ref.Name, "refs/heads/") {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchFromBundle fetches refs from a bundle file using the remote's refspecs
+func (r *Repository) fetchFromBundle(bundlePath string, refspecs []string, opts FetchOptions) (*FetchResult, error) {
+	bundle, err := ReadBundle(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := r.unbundle(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	discovery := &protocol.DiscoveryResponse{
+		SymRefs:    map[string]string{},
+		References: bundle.References,
+	}
+	updates, err := r.calculateRefUpdates(discovery, refspecs, opts.Remote, opts.Force)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate ref updates: %w", err)
+	}
+
+	changed := []RefUpdate{}
+	for _, update := range updates {
+		if update.OldHash != update.NewHash {
+			changed = append(changed, update)
+		}
+	}
+	updatedRefs, failedRefs, err := r.applyFetchedRefs(changed, opts.Atomic)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.writeFetchHead(discovery, opts, bundlePath); err != nil {
+		return nil, err
+	}
+
+	return &FetchResult{
+		UpdatedRefs: updatedRefs,
+		FailedRefs:  failedRefs,
+		PrunedRefs:  []string{},
+		ObjectCount: count,
+	}, nil
+}
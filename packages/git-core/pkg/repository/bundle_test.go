@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBundleCreateAndParse tests the bundle header written by BundleCreate
+func TestBundleCreateAndParse(t *testing.T) {
+	source := setupLocalCloneSource(t)
+	main, _ := source.GetBranch("main")
+
+	bundlePath := filepath.Join(t.TempDir(), "repo.bundle")
+	if err := source.BundleCreate([]string{"main", "feature", "v1", "HEAD"}, bundlePath); err != nil {
+		t.Fatalf("BundleCreate failed: %v", err)
+	}
+
+	if !IsBundle(bundlePath) {
+		t.Fatal("Expected file to be recognized as a bundle")
+	}
+
+	bundle, err := ReadBundle(bundlePath)
+	if err != nil {
+		t.Fatalf("ReadBundle failed: %v", err)
+	}
+
+	names := []string{}
+	for _, ref := range bundle.References {
+		names = append(names, ref.Name)
+	}
+	if got := strings.Join(names, ","); got != "refs/heads/main,refs/heads/feature,refs/tags/v1,HEAD" {
+		t.Errorf("Unexpected bundle refs %s", got)
+	}
+	if bundle.References[0].Hash != main.String() {
+		t.Errorf("main = %s, expected %s", bundle.References[0].Hash, main.String())
+	}
+	if len(bundle.Prerequisites) != 0 || len(bundle.Packfile) == 0 {
+		t.Errorf("Unexpected bundle contents: %d prerequisites, %d pack bytes", len(bundle.Prerequisites), len(bundle.Packfile))
+	}
+
+	if err := source.BundleCreate([]string{"missing"}, bundlePath); err == nil {
+		t.Error("Expected error for unknown ref")
+	}
+}
+
+// TestParseBundleHeader tests v3 headers, prerequisites and invalid input
+func TestParseBundleHeader(t *testing.T) {
+	const commit = "3b18e512dba79e4c8300dd08aeb37f8e728b8dad"
+
+	data := "# v3 git bundle\n@object-format=sha1\n-" + commit + " base\n" + commit + " refs/heads/main\n\nPACK"
+	bundle, err := ParseBundle([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseBundle failed: %v", err)
+	}
+	if len(bundle.Prerequisites) != 1 || bundle.Prerequisites[0].String() != commit {
+		t.Errorf("Unexpected prerequisites %v", bundle.Prerequisites)
+	}
+	if len(bundle.References) != 1 || bundle.References[0].Name != "refs/heads/main" {
+		t.Errorf("Unexpected references %v", bundle.References)
+	}
+	if string(bundle.Packfile) != "PACK" {
+		t.Errorf("Unexpected packfile %q", bundle.Packfile)
+	}
+
+	invalid := []string{
+		"not a bundle\n\n",
+		"# v2 git bundle\n" + commit + " refs/heads/main\n",
+		"# v2 git bundle\nzzz refs/heads/main\n\n",
+		"# v3 git bundle\n@object-format=sha256\n\n",
+	}
+	for _, data := range invalid {
+		if _, err := ParseBundle([]byte(data)); err == nil {
+			t.Errorf("Expected error parsing %q", data)
+		}
+	}
+}
+
+// TestCloneAndFetchFromBundle tests cloning a bundle and fetching a newer one
+func TestCloneAndFetchFromBundle(t *testing.T) {
+	source := setupLocalCloneSource(t)
+	feature, _ := source.GetBranch("feature")
+
+	bundlePath := filepath.Join(t.TempDir(), "repo.bundle")
+	if err := source.BundleCreate([]string{"main", "feature", "v1"}, bundlePath); err != nil {
+		t.Fatalf("BundleCreate failed: %v", err)
+	}
+
+	repo, err := Clone(bundlePath, filepath.Join(t.TempDir(), "clone"), DefaultCloneOptions())
+	if err != nil {
+		t.Fatalf("Clone from bundle failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(repo.Path, "dir", "file.txt"))
+	if err != nil || string(content) != "two\n" {
+		t.Errorf("Unexpected checked out content %q: %v", content, err)
+	}
+	if h, err := repo.GetRef("refs/remotes/origin/feature"); err != nil || h.String() != feature.String() {
+		t.Errorf("origin/feature = %v, expected %s (%v)", h, feature.String(), err)
+	}
+	if h, err := repo.GetRef("refs/tags/v1"); err != nil || h.String() != feature.String() {
+		t.Errorf("v1 = %v, expected %s (%v)", h, feature.String(), err)
+	}
+
+	// Add a commit to the source and fetch it through a new bundle
+	if err := os.WriteFile(filepath.Join(source.Path, "dir", "file.txt"), []byte("three\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := addFile(source, "dir/file.txt"); err != nil {
+		t.Fatalf("Failed to add file: %v", err)
+	}
+	newMain, err := createCommit(source, "three")
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if err := source.BundleCreate([]string{"main"}, bundlePath); err != nil {
+		t.Fatalf("BundleCreate failed: %v", err)
+	}
+
+	result, err := repo.Fetch(DefaultFetchOptions())
+	if err != nil {
+		t.Fatalf("Fetch from bundle failed: %v", err)
+	}
+	if _, ok := result.UpdatedRefs["refs/remotes/origin/main"]; !ok {
+		t.Errorf("Expected origin/main to be updated, got %v", result.UpdatedRefs)
+	}
+	if h, err := repo.GetRef("refs/remotes/origin/main"); err != nil || h.String() != newMain.String() {
+		t.Errorf("origin/main = %v, expected %s (%v)", h, newMain.String(), err)
+	}
+}
+
+// TestFetchFromBundleReportsFailedRefs tests that a non-atomic fetch
+// applies the refs it can and reports the others
+func TestFetchFromBundleReportsFailedRefs(t *testing.T) {
+	source := setupLocalCloneSource(t)
+	feature, _ := source.GetBranch("feature")
+	if err := source.CreateBranch("topic", feature); err != nil {
+		t.Fatalf("CreateBranch failed: %v", err)
+	}
+
+	bundlePath := filepath.Join(t.TempDir(), "repo.bundle")
+	if err := source.BundleCreate([]string{"main"}, bundlePath); err != nil {
+		t.Fatalf("BundleCreate failed: %v", err)
+	}
+	repo, err := Clone(bundlePath, filepath.Join(t.TempDir(), "clone"), DefaultCloneOptions())
+	if err != nil {
+		t.Fatalf("Clone from bundle failed: %v", err)
+	}
+
+	// A directory in the way of origin/topic makes its update fail
+	if err := os.MkdirAll(filepath.Join(repo.GitDir, "refs", "remotes", "origin", "topic", "blocked"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.BundleCreate([]string{"main", "feature", "topic"}, bundlePath); err != nil {
+		t.Fatalf("BundleCreate failed: %v", err)
+	}
+
+	opts := DefaultFetchOptions()
+	opts.Atomic = true
+	if _, err := repo.Fetch(opts); err == nil {
+		t.Fatal("Expected an atomic fetch to fail")
+	}
+	if _, err := repo.GetRef("refs/remotes/origin/feature"); err == nil {
+		t.Error("Expected the atomic fetch to leave origin/feature unset")
+	}
+
+	result, err := repo.Fetch(DefaultFetchOptions())
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if _, ok := result.FailedRefs["refs/remotes/origin/topic"]; !ok || len(result.FailedRefs) != 1 {
+		t.Errorf("FailedRefs = %v, expected origin/topic", result.FailedRefs)
+	}
+	if _, ok := result.UpdatedRefs["refs/remotes/origin/topic"]; ok {
+		t.Error("Expected origin/topic not to be reported as updated")
+	}
+	if h, err := repo.GetRef("refs/remotes/origin/feature"); err != nil || h.String() != feature.String() {
+		t.Errorf("origin/feature = %v, expected %s (%v)", h, feature.String(), err)
+	}
+}
+
+// TestUnbundlePrerequisites tests that missing prerequisite commits are reported
+func TestUnbundlePrerequisites(t *testing.T) {
+	source := setupLocalCloneSource(t)
+	main, _ := source.GetBranch("main")
+
+	bundlePath := filepath.Join(t.TempDir(), "thin.bundle")
+	data := "# v2 git bundle\n-" + main.String() + "\n" + main.String() + " refs/heads/main\n\n"
+	if err := os.WriteFile(bundlePath, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Clone(bundlePath, filepath.Join(t.TempDir(), "clone"), DefaultCloneOptions()); err == nil {
+		t.Error("Expected clone from a bundle with prerequisites to fail")
+	}
+
+	empty, err := Create(filepath.Join(t.TempDir(), "empty"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	if _, err := empty.Unbundle(bundlePath); err == nil || !strings.Contains(err.Error(), "prerequisite") {
+		t.Errorf("Expected prerequisite error, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+// seedFromBundleURI downloads the bundle, or bundle list, at uri and
+// unpacks it into the repository. It returns the bundled commits to send as
+// haves. Bundles only speed up a clone, so failures are reported through
+// progress and the clone falls back to a full fetch.
+func (r *Repository) seedFromBundleURI(client *protocol.Client, uri string, progress func(string)) []string {
+	progress(fmt.Sprintf("Downloading bundle from %s...", uri))
+	data, err := client.DownloadBundle(uri)
+	if err != nil {
+		progress(fmt.Sprintf("warning: failed to download bundle: %v", err))
+		return nil
+	}
+
+	if bundle, err := ParseBundle(data); err == nil {
+		return r.applyBundles([]*Bundle{bundle}, progress)
+	}
+
+	list, err := protocol.ParseBundleList(data, uri)
+	if err != nil {
+		progress(fmt.Sprintf("warning: %s is neither a bundle nor a bundle list: %v", uri, err))
+		return nil
+	}
+	return r.seedFromBundleList(client, list, progress)
+}
+
+// seedFromBundleList downloads and unpacks the bundles in a bundle list
+func (r *Repository) seedFromBundleList(client *protocol.Client, list *protocol.BundleList, progress func(string)) []string {
+	bundles := []*Bundle{}
+	for _, info := range list.Bundles {
+		progress(fmt.Sprintf("Downloading bundle %s...", info.ID))
+		data, err := client.DownloadBundle(info.URI)
+		if err != nil {
+			progress(fmt.Sprintf("warning: failed to download bundle %s: %v", info.ID, err))
+			continue
+		}
+		bundle, err := ParseBundle(data)
+		if err != nil {
+			progress(fmt.Sprintf("warning: failed to parse bundle %s: %v", info.ID, err))
+			continue
+		}
+		bundles = append(bundles, bundle)
+
+		// In "any" mode each bundle is complete on its own
+		if list.Mode == "any" {
+			break
+		}
+	}
+
+	return r.applyBundles(bundles, progress)
+}
+
+// applyBundles unbundles each bundle whose prerequisites are met, records
+// its branches under refs/bundles/ and returns the bundled commits
+func (r *Repository) applyBundles(bundles []*Bundle, progress func(string)) []string {
+	haves := []string{}
+	for _, bundle := range bundles {
+		count, err := r.unbundle(bundle)
+		if err != nil {
+			progress(fmt.Sprintf("warning: skipping bundle: %v", err))
+			continue
+		}
+		progress(fmt.Sprintf("Unpacked %d objects from bundle", count))
+
+		for _, ref := range bundle.References {
+			h, err := hash.ParseHash(ref.Hash)
+			if err != nil {
+				continue
+			}
+			if obj, err := r.ObjectDB.Get(h); err != nil || obj.Type() != object.CommitType {
+				continue
+			}
+
+			if !stringSliceContains(haves, ref.Hash) {
+				haves = append(haves, ref.Hash)
+			}
+			if strings.HasPrefix(ref.Name, "refs/heads/") {
+				bundleRef := "refs/bundles/" + strings.TrimPrefix(ref.Name, "refs/heads/")
+				if err := r.UpdateRef(bundleRef, h); err != nil {
+					progress(fmt.Sprintf("warning: failed to record %s: %v", bundleRef, err))
+				}
+			}
+		}
+	}
+
+	return haves
+}
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+// bundleURIServer serves a repository over smart HTTP plus static files
+// under /bundles/, recording the upload-pack request bodies
+type bundleURIServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []string
+}
+
+// newBundleURIServer starts a bundleURIServer for the source repository
+func newBundleURIServer(t *testing.T, source *Repository, files map[string][]byte) *bundleURIServer {
+	t.Helper()
+
+	main, _ := source.GetBranch("main")
+	feature, _ := source.GetBranch("feature")
+	refs := []protocol.Reference{
+		{Name: "refs/heads/main", Hash: main.String()},
+		{Name: "refs/heads/feature", Hash: feature.String()},
+	}
+	upload := newUploadPackHandler(t, source, refs)
+
+	server := &bundleURIServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if name, ok := strings.CutPrefix(req.URL.Path, "/bundles/"); ok {
+			data, found := files[name]
+			if !found {
+				http.NotFound(w, req)
+				return
+			}
+			w.Write(data)
+			return
+		}
+
+		if req.Method == http.MethodPost {
+			body, _ := io.ReadAll(req.Body)
+			server.mu.Lock()
+			server.requests = append(server.requests, string(body))
+			server.mu.Unlock()
+		}
+		upload.ServeHTTP(w, req)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// createTestBundle writes a bundle of the given refs and returns its bytes
+func createTestBundle(t *testing.T, repo *Repository, refs ...string) []byte {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.bundle")
+	if err := repo.BundleCreate(refs, path); err != nil {
+		t.Fatalf("BundleCreate failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// TestCloneWithBundleURI tests seeding a clone from a bundle before fetching
+func TestCloneWithBundleURI(t *testing.T) {
+	source := setupLocalCloneSource(t)
+	feature, _ := source.GetBranch("feature")
+	main, _ := source.GetBranch("main")
+
+	server := newBundleURIServer(t, source, map[string][]byte{
+		"base.bundle": createTestBundle(t, source, "feature"),
+	})
+
+	messages := []string{}
+	opts := DefaultCloneOptions()
+	opts.BundleURI = server.URL + "/bundles/base.bundle"
+	opts.ProgressCallback = func(msg string) { messages = append(messages, msg) }
+
+	repo, err := Clone(server.URL+"/repo.git", filepath.Join(t.TempDir(), "clone"), opts)
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+
+	if h, err := repo.GetRef("refs/bundles/feature"); err != nil || !h.Equals(feature) {
+		t.Errorf("refs/bundles/feature = %v, expected %s (%v)", h, feature.String(), err)
+	}
+	if h, err := repo.GetRef("refs/heads/main"); err != nil || !h.Equals(main) {
+		t.Errorf("main = %v, expected %s (%v)", h, main.String(), err)
+	}
+	content, err := os.ReadFile(filepath.Join(repo.Path, "dir", "file.txt"))
+	if err != nil || string(content) != "two\n" {
+		t.Errorf("Unexpected checked out content %q: %v", content, err)
+	}
+
+	if len(server.requests) != 1 || !strings.Contains(server.requests[0], "have "+feature.String()) {
+		t.Errorf("Expected the bundled commit to be sent as a have, got %q", server.requests)
+	}
+	if !strings.Contains(strings.Join(messages, "\n"), "from bundle") {
+		t.Errorf("Expected bundle progress, got %v", messages)
+	}
+}
+
+// TestCloneWithBundleList tests a bundle list with relative URIs
+func TestCloneWithBundleList(t *testing.T) {
+	source := setupLocalCloneSource(t)
+	main, _ := source.GetBranch("main")
+
+	list := "[bundle]\n\tversion = 1\n\tmode = all\n" +
+		"[bundle \"newer\"]\n\turi = full.bundle\n\tcreationToken = 2\n" +
+		"[bundle \"older\"]\n\turi = base.bundle\n\tcreationToken = 1\n"
+	server := newBundleURIServer(t, source, map[string][]byte{
+		"list":        []byte(list),
+		"base.bundle": createTestBundle(t, source, "feature"),
+		"full.bundle": createTestBundle(t, source, "main"),
+	})
+
+	opts := DefaultCloneOptions()
+	opts.BundleURI = server.URL + "/bundles/list"
+	repo, err := Clone(server.URL+"/repo.git", filepath.Join(t.TempDir(), "clone"), opts)
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+
+	if h, err := repo.GetRef("refs/bundles/main"); err != nil || !h.Equals(main) {
+		t.Errorf("refs/bundles/main = %v, expected %s (%v)", h, main.String(), err)
+	}
+}
+
+// TestCloneWithMissingBundle tests that an unavailable bundle falls back to a full fetch
+func TestCloneWithMissingBundle(t *testing.T) {
+	source := setupLocalCloneSource(t)
+	server := newBundleURIServer(t, source, map[string][]byte{})
+
+	messages := []string{}
+	opts := DefaultCloneOptions()
+	opts.BundleURI = server.URL + "/bundles/missing.bundle"
+	opts.ProgressCallback = func(msg string) { messages = append(messages, msg) }
+
+	repo, err := Clone(server.URL+"/repo.git", filepath.Join(t.TempDir(), "clone"), opts)
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+	if _, err := repo.GetRef("refs/heads/main"); err != nil {
+		t.Errorf("Clone is missing main: %v", err)
+	}
+	if !strings.Contains(strings.Join(messages, "\n"), "warning: failed to download bundle") {
+		t.Errorf("Expected a download warning, got %v", messages)
+	}
+	if strings.Contains(server.requests[0], "have ") {
+		t.Errorf("No haves should be sent without a bundle, got %q", server.requests[0])
+	}
+}
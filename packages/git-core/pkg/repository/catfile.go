@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// ObjectInfo is an object's type and size, like git cat-file -t and -s
+type ObjectInfo struct {
+	Hash hash.Hash
+	Type object.Type
+	// Size is the size of the object's content, without its header
+	Size int64
+	// Missing is set by the batch lookups for objects that do not exist
+	Missing bool
+}
+
+// RawObject is an object's type and serialized content, like
+// git cat-file <type>
+type RawObject struct {
+	ObjectInfo
+	Content []byte
+}
+
+// ObjectInfo returns an object's type and size without decoding its content
+func (r *Repository) ObjectInfo(h hash.Hash) (*ObjectInfo, error) {
+	if !r.ObjectDB.Has(h) {
+		return nil, fmt.Errorf("object not found: %s", h.String())
+	}
+
+	header, err := object.GetHeader(r.ObjectDB, h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %w", h.String(), err)
+	}
+	return &ObjectInfo{Hash: h, Type: header.Type, Size: header.Size}, nil
+}
+
+// ReadObject returns an object's type and serialized content
+func (r *Repository) ReadObject(h hash.Hash) (*RawObject, error) {
+	if !r.ObjectDB.Has(h) {
+		return nil, fmt.Errorf("object not found: %s", h.String())
+	}
+
+	obj, err := r.ObjectDB.Get(h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %w", h.String(), err)
+	}
+
+	var buf bytes.Buffer
+	if err := obj.Serialize(&buf); err != nil {
+		return nil, fmt.Errorf("failed to serialize object %s: %w", h.String(), err)
+	}
+
+	return &RawObject{
+		ObjectInfo: ObjectInfo{Hash: h, Type: obj.Type(), Size: int64(buf.Len())},
+		Content:    buf.Bytes(),
+	}, nil
+}
+
+// BatchObjectInfo returns the type and size of each object, like
+// git cat-file --batch-check. Objects that do not exist are reported with
+// Missing set rather than failing the batch.
+func (r *Repository) BatchObjectInfo(hashes []hash.Hash) ([]ObjectInfo, error) {
+	infos := make([]ObjectInfo, 0, len(hashes))
+	for _, h := range hashes {
+		if !r.ObjectDB.Has(h) {
+			infos = append(infos, ObjectInfo{Hash: h, Missing: true})
+			continue
+		}
+		info, err := r.ObjectInfo(h)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, *info)
+	}
+	return infos, nil
+}
+
+// BatchReadObject returns the type and content of each object, like
+// git cat-file --batch. Objects that do not exist are reported with
+// Missing set rather than failing the batch.
+func (r *Repository) BatchReadObject(hashes []hash.Hash) ([]RawObject, error) {
+	objects := make([]RawObject, 0, len(hashes))
+	for _, h := range hashes {
+		if !r.ObjectDB.Has(h) {
+			objects = append(objects, RawObject{ObjectInfo: ObjectInfo{Hash: h, Missing: true}})
+			continue
+		}
+		obj, err := r.ReadObject(h)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, *obj)
+	}
+	return objects, nil
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+func TestObjectInfoAndReadObject(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "hello\n")
+
+	info, err := repo.ObjectInfo(commits[0])
+	if err != nil {
+		t.Fatalf("ObjectInfo failed: %v", err)
+	}
+	if info.Type != object.CommitType {
+		t.Errorf("expected commit type, got %s", info.Type)
+	}
+
+	raw, err := repo.ReadObject(commits[0])
+	if err != nil {
+		t.Fatalf("ReadObject failed: %v", err)
+	}
+	if raw.Size != info.Size || int64(len(raw.Content)) != info.Size {
+		t.Errorf("size mismatch: info %d, read %d, content %d", info.Size, raw.Size, len(raw.Content))
+	}
+	if !bytes.HasPrefix(raw.Content, []byte("tree ")) {
+		t.Errorf("expected commit content to start with tree line, got %q", raw.Content)
+	}
+
+	// The serialized content must hash back to the object's own hash
+	full := append([]byte(fmt.Sprintf("%s %d\x00", raw.Type, len(raw.Content))), raw.Content...)
+	if got := repo.Hasher.Hash(full); !got.Equals(commits[0]) {
+		t.Errorf("content hashes to %s, expected %s", got, commits[0])
+	}
+
+	tree, _, err := repo.peelToTree(commits[0])
+	if err != nil {
+		t.Fatalf("peelToTree failed: %v", err)
+	}
+	blobHash := tree.Entries()[0].Hash
+
+	raw, err = repo.ReadObject(blobHash)
+	if err != nil {
+		t.Fatalf("ReadObject failed: %v", err)
+	}
+	if raw.Type != object.BlobType || string(raw.Content) != "hello\n" || raw.Size != 6 {
+		t.Errorf("unexpected blob: %s %d %q", raw.Type, raw.Size, raw.Content)
+	}
+}
+
+func TestObjectInfoMissing(t *testing.T) {
+	repo, _ := setupUndoRepo(t, "hello\n")
+	missing := repo.Hasher.Hash([]byte("no such object"))
+
+	if _, err := repo.ObjectInfo(missing); err == nil {
+		t.Error("expected error for missing object")
+	}
+	if _, err := repo.ReadObject(missing); err == nil {
+		t.Error("expected error for missing object")
+	}
+}
+
+func TestBatchObjectLookups(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "one\n", "two\n")
+	missing := repo.Hasher.Hash([]byte("no such object"))
+	hashes := []hash.Hash{commits[1], missing, commits[0]}
+
+	infos, err := repo.BatchObjectInfo(hashes)
+	if err != nil {
+		t.Fatalf("BatchObjectInfo failed: %v", err)
+	}
+	if len(infos) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(infos))
+	}
+	for i, info := range infos {
+		if !info.Hash.Equals(hashes[i]) {
+			t.Errorf("entry %d: expected hash %s, got %s", i, hashes[i], info.Hash)
+		}
+	}
+	if infos[0].Missing || infos[0].Type != object.CommitType {
+		t.Errorf("expected first entry to be a commit, got %+v", infos[0])
+	}
+	if !infos[1].Missing {
+		t.Error("expected second entry to be missing")
+	}
+
+	objects, err := repo.BatchReadObject(hashes)
+	if err != nil {
+		t.Fatalf("BatchReadObject failed: %v", err)
+	}
+	if len(objects) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(objects))
+	}
+	if !objects[1].Missing || objects[1].Content != nil {
+		t.Errorf("expected second entry to be missing, got %+v", objects[1])
+	}
+	if !strings.Contains(string(objects[2].Content), "tree ") {
+		t.Errorf("expected commit content, got %q", objects[2].Content)
+	}
+	if objects[0].Size != infos[0].Size {
+		t.Errorf("size mismatch: %d vs %d", objects[0].Size, infos[0].Size)
+	}
+}
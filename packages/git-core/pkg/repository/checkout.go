@@ -4,10 +4,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
-	"github.com/nseba/browser-git/git-core/pkg/index"
-	"github.com/nseba/browser-git/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
 )
 
 // CheckoutOptions contains options for checkout operations
@@ -18,7 +19,8 @@ type CheckoutOptions struct {
 	// CreateBranch creates a new branch before checking out
 	CreateBranch bool
 
-	// Detach creates a detached HEAD state
+	// Detach creates a detached HEAD state, even when the target is a
+	// branch. Targets that are not branches always detach HEAD.
 	Detach bool
 }
 
@@ -36,6 +38,7 @@ func DefaultCheckoutOptions() CheckoutOptions {
 // - branch name (e.g., "main", "feature")
 // - commit hash (e.g., "abc123...")
 // - symbolic ref (e.g., "refs/heads/main")
+// - any other revision (e.g., "v1.0", "HEAD~2"), which detaches HEAD
 func (r *Repository) Checkout(target string, opts CheckoutOptions) error {
 	// Load current index
 	indexPath := filepath.Join(r.GitDir, "index")
@@ -52,7 +55,7 @@ func (r *Repository) Checkout(target string, opts CheckoutOptions) error {
 	}
 
 	// Resolve target to a commit hash
-	targetHash, isBranch, err := r.resolveCheckoutTarget(target)
+	targetHash, branch, err := r.resolveCheckoutTarget(target)
 	if err != nil {
 		return err
 	}
@@ -62,7 +65,7 @@ func (r *Repository) Checkout(target string, opts CheckoutOptions) error {
 		if err := r.CreateBranch(target, targetHash); err != nil {
 			return fmt.Errorf("failed to create branch: %w", err)
 		}
-		isBranch = true
+		branch = target
 	}
 
 	// Get the commit object
@@ -81,25 +84,35 @@ func (r *Repository) Checkout(target string, opts CheckoutOptions) error {
 		return fmt.Errorf("failed to update working directory: %w", err)
 	}
 
+	// Remember where HEAD was for the reflog
+	from, _ := r.HEAD()
+	from = strings.TrimPrefix(from, "ref: refs/heads/")
+	fromHash, _ := r.ResolveHEAD()
+
 	// Update HEAD
-	if opts.Detach || !isBranch {
+	if opts.Detach || branch == "" {
 		// Detached HEAD state - point directly to commit
 		if err := r.SetHEAD(targetHash.String()); err != nil {
 			return fmt.Errorf("failed to update HEAD: %w", err)
 		}
 	} else {
 		// Normal checkout - point HEAD to branch
-		branchRef := fmt.Sprintf("ref: refs/heads/%s", target)
+		branchRef := fmt.Sprintf("ref: refs/heads/%s", branch)
 		if err := r.SetHEAD(branchRef); err != nil {
 			return fmt.Errorf("failed to update HEAD: %w", err)
 		}
 	}
 
+	if err := r.appendReflog("HEAD", fromHash, targetHash, fmt.Sprintf("checkout: moving from %s to %s", from, target)); err != nil {
+		return err
+	}
+
 	// Save updated index
 	if err := idx.Save(indexPath); err != nil {
 		return fmt.Errorf("failed to save index: %w", err)
 	}
 
+	r.runPostHook(HookPostCheckout, r.hookHash(fromHash), targetHash.String(), "1")
 	return nil
 }
 
@@ -144,9 +157,33 @@ func (r *Repository) CheckoutFile(path string) error {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
 
+	// A file checkout leaves HEAD where it is
+	head, _ := r.ResolveHEAD()
+	r.runPostHook(HookPostCheckout, r.hookHash(head), r.hookHash(head), "0")
 	return nil
 }
 
+// CheckoutPaths writes paths from a revision into the index and the
+// worktree without moving HEAD, like git checkout <rev> -- <paths>. An
+// empty rev checks the paths out of the index instead. Tracked files the
+// revision lacks are left alone.
+func (r *Repository) CheckoutPaths(rev string, paths []string) (*RestoreResult, error) {
+	opts := RestoreOptions{
+		Source:   rev,
+		Staged:   rev != "",
+		Worktree: true,
+		Overlay:  true,
+	}
+	result, err := r.Restore(paths, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	head, _ := r.ResolveHEAD()
+	r.runPostHook(HookPostCheckout, r.hookHash(head), r.hookHash(head), "0")
+	return result, nil
+}
+
 // checkUncommittedChanges checks for uncommitted changes that would be overwritten
 func (r *Repository) checkUncommittedChanges(idx *index.Index) error {
 	// Get HEAD commit
@@ -191,9 +228,16 @@ func (r *Repository) checkUncommittedChanges(idx *index.Index) error {
 		return nil
 	}
 
+	// Files outside the sparse-checkout cone are expected to be absent
+	sparse, err := r.SparseCheckout()
+	if err != nil {
+		return err
+	}
+
 	// Get status
 	workTreePath := r.WorkTree()
 	statusOpts := index.DefaultStatusOptions()
+	statusOpts.Sparse = sparse
 	status, err := index.GetStatus(workTreePath, idx, headCommit, r.ObjectDB, statusOpts)
 	if err != nil {
 		return fmt.Errorf("failed to get status: %w", err)
@@ -207,37 +251,27 @@ func (r *Repository) checkUncommittedChanges(idx *index.Index) error {
 	return nil
 }
 
-// resolveCheckoutTarget resolves a checkout target to a commit hash
-// Returns (hash, isBranch, error)
-func (r *Repository) resolveCheckoutTarget(target string) (hash.Hash, bool, error) {
-	// Try as branch name first
-	if r.BranchExists(target) {
-		h, err := r.GetBranch(target)
-		return h, true, err
-	}
-
-	// Try as full ref (refs/heads/*, refs/tags/*)
-	if len(target) >= 5 && target[:5] == "refs/" {
-		h, err := r.ResolveRef(target)
-		if err == nil {
-			// Check if it's a branch ref
-			isBranch := len(target) >= 11 && target[:11] == "refs/heads/"
-			return h, isBranch, nil
-		}
+// resolveCheckoutTarget resolves a checkout target to a commit hash and,
+// when the target is a branch, the branch name
+func (r *Repository) resolveCheckoutTarget(target string) (hash.Hash, string, error) {
+	// Try as branch name first, or as its full ref
+	branch := strings.TrimPrefix(target, "refs/heads/")
+	if r.BranchExists(branch) {
+		h, err := r.GetBranch(branch)
+		return h, branch, err
 	}
 
-	// Try as commit hash
-	h, err := hash.ParseHash(target)
+	// Anything else naming a commit is checked out detached: a hash,
+	// possibly abbreviated, a tag or a revision such as HEAD~2
+	h, err := r.ResolveRevision(target)
 	if err != nil {
-		return nil, false, fmt.Errorf("invalid target: not a branch, ref, or valid hash")
+		return nil, "", fmt.Errorf("invalid target %s: not a branch or commit: %w", target, err)
 	}
-
-	// Verify the commit exists
-	if !r.ObjectDB.Has(h) {
-		return nil, false, fmt.Errorf("commit %s not found", h.String())
+	commitHash, _, err := r.peelToCommit(h)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid target %s: %w", target, err)
 	}
-
-	return h, false, nil
+	return commitHash, "", nil
 }
 
 // updateWorkingDirectory updates the working directory and index from a tree
@@ -265,6 +299,12 @@ func (r *Repository) updateWorkingDirectory(treeHash hash.Hash, idx *index.Index
 		return err
 	}
 
+	// Only files inside the sparse-checkout cone are written
+	sparse, err := r.SparseCheckout()
+	if err != nil {
+		return err
+	}
+
 	// Remove files that are in index but not in target tree
 	for _, entry := range idx.Entries {
 		if _, exists := targetFiles[entry.Path]; !exists {
@@ -279,6 +319,16 @@ func (r *Repository) updateWorkingDirectory(treeHash hash.Hash, idx *index.Index
 
 	// Write all files from target tree
 	for path, file := range targetFiles {
+		if sparse != nil && !sparse.Includes(path) {
+			// Track the file without materializing it
+			idx.AddEntry(&index.Entry{
+				Mode: uint32(file.mode),
+				Hash: file.hash,
+				Path: path,
+			})
+			continue
+		}
+
 		// Get blob
 		blobObj, err := r.ObjectDB.Get(file.hash)
 		if err != nil {
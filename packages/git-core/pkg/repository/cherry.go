@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// CherryEntry is one local commit compared against an upstream
+type CherryEntry struct {
+	Commit  hash.Hash
+	Subject string
+	// Applied is true when an upstream commit makes the same change, which
+	// git cherry marks with "-"
+	Applied bool
+	// PatchID identifies the commit's change
+	PatchID hash.Hash
+}
+
+// Cherry finds the commits on head that are not on upstream and reports
+// which of them upstream already has in another form, like git cherry.
+// Commits are matched by patch ID, so a cherry-picked or rebased commit
+// counts as applied. An empty upstream means the current branch's
+// upstream and an empty head means HEAD. Entries are oldest first and
+// merges are left out.
+func (r *Repository) Cherry(upstream, head string) ([]CherryEntry, error) {
+	if head == "" {
+		head = "HEAD"
+	}
+	if upstream == "" {
+		branch, err := r.CurrentBranch()
+		if err != nil {
+			return nil, err
+		}
+		tracked, err := r.GetUpstream(branch)
+		if err != nil {
+			return nil, err
+		}
+		if tracked == nil {
+			return nil, fmt.Errorf("no upstream configured for branch '%s'", branch)
+		}
+		upstream = tracked.TrackingRef()
+	}
+
+	local, err := r.CommitsInRange(upstream + ".." + head)
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := r.CommitsInRange(head + ".." + upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	upstreamIDs := make(map[string]bool)
+	for _, entry := range theirs {
+		if len(entry.Commit.Parents) > 1 {
+			continue
+		}
+		id, err := r.PatchID(entry.Hash.String())
+		if err != nil {
+			return nil, err
+		}
+		upstreamIDs[id.String()] = true
+	}
+
+	entries := []CherryEntry{}
+	for i := len(local) - 1; i >= 0; i-- {
+		entry := local[i]
+		if len(entry.Commit.Parents) > 1 {
+			continue
+		}
+		id, err := r.PatchID(entry.Hash.String())
+		if err != nil {
+			return nil, err
+		}
+		subject, _, _ := strings.Cut(strings.TrimSpace(entry.Commit.Message), "\n")
+		entries = append(entries, CherryEntry{
+			Commit:  entry.Hash,
+			Subject: subject,
+			Applied: upstreamIDs[id.String()],
+			PatchID: id,
+		})
+	}
+
+	return entries, nil
+}
+
+// PatchID returns the patch ID of a commit's diff against its first
+// parent, like git patch-id. Whitespace, line numbers and blob hashes are
+// ignored, so the same change gives the same ID wherever it is applied.
+func (r *Repository) PatchID(rev string) (hash.Hash, error) {
+	show, err := r.Show(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	h := r.Hasher.New()
+	write := func(s string) {
+		h.Write([]byte(removeWhitespace(s)))
+	}
+	for _, file := range show.Files {
+		write("diff --git a/" + file.Path + " b/" + file.Path)
+		switch file.Change {
+		case ChangeAdded:
+			write(fmt.Sprintf("new file mode %06o", uint32(file.NewMode)))
+		case ChangeDeleted:
+			write(fmt.Sprintf("deleted file mode %06o", uint32(file.OldMode)))
+		default:
+			if file.OldMode != file.NewMode {
+				write(fmt.Sprintf("old mode %06o", uint32(file.OldMode)))
+				write(fmt.Sprintf("new mode %06o", uint32(file.NewMode)))
+			}
+		}
+
+		// Binary files and submodules are identified by their contents
+		if file.Binary || file.OldMode == object.ModeGitlink || file.NewMode == object.ModeGitlink {
+			zero := hash.ZeroHash(r.Hasher.Algorithm())
+			for _, side := range []hash.Hash{file.OldHash, file.NewHash} {
+				if side == nil {
+					side = zero
+				}
+				write(side.String())
+			}
+			continue
+		}
+
+		oldName, newName := "a/"+file.Path, "b/"+file.Path
+		if file.Change == ChangeAdded {
+			oldName = "/dev/null"
+		}
+		if file.Change == ChangeDeleted {
+			newName = "/dev/null"
+		}
+		write("--- " + oldName)
+		write("+++ " + newName)
+		for _, hunk := range file.Hunks {
+			for _, line := range hunk.Lines {
+				write(line)
+			}
+		}
+	}
+
+	return hash.Hash(h.Sum(nil)), nil
+}
+
+// removeWhitespace returns s without any whitespace
+func removeWhitespace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
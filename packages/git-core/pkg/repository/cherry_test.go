@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCherry tests that a commit picked onto the upstream branch is
+// reported as applied
+func TestCherry(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "base\n")
+	if err := repo.CreateBranch("upstream", commits[0]); err != nil {
+		t.Fatal(err)
+	}
+	commitFile := func(name, content, message string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repo.Path, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := addFile(repo, name); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := createCommit(repo, message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	commitFile("a.txt", "a\n", "Add a")
+	commitFile("b.txt", "b\n", "Add b")
+	localHead, err := repo.ResolveHEAD()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Checkout("upstream", DefaultCheckoutOptions()); err != nil {
+		t.Fatal(err)
+	}
+	commitFile("file.txt", "upstream\n", "Upstream change")
+	// The same change as "Add b", apart from whitespace
+	commitFile("b.txt", "b \n", "Pick b")
+
+	entries, err := repo.Cherry("upstream", "main")
+	if err != nil {
+		t.Fatalf("Cherry failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %+v", entries)
+	}
+	if entries[0].Subject != "Add a" || entries[0].Applied {
+		t.Errorf("Expected \"Add a\" not to be applied, got %+v", entries[0])
+	}
+	if entries[1].Subject != "Add b" || !entries[1].Applied || !entries[1].Commit.Equals(localHead) {
+		t.Errorf("Expected \"Add b\" to be applied, got %+v", entries[1])
+	}
+
+	picked, err := repo.PatchID("upstream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !picked.Equals(entries[1].PatchID) {
+		t.Errorf("Expected equal patch IDs, got %s and %s", picked, entries[1].PatchID)
+	}
+
+	// Seen from the other side, only the pick is applied
+	if entries, err := repo.Cherry("main", "upstream"); err != nil || len(entries) != 2 || entries[0].Applied || !entries[1].Applied {
+		t.Errorf("Unexpected reverse cherry %+v (%v)", entries, err)
+	}
+
+	if _, err := repo.Cherry("", ""); err == nil {
+		t.Error("Expected an error without a configured upstream")
+	}
+}
+
+// TestPatchIDMatchesGit tests PatchID against the output of git patch-id
+// for the same change
+func TestPatchIDMatchesGit(t *testing.T) {
+	repo, _ := setupUndoRepo(t, "a\nb\nc\n")
+	if err := os.WriteFile(filepath.Join(repo.Path, "file.txt"), []byte("a\nB  x\nc\nd"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo.Path, "new.sh"), []byte("n\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"file.txt", "new.sh"} {
+		if err := addFile(repo, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := createCommit(repo, "Change"); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := repo.PatchID("HEAD")
+	if err != nil {
+		t.Fatalf("PatchID failed: %v", err)
+	}
+	if want := "2d01bd80181cc969a82020e1fdb71f1fd46a13a8"; id.String() != want {
+		t.Errorf("Expected patch ID %s, got %s", want, id)
+	}
+}
@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+)
+
+// CleanOptions contains options for Clean
+type CleanOptions struct {
+	// DryRun only lists what would be removed. It is on by default and
+	// must be turned off explicitly to delete anything.
+	DryRun bool
+	// Directories also removes untracked directories (git clean -d).
+	// Without it untracked directories are left alone entirely.
+	Directories bool
+	// Ignored also removes files matched by .gitignore (git clean -x)
+	Ignored bool
+	// OnlyIgnored removes only files matched by .gitignore (git clean -X)
+	OnlyIgnored bool
+}
+
+// DefaultCleanOptions returns default clean options, which only list
+// untracked files
+func DefaultCleanOptions() CleanOptions {
+	return CleanOptions{
+		DryRun:      true,
+		Directories: false,
+		Ignored:     false,
+		OnlyIgnored: false,
+	}
+}
+
+// CleanResult describes what Clean removed
+type CleanResult struct {
+	// Removed lists the removed paths, or the paths that would be removed
+	// in a dry run. Directories removed as a whole end with "/".
+	Removed []string
+	// DryRun reports whether nothing was actually removed
+	DryRun bool
+}
+
+// cleaner walks the worktree collecting what Clean removes
+type cleaner struct {
+	root      string
+	tracked   map[string]bool
+	trackedIn map[string]bool
+	gitignore *index.Gitignore
+	opts      CleanOptions
+}
+
+// Clean removes untracked files from the worktree, like git clean. Tracked
+// files are never touched, and directories holding another repository are
+// skipped.
+func (r *Repository) Clean(opts CleanOptions) (*CleanResult, error) {
+	if r.IsBare() {
+		return nil, fmt.Errorf("cannot clean a bare repository")
+	}
+	if opts.Ignored && opts.OnlyIgnored {
+		return nil, fmt.Errorf("options Ignored and OnlyIgnored are mutually exclusive")
+	}
+
+	idx, err := index.Load(filepath.Join(r.GitDir, "index"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+
+	gitignore, err := index.LoadGitignore(r.WorkTree())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load gitignore: %w", err)
+	}
+
+	c := &cleaner{
+		root:      r.WorkTree(),
+		tracked:   make(map[string]bool),
+		trackedIn: make(map[string]bool),
+		gitignore: gitignore,
+		opts:      opts,
+	}
+	for _, entry := range idx.Entries {
+		c.tracked[entry.Path] = true
+		for dir := path.Dir(entry.Path); dir != "."; dir = path.Dir(dir) {
+			c.trackedIn[dir] = true
+		}
+	}
+
+	removed, _, err := c.walk("", false)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(removed)
+
+	if !opts.DryRun {
+		for _, rel := range removed {
+			target := filepath.Join(c.root, filepath.FromSlash(strings.TrimSuffix(rel, "/")))
+			if err := os.RemoveAll(target); err != nil {
+				return nil, fmt.Errorf("failed to remove %s: %w", rel, err)
+			}
+		}
+	}
+
+	return &CleanResult{Removed: removed, DryRun: opts.DryRun}, nil
+}
+
+// walk returns the removable paths within dir and whether dir itself can
+// be removed as a whole
+func (c *cleaner) walk(dir string, ignored bool) ([]string, bool, error) {
+	entries, err := os.ReadDir(filepath.Join(c.root, filepath.FromSlash(dir)))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read directory %s: %w", dir, err)
+	}
+
+	removed := []string{}
+	whole := dir != "" && !c.trackedIn[dir] && c.removable(dir, ignored)
+
+	for _, entry := range entries {
+		rel := entry.Name()
+		if dir != "" {
+			rel = dir + "/" + entry.Name()
+		}
+		if entry.Name() == ".git" {
+			// The worktree's own repository, or a nested one to keep
+			whole = false
+			if dir == "" {
+				continue
+			}
+			return []string{}, false, nil
+		}
+
+		entryIgnored := ignored || c.gitignore.Match(rel)
+
+		if entry.IsDir() && !c.tracked[rel] {
+			// Untracked directories are only entered with Directories
+			if !c.trackedIn[rel] && !c.opts.Directories {
+				whole = false
+				continue
+			}
+			inner, innerWhole, err := c.walk(rel, entryIgnored)
+			if err != nil {
+				return nil, false, err
+			}
+			if innerWhole {
+				removed = append(removed, rel+"/")
+			} else {
+				whole = false
+				removed = append(removed, inner...)
+			}
+			continue
+		}
+
+		if c.removable(rel, entryIgnored) {
+			removed = append(removed, rel)
+		} else {
+			whole = false
+		}
+	}
+
+	return removed, whole, nil
+}
+
+// removable reports whether a file or untracked directory may be removed
+func (c *cleaner) removable(rel string, ignored bool) bool {
+	if c.tracked[rel] {
+		return false
+	}
+	if c.opts.OnlyIgnored {
+		return ignored
+	}
+	return !ignored || c.opts.Ignored
+}
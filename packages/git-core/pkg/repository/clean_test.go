@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestClean tests which untracked and ignored paths are cleaned
+func TestClean(t *testing.T) {
+	repo, _ := setupUndoRepo(t, "one")
+
+	write := func(rel, content string) {
+		t.Helper()
+		full := filepath.Join(repo.Path, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("src/main.go", "package main\n")
+	if err := addFile(repo, "src/main.go"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createCommit(repo, "Add main"); err != nil {
+		t.Fatal(err)
+	}
+
+	write(".gitignore", "build/\n*.log\n")
+	write("untracked.txt", "new\n")
+	write("src/new.go", "package main\n")
+	write("debug.log", "log\n")
+	write("build/out.o", "binary\n")
+	write("tmp/a.txt", "a\n")
+	write("tmp/sub/b.txt", "b\n")
+	write("tmp/trace.log", "log\n")
+	write("nested/.git/HEAD", "ref: refs/heads/main\n")
+	write("nested/x.txt", "x\n")
+	if err := os.MkdirAll(filepath.Join(repo.Path, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(*CleanOptions)
+		expected []string
+	}{
+		{
+			name:     "files",
+			modify:   func(o *CleanOptions) {},
+			expected: []string{".gitignore", "src/new.go", "untracked.txt"},
+		},
+		{
+			name:     "directories",
+			modify:   func(o *CleanOptions) { o.Directories = true },
+			expected: []string{".gitignore", "empty/", "src/new.go", "tmp/a.txt", "tmp/sub/", "untracked.txt"},
+		},
+		{
+			name:     "ignored",
+			modify:   func(o *CleanOptions) { o.Directories = true; o.Ignored = true },
+			expected: []string{".gitignore", "build/", "debug.log", "empty/", "src/new.go", "tmp/", "untracked.txt"},
+		},
+		{
+			name:     "only ignored",
+			modify:   func(o *CleanOptions) { o.Directories = true; o.OnlyIgnored = true },
+			expected: []string{"build/", "debug.log", "tmp/trace.log"},
+		},
+	}
+
+	for _, tt := range tests {
+		opts := DefaultCleanOptions()
+		tt.modify(&opts)
+		result, err := repo.Clean(opts)
+		if err != nil {
+			t.Fatalf("%s: Clean failed: %v", tt.name, err)
+		}
+		if !result.DryRun || !reflect.DeepEqual(result.Removed, tt.expected) {
+			t.Errorf("%s: Removed = %v, expected %v", tt.name, result.Removed, tt.expected)
+		}
+	}
+
+	// Dry runs leave everything in place
+	if _, err := os.Stat(filepath.Join(repo.Path, "untracked.txt")); err != nil {
+		t.Fatal("Dry run removed a file")
+	}
+
+	opts := DefaultCleanOptions()
+	opts.DryRun = false
+	opts.Directories = true
+	if _, err := repo.Clean(opts); err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	for _, rel := range []string{"untracked.txt", "src/new.go", "tmp/a.txt", "tmp/sub", "empty"} {
+		if _, err := os.Stat(filepath.Join(repo.Path, rel)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", rel)
+		}
+	}
+	for _, rel := range []string{"file.txt", "src/main.go", "debug.log", "build/out.o", "tmp/trace.log", "nested/x.txt"} {
+		if _, err := os.Stat(filepath.Join(repo.Path, rel)); err != nil {
+			t.Errorf("Expected %s to be kept", rel)
+		}
+	}
+
+	opts.Ignored = true
+	opts.OnlyIgnored = true
+	if _, err := repo.Clean(opts); err == nil {
+		t.Error("Expected an error for conflicting options")
+	}
+}
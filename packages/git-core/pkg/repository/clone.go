@@ -2,14 +2,16 @@ package repository
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
-	"github.com/nseba/browser-git/git-core/pkg/object"
-	"github.com/nseba/browser-git/git-core/pkg/protocol"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
 )
 
 // CloneOptions contains options for cloning a repository
@@ -20,8 +22,21 @@ type CloneOptions struct {
 	Depth int
 	// Branch is the specific branch to clone (empty for default)
 	Branch string
+	// Filter is a partial clone filter-spec such as "blob:none" (empty for all objects)
+	Filter string
+	// Mirror clones every remote ref as-is into a bare repository (implies Bare)
+	Mirror bool
 	// Remote is the name of the remote (default: "origin")
 	Remote string
+	// BundleURI is a bundle or bundle list to seed the clone from before
+	// fetching the rest (empty to use bundles advertised by the server)
+	BundleURI string
+	// BranchFallback chooses the branch when none is requested and the
+	// remote does not advertise HEAD as a symref
+	BranchFallback protocol.BranchFallbackOptions
+	// Limits caps the responses and packfiles accepted from the remote,
+	// and is kept by the clone for later fetches
+	Limits protocol.Limits
 	// AuthProvider is the authentication provider to use
 	AuthProvider interface{}
 	// ProgressCallback is called with progress updates
@@ -31,27 +46,72 @@ type CloneOptions struct {
 // DefaultCloneOptions returns default clone options
 func DefaultCloneOptions() CloneOptions {
 	return CloneOptions{
-		Bare:   false,
-		Depth:  0,
-		Branch: "",
-		Remote: "origin",
+		Bare:           false,
+		Depth:          0,
+		Branch:         "",
+		Remote:         "origin",
+		BranchFallback: protocol.DefaultBranchFallbackOptions(),
+		Limits:         protocol.DefaultLimits(),
 	}
 }
 
-// Clone clones a remote repository to the specified path
+// CloneResult describes a completed clone
+type CloneResult struct {
+	// Repository is the cloned repository
+	Repository *Repository
+	// Branch is the branch HEAD points to, without refs/heads/ (empty if
+	// the remote has no branches)
+	Branch string
+	// BranchSource records how Branch was chosen
+	BranchSource protocol.DefaultBranchSource
+}
+
+// Clone clones a remote repository to the specified path.
+// Local paths and file:// URLs are cloned with CloneFromRepository,
+// or read as a bundle if they name a bundle file.
 func Clone(url string, path string, opts CloneOptions) (*Repository, error) {
-	// Create the target directory
-	if err := os.MkdirAll(path, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create directory: %w", err)
+	result, err := CloneWithResult(url, path, opts)
+	if err != nil {
+		return nil, err
 	}
+	return result.Repository, nil
+}
 
-	// Check if directory is empty
-	entries, err := os.ReadDir(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read directory: %w", err)
+// CloneWithResult clones like Clone and also reports which branch was
+// checked out and how it was chosen
+func CloneWithResult(url string, path string, opts CloneOptions) (*CloneResult, error) {
+	if sourcePath, ok := localClonePath(url); ok {
+		if IsBundle(sourcePath) {
+			return cloneFromBundle(sourcePath, path, opts)
+		}
+
+		source, err := Open(sourcePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open source repository: %w", err)
+		}
+		return cloneFromRepository(source, path, opts)
+	}
+
+	// Validate the partial clone filter before touching the filesystem
+	var filters map[string]string
+	if opts.Filter != "" {
+		parsed, err := protocol.ParseFilterSpec(opts.Filter)
+		if err != nil {
+			return nil, err
+		}
+		filters = parsed
+	}
+
+	if opts.Mirror {
+		if opts.Depth > 0 {
+			return nil, fmt.Errorf("a mirror clone cannot be shallow")
+		}
+		opts.Bare = true
 	}
-	if len(entries) > 0 {
-		return nil, fmt.Errorf("destination path '%s' already exists and is not an empty directory", path)
+
+	// Create the target directory, which must be empty
+	if err := prepareCloneDir(path); err != nil {
+		return nil, err
 	}
 
 	// Progress callback helper
@@ -65,6 +125,7 @@ func Clone(url string, path string, opts CloneOptions) (*Repository, error) {
 
 	// Create protocol client
 	client := protocol.NewClient()
+	client.SetLimits(opts.Limits)
 
 	// Set authentication if provided
 	if opts.AuthProvider != nil {
@@ -74,7 +135,7 @@ func Clone(url string, path string, opts CloneOptions) (*Repository, error) {
 
 	// Perform discovery to get remote references
 	progress("Fetching remote references...")
-	discovery, err := client.Discover(url, protocol.UploadPackService)
+	discovery, err := client.DiscoverRefs(url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to discover remote: %w", err)
 	}
@@ -82,6 +143,7 @@ func Clone(url string, path string, opts CloneOptions) (*Repository, error) {
 	// Determine the branch to clone
 	var targetBranch string
 	var targetHash string
+	branchSource := protocol.DefaultBranchRequested
 
 	if opts.Branch != "" {
 		// Clone specific branch
@@ -93,11 +155,15 @@ func Clone(url string, path string, opts CloneOptions) (*Repository, error) {
 		targetHash = ref.Hash
 	} else {
 		// Use default branch from HEAD
-		defaultBranch, err := discovery.GetDefaultBranch()
+		defaultBranch, source, err := discovery.ResolveDefaultBranch(opts.BranchFallback)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get default branch: %w", err)
 		}
 		targetBranch = defaultBranch
+		branchSource = source
+		if source != protocol.DefaultBranchSymref {
+			progress(fmt.Sprintf("warning: remote HEAD is not a symref, guessed '%s' (%s)", strings.TrimPrefix(defaultBranch, "refs/heads/"), source))
+		}
 		ref, found := discovery.GetReference(targetBranch)
 		if !found {
 			return nil, fmt.Errorf("default branch '%s' not found", targetBranch)
@@ -111,7 +177,13 @@ func Clone(url string, path string, opts CloneOptions) (*Repository, error) {
 	wants := []string{targetHash}
 
 	// For a full clone, we want all branches
-	if opts.Depth == 0 {
+	if opts.Mirror {
+		for _, ref := range mirrorRefs(discovery) {
+			if !stringSliceContains(wants, ref.Hash) {
+				wants = append(wants, ref.Hash)
+			}
+		}
+	} else if opts.Depth == 0 {
 		for _, ref := range discovery.References {
 			if strings.HasPrefix(ref.Name, "refs/heads/") || strings.HasPrefix(ref.Name, "refs/tags/") {
 				if !stringSliceContains(wants, ref.Hash) {
@@ -121,22 +193,6 @@ func Clone(url string, path string, opts CloneOptions) (*Repository, error) {
 		}
 	}
 
-	// We don't have any objects yet (empty repository)
-	haves := []string{}
-
-	// Build capabilities
-	capabilities := protocol.BuildCapabilities()
-
-	// Fetch packfile from remote
-	progress("Receiving objects...")
-	uploadPackClient := protocol.NewUploadPackClient(client, url)
-	packfileData, err := uploadPackClient.FetchPackfile(wants, haves, capabilities)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch packfile: %w", err)
-	}
-
-	progress(fmt.Sprintf("Received %d bytes", len(packfileData)))
-
 	// Initialize the local repository
 	progress("Initializing local repository...")
 	initOpts := InitOptions{
@@ -154,22 +210,104 @@ func Clone(url string, path string, opts CloneOptions) (*Repository, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to open repository: %w", err)
 	}
+	repo.Limits = opts.Limits
 
 	// Set up remote configuration
 	progress("Setting up remote...")
 	if err := setupRemote(repo, opts.Remote, url); err != nil {
 		return nil, fmt.Errorf("failed to setup remote: %w", err)
 	}
+	if opts.Mirror {
+		repo.Config.SetMirrorRemote(opts.Remote)
+		if err := repo.Config.Save(filepath.Join(repo.GitDir, "config")); err != nil {
+			return nil, fmt.Errorf("failed to save config: %w", err)
+		}
+	}
+
+	// Record the promisor remote so omitted objects are fetched on demand
+	if filters != nil {
+		repo.Config.SetPromisorRemote(opts.Remote, protocol.FormatFilterSpec(filters))
+		if err := repo.Config.Save(filepath.Join(repo.GitDir, "config")); err != nil {
+			return nil, fmt.Errorf("failed to save config: %w", err)
+		}
+		repo.ObjectDB = repo.newObjectDatabase()
+	}
+
+	// Seed the object store from bundles over plain HTTP, then only fetch
+	// what they lack. Bundles cannot honor depth or filters.
+	haves := []string{}
+	if opts.Depth == 0 && filters == nil {
+		if opts.BundleURI != "" {
+			haves = repo.seedFromBundleURI(client, opts.BundleURI, progress)
+		} else if discovery.HasCapability(protocol.BundleURICapability) {
+			if list, err := client.ListBundleURIs(url); err == nil && len(list.Bundles) > 0 {
+				haves = repo.seedFromBundleList(client, list, progress)
+			}
+		}
+	}
+
+	// Build capabilities
+	capabilities := protocol.BuildCapabilities()
+
+	// Fetch packfile from remote
+	progress("Receiving objects...")
+	uploadPackClient := protocol.NewUploadPackClient(client, url)
+	uploadPackClient.SetProtocolVersion(discovery.Version)
+	uploadPackClient.SetProgressCallback(progress)
+
+	// Objects are unpacked as the packfile arrives
+	stream := newPackStream(repo, uploadPackClient, false)
+	fetchResp, err := uploadPackClient.Fetch(&protocol.NegotiationRequest{
+		Wants:        wants,
+		Haves:        haves,
+		Capabilities: capabilities,
+		Deepen:       opts.Depth,
+		Filters:      filters,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch packfile: %w", err)
+	}
+	if err := stream.finish(fetchResp); err != nil {
+		return nil, err
+	}
+
+	progress(fmt.Sprintf("Received %d bytes", stream.received))
+	progress(fmt.Sprintf("Unpacked %d objects", stream.objects))
 
-	// Unpack objects from packfile
-	progress("Unpacking objects...")
-	if err := unpackPackfile(repo, packfileData); err != nil {
-		return nil, fmt.Errorf("failed to unpack objects: %w", err)
+	// Record where the truncated history ends
+	if err := repo.updateShallow(fetchResp.Shallows, fetchResp.Unshallows); err != nil {
+		return nil, err
+	}
+
+	// A mirror takes every remote ref verbatim instead of tracking branches
+	if opts.Mirror {
+		progress("Creating mirrored refs...")
+		for _, ref := range mirrorRefs(discovery) {
+			h, err := hash.ParseHash(ref.Hash)
+			if err != nil {
+				return nil, fmt.Errorf("invalid hash for %s: %w", ref.Name, err)
+			}
+			if err := repo.UpdateRef(ref.Name, h); err != nil {
+				return nil, fmt.Errorf("failed to create ref %s: %w", ref.Name, err)
+			}
+		}
+
+		progress("Done!")
+		return &CloneResult{
+			Repository:   repo,
+			Branch:       strings.TrimPrefix(targetBranch, "refs/heads/"),
+			BranchSource: branchSource,
+		}, nil
 	}
 
 	// Create remote tracking branches
 	progress("Creating remote tracking branches...")
 	for _, ref := range discovery.References {
+		// A shallow clone only fetched the target branch
+		if opts.Depth > 0 && ref.Name != targetBranch {
+			continue
+		}
+
 		if strings.HasPrefix(ref.Name, "refs/heads/") {
 			branchName := strings.TrimPrefix(ref.Name, "refs/heads/")
 			remoteBranch := fmt.Sprintf("refs/remotes/%s/%s", opts.Remote, branchName)
@@ -196,6 +334,11 @@ func Clone(url string, path string, opts CloneOptions) (*Repository, error) {
 		}
 	}
 
+	// Remember the remote's default branch as <remote>/HEAD
+	if err := repo.recordRemoteHEAD(discovery, opts.Remote); err != nil {
+		return nil, err
+	}
+
 	// Checkout the target branch (unless bare)
 	if !opts.Bare {
 		progress("Checking out files...")
@@ -206,7 +349,11 @@ func Clone(url string, path string, opts CloneOptions) (*Repository, error) {
 	}
 
 	progress("Done!")
-	return repo, nil
+	return &CloneResult{
+		Repository:   repo,
+		Branch:       strings.TrimPrefix(targetBranch, "refs/heads/"),
+		BranchSource: branchSource,
+	}, nil
 }
 
 // setupRemote configures the remote in the repository config
@@ -225,6 +372,10 @@ func setupRemote(repo *Repository, remoteName string, url string) error {
 	remoteConfig += fmt.Sprintf("\turl = %s\n", url)
 	remoteConfig += fmt.Sprintf("\tfetch = +refs/heads/*:refs/remotes/%s/*\n", remoteName)
 
+	// Keep the in-memory config in sync with the file
+	repo.Config.SetRemoteURL(remoteName, url)
+	repo.Config.SetFetchRefSpec(remoteName, fmt.Sprintf("+refs/heads/*:refs/remotes/%s/*", remoteName))
+
 	// Write updated config
 	updatedContent := string(content) + remoteConfig
 	if err := os.WriteFile(configPath, []byte(updatedContent), 0644); err != nil {
@@ -234,106 +385,248 @@ func setupRemote(repo *Repository, remoteName string, url string) error {
 	return nil
 }
 
-// unpackPackfile unpacks objects from a packfile into the repository
+// mirrorRefs returns the advertised refs a mirror stores: everything under
+// refs/, without HEAD or peeled tag entries
+func mirrorRefs(discovery *protocol.DiscoveryResponse) []protocol.Reference {
+	refs := []protocol.Reference{}
+	for _, ref := range discovery.References {
+		if strings.HasPrefix(ref.Name, "refs/") && !strings.HasSuffix(ref.Name, "^{}") {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// unpackPackfile unpacks objects from a packfile held in memory into the
+// repository, once its checksum is verified
 func unpackPackfile(repo *Repository, packfileData []byte) error {
-	// Parse packfile
-	reader := protocol.NewPackfileReader(bytes.NewReader(packfileData))
-	packfile, err := reader.ReadPackfile()
+	if _, err := repo.checkPack(packfileData, false); err != nil {
+		return err
+	}
+	_, err := unpackPackStream(repo, bytes.NewReader(packfileData))
+	return err
+}
+
+// packStream unpacks the packfile an upload-pack client fetches into a
+// repository as it arrives, instead of holding it in memory first
+type packStream struct {
+	repo     *Repository
+	verify   bool  // check every object before storing any
+	objects  int   // number of objects unpacked
+	received int64 // bytes of packfile received
+}
+
+// newPackStream makes the client unpack the packfile it fetches into repo.
+// With verify, every object is checked before anything is stored, so the
+// packfile is held in memory instead.
+func newPackStream(repo *Repository, client *protocol.UploadPackClient, verify bool) *packStream {
+	stream := &packStream{repo: repo, verify: verify}
+	if !verify {
+		client.SetPackHandler(stream.unpack)
+	}
+	return stream
+}
+
+// unpack is the client's pack handler
+func (s *packStream) unpack(pack io.Reader) error {
+	counter := &byteCounter{r: pack}
+	count, err := unpackPackStream(s.repo, counter)
+	s.received += counter.n
 	if err != nil {
-		return fmt.Errorf("failed to read packfile: %w", err)
+		return fmt.Errorf("failed to unpack objects: %w", err)
+	}
+	s.objects += count
+	return nil
+}
+
+// finish unpacks the packfile of a response that was not streamed, which
+// happens when the server sent no pack to stream or with verify, once the
+// packfile is checked
+func (s *packStream) finish(resp *protocol.NegotiationResponse) error {
+	if resp.PackStreamed {
+		return nil
+	}
+	if _, err := s.repo.checkPack(resp.Packfile, s.verify); err != nil {
+		return err
 	}
+	return s.unpack(bytes.NewReader(resp.Packfile))
+}
+
+// byteCounter counts the bytes read through it
+type byteCounter struct {
+	r io.Reader
+	n int64
+}
 
+// Read implements io.Reader
+func (c *byteCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// unpackPackStream unpacks a packfile into the repository as it is read,
+// storing each object whole as soon as it is decoded, so only the deltas
+// still waiting for their bases are held in memory. The pack may be thin:
+// its REF_DELTA objects can have bases that are not in the pack but
+// already stored locally, which the server may assume from the
+// negotiation. The pack's checksum is verified once it is read; when it
+// does not match, or the unpack fails in any other way, the objects the
+// pack added are deleted again, so nothing unverified is left behind. It
+// returns the number of objects in the pack.
+func unpackPackStream(repo *Repository, pack io.Reader) (count int, err error) {
 	// Create object database if not exists
 	if repo.ObjectDB == nil {
 		storage, err := createObjectStorage(repo)
 		if err != nil {
-			return fmt.Errorf("failed to create object storage: %w", err)
+			return 0, fmt.Errorf("failed to create object storage: %w", err)
 		}
 		repo.ObjectDB = object.NewObjectDatabase(storage, repo.Hasher)
 	}
 
-	// First pass: store all non-delta objects
-	// We need to do this in multiple passes to resolve deltas
-	objectsByHash := make(map[string]*protocol.PackfileObject)
-	resolvedObjects := make(map[string][]byte) // hash -> decompressed data
+	reader := protocol.NewPackfileReader(pack)
+	reader.SetHasher(repo.Hasher)
+	reader.SetLimits(repo.Limits)
+	header, err := reader.ReadHeader()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read packfile header: %w", err)
+	}
 
-	for i := range packfile.Objects {
-		obj := &packfile.Objects[i]
+	// The IDs of the objects stored so far by their offset in the pack, for
+	// OFS_DELTA bases, and the deltas whose base is neither stored nor yet
+	// read, by base hash or offset
+	objects := repo.unreplacedObjects()
+	stored := make(map[int64]hash.Hash)
+	waiting := make(map[string][]*protocol.PackfileObject)
+	waitingAt := make(map[int64][]*protocol.PackfileObject)
 
-		if !obj.IsDelta {
-			// Store regular object
-			if err := storePackfileObject(repo, obj, resolvedObjects); err != nil {
-				return fmt.Errorf("failed to store object %d: %w", i, err)
+	// The objects the pack added, as opposed to ones already stored
+	added := []hash.Hash{}
+	defer func() {
+		if err != nil {
+			for _, h := range added {
+				if deleteErr := objects.Delete(h); deleteErr != nil {
+					err = errors.Join(err, fmt.Errorf("failed to remove object %s: %w", h, deleteErr))
+				}
+			}
+		}
+	}()
+
+	// store stores a resolved object, then the deltas waiting for it, which
+	// are depth deltas away from the last object that was not waiting
+	var store func(obj *protocol.PackfileObject, depth int) error
+	store = func(obj *protocol.PackfileObject, depth int) error {
+		h, written, err := storePackfileObject(repo, objects, obj)
+		if err != nil {
+			return err
+		}
+		if written {
+			added = append(added, h)
+		}
+		stored[obj.PackOffset] = h
+		deltas := append(waiting[h.String()], waitingAt[obj.PackOffset]...)
+		delete(waiting, h.String())
+		delete(waitingAt, obj.PackOffset)
+		for _, delta := range deltas {
+			if max := repo.Limits.MaxDeltaDepth; max > 0 && depth+1 > max {
+				return &protocol.LimitError{Limit: "delta chain depth", Value: uint64(depth + 1), Max: uint64(max)}
 			}
-		} else {
-			// Collect delta objects for later processing
-			// We need to compute their hash first
-			if len(obj.BaseHash) > 0 {
-				baseHashStr := fmt.Sprintf("%x", obj.BaseHash)
-				objectsByHash[baseHashStr] = obj
+			if err := applyPackDelta(repo, delta, obj.Data, obj.Type); err != nil {
+				return err
+			}
+			if err := store(delta, depth+1); err != nil {
+				return err
 			}
 		}
+		return nil
 	}
 
-	// Second pass: resolve delta objects
-	// We may need multiple iterations if deltas reference other deltas
-	maxIterations := 10
-	for iteration := 0; iteration < maxIterations; iteration++ {
-		resolvedAny := false
-
-		for i := range packfile.Objects {
-			obj := &packfile.Objects[i]
-
-			if obj.IsDelta {
-				var baseData []byte
-				var found bool
+	for i := uint32(0); i < header.ObjectCount; i++ {
+		obj, err := reader.ReadObject()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read object %d: %w", i, err)
+		}
 
-				if len(obj.BaseHash) > 0 {
-					// REF_DELTA: find base by hash
-					baseHashStr := fmt.Sprintf("%x", obj.BaseHash)
-					baseData, found = resolvedObjects[baseHashStr]
-				} else if obj.Offset > 0 {
-					// OFS_DELTA: find base by offset
-					// This is more complex, we'd need to track offsets
-					// For now, skip OFS_DELTA
+		if obj.IsDelta {
+			var baseHash hash.Hash
+			if obj.Type == protocol.ObjOfsDelta {
+				// The base precedes the delta, but may itself be waiting
+				h, ok := stored[obj.Offset]
+				if !ok {
+					waitingAt[obj.Offset] = append(waitingAt[obj.Offset], obj)
 					continue
 				}
-
-				if found && baseData != nil {
-					// Apply delta
-					delta, err := protocol.ParseDelta(obj.Data)
-					if err != nil {
-						continue
-					}
-
-					resultData, err := protocol.ApplyDelta(baseData, delta)
-					if err != nil {
-						continue
-					}
-
-					// Store the resolved object
-					obj.Data = resultData
-					obj.IsDelta = false
-					if err := storePackfileObject(repo, obj, resolvedObjects); err != nil {
-						continue
-					}
-
-					resolvedAny = true
+				baseHash = h
+			} else {
+				baseHash = hash.NewHash(obj.BaseHash)
+				if !objects.Has(baseHash) {
+					waiting[baseHash.String()] = append(waiting[baseHash.String()], obj)
+					continue
 				}
 			}
+			base, err := objects.Get(baseHash)
+			if err != nil {
+				return 0, fmt.Errorf("failed to read base object %s: %w", baseHash.String(), err)
+			}
+			baseType, err := packObjectType(base)
+			if err != nil {
+				return 0, err
+			}
+			var baseData bytes.Buffer
+			if err := base.Serialize(&baseData); err != nil {
+				return 0, fmt.Errorf("failed to serialize base object: %w", err)
+			}
+			if err := applyPackDelta(repo, obj, baseData.Bytes(), baseType); err != nil {
+				return 0, fmt.Errorf("failed to resolve delta %d: %w", i, err)
+			}
 		}
 
-		// If we didn't resolve any deltas in this iteration, we're done or stuck
-		if !resolvedAny {
-			break
+		if err := store(obj, 0); err != nil {
+			return 0, fmt.Errorf("failed to store object %d: %w", i, err)
 		}
 	}
 
+	if _, err := reader.ReadChecksum(); err != nil {
+		return 0, err
+	}
+
+	// A delta whose base is nowhere to be found cannot be dropped quietly
+	for base := range waiting {
+		return 0, fmt.Errorf("failed to resolve delta: base object %s is missing", base)
+	}
+	for offset := range waitingAt {
+		return 0, fmt.Errorf("failed to resolve delta: no object at offset %d", offset)
+	}
+
+	return int(header.ObjectCount), nil
+}
+
+// applyPackDelta replaces a delta object with the object it makes of its
+// base, which has the base's type
+func applyPackDelta(repo *Repository, obj *protocol.PackfileObject, baseData []byte, baseType uint8) error {
+	delta, err := protocol.ParseDelta(obj.Data)
+	if err != nil {
+		return fmt.Errorf("failed to parse delta: %w", err)
+	}
+	data, err := protocol.ApplyDeltaWithLimits(baseData, delta, repo.Limits)
+	if err != nil {
+		return fmt.Errorf("failed to apply delta: %w", err)
+	}
+	obj.Data = data
+	obj.Type = baseType
+	obj.IsDelta = false
 	return nil
 }
 
-// storePackfileObject stores a single packfile object in the repository
-func storePackfileObject(repo *Repository, packObj *protocol.PackfileObject, resolvedObjects map[string][]byte) error {
+// newObjectWriter is implemented by object databases that can store an
+// object only if it is missing, hashing it once
+type newObjectWriter interface {
+	PutNew(obj object.Object) (hash.Hash, bool, error)
+}
+
+// storePackfileObject stores a single packfile object in db unless it is
+// already there, and reports whether it was written
+func storePackfileObject(repo *Repository, db object.Database, packObj *protocol.PackfileObject) (hash.Hash, bool, error) {
 	// Convert packfile object type to Git object type
 	var obj object.Object
 
@@ -341,14 +634,14 @@ func storePackfileObject(repo *Repository, packObj *protocol.PackfileObject, res
 	case protocol.ObjCommit:
 		commit, err := object.ParseCommit(packObj.Data)
 		if err != nil {
-			return fmt.Errorf("failed to parse commit: %w", err)
+			return nil, false, fmt.Errorf("failed to parse commit: %w", err)
 		}
 		obj = commit
 
 	case protocol.ObjTree:
 		tree, err := object.ParseTree(packObj.Data)
 		if err != nil {
-			return fmt.Errorf("failed to parse tree: %w", err)
+			return nil, false, fmt.Errorf("failed to parse tree: %w", err)
 		}
 		obj = tree
 
@@ -359,26 +652,31 @@ func storePackfileObject(repo *Repository, packObj *protocol.PackfileObject, res
 	case protocol.ObjTag:
 		tag, err := object.ParseTag(packObj.Data)
 		if err != nil {
-			return fmt.Errorf("failed to parse tag: %w", err)
+			return nil, false, fmt.Errorf("failed to parse tag: %w", err)
 		}
 		obj = tag
 
 	default:
-		return fmt.Errorf("unsupported object type: %d", packObj.Type)
+		return nil, false, fmt.Errorf("unsupported object type: %d", packObj.Type)
 	}
 
 	// Store object in database
-	h, err := repo.ObjectDB.Put(obj)
-	if err != nil {
-		return fmt.Errorf("failed to store object: %w", err)
+	if writer, ok := db.(newObjectWriter); ok {
+		h, written, err := writer.PutNew(obj)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to store object: %w", err)
+		}
+		return h, written, nil
 	}
 
-	// Store resolved object data for delta resolution
-	if resolvedObjects != nil {
-		resolvedObjects[h.String()] = packObj.Data
+	h := hash.HashObject(repo.Hasher, protocol.ObjectTypeName(packObj.Type), packObj.Data)
+	if db.Has(h) {
+		return h, false, nil
 	}
-
-	return nil
+	if _, err := db.Put(obj); err != nil {
+		return nil, false, fmt.Errorf("failed to store object: %w", err)
+	}
+	return h, true, nil
 }
 
 // checkoutBranch checks out a branch to the working directory
@@ -487,10 +785,7 @@ func checkoutTree(repo *Repository, tree *object.Tree, basePath string) error {
 
 // createObjectStorage creates an object storage for the repository
 func createObjectStorage(repo *Repository) (object.Storage, error) {
-	// For now, use file-based storage
-	// TODO: Support different storage backends
-	objectsPath := filepath.Join(repo.GitDir, "objects")
-	return newFileStorage(objectsPath, repo.Hasher), nil
+	return repo.newPackStorage(), nil
 }
 
 // stringSliceContains checks if a string slice contains a value
@@ -0,0 +1,255 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+// localClonePath returns the filesystem path for a clone source given as
+// a plain path or a file:// URL
+func localClonePath(url string) (string, bool) {
+	if strings.HasPrefix(url, "file://") {
+		return strings.TrimPrefix(url, "file://"), true
+	}
+	if strings.Contains(url, "://") {
+		return "", false
+	}
+	return url, true
+}
+
+// prepareCloneDir creates the clone destination, which must be empty
+func prepareCloneDir(path string) error {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %w", err)
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("destination path '%s' already exists and is not an empty directory", path)
+	}
+
+	return nil
+}
+
+// CloneFromRepository clones another repository on the same filesystem by
+// copying its objects and refs through the object database, without the
+// network protocol. Depth is ignored since all objects are available locally.
+func CloneFromRepository(source *Repository, path string, opts CloneOptions) (*Repository, error) {
+	result, err := cloneFromRepository(source, path, opts)
+	if err != nil {
+		return nil, err
+	}
+	return result.Repository, nil
+}
+
+// cloneFromRepository implements CloneFromRepository, reporting the branch
+// that was checked out
+func cloneFromRepository(source *Repository, path string, opts CloneOptions) (*CloneResult, error) {
+	if opts.Filter != "" {
+		return nil, fmt.Errorf("partial clone filters are not supported for local clones")
+	}
+	if opts.Mirror {
+		opts.Bare = true
+	}
+
+	progress := func(msg string) {
+		if opts.ProgressCallback != nil {
+			opts.ProgressCallback(msg)
+		}
+	}
+
+	sourcePath, err := filepath.Abs(source.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve source path: %w", err)
+	}
+
+	// Determine the branch to check out before touching the destination
+	branch := opts.Branch
+	branchSource := protocol.DefaultBranchRequested
+	if branch == "" {
+		branch, branchSource, err = localDefaultBranch(source, opts.BranchFallback)
+		if err != nil {
+			return nil, err
+		}
+	} else if !source.BranchExists(branch) {
+		return nil, fmt.Errorf("remote branch '%s' not found", branch)
+	}
+
+	if err := prepareCloneDir(path); err != nil {
+		return nil, err
+	}
+
+	progress("Cloning into '" + path + "'...")
+	if opts.Depth > 0 {
+		progress("warning: depth is ignored in local clones")
+	}
+
+	initOpts := InitOptions{
+		Bare:          opts.Bare,
+		InitialBranch: branch,
+		HashAlgorithm: source.Config.GetHashAlgorithm(),
+	}
+	repo, err := Create(path, initOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize repository: %w", err)
+	}
+	repo.Limits = opts.Limits
+
+	progress("Setting up remote...")
+	if err := setupRemote(repo, opts.Remote, sourcePath); err != nil {
+		return nil, fmt.Errorf("failed to setup remote: %w", err)
+	}
+	if opts.Mirror {
+		repo.Config.SetMirrorRemote(opts.Remote)
+		if err := repo.Config.Save(filepath.Join(repo.GitDir, "config")); err != nil {
+			return nil, fmt.Errorf("failed to save config: %w", err)
+		}
+	}
+
+	progress("Copying objects...")
+	count, err := copyObjects(source, repo)
+	if err != nil {
+		return nil, err
+	}
+	progress(fmt.Sprintf("Copied %d objects", count))
+
+	// A shallow source yields an equally shallow clone
+	shallows, err := source.ShallowCommits()
+	if err != nil {
+		return nil, err
+	}
+	boundaries := make([]string, len(shallows))
+	for i, h := range shallows {
+		boundaries[i] = h.String()
+	}
+	if err := repo.updateShallow(boundaries, nil); err != nil {
+		return nil, err
+	}
+
+	progress("Creating refs...")
+	if err := copyRefs(source, repo, opts, branch); err != nil {
+		return nil, err
+	}
+
+	// An empty source has nothing to check out
+	if !opts.Bare && repo.BranchExists(branch) {
+		progress("Checking out files...")
+		if err := checkoutBranch(repo, branch); err != nil {
+			return nil, fmt.Errorf("failed to checkout branch: %w", err)
+		}
+	}
+
+	progress("Done!")
+	return &CloneResult{
+		Repository:   repo,
+		Branch:       branch,
+		BranchSource: branchSource,
+	}, nil
+}
+
+// localDefaultBranch returns the branch a local clone checks out: the one
+// the source's HEAD is on, or a guess among its branches when HEAD is detached
+func localDefaultBranch(source *Repository, fallback protocol.BranchFallbackOptions) (string, protocol.DefaultBranchSource, error) {
+	if branch, err := source.CurrentBranch(); err == nil {
+		return branch, protocol.DefaultBranchSymref, nil
+	}
+
+	refs, err := source.ListRefs("refs/heads/")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to list branches: %w", err)
+	}
+	sort.Strings(refs)
+
+	discovery := &protocol.DiscoveryResponse{SymRefs: map[string]string{}}
+	if head, err := source.ResolveHEAD(); err == nil {
+		discovery.References = append(discovery.References, protocol.Reference{Name: "HEAD", Hash: head.String()})
+	}
+	for _, ref := range refs {
+		if h, err := source.ResolveRef(ref); err == nil {
+			discovery.References = append(discovery.References, protocol.Reference{Name: ref, Hash: h.String()})
+		}
+	}
+
+	branch, branchSource, err := discovery.ResolveDefaultBranch(fallback)
+	if err != nil {
+		return "", "", fmt.Errorf("source repository HEAD is detached, a branch must be specified: %w", err)
+	}
+	return strings.TrimPrefix(branch, "refs/heads/"), branchSource, nil
+}
+
+// copyObjects copies every object from source to dest, verifying that each
+// object still hashes to its name
+func copyObjects(source, dest *Repository) (int, error) {
+	hashes, err := source.ObjectDB.List()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	for _, h := range hashes {
+		obj, err := source.unreplacedObjects().Get(h)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read object %s: %w", h.String(), err)
+		}
+
+		stored, err := dest.ObjectDB.Put(obj)
+		if err != nil {
+			return 0, fmt.Errorf("failed to write object %s: %w", h.String(), err)
+		}
+		if !stored.Equals(h) {
+			return 0, fmt.Errorf("object %s is corrupt", h.String())
+		}
+	}
+
+	return len(hashes), nil
+}
+
+// copyRefs creates the clone's refs from the source's. A mirror copies every
+// ref as-is; otherwise branches become remote tracking branches, tags are
+// kept and the checked out branch is created locally.
+func copyRefs(source, dest *Repository, opts CloneOptions, branch string) error {
+	refs, err := source.ListRefs("refs/")
+	if err != nil {
+		return fmt.Errorf("failed to list refs: %w", err)
+	}
+
+	for _, ref := range refs {
+		h, err := source.ResolveRef(ref)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", ref, err)
+		}
+
+		targets := []string{}
+		switch {
+		case opts.Mirror:
+			targets = append(targets, ref)
+		case strings.HasPrefix(ref, "refs/heads/"):
+			name := strings.TrimPrefix(ref, "refs/heads/")
+			targets = append(targets, fmt.Sprintf("refs/remotes/%s/%s", opts.Remote, name))
+			if name == branch {
+				targets = append(targets, ref)
+			}
+		case strings.HasPrefix(ref, "refs/tags/"):
+			targets = append(targets, ref)
+		}
+
+		for _, target := range targets {
+			if err := dest.UpdateRef(target, h); err != nil {
+				return fmt.Errorf("failed to create ref %s: %w", target, err)
+			}
+		}
+	}
+
+	// The branch the source is on is the remote's default branch
+	if current, err := source.CurrentBranch(); err == nil && !opts.Mirror {
+		return dest.setRemoteHEAD(opts.Remote, current)
+	}
+	return nil
+}
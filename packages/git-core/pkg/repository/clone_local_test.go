@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+// setupLocalCloneSource creates a repository with two commits on main,
+// a feature branch and a tag
+func setupLocalCloneSource(t *testing.T) *Repository {
+	t.Helper()
+
+	source, err := Create(filepath.Join(t.TempDir(), "source"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	for i, content := range []string{"one\n", "two\n"} {
+		if err := os.MkdirAll(filepath.Join(source.Path, "dir"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(source.Path, "dir", "file.txt"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := addFile(source, "dir/file.txt"); err != nil {
+			t.Fatalf("Failed to add file: %v", err)
+		}
+		h, err := createCommit(source, content)
+		if err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+		if i == 0 {
+			if err := source.CreateBranch("feature", h); err != nil {
+				t.Fatalf("Failed to create branch: %v", err)
+			}
+			if err := source.UpdateRef("refs/tags/v1", h); err != nil {
+				t.Fatalf("Failed to create tag: %v", err)
+			}
+		}
+	}
+
+	return source
+}
+
+// TestCloneLocalPath tests cloning from a directory without the network protocol
+func TestCloneLocalPath(t *testing.T) {
+	source := setupLocalCloneSource(t)
+	main, err := source.GetBranch("main")
+	if err != nil {
+		t.Fatalf("Failed to get branch: %v", err)
+	}
+	feature, err := source.GetBranch("feature")
+	if err != nil {
+		t.Fatalf("Failed to get branch: %v", err)
+	}
+
+	repo, err := Clone(source.Path, filepath.Join(t.TempDir(), "clone"), DefaultCloneOptions())
+	if err != nil {
+		t.Fatalf("Local clone failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(repo.Path, "dir", "file.txt"))
+	if err != nil || string(content) != "two\n" {
+		t.Errorf("Unexpected checked out content %q: %v", content, err)
+	}
+
+	expected := map[string]string{
+		"refs/heads/main":             main.String(),
+		"refs/remotes/origin/main":    main.String(),
+		"refs/remotes/origin/feature": feature.String(),
+		"refs/tags/v1":                feature.String(),
+	}
+	for ref, want := range expected {
+		h, err := repo.GetRef(ref)
+		if err != nil || h.String() != want {
+			t.Errorf("Ref %s = %v, expected %s (%v)", ref, h, want, err)
+		}
+	}
+	if repo.BranchExists("feature") {
+		t.Error("Only the checked out branch should exist locally")
+	}
+
+	url, err := repo.Config.GetRemoteURL("origin")
+	if err != nil || !filepath.IsAbs(url) {
+		t.Errorf("Expected absolute remote URL, got %q: %v", url, err)
+	}
+
+	if _, _, err := repo.GetCommit(feature.String()); err != nil {
+		t.Errorf("Clone is missing objects: %v", err)
+	}
+}
+
+// TestCloneFromRepositoryOptions tests branch selection, bare and mirror local clones
+func TestCloneFromRepositoryOptions(t *testing.T) {
+	source := setupLocalCloneSource(t)
+
+	opts := DefaultCloneOptions()
+	opts.Branch = "feature"
+	repo, err := CloneFromRepository(source, filepath.Join(t.TempDir(), "feature"), opts)
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+	if branch, _ := repo.CurrentBranch(); branch != "feature" {
+		t.Errorf("Expected feature to be checked out, got %q", branch)
+	}
+	content, _ := os.ReadFile(filepath.Join(repo.Path, "dir", "file.txt"))
+	if string(content) != "one\n" {
+		t.Errorf("Unexpected checked out content %q", content)
+	}
+
+	opts = DefaultCloneOptions()
+	opts.Mirror = true
+	mirror, err := CloneFromRepository(source, filepath.Join(t.TempDir(), "mirror.git"), opts)
+	if err != nil {
+		t.Fatalf("Mirror clone failed: %v", err)
+	}
+	if !mirror.IsBare() || !mirror.Config.IsMirrorRemote("origin") {
+		t.Error("Expected a bare mirror")
+	}
+	if !mirror.BranchExists("feature") || !mirror.BranchExists("main") {
+		t.Error("Mirror should contain all branches")
+	}
+
+	opts = DefaultCloneOptions()
+	opts.Branch = "missing"
+	if _, err := CloneFromRepository(source, filepath.Join(t.TempDir(), "missing"), opts); err == nil {
+		t.Error("Expected error for missing branch")
+	}
+
+	opts = DefaultCloneOptions()
+	opts.Filter = "blob:none"
+	if _, err := CloneFromRepository(source, filepath.Join(t.TempDir(), "filtered"), opts); err == nil {
+		t.Error("Expected error for partial local clone")
+	}
+}
+
+// TestCloneDefaultBranchFallback tests how the branch is chosen and reported
+func TestCloneDefaultBranchFallback(t *testing.T) {
+	source := setupLocalCloneSource(t)
+	feature, _ := source.GetBranch("feature")
+
+	result, err := CloneWithResult(source.Path, filepath.Join(t.TempDir(), "clone"), DefaultCloneOptions())
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+	if result.Branch != "main" || result.BranchSource != protocol.DefaultBranchSymref {
+		t.Errorf("Got %q (%s), expected main from the symref", result.Branch, result.BranchSource)
+	}
+
+	opts := DefaultCloneOptions()
+	opts.Branch = "feature"
+	result, err = CloneWithResult(source.Path, filepath.Join(t.TempDir(), "requested"), opts)
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+	if result.Branch != "feature" || result.BranchSource != protocol.DefaultBranchRequested {
+		t.Errorf("Got %q (%s), expected the requested branch", result.Branch, result.BranchSource)
+	}
+
+	// A detached HEAD on a branch's commit selects that branch
+	if err := source.SetHEAD(feature.String()); err != nil {
+		t.Fatal(err)
+	}
+	result, err = CloneWithResult(source.Path, filepath.Join(t.TempDir(), "head"), DefaultCloneOptions())
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+	if result.Branch != "feature" || result.BranchSource != protocol.DefaultBranchHead {
+		t.Errorf("Got %q (%s), expected feature from the HEAD commit", result.Branch, result.BranchSource)
+	}
+	if branch, _ := result.Repository.CurrentBranch(); branch != "feature" {
+		t.Errorf("Clone HEAD is on %q, expected feature", branch)
+	}
+
+	// Otherwise the preferred names are tried
+	_, head, _ := source.peelToCommit(feature)
+	orphan := object.NewCommit()
+	orphan.Tree = head.Tree
+	orphan.Author = head.Author
+	orphan.Committer = head.Committer
+	orphan.Message = "Detached\n"
+	orphanHash, _ := source.ObjectDB.Put(orphan)
+	if err := source.SetHEAD(orphanHash.String()); err != nil {
+		t.Fatal(err)
+	}
+	result, err = CloneWithResult(source.Path, filepath.Join(t.TempDir(), "preferred"), DefaultCloneOptions())
+	if err != nil {
+		t.Fatalf("Clone failed: %v", err)
+	}
+	if result.Branch != "main" || result.BranchSource != protocol.DefaultBranchPreferred {
+		t.Errorf("Got %q (%s), expected main by preference", result.Branch, result.BranchSource)
+	}
+
+	opts = DefaultCloneOptions()
+	opts.BranchFallback = protocol.BranchFallbackOptions{Preferred: []string{"trunk"}}
+	if _, err := CloneWithResult(source.Path, filepath.Join(t.TempDir(), "strict"), opts); err == nil {
+		t.Error("Expected an error when no fallback applies")
+	}
+}
@@ -1,9 +1,17 @@
 package repository
 
 import (
+	"bytes"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"testing/iotest"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
 )
 
 func TestCloneOptions(t *testing.T) {
@@ -183,3 +191,201 @@ func TestFileStorage(t *testing.T) {
 		t.Errorf("Object path mismatch: expected %s, got %s", expectedPath, computedPath)
 	}
 }
+
+// TestUnpackRefDelta tests that a REF_DELTA object is stored with its base's type
+func TestUnpackRefDelta(t *testing.T) {
+	repo, _ := setupUndoRepo(t, "one")
+
+	base := []byte("line one\nline two\nline three\n")
+	target := []byte("line one\nline two\nline three\nline four\n")
+	baseBlob := object.NewBlob(base)
+	if err := baseBlob.ComputeHash(repo.Hasher); err != nil {
+		t.Fatal(err)
+	}
+	deltaData, err := protocol.EncodeDelta(protocol.CreateDelta(base, target))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = protocol.NewPackfileWriter(&buf).WritePackfile([]protocol.PackfileObject{
+		{Type: protocol.ObjBlob, Size: uint64(len(base)), Data: base},
+		{Type: protocol.ObjRefDelta, Size: uint64(len(deltaData)), Data: deltaData, BaseHash: baseBlob.Hash().Bytes(), IsDelta: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unpackPackfile(repo, buf.Bytes()); err != nil {
+		t.Fatalf("unpackPackfile failed: %v", err)
+	}
+
+	targetBlob := object.NewBlob(target)
+	if err := targetBlob.ComputeHash(repo.Hasher); err != nil {
+		t.Fatal(err)
+	}
+	obj, err := repo.ObjectDB.Get(targetBlob.Hash())
+	if err != nil {
+		t.Fatalf("Resolved delta was not stored: %v", err)
+	}
+	if blob, ok := obj.(*object.Blob); !ok || !bytes.Equal(blob.Content(), target) {
+		t.Errorf("Unexpected resolved object %#v", obj)
+	}
+}
+
+// TestUnpackThinPack tests that REF_DELTA objects based on local objects
+// outside the pack are resolved, and that a missing base is an error
+func TestUnpackThinPack(t *testing.T) {
+	repo, _ := setupUndoRepo(t, "one")
+
+	base := []byte("line one\nline two\nline three\n")
+	middle := []byte("line one\nline two\nline three\nline four\n")
+	target := []byte("line zero\nline one\nline two\nline three\nline four\n")
+	baseHash, err := repo.ObjectDB.Put(object.NewBlob(base))
+	if err != nil {
+		t.Fatal(err)
+	}
+	middleBlob := object.NewBlob(middle)
+	if err := middleBlob.ComputeHash(repo.Hasher); err != nil {
+		t.Fatal(err)
+	}
+	toMiddle, err := protocol.EncodeDelta(protocol.CreateDelta(base, middle))
+	if err != nil {
+		t.Fatal(err)
+	}
+	toTarget, err := protocol.EncodeDelta(protocol.CreateDelta(middle, target))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The delta on a delta comes first, so it waits for its base
+	var buf bytes.Buffer
+	err = protocol.NewPackfileWriter(&buf).WritePackfile([]protocol.PackfileObject{
+		{Type: protocol.ObjRefDelta, Size: uint64(len(toTarget)), Data: toTarget, BaseHash: middleBlob.Hash().Bytes(), IsDelta: true},
+		{Type: protocol.ObjRefDelta, Size: uint64(len(toMiddle)), Data: toMiddle, BaseHash: baseHash.Bytes(), IsDelta: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unpackPackfile(repo, buf.Bytes()); err != nil {
+		t.Fatalf("unpackPackfile failed: %v", err)
+	}
+
+	for _, content := range [][]byte{middle, target} {
+		blob := object.NewBlob(content)
+		if err := blob.ComputeHash(repo.Hasher); err != nil {
+			t.Fatal(err)
+		}
+		obj, err := repo.ObjectDB.Get(blob.Hash())
+		if err != nil {
+			t.Fatalf("Resolved delta was not stored: %v", err)
+		}
+		if stored, ok := obj.(*object.Blob); !ok || !bytes.Equal(stored.Content(), content) {
+			t.Errorf("Unexpected resolved object %#v", obj)
+		}
+	}
+
+	// A base that is neither in the pack nor local fails the unpack
+	missing := object.NewBlob([]byte("never stored\n"))
+	if err := missing.ComputeHash(repo.Hasher); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	err = protocol.NewPackfileWriter(&buf).WritePackfile([]protocol.PackfileObject{
+		{Type: protocol.ObjRefDelta, Size: uint64(len(toMiddle)), Data: toMiddle, BaseHash: missing.Hash().Bytes(), IsDelta: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = unpackPackfile(repo, buf.Bytes())
+	if err == nil || !strings.Contains(err.Error(), missing.Hash().String()) {
+		t.Errorf("Expected an error naming the missing base, got %v", err)
+	}
+}
+
+// TestUnpackPackStream tests that objects are stored as they are read from
+// a pack that arrives a byte at a time, before the pack is complete
+func TestUnpackPackStream(t *testing.T) {
+	repo, _ := setupUndoRepo(t)
+
+	contents := []string{"first blob\n", "second blob\n", largeTestFile(200)}
+	objects := []protocol.PackfileObject{}
+	for _, content := range contents {
+		objects = append(objects, protocol.PackfileObject{Type: protocol.ObjBlob, Size: uint64(len(content)), Data: []byte(content)})
+	}
+	var buf bytes.Buffer
+	if err := protocol.NewPackfileWriter(&buf).WritePackfile(objects); err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := unpackPackStream(repo, iotest.OneByteReader(bytes.NewReader(buf.Bytes())))
+	if err != nil {
+		t.Fatalf("unpackPackStream failed: %v", err)
+	}
+	if count != len(contents) {
+		t.Errorf("count = %d, want %d", count, len(contents))
+	}
+	for _, content := range contents {
+		if !repo.ObjectDB.Has(hash.HashBlob(repo.Hasher, []byte(content))) {
+			t.Errorf("Blob %q was not stored", content[:10])
+		}
+	}
+
+	// A pack cut off in its last object, or whose checksum is wrong, does
+	// not leave the objects before it behind, but keeps the ones that were
+	// stored before it
+	corrupt := append([]byte{}, buf.Bytes()...)
+	corrupt[len(corrupt)-1] ^= 0xff
+	for _, pack := range [][]byte{buf.Bytes()[:buf.Len()-40], corrupt} {
+		clone, _ := setupUndoRepo(t)
+		if _, err := clone.ObjectDB.Put(object.NewBlobFromString(contents[1])); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := unpackPackStream(clone, bytes.NewReader(pack)); err == nil {
+			t.Fatal("Expected an error for a truncated or corrupt pack")
+		}
+		if clone.ObjectDB.Has(hash.HashBlob(clone.Hasher, []byte(contents[0]))) {
+			t.Error("Expected the first blob to be removed once the pack failed")
+		}
+		if !clone.ObjectDB.Has(hash.HashBlob(clone.Hasher, []byte(contents[1]))) {
+			t.Error("Expected the blob stored before the pack to be kept")
+		}
+	}
+
+	// Offset deltas are resolved, also against a delta that waits for a
+	// base later in the pack
+	later := []byte(largeTestFile(150))
+	middle := append([]byte("a line before\n"), later...)
+	last := append(append([]byte{}, middle...), "a line after\n"...)
+	toMiddle, err := protocol.CreateAndEncodeDelta(later, middle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	toLast, err := protocol.CreateAndEncodeDelta(middle, last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	err = protocol.NewPackfileWriter(&buf).WritePackfile([]protocol.PackfileObject{
+		{Type: protocol.ObjRefDelta, Size: uint64(len(toMiddle)), Data: toMiddle, BaseHash: hash.HashBlob(repo.Hasher, later).Bytes(), IsDelta: true},
+		{Type: protocol.ObjOfsDelta, Size: uint64(len(toLast)), Data: toLast, Offset: protocol.PackfileHeaderSize, IsDelta: true},
+		{Type: protocol.ObjBlob, Size: uint64(len(later)), Data: later},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both deltas wait for their bases, so they are two deltas deep
+	limited, _ := setupUndoRepo(t)
+	limited.Limits.MaxDeltaDepth = 1
+	var limitErr *protocol.LimitError
+	if _, err := unpackPackStream(limited, bytes.NewReader(buf.Bytes())); !errors.As(err, &limitErr) {
+		t.Errorf("Expected a delta chain depth limit error, got %v", err)
+	}
+	if _, err := unpackPackStream(repo, bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("unpackPackStream failed: %v", err)
+	}
+	for _, content := range [][]byte{middle, last} {
+		if !repo.ObjectDB.Has(hash.HashBlob(repo.Hasher, content)) {
+			t.Errorf("Delta %q was not resolved", content[:10])
+		}
+	}
+}
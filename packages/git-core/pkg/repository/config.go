@@ -372,3 +372,41 @@ func (c *Config) SetBranchUpstream(branchName, remoteName, remoteBranch string)
 	c.Set(section, "remote", remoteName)
 	c.Set(section, "merge", fmt.Sprintf("refs/heads/%s", remoteBranch))
 }
+
+// GetPromisorRemote returns the remote that lazily provides missing objects
+// in a partial clone
+func (c *Config) GetPromisorRemote() (string, bool) {
+	return c.Get("extensions", "partialclone")
+}
+
+// SetPromisorRemote marks a remote as the promisor for a partial clone
+// created with the given filter-spec
+func (c *Config) SetPromisorRemote(remoteName, filterSpec string) {
+	section := fmt.Sprintf("remote.%s", remoteName)
+	c.Set(section, "promisor", "true")
+	c.Set(section, "partialclonefilter", filterSpec)
+
+	// Partial clones need repository format version 1 for the extension
+	c.Set("core", "repositoryformatversion", "1")
+	c.Set("extensions", "partialclone", remoteName)
+}
+
+// GetPartialCloneFilter returns the filter-spec used for a promisor remote
+func (c *Config) GetPartialCloneFilter(remoteName string) (string, bool) {
+	section := fmt.Sprintf("remote.%s", remoteName)
+	return c.Get(section, "partialclonefilter")
+}
+
+// IsMirrorRemote returns whether a remote mirrors all refs of the repository
+func (c *Config) IsMirrorRemote(remoteName string) bool {
+	section := fmt.Sprintf("remote.%s", remoteName)
+	mirror, _ := c.GetBool(section, "mirror")
+	return mirror
+}
+
+// SetMirrorRemote configures a remote to mirror all refs into the same namespace
+func (c *Config) SetMirrorRemote(remoteName string) {
+	section := fmt.Sprintf("remote.%s", remoteName)
+	c.Set(section, "fetch", "+refs/*:refs/*")
+	c.SetBool(section, "mirror", true)
+}
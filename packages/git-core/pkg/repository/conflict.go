@@ -6,10 +6,10 @@ import (
 	"path/filepath"
 	"time"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
-	"github.com/nseba/browser-git/git-core/pkg/index"
-	"github.com/nseba/browser-git/git-core/pkg/merge"
-	"github.com/nseba/browser-git/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/merge"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
 )
 
 // ConflictResolutionStrategy represents how to resolve a conflict
@@ -287,16 +287,8 @@ func (r *Repository) ContinueMerge(message string) (hash.Hash, error) {
 	}
 
 	// Update HEAD
-	currentBranch, err := r.CurrentBranch()
-	if err == nil {
-		branchRef := fmt.Sprintf("refs/heads/%s", currentBranch)
-		if err := r.UpdateRef(branchRef, commitHash); err != nil {
-			return nil, fmt.Errorf("failed to update branch: %w", err)
-		}
-	} else {
-		if err := r.SetHEAD(commitHash.String()); err != nil {
-			return nil, fmt.Errorf("failed to update HEAD: %w", err)
-		}
+	if err := r.UpdateHEAD(commitHash, commitReflogMessage("commit (merge)", message)); err != nil {
+		return nil, fmt.Errorf("failed to update HEAD: %w", err)
 	}
 
 	// Clean up merge state
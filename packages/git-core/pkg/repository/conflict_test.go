@@ -5,7 +5,7 @@ import (
 	"path/filepath"
 	"testing"
 
-	"github.com/nseba/browser-git/git-core/pkg/merge"
+	"github.com/nseba/browser-git/packages/git-core/pkg/merge"
 )
 
 // TestConflictResolutionStrategies tests different conflict resolution strategies
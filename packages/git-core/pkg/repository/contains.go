@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// BranchesContaining returns the local branches whose history includes a
+// commit, like git branch --contains. Names are sorted and given without
+// refs/heads/.
+func (r *Repository) BranchesContaining(rev string) ([]string, error) {
+	return r.refsContaining(rev, "refs/heads/")
+}
+
+// TagsContaining returns the tags whose history includes a commit, like
+// git tag --contains. Annotated tags are peeled to their commit; tags of
+// trees and blobs never contain a commit.
+func (r *Repository) TagsContaining(rev string) ([]string, error) {
+	return r.refsContaining(rev, "refs/tags/")
+}
+
+// refsContaining returns the refs under prefix that reach the commit rev
+// names, with the prefix trimmed
+func (r *Repository) refsContaining(rev, prefix string) ([]string, error) {
+	h, err := r.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	target, _, err := r.peelToCommit(h)
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := r.ListRefs(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs: %w", err)
+	}
+
+	walker := r.newContainsWalker(target)
+	names := make([]string, 0)
+	for _, ref := range refs {
+		refHash, err := r.ResolveRef(ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", ref, err)
+		}
+		tip, _, err := r.peelToCommit(refHash)
+		if err != nil {
+			continue
+		}
+
+		found, err := walker.reaches(tip)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			names = append(names, strings.TrimPrefix(ref, prefix))
+		}
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// containsWalker answers whether commits reach a target commit. Answers
+// are memoized across calls, so checking many tips walks each commit of
+// their combined history at most once.
+type containsWalker struct {
+	r       *Repository
+	target  string
+	shallow map[string]bool
+	memo    map[string]bool
+	parents map[string][]hash.Hash
+}
+
+// newContainsWalker creates a walker for commits reaching target
+func (r *Repository) newContainsWalker(target hash.Hash) *containsWalker {
+	return &containsWalker{
+		r:       r,
+		target:  target.String(),
+		shallow: r.shallowSet(),
+		memo:    make(map[string]bool),
+		parents: make(map[string][]hash.Hash),
+	}
+}
+
+// reaches reports whether start is the target or one of its descendants.
+// The walk is depth-first with an explicit stack, which always holds a
+// path from start towards its ancestors.
+func (w *containsWalker) reaches(start hash.Hash) (bool, error) {
+	stack := []hash.Hash{start}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		key := top.String()
+		if _, done := w.memo[key]; done {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		if key == w.target {
+			w.memo[key] = true
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		parents, err := w.commitParents(top)
+		if err != nil {
+			return false, err
+		}
+
+		// Decide once every parent is decided or one reaches the target
+		found, pending := false, false
+		for _, parent := range parents {
+			reached, done := w.memo[parent.String()]
+			if !done {
+				stack = append(stack, parent)
+				pending = true
+				break
+			}
+			if reached {
+				found = true
+				break
+			}
+		}
+		if pending {
+			continue
+		}
+
+		w.memo[key] = found
+		delete(w.parents, key)
+		stack = stack[:len(stack)-1]
+	}
+
+	return w.memo[start.String()], nil
+}
+
+// commitParents loads a commit's parents, treating shallow boundaries as
+// root commits
+func (w *containsWalker) commitParents(h hash.Hash) ([]hash.Hash, error) {
+	key := h.String()
+	if parents, ok := w.parents[key]; ok {
+		return parents, nil
+	}
+
+	obj, err := w.r.ObjectDB.Get(h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load commit %s: %w", shortHash(h), err)
+	}
+	commit, ok := obj.(*object.Commit)
+	if !ok {
+		return nil, fmt.Errorf("object %s is not a commit", shortHash(h))
+	}
+
+	parents := commit.Parents
+	if w.shallow[key] {
+		parents = nil
+	}
+	w.parents[key] = parents
+	return parents, nil
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// TestBranchesAndTagsContaining tests which refs reach a commit, through
+// first and second parents
+func TestBranchesAndTagsContaining(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "a\n", "b\n", "c\n")
+
+	// A side commit off the root, merged into a branch of its own
+	_, root, err := repo.peelToCommit(commits[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	put := func(message string, parents ...hash.Hash) hash.Hash {
+		commit := object.NewCommit()
+		commit.Tree = root.Tree
+		commit.Parents = parents
+		commit.Author = root.Author
+		commit.Committer = root.Committer
+		commit.Message = message
+		h, err := repo.ObjectDB.Put(commit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	side := put("Side\n", commits[0])
+	merge := put("Merge\n", commits[2], side)
+
+	for name, h := range map[string]hash.Hash{"release/1.x": commits[1], "side": side, "merged": merge} {
+		if err := repo.CreateBranch(name, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repo.CreateTag("v0", commits[0].String(), DefaultTagOptions()); err != nil {
+		t.Fatal(err)
+	}
+	annotated := DefaultTagOptions()
+	annotated.Message = "Release 1"
+	if _, err := repo.CreateTag("v1", commits[1].String(), annotated); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		rev      string
+		branches []string
+		tags     []string
+	}{
+		{commits[0].String(), []string{"main", "merged", "release/1.x", "side"}, []string{"v0", "v1"}},
+		{"v1", []string{"main", "merged", "release/1.x"}, []string{"v1"}},
+		{"side", []string{"merged", "side"}, []string{}},
+		{"merged", []string{"merged"}, []string{}},
+	}
+	for _, tt := range tests {
+		branches, err := repo.BranchesContaining(tt.rev)
+		if err != nil {
+			t.Fatalf("BranchesContaining(%s) failed: %v", tt.rev, err)
+		}
+		if !reflect.DeepEqual(branches, tt.branches) {
+			t.Errorf("BranchesContaining(%s): expected %v, got %v", tt.rev, tt.branches, branches)
+		}
+
+		tags, err := repo.TagsContaining(tt.rev)
+		if err != nil {
+			t.Fatalf("TagsContaining(%s) failed: %v", tt.rev, err)
+		}
+		if !reflect.DeepEqual(tags, tt.tags) {
+			t.Errorf("TagsContaining(%s): expected %v, got %v", tt.rev, tt.tags, tags)
+		}
+	}
+
+	if _, err := repo.BranchesContaining("missing"); err == nil {
+		t.Error("Expected an error for an unknown revision")
+	}
+}
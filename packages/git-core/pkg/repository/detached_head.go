@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// ErrDetachedHEAD is returned when an operation needs a current branch
+// but HEAD points directly at a commit
+var ErrDetachedHEAD = errors.New("HEAD is detached")
+
+// DetachedHEAD returns the commit HEAD points at when it is detached, or
+// nil when HEAD is on a branch
+func (r *Repository) DetachedHEAD() (hash.Hash, error) {
+	head, err := r.HEAD()
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(head, "ref: ") {
+		return nil, nil
+	}
+	h, err := hash.ParseHash(head)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HEAD: %w", err)
+	}
+	return h, nil
+}
+
+// AttachHEAD creates a branch at the commit a detached HEAD points to and
+// puts HEAD on it, like git switch -c on a detached HEAD. The index and
+// work tree are left as they are, and commits made while detached are
+// kept on the new branch.
+func (r *Repository) AttachHEAD(branch string) error {
+	h, err := r.DetachedHEAD()
+	if err != nil {
+		return err
+	}
+	if h == nil {
+		return fmt.Errorf("HEAD is not detached")
+	}
+	if r.BranchExists(branch) {
+		return fmt.Errorf("branch %s already exists", branch)
+	}
+
+	ref := "refs/heads/" + branch
+	tx := r.BeginRefTx()
+	if err := tx.Create(ref, h, "branch: Created from HEAD"); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to create branch %s: %w", branch, err)
+	}
+
+	if err := r.SetSymbolicRef("HEAD", ref); err != nil {
+		return err
+	}
+	return r.appendReflog("HEAD", h, h, fmt.Sprintf("checkout: moving from %s to %s", h.String(), branch))
+}
+
+// DetachedHEADWarning returns the warning to show after committing on a
+// detached HEAD, or "" when HEAD is on a branch
+func (r *Repository) DetachedHEADWarning() string {
+	h, err := r.DetachedHEAD()
+	if err != nil || h == nil {
+		return ""
+	}
+	return fmt.Sprintf("HEAD is detached at %s: commits made here are on no branch and can be lost when checking out something else; create a branch to keep them", shortHash(h))
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestDetachedHEAD tests checking out a revision detached, committing on
+// it and keeping the commit on a new branch
+func TestDetachedHEAD(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "one", "two")
+
+	if h, err := repo.DetachedHEAD(); err != nil || h != nil {
+		t.Fatalf("DetachedHEAD on a branch = %v, %v", h, err)
+	}
+	if warning := repo.DetachedHEADWarning(); warning != "" {
+		t.Errorf("unexpected warning on a branch: %q", warning)
+	}
+	if err := repo.AttachHEAD("topic"); err == nil {
+		t.Error("expected an error attaching HEAD that is on a branch")
+	}
+
+	if err := repo.Checkout("HEAD~1", DefaultCheckoutOptions()); err != nil {
+		t.Fatalf("Checkout HEAD~1 failed: %v", err)
+	}
+	expectHead(t, repo, commits[0], "one")
+	if h, err := repo.DetachedHEAD(); err != nil || !h.Equals(commits[0]) {
+		t.Errorf("DetachedHEAD = %v, %v, want the first commit", h, err)
+	}
+	if _, err := repo.CurrentBranch(); !errors.Is(err, ErrDetachedHEAD) {
+		t.Errorf("CurrentBranch = %v, want ErrDetachedHEAD", err)
+	}
+	if warning := repo.DetachedHEADWarning(); !strings.Contains(warning, shortHash(commits[0])) {
+		t.Errorf("warning = %q, want it to name the commit", warning)
+	}
+
+	// Committing moves the detached HEAD and leaves main alone
+	detached := commitTestTree(t, repo, "three", map[string]string{"file.txt": "three"}, commits[0])
+	if err := repo.UpdateHEAD(detached, "commit: three"); err != nil {
+		t.Fatalf("UpdateHEAD failed: %v", err)
+	}
+	if h, err := repo.DetachedHEAD(); err != nil || !h.Equals(detached) {
+		t.Errorf("DetachedHEAD after commit = %v, %v", h, err)
+	}
+	if h, err := repo.GetBranch("main"); err != nil || !h.Equals(commits[1]) {
+		t.Errorf("main = %v, %v, want the second commit", h, err)
+	}
+
+	if err := repo.AttachHEAD("main"); err == nil {
+		t.Error("expected an error attaching HEAD to an existing branch")
+	}
+	if err := repo.AttachHEAD("topic"); err != nil {
+		t.Fatalf("AttachHEAD failed: %v", err)
+	}
+	if branch, err := repo.CurrentBranch(); err != nil || branch != "topic" {
+		t.Errorf("CurrentBranch = %q, %v, want topic", branch, err)
+	}
+	if h, err := repo.GetBranch("topic"); err != nil || !h.Equals(detached) {
+		t.Errorf("topic = %v, %v, want the detached commit", h, err)
+	}
+
+	// A branch named as a full ref stays attached
+	if err := repo.Checkout("refs/heads/main", CheckoutOptions{Force: true}); err != nil {
+		t.Fatalf("Checkout refs/heads/main failed: %v", err)
+	}
+	if branch, err := repo.CurrentBranch(); err != nil || branch != "main" {
+		t.Errorf("CurrentBranch = %q, %v, want main", branch, err)
+	}
+	if err := repo.Checkout("main", CheckoutOptions{Detach: true}); err != nil {
+		t.Fatalf("Checkout --detach failed: %v", err)
+	}
+	if h, err := repo.DetachedHEAD(); err != nil || !h.Equals(commits[1]) {
+		t.Errorf("DetachedHEAD after --detach = %v, %v", h, err)
+	}
+}
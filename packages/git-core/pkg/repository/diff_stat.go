@@ -0,0 +1,297 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// DiffStatOptions contains options for NewDiffStat
+type DiffStatOptions struct {
+	// Width is the width of the stat lines, like git diff --stat=<width>
+	Width int
+	// NameWidth limits the width of file names (0 for no limit)
+	NameWidth int
+	// GraphWidth limits the width of the +/- graph (0 for no limit)
+	GraphWidth int
+}
+
+// DefaultDiffStatOptions returns default diffstat options
+func DefaultDiffStatOptions() DiffStatOptions {
+	return DiffStatOptions{
+		Width:      80,
+		NameWidth:  0,
+		GraphWidth: 0,
+	}
+}
+
+// FileStat is one file of a diffstat
+type FileStat struct {
+	Path string
+	// OldPath is the path a file was renamed or copied from ("" for other
+	// changes)
+	OldPath string
+	// Name is the name shown in the stat: renames are written as
+	// "dir/{old => new}", and long names are shortened to "...rest"
+	Name       string
+	Insertions int
+	Deletions  int
+	// Binary files have sizes instead of line counts
+	Binary  bool
+	OldSize int
+	NewSize int
+	// Plus and Minus are the numbers of + and - characters in the file's
+	// graph, scaled to fit the width
+	Plus  int
+	Minus int
+}
+
+// DiffStat summarizes the line changes of a diff, like git diff --stat
+type DiffStat struct {
+	Files      []FileStat
+	Insertions int
+	Deletions  int
+
+	// nameWidth and numberWidth are the column widths of String
+	nameWidth   int
+	numberWidth int
+}
+
+// NewDiffStat summarizes file diffs, which need their hunks
+// (DiffOptions.Hunks). The graph is laid out the way git diff --stat lays
+// it out in the given width.
+func NewDiffStat(files []FileDiff, opts DiffStatOptions) *DiffStat {
+	stat := &DiffStat{Files: make([]FileStat, len(files))}
+
+	maxLen, maxChange, binWidth := 0, 0, 0
+	for i, file := range files {
+		name := file.Path
+		if file.OldPath != "" {
+			name = renameName(file.OldPath, file.Path)
+		}
+		stat.Files[i] = FileStat{
+			Path:       file.Path,
+			OldPath:    file.OldPath,
+			Name:       name,
+			Insertions: file.Insertions,
+			Deletions:  file.Deletions,
+			Binary:     file.Binary,
+			OldSize:    file.OldSize,
+			NewSize:    file.NewSize,
+		}
+		if n := utf8.RuneCountInString(name); n > maxLen {
+			maxLen = n
+		}
+		if file.Binary {
+			// "Bin XXX -> YYY bytes"
+			if w := 14 + len(fmt.Sprint(file.OldSize)) + len(fmt.Sprint(file.NewSize)); w > binWidth {
+				binWidth = w
+			}
+			stat.numberWidth = 3
+			continue
+		}
+		stat.Insertions += file.Insertions
+		stat.Deletions += file.Deletions
+		if n := file.Insertions + file.Deletions; n > maxChange {
+			maxChange = n
+		}
+	}
+	if n := len(fmt.Sprint(maxChange)); n > stat.numberWidth {
+		stat.numberWidth = n
+	}
+
+	// Give the names and the graph the width they want, then shrink them
+	// to fit, as git's show_stats does
+	width := opts.Width
+	if width < 16+6+stat.numberWidth {
+		width = 16 + 6 + stat.numberWidth
+	}
+	graphWidth := maxChange
+	if maxChange+4 <= binWidth {
+		graphWidth = binWidth - 4
+	}
+	if opts.GraphWidth > 0 && opts.GraphWidth < graphWidth {
+		graphWidth = opts.GraphWidth
+	}
+	nameWidth := maxLen
+	if opts.NameWidth > 0 && opts.NameWidth < maxLen {
+		nameWidth = opts.NameWidth
+	}
+	if nameWidth+stat.numberWidth+6+graphWidth > width {
+		if graphWidth > width*3/8-stat.numberWidth-6 {
+			graphWidth = width*3/8 - stat.numberWidth - 6
+			if graphWidth < 6 {
+				graphWidth = 6
+			}
+		}
+		if opts.GraphWidth > 0 && graphWidth > opts.GraphWidth {
+			graphWidth = opts.GraphWidth
+		}
+		if nameWidth > width-stat.numberWidth-6-graphWidth {
+			nameWidth = width - stat.numberWidth - 6 - graphWidth
+		} else {
+			graphWidth = width - stat.numberWidth - 6 - nameWidth
+		}
+	}
+	stat.nameWidth = nameWidth
+
+	for i := range stat.Files {
+		file := &stat.Files[i]
+		file.Name = truncateStatName(file.Name, nameWidth)
+		if file.Binary {
+			continue
+		}
+		file.Plus, file.Minus = file.Insertions, file.Deletions
+		if graphWidth <= maxChange {
+			total := scaleStat(file.Insertions+file.Deletions, graphWidth, maxChange)
+			if total < 2 && file.Insertions > 0 && file.Deletions > 0 {
+				total = 2
+			}
+			if file.Insertions < file.Deletions {
+				file.Plus = scaleStat(file.Insertions, graphWidth, maxChange)
+				file.Minus = total - file.Plus
+			} else {
+				file.Minus = scaleStat(file.Deletions, graphWidth, maxChange)
+				file.Plus = total - file.Minus
+			}
+		}
+	}
+	return stat
+}
+
+// String formats the stat like git diff --stat, ending with the summary
+// line
+func (s *DiffStat) String() string {
+	var b strings.Builder
+	for _, file := range s.Files {
+		padding := s.nameWidth - utf8.RuneCountInString(file.Name)
+		if padding < 0 {
+			padding = 0
+		}
+		fmt.Fprintf(&b, " %s%s |", file.Name, strings.Repeat(" ", padding))
+		if file.Binary {
+			fmt.Fprintf(&b, " %*s", s.numberWidth, "Bin")
+			if file.OldSize != 0 || file.NewSize != 0 {
+				fmt.Fprintf(&b, " %d -> %d bytes", file.OldSize, file.NewSize)
+			}
+			b.WriteString("\n")
+			continue
+		}
+		fmt.Fprintf(&b, " %*d", s.numberWidth, file.Insertions+file.Deletions)
+		if file.Insertions+file.Deletions > 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString(strings.Repeat("+", file.Plus) + strings.Repeat("-", file.Minus) + "\n")
+	}
+	b.WriteString(s.Summary() + "\n")
+	return b.String()
+}
+
+// Numstat formats the stat like git diff --numstat, with "-" for the
+// counts of binary files
+func (s *DiffStat) Numstat() string {
+	var b strings.Builder
+	for _, file := range s.Files {
+		name := file.Path
+		if file.OldPath != "" {
+			name = renameName(file.OldPath, file.Path)
+		}
+		if file.Binary {
+			fmt.Fprintf(&b, "-\t-\t%s\n", name)
+		} else {
+			fmt.Fprintf(&b, "%d\t%d\t%s\n", file.Insertions, file.Deletions, name)
+		}
+	}
+	return b.String()
+}
+
+// Summary returns the totals line of the stat, such as " 2 files changed,
+// 3 insertions(+), 1 deletion(-)"
+func (s *DiffStat) Summary() string {
+	if len(s.Files) == 0 {
+		return " 0 files changed"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, " %d file%s changed", len(s.Files), plural(len(s.Files)))
+	if s.Insertions > 0 || s.Deletions == 0 {
+		fmt.Fprintf(&b, ", %d insertion%s(+)", s.Insertions, plural(s.Insertions))
+	}
+	if s.Deletions > 0 || s.Insertions == 0 {
+		fmt.Fprintf(&b, ", %d deletion%s(-)", s.Deletions, plural(s.Deletions))
+	}
+	return b.String()
+}
+
+// scaleStat scales a count to a graph of width columns for the largest
+// count maxChange, keeping at least one column for any change
+func scaleStat(n, width, maxChange int) int {
+	if n == 0 {
+		return 0
+	}
+	return 1 + n*(width-1)/maxChange
+}
+
+// renameName writes a rename as git's stat does, with the common leading
+// directories and trailing part outside braces: "dir/{old => new}.txt"
+func renameName(oldPath, newPath string) string {
+	prefix := 0
+	for i := 0; i < len(oldPath) && i < len(newPath) && oldPath[i] == newPath[i]; i++ {
+		if oldPath[i] == '/' {
+			prefix = i + 1
+		}
+	}
+
+	// With a common prefix the suffix may reach back to its slash
+	adjust := 0
+	if prefix > 0 {
+		adjust = 1
+	}
+	suffix := 0
+	for i, j := len(oldPath), len(newPath); i >= prefix-adjust && j >= prefix-adjust; i, j = i-1, j-1 {
+		// Positions one past the end compare as the terminating NUL
+		var a, b byte
+		if i < len(oldPath) {
+			a = oldPath[i]
+		}
+		if j < len(newPath) {
+			b = newPath[j]
+		}
+		if a != b {
+			break
+		}
+		if a == '/' {
+			suffix = len(oldPath) - i
+		}
+	}
+
+	oldMid := len(oldPath) - prefix - suffix
+	newMid := len(newPath) - prefix - suffix
+	if oldMid < 0 {
+		oldMid = 0
+	}
+	if newMid < 0 {
+		newMid = 0
+	}
+	if prefix+suffix == 0 {
+		return oldPath + " => " + newPath
+	}
+	return oldPath[:prefix] + "{" + oldPath[prefix:prefix+oldMid] + " => " + newPath[prefix:prefix+newMid] + "}" + oldPath[len(oldPath)-suffix:]
+}
+
+// truncateStatName shortens a name wider than width to "..." and its end,
+// starting at a slash when there is one
+func truncateStatName(name string, width int) string {
+	if utf8.RuneCountInString(name) <= width {
+		return name
+	}
+	keep := width - 3
+	if keep < 0 {
+		keep = 0
+	}
+	runes := []rune(name)
+	rest := string(runes[len(runes)-keep:])
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		rest = rest[i:]
+	}
+	return "..." + rest
+}
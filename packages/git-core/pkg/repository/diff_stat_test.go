@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The expected output is what git diff --stat and --numstat print for the
+// same trees
+func TestDiffStat(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	longPath := "very/long/directory/name/that/keeps/going/and/going/file_with_a_long_name.txt"
+	var evens strings.Builder
+	for i := 2; i <= 600; i += 2 {
+		evens.WriteString(strconv.Itoa(i) + "\n")
+	}
+	oldTree := writeTestTree(t, repo, map[string]string{
+		"a/b":             seqLines(30),
+		"big.txt":         seqLines(300),
+		"dir/sub/old.txt": seqLines(50),
+		"img.bin":         "a\x00b",
+		"small":           "x\n",
+		longPath:          seqLines(10),
+	})
+	newTree := writeTestTree(t, repo, map[string]string{
+		"a/c/b":           seqLines(30),
+		"big.txt":         evens.String(),
+		"dir/sub/new.txt": seqLines(51),
+		"img.bin":         "a\x00bcdef",
+		"small":           "y\n",
+		longPath:          seqLines(12),
+	})
+	opts := DefaultDiffOptions()
+	opts.Hunks = true
+	files, err := repo.DiffTrees(oldTree, newTree, opts)
+	if err != nil {
+		t.Fatalf("DiffTrees failed: %v", err)
+	}
+
+	stat := NewDiffStat(files, DefaultDiffStatOptions())
+	expected := " a/{ => c}/b                                        |   0\n" +
+		" big.txt                                            | 300 ++++++++++-----------\n" +
+		" dir/sub/{old.txt => new.txt}                       |   1 +\n" +
+		" img.bin                                            | Bin 3 -> 7 bytes\n" +
+		" small                                              |   2 +-\n" +
+		" .../going/and/going/file_with_a_long_name.txt      |   2 +\n" +
+		" 6 files changed, 154 insertions(+), 151 deletions(-)\n"
+	if got := stat.String(); got != expected {
+		t.Errorf("Stat =\n%s\nexpected\n%s", got, expected)
+	}
+	if stat.Insertions != 154 || stat.Deletions != 151 || stat.Files[1].Plus != 10 || stat.Files[1].Minus != 11 {
+		t.Errorf("Unexpected totals or graph: %+v", stat)
+	}
+
+	expected = "0\t0\ta/{ => c}/b\n" +
+		"150\t150\tbig.txt\n" +
+		"1\t0\tdir/sub/{old.txt => new.txt}\n" +
+		"-\t-\timg.bin\n" +
+		"1\t1\tsmall\n" +
+		"2\t0\t" + longPath + "\n"
+	if got := stat.Numstat(); got != expected {
+		t.Errorf("Numstat =\n%s\nexpected\n%s", got, expected)
+	}
+
+	// A narrower graph leaves more room for names
+	statOpts := DefaultDiffStatOptions()
+	statOpts.GraphWidth = 10
+	expected = " a/{ => c}/b                                                   |   0\n" +
+		" big.txt                                                       | 300 +++++-----\n"
+	if got := NewDiffStat(files, statOpts).String(); !strings.HasPrefix(got, expected) ||
+		!strings.Contains(got, " .../name/that/keeps/going/and/going/file_with_a_long_name.txt |   2 +\n") {
+		t.Errorf("Stat with a graph width of 10 =\n%s", got)
+	}
+
+	if got := NewDiffStat(nil, DefaultDiffStatOptions()).String(); got != " 0 files changed\n" {
+		t.Errorf("Unexpected empty stat %q", got)
+	}
+}
+
+func TestRenameName(t *testing.T) {
+	tests := []struct{ old, new, want string }{
+		{"a/b", "a/c/b", "a/{ => c}/b"},
+		{"dir/sub/old.txt", "dir/sub/new.txt", "dir/sub/{old.txt => new.txt}"},
+		{"old", "new", "old => new"},
+		{"src/x/file.go", "lib/x/file.go", "{src => lib}/x/file.go"},
+	}
+	for _, tt := range tests {
+		if got := renameName(tt.old, tt.new); got != tt.want {
+			t.Errorf("renameName(%q, %q) = %q, want %q", tt.old, tt.new, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,506 @@
+package repository
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/diff"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// Rename scores are out of maxRenameScore, as in Git
+const maxRenameScore = 60000
+
+// renameCandidatesPerFile is how many deleted files are kept as possible
+// sources of each added file
+const renameCandidatesPerFile = 4
+
+// DiffOptions contains options for DiffTrees and the work tree and index
+// diffs
+type DiffOptions struct {
+	// Renames pairs deleted files with added files of similar content,
+	// like git diff -M
+	Renames bool
+	// RenameThreshold is the similarity, in percent, a deleted and an added
+	// file need to be reported as a rename
+	RenameThreshold int
+	// RenameLimit skips looking for inexact renames when there are more
+	// than RenameLimit squared pairs of deleted and added files, like
+	// diff.renameLimit. Exact renames are always found. Zero means no limit.
+	RenameLimit int
+	// Copies also pairs added files with modified files whose old content
+	// they were copied from, like git diff -C. It implies Renames.
+	Copies bool
+	// CopiesHarder also looks for copies of unmodified files, like git
+	// diff --find-copies-harder. It implies Copies.
+	CopiesHarder bool
+	// CopyThreshold is the similarity, in percent, an added file needs
+	// with a file that still exists to be reported as a copy of it
+	CopyThreshold int
+	// Hunks attaches line hunks and counts to each entry
+	Hunks bool
+	// BinaryPatches makes the patches of changed binary files carry their
+	// content as Git binary patches that Am can apply, like git diff
+	// --binary, instead of only saying that they differ. It needs Hunks.
+	BinaryPatches bool
+	// LineDiff are the line diff options used for hunks
+	LineDiff diff.Options
+}
+
+// DefaultDiffOptions returns default diff options
+func DefaultDiffOptions() DiffOptions {
+	return DiffOptions{
+		Renames:         true,
+		RenameThreshold: 50,
+		RenameLimit:     1000,
+		Copies:          false,
+		CopiesHarder:    false,
+		CopyThreshold:   50,
+		Hunks:           false,
+		BinaryPatches:   false,
+		LineDiff:        diff.DefaultOptions(),
+	}
+}
+
+// DiffTrees returns the files that differ between two trees, like git
+// diff-tree -r. a and b may be trees or anything that peels to one, such
+// as a commit; nil stands for the empty tree. Entries are sorted by path,
+// renames by their new path.
+func (r *Repository) DiffTrees(a, b hash.Hash, opts DiffOptions) ([]FileDiff, error) {
+	treeHash := func(h hash.Hash) (hash.Hash, error) {
+		if h == nil {
+			return nil, nil
+		}
+		tree, _, err := r.peelToTree(h)
+		if err != nil {
+			return nil, err
+		}
+		return tree.Hash(), nil
+	}
+	oldTree, err := treeHash(a)
+	if err != nil {
+		return nil, err
+	}
+	newTree, err := treeHash(b)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []FileDiff{}
+	if err := r.diffTreeEntries(oldTree, newTree, "", &files); err != nil {
+		return nil, err
+	}
+
+	// Unmodified files are only needed as copy sources
+	oldFiles := make(map[string]treeFile)
+	if opts.CopiesHarder && oldTree != nil {
+		tree, _, err := r.peelToTree(oldTree)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.collectTreeFiles(tree, "", oldFiles); err != nil {
+			return nil, err
+		}
+	}
+
+	return finishDiff(files, oldFiles, opts, r.readBlobContent)
+}
+
+// blobReader returns the content of a blob
+type blobReader func(h hash.Hash) ([]byte, error)
+
+// finishDiff pairs renames and copies, sorts the files by path and
+// attaches hunks as opts ask, reading file content with read. oldFiles are
+// the files on the old side, which CopiesHarder looks at for copy sources;
+// it may be nil otherwise.
+func finishDiff(files []FileDiff, oldFiles map[string]treeFile, opts DiffOptions, read blobReader) ([]FileDiff, error) {
+	// Renames and copies take the place of their added file, so the
+	// order holds
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	var err error
+	if opts.Renames || opts.Copies || opts.CopiesHarder {
+		files, err = detectRenames(files, oldFiles, opts, read)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Hunks {
+		for i := range files {
+			if err := diffFile(&files[i], opts, read); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// diffTreeEntries appends the files that differ between two trees under
+// prefix, skipping subtrees that are the same in both. A nil hash is an
+// empty tree.
+func (r *Repository) diffTreeEntries(oldHash, newHash hash.Hash, prefix string, files *[]FileDiff) error {
+	oldEntries, err := r.treeEntriesByName(oldHash)
+	if err != nil {
+		return err
+	}
+	newEntries, err := r.treeEntriesByName(newHash)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(oldEntries)+len(newEntries))
+	for name := range oldEntries {
+		names = append(names, name)
+	}
+	for name := range newEntries {
+		if _, ok := oldEntries[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		filePath := name
+		if prefix != "" {
+			filePath = prefix + "/" + name
+		}
+		old, inOld := oldEntries[name]
+		entry, inNew := newEntries[name]
+		if inOld && inNew && old.Hash.Equals(entry.Hash) && old.Mode == entry.Mode {
+			continue
+		}
+
+		// A directory on either side is diffed against nothing or the
+		// other directory; a file is compared with the other side's file
+		var oldDir, newDir hash.Hash
+		oldFile, newFile := inOld, inNew
+		if inOld && old.Mode == object.ModeDir {
+			oldDir, oldFile = old.Hash, false
+		}
+		if inNew && entry.Mode == object.ModeDir {
+			newDir, newFile = entry.Hash, false
+		}
+		if oldDir != nil || newDir != nil {
+			if err := r.diffTreeEntries(oldDir, newDir, filePath, files); err != nil {
+				return err
+			}
+		}
+
+		file := FileDiff{Path: filePath}
+		switch {
+		case oldFile && newFile:
+			file.Change = ChangeModified
+		case oldFile:
+			file.Change = ChangeDeleted
+		case newFile:
+			file.Change = ChangeAdded
+		default:
+			continue
+		}
+		if oldFile {
+			file.OldHash, file.OldMode = old.Hash, old.Mode
+		}
+		if newFile {
+			file.NewHash, file.NewMode = entry.Hash, entry.Mode
+		}
+		*files = append(*files, file)
+	}
+	return nil
+}
+
+// treeEntriesByName loads a tree's entries keyed by name. A nil hash is an
+// empty tree.
+func (r *Repository) treeEntriesByName(h hash.Hash) (map[string]object.TreeEntry, error) {
+	entries := make(map[string]object.TreeEntry)
+	if h == nil {
+		return entries, nil
+	}
+	obj, err := r.ObjectDB.Get(h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tree %s: %w", shortHash(h), err)
+	}
+	tree, ok := obj.(*object.Tree)
+	if !ok {
+		return nil, fmt.Errorf("object %s is not a tree", shortHash(h))
+	}
+	for _, entry := range tree.Entries() {
+		entries[entry.Name] = entry
+	}
+	return entries, nil
+}
+
+// renameSource is a file that added files may have been renamed or
+// copied from
+type renameSource struct {
+	path string
+	hash hash.Hash
+	mode object.FileMode
+	// file is the source's index in the diff, or -1 for an unmodified file
+	file int
+	// deleted is set for deleted files, the only ones that can be renamed
+	deleted bool
+	// used counts the added files paired with the source
+	used int
+}
+
+// renameMatch is a possible rename or copy of a source to an added file
+type renameMatch struct {
+	src, dst int
+	score    int
+	// sameName is set when both files have the same base name
+	sameName bool
+}
+
+// detectRenames replaces deleted and added files that hold the same or
+// similar content with renames, and with copies when opts ask for them,
+// the way Git's diffcore-rename does: identical files are paired first,
+// then the best scoring pairs above the threshold. A deleted file paired
+// with several added files is renamed to the last of them and copied to
+// the others.
+func detectRenames(files []FileDiff, oldFiles map[string]treeFile, opts DiffOptions, read blobReader) ([]FileDiff, error) {
+	copies := opts.Copies || opts.CopiesHarder
+	var srcs []*renameSource
+	var dsts []int
+	changed := make(map[string]bool)
+	for i, file := range files {
+		changed[file.Path] = true
+		switch {
+		case file.Change == ChangeDeleted:
+			srcs = append(srcs, &renameSource{path: file.Path, hash: file.OldHash, mode: file.OldMode, file: i, deleted: true})
+		case file.Change == ChangeModified && copies:
+			srcs = append(srcs, &renameSource{path: file.Path, hash: file.OldHash, mode: file.OldMode, file: i})
+		case file.Change == ChangeAdded:
+			dsts = append(dsts, i)
+		}
+	}
+	if opts.CopiesHarder {
+		for p, file := range oldFiles {
+			if !changed[p] && file.mode != object.ModeGitlink {
+				srcs = append(srcs, &renameSource{path: p, hash: file.hash, mode: file.mode, file: -1})
+			}
+		}
+	}
+	if len(srcs) == 0 || len(dsts) == 0 {
+		return files, nil
+	}
+	sort.Slice(srcs, func(i, j int) bool {
+		return srcs[i].path < srcs[j].path
+	})
+
+	paired := make(map[int]*renameSource)
+	sameName := func(src, dst int) bool {
+		return path.Base(srcs[src].path) == path.Base(files[dst].Path)
+	}
+
+	// Exact matches, preferring an unused source with the same base name
+	bySrcHash := make(map[string][]int)
+	for i, src := range srcs {
+		key := src.hash.String()
+		bySrcHash[key] = append(bySrcHash[key], i)
+	}
+	for _, dst := range dsts {
+		best, bestScore := -1, -1
+		for _, i := range bySrcHash[files[dst].NewHash.String()] {
+			src := srcs[i]
+			if isRegularMode(src.mode) != isRegularMode(files[dst].NewMode) || src.used > 0 && !copies {
+				continue
+			}
+			score := 0
+			if src.used == 0 {
+				score++
+			}
+			if sameName(i, dst) {
+				score++
+			}
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best != -1 {
+			srcs[best].used++
+			paired[dst] = srcs[best]
+			files[dst].Similarity = 100
+		}
+	}
+
+	// Inexact matches between the remaining regular files. Renames pair
+	// each source once; copies may then reuse sources.
+	var leftSrcs, leftDsts []int
+	for i, src := range srcs {
+		if (src.used == 0 || copies) && isRegularMode(src.mode) {
+			leftSrcs = append(leftSrcs, i)
+		}
+	}
+	for _, dst := range dsts {
+		if _, ok := paired[dst]; !ok && isRegularMode(files[dst].NewMode) {
+			leftDsts = append(leftDsts, dst)
+		}
+	}
+	limit := opts.RenameLimit
+	if len(leftSrcs) > 0 && len(leftDsts) > 0 && (limit <= 0 || len(leftSrcs)*len(leftDsts) <= limit*limit) {
+		renameMin := opts.RenameThreshold * maxRenameScore / 100
+		copyMin := opts.CopyThreshold * maxRenameScore / 100
+		minScore := renameMin
+		if copies && copyMin < minScore {
+			minScore = copyMin
+		}
+
+		// Each file's size and chunks, keyed by source index or by the
+		// added file's index in files
+		srcSizes := make(map[int]int)
+		srcSpans := make(map[int]map[uint32]int)
+		for _, i := range leftSrcs {
+			content, err := read(srcs[i].hash)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", srcs[i].path, err)
+			}
+			srcSizes[i] = len(content)
+			srcSpans[i] = spanHashes(content)
+		}
+
+		matches := []renameMatch{}
+		for _, dst := range leftDsts {
+			content, err := read(files[dst].NewHash)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", files[dst].Path, err)
+			}
+			dstSpans := spanHashes(content)
+			candidates := []renameMatch{}
+			for _, i := range leftSrcs {
+				score := renameScore(srcSizes[i], len(content), srcSpans[i], dstSpans, minScore)
+				threshold := renameMin
+				if !srcs[i].deleted {
+					threshold = copyMin
+				}
+				if score >= threshold {
+					candidates = append(candidates, renameMatch{src: i, dst: dst, score: score, sameName: sameName(i, dst)})
+				}
+			}
+			sortRenameMatches(candidates)
+			if len(candidates) > renameCandidatesPerFile {
+				candidates = candidates[:renameCandidatesPerFile]
+			}
+			matches = append(matches, candidates...)
+		}
+
+		sortRenameMatches(matches)
+		pair := func(reuse bool) {
+			for _, match := range matches {
+				src := srcs[match.src]
+				if _, ok := paired[match.dst]; ok || src.used > 0 && !reuse {
+					continue
+				}
+				src.used++
+				paired[match.dst] = src
+				files[match.dst].Similarity = match.score * 100 / maxRenameScore
+			}
+		}
+		pair(false)
+		if copies {
+			pair(true)
+		}
+	}
+
+	renamed := make(map[int]bool)
+	for i := range files {
+		src, ok := paired[i]
+		if !ok {
+			continue
+		}
+		files[i].Change = ChangeCopied
+		if src.deleted {
+			src.used--
+			if src.used == 0 {
+				files[i].Change = ChangeRenamed
+				renamed[src.file] = true
+			}
+		}
+		files[i].OldPath = src.path
+		files[i].OldHash, files[i].OldMode = src.hash, src.mode
+	}
+
+	result := make([]FileDiff, 0, len(files))
+	for i, file := range files {
+		if !renamed[i] {
+			result = append(result, file)
+		}
+	}
+	return result, nil
+}
+
+// sortRenameMatches orders matches best first: by score, then matching
+// base names, then the order the files were found in
+func sortRenameMatches(matches []renameMatch) {
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		return a.sameName && !b.sameName
+	})
+}
+
+// renameScore estimates how much of a file of dstSize bytes was copied
+// from one of srcSize bytes, out of maxRenameScore, like Git's
+// estimate_similarity. Files whose sizes differ too much to reach minScore
+// score zero.
+func renameScore(srcSize, dstSize int, srcSpans, dstSpans map[uint32]int, minScore int) int {
+	maxSize, baseSize := srcSize, dstSize
+	if maxSize < baseSize {
+		maxSize, baseSize = baseSize, maxSize
+	}
+	if maxSize*(maxRenameScore-minScore) < (maxSize-baseSize)*maxRenameScore {
+		return 0
+	}
+	if dstSize == 0 {
+		return 0
+	}
+
+	copied := 0
+	for h, n := range srcSpans {
+		if m := dstSpans[h]; m < n {
+			copied += m
+		} else {
+			copied += n
+		}
+	}
+	return copied * maxRenameScore / maxSize
+}
+
+// spanHashes splits content into chunks that end at a newline or after 64
+// bytes and totals the chunk sizes by hash, as Git does to compare files.
+// CRs before LFs in text are ignored, and a final chunk without a newline
+// is not counted.
+func spanHashes(content []byte) map[uint32]int {
+	text := !isBinaryContent(content)
+	spans := make(map[uint32]int)
+	var accum1, accum2 uint32
+	n := 0
+	for i := 0; i < len(content); i++ {
+		c := uint32(content[i])
+		if text && c == '\r' && i+1 < len(content) && content[i+1] == '\n' {
+			continue
+		}
+		old1 := accum1
+		accum1 = accum1<<7 ^ accum2>>25
+		accum2 = accum2<<7 ^ old1>>25
+		accum1 += c
+		n++
+		if n < 64 && c != '\n' {
+			continue
+		}
+		spans[(accum1+accum2*0x61)%107927] += n
+		n = 0
+		accum1, accum2 = 0, 0
+	}
+	return spans
+}
+
+// isRegularMode reports whether a mode is a regular or executable file
+func isRegularMode(mode object.FileMode) bool {
+	return mode == object.ModeRegular || mode == object.ModeExecutable
+}
@@ -0,0 +1,319 @@
+package repository
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// writeTestTree stores a tree holding files, keyed by slash-separated
+// path, and returns its hash. Paths listed in executable get mode 100755.
+func writeTestTree(t *testing.T, repo *Repository, files map[string]string, executable ...string) hash.Hash {
+	t.Helper()
+
+	var write func(prefix string) hash.Hash
+	write = func(prefix string) hash.Hash {
+		tree := object.NewTree()
+		dirs := make(map[string]bool)
+		for p, content := range files {
+			if !strings.HasPrefix(p, prefix) {
+				continue
+			}
+			name := strings.TrimPrefix(p, prefix)
+			if i := strings.IndexByte(name, '/'); i >= 0 {
+				dirs[name[:i]] = true
+				continue
+			}
+			blobHash, err := repo.ObjectDB.Put(object.NewBlob([]byte(content)))
+			if err != nil {
+				t.Fatalf("Failed to store %s: %v", p, err)
+			}
+			mode := object.ModeRegular
+			for _, e := range executable {
+				if e == p {
+					mode = object.ModeExecutable
+				}
+			}
+			tree.AddEntryWithMode(mode, name, blobHash)
+		}
+		for dir := range dirs {
+			tree.AddEntryWithMode(object.ModeDir, dir, write(prefix+dir+"/"))
+		}
+		tree.Sort()
+		treeHash, err := repo.ObjectDB.Put(tree)
+		if err != nil {
+			t.Fatalf("Failed to store tree: %v", err)
+		}
+		return treeHash
+	}
+	return write("")
+}
+
+// seqLines returns the numbers from 1 to n, one per line, followed by extra
+func seqLines(n int, extra ...string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		b.WriteString(strconv.Itoa(i) + "\n")
+	}
+	for _, line := range extra {
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+// The expected results match git diff --raw on the same trees
+func TestDiffTrees(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	oldTree := writeTestTree(t, repo, map[string]string{
+		"a.txt":    seqLines(20),
+		"c":        seqLines(19, "new"),
+		"dir/gone": "g\n",
+		"dir/keep": "k\n",
+		"empty":    "",
+		"f2d":      "f\n",
+		"m":        "x\n",
+		"same/x":   "unchanged\n",
+	})
+	newTree := writeTestTree(t, repo, map[string]string{
+		"b.txt":     seqLines(20),
+		"d":         seqLines(18, "x", "y"),
+		"dir/keep":  "K\n",
+		"empty.new": "",
+		"f2d/inner": "i\n",
+		"same/x":    "unchanged\n",
+	}, "b.txt")
+
+	files, err := repo.DiffTrees(oldTree, newTree, DefaultDiffOptions())
+	if err != nil {
+		t.Fatalf("DiffTrees failed: %v", err)
+	}
+	var got []string
+	for _, file := range files {
+		entry := string(file.Change) + " " + file.Path
+		if file.Change == ChangeRenamed {
+			entry += " from " + file.OldPath + " " + strconv.Itoa(file.Similarity)
+		}
+		got = append(got, entry)
+	}
+	expected := []string{
+		"renamed b.txt from a.txt 100",
+		"renamed d from c 86",
+		"deleted dir/gone",
+		"modified dir/keep",
+		"renamed empty.new from empty 100",
+		"deleted f2d",
+		"added f2d/inner",
+		"deleted m",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Got:\n%s\nexpected:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+
+	if files[0].OldMode != object.ModeRegular || files[0].NewMode != object.ModeExecutable {
+		t.Errorf("Expected a mode change on the rename, got %o -> %o", files[0].OldMode, files[0].NewMode)
+	}
+	if len(files[1].Hunks) != 0 {
+		t.Error("Expected no hunks unless asked for")
+	}
+
+	// Without rename detection the moved files are deleted and added
+	opts := DefaultDiffOptions()
+	opts.Renames = false
+	opts.Hunks = true
+	files, err = repo.DiffTrees(oldTree, newTree, opts)
+	if err != nil {
+		t.Fatalf("DiffTrees failed: %v", err)
+	}
+	paths := []string{}
+	for _, file := range files {
+		if file.Change == ChangeRenamed {
+			t.Errorf("Unexpected rename of %s", file.Path)
+		}
+		paths = append(paths, file.Path)
+	}
+	if len(files) != 11 || !sort.StringsAreSorted(paths) {
+		t.Errorf("Unexpected files %v", paths)
+	}
+
+	// A higher threshold leaves the edited file unpaired
+	opts = DefaultDiffOptions()
+	opts.RenameThreshold = 90
+	files, err = repo.DiffTrees(oldTree, newTree, opts)
+	if err != nil {
+		t.Fatalf("DiffTrees failed: %v", err)
+	}
+	for _, file := range files {
+		if file.Path == "d" && file.Change != ChangeAdded {
+			t.Errorf("Expected d to be added at 90%%, got %s", file.Change)
+		}
+	}
+
+	// Diffing a tree against nothing lists every file
+	files, err = repo.DiffTrees(nil, oldTree, DefaultDiffOptions())
+	if err != nil {
+		t.Fatalf("DiffTrees failed: %v", err)
+	}
+	if len(files) != 8 || files[0].Change != ChangeAdded {
+		t.Errorf("Unexpected files %+v", files)
+	}
+}
+
+// The patch of a rename matches git diff
+func TestDiffTreesRenamePatch(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	oldTree := writeTestTree(t, repo, map[string]string{"c": seqLines(19, "new")})
+	newTree := writeTestTree(t, repo, map[string]string{"d": seqLines(18, "x", "y")})
+
+	opts := DefaultDiffOptions()
+	opts.Hunks = true
+	files, err := repo.DiffTrees(oldTree, newTree, opts)
+	if err != nil {
+		t.Fatalf("DiffTrees failed: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Expected one rename, got %+v", files)
+	}
+	file := files[0]
+	if file.Insertions != 2 || file.Deletions != 2 {
+		t.Errorf("Expected 2 insertions and deletions, got %d and %d", file.Insertions, file.Deletions)
+	}
+
+	expected := "diff --git a/c b/d\n" +
+		"similarity index 86%\n" +
+		"rename from c\n" +
+		"rename to d\n" +
+		"index 0d7d40e..a68014f 100644\n" +
+		"--- a/c\n" +
+		"+++ b/d\n" +
+		"@@ -16,5 +16,5 @@\n" +
+		" 16\n" +
+		" 17\n" +
+		" 18\n" +
+		"-19\n" +
+		"-new\n" +
+		"+x\n" +
+		"+y\n"
+	if patch := file.Patch(); patch != expected {
+		t.Errorf("Patch =\n%s\nexpected\n%s", patch, expected)
+	}
+}
+
+// The expected results match git diff-tree -r with -M, -C and
+// --find-copies-harder on the same trees
+func TestDiffTreesCopies(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	oldTree := writeTestTree(t, repo, map[string]string{
+		"a":    seqLines(20),
+		"b":    seqLines(30),
+		"gone": seqLines(15),
+		"u":    seqLines(40),
+	})
+	newTree := writeTestTree(t, repo, map[string]string{
+		"a":      seqLines(20),
+		"a.copy": seqLines(20),
+		"b":      seqLines(30, "x"),
+		"b2":     seqLines(29, "y"),
+		"g1":     seqLines(15),
+		"g2":     seqLines(15),
+		"u":      seqLines(40),
+		"u.copy": seqLines(39, "z"),
+	})
+
+	summary := func(opts DiffOptions) string {
+		t.Helper()
+		files, err := repo.DiffTrees(oldTree, newTree, opts)
+		if err != nil {
+			t.Fatalf("DiffTrees failed: %v", err)
+		}
+		entries := make([]string, len(files))
+		for i, file := range files {
+			entries[i] = string(file.Change) + " " + file.Path
+			if file.OldPath != "" {
+				entries[i] += " from " + file.OldPath + " " + strconv.Itoa(file.Similarity)
+			}
+		}
+		return strings.Join(entries, ", ")
+	}
+
+	if got, expected := summary(DefaultDiffOptions()), "added a.copy, modified b, added b2, renamed g1 from gone 100, added g2, added u.copy"; got != expected {
+		t.Errorf("Renames only:\n%s\nexpected\n%s", got, expected)
+	}
+
+	// A deleted file copied more than once is renamed to the last copy
+	opts := DefaultDiffOptions()
+	opts.Copies = true
+	if got, expected := summary(opts), "copied a.copy from gone 70, modified b, copied b2 from b 96, copied g1 from gone 100, renamed g2 from gone 100, copied u.copy from b 73"; got != expected {
+		t.Errorf("Copies:\n%s\nexpected\n%s", got, expected)
+	}
+
+	opts = DefaultDiffOptions()
+	opts.CopiesHarder = true
+	if got, expected := summary(opts), "copied a.copy from a 100, modified b, copied b2 from b 96, copied g1 from gone 100, renamed g2 from gone 100, copied u.copy from u 97"; got != expected {
+		t.Errorf("Copies harder:\n%s\nexpected\n%s", got, expected)
+	}
+
+	// A higher copy threshold leaves the weaker copies as added files
+	opts.CopyThreshold = 97
+	if got, expected := summary(opts), "copied a.copy from a 100, modified b, added b2, copied g1 from gone 100, renamed g2 from gone 100, copied u.copy from u 97"; got != expected {
+		t.Errorf("Copy threshold:\n%s\nexpected\n%s", got, expected)
+	}
+
+	opts = DefaultDiffOptions()
+	opts.Copies = true
+	opts.Hunks = true
+	files, err := repo.DiffTrees(oldTree, newTree, opts)
+	if err != nil {
+		t.Fatalf("DiffTrees failed: %v", err)
+	}
+	expected := "diff --git a/b b/b2\n" +
+		"similarity index 96%\n" +
+		"copy from b\n" +
+		"copy to b2\n" +
+		"index e8823e1..c0ed4c4 100644\n" +
+		"--- a/b\n" +
+		"+++ b/b2\n" +
+		"@@ -27,4 +27,4 @@\n" +
+		" 27\n" +
+		" 28\n" +
+		" 29\n" +
+		"-30\n" +
+		"+y\n"
+	if patch := files[2].Patch(); patch != expected {
+		t.Errorf("Patch =\n%s\nexpected\n%s", patch, expected)
+	}
+}
+
+func TestSpanHashes(t *testing.T) {
+	// CRLF and LF line endings hash the same in text
+	crlf := spanHashes([]byte("one\r\ntwo\r\n"))
+	lf := spanHashes([]byte("one\ntwo\n"))
+	if !reflect.DeepEqual(crlf, lf) {
+		t.Errorf("Expected CRLF chunks %v to match %v", crlf, lf)
+	}
+
+	// Long lines are split every 64 bytes, and a final partial chunk is
+	// not counted
+	total := 0
+	for _, n := range spanHashes([]byte(strings.Repeat("a", 150))) {
+		total += n
+	}
+	if total != 128 {
+		t.Errorf("Expected 128 bytes in chunks, got %d", total)
+	}
+}
@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// treeFile is a file's blob and mode in a tree, the index or the work tree
+type treeFile = struct {
+	hash hash.Hash
+	mode object.FileMode
+}
+
+// DiffHeadToIndex returns the changes staged for the next commit, like git
+// diff --cached. Before the first commit every staged file is added.
+// Files with merge conflicts are left out.
+func (r *Repository) DiffHeadToIndex(opts DiffOptions) ([]FileDiff, error) {
+	head, err := r.headFiles()
+	if err != nil {
+		return nil, err
+	}
+	idx, err := index.Load(filepath.Join(r.GitDir, "index"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	staged, conflicted := indexFiles(idx)
+	for path := range conflicted {
+		delete(head, path)
+	}
+
+	return finishDiff(diffFileMaps(head, staged), head, opts, r.readBlobContent)
+}
+
+// DiffIndexToWorktree returns the changes in the work tree that are not
+// staged, like git diff. Untracked files and files with merge conflicts
+// are left out.
+func (r *Repository) DiffIndexToWorktree(opts DiffOptions) ([]FileDiff, error) {
+	idx, err := index.Load(filepath.Join(r.GitDir, "index"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	staged, _ := indexFiles(idx)
+	worktree, read, err := r.worktreeFiles(idx)
+	if err != nil {
+		return nil, err
+	}
+
+	return finishDiff(diffFileMaps(staged, worktree), staged, opts, read)
+}
+
+// DiffHeadToWorktree returns the changes in the work tree since the last
+// commit, staged or not, like git diff HEAD. Only files in the index are
+// looked at, so untracked files are left out and files removed from the
+// index are deleted. Files with merge conflicts are left out.
+func (r *Repository) DiffHeadToWorktree(opts DiffOptions) ([]FileDiff, error) {
+	head, err := r.headFiles()
+	if err != nil {
+		return nil, err
+	}
+	idx, err := index.Load(filepath.Join(r.GitDir, "index"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	_, conflicted := indexFiles(idx)
+	for path := range conflicted {
+		delete(head, path)
+	}
+	worktree, read, err := r.worktreeFiles(idx)
+	if err != nil {
+		return nil, err
+	}
+
+	return finishDiff(diffFileMaps(head, worktree), head, opts, read)
+}
+
+// headFiles returns the files of HEAD's tree, or none before the first
+// commit
+func (r *Repository) headFiles() (map[string]treeFile, error) {
+	files := make(map[string]treeFile)
+	head, err := r.ResolveHEAD()
+	if err != nil {
+		return files, nil
+	}
+	tree, _, err := r.peelToTree(head)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load HEAD tree: %w", err)
+	}
+	if err := r.collectTreeFiles(tree, "", files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// indexFiles returns the merged files of the index, and the paths that
+// have conflict stages instead
+func indexFiles(idx *index.Index) (map[string]treeFile, map[string]bool) {
+	files := make(map[string]treeFile)
+	conflicted := make(map[string]bool)
+	for _, entry := range idx.Entries {
+		if entry.StageFlag != 0 {
+			conflicted[entry.Path] = true
+			continue
+		}
+		files[entry.Path] = treeFile{hash: entry.Hash, mode: object.FileMode(entry.Mode)}
+	}
+	return files, conflicted
+}
+
+// worktreeFiles returns the work tree version of each merged index entry,
+// leaving out the ones that were deleted, along with a reader for the
+// content of the files that differ from their index entry. Submodules are
+// not inspected, and files outside the sparse-checkout cone keep their
+// index version.
+func (r *Repository) worktreeFiles(idx *index.Index) (map[string]treeFile, blobReader, error) {
+	sparse, err := r.SparseCheckout()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load sparse-checkout: %w", err)
+	}
+
+	workTree := r.WorkTree()
+	files := make(map[string]treeFile)
+	contents := make(map[string][]byte)
+	for _, entry := range idx.Entries {
+		if entry.StageFlag != 0 {
+			continue
+		}
+		indexed := treeFile{hash: entry.Hash, mode: object.FileMode(entry.Mode)}
+		if entry.Mode == index.FileModeGitlink {
+			files[entry.Path] = indexed
+			continue
+		}
+
+		fullPath := filepath.Join(workTree, filepath.FromSlash(entry.Path))
+		info, err := os.Lstat(fullPath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("failed to stat %s: %w", entry.Path, err)
+		}
+		if err != nil || info.IsDir() {
+			if sparse != nil && !sparse.Includes(entry.Path) {
+				files[entry.Path] = indexed
+			}
+			continue
+		}
+
+		mode := object.ModeRegular
+		if info.Mode()&os.ModeSymlink != 0 {
+			mode = object.ModeSymlink
+		} else if info.Mode()&0111 != 0 {
+			mode = object.ModeExecutable
+		}
+		if mode == indexed.mode {
+			if modified, err := entry.IsModified(workTree); err == nil && !modified {
+				files[entry.Path] = indexed
+				continue
+			}
+		}
+
+		// Symlinks are stored as blobs containing the link target
+		var content []byte
+		if mode == object.ModeSymlink {
+			target, err := os.Readlink(fullPath)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read symlink %s: %w", entry.Path, err)
+			}
+			content = []byte(target)
+		} else {
+			content, err = os.ReadFile(fullPath)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read %s: %w", entry.Path, err)
+			}
+		}
+		h := hash.HashBlob(r.Hasher, content)
+		contents[h.String()] = content
+		files[entry.Path] = treeFile{hash: h, mode: mode}
+	}
+
+	read := func(h hash.Hash) ([]byte, error) {
+		if content, ok := contents[h.String()]; ok {
+			return content, nil
+		}
+		return r.readBlobContent(h)
+	}
+	return files, read, nil
+}
+
+// diffFileMaps returns the files that were added, deleted or modified
+// between two sets of files
+func diffFileMaps(oldFiles, newFiles map[string]treeFile) []FileDiff {
+	files := []FileDiff{}
+	for path, old := range oldFiles {
+		file := FileDiff{Path: path, OldHash: old.hash, OldMode: old.mode}
+		if current, ok := newFiles[path]; !ok {
+			file.Change = ChangeDeleted
+		} else if !current.hash.Equals(old.hash) || current.mode != old.mode {
+			file.Change = ChangeModified
+			file.NewHash, file.NewMode = current.hash, current.mode
+		} else {
+			continue
+		}
+		files = append(files, file)
+	}
+	for path, current := range newFiles {
+		if _, ok := oldFiles[path]; !ok {
+			files = append(files, FileDiff{Path: path, Change: ChangeAdded, NewHash: current.hash, NewMode: current.mode})
+		}
+	}
+	return files
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// diffSummary lists each file diff as "change path"
+func diffSummary(files []FileDiff) string {
+	entries := make([]string, len(files))
+	for i, file := range files {
+		entries[i] = string(file.Change) + " " + file.Path
+	}
+	return strings.Join(entries, ", ")
+}
+
+func TestDiffWorktreeAndIndex(t *testing.T) {
+	repo, _ := setupUndoRepo(t, "one\ntwo\n")
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repo.Path, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(repo.Path, "gone.txt"), []byte("gone\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := addFile(repo, "gone.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createCommit(repo, "Add gone.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stage one change to file.txt and a new file, then change file.txt
+	// again and delete gone.txt without staging either
+	write("file.txt", "one\nTWO\n")
+	write("new.txt", "new\n")
+	for _, path := range []string{"file.txt", "new.txt"} {
+		if err := addFile(repo, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("file.txt", "one\nTWO\nthree\n")
+	write("untracked.txt", "untracked\n")
+	if err := os.Remove(filepath.Join(repo.Path, "gone.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultDiffOptions()
+	opts.Hunks = true
+
+	staged, err := repo.DiffHeadToIndex(opts)
+	if err != nil {
+		t.Fatalf("DiffHeadToIndex failed: %v", err)
+	}
+	if got := diffSummary(staged); got != "modified file.txt, added new.txt" {
+		t.Errorf("Unexpected staged changes: %s", got)
+	}
+	expected := "diff --git a/file.txt b/file.txt\n" +
+		"index 814f4a4..879de50 100644\n" +
+		"--- a/file.txt\n" +
+		"+++ b/file.txt\n" +
+		"@@ -1,2 +1,2 @@\n" +
+		" one\n" +
+		"-two\n" +
+		"+TWO\n"
+	if patch := staged[0].Patch(); patch != expected {
+		t.Errorf("Staged patch =\n%s\nexpected\n%s", patch, expected)
+	}
+
+	unstaged, err := repo.DiffIndexToWorktree(opts)
+	if err != nil {
+		t.Fatalf("DiffIndexToWorktree failed: %v", err)
+	}
+	if got := diffSummary(unstaged); got != "modified file.txt, deleted gone.txt" {
+		t.Errorf("Unexpected unstaged changes: %s", got)
+	}
+	if hunk := unstaged[0].Hunks[0]; hunk.Header() != "@@ -1,2 +1,3 @@" || unstaged[0].Insertions != 1 {
+		t.Errorf("Unexpected unstaged hunk %s %v", hunk.Header(), hunk.Lines)
+	}
+	if unstaged[0].NewHash.String() != "ddc897f039f57aa91e16efa6dfde386c4255206f" {
+		t.Errorf("Expected the work tree blob hash, got %s", unstaged[0].NewHash)
+	}
+
+	all, err := repo.DiffHeadToWorktree(opts)
+	if err != nil {
+		t.Fatalf("DiffHeadToWorktree failed: %v", err)
+	}
+	if got := diffSummary(all); got != "modified file.txt, deleted gone.txt, added new.txt" {
+		t.Errorf("Unexpected changes since HEAD: %s", got)
+	}
+	if all[0].Insertions != 2 || all[0].Deletions != 1 {
+		t.Errorf("Expected +2 -1 for file.txt, got +%d -%d", all[0].Insertions, all[0].Deletions)
+	}
+
+	// Staging the deletion and the file under a new name is a rename
+	write("moved.txt", "gone\n")
+	if err := addFile(repo, "moved.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Remove([]string{"gone.txt"}, RemoveOptions{Cached: true}); err != nil {
+		t.Fatal(err)
+	}
+	staged, err = repo.DiffHeadToIndex(DefaultDiffOptions())
+	if err != nil {
+		t.Fatalf("DiffHeadToIndex failed: %v", err)
+	}
+	if got := diffSummary(staged); got != "modified file.txt, renamed moved.txt, added new.txt" {
+		t.Errorf("Unexpected staged changes after the move: %s", got)
+	}
+}
+
+func TestDiffIndexToWorktreeClean(t *testing.T) {
+	repo, _ := setupUndoRepo(t, "one\n", "two\n")
+
+	files, err := repo.DiffIndexToWorktree(DefaultDiffOptions())
+	if err != nil {
+		t.Fatalf("DiffIndexToWorktree failed: %v", err)
+	}
+	if len(files) != 0 {
+		t.Errorf("Expected no changes, got %s", diffSummary(files))
+	}
+
+	// A mode change alone has no hunks
+	if err := os.Chmod(filepath.Join(repo.Path, "file.txt"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultDiffOptions()
+	opts.Hunks = true
+	files, err = repo.DiffHeadToWorktree(opts)
+	if err != nil {
+		t.Fatalf("DiffHeadToWorktree failed: %v", err)
+	}
+	if len(files) != 1 || files[0].Change != ChangeModified || len(files[0].Hunks) != 0 {
+		t.Fatalf("Expected a mode change, got %+v", files)
+	}
+	expected := "diff --git a/file.txt b/file.txt\nold mode 100644\nnew mode 100755\n"
+	if patch := files[0].Patch(); patch != expected {
+		t.Errorf("Patch =\n%s\nexpected\n%s", patch, expected)
+	}
+}
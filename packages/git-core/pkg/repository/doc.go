@@ -0,0 +1,32 @@
+// Package repository is the high-level API for working with Git
+// repositories: creating, opening and cloning them, and the porcelain
+// operations built on the object, index and protocol packages.
+//
+// Open a repository with [Open], or create one with [Init] or [Create]:
+//
+//	repo, err := repository.Open("/path/to/work/tree")
+//	entries, err := repo.Log("", repository.DefaultLogOptions())
+//
+// Operations that take options follow one pattern: an XxxOptions struct
+// with a DefaultXxxOptions constructor, so new fields can be added without
+// breaking callers that start from the defaults.
+//
+// # Stability
+//
+// The following are frozen: they keep their names and signatures for all
+// v0.x and v1 releases. Options structs may gain fields. Everything else,
+// including all unlisted Repository methods, may change in a minor release.
+//
+//   - [Repository] and its Path, GitDir, Config, Hasher and ObjectDB fields
+//   - [Init], [Create], [Open], [IsRepository] and [FindRepository]
+//   - [Clone], [CloneOptions] and [DefaultCloneOptions]
+//   - [InitOptions] and [DefaultInitOptions]
+//   - the HEAD, ResolveHEAD, ResolveRef, ResolveRevision, UpdateRef,
+//     CurrentBranch, ListBranches, GetBranch, CreateBranch and DeleteBranch
+//     methods of [Repository]
+//   - the Checkout, Log, GetCommit, Show and ShowFile methods of
+//     [Repository] with their options and result types
+//
+// Fetch, Pull and Push are experimental while their result types grow to
+// report per-ref outcomes.
+package repository
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// EventType identifies a repository lifecycle event
+type EventType string
+
+const (
+	// EventStorageEvicted is published when the storage backend dropped objects
+	EventStorageEvicted EventType = "storage-evicted"
+
+	// EventCorruptionDetected is published when stored data failed validation
+	EventCorruptionDetected EventType = "corruption-detected"
+
+	// EventFsckScheduled is published when a verification pass is queued
+	EventFsckScheduled EventType = "fsck-scheduled"
+
+	// EventFsckCompleted is published when a verification pass finishes
+	EventFsckCompleted EventType = "fsck-completed"
+)
+
+// Event is a notification published on the repository event bus
+type Event struct {
+	// Type is the kind of event
+	Type EventType
+
+	// GitDir identifies the repository the event belongs to
+	GitDir string
+
+	// Objects lists the affected objects, if known
+	Objects []hash.Hash
+
+	// Message is a human-readable description
+	Message string
+
+	// Fsck is the verification result for EventFsckCompleted
+	Fsck *FsckReport
+}
+
+// EventHandler receives events from an EventBus
+type EventHandler func(Event)
+
+// EventBus dispatches repository events to subscribers
+type EventBus struct {
+	mu       sync.RWMutex
+	handlers map[int]EventHandler
+	nextID   int
+}
+
+// DefaultEventBus is shared by all opened repositories so that subscriptions
+// outlive individual Repository values
+var DefaultEventBus = NewEventBus()
+
+// NewEventBus creates an empty event bus
+func NewEventBus() *EventBus {
+	return &EventBus{
+		handlers: make(map[int]EventHandler),
+	}
+}
+
+// Subscribe registers a handler and returns an ID for Unsubscribe
+func (b *EventBus) Subscribe(handler EventHandler) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	b.handlers[b.nextID] = handler
+	return b.nextID
+}
+
+// Unsubscribe removes a previously registered handler
+func (b *EventBus) Unsubscribe(id int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.handlers, id)
+}
+
+// Publish delivers an event to all handlers in subscription order
+func (b *EventBus) Publish(event Event) {
+	b.mu.RLock()
+	ids := make([]int, 0, len(b.handlers))
+	for id := range b.handlers {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	handlers := make([]EventHandler, 0, len(ids))
+	for _, id := range ids {
+		handlers = append(handlers, b.handlers[id])
+	}
+	b.mu.RUnlock()
+
+	// Call handlers without holding the lock so they may (un)subscribe
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
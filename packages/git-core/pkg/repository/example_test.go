@@ -0,0 +1,151 @@
+package repository_test
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/repository"
+)
+
+// commitFile writes a file, stages it and commits it on the current branch
+func commitFile(repo *repository.Repository, path, content, message string) hash.Hash {
+	if err := os.WriteFile(filepath.Join(repo.Path, path), []byte(content), 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	indexPath := filepath.Join(repo.GitDir, "index")
+	idx, err := index.Load(indexPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := idx.Add(repo.Path, []string{path}, index.AddOptions{}); err != nil {
+		log.Fatal(err)
+	}
+	if err := idx.WriteBlobs(repo.Path, repo.ObjectDB); err != nil {
+		log.Fatal(err)
+	}
+	if err := idx.Save(indexPath); err != nil {
+		log.Fatal(err)
+	}
+
+	var parents []hash.Hash
+	if head, err := repo.ResolveHEAD(); err == nil {
+		parents = append(parents, head)
+	}
+	author := object.Signature{
+		Name:  "Ada Lovelace",
+		Email: "ada@example.com",
+		When:  time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+	}
+	commit, err := idx.CreateCommit(repo.Hasher, repo.ObjectDB, index.CommitOptions{
+		Message:   message,
+		Author:    author,
+		Committer: author,
+		Parents:   parents,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	branch, err := repo.CurrentBranch()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := repo.UpdateRef("refs/heads/"+branch, commit); err != nil {
+		log.Fatal(err)
+	}
+	return commit
+}
+
+// Create a repository, commit to it and read the history back
+func Example() {
+	dir, err := os.MkdirTemp("", "example")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo, err := repository.Create(dir, repository.DefaultInitOptions())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	commitFile(repo, "README.md", "# Example\n", "Initial commit\n")
+	commitFile(repo, "README.md", "# Example\n\nHello.\n", "Expand the README\n")
+
+	entries, err := repo.Log("", repository.DefaultLogOptions())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, entry := range entries {
+		fmt.Printf("%s %s", entry.Hash.String()[:7], entry.Commit.Message)
+	}
+	// Output:
+	// af7f52e Expand the README
+	// 083b646 Initial commit
+}
+
+// Show a commit's patch against its parent
+func ExampleRepository_Show() {
+	dir, err := os.MkdirTemp("", "example")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo, err := repository.Create(dir, repository.DefaultInitOptions())
+	if err != nil {
+		log.Fatal(err)
+	}
+	commitFile(repo, "greeting.txt", "hello\n", "Add greeting\n")
+	commitFile(repo, "greeting.txt", "hello, world\n", "Greet the world\n")
+
+	result, err := repo.Show("HEAD")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, file := range result.Files {
+		fmt.Printf("%s %s +%d -%d\n", file.Change, file.Path, file.Insertions, file.Deletions)
+	}
+	// Skip the diff and index header lines
+	patch := strings.SplitN(result.Patch, "\n", 3)[2]
+	fmt.Print(patch)
+	// Output:
+	// modified greeting.txt +1 -1
+	// --- a/greeting.txt
+	// +++ b/greeting.txt
+	// @@ -1 +1 @@
+	// -hello
+	// +hello, world
+}
+
+// Read a file as it was at an earlier revision
+func ExampleRepository_ShowFile() {
+	dir, err := os.MkdirTemp("", "example")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo, err := repository.Create(dir, repository.DefaultInitOptions())
+	if err != nil {
+		log.Fatal(err)
+	}
+	commitFile(repo, "VERSION", "1.0\n", "Release 1.0\n")
+	commitFile(repo, "VERSION", "1.1\n", "Release 1.1\n")
+
+	content, err := repo.ShowFile("HEAD~1", "VERSION")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(string(content))
+	// Output:
+	// 1.0
+}
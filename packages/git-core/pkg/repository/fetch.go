@@ -2,13 +2,16 @@ package repository
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"math"
 	"strings"
+	"time"
 
-	"github.com/nseba/browser-git/git-core/pkg/auth"
-	"github.com/nseba/browser-git/git-core/pkg/hash"
-	"github.com/nseba/browser-git/git-core/pkg/object"
-	"github.com/nseba/browser-git/git-core/pkg/protocol"
+	"github.com/nseba/browser-git/packages/git-core/pkg/auth"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
 )
 
 // FetchOptions contains options for fetching from a remote
@@ -21,12 +24,26 @@ type FetchOptions struct {
 	Prune bool
 	// Force allows non-fast-forward updates
 	Force bool
+	// Atomic updates either all the fetched refs or, when one cannot be
+	// updated, none of them
+	Atomic bool
 	// Depth for shallow fetch (0 for full fetch)
 	Depth int
+	// Deepen extends the history of a shallow repository by this many commits
+	Deepen int
+	// ShallowSince deepens or shortens history to commits after this time
+	ShallowSince time.Time
+	// ShallowExclude cuts history at commits reachable from these remote refs
+	ShallowExclude []string
+	// Unshallow fetches the complete history of a shallow repository
+	Unshallow bool
 	// AuthProvider is the authentication provider to use
 	AuthProvider auth.AuthProvider
 	// ProgressCallback is called with progress updates
 	ProgressCallback func(message string)
+	// VerifyObjects resolves every object in the received packfile before
+	// any is stored, instead of unpacking it as it arrives
+	VerifyObjects bool
 }
 
 // DefaultFetchOptions returns default fetch options
@@ -44,6 +61,9 @@ func DefaultFetchOptions() FetchOptions {
 type FetchResult struct {
 	// UpdatedRefs contains the refs that were updated
 	UpdatedRefs map[string]RefUpdate
+	// FailedRefs maps the refs that could not be updated to the reason.
+	// Only a non-atomic fetch reports them; an atomic one fails instead.
+	FailedRefs map[string]error
 	// PrunedRefs contains the refs that were pruned
 	PrunedRefs []string
 	// ObjectCount is the number of objects fetched
@@ -56,7 +76,7 @@ type RefUpdate struct {
 	RefName string
 	// OldHash is the previous hash (empty if new)
 	OldHash string
-	// NewHash is the new hash (empty if deleted)
+	// NewHash is the new hash (empty or the zero hash if deleted)
 	NewHash string
 	// Forced indicates if this was a forced update
 	Forced bool
@@ -64,6 +84,11 @@ type RefUpdate struct {
 
 // Fetch fetches objects and refs from a remote repository
 func (r *Repository) Fetch(opts FetchOptions) (*FetchResult, error) {
+	// Validate history options
+	if err := r.validateShallowOptions(opts); err != nil {
+		return nil, err
+	}
+
 	// Get remote URL from config
 	remoteURL, err := r.Config.GetRemoteURL(opts.Remote)
 	if err != nil {
@@ -79,8 +104,13 @@ func (r *Repository) Fetch(opts FetchOptions) (*FetchResult, error) {
 
 	progress(fmt.Sprintf("Fetching from %s...", opts.Remote))
 
+	// Bundle files are read directly instead of through the protocol
+	if bundlePath, ok := localClonePath(remoteURL); ok && IsBundle(bundlePath) {
+		return r.fetchFromBundle(bundlePath, r.fetchRefSpecs(opts), opts)
+	}
+
 	// Create protocol client
-	client := protocol.NewClient()
+	client := r.newClient()
 
 	// Set authentication if provided
 	if opts.AuthProvider != nil {
@@ -89,57 +119,59 @@ func (r *Repository) Fetch(opts FetchOptions) (*FetchResult, error) {
 
 	// Perform discovery to get remote references
 	progress("Discovering remote references...")
-	discovery, err := client.Discover(remoteURL, protocol.UploadPackService)
+	discovery, err := client.DiscoverRefs(remoteURL, fetchRefPrefixes(r.fetchRefSpecs(opts)))
 	if err != nil {
 		return nil, fmt.Errorf("failed to discover remote: %w", err)
 	}
 
-	// Get fetch refspecs from config if not provided
-	refspecs := opts.RefSpecs
-	if len(refspecs) == 0 {
-		refspecs, err = r.Config.GetFetchRefSpecs(opts.Remote)
-		if err != nil {
-			// Use default refspec
-			refspecs = []string{fmt.Sprintf("+refs/heads/*:refs/remotes/%s/*", opts.Remote)}
-		}
-	}
-
 	// Calculate which refs to update
-	refsToUpdate, err := r.calculateRefUpdates(discovery, refspecs, opts.Remote, opts.Force)
+	refsToUpdate, err := r.calculateRefUpdates(discovery, r.fetchRefSpecs(opts), opts.Remote, opts.Force)
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate ref updates: %w", err)
 	}
 
 	// If no refs to update, we're up to date
 	if len(refsToUpdate) == 0 {
+		if err := r.writeFetchHead(discovery, opts, remoteURL); err != nil {
+			return nil, err
+		}
+		if err := r.recordRemoteHEAD(discovery, opts.Remote); err != nil {
+			return nil, err
+		}
 		progress("Already up to date")
 		return &FetchResult{
 			UpdatedRefs: make(map[string]RefUpdate),
+			FailedRefs:  map[string]error{},
 			PrunedRefs:  []string{},
 			ObjectCount: 0,
 		}, nil
 	}
 
-	// Collect objects we want
+	// Collect objects we want. Changing the depth of existing history
+	// needs the current tips as well, even though we already have them.
+	reshaping := opts.reshapesHistory()
 	wants := []string{}
 	for _, update := range refsToUpdate {
-		if update.NewHash != "" && update.NewHash != update.OldHash {
+		if update.NewHash != "" && (update.NewHash != update.OldHash || reshaping) && !stringSliceContains(wants, update.NewHash) {
 			wants = append(wants, update.NewHash)
 		}
 	}
 
-	// Collect objects we already have
-	haves, err := r.getAllLocalCommits()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get local commits: %w", err)
-	}
+	// Offer the history we already have, starting from every ref, tag
+	// and reflog entry
+	negotiator := r.newFetchNegotiator()
 
 	// If we want objects we already have, filter them out
-	filteredWants := []string{}
-	for _, want := range wants {
-		if !stringSliceContains(haves, want) {
-			filteredWants = append(filteredWants, want)
-		}
+	filteredWants := wants
+	if !reshaping {
+		filteredWants = excludeStrings(wants, negotiator.tips)
+	}
+
+	// Shallow boundaries are announced separately: advertising them as
+	// haves would imply we hold their ancestors
+	shallowCommits, err := r.readShallowFile()
+	if err != nil {
+		return nil, err
 	}
 
 	// If no new objects to fetch, just update refs
@@ -148,34 +180,74 @@ func (r *Repository) Fetch(opts FetchOptions) (*FetchResult, error) {
 		// Build capabilities
 		capabilities := protocol.BuildCapabilities()
 
+		// Keep omitting the objects a partial clone filtered out
+		var filters map[string]string
+		if promisor, ok := r.Config.GetPromisorRemote(); ok && promisor == opts.Remote {
+			if spec, ok := r.Config.GetPartialCloneFilter(opts.Remote); ok {
+				filters, err = protocol.ParseFilterSpec(spec)
+				if err != nil {
+					return nil, fmt.Errorf("invalid partial clone filter: %w", err)
+				}
+			}
+		}
+
+		// Translate history options into deepen arguments
+		deepen := opts.Depth
+		if opts.Deepen > 0 {
+			deepen = opts.Deepen
+		}
+		if opts.Unshallow {
+			deepen = unshallowDepth
+		}
+		var deepenSince int64
+		if !opts.ShallowSince.IsZero() {
+			deepenSince = opts.ShallowSince.Unix()
+		}
+
 		// Fetch packfile from remote
 		progress("Receiving objects...")
 		uploadPackClient := protocol.NewUploadPackClient(client, remoteURL)
-		packfileData, err := uploadPackClient.FetchPackfile(filteredWants, haves, capabilities)
+		uploadPackClient.SetProtocolVersion(discovery.Version)
+		uploadPackClient.SetProgressCallback(progress)
+
+		// Objects are unpacked as the packfile arrives, unless they are
+		// all to be checked first
+		stream := newPackStream(r, uploadPackClient, opts.VerifyObjects)
+		fetchResp, err := uploadPackClient.FetchNegotiated(&protocol.NegotiationRequest{
+			Wants:          filteredWants,
+			Shallows:       shallowCommits,
+			Capabilities:   capabilities,
+			Deepen:         deepen,
+			DeepenRelative: opts.Deepen > 0,
+			DeepenSince:    deepenSince,
+			DeepenNot:      opts.ShallowExclude,
+			Filters:        filters,
+		}, negotiator)
 		if err != nil {
 			return nil, fmt.Errorf("failed to fetch packfile: %w", err)
 		}
+		if err := stream.finish(fetchResp); err != nil {
+			return nil, err
+		}
+		objectCount = stream.objects
 
-		progress(fmt.Sprintf("Received %d bytes", len(packfileData)))
+		progress(fmt.Sprintf("Received %d bytes", stream.received))
+		progress(fmt.Sprintf("Unpacked %d objects", objectCount))
 
-		// Unpack objects from packfile
-		progress("Unpacking objects...")
-		count, err := r.unpackPackfile(packfileData)
-		if err != nil {
-			return nil, fmt.Errorf("failed to unpack objects: %w", err)
+		// Record where the truncated history now ends
+		if err := r.updateShallow(fetchResp.Shallows, fetchResp.Unshallows); err != nil {
+			return nil, err
 		}
-		objectCount = count
-		progress(fmt.Sprintf("Unpacked %d objects", objectCount))
 	}
 
 	// Update remote tracking branches
 	progress("Updating remote tracking branches...")
-	updatedRefs := make(map[string]RefUpdate)
-	for _, update := range refsToUpdate {
-		if err := r.updateRef(update); err != nil {
-			return nil, fmt.Errorf("failed to update ref %s: %w", update.RefName, err)
-		}
-		updatedRefs[update.RefName] = update
+	updatedRefs, failedRefs, err := r.applyFetchedRefs(refsToUpdate, opts.Atomic)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.writeFetchHead(discovery, opts, remoteURL); err != nil {
+		return nil, err
 	}
 
 	// Prune remote tracking branches if requested
@@ -191,14 +263,102 @@ func (r *Repository) Fetch(opts FetchOptions) (*FetchResult, error) {
 		}
 	}
 
+	if err := r.recordRemoteHEAD(discovery, opts.Remote); err != nil {
+		return nil, err
+	}
+
 	progress("Done!")
 	return &FetchResult{
 		UpdatedRefs: updatedRefs,
+		FailedRefs:  failedRefs,
 		PrunedRefs:  prunedRefs,
 		ObjectCount: objectCount,
 	}, nil
 }
 
+// applyFetchedRefs updates the refs a fetch brought in and returns the
+// ones that were updated. When not atomic, a ref that cannot be updated
+// does not fail the fetch; it is returned with the reason instead.
+func (r *Repository) applyFetchedRefs(updates []RefUpdate, atomic bool) (map[string]RefUpdate, map[string]error, error) {
+	failed := map[string]error{}
+	if err := r.UpdateRefs(updates, atomic); err != nil {
+		var updateErr *RefUpdateError
+		if atomic || !errors.As(err, &updateErr) {
+			return nil, nil, err
+		}
+		failed = updateErr.Failed
+	}
+
+	updated := make(map[string]RefUpdate)
+	for _, update := range updates {
+		if _, ok := failed[update.RefName]; !ok {
+			updated[update.RefName] = update
+		}
+	}
+	return updated, failed, nil
+}
+
+// fetchRefSpecs returns the refspecs to fetch, from the options or the
+// remote's configuration
+func (r *Repository) fetchRefSpecs(opts FetchOptions) []string {
+	if len(opts.RefSpecs) > 0 {
+		return opts.RefSpecs
+	}
+
+	refspecs, err := r.Config.GetFetchRefSpecs(opts.Remote)
+	if err != nil {
+		// Use default refspec
+		return []string{fmt.Sprintf("+refs/heads/*:refs/remotes/%s/*", opts.Remote)}
+	}
+	return refspecs
+}
+
+// fetchRefPrefixes returns the ref prefixes a protocol v2 server needs to
+// list for refspecs, plus HEAD to learn the remote's default branch
+func fetchRefPrefixes(refspecs []string) []string {
+	prefixes := []string{"HEAD"}
+	for _, refspec := range refspecs {
+		src, _, _ := parseRefSpec(refspec)
+		prefix := strings.TrimSuffix(src, "*")
+		if !stringSliceContains(prefixes, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// unshallowDepth is the depth Git requests to fetch the complete history
+const unshallowDepth = math.MaxInt32
+
+// reshapesHistory reports whether the options change the depth of history
+// that is already present locally
+func (opts FetchOptions) reshapesHistory() bool {
+	return opts.Depth > 0 || opts.Deepen > 0 || opts.Unshallow ||
+		!opts.ShallowSince.IsZero() || len(opts.ShallowExclude) > 0
+}
+
+// validateShallowOptions rejects contradictory history options
+func (r *Repository) validateShallowOptions(opts FetchOptions) error {
+	if opts.Depth < 0 || opts.Deepen < 0 {
+		return fmt.Errorf("depth must be a positive number")
+	}
+	if opts.Depth > 0 && opts.Deepen > 0 {
+		return fmt.Errorf("depth and deepen are mutually exclusive")
+	}
+	if opts.Unshallow {
+		if opts.Depth > 0 || opts.Deepen > 0 || !opts.ShallowSince.IsZero() || len(opts.ShallowExclude) > 0 {
+			return fmt.Errorf("unshallow cannot be combined with other depth options")
+		}
+		if !r.IsShallow() {
+			return fmt.Errorf("unshallow on a complete repository does not make sense")
+		}
+	}
+	if opts.Deepen > 0 && !r.IsShallow() {
+		return fmt.Errorf("deepen requires a shallow repository")
+	}
+	return nil
+}
+
 // calculateRefUpdates determines which refs need to be updated based on refspecs
 func (r *Repository) calculateRefUpdates(discovery *protocol.DiscoveryResponse, refspecs []string, remote string, force bool) ([]RefUpdate, error) {
 	updates := []RefUpdate{}
@@ -212,6 +372,11 @@ func (r *Repository) calculateRefUpdates(discovery *protocol.DiscoveryResponse,
 
 		// Match source pattern against remote refs
 		for _, ref := range discovery.References {
+			// Peeled tag entries are not refs of their own
+			if strings.HasSuffix(ref.Name, "^{}") {
+				continue
+			}
+
 			if matchesPattern(ref.Name, src) {
 				// Calculate destination ref name
 				dstRef := calculateDestRef(ref.Name, src, dst, remote)
@@ -286,79 +451,24 @@ func calculateDestRef(refName, srcPattern, dstPattern, remote string) string {
 	return dstPattern
 }
 
-// getAllLocalCommits returns hashes of all local commits
-func (r *Repository) getAllLocalCommits() ([]string, error) {
-	commits := []string{}
-
-	// Get all local branches
-	refs, err := r.ListRefs("refs/heads/")
-	if err != nil {
-		return commits, nil // No local refs yet
-	}
-
-	// Add all remote tracking branches
-	remoteRefs, err := r.ListRefs("refs/remotes/")
-	if err == nil {
-		refs = append(refs, remoteRefs...)
-	}
-
-	// Collect unique commit hashes
-	seen := make(map[string]bool)
-	for _, ref := range refs {
-		h, err := r.GetRef(ref)
-		if err != nil {
-			continue
-		}
-		hashStr := h.String()
-		if !seen[hashStr] {
-			commits = append(commits, hashStr)
-			seen[hashStr] = true
+// excludeStrings returns the values not present in exclude
+func excludeStrings(values, exclude []string) []string {
+	result := []string{}
+	for _, value := range values {
+		if !stringSliceContains(exclude, value) {
+			result = append(result, value)
 		}
 	}
-
-	return commits, nil
+	return result
 }
 
-// unpackPackfile unpacks objects from a packfile and returns the count
+// unpackPackfile unpacks objects from a packfile, once its checksum is
+// verified, and returns the count
 func (r *Repository) unpackPackfile(packfileData []byte) (int, error) {
-	// Ensure object database is initialized
-	if r.ObjectDB == nil {
-		storage, err := createObjectStorage(r)
-		if err != nil {
-			return 0, fmt.Errorf("failed to create object storage: %w", err)
-		}
-		r.ObjectDB = object.NewObjectDatabase(storage, r.Hasher)
-	}
-
-	// Use the same unpackPackfile logic from clone
-	if err := unpackPackfile(r, packfileData); err != nil {
+	if _, err := r.checkPack(packfileData, false); err != nil {
 		return 0, err
 	}
-
-	// Parse packfile to get object count
-	reader := protocol.NewPackfileReader(bytes.NewReader(packfileData))
-	packfile, err := reader.ReadPackfile()
-	if err != nil {
-		return 0, fmt.Errorf("failed to read packfile: %w", err)
-	}
-
-	return len(packfile.Objects), nil
-}
-
-// updateRef updates a reference
-func (r *Repository) updateRef(update RefUpdate) error {
-	// Parse new hash
-	h, err := hash.ParseHash(update.NewHash)
-	if err != nil {
-		return fmt.Errorf("invalid hash: %w", err)
-	}
-
-	// Update the ref
-	if err := r.UpdateRef(update.RefName, h); err != nil {
-		return err
-	}
-
-	return nil
+	return unpackPackStream(r, bytes.NewReader(packfileData))
 }
 
 // pruneRemoteRefs removes remote tracking branches that no longer exist on remote
@@ -384,6 +494,9 @@ func (r *Repository) pruneRemoteRefs(discovery *protocol.DiscoveryResponse, remo
 	// Check each local remote ref
 	for _, localRef := range localRemoteRefs {
 		branchName := strings.TrimPrefix(localRef, remotePrefix)
+		if branchName == "HEAD" {
+			continue
+		}
 		if !remoteBranches[branchName] {
 			// This branch no longer exists on remote, prune it
 			if err := r.DeleteRef(localRef); err != nil {
@@ -393,6 +506,14 @@ func (r *Repository) pruneRemoteRefs(discovery *protocol.DiscoveryResponse, remo
 		}
 	}
 
+	// <remote>/HEAD goes with the branch it points to
+	if target, err := r.SymbolicRef(remoteHEADRef(remote)); err == nil && stringSliceContains(pruned, target) {
+		if err := r.DeleteRef(remoteHEADRef(remote)); err != nil {
+			return pruned, fmt.Errorf("failed to delete ref %s: %w", remoteHEADRef(remote), err)
+		}
+		pruned = append(pruned, remoteHEADRef(remote))
+	}
+
 	return pruned, nil
 }
 
@@ -417,6 +538,7 @@ func (r *Repository) isAncestor(ancestor, descendant string) (bool, error) {
 	// Walk commit history from descendant to see if we reach ancestor
 	visited := make(map[string]bool)
 	toVisit := []hash.Hash{descendantHash}
+	shallow := r.shallowSet()
 
 	for len(toVisit) > 0 {
 		current := toVisit[0]
@@ -443,6 +565,11 @@ func (r *Repository) isAncestor(ancestor, descendant string) (bool, error) {
 			continue
 		}
 
+		// Shallow boundaries have no known parents
+		if shallow[current.String()] {
+			continue
+		}
+
 		// Add parents to visit
 		for _, parent := range commit.Parents {
 			toVisit = append(toVisit, parent)
@@ -545,6 +672,9 @@ func (r *Repository) Pull(opts PullOptions) (*PullResult, error) {
 
 	// Get the fetched remote branch ref
 	remoteBranchRef := fmt.Sprintf("refs/remotes/%s/%s", opts.Remote, pullBranch)
+	if err, ok := fetchResult.FailedRefs[remoteBranchRef]; ok {
+		return nil, fmt.Errorf("failed to fetch: %w", err)
+	}
 	remoteBranchHash, err := r.GetRef(remoteBranchRef)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get remote branch: %w", err)
@@ -598,15 +728,8 @@ func (r *Repository) Pull(opts PullOptions) (*PullResult, error) {
 		mergeOpts.AllowFastForward = false // We already checked for fast-forward
 		mergeOpts.CommitMessage = fmt.Sprintf("Merge branch '%s' of %s into %s", pullBranch, opts.Remote, currentBranch)
 
-		// Instead of merging by branch name, we need to merge the remote branch
-		// First, create a temporary local branch pointing to the remote branch
-		tempBranch := fmt.Sprintf("PULL_HEAD_%s", remoteBranchHash.String()[:8])
-		if err := r.UpdateRef(fmt.Sprintf("refs/heads/%s", tempBranch), remoteBranchHash); err != nil {
-			return nil, fmt.Errorf("failed to create temp branch: %w", err)
-		}
-		defer r.DeleteRef(fmt.Sprintf("refs/heads/%s", tempBranch))
-
-		mergeResult, err := r.Merge(tempBranch, mergeOpts)
+		// The fetch marked the pulled branch for merging in FETCH_HEAD
+		mergeResult, err := r.Merge("FETCH_HEAD", mergeOpts)
 		if err != nil {
 			return nil, fmt.Errorf("failed to merge: %w", err)
 		}
@@ -628,9 +751,15 @@ func (r *Repository) fastForward(newHash hash.Hash) error {
 		return fmt.Errorf("failed to get current branch: %w", err)
 	}
 
+	if oldHash, err := r.ResolveHEAD(); err == nil {
+		if err := r.writeOrigHead(oldHash); err != nil {
+			return err
+		}
+	}
+
 	// Update the branch ref
 	branchRef := fmt.Sprintf("refs/heads/%s", currentBranch)
-	if err := r.UpdateRef(branchRef, newHash); err != nil {
+	if err := r.UpdateRefWithLog(branchRef, newHash, "pull: Fast-forward"); err != nil {
 		return fmt.Errorf("failed to update branch ref: %w", err)
 	}
 
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+// FetchHeadEntry is one ref recorded in FETCH_HEAD by the last fetch
+type FetchHeadEntry struct {
+	// Hash is the object the ref pointed to on the remote
+	Hash hash.Hash
+	// NotForMerge marks refs that git pull and Merge("FETCH_HEAD") leave
+	// alone
+	NotForMerge bool
+	// Ref is the ref's name on the remote, such as refs/heads/main
+	Ref string
+	// URL is the remote's URL, without credentials
+	URL string
+}
+
+// Description returns how FETCH_HEAD and merge messages name the ref,
+// such as "branch 'main' of https://example.com/repo"
+func (e FetchHeadEntry) Description() string {
+	var what string
+	switch {
+	case e.Ref == "HEAD":
+		return e.URL
+	case strings.HasPrefix(e.Ref, "refs/heads/"):
+		what = "branch '" + strings.TrimPrefix(e.Ref, "refs/heads/") + "'"
+	case strings.HasPrefix(e.Ref, "refs/tags/"):
+		what = "tag '" + strings.TrimPrefix(e.Ref, "refs/tags/") + "'"
+	case strings.HasPrefix(e.Ref, "refs/remotes/"):
+		what = "remote-tracking branch '" + strings.TrimPrefix(e.Ref, "refs/remotes/") + "'"
+	default:
+		what = "'" + e.Ref + "'"
+	}
+	return what + " of " + e.URL
+}
+
+// FetchHead returns the refs the last fetch recorded in FETCH_HEAD, those
+// marked for merging first. Without a FETCH_HEAD there are none.
+func (r *Repository) FetchHead() ([]FetchHeadEntry, error) {
+	data, err := os.ReadFile(filepath.Join(r.GitDir, "FETCH_HEAD"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []FetchHeadEntry{}, nil
+		}
+		return nil, fmt.Errorf("failed to read FETCH_HEAD: %w", err)
+	}
+
+	entries := []FetchHeadEntry{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		entry, err := parseFetchHeadLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FETCH_HEAD entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// writeFetchHead records the refs a fetch matched in FETCH_HEAD. When the
+// options give refspecs, the refs they name without a wildcard are marked
+// for merging; otherwise the current branch's upstream is, if it is on
+// this remote. The rest are not-for-merge, as with git fetch.
+func (r *Repository) writeFetchHead(discovery *protocol.DiscoveryResponse, opts FetchOptions, remoteURL string) error {
+	explicit := len(opts.RefSpecs) > 0
+	var upstream *Upstream
+	if !explicit {
+		if branch, err := r.CurrentBranch(); err == nil {
+			upstream, _ = r.GetUpstream(branch)
+		}
+	}
+
+	remoteURL = fetchHeadURL(remoteURL)
+	var forMerge, notForMerge []FetchHeadEntry
+	seen := make(map[string]bool)
+	for _, refspec := range r.fetchRefSpecs(opts) {
+		src, _, _ := parseRefSpec(refspec)
+		for _, ref := range discovery.References {
+			if strings.HasSuffix(ref.Name, "^{}") || seen[ref.Name] || !matchesPattern(ref.Name, src) {
+				continue
+			}
+			h, err := hash.ParseHash(ref.Hash)
+			if err != nil {
+				continue
+			}
+			seen[ref.Name] = true
+
+			entry := FetchHeadEntry{Hash: h, Ref: ref.Name, URL: remoteURL}
+			merge := upstream != nil && upstream.Remote == opts.Remote && upstream.Merge == ref.Name
+			if explicit {
+				merge = !strings.HasSuffix(src, "*")
+			}
+			if merge {
+				forMerge = append(forMerge, entry)
+			} else {
+				entry.NotForMerge = true
+				notForMerge = append(notForMerge, entry)
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, entry := range append(forMerge, notForMerge...) {
+		marker := ""
+		if entry.NotForMerge {
+			marker = "not-for-merge"
+		}
+		fmt.Fprintf(&b, "%s\t%s\t%s\n", entry.Hash.String(), marker, entry.Description())
+	}
+	if err := os.WriteFile(filepath.Join(r.GitDir, "FETCH_HEAD"), []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write FETCH_HEAD: %w", err)
+	}
+	return nil
+}
+
+// fetchHeadURL drops credentials and a trailing slash or .git from a
+// remote URL, the way git records it in FETCH_HEAD
+func fetchHeadURL(remoteURL string) string {
+	if u, err := url.Parse(remoteURL); err == nil && u.User != nil {
+		u.User = nil
+		remoteURL = u.String()
+	}
+	remoteURL = strings.TrimRight(remoteURL, "/")
+	return strings.TrimSuffix(remoteURL, ".git")
+}
+
+// parseFetchHeadLine parses "<hash>\t[not-for-merge]\t<description>"
+func parseFetchHeadLine(line string) (FetchHeadEntry, error) {
+	fields := strings.SplitN(line, "\t", 3)
+	if len(fields) < 3 {
+		return FetchHeadEntry{}, fmt.Errorf("malformed line %q", line)
+	}
+	h, err := hash.ParseHash(fields[0])
+	if err != nil {
+		return FetchHeadEntry{}, fmt.Errorf("invalid hash: %w", err)
+	}
+
+	entry := FetchHeadEntry{Hash: h, NotForMerge: fields[1] == "not-for-merge"}
+	what, remoteURL, ok := strings.Cut(fields[2], " of ")
+	if !ok {
+		entry.Ref, entry.URL = "HEAD", fields[2]
+		return entry, nil
+	}
+	entry.URL = remoteURL
+	for prefix, kind := range map[string]string{"refs/heads/": "branch ", "refs/tags/": "tag ", "refs/remotes/": "remote-tracking branch "} {
+		if name, ok := strings.CutPrefix(what, kind); ok {
+			entry.Ref = prefix + strings.Trim(name, "'")
+			return entry, nil
+		}
+	}
+	entry.Ref = strings.Trim(what, "'")
+	return entry, nil
+}
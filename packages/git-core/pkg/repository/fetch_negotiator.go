@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// fetchNegotiator chooses the local commits a fetch offers as haves. Like
+// git's default negotiator it walks back from every ref, tag and reflog
+// entry, newest commit first, and stops walking past commits the server
+// has acknowledged.
+type fetchNegotiator struct {
+	repo  *Repository
+	queue commitQueue
+	// seen holds every commit queued so far
+	seen   map[string]*logCommit
+	popped map[string]bool
+	common map[string]bool
+	// pending counts the queued commits not known to be common
+	pending int
+	// shallow boundaries are never offered: their parents are missing
+	shallow map[string]bool
+	// tips are the values of the refs and reflog entries the walk
+	// started from, whose history is complete locally
+	tips []string
+}
+
+// newFetchNegotiator creates a negotiator starting from the local refs,
+// tags and reflogs
+func (r *Repository) newFetchNegotiator() *fetchNegotiator {
+	n := &fetchNegotiator{
+		repo:    r,
+		seen:    make(map[string]*logCommit),
+		popped:  make(map[string]bool),
+		common:  make(map[string]bool),
+		shallow: r.shallowSet(),
+		tips:    []string{},
+	}
+
+	for _, tip := range r.negotiationTips() {
+		if stringSliceContains(n.tips, tip.String()) || !r.ObjectDB.Has(tip) {
+			continue
+		}
+		commitHash, commit, err := r.peelToCommit(tip)
+		if err != nil {
+			continue
+		}
+		n.tips = append(n.tips, tip.String())
+		n.push(commitHash, commit)
+	}
+	return n
+}
+
+// negotiationTips returns what HEAD, the branches, remote-tracking
+// branches and tags point to, and every value in the reflogs
+func (r *Repository) negotiationTips() []hash.Hash {
+	tips := []hash.Hash{}
+	if head, err := r.ResolveRef("HEAD"); err == nil {
+		tips = append(tips, head)
+	}
+
+	for _, prefix := range []string{"refs/heads/", "refs/remotes/", "refs/tags/"} {
+		refs, err := r.ListRefs(prefix)
+		if err != nil {
+			continue
+		}
+		for _, ref := range refs {
+			if h, err := r.GetRef(ref); err == nil {
+				tips = append(tips, h)
+			}
+		}
+	}
+
+	for _, ref := range r.reflogRefs() {
+		entries, err := r.Reflog(ref)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.New.IsZero() {
+				tips = append(tips, entry.New)
+			}
+		}
+	}
+
+	return tips
+}
+
+// NextHaves returns up to count commits not yet known to be common,
+// newest first
+func (n *fetchNegotiator) NextHaves(count int) []string {
+	haves := []string{}
+	for len(haves) < count && n.pending > 0 {
+		c := n.queue.pop()
+		key := c.hash.String()
+		n.popped[key] = true
+
+		if n.common[key] {
+			for _, parent := range n.parents(c) {
+				n.markCommon(parent)
+			}
+			continue
+		}
+		n.pending--
+
+		for _, parent := range n.parents(c) {
+			n.pushParent(parent)
+		}
+		if !n.shallow[key] {
+			haves = append(haves, key)
+		}
+	}
+	return haves
+}
+
+// Ack records that the server has a commit, so neither it nor its
+// ancestors are offered again
+func (n *fetchNegotiator) Ack(hashStr string) {
+	if h, err := hash.ParseHash(hashStr); err == nil {
+		n.markCommon(h)
+	}
+}
+
+// markCommon marks a commit common. Commits still queued are marked
+// there, and pass it on to their parents when popped.
+func (n *fetchNegotiator) markCommon(h hash.Hash) {
+	key := h.String()
+	if n.common[key] {
+		return
+	}
+	c, ok := n.seen[key]
+	if !ok {
+		if c = n.pushParent(h); c == nil {
+			return
+		}
+	}
+
+	n.common[key] = true
+	if !n.popped[key] {
+		n.pending--
+		return
+	}
+	for _, parent := range n.parents(c) {
+		n.markCommon(parent)
+	}
+}
+
+// parents returns the parents the walk follows from a commit: none past
+// a shallow boundary
+func (n *fetchNegotiator) parents(c *logCommit) []hash.Hash {
+	if n.shallow[c.hash.String()] {
+		return nil
+	}
+	return c.commit.Parents
+}
+
+// pushParent queues a commit reached from a child, unless it was queued
+// before or is missing locally
+func (n *fetchNegotiator) pushParent(h hash.Hash) *logCommit {
+	if c, ok := n.seen[h.String()]; ok {
+		return c
+	}
+	if !n.repo.ObjectDB.Has(h) {
+		return nil
+	}
+	obj, err := n.repo.ObjectDB.Get(h)
+	if err != nil {
+		return nil
+	}
+	commit, ok := obj.(*object.Commit)
+	if !ok {
+		return nil
+	}
+	return n.push(h, commit)
+}
+
+// push queues a commit that has not been seen yet
+func (n *fetchNegotiator) push(h hash.Hash, commit *object.Commit) *logCommit {
+	if c, ok := n.seen[h.String()]; ok {
+		return c
+	}
+	c := &logCommit{hash: h, commit: commit}
+	n.seen[h.String()] = c
+	n.queue.push(c)
+	n.pending++
+	return c
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// commitAt writes a commit made at the given Unix time
+func commitAt(t *testing.T, repo *Repository, message string, when int64, parents ...hash.Hash) hash.Hash {
+	t.Helper()
+
+	commit := object.NewCommit()
+	commit.Tree = writeTestTree(t, repo, map[string]string{"file.txt": message + "\n"})
+	commit.Parents = parents
+	commit.Author = object.Signature{Name: "Test User", Email: "test@example.com", When: time.Unix(when, 0)}
+	commit.Committer = commit.Author
+	commit.Message = message + "\n"
+	h, err := repo.ObjectDB.Put(commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// TestFetchNegotiator tests that haves come from branches, tags and
+// reflogs, newest first, and skip the ancestors of acknowledged commits
+func TestFetchNegotiator(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	base := commitAt(t, repo, "base", 1000)
+	a1 := commitAt(t, repo, "a1", 2000, base)
+	a2 := commitAt(t, repo, "a2", 3000, a1)
+	tagged := commitAt(t, repo, "tagged", 4000, base)
+	dropped := commitAt(t, repo, "dropped", 5000, a2)
+
+	// The dropped commit is only left in the reflog of main
+	if err := repo.UpdateRefWithLog("refs/heads/main", dropped, "commit: dropped"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateRefWithLog("refs/heads/main", a2, "reset: moving to a2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateRef("refs/tags/v1", tagged); err != nil {
+		t.Fatal(err)
+	}
+
+	negotiator := repo.newFetchNegotiator()
+	for _, tip := range []hash.Hash{a2, tagged, dropped} {
+		if !stringSliceContains(negotiator.tips, tip.String()) {
+			t.Errorf("Expected %s among the tips %q", tip, negotiator.tips)
+		}
+	}
+
+	want := []string{dropped.String(), tagged.String(), a2.String(), a1.String(), base.String()}
+	haves := append(negotiator.NextHaves(2), negotiator.NextHaves(10)...)
+	if strings.Join(haves, " ") != strings.Join(want, " ") {
+		t.Errorf("haves = %q, want %q", haves, want)
+	}
+	if more := negotiator.NextHaves(10); len(more) != 0 {
+		t.Errorf("Expected no more haves, got %q", more)
+	}
+
+	// Once the server has a2, neither it nor its ancestors are offered
+	negotiator = repo.newFetchNegotiator()
+	haves = negotiator.NextHaves(2)
+	if strings.Join(haves, " ") != dropped.String()+" "+tagged.String() {
+		t.Fatalf("haves = %q", haves)
+	}
+	negotiator.Ack(a2.String())
+	if more := negotiator.NextHaves(10); len(more) != 0 {
+		t.Errorf("Expected the common history to be skipped, got %q", more)
+	}
+}
+
+// TestFetchNegotiatorShallow tests that shallow boundaries are not offered
+// and their missing parents are not walked
+func TestFetchNegotiatorShallow(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	cutOff := commitAt(t, repo, "cut off", 1000)
+	boundary := commitAt(t, repo, "boundary", 2000, cutOff)
+	tip := commitAt(t, repo, "tip", 3000, boundary)
+	if err := repo.UpdateRef("refs/heads/main", tip); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.updateShallow([]string{boundary.String()}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	haves := repo.newFetchNegotiator().NextHaves(10)
+	if len(haves) != 1 || haves[0] != tip.String() {
+		t.Errorf("haves = %q, want only the tip", haves)
+	}
+}
@@ -0,0 +1,687 @@
+package repository
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// DefaultForEachRefFormat is the format git for-each-ref uses by default
+const DefaultForEachRefFormat = "%(objectname) %(objecttype)\t%(refname)"
+
+// ForEachRefOptions configures ForEachRef
+type ForEachRefOptions struct {
+	// Patterns select refs. A pattern without wildcards selects the refs
+	// under it, as "refs/heads" selects refs/heads/main; one with *, ? or
+	// [...] is a glob whose wildcards do not match slashes. Empty selects
+	// every ref.
+	Patterns []string
+
+	// Sort are the keys to order refs by, most significant first. A key is
+	// a field as in Format, such as refname or committerdate, optionally
+	// prefixed with "version:" to compare numbers in it numerically, or
+	// with "-" to reverse it. Ties are ordered by refname.
+	Sort []string
+
+	// Format is the output format of each ref: %(field) expands to one of
+	// the fields listed on ForEachRef, %% to a percent sign and %xx to the
+	// byte with hex code xx
+	Format string
+
+	// Count limits the number of refs listed, like --count; 0 is unlimited
+	Count int
+}
+
+// DefaultForEachRefOptions returns default for-each-ref options
+func DefaultForEachRefOptions() ForEachRefOptions {
+	return ForEachRefOptions{
+		Patterns: []string{},
+		Sort:     []string{"refname"},
+		Format:   DefaultForEachRefFormat,
+		Count:    0,
+	}
+}
+
+// RefEntry is a ref listed by ForEachRef
+type RefEntry struct {
+	Name string
+	Hash hash.Hash
+	// Output is the ref formatted with ForEachRefOptions.Format
+	Output string
+}
+
+// ForEachRef lists refs with their fields formatted, like git for-each-ref.
+// The fields are:
+//
+//	refname[:short|:lstrip=N|:rstrip=N]   the ref's name
+//	objectname[:short[=N]]                the object the ref points to
+//	objecttype, objectsize
+//	*objectname, *objecttype, ...         fields of an annotated tag's target
+//	HEAD                                  "*" for the checked out branch, or a space
+//	upstream[:short|:track|:trackshort|:remotename|:remoteref]
+//	symref[:short|:lstrip=N|:rstrip=N]    the ref a symbolic ref points to
+//	subject, body, contents               the commit or tag message
+//	authorname, authoremail[:trim], authordate[:FORMAT], and the same
+//	for committer and tagger
+//	creatordate[:FORMAT]                  a commit's committer or a tag's tagger date
+//
+// Dates use Git's default format, or :unix, :raw, :iso, :iso-strict,
+// :rfc, :relative or :short. Fields that do not apply to an object are empty.
+func (r *Repository) ForEachRef(opts ForEachRefOptions) ([]RefEntry, error) {
+	format := opts.Format
+	if format == "" {
+		format = DefaultForEachRefFormat
+	}
+	segments, err := parseRefFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := parseRefSortKeys(opts.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	current := ""
+	if branch, err := r.CurrentBranch(); err == nil {
+		current = "refs/heads/" + branch
+	}
+
+	refs := []*refFields{}
+	err = r.WalkRefs(WalkRefsOptions{Patterns: opts.Patterns}, func(ref Ref) error {
+		refs = append(refs, &refFields{
+			r:       r,
+			name:    ref.Name,
+			hash:    ref.Hash,
+			current: current,
+			values:  make(map[refAtom]refValue),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var sortErr error
+	sort.SliceStable(refs, func(i, j int) bool {
+		less, err := compareRefs(refs[i], refs[j], keys)
+		if err != nil && sortErr == nil {
+			sortErr = err
+		}
+		return less
+	})
+	if sortErr != nil {
+		return nil, sortErr
+	}
+
+	if opts.Count > 0 && len(refs) > opts.Count {
+		refs = refs[:opts.Count]
+	}
+
+	entries := make([]RefEntry, 0, len(refs))
+	for _, ref := range refs {
+		var b strings.Builder
+		for _, segment := range segments {
+			if segment.atom == nil {
+				b.WriteString(segment.literal)
+				continue
+			}
+			value, err := ref.value(*segment.atom)
+			if err != nil {
+				return nil, err
+			}
+			b.WriteString(value.text)
+		}
+		entries = append(entries, RefEntry{Name: ref.name, Hash: ref.hash, Output: b.String()})
+	}
+
+	return entries, nil
+}
+
+// refAtom is a field of a format or sort key, such as refname:short
+type refAtom struct {
+	// deref selects the target of an annotated tag, as in *objectname
+	deref    bool
+	name     string
+	modifier string
+}
+
+// refAtomNames are the fields ForEachRef knows
+var refAtomNames = map[string]bool{
+	"refname": true, "objectname": true, "objecttype": true, "objectsize": true,
+	"HEAD": true, "upstream": true, "symref": true, "subject": true, "body": true, "contents": true,
+	"authorname": true, "authoremail": true, "authordate": true,
+	"committername": true, "committeremail": true, "committerdate": true,
+	"taggername": true, "taggeremail": true, "taggerdate": true,
+	"creatordate": true,
+}
+
+// parseRefAtom parses a field name with its optional * and modifier
+func parseRefAtom(s string) (refAtom, error) {
+	var atom refAtom
+	if strings.HasPrefix(s, "*") {
+		atom.deref = true
+		s = s[1:]
+	}
+	atom.name, atom.modifier, _ = strings.Cut(s, ":")
+	if !refAtomNames[atom.name] {
+		return refAtom{}, fmt.Errorf("unknown field name: %s", s)
+	}
+	return atom, nil
+}
+
+// refFormatSegment is literal text or a field of a format
+type refFormatSegment struct {
+	literal string
+	atom    *refAtom
+}
+
+// parseRefFormat splits a format into literal text and fields
+func parseRefFormat(format string) ([]refFormatSegment, error) {
+	var segments []refFormatSegment
+	var literal strings.Builder
+	flush := func() {
+		if literal.Len() > 0 {
+			segments = append(segments, refFormatSegment{literal: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			literal.WriteByte(format[i])
+			continue
+		}
+
+		rest := format[i+1:]
+		switch {
+		case strings.HasPrefix(rest, "%"):
+			literal.WriteByte('%')
+			i++
+		case strings.HasPrefix(rest, "("):
+			end := strings.IndexByte(rest, ')')
+			if end < 0 {
+				return nil, fmt.Errorf("malformed format string %s", format)
+			}
+			atom, err := parseRefAtom(rest[1:end])
+			if err != nil {
+				return nil, err
+			}
+			flush()
+			segments = append(segments, refFormatSegment{atom: &atom})
+			i += end + 1
+		default:
+			if len(rest) >= 2 {
+				if b, err := strconv.ParseUint(rest[:2], 16, 8); err == nil {
+					literal.WriteByte(byte(b))
+					i += 2
+					continue
+				}
+			}
+			// Like Git, keep a lone percent sign
+			literal.WriteByte('%')
+		}
+	}
+	flush()
+
+	return segments, nil
+}
+
+// refSortKey is a parsed sort key
+type refSortKey struct {
+	atom    refAtom
+	reverse bool
+	version bool
+}
+
+// parseRefSortKeys parses sort keys, defaulting to refname
+func parseRefSortKeys(keys []string) ([]refSortKey, error) {
+	parsed := make([]refSortKey, 0, len(keys)+1)
+	for _, key := range keys {
+		var k refSortKey
+		if strings.HasPrefix(key, "-") {
+			k.reverse = true
+			key = key[1:]
+		}
+		for _, prefix := range []string{"version:", "v:"} {
+			if strings.HasPrefix(key, prefix) {
+				k.version = true
+				key = strings.TrimPrefix(key, prefix)
+			}
+		}
+		atom, err := parseRefAtom(key)
+		if err != nil {
+			return nil, err
+		}
+		k.atom = atom
+		parsed = append(parsed, k)
+	}
+
+	// Ties are ordered by refname
+	return append(parsed, refSortKey{atom: refAtom{name: "refname"}}), nil
+}
+
+// compareRefs reports whether a sorts before b
+func compareRefs(a, b *refFields, keys []refSortKey) (bool, error) {
+	for _, key := range keys {
+		va, err := a.value(key.atom)
+		if err != nil {
+			return false, err
+		}
+		vb, err := b.value(key.atom)
+		if err != nil {
+			return false, err
+		}
+
+		var cmp int
+		switch {
+		case va.numeric && vb.numeric:
+			cmp = compareInt64(va.num, vb.num)
+		case key.version:
+			cmp = compareVersions(va.text, vb.text)
+		default:
+			cmp = strings.Compare(va.text, vb.text)
+		}
+		if key.reverse {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp < 0, nil
+		}
+	}
+	return false, nil
+}
+
+// compareInt64 compares two integers like strings.Compare
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareVersions compares strings with the digit runs in them compared
+// as numbers, so v1.9 sorts before v1.10
+func compareVersions(a, b string) int {
+	for a != "" && b != "" {
+		da, db := leadingDigits(a), leadingDigits(b)
+		if da > 0 && db > 0 {
+			na := strings.TrimLeft(a[:da], "0")
+			nb := strings.TrimLeft(b[:db], "0")
+			if len(na) != len(nb) {
+				return compareInt64(int64(len(na)), int64(len(nb)))
+			}
+			if cmp := strings.Compare(na, nb); cmp != 0 {
+				return cmp
+			}
+			a, b = a[da:], b[db:]
+			continue
+		}
+		if a[0] != b[0] {
+			return compareInt64(int64(a[0]), int64(b[0]))
+		}
+		a, b = a[1:], b[1:]
+	}
+	return compareInt64(int64(len(a)), int64(len(b)))
+}
+
+// leadingDigits returns the length of the run of digits starting s
+func leadingDigits(s string) int {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return n
+}
+
+// matchRefPatterns reports whether a ref is selected by patterns
+func matchRefPatterns(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if strings.ContainsAny(pattern, "*?[") {
+			if matched, _ := path.Match(pattern, name); matched {
+				return true
+			}
+			continue
+		}
+		pattern = strings.TrimSuffix(pattern, "/")
+		if name == pattern || strings.HasPrefix(name, pattern+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// shortRefName abbreviates a ref name the way refname:short does
+func shortRefName(name string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/"} {
+		if strings.HasPrefix(name, prefix) {
+			return strings.TrimPrefix(name, prefix)
+		}
+	}
+	return strings.TrimPrefix(name, "refs/")
+}
+
+// refValue is a field's value: its text, and a number for dates and sizes,
+// which sort numerically
+type refValue struct {
+	text    string
+	num     int64
+	numeric bool
+}
+
+// refFields computes the fields of one ref, loading objects only as the
+// fields need them
+type refFields struct {
+	r       *Repository
+	name    string
+	hash    hash.Hash
+	current string
+
+	obj    object.Object
+	target object.Object
+	values map[refAtom]refValue
+}
+
+// object loads the object the ref points to, or with deref, the object an
+// annotated tag points to. The latter is nil for other refs.
+func (f *refFields) object(deref bool) (object.Object, error) {
+	if f.obj == nil {
+		obj, err := f.r.ObjectDB.Get(f.hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", f.name, err)
+		}
+		f.obj = obj
+	}
+	if !deref {
+		return f.obj, nil
+	}
+
+	tag, ok := f.obj.(*object.Tag)
+	if !ok {
+		return nil, nil
+	}
+	if f.target == nil {
+		target, err := f.r.ObjectDB.Get(tag.Target)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the target of %s: %w", f.name, err)
+		}
+		f.target = target
+	}
+	return f.target, nil
+}
+
+// value computes a field, caching it for sorting and formatting
+func (f *refFields) value(atom refAtom) (refValue, error) {
+	if value, ok := f.values[atom]; ok {
+		return value, nil
+	}
+	value, err := f.compute(atom)
+	if err != nil {
+		return refValue{}, err
+	}
+	f.values[atom] = value
+	return value, nil
+}
+
+// compute evaluates a field
+func (f *refFields) compute(atom refAtom) (refValue, error) {
+	switch atom.name {
+	case "refname":
+		if atom.deref {
+			return refValue{}, nil
+		}
+		name, err := formatRefName(f.name, atom.modifier)
+		return refValue{text: name}, err
+	case "HEAD":
+		if f.name == f.current && !atom.deref {
+			return refValue{text: "*"}, nil
+		}
+		return refValue{text: " "}, nil
+	case "upstream":
+		if atom.deref {
+			return refValue{}, nil
+		}
+		return f.upstream(atom.modifier)
+	case "symref":
+		target, err := f.r.readSymbolicRef(f.name)
+		if err != nil || target == "" || atom.deref {
+			return refValue{}, nil
+		}
+		name, err := formatRefName(target, atom.modifier)
+		return refValue{text: name}, err
+	}
+
+	obj, err := f.object(atom.deref)
+	if err != nil || obj == nil {
+		return refValue{}, err
+	}
+
+	switch atom.name {
+	case "objectname":
+		return formatObjectName(obj.Hash(), atom.modifier)
+	case "objecttype":
+		return refValue{text: string(obj.Type())}, nil
+	case "objectsize":
+		return refValue{text: strconv.FormatInt(obj.Size(), 10), num: obj.Size(), numeric: true}, nil
+	}
+
+	var message string
+	var author, committer, tagger, creator *object.Signature
+	switch o := obj.(type) {
+	case *object.Commit:
+		message = o.Message
+		author, committer, creator = &o.Author, &o.Committer, &o.Committer
+	case *object.Tag:
+		message = o.Message
+		tagger, creator = &o.Tagger, &o.Tagger
+	}
+
+	switch atom.name {
+	case "subject", "body", "contents":
+		part := atom.modifier
+		if atom.name != "contents" {
+			part = atom.name
+		}
+		return formatRefMessage(message, part)
+	case "creatordate":
+		return formatRefPerson(creator, "date", atom.modifier)
+	}
+
+	switch {
+	case strings.HasPrefix(atom.name, "author"):
+		return formatRefPerson(author, strings.TrimPrefix(atom.name, "author"), atom.modifier)
+	case strings.HasPrefix(atom.name, "committer"):
+		return formatRefPerson(committer, strings.TrimPrefix(atom.name, "committer"), atom.modifier)
+	case strings.HasPrefix(atom.name, "tagger"):
+		return formatRefPerson(tagger, strings.TrimPrefix(atom.name, "tagger"), atom.modifier)
+	}
+	return refValue{}, fmt.Errorf("unknown field name: %s", atom.name)
+}
+
+// upstream computes the upstream field of a branch
+func (f *refFields) upstream(modifier string) (refValue, error) {
+	if !strings.HasPrefix(f.name, "refs/heads/") {
+		return refValue{}, nil
+	}
+	upstream, err := f.r.GetUpstream(strings.TrimPrefix(f.name, "refs/heads/"))
+	if err != nil || upstream == nil {
+		return refValue{}, err
+	}
+	tracking := upstream.TrackingRef()
+
+	switch modifier {
+	case "":
+		return refValue{text: tracking}, nil
+	case "short":
+		return refValue{text: shortRefName(tracking)}, nil
+	case "remotename":
+		return refValue{text: upstream.Remote}, nil
+	case "remoteref":
+		return refValue{text: upstream.Merge}, nil
+	case "track", "trackshort":
+	default:
+		return refValue{}, fmt.Errorf("unrecognized %%(upstream) argument: %s", modifier)
+	}
+
+	if _, err := f.r.ResolveRef(tracking); err != nil {
+		if modifier == "track" {
+			return refValue{text: "[gone]"}, nil
+		}
+		return refValue{}, nil
+	}
+	ahead, behind, err := f.r.AheadBehind(f.name, tracking)
+	if err != nil {
+		return refValue{}, err
+	}
+
+	if modifier == "trackshort" {
+		short := map[[2]bool]string{{false, false}: "=", {true, false}: ">", {false, true}: "<", {true, true}: "<>"}
+		return refValue{text: short[[2]bool{ahead > 0, behind > 0}]}, nil
+	}
+	var parts []string
+	if ahead > 0 {
+		parts = append(parts, fmt.Sprintf("ahead %d", ahead))
+	}
+	if behind > 0 {
+		parts = append(parts, fmt.Sprintf("behind %d", behind))
+	}
+	if len(parts) == 0 {
+		return refValue{}, nil
+	}
+	return refValue{text: "[" + strings.Join(parts, ", ") + "]"}, nil
+}
+
+// formatRefName applies a refname modifier
+func formatRefName(name, modifier string) (string, error) {
+	if modifier == "" {
+		return name, nil
+	}
+	if modifier == "short" {
+		return shortRefName(name), nil
+	}
+
+	op, arg, _ := strings.Cut(modifier, "=")
+	n, err := strconv.Atoi(arg)
+	if err != nil || (op != "lstrip" && op != "strip" && op != "rstrip") {
+		return "", fmt.Errorf("unrecognized %%(refname) argument: %s", modifier)
+	}
+
+	// A negative count keeps that many components instead
+	parts := strings.Split(name, "/")
+	if n < 0 {
+		n = len(parts) + n
+		if n < 0 {
+			n = 0
+		}
+	}
+	if n >= len(parts) {
+		return "", nil
+	}
+	if op == "rstrip" {
+		return strings.Join(parts[:len(parts)-n], "/"), nil
+	}
+	return strings.Join(parts[n:], "/"), nil
+}
+
+// formatObjectName applies an objectname modifier
+func formatObjectName(h hash.Hash, modifier string) (refValue, error) {
+	switch {
+	case modifier == "":
+		return refValue{text: h.String()}, nil
+	case modifier == "short":
+		return refValue{text: shortHash(h)}, nil
+	case strings.HasPrefix(modifier, "short="):
+		n, err := strconv.Atoi(strings.TrimPrefix(modifier, "short="))
+		if err != nil || n <= 0 {
+			return refValue{}, fmt.Errorf("unrecognized %%(objectname) argument: %s", modifier)
+		}
+		s := h.String()
+		if n < 4 {
+			n = 4
+		}
+		if n < len(s) {
+			s = s[:n]
+		}
+		return refValue{text: s}, nil
+	}
+	return refValue{}, fmt.Errorf("unrecognized %%(objectname) argument: %s", modifier)
+}
+
+// formatRefMessage returns part of a message: its subject, the first
+// paragraph joined into a line; its body, after the first paragraph; or
+// all of it
+func formatRefMessage(message, part string) (refValue, error) {
+	lines := strings.Split(strings.TrimLeft(message, "\n"), "\n")
+	end := 0
+	for end < len(lines) && strings.TrimSpace(lines[end]) != "" {
+		end++
+	}
+
+	switch part {
+	case "":
+		return refValue{text: message}, nil
+	case "subject":
+		return refValue{text: strings.Join(lines[:end], " ")}, nil
+	case "body":
+		body := strings.TrimLeft(strings.Join(lines[end:], "\n"), "\n")
+		return refValue{text: body}, nil
+	}
+	return refValue{}, fmt.Errorf("unrecognized %%(contents) argument: %s", part)
+}
+
+// formatRefPerson formats the name, email or date of an author, committer
+// or tagger
+func formatRefPerson(who *object.Signature, field, modifier string) (refValue, error) {
+	if who == nil {
+		// A missing date sorts as the epoch
+		return refValue{numeric: field == "date"}, nil
+	}
+
+	switch field {
+	case "name":
+		return refValue{text: who.Name}, nil
+	case "email":
+		if modifier == "trim" {
+			return refValue{text: who.Email}, nil
+		}
+		return refValue{text: "<" + who.Email + ">"}, nil
+	case "date":
+		text, err := formatRefDate(who.When, modifier)
+		return refValue{text: text, num: who.When.Unix(), numeric: true}, err
+	}
+	return refValue{}, fmt.Errorf("unknown field name: %s", field)
+}
+
+// formatRefDate formats a date like git's --date formats
+func formatRefDate(t time.Time, format string) (string, error) {
+	switch format {
+	case "", "default":
+		return t.Format("Mon Jan 2 15:04:05 2006 -0700"), nil
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10), nil
+	case "raw":
+		return fmt.Sprintf("%d %s", t.Unix(), t.Format("-0700")), nil
+	case "iso", "iso8601":
+		return t.Format("2006-01-02 15:04:05 -0700"), nil
+	case "iso-strict", "iso8601-strict":
+		return t.Format("2006-01-02T15:04:05-07:00"), nil
+	case "rfc", "rfc2822":
+		return t.Format("Mon, 2 Jan 2006 15:04:05 -0700"), nil
+	case "short":
+		return t.Format("2006-01-02"), nil
+	case "relative":
+		return relativeDate(t, time.Now()), nil
+	}
+	return "", fmt.Errorf("unknown date format %s", format)
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// setupForEachRefRepo creates branches and tags on a history of three
+// commits a minute apart
+func setupForEachRefRepo(t *testing.T) *Repository {
+	t.Helper()
+
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	first := commitAs(t, repo, "Alice", "alice@example.com", "First", 1)
+	second := commitAs(t, repo, "Bob", "bob@example.com", "Second\n\nWith a body", 2)
+	commitAs(t, repo, "Alice", "alice@example.com", "Third", 3)
+
+	if err := repo.CreateBranch("release/1.x", second); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateBranch("old", first); err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{"v1.9", "v1.10"} {
+		opts := DefaultTagOptions()
+		opts.Message = "Release " + tag
+		if _, err := repo.CreateTag(tag, second.String(), opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repo.CreateTag("v2", "HEAD", DefaultTagOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	return repo
+}
+
+// TestForEachRef tests selecting, sorting and formatting refs
+func TestForEachRef(t *testing.T) {
+	repo := setupForEachRefRepo(t)
+	branch, err := repo.CurrentBranch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts ForEachRefOptions
+		want []string
+	}{
+		{
+			"branches by newest commit",
+			ForEachRefOptions{
+				Patterns: []string{"refs/heads"},
+				Sort:     []string{"-committerdate"},
+				Format:   "%(HEAD) %(refname:short) %(subject) %(authorname)",
+			},
+			[]string{"* " + branch + " Third Alice", "  release/1.x Second Bob", "  old First Alice"},
+		},
+		{
+			"tags by version",
+			ForEachRefOptions{
+				Patterns: []string{"refs/tags/v1*"},
+				Sort:     []string{"version:refname"},
+				Format:   "%(refname:lstrip=2) %(objecttype) %(*objecttype) %(contents)",
+			},
+			[]string{"v1.9 tag commit Release v1.9\n", "v1.10 tag commit Release v1.10\n"},
+		},
+		{
+			"glob without crossing slashes",
+			ForEachRefOptions{Patterns: []string{"refs/heads/*"}, Format: "%(refname)"},
+			[]string{"refs/heads/" + branch, "refs/heads/old"},
+		},
+		{
+			"message parts and escapes",
+			ForEachRefOptions{
+				Patterns: []string{"refs/heads/release"},
+				Format:   "%(subject)%09%(body)%%%(committerdate:short)",
+			},
+			[]string{"Second\tWith a body\n%2024-01-01"},
+		},
+		{
+			"count",
+			ForEachRefOptions{Sort: []string{"-refname"}, Count: 2, Format: "%(refname:rstrip=1)"},
+			[]string{"refs/tags", "refs/tags"},
+		},
+	}
+
+	for _, tt := range tests {
+		refs, err := repo.ForEachRef(tt.opts)
+		if err != nil {
+			t.Fatalf("%s: ForEachRef failed: %v", tt.name, err)
+		}
+		got := make([]string, len(refs))
+		for i, ref := range refs {
+			got[i] = ref.Output
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+
+	for _, opts := range []ForEachRefOptions{
+		{Format: "%(nosuchfield)"},
+		{Format: "%(refname"},
+		{Sort: []string{"-nosuchfield"}},
+		{Format: "%(authordate:someday)"},
+	} {
+		if _, err := repo.ForEachRef(opts); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+}
+
+// TestListBranchesNested tests that branch names with slashes are listed
+func TestListBranchesNested(t *testing.T) {
+	repo := setupForEachRefRepo(t)
+	branch, err := repo.CurrentBranch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	branches, err := repo.ListBranches()
+	if err != nil {
+		t.Fatalf("ListBranches failed: %v", err)
+	}
+	if want := []string{branch, "old", "release/1.x"}; !reflect.DeepEqual(branches, want) {
+		t.Errorf("Expected %v, got %v", want, branches)
+	}
+}
+
+// TestCompareVersions tests ordering names with numbers in them
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.9", "v1.10", -1},
+		{"v1.10", "v1.9", 1},
+		{"v1.010", "v1.10", 0},
+		{"v1.2", "v1.2.1", -1},
+		{"a", "b", -1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, expected %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// mboxFromDate is the fixed date git puts on each patch's mbox separator,
+// which lets a patch be told apart from a "From " line in a message
+const mboxFromDate = "Mon Sep 17 00:00:00 2001"
+
+// patchNameMax is the longest file name FormatPatch generates
+const patchNameMax = 64
+
+// FormatPatchOptions contains options for FormatPatch
+type FormatPatchOptions struct {
+	// SubjectPrefix is the tag put in brackets before each subject
+	SubjectPrefix string
+	// Numbered numbers the subjects ([PATCH 1/1]) even for a single patch
+	Numbered bool
+	// Signature is written below the "-- " line ending each patch; an
+	// empty signature leaves the block out
+	Signature string
+}
+
+// DefaultFormatPatchOptions returns default format-patch options
+func DefaultFormatPatchOptions() FormatPatchOptions {
+	return FormatPatchOptions{
+		SubjectPrefix: "PATCH",
+		Numbered:      false,
+		Signature:     "browser-git",
+	}
+}
+
+// FormattedPatch is one commit formatted as an email
+type FormattedPatch struct {
+	Commit hash.Hash
+	// Filename is the name git format-patch gives the file, such as
+	// 0001-Fix-typo.patch
+	Filename string
+	// Content is the patch as one mbox message. Concatenating the
+	// contents of a series gives an mbox that Am accepts.
+	Content string
+}
+
+// FormatPatch formats each non-merge commit in a revision range as an
+// email, oldest first, like git format-patch. A single revision selects
+// the commits since it, so "origin/main" means "origin/main..HEAD".
+func (r *Repository) FormatPatch(revRange string, opts FormatPatchOptions) ([]FormattedPatch, error) {
+	if revRange == "" {
+		return nil, fmt.Errorf("no revision range specified")
+	}
+	if !strings.Contains(revRange, "..") {
+		revRange += ".."
+	}
+
+	entries, err := r.CommitsInRange(revRange)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parents come before their children; merges are left out
+	var ordered []*LogEntry
+	inRange := make(map[string]*LogEntry)
+	for _, entry := range entries {
+		inRange[entry.Hash.String()] = entry
+	}
+	emitted := make(map[string]bool)
+	var emit func(entry *LogEntry)
+	emit = func(entry *LogEntry) {
+		key := entry.Hash.String()
+		if emitted[key] {
+			return
+		}
+		emitted[key] = true
+		for _, parent := range entry.Parents {
+			if p, ok := inRange[parent.String()]; ok {
+				emit(p)
+			}
+		}
+		if len(entry.Commit.Parents) <= 1 {
+			ordered = append(ordered, entry)
+		}
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		emit(entries[i])
+	}
+
+	// Binary changes are included so that the series applies
+	diffOpts := DefaultDiffOptions()
+	diffOpts.Renames = false
+	diffOpts.Hunks = true
+	diffOpts.BinaryPatches = true
+
+	patches := make([]FormattedPatch, 0, len(ordered))
+	for i, entry := range ordered {
+		show, err := r.showCommit(entry.Hash.String(), diffOpts)
+		if err != nil {
+			return nil, err
+		}
+		commit := entry.Commit
+
+		firstLine, _, _ := strings.Cut(strings.TrimSpace(commit.Message), "\n")
+		subject, body := splitPatchMessage(commit.Message)
+		tag := opts.SubjectPrefix
+		if opts.Numbered || len(ordered) > 1 {
+			tag = strings.TrimSpace(fmt.Sprintf("%s %d/%d", tag, i+1, len(ordered)))
+		}
+		if tag != "" {
+			subject = "[" + tag + "] " + subject
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "From %s %s\n", entry.Hash.String(), mboxFromDate)
+		fmt.Fprintf(&b, "From: %s <%s>\n", encodeHeaderWord(commit.Author.Name), commit.Author.Email)
+		fmt.Fprintf(&b, "Date: %s\n", commit.Author.When.Format("Mon, 2 Jan 2006 15:04:05 -0700"))
+		fmt.Fprintf(&b, "Subject: %s\n", encodeHeaderWord(subject))
+		if !isASCII(body) || !isASCII(show.Patch) {
+			b.WriteString("MIME-Version: 1.0\n")
+			b.WriteString("Content-Type: text/plain; charset=UTF-8\n")
+			b.WriteString("Content-Transfer-Encoding: 8bit\n")
+		}
+		b.WriteString("\n")
+		b.WriteString(body)
+		b.WriteString("\n")
+		b.WriteString(show.Patch)
+		if opts.Signature != "" {
+			fmt.Fprintf(&b, "-- \n%s\n\n", opts.Signature)
+		}
+
+		patches = append(patches, FormattedPatch{
+			Commit:   entry.Hash,
+			Filename: patchFilename(i+1, firstLine),
+			Content:  b.String(),
+		})
+	}
+
+	return patches, nil
+}
+
+// splitPatchMessage splits a commit message into an email subject, its
+// first paragraph joined into one line, and the rest of the message
+func splitPatchMessage(message string) (subject, body string) {
+	message = strings.TrimLeft(message, "\n")
+	paragraph, rest, _ := strings.Cut(message, "\n\n")
+	subject = strings.Join(strings.Fields(paragraph), " ")
+
+	rest = strings.Trim(rest, "\n")
+	if rest != "" {
+		body = rest + "\n"
+	}
+	return subject, body
+}
+
+// patchFilename returns format-patch's file name for a patch: its number
+// and the sanitized subject
+func patchFilename(n int, subject string) string {
+	prefix := fmt.Sprintf("%04d-", n)
+	const suffix = ".patch"
+
+	name := sanitizeSubject(subject)
+	if max := patchNameMax - len(prefix) - len(suffix); len(name) > max {
+		name = name[:max]
+	}
+	name = strings.TrimRight(name, ".-")
+	return prefix + name + suffix
+}
+
+// sanitizeSubject makes a subject usable as a file name, as git's %f
+// does: runs of characters other than letters, digits, dots and
+// underscores become one dash, and runs of dots one dot
+func sanitizeSubject(subject string) string {
+	var b strings.Builder
+	dash := false
+	for i := 0; i < len(subject); i++ {
+		c := subject[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteByte(c)
+			for c == '.' && i+1 < len(subject) && subject[i+1] == '.' {
+				i++
+			}
+		} else {
+			dash = true
+		}
+	}
+	return strings.TrimRight(b.String(), ".-")
+}
+
+// encodeHeaderWord encodes a header value as RFC 2047 words when it is
+// not plain ASCII
+func encodeHeaderWord(s string) string {
+	if isASCII(s) {
+		return s
+	}
+	return mime.QEncoding.Encode("UTF-8", s)
+}
+
+// isASCII reports whether s contains only ASCII characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFormatPatch tests the mbox headers, numbering and file names of a
+// patch series
+func TestFormatPatch(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "a\n")
+	commitAs(t, repo, "Zoë Writer", "zoe@example.com", "Change the file", 1)
+	if err := os.WriteFile(filepath.Join(repo.Path, "new.txt"), []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := addFile(repo, "new.txt"); err != nil {
+		t.Fatal(err)
+	}
+	second, err := createCommit(repo, "Add new.txt: a file\n\nIt has a body.\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patches, err := repo.FormatPatch(commits[0].String(), DefaultFormatPatchOptions())
+	if err != nil {
+		t.Fatalf("FormatPatch failed: %v", err)
+	}
+	if len(patches) != 2 || !patches[1].Commit.Equals(second) {
+		t.Fatalf("Expected 2 patches ending with %s, got %+v", second, patches)
+	}
+
+	if patches[0].Filename != "0001-Change-the-file.patch" || patches[1].Filename != "0002-Add-new.txt-a-file.patch" {
+		t.Errorf("Unexpected file names %q, %q", patches[0].Filename, patches[1].Filename)
+	}
+	for _, want := range []string{
+		"From: =?UTF-8?q?Zo=C3=AB_Writer?= <zoe@example.com>\n",
+		"Date: Mon, 1 Jan 2024 00:01:00 +0000\n",
+		"Subject: [PATCH 1/2] Change the file\n",
+		"\n-a\n+Change the file\n",
+		"-- \nbrowser-git\n",
+	} {
+		if !strings.Contains(patches[0].Content, want) {
+			t.Errorf("Expected the first patch to contain %q:\n%s", want, patches[0].Content)
+		}
+	}
+	if !strings.HasPrefix(patches[1].Content, "From "+second.String()+" "+mboxFromDate+"\n") {
+		t.Errorf("Expected an mbox separator, got:\n%s", patches[1].Content)
+	}
+	if !strings.Contains(patches[1].Content, "Subject: [PATCH 2/2] Add new.txt: a file\n\nIt has a body.\n\ndiff --git a/new.txt b/new.txt\n") {
+		t.Errorf("Unexpected second patch:\n%s", patches[1].Content)
+	}
+
+	// A single patch is not numbered
+	opts := DefaultFormatPatchOptions()
+	opts.SubjectPrefix = "RFC"
+	patches, err = repo.FormatPatch("HEAD~1..HEAD", opts)
+	if err != nil {
+		t.Fatalf("FormatPatch failed: %v", err)
+	}
+	if len(patches) != 1 || !strings.Contains(patches[0].Content, "Subject: [RFC] Add new.txt: a file\n") {
+		t.Errorf("Expected one unnumbered patch, got %+v", patches)
+	}
+
+	if _, err := repo.FormatPatch("", DefaultFormatPatchOptions()); err == nil {
+		t.Error("Expected an error for an empty range")
+	}
+}
+
+// TestPatchFilename tests how subjects become patch file names
+func TestPatchFilename(t *testing.T) {
+	tests := []struct {
+		n       int
+		subject string
+		want    string
+	}{
+		{1, "Fix typo", "0001-Fix-typo.patch"},
+		{12, "  [core] don't crash!  ", "0012-core-don-t-crash.patch"},
+		{3, "Bump to v1.2.", "0003-Bump-to-v1.2.patch"},
+		{4, strings.Repeat("word ", 20), "0004-" + strings.Repeat("word-", 10) + "wor.patch"},
+	}
+	for _, tt := range tests {
+		if got := patchFilename(tt.n, tt.subject); got != tt.want {
+			t.Errorf("patchFilename(%d, %q) = %q, want %q", tt.n, tt.subject, got, tt.want)
+		}
+	}
+}
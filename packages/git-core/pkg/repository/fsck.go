@@ -0,0 +1,400 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// FsckIssueKind classifies a problem found by Fsck
+type FsckIssueKind string
+
+const (
+	// FsckCorrupt is an object that cannot be decompressed or parsed
+	FsckCorrupt FsckIssueKind = "corrupt"
+	// FsckHashMismatch is an object whose content does not match its name
+	FsckHashMismatch FsckIssueKind = "hash-mismatch"
+	// FsckBadLink is an object that points to an object of the wrong type
+	FsckBadLink FsckIssueKind = "bad-link"
+	// FsckMissing is an object that is referenced but not stored
+	FsckMissing FsckIssueKind = "missing"
+	// FsckDangling is an unreachable object no other object points to
+	FsckDangling FsckIssueKind = "dangling"
+	// FsckBadRef is a ref that is unreadable or points to a missing object
+	FsckBadRef FsckIssueKind = "bad-ref"
+)
+
+// FsckOptions contains options for Fsck
+type FsckOptions struct {
+	// Connectivity checks that everything reachable from refs is present
+	Connectivity bool
+	// Dangling reports unreachable objects that nothing points to
+	Dangling bool
+	// Reflogs treats reflog entries as reachable, as git fsck does
+	Reflogs bool
+}
+
+// DefaultFsckOptions returns default fsck options
+func DefaultFsckOptions() FsckOptions {
+	return FsckOptions{
+		Connectivity: true,
+		Dangling:     true,
+		Reflogs:      true,
+	}
+}
+
+// FsckIssue describes one problem found by Fsck
+type FsckIssue struct {
+	Kind FsckIssueKind
+	// Hash is the object the issue is about (nil for unreadable refs)
+	Hash hash.Hash
+	// Type is the object's type, when known
+	Type object.Type
+	// Ref is the ref the issue is about, for bad refs
+	Ref string
+	// Referrer is an object pointing to a missing or mistyped object
+	Referrer hash.Hash
+	// Message describes the problem
+	Message string
+}
+
+// fsckLink is a pointer from one object to another, with the type the
+// target must have
+type fsckLink struct {
+	target   hash.Hash
+	wantType object.Type
+}
+
+// Fsck verifies the object database: every stored object must hash to its
+// name and parse, every ref must point to a stored object, and everything
+// reachable from refs, HEAD, the index and reflogs must be present. In a
+// partial clone, objects missing locally are assumed to be promised by the
+// remote, and commits at a shallow boundary may lack their parents.
+func (r *Repository) Fsck(opts FsckOptions) (*FsckReport, error) {
+	// The object store is shared, so every namespace's refs are roots
+	if r.Namespace != "" {
+		return r.withoutNamespace().Fsck(opts)
+	}
+	report := &FsckReport{
+		Missing:    make([]hash.Hash, 0),
+		Corrupt:    make([]hash.Hash, 0),
+		BrokenRefs: make([]string, 0),
+		Malformed:  make([]hash.Hash, 0),
+		Dangling:   make([]hash.Hash, 0),
+		Issues:     make([]FsckIssue, 0),
+	}
+
+	// Read loose and packed objects directly, so missing objects are never
+	// fetched from a promisor remote while checking
+	storage := r.newPackStorage()
+	defer storage.Close()
+	hashes, err := storage.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i].String() < hashes[j].String() })
+
+	types := make(map[string]object.Type)
+	links := make(map[string][]fsckLink)
+	corrupt := make(map[string]bool)
+	shallow := r.shallowSet()
+
+	for _, h := range hashes {
+		report.Checked++
+
+		obj, issue := r.fsckObject(storage, h)
+		if issue != nil {
+			report.addIssue(*issue)
+			corrupt[h.String()] = true
+			continue
+		}
+		types[h.String()] = obj.Type()
+		links[h.String()] = objectLinks(obj, shallow[h.String()])
+
+		var invalid error
+		switch o := obj.(type) {
+		case *object.Commit:
+			invalid = o.Validate()
+		case *object.Tag:
+			invalid = o.Validate()
+		}
+		if invalid != nil {
+			report.Malformed = append(report.Malformed, h)
+		}
+	}
+
+	// Check that links point to objects of the right type
+	referenced := make(map[string]bool)
+	for _, h := range hashes {
+		for _, link := range links[h.String()] {
+			referenced[link.target.String()] = true
+			if t, ok := types[link.target.String()]; ok && t != link.wantType {
+				report.addIssue(FsckIssue{
+					Kind: FsckBadLink,
+					Hash: h,
+					Type: types[h.String()],
+					Message: fmt.Sprintf("%s %s points to %s %s, expected a %s",
+						types[h.String()], shortHash(h), t, shortHash(link.target), link.wantType),
+				})
+			}
+		}
+	}
+
+	if !opts.Connectivity && !opts.Dangling {
+		return report, nil
+	}
+
+	roots, badRefs := r.fsckRoots(opts)
+	for _, issue := range badRefs {
+		report.addIssue(issue)
+	}
+
+	partial := r.IsPartialClone()
+	reachable := make(map[string]bool)
+	missing := make(map[string]bool)
+
+	queue := []hash.Hash{}
+	for _, root := range roots {
+		if _, ok := types[root.hash.String()]; !ok {
+			if opts.Connectivity && !partial && !corrupt[root.hash.String()] {
+				report.addIssue(FsckIssue{
+					Kind:    FsckBadRef,
+					Hash:    root.hash,
+					Ref:     root.name,
+					Message: fmt.Sprintf("%s points to missing object %s", root.name, root.hash.String()),
+				})
+			}
+			continue
+		}
+		queue = append(queue, root.hash)
+	}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		key := current.String()
+		if reachable[key] {
+			continue
+		}
+		reachable[key] = true
+
+		for _, link := range links[key] {
+			linkKey := link.target.String()
+			if _, ok := types[linkKey]; ok {
+				queue = append(queue, link.target)
+				continue
+			}
+			// Corrupt objects are stored, and already reported
+			if opts.Connectivity && !partial && !missing[linkKey] && !corrupt[linkKey] {
+				missing[linkKey] = true
+				report.addIssue(FsckIssue{
+					Kind:     FsckMissing,
+					Hash:     link.target,
+					Type:     link.wantType,
+					Referrer: current,
+					Message:  fmt.Sprintf("missing %s %s", link.wantType, linkKey),
+				})
+			}
+		}
+	}
+
+	if opts.Dangling {
+		for _, h := range hashes {
+			key := h.String()
+			t, ok := types[key]
+			if !ok || reachable[key] || referenced[key] {
+				continue
+			}
+			report.addIssue(FsckIssue{
+				Kind:    FsckDangling,
+				Hash:    h,
+				Type:    t,
+				Message: fmt.Sprintf("dangling %s %s", t, key),
+			})
+		}
+	}
+
+	return report, nil
+}
+
+// addIssue records an issue and lists it under the matching summary
+func (f *FsckReport) addIssue(issue FsckIssue) {
+	f.Issues = append(f.Issues, issue)
+
+	switch issue.Kind {
+	case FsckCorrupt, FsckHashMismatch, FsckBadLink:
+		f.Corrupt = append(f.Corrupt, issue.Hash)
+	case FsckMissing:
+		f.Missing = append(f.Missing, issue.Hash)
+	case FsckDangling:
+		f.Dangling = append(f.Dangling, issue.Hash)
+	case FsckBadRef:
+		f.BrokenRefs = append(f.BrokenRefs, issue.Ref)
+	}
+}
+
+// fsckObject reads, hashes and parses one stored object
+func (r *Repository) fsckObject(storage object.Storage, h hash.Hash) (object.Object, *FsckIssue) {
+	corrupt := func(kind FsckIssueKind, format string, args ...interface{}) *FsckIssue {
+		return &FsckIssue{Kind: kind, Hash: h, Message: fmt.Sprintf(format, args...)}
+	}
+
+	compressed, err := storage.Read(h)
+	if err != nil {
+		return nil, corrupt(FsckCorrupt, "failed to read object %s: %v", h.String(), err)
+	}
+	data, err := object.Decompress(compressed)
+	if err != nil {
+		return nil, corrupt(FsckCorrupt, "failed to decompress object %s: %v", h.String(), err)
+	}
+	if actual := r.Hasher.Hash(data); !actual.Equals(h) {
+		return nil, corrupt(FsckHashMismatch, "object %s hashes to %s", h.String(), actual.String())
+	}
+
+	obj, err := object.ParseObjectWithHeader(data)
+	if err != nil {
+		return nil, corrupt(FsckCorrupt, "failed to parse object %s: %v", h.String(), err)
+	}
+	obj.SetHash(h)
+
+	switch o := obj.(type) {
+	case *object.Commit:
+		if o.Tree == nil {
+			return nil, corrupt(FsckCorrupt, "commit %s has no tree", h.String())
+		}
+	case *object.Tag:
+		if o.Target == nil || !object.IsValidType(o.TargetType) {
+			return nil, corrupt(FsckCorrupt, "tag %s has no valid target", h.String())
+		}
+	}
+
+	return obj, nil
+}
+
+// objectLinks returns the objects an object points to. Parents of shallow
+// commits are not stored, so they are left out.
+func objectLinks(obj object.Object, shallow bool) []fsckLink {
+	links := []fsckLink{}
+
+	switch o := obj.(type) {
+	case *object.Commit:
+		links = append(links, fsckLink{target: o.Tree, wantType: object.TreeType})
+		if !shallow {
+			for _, parent := range o.Parents {
+				links = append(links, fsckLink{target: parent, wantType: object.CommitType})
+			}
+		}
+
+	case *object.Tree:
+		for _, entry := range o.Entries() {
+			switch entry.Mode {
+			case object.ModeGitlink:
+				// Submodule commits live in another repository
+			case object.ModeDir:
+				links = append(links, fsckLink{target: entry.Hash, wantType: object.TreeType})
+			default:
+				links = append(links, fsckLink{target: entry.Hash, wantType: object.BlobType})
+			}
+		}
+
+	case *object.Tag:
+		links = append(links, fsckLink{target: o.Target, wantType: o.TargetType})
+	}
+
+	return links
+}
+
+// fsckRoot is a starting point for the connectivity check
+type fsckRoot struct {
+	name string
+	hash hash.Hash
+}
+
+// fsckRoots returns the refs, HEAD, pseudo-refs, index entries and
+// optionally reflog entries that keep objects reachable, and the refs that
+// could not be read
+func (r *Repository) fsckRoots(opts FsckOptions) ([]fsckRoot, []FsckIssue) {
+	roots := []fsckRoot{}
+	badRefs := []FsckIssue{}
+
+	refs, err := r.ListRefs("refs/")
+	if err != nil {
+		badRefs = append(badRefs, FsckIssue{Kind: FsckBadRef, Ref: "refs/", Message: err.Error()})
+	}
+	for _, ref := range refs {
+		h, err := r.ResolveRef(ref)
+		if err != nil {
+			badRefs = append(badRefs, FsckIssue{Kind: FsckBadRef, Ref: ref, Message: err.Error()})
+			continue
+		}
+		roots = append(roots, fsckRoot{name: ref, hash: h})
+	}
+
+	// HEAD may point to an unborn branch, which is not an error
+	if head, err := r.HEAD(); err == nil && !strings.HasPrefix(head, "ref: ") {
+		h, err := hash.ParseHash(head)
+		if err != nil {
+			badRefs = append(badRefs, FsckIssue{Kind: FsckBadRef, Ref: "HEAD", Message: fmt.Sprintf("invalid HEAD: %v", err)})
+		} else {
+			roots = append(roots, fsckRoot{name: "HEAD", hash: h})
+		}
+	}
+
+	for _, name := range []string{"ORIG_HEAD", "MERGE_HEAD", "CHERRY_PICK_HEAD", "REVERT_HEAD", "REBASE_HEAD", "FETCH_HEAD"} {
+		if h := r.readStateHash(name); h != nil {
+			roots = append(roots, fsckRoot{name: name, hash: h})
+		}
+	}
+
+	if idx, err := index.Load(filepath.Join(r.GitDir, "index")); err == nil {
+		for _, entry := range idx.Entries {
+			// Blobs of newly added files are written at commit time
+			if r.ObjectDB.Has(entry.Hash) {
+				roots = append(roots, fsckRoot{name: "index:" + entry.Path, hash: entry.Hash})
+			}
+		}
+	}
+
+	if opts.Reflogs {
+		for _, ref := range r.reflogRefs() {
+			entries, err := r.Reflog(ref)
+			if err != nil {
+				continue
+			}
+			for _, entry := range entries {
+				// Expired entries may name pruned objects
+				if entry.New != nil && r.ObjectDB.Has(entry.New) {
+					roots = append(roots, fsckRoot{name: "reflog:" + ref, hash: entry.New})
+				}
+			}
+		}
+	}
+
+	return roots, badRefs
+}
+
+// reflogRefs returns the refs that have a reflog
+func (r *Repository) reflogRefs() []string {
+	logsDir := filepath.Join(r.GitDir, "logs")
+	refs := []string{}
+
+	filepath.Walk(logsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(logsDir, path)
+		if err == nil {
+			refs = append(refs, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+
+	return refs
+}
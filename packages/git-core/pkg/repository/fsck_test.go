@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// objectFilePath returns the loose object file for a hash
+func objectFilePath(repo *Repository, h hash.Hash) string {
+	s := h.String()
+	return filepath.Join(repo.ObjectsPath(), s[:2], s[2:])
+}
+
+// findIssue returns the first issue of a kind about an object
+func findIssue(report *FsckReport, kind FsckIssueKind, h hash.Hash) *FsckIssue {
+	for i, issue := range report.Issues {
+		if issue.Kind == kind && issue.Hash.Equals(h) {
+			return &report.Issues[i]
+		}
+	}
+	return nil
+}
+
+// TestFsckClean tests a healthy repository and dangling objects
+func TestFsckClean(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "one", "two")
+
+	report, err := repo.Fsck(DefaultFsckOptions())
+	if err != nil {
+		t.Fatalf("Fsck failed: %v", err)
+	}
+	if !report.OK() || report.Checked != 6 || len(report.Issues) != 0 {
+		t.Errorf("Expected a clean report of 6 objects, got %+v", report)
+	}
+
+	// An unreferenced blob and commit dangle; the commit's tree does not,
+	// because the commit points to it
+	blob, _ := repo.ObjectDB.Put(object.NewBlobFromString("lost"))
+	_, head, _ := repo.peelToCommit(commits[1])
+	orphan := object.NewCommit()
+	orphan.Tree = head.Tree
+	orphan.Author = head.Author
+	orphan.Committer = head.Committer
+	orphan.Message = "Orphan\n"
+	orphanHash, _ := repo.ObjectDB.Put(orphan)
+
+	report, err = repo.Fsck(DefaultFsckOptions())
+	if err != nil {
+		t.Fatalf("Fsck failed: %v", err)
+	}
+	if !report.OK() || len(report.Dangling) != 2 {
+		t.Fatalf("Expected two dangling objects, got %+v", report)
+	}
+	if issue := findIssue(report, FsckDangling, blob); issue == nil || issue.Type != object.BlobType {
+		t.Errorf("Expected dangling blob, got %+v", report.Issues)
+	}
+	if findIssue(report, FsckDangling, orphanHash) == nil {
+		t.Errorf("Expected dangling commit, got %+v", report.Issues)
+	}
+
+	// A ref makes the commit reachable
+	if err := repo.UpdateRef("refs/heads/orphan", orphanHash); err != nil {
+		t.Fatal(err)
+	}
+	report, _ = repo.Fsck(DefaultFsckOptions())
+	if len(report.Dangling) != 1 || !report.Dangling[0].Equals(blob) {
+		t.Errorf("Expected only the blob to dangle, got %v", report.Dangling)
+	}
+}
+
+// TestFsckDamage tests corrupt, missing and mistyped objects and bad refs
+func TestFsckDamage(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "one", "two")
+
+	_, first, _ := repo.peelToCommit(commits[0])
+	firstTree, _, _ := repo.peelToTree(commits[0])
+	blobOne := firstTree.Entries()[0].Hash
+
+	// Remove the first version of the file
+	if err := os.Remove(objectFilePath(repo, blobOne)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the second commit's tree with the content of another object
+	_, second, _ := repo.peelToCommit(commits[1])
+	path := objectFilePath(repo, second.Tree)
+	os.Chmod(path, 0644)
+	garbage, _ := object.Compress([]byte("blob 3\x00abc"))
+	if err := os.WriteFile(path, garbage, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A tree whose file entry points at a tree
+	badTree := object.NewTree()
+	badTree.AddEntryWithMode(object.ModeRegular, "file.txt", first.Tree)
+	badTreeHash, _ := repo.ObjectDB.Put(badTree)
+	if err := repo.UpdateRef("refs/tags/bad", badTreeHash); err != nil {
+		t.Fatal(err)
+	}
+
+	// Refs that are unreadable or point nowhere
+	os.WriteFile(filepath.Join(repo.GitDir, "refs", "heads", "garbage"), []byte("not a hash\n"), 0644)
+	gone := repo.Hasher.Hash([]byte("gone"))
+	if err := repo.UpdateRef("refs/heads/gone", gone); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := repo.Fsck(DefaultFsckOptions())
+	if err != nil {
+		t.Fatalf("Fsck failed: %v", err)
+	}
+	if report.OK() {
+		t.Fatal("Expected problems to be reported")
+	}
+
+	if issue := findIssue(report, FsckMissing, blobOne); issue == nil || !issue.Referrer.Equals(first.Tree) || issue.Type != object.BlobType {
+		t.Errorf("Expected missing blob referenced by the first tree, got %+v", report.Issues)
+	}
+	if findIssue(report, FsckHashMismatch, second.Tree) == nil {
+		t.Errorf("Expected hash mismatch for the second tree, got %+v", report.Issues)
+	}
+	if findIssue(report, FsckBadLink, badTreeHash) == nil {
+		t.Errorf("Expected bad link from the crafted tree, got %+v", report.Issues)
+	}
+	if len(report.Corrupt) != 2 || len(report.Missing) != 1 {
+		t.Errorf("Corrupt = %v, Missing = %v", report.Corrupt, report.Missing)
+	}
+
+	brokenRefs := map[string]bool{}
+	for _, ref := range report.BrokenRefs {
+		brokenRefs[ref] = true
+	}
+	if !brokenRefs["refs/heads/garbage"] || !brokenRefs["refs/heads/gone"] || len(brokenRefs) != 2 {
+		t.Errorf("Unexpected broken refs %v", report.BrokenRefs)
+	}
+}
+
+// TestFsckPartialClone tests that missing objects are expected in partial clones
+func TestFsckPartialClone(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "one")
+
+	tree, _, _ := repo.peelToTree(commits[0])
+	if err := os.Remove(objectFilePath(repo, tree.Entries()[0].Hash)); err != nil {
+		t.Fatal(err)
+	}
+	repo.Config.SetPromisorRemote("origin", "blob:none")
+
+	report, err := repo.Fsck(DefaultFsckOptions())
+	if err != nil {
+		t.Fatalf("Fsck failed: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("Expected promised objects to be accepted, got %+v", report.Issues)
+	}
+}
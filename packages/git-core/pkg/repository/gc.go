@@ -0,0 +1,368 @@
+package repository
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// GCOptions contains options for GC
+type GCOptions struct {
+	// ReflogExpire drops reflog entries older than this (0 keeps them all)
+	ReflogExpire time.Duration
+	// ReflogExpireUnreachable drops older entries that are no longer
+	// reachable from the ref they belong to (0 keeps them all)
+	ReflogExpireUnreachable time.Duration
+	// PruneExpire is the grace period before an unreachable loose object
+	// is deleted, protecting objects written by operations in progress.
+	// A negative value disables pruning.
+	PruneExpire time.Duration
+	// Repack writes all reachable objects, loose or packed, into a single
+	// packfile and its index, which replaces the packs before it. Loose
+	// objects are deleted once they are in the new pack, and unreachable
+	// objects only found in the old packs are left loose, to be pruned
+	// once they are older than PruneExpire.
+	Repack bool
+	// DryRun reports what would be done without changing anything
+	DryRun bool
+}
+
+// DefaultGCOptions returns the default gc options, matching Git's defaults
+func DefaultGCOptions() GCOptions {
+	return GCOptions{
+		ReflogExpire:            90 * 24 * time.Hour,
+		ReflogExpireUnreachable: 30 * 24 * time.Hour,
+		PruneExpire:             14 * 24 * time.Hour,
+		Repack:                  false,
+		DryRun:                  false,
+	}
+}
+
+// GCResult describes what GC did
+type GCResult struct {
+	// ReflogEntriesExpired is the number of reflog entries dropped
+	ReflogEntriesExpired int
+	// Pruned lists the unreachable loose objects that were deleted
+	Pruned []hash.Hash
+	// PackPath is the packfile written by Repack, relative to GitDir
+	PackPath string
+	// Packed is the number of objects written to the packfile
+	Packed int
+	// Loosened is the number of unreachable objects Repack took out of the
+	// packs it replaced
+	Loosened int
+	// LooseObjects is the number of loose objects left
+	LooseObjects int
+}
+
+// GC cleans up the repository: it expires old reflog entries, deletes
+// unreachable loose objects older than the grace period and optionally
+// repacks the reachable objects
+func (r *Repository) GC(opts GCOptions) (*GCResult, error) {
+	// The object store is shared, so every namespace's refs keep objects
+	if r.Namespace != "" {
+		return r.withoutNamespace().GC(opts)
+	}
+	result := &GCResult{Pruned: []hash.Hash{}}
+
+	// Reflogs are expired first, so objects only they kept alive can go
+	expired, err := r.expireReflogs(opts)
+	if err != nil {
+		return nil, err
+	}
+	result.ReflogEntriesExpired = expired
+
+	reachable, err := r.reachableObjects()
+	if err != nil {
+		return nil, err
+	}
+
+	storage := newFileStorage(r.ObjectsPath(), r.Hasher)
+	loose, err := storage.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	sort.Slice(loose, func(i, j int) bool { return loose[i].String() < loose[j].String() })
+
+	if opts.PruneExpire >= 0 {
+		cutoff := time.Now().Add(-opts.PruneExpire)
+		for _, h := range loose {
+			if reachable[h.String()] {
+				continue
+			}
+			info, err := os.Stat(storage.objectPath(h))
+			if err != nil || info.ModTime().After(cutoff) {
+				continue
+			}
+			if !opts.DryRun {
+				if err := storage.Delete(h); err != nil {
+					return nil, fmt.Errorf("failed to prune object %s: %w", h.String(), err)
+				}
+			}
+			result.Pruned = append(result.Pruned, h)
+		}
+	}
+	result.LooseObjects = len(loose) - len(result.Pruned)
+
+	if opts.Repack {
+		isLoose := make(map[string]bool, len(loose))
+		for _, h := range loose {
+			isLoose[h.String()] = true
+		}
+		for _, h := range result.Pruned {
+			delete(isLoose, h.String())
+		}
+
+		// Every reachable object goes into the new pack, whether it is
+		// loose or in one of the packs the new one replaces
+		packs := NewPackStorage(storage, filepath.Join(r.ObjectsPath(), "pack"), r.Hasher)
+		defer packs.Close()
+		all, err := packs.List()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+		sort.Slice(all, func(i, j int) bool { return all[i].String() < all[j].String() })
+
+		packed := []hash.Hash{}
+		loosen := []hash.Hash{}
+		for _, h := range all {
+			switch {
+			case reachable[h.String()]:
+				packed = append(packed, h)
+				if isLoose[h.String()] {
+					result.LooseObjects--
+				}
+			case !isLoose[h.String()]:
+				loosen = append(loosen, h)
+			}
+		}
+		packPath, err := r.writePack(packs, packed, loosen, opts.DryRun)
+		if err != nil {
+			return nil, err
+		}
+		result.PackPath = packPath
+		result.Packed = len(packed)
+		result.Loosened = len(loosen)
+		result.LooseObjects += len(loosen)
+	}
+
+	return result, nil
+}
+
+// reachableObjects returns every stored object reachable from refs, HEAD,
+// pseudo-refs, the index and reflogs
+func (r *Repository) reachableObjects() (map[string]bool, error) {
+	roots, _ := r.fsckRoots(FsckOptions{Reflogs: true})
+	shallow := r.shallowSet()
+
+	reachable := make(map[string]bool)
+	queue := make([]hash.Hash, 0, len(roots))
+	for _, root := range roots {
+		queue = append(queue, root.hash)
+	}
+
+	// Replaced objects keep their own history alive
+	objects := r.unreplacedObjects()
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		key := current.String()
+		if reachable[key] {
+			continue
+		}
+		reachable[key] = true
+
+		// Blobs link to nothing, so they are never loaded
+		if !objects.Has(current) {
+			continue
+		}
+		header, err := object.GetHeader(objects, current)
+		if err != nil || header.Type == object.BlobType {
+			continue
+		}
+
+		obj, err := objects.Get(current)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load object %s: %w", key, err)
+		}
+		for _, link := range objectLinks(obj, shallow[key]) {
+			if !reachable[link.target.String()] {
+				queue = append(queue, link.target)
+			}
+		}
+	}
+
+	return reachable, nil
+}
+
+// expireReflogs drops old reflog entries and returns how many were dropped
+func (r *Repository) expireReflogs(opts GCOptions) (int, error) {
+	if opts.ReflogExpire <= 0 && opts.ReflogExpireUnreachable <= 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	expired := 0
+
+	for _, ref := range r.reflogRefs() {
+		path := r.reflogPath(ref)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read reflog for %s: %w", ref, err)
+		}
+
+		// Commits reachable from the ref's current value are kept longer
+		var tipHistory map[string]bool
+
+		kept := []string{}
+		dropped := 0
+		for _, line := range strings.Split(string(data), "\n") {
+			if line == "" {
+				continue
+			}
+			entry, err := parseReflogLine(line)
+			if err != nil {
+				// Keep lines we cannot interpret rather than losing history
+				kept = append(kept, line)
+				continue
+			}
+
+			age := now.Sub(entry.Committer.When)
+			drop := opts.ReflogExpire > 0 && age > opts.ReflogExpire
+			if !drop && opts.ReflogExpireUnreachable > 0 && age > opts.ReflogExpireUnreachable {
+				if tipHistory == nil {
+					tipHistory = r.refHistory(ref)
+				}
+				drop = !tipHistory[entry.New.String()]
+			}
+
+			if drop {
+				dropped++
+			} else {
+				kept = append(kept, line)
+			}
+		}
+
+		if dropped == 0 {
+			continue
+		}
+		expired += dropped
+		if opts.DryRun {
+			continue
+		}
+
+		content := ""
+		if len(kept) > 0 {
+			content = strings.Join(kept, "\n") + "\n"
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return 0, fmt.Errorf("failed to write reflog for %s: %w", ref, err)
+		}
+	}
+
+	return expired, nil
+}
+
+// refHistory returns the commits reachable from a ref's current value
+func (r *Repository) refHistory(ref string) map[string]bool {
+	history := make(map[string]bool)
+
+	var tip hash.Hash
+	var err error
+	if ref == "HEAD" {
+		tip, err = r.ResolveHEAD()
+	} else {
+		tip, err = r.ResolveRef(ref)
+	}
+	if err != nil {
+		return history
+	}
+
+	history[tip.String()] = true
+	ancestors, err := r.GetAncestors(tip)
+	if err != nil {
+		return history
+	}
+	for _, h := range ancestors {
+		history[h.String()] = true
+	}
+	return history
+}
+
+// writePack writes objects into a new pack in objects/pack, with its
+// index, and returns the pack's path relative to GitDir. The pack replaces
+// the ones before it: once it is indexed, the objects to loosen are copied
+// out of the old packs, the loose copies of the packed objects are deleted
+// and then the old packs are.
+func (r *Repository) writePack(packs *PackStorage, hashes, loosen []hash.Hash, dryRun bool) (string, error) {
+	objects := make([]object.Object, 0, len(hashes))
+	for _, h := range hashes {
+		obj, err := r.unreplacedObjects().Get(h)
+		if err != nil {
+			return "", fmt.Errorf("failed to load object %s: %w", h.String(), err)
+		}
+		objects = append(objects, obj)
+	}
+
+	pack, err := r.createPackfileForPush(objects)
+	if err != nil {
+		return "", fmt.Errorf("failed to write packfile: %w", err)
+	}
+
+	// Like Git, name the pack after its trailing checksum
+	checksum := hex.EncodeToString(pack[len(pack)-r.Hasher.Size():])
+	relPath := filepath.ToSlash(filepath.Join("objects", "pack", "pack-"+checksum+".pack"))
+	if dryRun {
+		return relPath, nil
+	}
+
+	existing, _ := filepath.Glob(filepath.Join(r.ObjectsPath(), "pack", "pack-*.pack"))
+
+	if err := WriteFileInRepo(r.GitDir, relPath, pack, 0444); err != nil {
+		return "", fmt.Errorf("failed to write packfile: %w", err)
+	}
+	if _, err := r.writePackIndex(relPath, pack); err != nil {
+		return "", err
+	}
+
+	for _, h := range loosen {
+		data, err := packs.Read(h)
+		if err != nil {
+			return "", fmt.Errorf("failed to read object %s: %w", h.String(), err)
+		}
+		if err := packs.Storage.Write(h, data); err != nil {
+			return "", fmt.Errorf("failed to loosen object %s: %w", h.String(), err)
+		}
+	}
+	for _, h := range hashes {
+		if !packs.Storage.Has(h) {
+			continue
+		}
+		if err := packs.Storage.Delete(h); err != nil {
+			return "", fmt.Errorf("failed to delete packed object %s: %w", h.String(), err)
+		}
+	}
+
+	for _, old := range existing {
+		if filepath.Base(old) != filepath.Base(relPath) {
+			if err := os.Remove(old); err != nil {
+				return "", fmt.Errorf("failed to remove old packfile: %w", err)
+			}
+			oldIdx := strings.TrimSuffix(old, ".pack") + ".idx"
+			if err := os.Remove(oldIdx); err != nil && !os.IsNotExist(err) {
+				return "", fmt.Errorf("failed to remove old pack index: %w", err)
+			}
+		}
+	}
+
+	return relPath, nil
+}
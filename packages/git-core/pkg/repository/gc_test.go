@@ -0,0 +1,297 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+// ageObject sets a loose object's modification time into the past
+func ageObject(t *testing.T, repo *Repository, h hash.Hash, age time.Duration) {
+	t.Helper()
+	when := time.Now().Add(-age)
+	if err := os.Chtimes(objectFilePath(repo, h), when, when); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// reflogLine formats a reflog entry recorded at the given time
+func reflogLine(old, new hash.Hash, when time.Time, message string) string {
+	return fmt.Sprintf("%s %s Test User <test@example.com> %d +0000\t%s\n", old.String(), new.String(), when.Unix(), message)
+}
+
+// TestGCPrune tests that only old unreachable objects are pruned
+func TestGCPrune(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "one", "two")
+
+	oldBlob, _ := repo.ObjectDB.Put(object.NewBlobFromString("old garbage"))
+	newBlob, _ := repo.ObjectDB.Put(object.NewBlobFromString("new garbage"))
+	ageObject(t, repo, oldBlob, 30*24*time.Hour)
+	ageObject(t, repo, commits[0], 30*24*time.Hour)
+
+	opts := DefaultGCOptions()
+	opts.DryRun = true
+	result, err := repo.GC(opts)
+	if err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+	if len(result.Pruned) != 1 || !result.Pruned[0].Equals(oldBlob) || !repo.ObjectDB.Has(oldBlob) {
+		t.Fatalf("Dry run should report but keep the old blob, got %v", result.Pruned)
+	}
+
+	result, err = repo.GC(DefaultGCOptions())
+	if err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+	if len(result.Pruned) != 1 || repo.ObjectDB.Has(oldBlob) {
+		t.Errorf("Expected the old blob to be pruned, got %v", result.Pruned)
+	}
+	if !repo.ObjectDB.Has(newBlob) || !repo.ObjectDB.Has(commits[0]) {
+		t.Error("Recent and reachable objects must be kept")
+	}
+	if result.LooseObjects != 7 {
+		t.Errorf("LooseObjects = %d, expected 7", result.LooseObjects)
+	}
+
+	report, err := repo.Fsck(DefaultFsckOptions())
+	if err != nil || !report.OK() {
+		t.Errorf("Repository is damaged after GC: %+v (%v)", report, err)
+	}
+}
+
+// TestGCExpireReflogs tests reflog expiry and pruning what it released
+func TestGCExpireReflogs(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "one", "two")
+
+	// A commit that only the reflog remembers, as after a reset
+	_, head, _ := repo.peelToCommit(commits[1])
+	lost := object.NewCommit()
+	lost.Tree = head.Tree
+	lost.Parents = []hash.Hash{commits[1]}
+	lost.Author = head.Author
+	lost.Committer = head.Committer
+	lost.Message = "Lost\n"
+	lostHash, _ := repo.ObjectDB.Put(lost)
+	ageObject(t, repo, lostHash, 60*24*time.Hour)
+
+	now := time.Now()
+	zero := hash.ZeroHash(repo.Hasher.Algorithm())
+	log := reflogLine(zero, commits[0], now.Add(-100*24*time.Hour), "commit (initial): one") +
+		reflogLine(commits[0], lostHash, now.Add(-40*24*time.Hour), "commit: lost") +
+		reflogLine(lostHash, commits[1], now.Add(-40*24*time.Hour), "reset: moving to two") +
+		reflogLine(commits[1], commits[1], now, "checkout: moving from main to main")
+	for _, ref := range []string{"refs/heads/main", "HEAD"} {
+		if err := os.WriteFile(repo.reflogPath(ref), []byte(log), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Still referenced by the reflog, the lost commit survives a plain prune
+	noExpiry := DefaultGCOptions()
+	noExpiry.ReflogExpire = 0
+	noExpiry.ReflogExpireUnreachable = 0
+	result, err := repo.GC(noExpiry)
+	if err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+	if result.ReflogEntriesExpired != 0 || len(result.Pruned) != 0 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	result, err = repo.GC(DefaultGCOptions())
+	if err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+	// Per reflog: the 100 day old entry and the unreachable lost commit
+	if result.ReflogEntriesExpired != 4 {
+		t.Errorf("ReflogEntriesExpired = %d, expected 4", result.ReflogEntriesExpired)
+	}
+	if len(result.Pruned) != 1 || !result.Pruned[0].Equals(lostHash) {
+		t.Errorf("Expected the lost commit to be pruned, got %v", result.Pruned)
+	}
+
+	entries, err := repo.Reflog("refs/heads/main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[1].Message != "reset: moving to two" {
+		t.Errorf("Unexpected remaining entries %+v", entries)
+	}
+}
+
+// TestGCRepack tests writing reachable objects to a packfile
+func TestGCRepack(t *testing.T) {
+	repo, _ := setupUndoRepo(t, "one", "two")
+	garbage, _ := repo.ObjectDB.Put(object.NewBlobFromString("unreachable"))
+
+	opts := DefaultGCOptions()
+	opts.Repack = true
+	result, err := repo.GC(opts)
+	if err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+	if result.Packed != 6 {
+		t.Errorf("Packed = %d, expected 6", result.Packed)
+	}
+	if result.LooseObjects != 1 {
+		t.Errorf("LooseObjects = %d, expected the unreachable blob alone", result.LooseObjects)
+	}
+
+	data, err := os.ReadFile(filepath.Join(repo.GitDir, result.PackPath))
+	if err != nil {
+		t.Fatalf("Failed to read pack: %v", err)
+	}
+	pack, err := protocol.NewPackfileReader(bytes.NewReader(data)).ReadPackfile()
+	if err != nil {
+		t.Fatalf("Failed to parse pack: %v", err)
+	}
+	if pack.Header.ObjectCount != 6 {
+		t.Errorf("Pack has %d objects, expected 6", pack.Header.ObjectCount)
+	}
+	for _, obj := range pack.Objects {
+		if bytes.Equal(obj.Data, []byte("unreachable")) {
+			t.Error("Unreachable objects must not be packed")
+		}
+	}
+	if !repo.ObjectDB.Has(garbage) {
+		t.Error("Recent unreachable objects must be kept")
+	}
+
+	// A second repack replaces the first pack
+	commitFileContent(t, repo, "three")
+	result, err = repo.GC(opts)
+	if err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+	packs, _ := filepath.Glob(filepath.Join(repo.ObjectsPath(), "pack", "pack-*.pack"))
+	if len(packs) != 1 || filepath.Base(packs[0]) != filepath.Base(result.PackPath) || result.Packed != 9 {
+		t.Errorf("Expected a single pack of 9 objects, got %v (%d)", packs, result.Packed)
+	}
+
+	// The pack is indexed, and the first pack's index went with it
+	indexes, _ := filepath.Glob(filepath.Join(repo.ObjectsPath(), "pack", "pack-*.idx"))
+	if len(indexes) != 1 || strings.TrimSuffix(indexes[0], ".idx") != strings.TrimSuffix(packs[0], ".pack") {
+		t.Fatalf("Expected the pack's index alone, got %v", indexes)
+	}
+	data, err = os.ReadFile(indexes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := protocol.ReadPackIndex(data, repo.Hasher)
+	if err != nil {
+		t.Fatalf("ReadPackIndex failed: %v", err)
+	}
+	if len(idx.Entries) != 9 {
+		t.Errorf("Expected 9 indexed objects, got %d", len(idx.Entries))
+	}
+	for _, entry := range idx.Entries {
+		if !repo.ObjectDB.Has(hash.NewHash(entry.Hash)) {
+			t.Errorf("Indexed object %x is not in the repository", entry.Hash)
+		}
+	}
+
+	// Indexing again gives the same file
+	if err := os.Remove(indexes[0]); err != nil {
+		t.Fatal(err)
+	}
+	idxPath, err := repo.IndexPack(result.PackPath)
+	if err != nil {
+		t.Fatalf("IndexPack failed: %v", err)
+	}
+	again, err := os.ReadFile(filepath.Join(repo.GitDir, idxPath))
+	if err != nil || !bytes.Equal(again, data) {
+		t.Errorf("Expected the same index at %s, got %v", idxPath, err)
+	}
+}
+
+// TestGCRepackKeptPack tests repacking a clone whose objects are partly
+// only in a pack: they go into the new pack, unreachable ones are left
+// loose, and fsck finds everything
+func TestGCRepackKeptPack(t *testing.T) {
+	source := setupLocalCloneSource(t)
+	clone, err := Clone(source.Path, filepath.Join(t.TempDir(), "clone"), DefaultCloneOptions())
+	if err != nil {
+		t.Fatalf("Local clone failed: %v", err)
+	}
+
+	// Keep the cloned history in a pack alone, with an unreachable blob
+	hashes, err := newFileStorage(clone.ObjectsPath(), clone.Hasher).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := []protocol.PackfileObject{}
+	for _, h := range hashes {
+		obj, err := clone.ObjectDB.Get(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		objType, err := packObjectType(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var data bytes.Buffer
+		if err := obj.Serialize(&data); err != nil {
+			t.Fatal(err)
+		}
+		objects = append(objects, protocol.PackfileObject{Type: objType, Size: uint64(data.Len()), Data: data.Bytes()})
+	}
+	garbage := []byte("only in the pack\n")
+	objects = append(objects, protocol.PackfileObject{Type: protocol.ObjBlob, Size: uint64(len(garbage)), Data: garbage})
+	var buf bytes.Buffer
+	if err := protocol.NewPackfileWriter(&buf).WritePackfile(objects); err != nil {
+		t.Fatal(err)
+	}
+	writeTestPack(t, clone, buf.Bytes())
+	for _, h := range hashes {
+		if err := os.Remove(objectFilePath(clone, h)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	head := commitFileContent(t, clone, "three")
+	opts := DefaultGCOptions()
+	opts.Repack = true
+	result, err := clone.GC(opts)
+	if err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+	if result.Packed != len(hashes)+3 || result.Loosened != 1 || result.LooseObjects != 1 {
+		t.Errorf("Expected %d packed objects and the garbage alone loose, got %+v", len(hashes)+3, result)
+	}
+	packs, _ := filepath.Glob(filepath.Join(clone.ObjectsPath(), "pack", "pack-*.pack"))
+	if len(packs) != 1 || filepath.Base(packs[0]) != filepath.Base(result.PackPath) {
+		t.Errorf("Expected the new pack alone, got %v", packs)
+	}
+	garbageID := hash.HashBlob(clone.Hasher, garbage)
+	if _, err := os.Stat(objectFilePath(clone, garbageID)); err != nil {
+		t.Errorf("Expected the unreachable blob to be left loose: %v", err)
+	}
+
+	report, err := clone.Fsck(DefaultFsckOptions())
+	if err != nil || !report.OK() {
+		t.Fatalf("Repository is damaged after GC: %+v (%v)", report, err)
+	}
+	if report.Checked != result.Packed+1 || len(report.Dangling) != 1 || !report.Dangling[0].Equals(garbageID) {
+		t.Errorf("Expected fsck to check %d objects and find the blob dangling, got %+v", result.Packed+1, report)
+	}
+	log, err := clone.Log("HEAD", DefaultLogOptions())
+	if err != nil || len(log) != 3 || !log[0].Hash.Equals(head) {
+		t.Errorf("Expected 3 commits from the repacked history, got %d (%v)", len(log), err)
+	}
+
+	stats, err := clone.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.InPack != result.Packed || stats.LooseObjects != 1 || stats.Packs != 1 {
+		t.Errorf("Unexpected stats after repack %+v", stats)
+	}
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// GrepOptions configures Grep
+type GrepOptions struct {
+	// IgnoreCase matches without regard to case, like -i
+	IgnoreCase bool
+	// FixedStrings treats the pattern as a literal string, like -F
+	FixedStrings bool
+	// InvertMatch reports lines that don't match, like -v
+	InvertMatch bool
+	// Paths limits the search to these files or directories
+	Paths []string
+	// MaxCount stops after this many matching lines per file, like -m.
+	// Zero means no limit.
+	MaxCount int
+}
+
+// DefaultGrepOptions returns default grep options
+func DefaultGrepOptions() GrepOptions {
+	return GrepOptions{
+		IgnoreCase:   false,
+		FixedStrings: false,
+		InvertMatch:  false,
+		MaxCount:     0,
+	}
+}
+
+// GrepMatch is one matching line
+type GrepMatch struct {
+	Path string
+	// Line is the 1-based line number
+	Line int
+	// Column is the 1-based byte offset of the first match in the line, or
+	// 0 for inverted matches
+	Column int
+	// Text is the line without its line ending
+	Text string
+}
+
+// Grep searches file contents for a regular expression, like git grep.
+// With a revision the files of that tree are searched; with an empty rev
+// the tracked files in the working tree are. Patterns use Go's regexp
+// syntax. Binary files are skipped, like -I.
+func (r *Repository) Grep(pattern, rev string, opts GrepOptions) ([]GrepMatch, error) {
+	if opts.FixedStrings {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if opts.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	if rev == "" {
+		return r.grepWorktree(re, opts)
+	}
+
+	listOpts := DefaultListTreeOptions()
+	listOpts.Recursive = true
+	listOpts.Paths = opts.Paths
+	entries, err := r.ListTree(rev, listOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []GrepMatch
+	for _, entry := range entries {
+		if entry.Type != object.BlobType {
+			continue
+		}
+		content, err := r.readBlobContent(entry.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", entry.Path, err)
+		}
+		matches = append(matches, grepContent(entry.Path, content, re, opts)...)
+	}
+	return matches, nil
+}
+
+// grepWorktree searches the working tree copies of tracked files
+func (r *Repository) grepWorktree(re *regexp.Regexp, opts GrepOptions) ([]GrepMatch, error) {
+	idx, err := index.Load(filepath.Join(r.GitDir, "index"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+
+	var matches []GrepMatch
+	for i, entry := range idx.Entries {
+		// Conflicted paths have several entries but one file
+		if i > 0 && idx.Entries[i-1].Path == entry.Path {
+			continue
+		}
+		if !matchesPathFilter(entry.Path, opts.Paths) {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(r.WorkTree(), filepath.FromSlash(entry.Path)))
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Deleted, or outside the sparse-checkout cone
+				continue
+			}
+			return nil, fmt.Errorf("failed to read %s: %w", entry.Path, err)
+		}
+		matches = append(matches, grepContent(entry.Path, content, re, opts)...)
+	}
+	return matches, nil
+}
+
+// grepContent returns the lines of one file that match
+func grepContent(path string, content []byte, re *regexp.Regexp, opts GrepOptions) []GrepMatch {
+	if len(content) == 0 || isBinaryContent(content) {
+		return nil
+	}
+
+	// A trailing newline ends the last line rather than starting another
+	content = bytes.TrimSuffix(content, []byte("\n"))
+
+	var matches []GrepMatch
+	for lineNo, line := range bytes.Split(content, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+
+		loc := re.FindIndex(line)
+		if (loc != nil) == opts.InvertMatch {
+			continue
+		}
+
+		match := GrepMatch{Path: path, Line: lineNo + 1, Text: string(line)}
+		if loc != nil {
+			match.Column = loc[0] + 1
+		}
+		matches = append(matches, match)
+
+		if opts.MaxCount > 0 && len(matches) >= opts.MaxCount {
+			break
+		}
+	}
+	return matches
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// grepKeys summarises matches as "path:line:text" strings
+func grepKeys(matches []GrepMatch) []string {
+	keys := make([]string, len(matches))
+	for i, m := range matches {
+		keys[i] = m.Path + ":" + strconv.Itoa(m.Line) + ":" + m.Text
+	}
+	return keys
+}
+
+func TestGrepRevision(t *testing.T) {
+	repo := setupListTreeRepo(t)
+
+	tests := []struct {
+		name    string
+		pattern string
+		opts    GrepOptions
+		keys    []string
+	}{
+		{
+			name:    "regex",
+			pattern: `^package \w+$`,
+			opts:    DefaultGrepOptions(),
+			keys:    []string{"src/lib/extra.go:1:package lib", "src/lib/util.go:1:package lib", "src/main.go:1:package main"},
+		},
+		{
+			name:    "path filter",
+			pattern: "package",
+			opts:    GrepOptions{Paths: []string{"src/main.go"}},
+			keys:    []string{"src/main.go:1:package main"},
+		},
+		{
+			name:    "ignore case",
+			pattern: "HELLO",
+			opts:    GrepOptions{IgnoreCase: true},
+			keys:    []string{"README.md:1:hello"},
+		},
+		{
+			name:    "fixed strings",
+			pattern: "//",
+			opts:    GrepOptions{FixedStrings: true},
+			keys:    []string{"src/lib/extra.go:3:// extra"},
+		},
+		{
+			name:    "invert",
+			pattern: "package",
+			opts:    GrepOptions{InvertMatch: true, Paths: []string{"src/lib/extra.go"}},
+			keys:    []string{"src/lib/extra.go:2:", "src/lib/extra.go:3:// extra"},
+		},
+		{
+			name:    "max count",
+			pattern: ".",
+			opts:    GrepOptions{MaxCount: 1, Paths: []string{"src/lib/extra.go"}},
+			keys:    []string{"src/lib/extra.go:1:package lib"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, err := repo.Grep(tt.pattern, "HEAD", tt.opts)
+			if err != nil {
+				t.Fatalf("Grep failed: %v", err)
+			}
+			if keys := grepKeys(matches); !reflect.DeepEqual(keys, tt.keys) {
+				t.Errorf("expected %v, got %v", tt.keys, keys)
+			}
+		})
+	}
+}
+
+func TestGrepColumn(t *testing.T) {
+	repo := setupListTreeRepo(t)
+
+	matches, err := repo.Grep("main", "HEAD", DefaultGrepOptions())
+	if err != nil {
+		t.Fatalf("Grep failed: %v", err)
+	}
+	if len(matches) != 1 || matches[0].Column != 9 {
+		t.Errorf("expected one match at column 9, got %+v", matches)
+	}
+}
+
+func TestGrepWorktree(t *testing.T) {
+	repo := setupListTreeRepo(t)
+
+	if err := os.WriteFile(filepath.Join(repo.Path, "README.md"), []byte("hello\nworld\n"), 0644); err != nil {
+		t.Fatalf("Failed to write README.md: %v", err)
+	}
+	if err := os.Remove(filepath.Join(repo.Path, "src", "main.go")); err != nil {
+		t.Fatalf("Failed to remove main.go: %v", err)
+	}
+	// Untracked files aren't searched
+	if err := os.WriteFile(filepath.Join(repo.Path, "notes.txt"), []byte("world\n"), 0644); err != nil {
+		t.Fatalf("Failed to write notes.txt: %v", err)
+	}
+
+	matches, err := repo.Grep("world|main", "", DefaultGrepOptions())
+	if err != nil {
+		t.Fatalf("Grep failed: %v", err)
+	}
+	if keys, expected := grepKeys(matches), []string{"README.md:2:world"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+
+	// The committed tree is unaffected by the working tree
+	matches, err = repo.Grep("world", "HEAD", DefaultGrepOptions())
+	if err != nil {
+		t.Fatalf("Grep failed: %v", err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("expected no matches at HEAD, got %+v", matches)
+	}
+}
+
+func TestGrepInvalidPattern(t *testing.T) {
+	repo := setupListTreeRepo(t)
+
+	if _, err := repo.Grep("(", "HEAD", DefaultGrepOptions()); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
@@ -2,12 +2,15 @@ package repository
 
 import (
 	"fmt"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
-	"github.com/nseba/browser-git/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/diff"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/merge"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
 )
 
 // LogOptions contains options for log operations
@@ -18,15 +21,44 @@ type LogOptions struct {
 	// Author filters commits by author name or email
 	Author string
 
+	// Committer filters commits by committer name or email
+	Committer string
+
+	// Grep filters commits by regular expressions on their message, like
+	// git log --grep. A commit matching any of the patterns is kept.
+	Grep []string
+
+	// AllMatch keeps only commits whose message matches all Grep
+	// patterns, like --all-match
+	AllMatch bool
+
+	// InvertGrep keeps only commits whose message matches none of the Grep
+	// patterns, like --invert-grep. Author and Committer still apply as
+	// they are.
+	InvertGrep bool
+
+	// RegexpIgnoreCase matches Grep patterns without regard to case, like
+	// -i
+	RegexpIgnoreCase bool
+
+	// FixedStrings treats Grep patterns as literal strings, like -F
+	FixedStrings bool
+
 	// Since filters commits after this date
 	Since *time.Time
 
 	// Until filters commits before this date
 	Until *time.Time
 
-	// Path filters commits that touched this path
+	// Path limits the log to commits that changed this file or directory.
+	// History is simplified like git log -- <path>: a merge is only shown
+	// when it differs from all its parents at the path.
 	Path string
 
+	// Follow continues the history of the file at Path through renames
+	// and copies, like git log --follow
+	Follow bool
+
 	// Format specifies the output format (full, oneline, etc.)
 	Format LogFormat
 
@@ -38,18 +70,35 @@ type LogOptions struct {
 
 	// FirstParent follows only first parent
 	FirstParent bool
+
+	// Order is the order of the entries. Entries are always in the same
+	// order for the same history.
+	Order LogOrder
+
+	// NotesRef is the notes ref whose notes are included in each entry.
+	// Empty leaves notes out, like --no-notes.
+	NotesRef string
+
+	// UseMailmap canonicalizes authors and committers with the
+	// repository's .mailmap, like --use-mailmap. The Author filter then
+	// matches the canonical identity.
+	UseMailmap bool
 }
 
-// LogFormat specifies the format for log output
-type LogFormat int
+// LogFormat specifies the format for log output. Besides the named
+// formats it may be a format string, like git log --pretty: "format:"
+// followed by placeholders such as %H, %an, %ad and %s, "tformat:", which
+// ends the output with a newline, or a string with placeholders alone,
+// which is taken as tformat.
+type LogFormat string
 
 const (
 	// LogFormatFull shows full commit details
-	LogFormatFull LogFormat = iota
+	LogFormatFull LogFormat = "full"
 	// LogFormatOneline shows one line per commit
-	LogFormatOneline
+	LogFormatOneline LogFormat = "oneline"
 	// LogFormatShort shows abbreviated commit info
-	LogFormatShort
+	LogFormatShort LogFormat = "short"
 )
 
 // DefaultLogOptions returns default log options
@@ -60,6 +109,8 @@ func DefaultLogOptions() LogOptions {
 		Graph:       false,
 		All:         false,
 		FirstParent: false,
+		NotesRef:    DefaultNotesRef,
+		UseMailmap:  true,
 	}
 }
 
@@ -69,14 +120,37 @@ type LogEntry struct {
 	Hash    hash.Hash
 	Refs    []string // Branch/tag names pointing to this commit
 	Parents []hash.Hash
+	Notes   string // Note attached to the commit, if any
+	// Path is the name the followed file has in the commit, with
+	// LogOptions.Follow
+	Path string
+	// Side is the side of an A...B range that reaches the commit
+	Side RangeSide
 }
 
 // Log returns the commit history
 func (r *Repository) Log(startRef string, opts LogOptions) ([]*LogEntry, error) {
-	// Resolve starting point
-	var startHash hash.Hash
-	var err error
+	entries, _, err := r.log(startRef, opts)
+	return entries, err
+}
+
+// log returns the commit history, and with a sorted order all commits of
+// the walk in that order, including those that were filtered out
+func (r *Repository) log(startRef string, opts LogOptions) ([]*LogEntry, []*logCommit, error) {
+	it, err := r.LogIterator(startRef, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries, err := it.NextPage(-1)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entries, it.walked, nil
+}
 
+// resolveLogStart resolves the commit a log starts from, HEAD when
+// startRef is empty
+func (r *Repository) resolveLogStart(startRef string) (hash.Hash, error) {
 	if startRef == "" {
 		// Use HEAD
 		headStr, err := r.HEAD()
@@ -85,123 +159,182 @@ func (r *Repository) Log(startRef string, opts LogOptions) ([]*LogEntry, error)
 		}
 
 		if headStr[:5] == "ref: " {
-			refName := headStr[5:]
-			startHash, err = r.ResolveRef(refName)
+			startHash, err := r.ResolveRef(headStr[5:])
 			if err != nil {
 				return nil, fmt.Errorf("failed to resolve HEAD: %w", err)
 			}
-		} else {
-			startHash, err = hash.ParseHash(headStr)
-			if err != nil {
-				return nil, fmt.Errorf("invalid HEAD hash: %w", err)
-			}
+			return startHash, nil
 		}
-	} else {
-		// Try to resolve the ref
-		if r.BranchExists(startRef) {
-			startHash, err = r.GetBranch(startRef)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			// Try as ref or hash
-			startHash, err = r.ResolveRef(startRef)
-			if err != nil {
-				// Try as direct hash
-				startHash, err = hash.ParseHash(startRef)
-				if err != nil {
-					return nil, fmt.Errorf("invalid ref or hash: %s", startRef)
-				}
-			}
+		startHash, err := hash.ParseHash(headStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HEAD hash: %w", err)
 		}
+		return startHash, nil
 	}
 
-	// Get all refs if needed
-	refs := make(map[string][]string)
-	if opts.All || opts.Graph {
-		branches, err := r.ListBranches()
-		if err == nil {
-			for _, branch := range branches {
-				branchHash, err := r.GetBranch(branch)
-				if err == nil {
-					refs[branchHash.String()] = append(refs[branchHash.String()], branch)
-				}
-			}
+	// Try to resolve the ref
+	if r.BranchExists(startRef) {
+		return r.GetBranch(startRef)
+	}
+	// Try as ref or hash
+	startHash, err := r.ResolveRef(startRef)
+	if err != nil {
+		// Try as direct hash
+		startHash, err = hash.ParseHash(startRef)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ref or hash: %s", startRef)
 		}
 	}
+	return startHash, nil
+}
 
-	// Traverse commit history
-	entries, err := r.traverseCommits(startHash, opts, refs)
+// simplifyParents applies git's default history simplification for a path
+// filter. A commit that has the same entry at path as one of its parents
+// did not change it, and only that parent's history is followed; any other
+// commit changed the path and all its parents are followed.
+func (r *Repository) simplifyParents(commit *object.Commit, parents []hash.Hash, path string) ([]hash.Hash, bool, error) {
+	entry, err := r.pathEntry(commit.Tree, path)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	if len(parents) == 0 {
+		// A root commit is compared with the empty tree
+		return nil, entry != nil, nil
 	}
 
-	return entries, nil
+	for _, parent := range parents {
+		obj, err := r.ObjectDB.Get(parent)
+		if err != nil {
+			continue // A missing parent is never the same
+		}
+		parentCommit, ok := obj.(*object.Commit)
+		if !ok {
+			continue
+		}
+		parentEntry, err := r.pathEntry(parentCommit.Tree, path)
+		if err != nil {
+			return nil, false, err
+		}
+		if entry == nil && parentEntry == nil ||
+			entry != nil && parentEntry != nil && entry.Mode == parentEntry.Mode && entry.Hash.Equals(parentEntry.Hash) {
+			return []hash.Hash{parent}, false, nil
+		}
+	}
+	return parents, true, nil
 }
 
-// traverseCommits walks the commit graph
-func (r *Repository) traverseCommits(startHash hash.Hash, opts LogOptions, refs map[string][]string) ([]*LogEntry, error) {
-	entries := make([]*LogEntry, 0)
-	visited := make(map[string]bool)
-	queue := []hash.Hash{startHash}
+// renamedFrom returns the path the file at path in a commit had in one of
+// its parents: path itself when the parent has it, or else the file it was
+// renamed or copied from, which the rename and copy detection of opts look
+// for
+func (r *Repository) renamedFrom(commit *object.Commit, parent hash.Hash, path string, opts DiffOptions) (string, error) {
+	tree, parentCommit, err := r.peelToTree(parent)
+	if err != nil {
+		return path, nil // A missing parent ends the history anyway
+	}
+	if entry, err := r.pathEntry(parentCommit.Tree, path); err != nil || entry != nil {
+		return path, err
+	}
 
-	for len(queue) > 0 && (opts.MaxCount < 0 || len(entries) < opts.MaxCount) {
-		// Dequeue
-		currentHash := queue[0]
-		queue = queue[1:]
+	files := []FileDiff{}
+	if err := r.diffTreeEntries(parentCommit.Tree, commit.Tree, "", &files); err != nil {
+		return "", err
+	}
+	// Only the followed file is looked for, among all files of the parent
+	added := files[:0]
+	for _, file := range files {
+		if file.Change != ChangeAdded || file.Path == path {
+			added = append(added, file)
+		}
+	}
+	oldFiles := make(map[string]treeFile)
+	if err := r.collectTreeFiles(tree, "", oldFiles); err != nil {
+		return "", err
+	}
 
-		// Skip if visited
-		hashStr := currentHash.String()
-		if visited[hashStr] {
-			continue
+	renamed, err := finishDiff(added, oldFiles, opts, r.readBlobContent)
+	if err != nil {
+		return "", err
+	}
+	for _, file := range renamed {
+		if file.Path == path && file.OldPath != "" {
+			return file.OldPath, nil
 		}
-		visited[hashStr] = true
+	}
+	return path, nil
+}
 
-		// Get commit object
-		commitObj, err := r.ObjectDB.Get(currentHash)
+// pathEntry returns the entry at a slash-separated path of a tree, or nil
+// when there is none. An empty path is the tree itself.
+func (r *Repository) pathEntry(treeHash hash.Hash, path string) (*object.TreeEntry, error) {
+	entry := &object.TreeEntry{Mode: object.ModeDir, Hash: treeHash}
+	if path == "" {
+		return entry, nil
+	}
+	for _, part := range strings.Split(path, "/") {
+		if entry.Mode != object.ModeDir {
+			return nil, nil
+		}
+		entries, err := r.treeEntriesByName(entry.Hash)
 		if err != nil {
-			continue // Skip if commit not found
+			return nil, err
 		}
-
-		commit, ok := commitObj.(*object.Commit)
+		next, ok := entries[part]
 		if !ok {
-			continue
+			return nil, nil
 		}
+		entry = &next
+	}
+	return entry, nil
+}
 
-		// Apply filters
-		if !r.matchesFilters(commit, opts) {
-			// Still traverse parents
-			if !opts.FirstParent {
-				queue = append(queue, commit.Parents...)
-			} else if len(commit.Parents) > 0 {
-				queue = append(queue, commit.Parents[0])
-			}
-			continue
+// compileLogGrep compiles the Grep patterns of log options. ^ and $ match
+// at line boundaries, as git log --grep matches line by line.
+func compileLogGrep(opts LogOptions) ([]*regexp.Regexp, error) {
+	grep := make([]*regexp.Regexp, 0, len(opts.Grep))
+	for _, pattern := range opts.Grep {
+		if opts.FixedStrings {
+			pattern = regexp.QuoteMeta(pattern)
 		}
-
-		// Create log entry
-		entry := &LogEntry{
-			Commit:  commit,
-			Hash:    currentHash,
-			Refs:    refs[hashStr],
-			Parents: commit.Parents,
+		flags := "(?m)"
+		if opts.RegexpIgnoreCase {
+			flags = "(?mi)"
+		}
+		re, err := regexp.Compile(flags + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grep pattern: %w", err)
 		}
+		grep = append(grep, re)
+	}
+	return grep, nil
+}
 
-		entries = append(entries, entry)
+// attachNotes fills in the notes of log entries from a notes ref
+func (r *Repository) attachNotes(entries []*LogEntry, ref string) error {
+	notes, _, err := r.loadNotes(notesRef(ref))
+	if err != nil {
+		return err
+	}
+	if len(notes) == 0 {
+		return nil
+	}
 
-		// Add parents to queue
-		if !opts.FirstParent {
-			queue = append(queue, commit.Parents...)
-		} else if len(commit.Parents) > 0 {
-			queue = append(queue, commit.Parents[0])
+	for _, entry := range entries {
+		blob, ok := notes[entry.Hash.String()]
+		if !ok {
+			continue
+		}
+		content, err := r.readBlobContent(blob)
+		if err != nil {
+			return fmt.Errorf("failed to read note for %s: %w", shortHash(entry.Hash), err)
 		}
+		entry.Notes = string(content)
 	}
-
-	return entries, nil
+	return nil
 }
 
 // matchesFilters checks if a commit matches the filter criteria
-func (r *Repository) matchesFilters(commit *object.Commit, opts LogOptions) bool {
+func (r *Repository) matchesFilters(commit *object.Commit, opts LogOptions, grep []*regexp.Regexp) bool {
 	// Author filter
 	if opts.Author != "" {
 		authorMatch := strings.Contains(strings.ToLower(commit.Author.Name), strings.ToLower(opts.Author)) ||
@@ -211,6 +344,32 @@ func (r *Repository) matchesFilters(commit *object.Commit, opts LogOptions) bool
 		}
 	}
 
+	// Committer filter
+	if opts.Committer != "" {
+		committerMatch := strings.Contains(strings.ToLower(commit.Committer.Name), strings.ToLower(opts.Committer)) ||
+			strings.Contains(strings.ToLower(commit.Committer.Email), strings.ToLower(opts.Committer))
+		if !committerMatch {
+			return false
+		}
+	}
+
+	// Message filter
+	if len(grep) > 0 {
+		matches := 0
+		for _, re := range grep {
+			if re.MatchString(commit.Message) {
+				matches++
+			}
+		}
+		if opts.InvertGrep {
+			if matches > 0 {
+				return false
+			}
+		} else if matches == 0 || opts.AllMatch && matches < len(grep) {
+			return false
+		}
+	}
+
 	// Date filters
 	if opts.Since != nil && commit.Author.When.Before(*opts.Since) {
 		return false
@@ -219,9 +378,6 @@ func (r *Repository) matchesFilters(commit *object.Commit, opts LogOptions) bool
 		return false
 	}
 
-	// Path filter (would require diff checking - simplified for now)
-	// TODO: Implement path filtering with proper diff checking
-
 	return true
 }
 
@@ -249,12 +405,10 @@ func (r *Repository) GetCommit(hashStr string) (*object.Commit, hash.Hash, error
 	matches := make([]hash.Hash, 0)
 	for _, h := range allHashes {
 		if strings.HasPrefix(h.String(), hashStr) {
-			// Check if it's a commit
-			obj, err := r.ObjectDB.Get(h)
-			if err == nil {
-				if _, ok := obj.(*object.Commit); ok {
-					matches = append(matches, h)
-				}
+			// Check if it's a commit without decoding the content
+			header, err := object.GetHeader(r.ObjectDB, h)
+			if err == nil && header.Type == object.CommitType {
+				matches = append(matches, h)
 			}
 		}
 	}
@@ -339,7 +493,32 @@ func (r *Repository) IsAncestor(ancestor, descendant hash.Hash) (bool, error) {
 	return false, nil
 }
 
-// GetCommitsBetween returns commits between two commits (from..to)
+// AheadBehind counts the commits on local that upstream lacks (ahead) and
+// the commits on upstream that local lacks (behind), as git status reports
+// for a branch and its upstream. Both are revisions. The count paints
+// both histories down as the merge-base walk does and stops where they
+// meet rather than walking the history they share.
+func (r *Repository) AheadBehind(local, upstream string) (ahead, behind int, err error) {
+	tips := make([]hash.Hash, 2)
+	for i, rev := range []string{local, upstream} {
+		h, err := r.ResolveRevision(rev)
+		if err != nil {
+			return 0, 0, err
+		}
+		if tips[i], _, err = r.peelToCommit(h); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	ahead, behind, err = merge.AheadBehind(r.ObjectDB, tips[0], tips[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count commits: %w", err)
+	}
+	return ahead, behind, nil
+}
+
+// GetCommitsBetween returns commits between two commits (from..to). For
+// other ranges see CommitsInRange.
 func (r *Repository) GetCommitsBetween(fromHash, toHash hash.Hash) ([]*LogEntry, error) {
 	// Get all commits reachable from 'to'
 	toAncestors, err := r.GetAncestors(toHash)
@@ -403,11 +582,17 @@ func (r *Repository) GetCommitsBetween(fromHash, toHash hash.Hash) ([]*LogEntry,
 
 // FormatLogEntry formats a log entry according to the specified format
 func FormatLogEntry(entry *LogEntry, format LogFormat) string {
-	switch format {
-	case LogFormatOneline:
+	switch {
+	case format == LogFormatOneline:
 		return formatOneline(entry)
-	case LogFormatShort:
+	case format == LogFormatShort:
 		return formatShort(entry)
+	case strings.HasPrefix(string(format), "format:"):
+		return formatPretty(entry, strings.TrimPrefix(string(format), "format:"))
+	case strings.HasPrefix(string(format), "tformat:"):
+		return formatPretty(entry, strings.TrimPrefix(string(format), "tformat:")) + "\n"
+	case strings.Contains(string(format), "%"):
+		return formatPretty(entry, string(format)) + "\n"
 	default:
 		return formatFull(entry)
 	}
@@ -471,6 +656,16 @@ func formatFull(entry *LogEntry) string {
 		sb.WriteString("\n")
 	}
 
+	// Notes
+	if entry.Notes != "" {
+		sb.WriteString("\nNotes:\n")
+		for _, line := range strings.Split(strings.TrimSuffix(entry.Notes, "\n"), "\n") {
+			sb.WriteString("    ")
+			sb.WriteString(line)
+			sb.WriteString("\n")
+		}
+	}
+
 	return sb.String()
 }
 
@@ -480,6 +675,12 @@ type BlameLine struct {
 	Content    string
 	Commit     *object.Commit
 	CommitHash hash.Hash
+	// OriginalLineNumber is the line's number in the file as the commit
+	// introduced it
+	OriginalLineNumber int
+	// Path is the file the commit introduced the line in, which differs
+	// from the blamed file when the line came through a rename or copy
+	Path string
 }
 
 // BlameOptions contains options for blame operations
@@ -489,17 +690,47 @@ type BlameOptions struct {
 
 	// EndLine limits blame to lines up to this line (1-indexed)
 	EndLine int
+
+	// UseMailmap canonicalizes authors and committers with the
+	// repository's .mailmap, as git blame does
+	UseMailmap bool
+
+	// DetectMoves also follows lines moved or copied within the file, like
+	// git blame -M. A block of lines needs more than MoveScore alphanumeric
+	// characters to count.
+	DetectMoves bool
+	MoveScore   int
+
+	// CopyLevel also follows lines copied from other files, like git blame
+	// given -C CopyLevel times: 1 looks in the files the same commit
+	// modified, 2 also in all files of the parent when the commit created
+	// or renamed the file, and 3 in all files of every parent. It implies
+	// DetectMoves. A block of lines needs more than CopyScore alphanumeric
+	// characters to count.
+	CopyLevel int
+	CopyScore int
+
+	// IncrementalCallback is called with the lines of each commit as soon
+	// as they are attributed to it, like git blame --incremental reports
+	// them
+	IncrementalCallback func(lines []*BlameLine)
 }
 
 // DefaultBlameOptions returns default blame options
 func DefaultBlameOptions() BlameOptions {
 	return BlameOptions{
-		StartLine: 1,
-		EndLine:   -1, // unlimited
+		StartLine:  1,
+		EndLine:    -1, // unlimited
+		UseMailmap: true,
+		MoveScore:  20,
+		CopyScore:  40,
 	}
 }
 
-// Blame returns line-by-line history for a file
+// Blame returns line-by-line history for a file. Each line is attributed
+// to the commit that introduced it, found by passing the lines a commit
+// shares with its parents on to them, as git blame does. Renames of the
+// whole file are always followed.
 func (r *Repository) Blame(path string, commitHash hash.Hash, opts BlameOptions) ([]*BlameLine, error) {
 	// Get the commit
 	commitObj, err := r.ObjectDB.Get(commitHash)
@@ -512,40 +743,72 @@ func (r *Repository) Blame(path string, commitHash hash.Hash, opts BlameOptions)
 		return nil, fmt.Errorf("object is not a commit")
 	}
 
+	var mailmap *Mailmap
+	if opts.UseMailmap {
+		if mailmap, err = r.Mailmap(); err != nil {
+			return nil, err
+		}
+	}
+
 	// Get the file content at this commit
-	content, err := r.getFileAtCommit(path, commit)
+	path = strings.Trim(path, "/")
+	entry, err := r.pathEntry(commit.Tree, path)
 	if err != nil {
 		return nil, err
 	}
-
-	// Split into lines
-	lines := strings.Split(string(content), "\n")
+	if entry == nil {
+		return nil, fmt.Errorf("file not found: %s", path)
+	}
+	if entry.Mode == object.ModeDir {
+		return nil, fmt.Errorf("path is a directory: %s", path)
+	}
+	content, err := r.readBlobContent(entry.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load blob: %w", err)
+	}
+	lines := diff.SplitLines(content)
 
 	// Apply line range filter
 	startIdx := opts.StartLine - 1
 	if startIdx < 0 {
 		startIdx = 0
 	}
+	if startIdx > 0 && startIdx >= len(lines) {
+		return nil, fmt.Errorf("file %s has only %d lines", path, len(lines))
+	}
 
 	endIdx := len(lines)
-	if opts.EndLine > 0 && opts.EndLine <= len(lines) {
+	if opts.EndLine > 0 && opts.EndLine < endIdx {
 		endIdx = opts.EndLine
 	}
+	if endIdx < startIdx {
+		endIdx = startIdx
+	}
 
-	// For now, simple implementation: attribute all lines to the current commit
-	// A full implementation would trace back through history to find the commit
-	// that introduced each line
-	blameLines := make([]*BlameLine, 0, endIdx-startIdx)
+	b := &blamer{
+		repo:    r,
+		opts:    opts,
+		mailmap: mailmap,
+		shallow: r.shallowSet(),
+		queue:   &commitQueue{},
+		queued:  make(map[string]bool),
+		origins: make(map[string][]*blameOrigin),
+		final:   lines,
+		result:  make([]*BlameLine, endIdx-startIdx),
+		offset:  startIdx,
+	}
+	suspects := make([]blameSuspect, 0, endIdx-startIdx)
 	for i := startIdx; i < endIdx; i++ {
-		blameLines = append(blameLines, &BlameLine{
-			LineNumber: i + 1,
-			Content:    lines[i],
-			Commit:     commit,
-			CommitHash: commitHash,
-		})
+		suspects = append(suspects, blameSuspect{final: i, line: i})
+	}
+	origin := b.origin(commitHash, mailmap.MapCommit(commit), path, entry.Hash)
+	origin.lines = lines
+	b.pass(origin, suspects)
+	if err := b.run(); err != nil {
+		return nil, err
 	}
 
-	return blameLines, nil
+	return b.result, nil
 }
 
 // getFileAtCommit retrieves file content at a specific commit
@@ -7,9 +7,9 @@ import (
 	"testing"
 	"time"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
-	"github.com/nseba/browser-git/git-core/pkg/index"
-	"github.com/nseba/browser-git/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
 )
 
 // TestGetCommitFullHash tests retrieving a commit by full hash
@@ -172,6 +172,52 @@ func TestIsAncestor(t *testing.T) {
 	}
 }
 
+// TestAheadBehind tests counting a branch's commits against another's
+func TestAheadBehind(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "a\n", "b\n", "c\n")
+
+	_, tip, err := repo.peelToCommit(commits[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	side := object.NewCommit()
+	side.Tree = tip.Tree
+	side.Parents = []hash.Hash{commits[1]}
+	side.Author = tip.Author
+	side.Committer = tip.Committer
+	side.Message = "Side\n"
+	sideHash, err := repo.ObjectDB.Put(side)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateBranch("side", sideHash); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		local, upstream string
+		ahead, behind   int
+	}{
+		{"main", "main", 0, 0},
+		{"main", commits[0].String(), 2, 0},
+		{commits[0].String(), "main", 0, 2},
+		{"main", "side", 1, 1},
+	}
+	for _, tt := range tests {
+		ahead, behind, err := repo.AheadBehind(tt.local, tt.upstream)
+		if err != nil {
+			t.Fatalf("AheadBehind(%s, %s) failed: %v", tt.local, tt.upstream, err)
+		}
+		if ahead != tt.ahead || behind != tt.behind {
+			t.Errorf("AheadBehind(%s, %s): expected %d/%d, got %d/%d", tt.local, tt.upstream, tt.ahead, tt.behind, ahead, behind)
+		}
+	}
+
+	if _, _, err := repo.AheadBehind("main", "missing"); err == nil {
+		t.Error("Expected an error for an unknown revision")
+	}
+}
+
 // TestLogBasic tests basic log functionality
 func TestLogBasic(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -301,6 +347,298 @@ func TestLogAuthorFilter(t *testing.T) {
 	}
 }
 
+// TestLogPathFilter tests path-limited logs with merge simplification,
+// matching git log -- <path> on the same history
+func TestLogPathFilter(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	put := func(message string, files map[string]string, parents ...hash.Hash) hash.Hash {
+		return commitTestTree(t, repo, message, files, parents...)
+	}
+
+	// D repeats B's change on a side branch, and M2 changes a.txt while
+	// merging
+	a := put("A", map[string]string{"a.txt": "1\n", "dir/x": "1\n"})
+	b := put("B", map[string]string{"a.txt": "2\n", "dir/x": "1\n"}, a)
+	c := put("C", map[string]string{"a.txt": "1\n", "dir/x": "2\n"}, a)
+	d := put("D", map[string]string{"a.txt": "2\n", "dir/x": "2\n"}, c)
+	m1 := put("M1", map[string]string{"a.txt": "2\n", "dir/x": "2\n"}, b, d)
+	e := put("E", map[string]string{"a.txt": "2\n", "dir/x": "3\n"}, m1)
+	f := put("F", map[string]string{"a.txt": "3\n", "dir/x": "1\n"}, b)
+	m2 := put("M2", map[string]string{"a.txt": "4\n", "dir/x": "3\n"}, e, f)
+	if err := repo.CreateBranch("main", m2); err != nil {
+		t.Fatal(err)
+	}
+	repo.SetHEAD("ref: refs/heads/main")
+
+	tests := []struct {
+		path        string
+		firstParent bool
+		want        string
+	}{
+		{path: "a.txt", want: "M2 F B A"},
+		{path: "dir", want: "E C A"},
+		{path: "./dir/", want: "E C A"},
+		{path: "dir/x", want: "E C A"},
+		{path: "missing", want: ""},
+		{path: "a.txt", firstParent: true, want: "M2 B A"},
+	}
+	for _, tt := range tests {
+		opts := DefaultLogOptions()
+		opts.Path = tt.path
+		opts.FirstParent = tt.firstParent
+		entries, err := repo.Log("", opts)
+		if err != nil {
+			t.Fatalf("Log -- %s failed: %v", tt.path, err)
+		}
+		var got []string
+		for _, entry := range entries {
+			got = append(got, strings.TrimSpace(entry.Commit.Message))
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("Log -- %q (first parent %v) = %q, want %q", tt.path, tt.firstParent, strings.Join(got, " "), tt.want)
+		}
+	}
+}
+
+// TestLogFollow tests following a file through a rename and a copy,
+// matching git log --follow --name-only on the same history
+func TestLogFollow(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	var commit hash.Hash
+	for _, step := range []struct {
+		message string
+		files   map[string]string
+	}{
+		{"A", map[string]string{"a": seqLines(20), "other": "x\n"}},
+		{"B", map[string]string{"a": seqLines(21), "other": "x\n"}},
+		{"C", map[string]string{"a": seqLines(21), "other": "y\n"}},
+		{"D", map[string]string{"b": "0\n" + seqLines(21), "other": "y\n"}},
+		{"E", map[string]string{"b": "0\n" + seqLines(22), "other": "y\n"}},
+		{"F", map[string]string{"b": "0\n" + seqLines(22), "c": "0\n" + seqLines(22), "other": "y\n"}},
+		{"G", map[string]string{"b": "0\n" + seqLines(22), "c": "0\n" + seqLines(22, "9"), "other": "y\n"}},
+	} {
+		var parents []hash.Hash
+		if commit != nil {
+			parents = append(parents, commit)
+		}
+		commit = commitTestTree(t, repo, step.message, step.files, parents...)
+	}
+	if err := repo.CreateBranch("main", commit); err != nil {
+		t.Fatal(err)
+	}
+	repo.SetHEAD("ref: refs/heads/main")
+
+	for path, want := range map[string]string{
+		"c": "G c F c E b D b B a A a",
+		"b": "E b D b B a A a",
+		// The rename deletes a
+		"a": "D a B a A a",
+	} {
+		opts := DefaultLogOptions()
+		opts.Path = path
+		opts.Follow = true
+		entries, err := repo.Log("", opts)
+		if err != nil {
+			t.Fatalf("Log --follow -- %s failed: %v", path, err)
+		}
+		var got []string
+		for _, entry := range entries {
+			got = append(got, strings.TrimSpace(entry.Commit.Message), entry.Path)
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("Log --follow -- %s = %q, want %q", path, strings.Join(got, " "), want)
+		}
+	}
+
+	// Without Follow the history stops where the file was created
+	opts := DefaultLogOptions()
+	opts.Path = "c"
+	if entries, err := repo.Log("", opts); err != nil || len(entries) != 2 {
+		t.Errorf("Expected two commits without Follow, got %d (%v)", len(entries), err)
+	}
+}
+
+// TestLogGrep tests message and committer filters, matching git log on
+// the same history
+func TestLogGrep(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	var parents []hash.Hash
+	for _, c := range []struct{ message, committer string }{
+		{"Fix parser bug", "Alice"},
+		{"Add parser tests", "Bob"},
+		{"Refactor lexer\n\nfixes #12", "Carol"},
+		{"fix: typo", "Alice"},
+		{"docs", "Bob"},
+	} {
+		commit := object.NewCommit()
+		commit.Tree = writeTestTree(t, repo, map[string]string{})
+		commit.Parents = parents
+		commit.Author = object.Signature{Name: "Test User", Email: "test@example.com", When: time.Unix(1577836800, 0)}
+		commit.Committer = object.Signature{Name: c.committer, Email: strings.ToLower(c.committer) + "@example.com", When: commit.Author.When}
+		commit.Message = c.message + "\n"
+		h, err := repo.ObjectDB.Put(commit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parents = []hash.Hash{h}
+	}
+	if err := repo.CreateBranch("main", parents[0]); err != nil {
+		t.Fatal(err)
+	}
+	repo.SetHEAD("ref: refs/heads/main")
+
+	tests := []struct {
+		name   string
+		modify func(opts *LogOptions)
+		want   string
+	}{
+		{"one pattern", func(o *LogOptions) { o.Grep = []string{"parser"} }, "Add parser tests|Fix parser bug"},
+		{"any pattern", func(o *LogOptions) { o.Grep = []string{"parser", "fix"} }, "fix: typo|Refactor lexer|Add parser tests|Fix parser bug"},
+		{"all patterns", func(o *LogOptions) { o.Grep = []string{"parser", "Fix"}; o.AllMatch = true }, "Fix parser bug"},
+		{"ignore case", func(o *LogOptions) { o.Grep = []string{"fix"}; o.RegexpIgnoreCase = true }, "fix: typo|Refactor lexer|Fix parser bug"},
+		{"invert", func(o *LogOptions) { o.Grep = []string{"fix"}; o.InvertGrep = true }, "docs|Add parser tests|Fix parser bug"},
+		{"invert all", func(o *LogOptions) { o.Grep = []string{"parser", "Fix"}; o.AllMatch = true; o.InvertGrep = true }, "docs|fix: typo|Refactor lexer"},
+		{"line start", func(o *LogOptions) { o.Grep = []string{"^fix"} }, "fix: typo|Refactor lexer"},
+		{"line end", func(o *LogOptions) { o.Grep = []string{"bug$"} }, "Fix parser bug"},
+		{"fixed string", func(o *LogOptions) { o.Grep = []string{"#12"}; o.FixedStrings = true }, "Refactor lexer"},
+		{"committer", func(o *LogOptions) { o.Committer = "Alice" }, "fix: typo|Fix parser bug"},
+		{"committer and grep", func(o *LogOptions) { o.Committer = "Alice"; o.Grep = []string{"parser"} }, "Fix parser bug"},
+		{"committer and inverted grep", func(o *LogOptions) { o.Committer = "Alice"; o.Grep = []string{"parser"}; o.InvertGrep = true }, "fix: typo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultLogOptions()
+			tt.modify(&opts)
+			entries, err := repo.Log("", opts)
+			if err != nil {
+				t.Fatalf("Log failed: %v", err)
+			}
+			var got []string
+			for _, entry := range entries {
+				subject, _, _ := strings.Cut(entry.Commit.Message, "\n")
+				got = append(got, subject)
+			}
+			if strings.Join(got, "|") != tt.want {
+				t.Errorf("Got %q, want %q", strings.Join(got, "|"), tt.want)
+			}
+		})
+	}
+
+	opts := DefaultLogOptions()
+	opts.Grep = []string{"("}
+	if _, err := repo.Log("", opts); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+	opts.FixedStrings = true
+	if entries, err := repo.Log("", opts); err != nil || len(entries) != 0 {
+		t.Errorf("Expected no match for a literal pattern, got %d (%v)", len(entries), err)
+	}
+}
+
+// setupBranchyRepo creates history with skewed commit dates on main: B
+// and C branch off the root A, M merges D on B with E on C, and H merges F
+// after M with G2, which branches off C too
+func setupBranchyRepo(t *testing.T) *Repository {
+	t.Helper()
+
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	tree := writeTestTree(t, repo, map[string]string{})
+	put := func(message string, date int64, parents ...hash.Hash) hash.Hash {
+		commit := object.NewCommit()
+		commit.Tree = tree
+		commit.Parents = parents
+		commit.Author = object.Signature{Name: "Test User", Email: "test@example.com", When: time.Unix(date, 0)}
+		commit.Committer = commit.Author
+		commit.Message = message + "\n"
+		h, err := repo.ObjectDB.Put(commit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	a := put("A", 100)
+	b := put("B", 200, a)
+	c := put("C", 300, a)
+	d := put("D", 400, b)
+	e := put("E", 150, c)
+	m := put("M", 600, d, e)
+	f := put("F", 700, m)
+	g := put("G", 800, c)
+	g2 := put("G2", 250, g)
+	h := put("H", 900, f, g2)
+	i := put("I", 900, h)
+	if err := repo.CreateBranch("main", i); err != nil {
+		t.Fatal(err)
+	}
+	repo.SetHEAD("ref: refs/heads/main")
+	return repo
+}
+
+// TestLogOrder tests the default, date and topological orders on branchy
+// history with skewed dates, matching git log on the same history
+func TestLogOrder(t *testing.T) {
+	repo := setupBranchyRepo(t)
+
+	tests := []struct {
+		order    LogOrder
+		maxCount int
+		want     string
+	}{
+		{order: LogOrderDefault, maxCount: -1, want: "I H F M D G2 G C B E A"},
+		{order: LogOrderDate, maxCount: -1, want: "I H F M D G2 G B E C A"},
+		{order: LogOrderTopo, maxCount: -1, want: "I H G2 G F M E C D B A"},
+		{order: LogOrderTopo, maxCount: 4, want: "I H G2 G"},
+	}
+	for _, tt := range tests {
+		opts := DefaultLogOptions()
+		opts.Order = tt.order
+		opts.MaxCount = tt.maxCount
+		entries, err := repo.Log("", opts)
+		if err != nil {
+			t.Fatalf("Log failed: %v", err)
+		}
+		var got []string
+		for _, entry := range entries {
+			got = append(got, strings.TrimSpace(entry.Commit.Message))
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("Log in order %d = %q, want %q", tt.order, strings.Join(got, " "), tt.want)
+		}
+	}
+}
+
+// commitTestTree stores a commit of the given files with fixed signatures
+func commitTestTree(t *testing.T, repo *Repository, message string, files map[string]string, parents ...hash.Hash) hash.Hash {
+	t.Helper()
+
+	commit := object.NewCommit()
+	commit.Tree = writeTestTree(t, repo, files)
+	commit.Parents = parents
+	commit.Author = object.Signature{Name: "Test User", Email: "test@example.com", When: time.Unix(1577836800, 0)}
+	commit.Committer = commit.Author
+	commit.Message = message + "\n"
+	h, err := repo.ObjectDB.Put(commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
 // TestFormatLogEntry tests log entry formatting
 func TestFormatLogEntry(t *testing.T) {
 	// Create a test commit
@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// HookName identifies a hook point, named as in Git
+type HookName string
+
+const (
+	// HookPreCommit runs before a commit is created, with no arguments.
+	// Failing it aborts the commit.
+	HookPreCommit HookName = "pre-commit"
+
+	// HookCommitMsg runs with the path of the file holding the proposed
+	// commit message, which it may edit. Failing it aborts the commit.
+	HookCommitMsg HookName = "commit-msg"
+
+	// HookPrePush runs with the remote's name and URL, and one line per
+	// ref on stdin: "<local ref> <local hash> <remote ref> <remote hash>".
+	// Failing it aborts the push.
+	HookPrePush HookName = "pre-push"
+
+	// HookPostCheckout runs after a checkout with the previous and new
+	// HEAD, and "1" for a branch checkout or "0" for a file checkout
+	HookPostCheckout HookName = "post-checkout"
+
+	// HookPostMerge runs after a successful merge with "1" for a squash
+	// merge or "0" otherwise
+	HookPostMerge HookName = "post-merge"
+)
+
+// ErrHookRejected is wrapped by the error of an operation a hook vetoed
+var ErrHookRejected = errors.New("hook rejected the operation")
+
+// HookInvocation carries what a hook receives: the arguments and standard
+// input native Git would pass to the hook script
+type HookInvocation struct {
+	// Name is the hook point
+	Name HookName
+
+	// GitDir and WorkTree identify the repository, as GIT_DIR and the
+	// working directory a hook script would run in
+	GitDir   string
+	WorkTree string
+
+	// Args are the hook's arguments
+	Args []string
+
+	// Stdin is the hook's standard input, empty for most hooks
+	Stdin string
+}
+
+// Hook runs at a hook point. Returning an error vetoes the operation for
+// pre-commit, commit-msg and pre-push; post-* hooks run after the fact and
+// their errors are ignored, as they cannot undo the operation.
+type Hook func(inv *HookInvocation) error
+
+// HookRegistry holds the hooks registered for each hook point
+type HookRegistry struct {
+	mu     sync.RWMutex
+	hooks  map[int]registeredHook
+	nextID int
+}
+
+// registeredHook is a hook with the point it runs at
+type registeredHook struct {
+	name HookName
+	hook Hook
+}
+
+// DefaultHooks is shared by all opened repositories so that registrations
+// outlive individual Repository values
+var DefaultHooks = NewHookRegistry()
+
+// NewHookRegistry creates an empty hook registry
+func NewHookRegistry() *HookRegistry {
+	return &HookRegistry{
+		hooks: make(map[int]registeredHook),
+	}
+}
+
+// Register adds a hook for a hook point and returns an ID for Unregister
+func (h *HookRegistry) Register(name HookName, hook Hook) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	h.hooks[h.nextID] = registeredHook{name: name, hook: hook}
+	return h.nextID
+}
+
+// Unregister removes a previously registered hook
+func (h *HookRegistry) Unregister(id int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.hooks, id)
+}
+
+// Run calls the hooks registered for inv.Name in registration order,
+// stopping at the first that fails
+func (h *HookRegistry) Run(inv *HookInvocation) error {
+	h.mu.RLock()
+	ids := make([]int, 0, len(h.hooks))
+	for id, registered := range h.hooks {
+		if registered.name == inv.Name {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	hooks := make([]Hook, 0, len(ids))
+	for _, id := range ids {
+		hooks = append(hooks, h.hooks[id].hook)
+	}
+	h.mu.RUnlock()
+
+	// Call hooks without holding the lock so they may (un)register
+	for _, hook := range hooks {
+		if err := hook(inv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runHook runs the hooks for a hook point. A failing hook's error is
+// wrapped with ErrHookRejected.
+func (r *Repository) runHook(name HookName, stdin string, args ...string) error {
+	if r.Hooks == nil {
+		return nil
+	}
+
+	inv := &HookInvocation{
+		Name:     name,
+		GitDir:   r.GitDir,
+		WorkTree: r.WorkTree(),
+		Args:     args,
+		Stdin:    stdin,
+	}
+	if err := r.Hooks.Run(inv); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrHookRejected, name, err)
+	}
+	return nil
+}
+
+// runPostHook runs a post-* hook, whose outcome cannot change the
+// operation it follows
+func (r *Repository) runPostHook(name HookName, args ...string) {
+	_ = r.runHook(name, "", args...)
+}
+
+// RunCommitHooks runs the pre-commit and commit-msg hooks for a proposed
+// commit message, like git commit does before creating the commit. The
+// message is passed through COMMIT_EDITMSG, so commit-msg hooks may edit
+// it. Returns the message to commit.
+func (r *Repository) RunCommitHooks(message string) (string, error) {
+	if err := r.runHook(HookPreCommit, ""); err != nil {
+		return "", err
+	}
+
+	msgPath := filepath.Join(r.GitDir, "COMMIT_EDITMSG")
+	if err := WriteFileInRepo(r.GitDir, "COMMIT_EDITMSG", []byte(message), 0644); err != nil {
+		return "", fmt.Errorf("failed to write COMMIT_EDITMSG: %w", err)
+	}
+	if err := r.runHook(HookCommitMsg, "", msgPath); err != nil {
+		return "", err
+	}
+
+	edited, err := os.ReadFile(msgPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read COMMIT_EDITMSG: %w", err)
+	}
+	return string(edited), nil
+}
+
+// prePushInput formats the pre-push hook's standard input for the refs
+// about to be pushed
+func prePushInput(refs []refToPush) string {
+	var b strings.Builder
+	for _, ref := range refs {
+		local, localHash := ref.localName, ref.newHash
+		if isZeroHash(localHash) {
+			local = "(delete)"
+		}
+		fmt.Fprintf(&b, "%s %s %s %s\n", local, localHash, ref.remoteName, ref.oldHash)
+	}
+	return b.String()
+}
+
+// isZeroHash reports whether a hex hash is all zeros, Git's name for a
+// missing object
+func isZeroHash(h string) bool {
+	return h != "" && strings.Trim(h, "0") == ""
+}
+
+// hookHash formats a hash for a hook argument, using the zero hash for
+// a missing one as Git does
+func (r *Repository) hookHash(h hash.Hash) string {
+	if h == nil {
+		return hash.ZeroHash(r.Hasher.Algorithm()).String()
+	}
+	return h.String()
+}
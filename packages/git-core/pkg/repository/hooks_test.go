@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestHookRegistry tests that hooks run in registration order and stop at
+// the first failure
+func TestHookRegistry(t *testing.T) {
+	hooks := NewHookRegistry()
+	var calls []string
+	hooks.Register(HookPreCommit, func(*HookInvocation) error {
+		calls = append(calls, "first")
+		return nil
+	})
+	veto := hooks.Register(HookPreCommit, func(*HookInvocation) error {
+		calls = append(calls, "veto")
+		return errors.New("lint failed")
+	})
+	hooks.Register(HookPreCommit, func(*HookInvocation) error {
+		calls = append(calls, "last")
+		return nil
+	})
+	hooks.Register(HookPostMerge, func(*HookInvocation) error {
+		calls = append(calls, "other hook point")
+		return nil
+	})
+
+	if err := hooks.Run(&HookInvocation{Name: HookPreCommit}); err == nil {
+		t.Error("Expected the veto")
+	}
+	if !reflect.DeepEqual(calls, []string{"first", "veto"}) {
+		t.Errorf("Unexpected calls %v", calls)
+	}
+
+	calls = nil
+	hooks.Unregister(veto)
+	if err := hooks.Run(&HookInvocation{Name: HookPreCommit}); err != nil {
+		t.Errorf("Run failed: %v", err)
+	}
+	if !reflect.DeepEqual(calls, []string{"first", "last"}) {
+		t.Errorf("Unexpected calls %v", calls)
+	}
+}
+
+// TestCommitHooks tests that pre-commit can veto a commit and commit-msg
+// receives, and may edit, the message file
+func TestCommitHooks(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "a\n")
+	repo.Hooks = NewHookRegistry()
+
+	veto := repo.Hooks.Register(HookPreCommit, func(*HookInvocation) error {
+		return errors.New("tests failed")
+	})
+	opts := DefaultAmendOptions()
+	opts.Message = "Amended"
+	if _, err := repo.AmendCommit(opts); !errors.Is(err, ErrHookRejected) {
+		t.Fatalf("Expected the pre-commit hook to reject the commit, got %v", err)
+	}
+	if head, _ := repo.ResolveHEAD(); !head.Equals(commits[0]) {
+		t.Error("Expected HEAD to be unchanged after a veto")
+	}
+
+	opts.NoVerify = true
+	if _, err := repo.AmendCommit(opts); err != nil {
+		t.Fatalf("Expected NoVerify to skip hooks, got %v", err)
+	}
+	repo.Hooks.Unregister(veto)
+
+	var args []string
+	repo.Hooks.Register(HookCommitMsg, func(inv *HookInvocation) error {
+		args = inv.Args
+		message, err := os.ReadFile(inv.Args[0])
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(inv.Args[0], append(message, "\n\nSigned-off-by: Test User <test@example.com>\n"...), 0644)
+	})
+	opts.NoVerify = false
+	result, err := repo.AmendCommit(opts)
+	if err != nil {
+		t.Fatalf("AmendCommit failed: %v", err)
+	}
+	if len(args) != 1 || args[0] != filepath.Join(repo.GitDir, "COMMIT_EDITMSG") {
+		t.Errorf("Expected the COMMIT_EDITMSG path, got %v", args)
+	}
+	commit, _, err := repo.GetCommit(result.Commit.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit.Message != "Amended\n\nSigned-off-by: Test User <test@example.com>\n" {
+		t.Errorf("Expected the hook's edit in the message, got %q", commit.Message)
+	}
+}
+
+// TestPostCheckoutAndMergeHooks tests the arguments post-checkout and
+// post-merge receive
+func TestPostCheckoutAndMergeHooks(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "a\n", "b\n")
+	repo.Hooks = NewHookRegistry()
+
+	var invocations []HookInvocation
+	record := func(inv *HookInvocation) error {
+		invocations = append(invocations, *inv)
+		return errors.New("post hooks cannot veto")
+	}
+	repo.Hooks.Register(HookPostCheckout, record)
+	repo.Hooks.Register(HookPostMerge, record)
+
+	if err := repo.CreateBranch("topic", commits[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Checkout("topic", DefaultCheckoutOptions()); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if _, err := repo.Merge("main", DefaultMergeOptions()); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if err := repo.CheckoutFile("file.txt"); err != nil {
+		t.Fatalf("CheckoutFile failed: %v", err)
+	}
+
+	want := [][]string{
+		{commits[1].String(), commits[0].String(), "1"},
+		{"0"},
+		{commits[1].String(), commits[1].String(), "0"},
+	}
+	if len(invocations) != len(want) {
+		t.Fatalf("Expected %d hook runs, got %d", len(want), len(invocations))
+	}
+	for i, inv := range invocations {
+		if !reflect.DeepEqual(inv.Args, want[i]) {
+			t.Errorf("%s: expected args %v, got %v", inv.Name, want[i], inv.Args)
+		}
+		if inv.GitDir != repo.GitDir || inv.WorkTree != repo.WorkTree() {
+			t.Errorf("%s: unexpected repository %s", inv.Name, inv.GitDir)
+		}
+	}
+}
+
+// TestPrePushInput tests the pre-push hook's ref lines
+func TestPrePushInput(t *testing.T) {
+	zero := "0000000000000000000000000000000000000000"
+	local := "1111111111111111111111111111111111111111"
+	remote := "2222222222222222222222222222222222222222"
+
+	got := prePushInput([]refToPush{
+		{localName: "refs/heads/main", remoteName: "refs/heads/main", oldHash: remote, newHash: local},
+		{localName: "", remoteName: "refs/heads/old", oldHash: remote, newHash: zero},
+	})
+	want := "refs/heads/main " + local + " refs/heads/main " + remote + "\n" +
+		"(delete) " + zero + " refs/heads/old " + remote + "\n"
+	if got != want {
+		t.Errorf("Unexpected pre-push input:\n%s", got)
+	}
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+// IndexPack writes the v2 .idx file for a packfile in the repository, like
+// git index-pack, so its objects can be found without unpacking it. The
+// pack path and the returned index path are relative to GitDir.
+func (r *Repository) IndexPack(packPath string) (string, error) {
+	if !strings.HasSuffix(packPath, ".pack") {
+		return "", fmt.Errorf("not a packfile: %s", packPath)
+	}
+	data, err := os.ReadFile(filepath.Join(r.GitDir, filepath.FromSlash(packPath)))
+	if err != nil {
+		return "", fmt.Errorf("failed to read packfile: %w", err)
+	}
+	return r.writePackIndex(packPath, data)
+}
+
+// writePackIndex indexes the pack data stored at packPath, writing the
+// index beside it
+func (r *Repository) writePackIndex(packPath string, data []byte) (string, error) {
+	idx, err := protocol.IndexPack(data, r.Hasher, r.Limits)
+	if err != nil {
+		return "", fmt.Errorf("failed to index packfile: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := protocol.WritePackIndex(&buf, idx, r.Hasher); err != nil {
+		return "", err
+	}
+
+	idxPath := strings.TrimSuffix(packPath, ".pack") + ".idx"
+	if err := WriteFileInRepo(r.GitDir, idxPath, buf.Bytes(), 0444); err != nil {
+		return "", fmt.Errorf("failed to write pack index: %w", err)
+	}
+	return idxPath, nil
+}
+
+// VerifyPack checks a packfile in the repository against its .idx file,
+// like git verify-pack: both checksums, and the ID, offset and CRC-32 of
+// every object. Corruption is reported as a *protocol.CorruptPackError.
+// The pack path is relative to GitDir.
+func (r *Repository) VerifyPack(packPath string) error {
+	if !strings.HasSuffix(packPath, ".pack") {
+		return fmt.Errorf("not a packfile: %s", packPath)
+	}
+	data, err := os.ReadFile(filepath.Join(r.GitDir, filepath.FromSlash(packPath)))
+	if err != nil {
+		return fmt.Errorf("failed to read packfile: %w", err)
+	}
+	idxPath := strings.TrimSuffix(packPath, ".pack") + ".idx"
+	idxData, err := os.ReadFile(filepath.Join(r.GitDir, filepath.FromSlash(idxPath)))
+	if err != nil {
+		return fmt.Errorf("failed to read pack index: %w", err)
+	}
+	idx, err := protocol.ReadPackIndex(idxData, r.Hasher)
+	if err != nil {
+		return fmt.Errorf("failed to read pack index: %w", err)
+	}
+	return protocol.VerifyPack(data, idx, r.Hasher, r.Limits)
+}
+
+// checkPack checks a packfile held in memory before anything in it is
+// stored or sent: its trailing checksum and, when objects is set, that
+// every object in it resolves, taking the bases of a thin pack's deltas
+// from the repository. It returns the IDs of the objects in the pack, or
+// nil when they were not checked.
+func (r *Repository) checkPack(data []byte, objects bool) ([]hash.Hash, error) {
+	if err := protocol.VerifyPackChecksum(data, r.Hasher); err != nil {
+		return nil, err
+	}
+	if !objects {
+		return nil, nil
+	}
+
+	stored := r.unreplacedObjects()
+	idx, err := protocol.IndexThinPack(data, r.Hasher, r.Limits, func(id []byte) (uint8, []byte, bool) {
+		obj, err := stored.Get(hash.NewHash(id))
+		if err != nil {
+			return 0, nil, false
+		}
+		objType, err := packObjectType(obj)
+		if err != nil {
+			return 0, nil, false
+		}
+		var buf bytes.Buffer
+		if err := obj.Serialize(&buf); err != nil {
+			return 0, nil, false
+		}
+		return objType, buf.Bytes(), true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check pack objects: %w", err)
+	}
+	ids := make([]hash.Hash, 0, len(idx.Entries))
+	for _, entry := range idx.Entries {
+		ids = append(ids, hash.NewHash(entry.Hash))
+	}
+	return ids, nil
+}
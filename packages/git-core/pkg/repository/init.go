@@ -34,8 +34,13 @@ func Init(path string, opts InitOptions) error {
 		gitDir = filepath.Join(path, ".git")
 	}
 
-	// Check if repository already exists
-	if _, err := os.Stat(gitDir); err == nil {
+	// Check if repository already exists. A bare repository may be
+	// initialized in an existing directory, such as a fresh clone target.
+	if opts.Bare {
+		if isBareRepository(gitDir) {
+			return fmt.Errorf("repository already exists at %s", gitDir)
+		}
+	} else if _, err := os.Stat(gitDir); err == nil {
 		return fmt.Errorf("repository already exists at %s", gitDir)
 	}
 
@@ -0,0 +1,267 @@
+package repository
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// fsckPendingFile records objects queued for verification, relative to GitDir.
+// A line containing "*" requests a full scan.
+const fsckPendingFile = "fsck-pending"
+
+// FsckReport is the result of verifying stored objects and refs
+type FsckReport struct {
+	// Checked is the number of objects verified
+	Checked int
+
+	// Missing lists objects that could not be found in storage
+	Missing []hash.Hash
+
+	// Corrupt lists objects whose content does not match their hash, that
+	// cannot be parsed or that point to objects of the wrong type
+	Corrupt []hash.Hash
+
+	// BrokenRefs lists refs pointing at missing objects
+	BrokenRefs []string
+
+	// Malformed lists intact commits and tags with non-standard signature
+	// lines. These occur in real histories, so they do not fail the report.
+	Malformed []hash.Hash
+
+	// Dangling lists unreachable objects that no other object points to.
+	// Only Fsck looks for them, and they do not fail the report.
+	Dangling []hash.Hash
+
+	// Issues describes each problem Fsck found in detail
+	Issues []FsckIssue
+}
+
+// OK reports whether verification found no problems with stored data
+func (f *FsckReport) OK() bool {
+	return len(f.Missing) == 0 && len(f.Corrupt) == 0 && len(f.BrokenRefs) == 0
+}
+
+// OnStorageEvicted is called by the storage backend after it compacted or
+// evicted data. An empty list means the affected objects are unknown.
+func (r *Repository) OnStorageEvicted(hashes []hash.Hash) (*FsckReport, error) {
+	r.publish(Event{
+		Type:    EventStorageEvicted,
+		Objects: hashes,
+		Message: "storage backend evicted objects",
+	})
+
+	return r.ScheduleFsck(hashes)
+}
+
+// OnCorruptionDetected is called by the storage backend when stored data
+// failed validation
+func (r *Repository) OnCorruptionDetected(h hash.Hash, message string) (*FsckReport, error) {
+	var hashes []hash.Hash
+	if h != nil {
+		hashes = []hash.Hash{h}
+	}
+
+	r.publish(Event{
+		Type:    EventCorruptionDetected,
+		Objects: hashes,
+		Message: message,
+	})
+
+	return r.ScheduleFsck(hashes)
+}
+
+// ScheduleFsck queues objects for verification. Unless storage.autoFsck is
+// false, the queued verification runs immediately and its report is returned.
+func (r *Repository) ScheduleFsck(hashes []hash.Hash) (*FsckReport, error) {
+	var buf bytes.Buffer
+	if len(hashes) == 0 {
+		buf.WriteString("*\n")
+	}
+	for _, h := range hashes {
+		buf.WriteString(h.String() + "\n")
+	}
+
+	pendingPath := filepath.Join(r.GitDir, fsckPendingFile)
+	f, err := os.OpenFile(pendingPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open fsck queue: %w", err)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write fsck queue: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write fsck queue: %w", err)
+	}
+
+	r.publish(Event{
+		Type:    EventFsckScheduled,
+		Objects: hashes,
+		Message: "verification scheduled",
+	})
+
+	if auto, ok := r.Config.GetBool("storage", "autofsck"); ok && !auto {
+		return nil, nil
+	}
+
+	return r.RunScheduledFsck()
+}
+
+// FsckPending reports whether a scheduled verification has not run yet
+func (r *Repository) FsckPending() bool {
+	_, err := os.Stat(filepath.Join(r.GitDir, fsckPendingFile))
+	return err == nil
+}
+
+// RunScheduledFsck verifies all queued objects and clears the queue.
+// It returns nil when nothing was scheduled.
+func (r *Repository) RunScheduledFsck() (*FsckReport, error) {
+	pendingPath := filepath.Join(r.GitDir, fsckPendingFile)
+	data, err := os.ReadFile(pendingPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read fsck queue: %w", err)
+	}
+
+	full := false
+	seen := make(map[string]bool)
+	var hashes []hash.Hash
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || seen[line] {
+			continue
+		}
+		seen[line] = true
+
+		if line == "*" {
+			full = true
+			continue
+		}
+
+		h, err := hash.ParseHash(line)
+		if err != nil {
+			// Skip garbage rather than blocking all future verification
+			continue
+		}
+		hashes = append(hashes, h)
+	}
+
+	if full {
+		hashes, err = r.ObjectDB.List()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+	}
+
+	report := &FsckReport{
+		Missing:    make([]hash.Hash, 0),
+		Corrupt:    make([]hash.Hash, 0),
+		BrokenRefs: make([]string, 0),
+	}
+
+	for _, h := range hashes {
+		r.verifyObject(h, report)
+	}
+
+	if full {
+		if err := r.verifyRefs(report); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.Remove(pendingPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to clear fsck queue: %w", err)
+	}
+
+	message := "verification passed"
+	if !report.OK() {
+		message = fmt.Sprintf("verification found %d missing, %d corrupt objects and %d broken refs",
+			len(report.Missing), len(report.Corrupt), len(report.BrokenRefs))
+	}
+
+	r.publish(Event{
+		Type:    EventFsckCompleted,
+		Objects: hashes,
+		Message: message,
+		Fsck:    report,
+	})
+
+	return report, nil
+}
+
+// verifyObject checks that an object is present and matches its hash
+func (r *Repository) verifyObject(h hash.Hash, report *FsckReport) {
+	report.Checked++
+
+	if !r.ObjectDB.Has(h) {
+		report.Missing = append(report.Missing, h)
+		return
+	}
+
+	obj, err := r.unreplacedObjects().Get(h)
+	if err != nil {
+		report.Corrupt = append(report.Corrupt, h)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := obj.SerializeWithHeader(&buf); err != nil || !r.Hasher.Hash(buf.Bytes()).Equals(h) {
+		report.Corrupt = append(report.Corrupt, h)
+		return
+	}
+
+	var invalid error
+	switch o := obj.(type) {
+	case *object.Commit:
+		invalid = o.Validate()
+	case *object.Tag:
+		invalid = o.Validate()
+	}
+	if invalid != nil {
+		report.Malformed = append(report.Malformed, h)
+	}
+}
+
+// verifyRefs checks that every ref points at a readable object.
+// Only object headers are decoded, so large blobs are never loaded.
+func (r *Repository) verifyRefs(report *FsckReport) error {
+	refs, err := r.ListRefs("refs/")
+	if err != nil {
+		return fmt.Errorf("failed to list refs: %w", err)
+	}
+	sort.Strings(refs)
+
+	for _, ref := range refs {
+		h, err := r.ResolveRef(ref)
+		if err != nil {
+			report.BrokenRefs = append(report.BrokenRefs, ref)
+			continue
+		}
+		if _, err := object.GetHeader(r.ObjectDB, h); err != nil {
+			report.BrokenRefs = append(report.BrokenRefs, ref)
+		}
+	}
+
+	return nil
+}
+
+// publish sends an event for this repository on its event bus
+func (r *Repository) publish(event Event) {
+	if r.Events == nil {
+		return
+	}
+
+	event.GitDir = r.GitDir
+	r.Events.Publish(event)
+}
@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// setupLifecycleRepo creates a repository with a private event bus and a stored blob
+func setupLifecycleRepo(t *testing.T) (*Repository, hash.Hash, *[]Event) {
+	t.Helper()
+
+	repo := setupManifestRepo(t)
+	repo.Events = NewEventBus()
+
+	events := &[]Event{}
+	repo.Events.Subscribe(func(e Event) {
+		*events = append(*events, e)
+	})
+
+	blobHash, err := repo.ObjectDB.Put(object.NewBlob([]byte("stored content\n")))
+	if err != nil {
+		t.Fatalf("Failed to store blob: %v", err)
+	}
+
+	return repo, blobHash, events
+}
+
+// TestEventBus tests subscription ordering and removal
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+
+	var order []int
+	first := bus.Subscribe(func(Event) { order = append(order, 1) })
+	bus.Subscribe(func(Event) { order = append(order, 2) })
+
+	bus.Publish(Event{Type: EventStorageEvicted})
+	bus.Unsubscribe(first)
+	bus.Publish(Event{Type: EventStorageEvicted})
+
+	if len(order) != 3 || order[0] != 1 || order[1] != 2 || order[2] != 2 {
+		t.Errorf("Handler calls = %v, want [1 2 2]", order)
+	}
+}
+
+// TestOnStorageEvicted tests that eviction schedules and runs verification
+func TestOnStorageEvicted(t *testing.T) {
+	repo, blobHash, events := setupLifecycleRepo(t)
+
+	// Simulate the backend dropping the object
+	if err := repo.ObjectDB.Delete(blobHash); err != nil {
+		t.Fatalf("Failed to delete object: %v", err)
+	}
+
+	report, err := repo.OnStorageEvicted([]hash.Hash{blobHash})
+	if err != nil {
+		t.Fatalf("OnStorageEvicted failed: %v", err)
+	}
+
+	if report == nil || report.OK() {
+		t.Fatalf("Expected failing report, got %+v", report)
+	}
+	if len(report.Missing) != 1 || !report.Missing[0].Equals(blobHash) {
+		t.Errorf("Missing = %v, want [%s]", report.Missing, blobHash)
+	}
+	if repo.FsckPending() {
+		t.Error("Expected fsck queue to be cleared")
+	}
+
+	want := []EventType{EventStorageEvicted, EventFsckScheduled, EventFsckCompleted}
+	if len(*events) != len(want) {
+		t.Fatalf("Got %d events, want %d", len(*events), len(want))
+	}
+	for i, e := range *events {
+		if e.Type != want[i] {
+			t.Errorf("Event %d = %s, want %s", i, e.Type, want[i])
+		}
+		if e.GitDir != repo.GitDir {
+			t.Errorf("Event %d GitDir = %s, want %s", i, e.GitDir, repo.GitDir)
+		}
+	}
+}
+
+// TestOnCorruptionDetected tests detection of content that no longer matches its hash
+func TestOnCorruptionDetected(t *testing.T) {
+	repo, blobHash, _ := setupLifecycleRepo(t)
+
+	// Replace the stored object with different content
+	compressed, err := object.Compress([]byte("blob 5\x00other"))
+	if err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	objectPath := filepath.Join(repo.ObjectsPath(), blobHash.String()[:2], blobHash.String()[2:])
+	if err := os.Remove(objectPath); err != nil {
+		t.Fatalf("Failed to remove object: %v", err)
+	}
+	if err := os.WriteFile(objectPath, compressed, 0444); err != nil {
+		t.Fatalf("Failed to write object: %v", err)
+	}
+
+	report, err := repo.OnCorruptionDetected(blobHash, "checksum mismatch")
+	if err != nil {
+		t.Fatalf("OnCorruptionDetected failed: %v", err)
+	}
+
+	if len(report.Corrupt) != 1 || !report.Corrupt[0].Equals(blobHash) {
+		t.Errorf("Corrupt = %v, want [%s]", report.Corrupt, blobHash)
+	}
+}
+
+// TestScheduleFsckDeferred tests that disabling storage.autoFsck only queues verification
+func TestScheduleFsckDeferred(t *testing.T) {
+	repo, _, events := setupLifecycleRepo(t)
+	repo.Config.SetBool("storage", "autoFsck", false)
+
+	report, err := repo.OnStorageEvicted(nil)
+	if err != nil {
+		t.Fatalf("OnStorageEvicted failed: %v", err)
+	}
+	if report != nil {
+		t.Error("Expected verification to be deferred")
+	}
+	if !repo.FsckPending() {
+		t.Fatal("Expected fsck to be pending")
+	}
+
+	// A full scan covers every object and ref
+	report, err = repo.RunScheduledFsck()
+	if err != nil {
+		t.Fatalf("RunScheduledFsck failed: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("Expected healthy repository, got %+v", report)
+	}
+	if report.Checked < 4 {
+		t.Errorf("Checked = %d, want at least 4 objects", report.Checked)
+	}
+	if last := (*events)[len(*events)-1]; last.Type != EventFsckCompleted || last.Fsck != report {
+		t.Errorf("Expected final event to carry the report, got %+v", last)
+	}
+
+	report, err = repo.RunScheduledFsck()
+	if err != nil {
+		t.Fatalf("RunScheduledFsck failed: %v", err)
+	}
+	if report != nil {
+		t.Error("Expected no report once the queue is empty")
+	}
+}
+
+// TestFsckMalformedSignature tests that unusual author lines are flagged but kept intact
+func TestFsckMalformedSignature(t *testing.T) {
+	repo, blobHash, _ := setupLifecycleRepo(t)
+
+	tree := object.NewTree()
+	tree.AddEntryWithMode(object.ModeRegular, "file.txt", blobHash)
+	treeHash, err := repo.ObjectDB.Put(tree)
+	if err != nil {
+		t.Fatalf("Failed to store tree: %v", err)
+	}
+
+	data := "tree " + treeHash.String() + "\n" +
+		"author Old Timer oldtimer@example.com 1112911993 +051800\n" +
+		"committer Old Timer <oldtimer@example.com> 1112911993 +0000\n" +
+		"\nimported\n"
+	commit, err := object.ParseCommit([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseCommit failed: %v", err)
+	}
+	commitHash, err := repo.ObjectDB.Put(commit)
+	if err != nil {
+		t.Fatalf("Failed to store commit: %v", err)
+	}
+	if expected := hash.HashObject(repo.Hasher, "commit", []byte(data)); !commitHash.Equals(expected) {
+		t.Fatalf("Commit bytes changed on re-serialization: %s != %s", commitHash, expected)
+	}
+
+	report, err := repo.ScheduleFsck([]hash.Hash{commitHash})
+	if err != nil {
+		t.Fatalf("ScheduleFsck failed: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("Malformed signatures should not fail the report: %+v", report)
+	}
+	if len(report.Malformed) != 1 || !report.Malformed[0].Equals(commitHash) {
+		t.Errorf("Malformed = %v, want [%s]", report.Malformed, commitHash)
+	}
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// GraphRow is one commit of a history graph and the lines leaving it
+type GraphRow struct {
+	Entry *LogEntry
+	// Column is the lane the commit is drawn in, counted from 0 at the left
+	Column int
+	// Columns is the number of lanes the row has, including the commit's
+	Columns int
+	// Parents are the parents the commit is drawn connected to. With a
+	// path or message filter these are the nearest shown ancestors, as git
+	// log --graph rewrites parents.
+	Parents []hash.Hash
+	// Edges are the lines from this row down to the next one
+	Edges []GraphEdge
+}
+
+// GraphEdge is a line from a lane of one row to a lane of the next row
+type GraphEdge struct {
+	From int
+	To   int
+	// Parent is the commit the line leads to
+	Parent hash.Hash
+}
+
+// LogGraph returns the commits of Log laid out in lanes, like git log
+// --graph draws them. Lines pass straight down in their lane, a commit's
+// first parent continues in its lane and further parents open lanes to its
+// right, and lines that meet are merged, after which the lanes to the
+// right move left. As with git log --graph, commits come in topological
+// order unless opts ask for LogOrderDate.
+func (r *Repository) LogGraph(startRef string, opts LogOptions) ([]*GraphRow, error) {
+	if opts.Order == LogOrderDefault {
+		opts.Order = LogOrderTopo
+	}
+	entries, walked, err := r.log(startRef, opts)
+	if err != nil {
+		return nil, err
+	}
+	parents := shownParents(walked)
+
+	rows := make([]*GraphRow, len(entries))
+	// lanes holds the commit each lane of the next row leads to
+	var lanes []hash.Hash
+	for i, entry := range entries {
+		row := &GraphRow{Entry: entry, Column: laneIndex(lanes, entry.Hash), Parents: parents[entry.Hash.String()]}
+		rows[i] = row
+		if row.Column < 0 {
+			// A commit no shown child leads to starts a lane of its own
+			row.Column = len(lanes)
+			lanes = append(lanes, entry.Hash)
+		}
+		row.Columns = len(lanes)
+
+		// The commit's lane is replaced by lanes for those of its parents
+		// that no other lane leads to yet
+		next := make([]hash.Hash, 0, len(lanes)+len(row.Parents))
+		next = append(next, lanes[:row.Column]...)
+		for _, parent := range row.Parents {
+			if laneIndex(lanes, parent) < 0 {
+				next = append(next, parent)
+			}
+		}
+		next = append(next, lanes[row.Column+1:]...)
+
+		for j, lane := range lanes {
+			if j != row.Column {
+				row.Edges = append(row.Edges, GraphEdge{From: j, To: laneIndex(next, lane), Parent: lane})
+			}
+		}
+		for _, parent := range row.Parents {
+			row.Edges = append(row.Edges, GraphEdge{From: row.Column, To: laneIndex(next, parent), Parent: parent})
+		}
+		lanes = next
+	}
+	return rows, nil
+}
+
+// laneIndex returns the lane leading to h, or -1
+func laneIndex(lanes []hash.Hash, h hash.Hash) int {
+	for i, lane := range lanes {
+		if lane.Equals(h) {
+			return i
+		}
+	}
+	return -1
+}
+
+// shownParents maps the shown commits of a walk to their nearest shown
+// ancestors along the parents the walk followed, so the graph skips the
+// commits that were filtered out
+func shownParents(walked []*logCommit) map[string][]hash.Hash {
+	commits := make(map[string]*logCommit, len(walked))
+	for _, c := range walked {
+		commits[c.hash.String()] = c
+	}
+
+	// rewritten caches the shown commits that stand for a hidden one
+	rewritten := make(map[string][]hash.Hash)
+	var resolve func(h hash.Hash) []hash.Hash
+	resolve = func(h hash.Hash) []hash.Hash {
+		c, ok := commits[h.String()]
+		if !ok {
+			return nil // Not part of the walk
+		}
+		if c.entry != nil {
+			return []hash.Hash{h}
+		}
+		if shown, ok := rewritten[h.String()]; ok {
+			return shown
+		}
+		var shown []hash.Hash
+		for _, parent := range c.parents {
+			shown = appendUniqueHashes(shown, resolve(parent)...)
+		}
+		rewritten[h.String()] = shown
+		return shown
+	}
+
+	parents := make(map[string][]hash.Hash)
+	for _, c := range walked {
+		if c.entry == nil {
+			continue
+		}
+		var shown []hash.Hash
+		for _, parent := range c.parents {
+			shown = appendUniqueHashes(shown, resolve(parent)...)
+		}
+		parents[c.hash.String()] = shown
+	}
+	return parents
+}
+
+// appendUniqueHashes appends the hashes that list doesn't hold yet
+func appendUniqueHashes(list []hash.Hash, hashes ...hash.Hash) []hash.Hash {
+	for _, h := range hashes {
+		if laneIndex(list, h) < 0 {
+			list = append(list, h)
+		}
+	}
+	return list
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// graphLayout writes each row as its subject, its column and its edges
+func graphLayout(rows []*GraphRow) string {
+	var b strings.Builder
+	for _, row := range rows {
+		fmt.Fprintf(&b, "%s %d/%d", strings.TrimSpace(row.Entry.Commit.Message), row.Column, row.Columns)
+		for _, edge := range row.Edges {
+			fmt.Fprintf(&b, " %d>%d", edge.From, edge.To)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func TestLogGraph(t *testing.T) {
+	repo := setupBranchyRepo(t)
+
+	rows, err := repo.LogGraph("", DefaultLogOptions())
+	if err != nil {
+		t.Fatalf("LogGraph failed: %v", err)
+	}
+	// The same shape as git log --graph draws
+	expected := "I 0/1 0>0\n" +
+		"H 0/1 0>0 0>1\n" +
+		"G2 1/2 0>0 1>1\n" +
+		"G 1/2 0>0 1>1\n" +
+		"F 0/2 1>1 0>0\n" +
+		"M 0/2 1>2 0>0 0>1\n" +
+		"E 1/3 0>0 2>1 1>1\n" +
+		"C 1/2 0>0 1>1\n" +
+		"D 0/2 1>1 0>0\n" +
+		"B 0/2 1>0 0>0\n" +
+		"A 0/1\n"
+	if got := graphLayout(rows); got != expected {
+		t.Errorf("Unexpected graph:\n%s\nwant:\n%s", got, expected)
+	}
+
+	// Lines skip the commits that are filtered out
+	opts := DefaultLogOptions()
+	opts.Grep = []string{"^[ACEG]$"}
+	rows, err = repo.LogGraph("", opts)
+	if err != nil {
+		t.Fatalf("LogGraph failed: %v", err)
+	}
+	expected = "G 0/1 0>0\n" +
+		"E 1/2 0>0 1>0\n" +
+		"C 0/1 0>0\n" +
+		"A 0/1\n"
+	if got := graphLayout(rows); got != expected {
+		t.Errorf("Unexpected filtered graph:\n%s\nwant:\n%s", got, expected)
+	}
+
+	// A cut-off history keeps the lines leading on
+	opts = DefaultLogOptions()
+	opts.MaxCount = 3
+	rows, err = repo.LogGraph("", opts)
+	if err != nil {
+		t.Fatalf("LogGraph failed: %v", err)
+	}
+	if len(rows) != 3 || len(rows[2].Edges) != 2 {
+		t.Errorf("Unexpected cut-off graph:\n%s", graphLayout(rows))
+	}
+}
@@ -0,0 +1,262 @@
+package repository
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// LogIterator walks the history of Log a page at a time. Between pages it
+// holds only the commits waiting to be walked and the hashes already
+// reached, so a long history can be paged through without building all
+// its entries. Sorted orders need the whole walk before their first entry,
+// which the iterator then keeps.
+type LogIterator struct {
+	repo    *Repository
+	opts    LogOptions
+	grep    []*regexp.Regexp
+	refs    map[string][]string
+	mailmap *Mailmap
+	shallow map[string]bool
+
+	queue *commitQueue
+	seen  map[string]bool
+	// paths holds the name the filtered path has in queued commits, which
+	// Follow changes at renames
+	paths map[string]string
+
+	// walked holds the commits of a sorted order once the walk is done,
+	// and next the index of the one to return next
+	walked []*logCommit
+	sorted bool
+	next   int
+	// returned counts the entries returned so far, for MaxCount
+	returned int
+}
+
+// LogIterator starts walking the history from startRef as Log does. The
+// entries come from NextPage.
+func (r *Repository) LogIterator(startRef string, opts LogOptions) (*LogIterator, error) {
+	startHash, err := r.resolveLogStart(startRef)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get all refs if needed
+	refs := make(map[string][]string)
+	if opts.All || opts.Graph {
+		branches, err := r.ListBranches()
+		if err == nil {
+			for _, branch := range branches {
+				branchHash, err := r.GetBranch(branch)
+				if err == nil {
+					refs[branchHash.String()] = append(refs[branchHash.String()], branch)
+				}
+			}
+		}
+	}
+
+	var mailmap *Mailmap
+	if opts.UseMailmap {
+		if mailmap, err = r.Mailmap(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Paths are relative to the top of the tree
+	opts.Path = strings.Trim(strings.TrimPrefix(opts.Path, "./"), "/")
+	if opts.Path == "." {
+		opts.Path = ""
+	}
+
+	grep, err := compileLogGrep(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	it := &LogIterator{
+		repo:    r,
+		opts:    opts,
+		grep:    grep,
+		refs:    refs,
+		mailmap: mailmap,
+		shallow: r.shallowSet(),
+		queue:   &commitQueue{},
+		seen:    make(map[string]bool),
+		paths:   make(map[string]string),
+	}
+	it.enqueue(startHash)
+	return it, nil
+}
+
+// NextPage returns up to n more entries, or all that are left when n is
+// negative. A page with fewer than n entries is the last one.
+func (it *LogIterator) NextPage(n int) ([]*LogEntry, error) {
+	if it.opts.Order != LogOrderDefault && !it.sorted {
+		if err := it.walkAll(); err != nil {
+			return nil, err
+		}
+	}
+
+	entries := make([]*LogEntry, 0)
+	for n < 0 || len(entries) < n {
+		if it.opts.MaxCount >= 0 && it.returned >= it.opts.MaxCount {
+			break
+		}
+		c, err := it.nextCommit()
+		if err != nil {
+			return nil, err
+		}
+		if c == nil {
+			break
+		}
+		if c.entry != nil {
+			entries = append(entries, c.entry)
+			it.returned++
+		}
+	}
+
+	if it.opts.NotesRef != "" {
+		if err := it.repo.attachNotes(entries, it.opts.NotesRef); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// Done reports whether the walk is over. Commits left to walk may all be
+// filtered out, so NextPage can still return an empty last page.
+func (it *LogIterator) Done() bool {
+	if it.opts.MaxCount >= 0 && it.returned >= it.opts.MaxCount {
+		return true
+	}
+	if it.sorted {
+		return it.next >= len(it.walked)
+	}
+	return it.queue.len() == 0
+}
+
+// nextCommit returns the next commit of the walk, or nil at its end
+func (it *LogIterator) nextCommit() (*logCommit, error) {
+	if !it.sorted {
+		return it.step()
+	}
+	if it.next >= len(it.walked) {
+		return nil, nil
+	}
+	c := it.walked[it.next]
+	it.next++
+	return c, nil
+}
+
+// walkAll walks the whole history and sorts it in the order of the options
+func (it *LogIterator) walkAll() error {
+	var walked []*logCommit
+	for {
+		c, err := it.step()
+		if err != nil {
+			return err
+		}
+		if c == nil {
+			break
+		}
+		walked = append(walked, c)
+	}
+	it.walked = sortLogCommits(walked, it.opts.Order)
+	it.sorted = true
+	return nil
+}
+
+// enqueue queues a commit the walk has not reached yet
+func (it *LogIterator) enqueue(h hash.Hash) {
+	if it.seen[h.String()] {
+		return
+	}
+	it.seen[h.String()] = true
+	commitObj, err := it.repo.ObjectDB.Get(h)
+	if err != nil {
+		return // Skip if commit not found
+	}
+	if commit, ok := commitObj.(*object.Commit); ok {
+		it.queue.push(&logCommit{hash: h, commit: commit})
+	}
+}
+
+// step takes the newest queued commit, decides whether it is shown and
+// queues the parents to follow. It returns nil when the queue is empty.
+func (it *LogIterator) step() (*logCommit, error) {
+	if it.queue.len() == 0 {
+		return nil, nil
+	}
+	r, opts := it.repo, it.opts
+
+	current := it.queue.pop()
+	hashStr := current.hash.String()
+	commit := it.mailmap.MapCommit(current.commit)
+
+	// Shallow boundaries are grafted as root commits
+	parents := commit.Parents
+	if it.shallow[hashStr] {
+		parents = nil
+	}
+
+	if opts.FirstParent && len(parents) > 1 {
+		parents = parents[:1]
+	}
+
+	// Apply filters
+	show := r.matchesFilters(commit, opts, it.grep)
+	follow := parents
+	path, ok := it.paths[hashStr]
+	if !ok {
+		path = opts.Path
+	}
+	delete(it.paths, hashStr)
+	if path != "" {
+		var changed bool
+		var err error
+		follow, changed, err = r.simplifyParents(commit, parents, path)
+		if err != nil {
+			return nil, err
+		}
+		show = show && changed
+
+		for _, parent := range follow {
+			// A commit that changed the file may have renamed it
+			parentPath := path
+			if opts.Follow && changed {
+				// Like git log --follow, copies of any file count too
+				followOpts := DefaultDiffOptions()
+				followOpts.CopiesHarder = true
+				if parentPath, err = r.renamedFrom(commit, parent, path, followOpts); err != nil {
+					return nil, err
+				}
+			}
+			if _, ok := it.paths[parent.String()]; !ok && !it.seen[parent.String()] {
+				it.paths[parent.String()] = parentPath
+			}
+		}
+	}
+
+	if show {
+		entry := &LogEntry{
+			Commit:  commit,
+			Hash:    current.hash,
+			Refs:    it.refs[hashStr],
+			Parents: parents,
+		}
+		if opts.Follow {
+			entry.Path = path
+		}
+		current.entry = entry
+	}
+	current.parents = follow
+
+	// Add parents to queue
+	for _, parent := range follow {
+		it.enqueue(parent)
+	}
+	return current, nil
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestLogIterator tests that pages of a log iterator add up to Log in each
+// order, and that MaxCount and message filters carry across pages
+func TestLogIterator(t *testing.T) {
+	repo := setupBranchyRepo(t)
+
+	tests := []struct {
+		name     string
+		order    LogOrder
+		maxCount int
+		grep     string
+		pageSize int
+		want     []string
+	}{
+		{name: "default", order: LogOrderDefault, maxCount: -1, pageSize: 4, want: []string{"I H F M", "D G2 G C", "B E A"}},
+		{name: "date", order: LogOrderDate, maxCount: -1, pageSize: 5, want: []string{"I H F M D", "G2 G B E C", "A"}},
+		{name: "topo", order: LogOrderTopo, maxCount: -1, pageSize: 6, want: []string{"I H G2 G F M", "E C D B A"}},
+		{name: "max count", order: LogOrderDefault, maxCount: 5, pageSize: 3, want: []string{"I H F", "M D"}},
+		{name: "grep", order: LogOrderDefault, maxCount: -1, grep: "^G", pageSize: 1, want: []string{"G2", "G", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultLogOptions()
+			opts.Order = tt.order
+			opts.MaxCount = tt.maxCount
+			if tt.grep != "" {
+				opts.Grep = []string{tt.grep}
+			}
+			it, err := repo.LogIterator("", opts)
+			if err != nil {
+				t.Fatalf("LogIterator failed: %v", err)
+			}
+
+			var pages []string
+			for !it.Done() {
+				entries, err := it.NextPage(tt.pageSize)
+				if err != nil {
+					t.Fatalf("NextPage failed: %v", err)
+				}
+				var got []string
+				for _, entry := range entries {
+					got = append(got, strings.TrimSpace(entry.Commit.Message))
+				}
+				pages = append(pages, strings.Join(got, " "))
+				if len(pages) > len(tt.want) {
+					break
+				}
+			}
+			if strings.Join(pages, " | ") != strings.Join(tt.want, " | ") {
+				t.Errorf("pages = %q, want %q", pages, tt.want)
+			}
+
+			entries, err := it.NextPage(tt.pageSize)
+			if err != nil || len(entries) != 0 {
+				t.Errorf("NextPage after the end = %d entries, %v", len(entries), err)
+			}
+		})
+	}
+}
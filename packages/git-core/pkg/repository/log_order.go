@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"container/heap"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// LogOrder specifies the order of log entries
+type LogOrder int
+
+const (
+	// LogOrderDefault shows the newest commit of the walk next, by commit
+	// date, like git log
+	LogOrderDefault LogOrder = iota
+	// LogOrderDate shows no parent before all its children, and otherwise
+	// newest commit date first, like --date-order
+	LogOrderDate
+	// LogOrderTopo shows no parent before all its children and avoids
+	// interleaving lines of history, like --topo-order
+	LogOrderTopo
+)
+
+// logCommit is a commit reached by the log walk
+type logCommit struct {
+	hash   hash.Hash
+	commit *object.Commit
+	// entry is nil when the commit is filtered out
+	entry *LogEntry
+	// parents are the parents the walk followed from the commit
+	parents []hash.Hash
+	// seq is the order the commit was queued in
+	seq int
+}
+
+// commitQueue is a priority queue of commits, newest commit date first.
+// Commits with the same date come out in the order they were pushed, so
+// walks are deterministic.
+type commitQueue struct {
+	heap   commitHeap
+	pushed int
+}
+
+func (q *commitQueue) push(c *logCommit) {
+	c.seq = q.pushed
+	q.pushed++
+	heap.Push(&q.heap, c)
+}
+
+func (q *commitQueue) pop() *logCommit {
+	return heap.Pop(&q.heap).(*logCommit)
+}
+
+func (q *commitQueue) len() int {
+	return len(q.heap)
+}
+
+// commitHeap implements heap.Interface for commitQueue
+type commitHeap []*logCommit
+
+func (h commitHeap) Len() int { return len(h) }
+
+func (h commitHeap) Less(i, j int) bool {
+	a, b := h[i].commit.Committer.When, h[j].commit.Committer.When
+	if !a.Equal(b) {
+		return a.After(b)
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h commitHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *commitHeap) Push(x interface{}) { *h = append(*h, x.(*logCommit)) }
+
+func (h *commitHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// sortLogCommits orders the commits of a walk, given in walk order, so
+// that no commit comes before its children, as git's
+// sort_in_topological_order does. LogOrderDate continues with the newest
+// commit whose children are all done; LogOrderTopo with the one that was
+// ready last, which keeps each line of history together.
+func sortLogCommits(walked []*logCommit, order LogOrder) []*logCommit {
+	// A commit's indegree is one more than the number of its children
+	// still to be shown
+	indegree := make(map[string]int, len(walked))
+	for _, c := range walked {
+		indegree[c.hash.String()] = 1
+	}
+	for _, c := range walked {
+		for _, parent := range c.parents {
+			if indegree[parent.String()] > 0 {
+				indegree[parent.String()]++
+			}
+		}
+	}
+	commits := make(map[string]*logCommit, len(walked))
+	for _, c := range walked {
+		commits[c.hash.String()] = c
+	}
+
+	byDate := &commitQueue{}
+	var stack []*logCommit
+	ready := func(c *logCommit) {
+		if order == LogOrderTopo {
+			stack = append(stack, c)
+		} else {
+			byDate.push(c)
+		}
+	}
+	// Start from the tips, which have no children in the walk, in walk
+	// order
+	for _, c := range walked {
+		if indegree[c.hash.String()] == 1 {
+			ready(c)
+		}
+	}
+	for i, j := 0, len(stack)-1; i < j; i, j = i+1, j-1 {
+		stack[i], stack[j] = stack[j], stack[i]
+	}
+	next := func() *logCommit {
+		if order == LogOrderTopo {
+			if len(stack) == 0 {
+				return nil
+			}
+			c := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			return c
+		}
+		if byDate.len() == 0 {
+			return nil
+		}
+		return byDate.pop()
+	}
+
+	sorted := make([]*logCommit, 0, len(walked))
+	for c := next(); c != nil; c = next() {
+		for _, parent := range c.parents {
+			key := parent.String()
+			if indegree[key] == 0 {
+				continue
+			}
+			// A parent is ready once all its children are shown
+			indegree[key]--
+			if indegree[key] == 1 {
+				ready(commits[key])
+			}
+		}
+		indegree[c.hash.String()] = 0
+		sorted = append(sorted, c)
+	}
+	return sorted
+}
@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// IndexFileStatus is the category a file is reported under by ListIndexFiles
+type IndexFileStatus string
+
+const (
+	// IndexFileCached is a file in the index, like ls-files --cached
+	IndexFileCached IndexFileStatus = "cached"
+	// IndexFileDeleted is a tracked file missing from the working tree
+	IndexFileDeleted IndexFileStatus = "deleted"
+	// IndexFileModified is a tracked file that differs from the index
+	IndexFileModified IndexFileStatus = "modified"
+	// IndexFileUnmerged is a conflicted index entry at stage 1, 2 or 3
+	IndexFileUnmerged IndexFileStatus = "unmerged"
+	// IndexFileOther is an untracked file
+	IndexFileOther IndexFileStatus = "other"
+	// IndexFileIgnored is an untracked file matched by .gitignore
+	IndexFileIgnored IndexFileStatus = "ignored"
+)
+
+// ListIndexFilesOptions selects which files ListIndexFiles reports. When no
+// category is selected, Cached is assumed, as with git ls-files.
+type ListIndexFilesOptions struct {
+	// Cached reports every index entry, like --cached
+	Cached bool
+	// Deleted reports tracked files missing from the working tree, like --deleted
+	Deleted bool
+	// Modified reports tracked files that differ from the index, including
+	// deleted files, like --modified
+	Modified bool
+	// Unmerged reports conflicted entries, like --unmerged
+	Unmerged bool
+	// Others reports untracked files that aren't ignored, like --others
+	Others bool
+	// Ignored reports untracked files matched by .gitignore, like --others --ignored
+	Ignored bool
+	// Paths limits the listing to these files or directories
+	Paths []string
+}
+
+// DefaultListIndexFilesOptions returns default ls-files options
+func DefaultListIndexFilesOptions() ListIndexFilesOptions {
+	return ListIndexFilesOptions{
+		Cached: true,
+	}
+}
+
+// IndexFile is one file reported by ListIndexFiles
+type IndexFile struct {
+	Path   string
+	Status IndexFileStatus
+	// Mode, Hash and Stage are taken from the index entry and are unset for
+	// untracked files
+	Mode  object.FileMode
+	Hash  hash.Hash
+	Stage int
+}
+
+// ListIndexFiles lists files in the index and working tree, like
+// git ls-files. Tracked files are reported in index order, one result per
+// selected category they fall under, followed by untracked files.
+func (r *Repository) ListIndexFiles(opts ListIndexFilesOptions) ([]IndexFile, error) {
+	if !opts.Cached && !opts.Deleted && !opts.Modified && !opts.Unmerged && !opts.Others && !opts.Ignored {
+		opts.Cached = true
+	}
+
+	idx, err := index.Load(filepath.Join(r.GitDir, "index"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+
+	sparse, err := r.SparseCheckout()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sparse-checkout: %w", err)
+	}
+
+	workTree := r.WorkTree()
+	tracked := make(map[string]bool, len(idx.Entries))
+	var files []IndexFile
+
+	for _, entry := range idx.Entries {
+		tracked[entry.Path] = true
+		if !matchesPathFilter(entry.Path, opts.Paths) {
+			continue
+		}
+
+		file := IndexFile{
+			Path:  entry.Path,
+			Mode:  object.FileMode(entry.Mode),
+			Hash:  entry.Hash,
+			Stage: int(entry.StageFlag),
+		}
+		report := func(status IndexFileStatus) {
+			file.Status = status
+			files = append(files, file)
+		}
+
+		if opts.Cached {
+			report(IndexFileCached)
+		}
+		if opts.Unmerged && entry.StageFlag > 0 {
+			report(IndexFileUnmerged)
+		}
+
+		if !opts.Deleted && !opts.Modified {
+			continue
+		}
+		if entry.StageFlag > 0 || (sparse != nil && !sparse.Includes(entry.Path)) {
+			// Conflicted entries have no single version to compare against,
+			// and files outside the sparse cone are absent on purpose
+			continue
+		}
+
+		_, statErr := os.Lstat(filepath.Join(workTree, filepath.FromSlash(entry.Path)))
+		deleted := os.IsNotExist(statErr)
+		if statErr != nil && !deleted {
+			return nil, fmt.Errorf("failed to stat %s: %w", entry.Path, statErr)
+		}
+
+		if opts.Deleted && deleted {
+			report(IndexFileDeleted)
+		}
+		if opts.Modified {
+			modified := deleted
+			if !deleted {
+				modified, err = entry.IsModified(workTree)
+				if err != nil {
+					return nil, fmt.Errorf("failed to check %s: %w", entry.Path, err)
+				}
+			}
+			if modified {
+				report(IndexFileModified)
+			}
+		}
+	}
+
+	if opts.Others || opts.Ignored {
+		untracked, err := r.listUntrackedFiles(tracked, opts)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, untracked...)
+	}
+
+	return files, nil
+}
+
+// listUntrackedFiles walks the working tree for files not in the index
+func (r *Repository) listUntrackedFiles(tracked map[string]bool, opts ListIndexFilesOptions) ([]IndexFile, error) {
+	gitignore, err := index.LoadGitignore(r.WorkTree())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load .gitignore: %w", err)
+	}
+
+	var files []IndexFile
+	workTree := r.WorkTree()
+	err = filepath.WalkDir(workTree, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == workTree {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(workTree, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if !opts.Ignored && gitignore.Match(relPath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if tracked[relPath] || !matchesPathFilter(relPath, opts.Paths) {
+			return nil
+		}
+
+		status := IndexFileOther
+		if m := gitignore.CheckIgnore(relPath); m != nil && m.Ignored {
+			status = IndexFileIgnored
+		}
+		if (status == IndexFileOther && opts.Others) || (status == IndexFileIgnored && opts.Ignored) {
+			files = append(files, IndexFile{Path: relPath, Status: status})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk working tree: %w", err)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files, nil
+}
+
+// matchesPathFilter reports whether path is one of paths or lies under one
+// of them. An empty filter matches everything.
+func matchesPathFilter(path string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, filter := range paths {
+		filter = strings.TrimSuffix(strings.TrimPrefix(filter, "./"), "/")
+		if filter == "" || filter == "." || path == filter || strings.HasPrefix(path, filter+"/") {
+			return true
+		}
+	}
+	return false
+}
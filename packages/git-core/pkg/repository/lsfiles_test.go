@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+)
+
+// setupListIndexFilesRepo starts from the ls-tree fixture and leaves the
+// working tree with a deleted, a modified, an untracked and an ignored file
+func setupListIndexFilesRepo(t *testing.T) *Repository {
+	t.Helper()
+
+	repo := setupListTreeRepo(t)
+	if err := os.Remove(filepath.Join(repo.Path, "README.md")); err != nil {
+		t.Fatalf("Failed to remove README.md: %v", err)
+	}
+	writes := map[string]string{
+		"src/main.go": "package main\n\nfunc main() {}\n",
+		"notes.txt":   "todo\n",
+		".gitignore":  "*.log\n",
+		"debug.log":   "trace\n",
+	}
+	for path, content := range writes {
+		if err := os.WriteFile(filepath.Join(repo.Path, filepath.FromSlash(path)), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	return repo
+}
+
+// indexFileKeys summarises results as "status path" strings
+func indexFileKeys(files []IndexFile) []string {
+	keys := make([]string, len(files))
+	for i, file := range files {
+		keys[i] = string(file.Status) + " " + file.Path
+	}
+	return keys
+}
+
+func TestListIndexFiles(t *testing.T) {
+	repo := setupListIndexFilesRepo(t)
+
+	tests := []struct {
+		name string
+		opts ListIndexFilesOptions
+		keys []string
+	}{
+		{
+			name: "default lists cached files",
+			opts: ListIndexFilesOptions{},
+			keys: []string{"cached README.md", "cached src/lib/extra.go", "cached src/lib/util.go", "cached src/main.go"},
+		},
+		{
+			name: "deleted",
+			opts: ListIndexFilesOptions{Deleted: true},
+			keys: []string{"deleted README.md"},
+		},
+		{
+			name: "modified includes deleted",
+			opts: ListIndexFilesOptions{Modified: true},
+			keys: []string{"modified README.md", "modified src/main.go"},
+		},
+		{
+			name: "others",
+			opts: ListIndexFilesOptions{Others: true},
+			keys: []string{"other .gitignore", "other notes.txt"},
+		},
+		{
+			name: "ignored",
+			opts: ListIndexFilesOptions{Ignored: true},
+			keys: []string{"ignored debug.log"},
+		},
+		{
+			name: "path filter",
+			opts: ListIndexFilesOptions{Cached: true, Modified: true, Paths: []string{"src/"}},
+			keys: []string{"cached src/lib/extra.go", "cached src/lib/util.go", "cached src/main.go", "modified src/main.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := repo.ListIndexFiles(tt.opts)
+			if err != nil {
+				t.Fatalf("ListIndexFiles failed: %v", err)
+			}
+			if keys := indexFileKeys(files); !reflect.DeepEqual(keys, tt.keys) {
+				t.Errorf("expected %v, got %v", tt.keys, keys)
+			}
+		})
+	}
+}
+
+func TestListIndexFilesUnmerged(t *testing.T) {
+	repo := setupListTreeRepo(t)
+
+	indexPath := filepath.Join(repo.GitDir, "index")
+	idx, err := index.Load(indexPath)
+	if err != nil {
+		t.Fatalf("Failed to load index: %v", err)
+	}
+	readme, _ := idx.GetEntry("README.md")
+	for stage := uint8(1); stage <= 3; stage++ {
+		entry := *readme
+		entry.Path = "conflict.txt"
+		entry.StageFlag = stage
+		idx.Entries = append(idx.Entries, &entry)
+	}
+	idx.Sort()
+	if err := idx.Save(indexPath); err != nil {
+		t.Fatalf("Failed to save index: %v", err)
+	}
+
+	files, err := repo.ListIndexFiles(ListIndexFilesOptions{Unmerged: true})
+	if err != nil {
+		t.Fatalf("ListIndexFiles failed: %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("expected 3 unmerged entries, got %v", indexFileKeys(files))
+	}
+	for i, file := range files {
+		if file.Path != "conflict.txt" || file.Status != IndexFileUnmerged || file.Stage != i+1 {
+			t.Errorf("unexpected entry %d: %+v", i, file)
+		}
+		if !file.Hash.Equals(readme.Hash) {
+			t.Errorf("expected hash %s, got %s", readme.Hash, file.Hash)
+		}
+	}
+}
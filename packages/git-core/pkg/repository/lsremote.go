@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/auth"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+// peeledSuffix marks an advertised ref that gives the object an annotated
+// tag points to
+const peeledSuffix = "^{}"
+
+// LsRemoteOptions configures LsRemote
+type LsRemoteOptions struct {
+	// Heads limits the listing to branches, like --heads
+	Heads bool
+	// Tags limits the listing to tags, like --tags. Setting both Heads and
+	// Tags lists both.
+	Tags bool
+	// AuthProvider is the authentication provider to use
+	AuthProvider auth.AuthProvider
+}
+
+// DefaultLsRemoteOptions returns default ls-remote options, which list
+// every advertised ref
+func DefaultLsRemoteOptions() LsRemoteOptions {
+	return LsRemoteOptions{
+		Heads: false,
+		Tags:  false,
+	}
+}
+
+// RemoteRef is a ref advertised by a remote
+type RemoteRef struct {
+	// Name is the full ref name, or HEAD
+	Name string
+	Hash hash.Hash
+	// Peeled is the object an annotated tag points to, nil otherwise
+	Peeled hash.Hash
+	// Target is the ref a symbolic ref such as HEAD points to, if advertised
+	Target string
+}
+
+// LsRemote lists the refs of a remote, like git ls-remote. remoteOrURL is
+// the name of a configured remote or a URL; local paths and bundles are
+// read directly.
+func (r *Repository) LsRemote(remoteOrURL string, opts LsRemoteOptions) ([]RemoteRef, error) {
+	url := remoteOrURL
+	if remoteURL, err := r.Config.GetRemoteURL(remoteOrURL); err == nil {
+		url = remoteURL
+	}
+	return lsRemote(r.newClient(), url, opts)
+}
+
+// LsRemote lists the refs of the repository at url without a local
+// repository, so a remote can be inspected before it is cloned
+func LsRemote(url string, opts LsRemoteOptions) ([]RemoteRef, error) {
+	return lsRemote(protocol.NewClient(), url, opts)
+}
+
+// lsRemote discovers the refs at url and folds them into RemoteRefs
+func lsRemote(client *protocol.Client, url string, opts LsRemoteOptions) ([]RemoteRef, error) {
+	var discovery *protocol.DiscoveryResponse
+	if sourcePath, ok := localClonePath(url); ok {
+		if IsBundle(sourcePath) {
+			bundle, err := ReadBundle(sourcePath)
+			if err != nil {
+				return nil, err
+			}
+			discovery = &protocol.DiscoveryResponse{References: bundle.References}
+		} else {
+			source, err := Open(sourcePath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open source repository: %w", err)
+			}
+			discovery, err = localDiscovery(source)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		if opts.AuthProvider != nil {
+			client.SetAuthProvider(opts.AuthProvider)
+		}
+
+		// Protocol v2 servers only list the refs asked for
+		var prefixes []string
+		if opts.Heads {
+			prefixes = append(prefixes, "refs/heads/")
+		}
+		if opts.Tags {
+			prefixes = append(prefixes, "refs/tags/")
+		}
+
+		var err error
+		discovery, err = client.DiscoverRefs(url, prefixes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover remote: %w", err)
+		}
+	}
+
+	return remoteRefsFromDiscovery(discovery, opts)
+}
+
+// remoteRefsFromDiscovery turns advertised refs into RemoteRefs, attaching
+// peeled tag entries and symref targets to the refs they describe
+func remoteRefsFromDiscovery(discovery *protocol.DiscoveryResponse, opts LsRemoteOptions) ([]RemoteRef, error) {
+	refs := make([]RemoteRef, 0, len(discovery.References))
+	positions := make(map[string]int, len(discovery.References))
+
+	for _, ref := range discovery.References {
+		h, err := hash.ParseHash(ref.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hash for %s: %w", ref.Name, err)
+		}
+
+		// Peeled entries follow their tag. This also drops the
+		// capabilities^{} placeholder an empty repository advertises.
+		if name := strings.TrimSuffix(ref.Name, peeledSuffix); name != ref.Name {
+			if i, ok := positions[name]; ok {
+				refs[i].Peeled = h
+			}
+			continue
+		}
+
+		positions[ref.Name] = len(refs)
+		refs = append(refs, RemoteRef{
+			Name:   ref.Name,
+			Hash:   h,
+			Target: discovery.SymRefs[ref.Name],
+		})
+	}
+
+	if !opts.Heads && !opts.Tags {
+		return refs, nil
+	}
+
+	filtered := refs[:0]
+	for _, ref := range refs {
+		if (opts.Heads && strings.HasPrefix(ref.Name, "refs/heads/")) ||
+			(opts.Tags && strings.HasPrefix(ref.Name, "refs/tags/")) {
+			filtered = append(filtered, ref)
+		}
+	}
+	return filtered, nil
+}
+
+// localDiscovery builds the ref advertisement a server would send for a
+// local repository, including peeled entries for annotated tags
+func localDiscovery(source *Repository) (*protocol.DiscoveryResponse, error) {
+	discovery := &protocol.DiscoveryResponse{SymRefs: map[string]string{}}
+
+	if head, err := source.ResolveHEAD(); err == nil {
+		discovery.References = append(discovery.References, protocol.Reference{Name: "HEAD", Hash: head.String()})
+		if branch, err := source.CurrentBranch(); err == nil {
+			discovery.SymRefs["HEAD"] = "refs/heads/" + branch
+		}
+	}
+
+	err := source.WalkRefs(WalkRefsOptions{Peel: true}, func(ref Ref) error {
+		discovery.References = append(discovery.References, protocol.Reference{Name: ref.Name, Hash: ref.Hash.String()})
+		if ref.Peeled != nil {
+			discovery.References = append(discovery.References, protocol.Reference{Name: ref.Name + peeledSuffix, Hash: ref.Peeled.String()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return discovery, nil
+}
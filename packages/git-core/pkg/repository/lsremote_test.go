@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+// remoteRefsByName indexes ls-remote results by ref name
+func remoteRefsByName(refs []RemoteRef) map[string]RemoteRef {
+	byName := make(map[string]RemoteRef, len(refs))
+	for _, ref := range refs {
+		byName[ref.Name] = ref
+	}
+	return byName
+}
+
+func TestLsRemoteHTTP(t *testing.T) {
+	source, commits := setupUndoRepo(t, "one\n", "two\n")
+
+	refs := []protocol.Reference{
+		{Name: "HEAD", Hash: commits[1].String()},
+		{Name: "refs/heads/main", Hash: commits[1].String()},
+		{Name: "refs/heads/old", Hash: commits[0].String()},
+		{Name: "refs/tags/v1", Hash: commits[1].String()},
+		{Name: "refs/tags/v1^{}", Hash: commits[0].String()},
+	}
+	server := newUploadPackServer(t, source, refs)
+	defer server.Close()
+
+	result, err := LsRemote(server.URL+"/repo.git", DefaultLsRemoteOptions())
+	if err != nil {
+		t.Fatalf("LsRemote failed: %v", err)
+	}
+	if len(result) != 4 {
+		t.Fatalf("expected 4 refs with the peeled entry folded in, got %+v", result)
+	}
+
+	byName := remoteRefsByName(result)
+	if head := byName["HEAD"]; head.Target != "refs/heads/main" || !head.Hash.Equals(commits[1]) {
+		t.Errorf("unexpected HEAD: %+v", head)
+	}
+	if tag := byName["refs/tags/v1"]; tag.Peeled == nil || !tag.Peeled.Equals(commits[0]) {
+		t.Errorf("expected v1 to peel to %s, got %+v", commits[0], tag)
+	}
+	if old := byName["refs/heads/old"]; old.Peeled != nil || !old.Hash.Equals(commits[0]) {
+		t.Errorf("unexpected old branch: %+v", old)
+	}
+
+	opts := DefaultLsRemoteOptions()
+	opts.Heads = true
+	heads, err := LsRemote(server.URL+"/repo.git", opts)
+	if err != nil {
+		t.Fatalf("LsRemote failed: %v", err)
+	}
+	if len(heads) != 2 || heads[0].Name != "refs/heads/main" || heads[1].Name != "refs/heads/old" {
+		t.Errorf("expected only branches, got %+v", heads)
+	}
+}
+
+func TestLsRemoteConfiguredRemote(t *testing.T) {
+	source, commits := setupUndoRepo(t, "one\n")
+
+	tag := object.NewTag()
+	tag.Target = commits[0]
+	tag.TargetType = object.CommitType
+	tag.Name = "v1"
+	tag.Tagger = object.Signature{Name: "Test", Email: "test@example.com", When: time.Unix(1700000000, 0).UTC()}
+	tag.Message = "Release v1\n"
+	tagHash, err := source.ObjectDB.Put(tag)
+	if err != nil {
+		t.Fatalf("Failed to store tag: %v", err)
+	}
+	if err := source.UpdateRef("refs/tags/v1", tagHash); err != nil {
+		t.Fatalf("Failed to create tag ref: %v", err)
+	}
+
+	repo, err := Create(filepath.Join(t.TempDir(), "local"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	repo.Config.SetRemoteURL("origin", source.Path)
+
+	result, err := repo.LsRemote("origin", LsRemoteOptions{Tags: true})
+	if err != nil {
+		t.Fatalf("LsRemote failed: %v", err)
+	}
+	if len(result) != 1 {
+		t.Fatalf("expected only the tag, got %+v", result)
+	}
+	if !result[0].Hash.Equals(tagHash) || result[0].Peeled == nil || !result[0].Peeled.Equals(commits[0]) {
+		t.Errorf("expected tag %s peeled to %s, got %+v", tagHash, commits[0], result[0])
+	}
+
+	all, err := repo.LsRemote(source.Path, DefaultLsRemoteOptions())
+	if err != nil {
+		t.Fatalf("LsRemote by path failed: %v", err)
+	}
+	byName := remoteRefsByName(all)
+	branch, err := source.CurrentBranch()
+	if err != nil {
+		t.Fatalf("Failed to get branch: %v", err)
+	}
+	if head := byName["HEAD"]; head.Target != "refs/heads/"+branch || !head.Hash.Equals(commits[0]) {
+		t.Errorf("unexpected HEAD: %+v", head)
+	}
+	if _, ok := byName["refs/heads/"+branch]; !ok {
+		t.Errorf("expected branch %s in %+v", branch, all)
+	}
+}
+
+func TestLsRemoteUnknownRemote(t *testing.T) {
+	repo, _ := setupUndoRepo(t, "one\n")
+
+	if _, err := repo.LsRemote(filepath.Join(t.TempDir(), "missing"), DefaultLsRemoteOptions()); err == nil {
+		t.Error("expected error for missing repository")
+	}
+}
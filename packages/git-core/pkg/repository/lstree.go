@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// ListTreeOptions configures ListTree
+type ListTreeOptions struct {
+	// Recursive descends into subtrees and lists their files, like -r
+	Recursive bool
+	// ShowTrees lists the subtrees themselves when Recursive is set, like -t
+	ShowTrees bool
+	// Sizes looks up the size of each blob, like --long
+	Sizes bool
+	// Paths limits the listing to these paths. A path names an entry and,
+	// when Recursive is set, everything below it; a trailing slash lists a
+	// directory's contents instead of the directory itself.
+	Paths []string
+}
+
+// DefaultListTreeOptions returns default ls-tree options
+func DefaultListTreeOptions() ListTreeOptions {
+	return ListTreeOptions{
+		Recursive: false,
+		ShowTrees: false,
+		Sizes:     false,
+	}
+}
+
+// TreeListEntry is one entry reported by ListTree
+type TreeListEntry struct {
+	// Path is relative to the root of the listed tree
+	Path string
+	Mode object.FileMode
+	// Type is blob, tree, or commit for submodules
+	Type object.Type
+	Hash hash.Hash
+	// Size is the blob size, or -1 for trees, submodules and when sizes
+	// were not requested
+	Size int64
+}
+
+// ListTree lists the entries of a tree-ish, like git ls-tree. Entries come
+// back in tree order, with subtrees expanded in place when recursing.
+func (r *Repository) ListTree(treeish string, opts ListTreeOptions) ([]TreeListEntry, error) {
+	h, err := r.ResolveRevision(treeish)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, _, err := r.peelToTree(h)
+	if err != nil {
+		return nil, err
+	}
+
+	var filters []string
+	for _, path := range opts.Paths {
+		path = strings.TrimPrefix(path, "./")
+		if path == "" || path == "." || path == "/" {
+			// The root selects everything
+			filters = nil
+			break
+		}
+		filters = append(filters, path)
+	}
+
+	var entries []TreeListEntry
+	if err := r.listTree(tree, "", filters, len(filters) == 0, opts, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// listTree walks one tree level. selected is set when everything at this
+// level was asked for; otherwise entries are matched against filters.
+func (r *Repository) listTree(tree *object.Tree, prefix string, filters []string, selected bool, opts ListTreeOptions, entries *[]TreeListEntry) error {
+	for _, entry := range tree.Entries() {
+		path := entry.Name
+		if prefix != "" {
+			path = prefix + "/" + entry.Name
+		}
+		isTree := entry.Mode == object.ModeDir
+
+		match, contents, descend := selected, false, false
+		if !selected {
+			for _, filter := range filters {
+				name := strings.TrimSuffix(filter, "/")
+				switch {
+				case path == name:
+					match = true
+					contents = contents || (isTree && name != filter)
+				case isTree && strings.HasPrefix(name, path+"/"):
+					descend = true
+				}
+			}
+		}
+
+		switch {
+		case match && contents:
+			// "dir/" lists the directory's entries rather than dir itself
+			if err := r.listSubtree(entry.Hash, path, nil, true, opts, entries); err != nil {
+				return err
+			}
+		case match:
+			if !isTree || !opts.Recursive || opts.ShowTrees {
+				if err := r.appendTreeListEntry(entry, path, opts, entries); err != nil {
+					return err
+				}
+			}
+			if isTree && opts.Recursive {
+				if err := r.listSubtree(entry.Hash, path, nil, true, opts, entries); err != nil {
+					return err
+				}
+			}
+		case descend:
+			if opts.Recursive && opts.ShowTrees {
+				if err := r.appendTreeListEntry(entry, path, opts, entries); err != nil {
+					return err
+				}
+			}
+			if err := r.listSubtree(entry.Hash, path, filters, false, opts, entries); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// listSubtree loads a subtree and lists it
+func (r *Repository) listSubtree(h hash.Hash, path string, filters []string, selected bool, opts ListTreeOptions, entries *[]TreeListEntry) error {
+	obj, err := r.ObjectDB.Get(h)
+	if err != nil {
+		return fmt.Errorf("failed to load subtree %s: %w", path, err)
+	}
+	subtree, ok := obj.(*object.Tree)
+	if !ok {
+		return fmt.Errorf("subtree %s is not a tree object", path)
+	}
+	return r.listTree(subtree, path, filters, selected, opts, entries)
+}
+
+// appendTreeListEntry records a tree entry, looking up its size if asked
+func (r *Repository) appendTreeListEntry(entry object.TreeEntry, path string, opts ListTreeOptions, entries *[]TreeListEntry) error {
+	item := TreeListEntry{
+		Path: path,
+		Mode: entry.Mode,
+		Type: object.BlobType,
+		Hash: entry.Hash,
+		Size: -1,
+	}
+
+	switch entry.Mode {
+	case object.ModeDir:
+		item.Type = object.TreeType
+	case object.ModeGitlink:
+		item.Type = object.CommitType
+	default:
+		if opts.Sizes {
+			header, err := object.GetHeader(r.ObjectDB, entry.Hash)
+			if err != nil {
+				return fmt.Errorf("failed to read size of %s: %w", path, err)
+			}
+			item.Size = header.Size
+		}
+	}
+
+	*entries = append(*entries, item)
+	return nil
+}
@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// setupListTreeRepo commits a small nested tree
+func setupListTreeRepo(t *testing.T) *Repository {
+	t.Helper()
+
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	files := map[string]string{
+		"README.md":        "hello\n",
+		"src/main.go":      "package main\n",
+		"src/lib/util.go":  "package lib\n",
+		"src/lib/extra.go": "package lib\n\n// extra\n",
+	}
+	for path, content := range files {
+		full := filepath.Join(repo.Path, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+		if err := addFile(repo, path); err != nil {
+			t.Fatalf("Failed to add %s: %v", path, err)
+		}
+	}
+	if _, err := createCommit(repo, "Initial commit"); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	return repo
+}
+
+func listTreePaths(t *testing.T, repo *Repository, opts ListTreeOptions) []string {
+	t.Helper()
+
+	entries, err := repo.ListTree("HEAD", opts)
+	if err != nil {
+		t.Fatalf("ListTree failed: %v", err)
+	}
+	paths := make([]string, len(entries))
+	for i, entry := range entries {
+		paths[i] = entry.Path
+	}
+	return paths
+}
+
+func TestListTree(t *testing.T) {
+	repo := setupListTreeRepo(t)
+
+	tests := []struct {
+		name  string
+		opts  ListTreeOptions
+		paths []string
+	}{
+		{
+			name:  "top level",
+			opts:  DefaultListTreeOptions(),
+			paths: []string{"README.md", "src"},
+		},
+		{
+			name:  "recursive",
+			opts:  ListTreeOptions{Recursive: true},
+			paths: []string{"README.md", "src/lib/extra.go", "src/lib/util.go", "src/main.go"},
+		},
+		{
+			name:  "recursive with trees",
+			opts:  ListTreeOptions{Recursive: true, ShowTrees: true},
+			paths: []string{"README.md", "src", "src/lib", "src/lib/extra.go", "src/lib/util.go", "src/main.go"},
+		},
+		{
+			name:  "directory path",
+			opts:  ListTreeOptions{Paths: []string{"src"}},
+			paths: []string{"src"},
+		},
+		{
+			name:  "directory contents",
+			opts:  ListTreeOptions{Paths: []string{"src/"}},
+			paths: []string{"src/lib", "src/main.go"},
+		},
+		{
+			name:  "nested path",
+			opts:  ListTreeOptions{Paths: []string{"src/lib/util.go", "README.md"}},
+			paths: []string{"README.md", "src/lib/util.go"},
+		},
+		{
+			name:  "recursive under path",
+			opts:  ListTreeOptions{Recursive: true, Paths: []string{"src/lib"}},
+			paths: []string{"src/lib/extra.go", "src/lib/util.go"},
+		},
+		{
+			name:  "unknown path",
+			opts:  ListTreeOptions{Paths: []string{"missing"}},
+			paths: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths := listTreePaths(t, repo, tt.opts)
+			if len(paths) == 0 && len(tt.paths) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(paths, tt.paths) {
+				t.Errorf("expected %v, got %v", tt.paths, paths)
+			}
+		})
+	}
+}
+
+func TestListTreeEntryDetails(t *testing.T) {
+	repo := setupListTreeRepo(t)
+
+	opts := DefaultListTreeOptions()
+	opts.Sizes = true
+	entries, err := repo.ListTree("HEAD", opts)
+	if err != nil {
+		t.Fatalf("ListTree failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+
+	readme := entries[0]
+	if readme.Type != object.BlobType || readme.Mode != object.ModeRegular || readme.Size != 6 {
+		t.Errorf("unexpected README entry: %+v", readme)
+	}
+	blob, err := repo.readBlobContent(readme.Hash)
+	if err != nil {
+		t.Fatalf("Failed to read blob: %v", err)
+	}
+	if string(blob) != "hello\n" {
+		t.Errorf("expected README content, got %q", blob)
+	}
+
+	src := entries[1]
+	if src.Type != object.TreeType || src.Mode != object.ModeDir || src.Size != -1 {
+		t.Errorf("unexpected src entry: %+v", src)
+	}
+}
+
+func TestListTreeInvalidTreeish(t *testing.T) {
+	repo := setupListTreeRepo(t)
+
+	if _, err := repo.ListTree("no-such-branch", DefaultListTreeOptions()); err == nil {
+		t.Error("expected error for unknown tree-ish")
+	}
+}
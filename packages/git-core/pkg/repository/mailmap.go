@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// mailmapFile is the mailmap's path in the working tree and in commits
+const mailmapFile = ".mailmap"
+
+// Mailmap maps the names and emails recorded in commits to canonical
+// identities, as described by a .mailmap file
+type Mailmap struct {
+	entries []mailmapEntry
+}
+
+// mailmapEntry is one .mailmap line. An empty commitName matches any name
+// recorded with commitEmail; empty proper fields leave that part unchanged.
+type mailmapEntry struct {
+	properName  string
+	properEmail string
+	commitName  string
+	commitEmail string
+}
+
+// ParseMailmap parses .mailmap content. Each line takes one of the forms
+//
+//	Proper Name <commit@email>
+//	<proper@email> <commit@email>
+//	Proper Name <proper@email> <commit@email>
+//	Proper Name <proper@email> Commit Name <commit@email>
+//
+// Blank lines, comments and malformed lines are skipped.
+func ParseMailmap(data []byte) *Mailmap {
+	m := &Mailmap{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		var names, emails []string
+		for {
+			open := strings.Index(line, "<")
+			if open < 0 {
+				break
+			}
+			end := strings.Index(line[open:], ">")
+			if end < 0 {
+				break
+			}
+			names = append(names, strings.TrimSpace(line[:open]))
+			emails = append(emails, strings.TrimSpace(line[open+1:open+end]))
+			line = line[open+end+1:]
+		}
+
+		switch len(emails) {
+		case 1:
+			if names[0] != "" {
+				m.entries = append(m.entries, mailmapEntry{properName: names[0], commitEmail: emails[0]})
+			}
+		case 2:
+			m.entries = append(m.entries, mailmapEntry{
+				properName:  names[0],
+				properEmail: emails[0],
+				commitName:  names[1],
+				commitEmail: emails[1],
+			})
+		}
+	}
+
+	return m
+}
+
+// Resolve returns the canonical name and email for an identity recorded in
+// a commit. Emails and names are compared case-insensitively; an entry that
+// names the commit identity wins over one matching the email alone.
+func (m *Mailmap) Resolve(name, email string) (string, string) {
+	if m == nil {
+		return name, email
+	}
+
+	var match *mailmapEntry
+	for i := range m.entries {
+		entry := &m.entries[i]
+		if !strings.EqualFold(entry.commitEmail, email) {
+			continue
+		}
+		if entry.commitName != "" {
+			if strings.EqualFold(entry.commitName, name) {
+				match = entry
+				break
+			}
+			continue
+		}
+		// Later email-only lines override earlier ones
+		match = entry
+	}
+
+	if match == nil {
+		return name, email
+	}
+	if match.properName != "" {
+		name = match.properName
+	}
+	if match.properEmail != "" {
+		email = match.properEmail
+	}
+	return name, email
+}
+
+// MapCommit returns a commit with its author and committer canonicalized.
+// The commit is not modified: a copy is returned when an identity changes.
+func (m *Mailmap) MapCommit(commit *object.Commit) *object.Commit {
+	if m == nil || len(m.entries) == 0 {
+		return commit
+	}
+
+	author, authorChanged := m.mapSignature(commit.Author)
+	committer, committerChanged := m.mapSignature(commit.Committer)
+	if !authorChanged && !committerChanged {
+		return commit
+	}
+
+	mapped := *commit
+	mapped.Author = author
+	mapped.Committer = committer
+	return &mapped
+}
+
+// mapSignature resolves a signature's identity, keeping its time
+func (m *Mailmap) mapSignature(sig object.Signature) (object.Signature, bool) {
+	name, email := m.Resolve(sig.Name, sig.Email)
+	if name == sig.Name && email == sig.Email {
+		return sig, false
+	}
+	return object.Signature{Name: name, Email: email, When: sig.When}, true
+}
+
+// Mailmap loads the repository's .mailmap: the working tree copy when
+// there is one, otherwise the one committed at HEAD. A repository without
+// a mailmap gets an empty one, which maps every identity to itself.
+func (r *Repository) Mailmap() (*Mailmap, error) {
+	if !r.IsBare() {
+		data, err := os.ReadFile(filepath.Join(r.WorkTree(), mailmapFile))
+		if err == nil {
+			return ParseMailmap(data), nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read %s: %w", mailmapFile, err)
+		}
+	}
+
+	head, err := r.ResolveHEAD()
+	if err != nil {
+		// Unborn branch
+		return &Mailmap{}, nil
+	}
+	_, commit, err := r.peelToCommit(head)
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.getFileAtCommit(mailmapFile, commit)
+	if err != nil {
+		return &Mailmap{}, nil
+	}
+	return ParseMailmap(data), nil
+}
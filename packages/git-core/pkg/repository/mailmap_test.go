@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMailmapResolve(t *testing.T) {
+	mailmap := ParseMailmap([]byte(`# Canonical names
+Proper Name <commit@example.com>
+<proper@example.com> <old@example.com>
+Jane Doe <jane@example.com> <jane@laptop>
+Joe <joe@example.com> Joseph <shared@example.com>
+Shared <shared@example.com>
+not a mapping
+`))
+
+	tests := []struct {
+		name, email         string
+		wantName, wantEmail string
+	}{
+		{"someone", "commit@example.com", "Proper Name", "commit@example.com"},
+		{"someone", "COMMIT@example.com", "Proper Name", "COMMIT@example.com"},
+		{"Old", "old@example.com", "Old", "proper@example.com"},
+		{"jd", "jane@laptop", "Jane Doe", "jane@example.com"},
+		{"Joseph", "shared@example.com", "Joe", "joe@example.com"},
+		{"Other", "shared@example.com", "Shared", "shared@example.com"},
+		{"Unmapped", "nobody@example.com", "Unmapped", "nobody@example.com"},
+	}
+
+	for _, tt := range tests {
+		name, email := mailmap.Resolve(tt.name, tt.email)
+		if name != tt.wantName || email != tt.wantEmail {
+			t.Errorf("Resolve(%q, %q) = %q, %q; expected %q, %q", tt.name, tt.email, name, email, tt.wantName, tt.wantEmail)
+		}
+	}
+}
+
+func TestRepositoryMailmapFromHEAD(t *testing.T) {
+	repo, _ := setupUndoRepo(t, "one\n")
+
+	// Without a .mailmap identities are unchanged
+	mailmap, err := repo.Mailmap()
+	if err != nil {
+		t.Fatalf("Mailmap failed: %v", err)
+	}
+	if name, _ := mailmap.Resolve("a", "a@example.com"); name != "a" {
+		t.Errorf("expected identity mapping, got %q", name)
+	}
+
+	if err := os.WriteFile(filepath.Join(repo.Path, ".mailmap"), []byte("A <a@example.com>\n"), 0644); err != nil {
+		t.Fatalf("Failed to write .mailmap: %v", err)
+	}
+	if err := addFile(repo, ".mailmap"); err != nil {
+		t.Fatalf("Failed to add .mailmap: %v", err)
+	}
+	if _, err := createCommit(repo, "Add mailmap"); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	// Bare repositories and deleted working tree copies fall back to HEAD
+	if err := os.Remove(filepath.Join(repo.Path, ".mailmap")); err != nil {
+		t.Fatalf("Failed to remove .mailmap: %v", err)
+	}
+
+	mailmap, err = repo.Mailmap()
+	if err != nil {
+		t.Fatalf("Mailmap failed: %v", err)
+	}
+	if name, _ := mailmap.Resolve("a", "a@example.com"); name != "A" {
+		t.Errorf("expected mapping from HEAD, got %q", name)
+	}
+}
+
+func TestLogAndBlameMailmap(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	commitAs(t, repo, "alice", "alice@laptop", "alice 1", 1)
+	head := commitAs(t, repo, "bobby", "bob@work.example.com", "bob 1", 2)
+
+	mailmap := "Alice Smith <alice@example.com> <alice@laptop>\nBob <bob@work.example.com>\n"
+	if err := os.WriteFile(filepath.Join(repo.Path, ".mailmap"), []byte(mailmap), 0644); err != nil {
+		t.Fatalf("Failed to write .mailmap: %v", err)
+	}
+
+	opts := DefaultLogOptions()
+	opts.Author = "Alice Smith"
+	entries, err := repo.Log("", opts)
+	if err != nil {
+		t.Fatalf("Log failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected the author filter to match the canonical name, got %d entries", len(entries))
+	}
+	author := entries[0].Commit.Author
+	if author.Name != "Alice Smith" || author.Email != "alice@example.com" {
+		t.Errorf("expected the canonical author, got %s <%s>", author.Name, author.Email)
+	}
+	if !author.When.Equal(time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC)) {
+		t.Errorf("expected the author date to be kept, got %v", author.When)
+	}
+
+	opts = DefaultLogOptions()
+	opts.UseMailmap = false
+	entries, err = repo.Log("", opts)
+	if err != nil {
+		t.Fatalf("Log failed: %v", err)
+	}
+	if entries[0].Commit.Author.Name != "bobby" {
+		t.Errorf("expected the recorded author without the mailmap, got %q", entries[0].Commit.Author.Name)
+	}
+
+	lines, err := repo.Blame("file.txt", head, DefaultBlameOptions())
+	if err != nil {
+		t.Fatalf("Blame failed: %v", err)
+	}
+	if committer := lines[0].Commit.Committer; committer.Name != "Bob" || committer.Email != "bob@work.example.com" {
+		t.Errorf("expected the canonical committer, got %s <%s>", committer.Name, committer.Email)
+	}
+
+	// Mapping never alters the stored commit
+	commit, _, err := repo.GetCommit(head.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit.Author.Name != "bobby" {
+		t.Errorf("expected the stored commit to keep its author, got %q", commit.Author.Name)
+	}
+}
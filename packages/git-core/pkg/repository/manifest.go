@@ -0,0 +1,219 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// CheckoutManifest maps worktree paths to the blob hash of their content
+type CheckoutManifest map[string]hash.Hash
+
+// CheckoutVerification is the result of comparing the worktree with HEAD's tree
+type CheckoutVerification struct {
+	// Clean is true when every file in HEAD is present with matching content
+	Clean bool
+
+	// Modified lists files whose content differs from HEAD
+	Modified []string
+
+	// Missing lists files in HEAD that are absent from the worktree
+	Missing []string
+
+	// Untracked lists non-ignored worktree files that are not in HEAD
+	Untracked []string
+}
+
+// Mismatches returns all paths that make the checkout unclean, sorted
+func (v *CheckoutVerification) Mismatches() []string {
+	paths := make([]string, 0, len(v.Modified)+len(v.Missing))
+	paths = append(paths, v.Modified...)
+	paths = append(paths, v.Missing...)
+	sort.Strings(paths)
+	return paths
+}
+
+// WorktreeManifest hashes every non-ignored file in the worktree
+func (r *Repository) WorktreeManifest() (CheckoutManifest, error) {
+	manifest := make(CheckoutManifest)
+
+	err := r.walkWorktreeBlobs(func(path string, blobHash hash.Hash) error {
+		manifest[path] = blobHash
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// VerifyCheckout compares the worktree with HEAD's tree in a single pass.
+// It is cheaper than a full status because the index is never consulted.
+func (r *Repository) VerifyCheckout() (*CheckoutVerification, error) {
+	if r.IsBare() {
+		return nil, fmt.Errorf("cannot verify checkout in a bare repository")
+	}
+
+	// Collect the files HEAD expects to be present
+	expected, err := r.headTreeFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	// Files outside the sparse-checkout cone are expected to be absent
+	sparse, err := r.SparseCheckout()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CheckoutVerification{
+		Modified:  make([]string, 0),
+		Missing:   make([]string, 0),
+		Untracked: make([]string, 0),
+	}
+
+	// Walk the worktree once, checking off expected files as we go
+	seen := make(map[string]bool, len(expected))
+	err = r.walkWorktreeBlobs(func(path string, blobHash hash.Hash) error {
+		want, ok := expected[path]
+		if !ok {
+			result.Untracked = append(result.Untracked, path)
+			return nil
+		}
+
+		seen[path] = true
+		if !want.hash.Equals(blobHash) {
+			result.Modified = append(result.Modified, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for path, file := range expected {
+		// Submodules are not checked out by this implementation
+		if file.mode == object.ModeGitlink {
+			continue
+		}
+		if sparse != nil && !sparse.Includes(path) {
+			continue
+		}
+		if !seen[path] {
+			result.Missing = append(result.Missing, path)
+		}
+	}
+
+	sort.Strings(result.Modified)
+	sort.Strings(result.Missing)
+	sort.Strings(result.Untracked)
+	result.Clean = len(result.Modified) == 0 && len(result.Missing) == 0
+
+	return result, nil
+}
+
+// headTreeFiles returns all files in HEAD's tree, or none for an unborn branch
+func (r *Repository) headTreeFiles() (map[string]struct {
+	hash hash.Hash
+	mode object.FileMode
+}, error) {
+	files := make(map[string]struct {
+		hash hash.Hash
+		mode object.FileMode
+	})
+
+	headHash, err := r.ResolveHEAD()
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// No commits yet
+			return files, nil
+		}
+		return nil, fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+
+	commitObj, err := r.ObjectDB.Get(headHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load HEAD commit: %w", err)
+	}
+
+	commit, ok := commitObj.(*object.Commit)
+	if !ok {
+		return nil, fmt.Errorf("HEAD is not a commit")
+	}
+
+	treeObj, err := r.ObjectDB.Get(commit.Tree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load HEAD tree: %w", err)
+	}
+
+	tree, ok := treeObj.(*object.Tree)
+	if !ok {
+		return nil, fmt.Errorf("HEAD tree is not a tree object")
+	}
+
+	if err := r.collectTreeFiles(tree, "", files); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// walkWorktreeBlobs calls fn with the blob hash of every non-ignored worktree file
+func (r *Repository) walkWorktreeBlobs(fn func(path string, blobHash hash.Hash) error) error {
+	workTreePath := r.WorkTree()
+
+	gitignore, err := index.LoadGitignore(workTreePath)
+	if err != nil {
+		return fmt.Errorf("failed to load gitignore: %w", err)
+	}
+
+	return filepath.WalkDir(workTreePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip .git directory
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(workTreePath, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		if gitignore.Match(relPath) {
+			return nil
+		}
+
+		// Symlinks are stored as blobs containing the link target
+		var content []byte
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return fmt.Errorf("failed to read symlink %s: %w", relPath, err)
+			}
+			content = []byte(target)
+		} else {
+			content, err = os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", relPath, err)
+			}
+		}
+
+		return fn(relPath, hash.HashBlob(r.Hasher, content))
+	})
+}
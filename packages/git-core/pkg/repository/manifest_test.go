@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// setupManifestRepo creates a repository with one commit containing a.txt and b.txt
+func setupManifestRepo(t *testing.T) *Repository {
+	t.Helper()
+
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(repo.Path, "a.txt"), []byte("alpha\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	commitHash := createTestCommitForHistory(t, repo, "b.txt", "beta\n", "Initial commit", nil)
+
+	branch, err := repo.CurrentBranch()
+	if err != nil {
+		t.Fatalf("Failed to get current branch: %v", err)
+	}
+	if err := repo.UpdateRef("refs/heads/"+branch, commitHash); err != nil {
+		t.Fatalf("Failed to update branch: %v", err)
+	}
+
+	return repo
+}
+
+// TestWorktreeManifest tests hashing the worktree
+func TestWorktreeManifest(t *testing.T) {
+	repo := setupManifestRepo(t)
+
+	manifest, err := repo.WorktreeManifest()
+	if err != nil {
+		t.Fatalf("WorktreeManifest failed: %v", err)
+	}
+
+	if len(manifest) != 2 {
+		t.Fatalf("Expected 2 entries, got %d: %v", len(manifest), manifest)
+	}
+
+	want := hash.HashBlob(repo.Hasher, []byte("beta\n"))
+	if !manifest["b.txt"].Equals(want) {
+		t.Errorf("b.txt hash = %s, want %s", manifest["b.txt"], want)
+	}
+}
+
+// TestVerifyCheckoutClean tests verification of an intact checkout
+func TestVerifyCheckoutClean(t *testing.T) {
+	repo := setupManifestRepo(t)
+
+	// createTestCommitForHistory only commits the named file, so a.txt is untracked
+	result, err := repo.VerifyCheckout()
+	if err != nil {
+		t.Fatalf("VerifyCheckout failed: %v", err)
+	}
+
+	if !result.Clean {
+		t.Errorf("Expected clean checkout, mismatches: %v", result.Mismatches())
+	}
+	if len(result.Untracked) != 1 || result.Untracked[0] != "a.txt" {
+		t.Errorf("Untracked = %v, want [a.txt]", result.Untracked)
+	}
+}
+
+// TestVerifyCheckoutMismatches tests detection of modified and missing files
+func TestVerifyCheckoutMismatches(t *testing.T) {
+	repo := setupManifestRepo(t)
+
+	commitHash, err := repo.ResolveHEAD()
+	if err != nil {
+		t.Fatalf("Failed to resolve HEAD: %v", err)
+	}
+	second := createTestCommitForHistory(t, repo, "a.txt", "alpha\n", "Add a.txt", []hash.Hash{commitHash})
+	if err := repo.UpdateRef("refs/heads/main", second); err != nil {
+		t.Fatalf("Failed to update branch: %v", err)
+	}
+
+	// Simulate storage eviction and corruption
+	if err := os.Remove(filepath.Join(repo.Path, "a.txt")); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repo.Path, "b.txt"), []byte("corrupted\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	result, err := repo.VerifyCheckout()
+	if err != nil {
+		t.Fatalf("VerifyCheckout failed: %v", err)
+	}
+
+	if result.Clean {
+		t.Fatal("Expected unclean checkout")
+	}
+	if len(result.Missing) != 1 || result.Missing[0] != "a.txt" {
+		t.Errorf("Missing = %v, want [a.txt]", result.Missing)
+	}
+	if len(result.Modified) != 1 || result.Modified[0] != "b.txt" {
+		t.Errorf("Modified = %v, want [b.txt]", result.Modified)
+	}
+
+	mismatches := result.Mismatches()
+	if len(mismatches) != 2 || mismatches[0] != "a.txt" || mismatches[1] != "b.txt" {
+		t.Errorf("Mismatches = %v, want [a.txt b.txt]", mismatches)
+	}
+}
+
+// TestVerifyCheckoutUnborn tests verification before the first commit
+func TestVerifyCheckoutUnborn(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	result, err := repo.VerifyCheckout()
+	if err != nil {
+		t.Fatalf("VerifyCheckout failed: %v", err)
+	}
+	if !result.Clean {
+		t.Error("Expected empty repository to be clean")
+	}
+}
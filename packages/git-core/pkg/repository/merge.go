@@ -6,10 +6,10 @@ import (
 	"path/filepath"
 	"time"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
-	"github.com/nseba/browser-git/git-core/pkg/index"
-	"github.com/nseba/browser-git/git-core/pkg/merge"
-	"github.com/nseba/browser-git/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/merge"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
 )
 
 // MergeOptions contains options for merge operations
@@ -31,7 +31,8 @@ func DefaultMergeOptions() *MergeOptions {
 	}
 }
 
-// Merge merges a branch into the current branch
+// Merge merges a branch into the current branch. "FETCH_HEAD" merges the
+// ref the last fetch marked for merging, as git pull does.
 func (r *Repository) Merge(branchName string, opts *MergeOptions) (*merge.MergeResult, error) {
 	if opts == nil {
 		opts = DefaultMergeOptions()
@@ -44,10 +45,9 @@ func (r *Repository) Merge(branchName string, opts *MergeOptions) (*merge.MergeR
 	}
 
 	// Get the branch to merge
-	branchRef := fmt.Sprintf("refs/heads/%s", branchName)
-	branchCommitHash, err := r.ResolveRef(branchRef)
+	branchCommitHash, description, err := r.resolveMergeHead(branchName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to resolve branch %s: %w", branchName, err)
+		return nil, err
 	}
 
 	// Check if we can do a fast-forward merge
@@ -58,8 +58,17 @@ func (r *Repository) Merge(branchName string, opts *MergeOptions) (*merge.MergeR
 		}
 
 		if canFF {
+			if err := r.writeOrigHead(currentCommitHash); err != nil {
+				return nil, err
+			}
+
 			// Perform fast-forward merge
-			return r.fastForwardMerge(branchCommitHash, branchName)
+			result, err := r.fastForwardMerge(branchCommitHash, branchName)
+			if err != nil {
+				return nil, err
+			}
+			r.runPostHook(HookPostMerge, "0")
+			return result, nil
 		}
 	}
 
@@ -84,7 +93,7 @@ func (r *Repository) Merge(branchName string, opts *MergeOptions) (*merge.MergeR
 
 	// If there are conflicts, save merge state and return them
 	if !result.Success {
-		if err := r.saveMergeState(branchCommitHash, branchName, result.Conflicts); err != nil {
+		if err := r.saveMergeState(branchCommitHash, branchName, description, result.Conflicts); err != nil {
 			return nil, fmt.Errorf("failed to save merge state: %w", err)
 		}
 		return result, nil
@@ -95,7 +104,7 @@ func (r *Repository) Merge(branchName string, opts *MergeOptions) (*merge.MergeR
 		result.TreeHash,
 		currentCommitHash,
 		branchCommitHash,
-		branchName,
+		description,
 		opts,
 	)
 
@@ -105,19 +114,13 @@ func (r *Repository) Merge(branchName string, opts *MergeOptions) (*merge.MergeR
 
 	result.CommitHash = commitHash
 
-	// Update HEAD to point to new commit
-	currentBranch, err := r.CurrentBranch()
-	if err == nil {
-		// Update branch ref
-		branchRef := fmt.Sprintf("refs/heads/%s", currentBranch)
-		if err := r.UpdateRef(branchRef, commitHash); err != nil {
-			return nil, fmt.Errorf("failed to update branch ref: %w", err)
-		}
-	} else {
-		// Detached HEAD - update HEAD directly
-		if err := r.SetHEAD(commitHash.String()); err != nil {
-			return nil, fmt.Errorf("failed to update HEAD: %w", err)
-		}
+	if err := r.writeOrigHead(currentCommitHash); err != nil {
+		return nil, err
+	}
+
+	// Update the current branch, or HEAD directly when detached
+	if err := r.UpdateHEAD(commitHash, fmt.Sprintf("merge %s: Merge made by the 'ort' strategy.", branchName)); err != nil {
+		return nil, fmt.Errorf("failed to update HEAD: %w", err)
 	}
 
 	// Update working directory
@@ -125,9 +128,45 @@ func (r *Repository) Merge(branchName string, opts *MergeOptions) (*merge.MergeR
 		return nil, fmt.Errorf("failed to update working directory: %w", err)
 	}
 
+	r.runPostHook(HookPostMerge, "0")
 	return result, nil
 }
 
+// resolveMergeHead resolves what Merge is asked to merge to a commit, and
+// returns the description merge messages use for it, such as
+// "branch 'feature'"
+func (r *Repository) resolveMergeHead(name string) (hash.Hash, string, error) {
+	if name != "FETCH_HEAD" {
+		h, err := r.ResolveRef(fmt.Sprintf("refs/heads/%s", name))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to resolve branch %s: %w", name, err)
+		}
+		return h, fmt.Sprintf("branch '%s'", name), nil
+	}
+
+	entries, err := r.FetchHead()
+	if err != nil {
+		return nil, "", err
+	}
+	var forMerge []FetchHeadEntry
+	for _, entry := range entries {
+		if !entry.NotForMerge {
+			forMerge = append(forMerge, entry)
+		}
+	}
+	switch {
+	case len(forMerge) == 0:
+		return nil, "", fmt.Errorf("no fetched ref is marked for merging in FETCH_HEAD")
+	case len(forMerge) > 1:
+		return nil, "", fmt.Errorf("FETCH_HEAD marks %d refs for merging; merging more than one is not supported", len(forMerge))
+	}
+	h, _, err := r.peelToCommit(forMerge[0].Hash)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to resolve FETCH_HEAD: %w", err)
+	}
+	return h, forMerge[0].Description(), nil
+}
+
 // fastForwardMerge performs a fast-forward merge
 func (r *Repository) fastForwardMerge(targetCommitHash hash.Hash, branchName string) (*merge.MergeResult, error) {
 	// Update current branch to point to target commit
@@ -137,7 +176,7 @@ func (r *Repository) fastForwardMerge(targetCommitHash hash.Hash, branchName str
 	}
 
 	branchRef := fmt.Sprintf("refs/heads/%s", currentBranch)
-	if err := r.UpdateRef(branchRef, targetCommitHash); err != nil {
+	if err := r.UpdateRefWithLog(branchRef, targetCommitHash, fmt.Sprintf("merge %s: Fast-forward", branchName)); err != nil {
 		return nil, fmt.Errorf("failed to update branch ref: %w", err)
 	}
 
@@ -170,7 +209,7 @@ func (r *Repository) createMergeCommit(
 	treeHash hash.Hash,
 	parent1 hash.Hash,
 	parent2 hash.Hash,
-	branchName string,
+	description string,
 	opts *MergeOptions,
 ) (hash.Hash, error) {
 	// Create commit object
@@ -202,7 +241,7 @@ func (r *Repository) createMergeCommit(
 	if opts.CommitMessage != "" {
 		commit.Message = opts.CommitMessage
 	} else {
-		commit.Message = fmt.Sprintf("Merge branch '%s'", branchName)
+		commit.Message = "Merge " + description
 	}
 
 	// Compute hash
@@ -221,20 +260,7 @@ func (r *Repository) createMergeCommit(
 
 // ResolveHEAD resolves HEAD to a commit hash
 func (r *Repository) ResolveHEAD() (hash.Hash, error) {
-	head, err := r.HEAD()
-	if err != nil {
-		return nil, err
-	}
-
-	// If HEAD is a symbolic ref, resolve it
-	const prefix = "ref: "
-	if len(head) > len(prefix) && head[:len(prefix)] == prefix {
-		refName := head[len(prefix):]
-		return r.ResolveRef(refName)
-	}
-
-	// HEAD is a direct hash
-	return hash.ParseHash(head)
+	return r.ResolveRef("HEAD")
 }
 
 // checkoutTree checks out a tree to the working directory
@@ -335,6 +361,15 @@ func (r *Repository) checkoutTreeRecursive(tree *object.Tree, prefix string, idx
 				MTime: time.Now(),
 				CTime: time.Now(),
 			}
+
+			// Record the written file's stat data so it reads as unmodified
+			if !r.IsBare() {
+				if info, err := os.Stat(filepath.Join(r.WorkTree(), path)); err == nil {
+					indexEntry.MTime = info.ModTime()
+					indexEntry.CTime = info.ModTime()
+					indexEntry.Size = uint32(info.Size())
+				}
+			}
 			idx.AddEntry(indexEntry)
 		}
 	}
@@ -343,7 +378,7 @@ func (r *Repository) checkoutTreeRecursive(tree *object.Tree, prefix string, idx
 }
 
 // saveMergeState saves the merge state when there are conflicts
-func (r *Repository) saveMergeState(theirCommit hash.Hash, branchName string, conflicts []merge.Conflict) error {
+func (r *Repository) saveMergeState(theirCommit hash.Hash, branchName, description string, conflicts []merge.Conflict) error {
 	// Write MERGE_HEAD
 	mergeHeadPath := filepath.Join(r.GitDir, "MERGE_HEAD")
 	if err := os.WriteFile(mergeHeadPath, []byte(theirCommit.String()+"\n"), 0644); err != nil {
@@ -352,7 +387,7 @@ func (r *Repository) saveMergeState(theirCommit hash.Hash, branchName string, co
 
 	// Write MERGE_MSG
 	mergeMsgPath := filepath.Join(r.GitDir, "MERGE_MSG")
-	msg := fmt.Sprintf("Merge branch '%s'\n\nConflicts:\n", branchName)
+	msg := fmt.Sprintf("Merge %s\n\nConflicts:\n", description)
 	for _, c := range conflicts {
 		msg += fmt.Sprintf("\t%s\n", c.Path)
 	}
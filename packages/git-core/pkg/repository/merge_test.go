@@ -5,7 +5,8 @@ import (
 	"path/filepath"
 	"testing"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
 )
 
 // TestMergeFastForward tests a fast-forward merge scenario
@@ -213,19 +214,58 @@ func TestMergeThreeWayNoConflict(t *testing.T) {
 // Helper functions for testing
 
 func addFile(repo *Repository, path string) error {
-	// This is a placeholder - actual implementation would use index.Add
-	// For now, we'll skip this in the test
-	return nil
+	indexPath := filepath.Join(repo.GitDir, "index")
+	idx, err := index.Load(indexPath)
+	if err != nil {
+		return err
+	}
+
+	if err := idx.Add(repo.Path, []string{path}, index.AddOptions{}); err != nil {
+		return err
+	}
+
+	if err := idx.WriteBlobs(repo.Path, repo.ObjectDB); err != nil {
+		return err
+	}
+
+	return idx.Save(indexPath)
 }
 
 func createCommit(repo *Repository, message string) (hash.Hash, error) {
-	// This is a placeholder - actual implementation would create a real commit
-	// For now, we'll skip this in the test
-	return nil, nil
+	indexPath := filepath.Join(repo.GitDir, "index")
+	idx, err := index.Load(indexPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parent is the current HEAD commit, if any
+	var parents []hash.Hash
+	if head, err := repo.ResolveHEAD(); err == nil {
+		parents = append(parents, head)
+	}
+
+	author := index.DefaultSignature("Test User", "test@example.com")
+	commitHash, err := idx.CreateCommit(repo.Hasher, repo.ObjectDB, index.CommitOptions{
+		Message:   message,
+		Author:    author,
+		Committer: author,
+		Parents:   parents,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := repo.CurrentBranch(); err != nil {
+		return nil, err
+	}
+
+	if err := repo.UpdateHEAD(commitHash, commitReflogMessage("commit", message)); err != nil {
+		return nil, err
+	}
+
+	return commitHash, nil
 }
 
 func switchBranch(repo *Repository, branchName string) error {
-	// This is a placeholder - actual implementation would use checkout
-	// For now, we'll skip this in the test
-	return nil
+	return repo.Checkout(branchName, DefaultCheckoutOptions())
 }
@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+// newUploadPackServer serves ref discovery for the given refs and a pack
+// of every object in the source repository
+func newUploadPackServer(t *testing.T, source *Repository, refs []protocol.Reference) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(newUploadPackHandler(t, source, refs))
+}
+
+// newUploadPackHandler is the handler behind newUploadPackServer
+func newUploadPackHandler(t *testing.T, source *Repository, refs []protocol.Reference) http.Handler {
+	t.Helper()
+
+	pack := testPackfile(t, source)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writer := protocol.NewPktLineWriter(w)
+
+		if req.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+			writer.WriteString("# service=git-upload-pack\n")
+			writer.WriteFlush()
+			for i, ref := range refs {
+				if i == 0 {
+					writer.WriteString(fmt.Sprintf("%s %s\x00symref=HEAD:refs/heads/main\n", ref.Hash, ref.Name))
+				} else {
+					writer.WriteString(fmt.Sprintf("%s %s\n", ref.Hash, ref.Name))
+				}
+			}
+			writer.WriteFlush()
+			return
+		}
+
+		writer.WriteString("NAK\n")
+		writer.WriteLine(append([]byte{1}, pack...))
+		writer.WriteFlush()
+	})
+}
+
+// testPackfile packs every object in the source repository
+func testPackfile(t *testing.T, source *Repository) []byte {
+	t.Helper()
+
+	hashes, err := source.ObjectDB.List()
+	if err != nil {
+		t.Fatalf("Failed to list objects: %v", err)
+	}
+
+	objects := make([]protocol.PackfileObject, 0, len(hashes))
+	for _, h := range hashes {
+		obj, err := source.ObjectDB.Get(h)
+		if err != nil {
+			t.Fatalf("Failed to read object: %v", err)
+		}
+
+		var data bytes.Buffer
+		if err := obj.Serialize(&data); err != nil {
+			t.Fatalf("Failed to serialize object: %v", err)
+		}
+
+		objType := map[object.Type]uint8{
+			object.CommitType: protocol.ObjCommit,
+			object.TreeType:   protocol.ObjTree,
+			object.BlobType:   protocol.ObjBlob,
+			object.TagType:    protocol.ObjTag,
+		}[obj.Type()]
+		objects = append(objects, protocol.PackfileObject{Type: objType, Size: uint64(data.Len()), Data: data.Bytes()})
+	}
+
+	var pack bytes.Buffer
+	if err := protocol.NewPackfileWriter(&pack).WritePackfile(objects); err != nil {
+		t.Fatalf("Failed to write packfile: %v", err)
+	}
+	return pack.Bytes()
+}
+
+// TestCloneMirror tests that a mirror clone copies every ref into a bare repository
+func TestCloneMirror(t *testing.T) {
+	source, err := Create(filepath.Join(t.TempDir(), "source"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(source.Path, "file.txt"), []byte("one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := addFile(source, "file.txt"); err != nil {
+		t.Fatalf("Failed to add file: %v", err)
+	}
+	first, err := createCommit(source, "first")
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(source.Path, "file.txt"), []byte("two\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := addFile(source, "file.txt"); err != nil {
+		t.Fatalf("Failed to add file: %v", err)
+	}
+	second, err := createCommit(source, "second")
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	refs := []protocol.Reference{
+		{Name: "HEAD", Hash: second.String()},
+		{Name: "refs/heads/main", Hash: second.String()},
+		{Name: "refs/pull/1/head", Hash: first.String()},
+		{Name: "refs/notes/commits", Hash: first.String()},
+		{Name: "refs/tags/v1", Hash: first.String()},
+		{Name: "refs/tags/v1^{}", Hash: first.String()},
+	}
+	server := newUploadPackServer(t, source, refs)
+	defer server.Close()
+
+	opts := DefaultCloneOptions()
+	opts.Mirror = true
+	repo, err := Clone(server.URL+"/repo.git", filepath.Join(t.TempDir(), "mirror.git"), opts)
+	if err != nil {
+		t.Fatalf("Mirror clone failed: %v", err)
+	}
+
+	if !repo.IsBare() {
+		t.Error("Mirror clone should be bare")
+	}
+	if !repo.Config.IsMirrorRemote("origin") {
+		t.Error("Expected remote.origin.mirror to be set")
+	}
+	specs, err := repo.Config.GetFetchRefSpecs("origin")
+	if err != nil || len(specs) != 1 || specs[0] != "+refs/*:refs/*" {
+		t.Errorf("Unexpected fetch refspecs: %v", specs)
+	}
+
+	for _, ref := range refs[1:5] {
+		h, err := repo.GetRef(ref.Name)
+		if err != nil {
+			t.Errorf("Missing mirrored ref %s: %v", ref.Name, err)
+			continue
+		}
+		if h.String() != ref.Hash {
+			t.Errorf("Ref %s = %s, expected %s", ref.Name, h.String(), ref.Hash)
+		}
+	}
+
+	remoteRefs, _ := repo.ListRefs("refs/remotes/")
+	if len(remoteRefs) != 0 {
+		t.Errorf("Mirror should not create tracking refs, got %v", remoteRefs)
+	}
+	if _, err := repo.GetRef("refs/tags/v1^{}"); err == nil {
+		t.Error("Peeled tag entry should not become a ref")
+	}
+
+	// The config survives reopening
+	reopened, err := Open(repo.Path)
+	if err != nil {
+		t.Fatalf("Failed to open mirror: %v", err)
+	}
+	if !reopened.Config.IsMirrorRemote("origin") {
+		t.Error("Mirror setting was not saved")
+	}
+	if _, _, err := reopened.GetCommit(first.String()); err != nil {
+		t.Errorf("Mirror is missing objects: %v", err)
+	}
+}
+
+// TestCloneMirrorRejectsDepth tests that a mirror clone cannot be shallow
+func TestCloneMirrorRejectsDepth(t *testing.T) {
+	opts := DefaultCloneOptions()
+	opts.Mirror = true
+	opts.Depth = 1
+
+	_, err := Clone("https://example.com/repo.git", filepath.Join(t.TempDir(), "mirror.git"), opts)
+	if err == nil || !strings.Contains(err.Error(), "shallow") {
+		t.Errorf("Expected shallow mirror error, got %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+)
+
+// MovedPath records one index entry renamed by Move
+type MovedPath struct {
+	From string
+	To   string
+}
+
+// MoveResult describes what Move renamed
+type MoveResult struct {
+	// Source and Destination are the worktree paths that were renamed
+	Source      string
+	Destination string
+	// Moved lists every index entry that was renamed
+	Moved []MovedPath
+}
+
+// Move renames a tracked file or directory in the worktree and the index,
+// like git mv. When dst is an existing directory, src is moved into it.
+// Renames that only change case are supported on case-insensitive
+// filesystems. The worktree rename is undone if the index cannot be saved.
+func (r *Repository) Move(src, dst string) (*MoveResult, error) {
+	if r.IsBare() {
+		return nil, fmt.Errorf("cannot move files in a bare repository")
+	}
+
+	src = strings.Trim(path.Clean(filepath.ToSlash(src)), "/")
+	dst = strings.Trim(path.Clean(filepath.ToSlash(dst)), "/")
+	if src == "." || src == "" || strings.HasPrefix(src, "../") {
+		return nil, fmt.Errorf("bad source '%s'", src)
+	}
+	if dst == "" || strings.HasPrefix(dst, "../") || dst == ".." {
+		return nil, fmt.Errorf("bad destination '%s'", dst)
+	}
+
+	indexPath := filepath.Join(r.GitDir, "index")
+	idx, err := index.Load(indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+
+	workTree := r.WorkTree()
+	srcPath := filepath.Join(workTree, filepath.FromSlash(src))
+	srcInfo, err := os.Lstat(srcPath)
+	if err != nil {
+		return nil, fmt.Errorf("bad source '%s': %w", src, err)
+	}
+
+	// A case-only rename finds the source itself at the destination on a
+	// case-insensitive filesystem
+	dstInfo, err := os.Lstat(filepath.Join(workTree, filepath.FromSlash(dst)))
+	caseOnly := src != dst && strings.EqualFold(src, dst) &&
+		(err != nil || os.SameFile(srcInfo, dstInfo))
+
+	// Moving into an existing directory keeps the source's name
+	if !caseOnly {
+		if info, err := os.Stat(filepath.Join(workTree, filepath.FromSlash(dst))); err == nil && info.IsDir() {
+			if dst == "." {
+				dst = path.Base(src)
+			} else {
+				dst = dst + "/" + path.Base(src)
+			}
+		}
+	}
+	if src == dst {
+		return nil, fmt.Errorf("source and destination are the same: %s", src)
+	}
+	if strings.HasPrefix(dst, src+"/") {
+		return nil, fmt.Errorf("cannot move directory '%s' into itself", src)
+	}
+
+	dstPath := filepath.Join(workTree, filepath.FromSlash(dst))
+	if _, err := os.Lstat(dstPath); err == nil && !caseOnly {
+		return nil, fmt.Errorf("destination '%s' already exists", dst)
+	}
+	if info, err := os.Stat(filepath.Dir(dstPath)); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("destination directory '%s' does not exist", path.Dir(dst))
+	}
+
+	// Collect the index entries to rename
+	moved := []MovedPath{}
+	for _, entry := range idx.Entries {
+		var to string
+		switch {
+		case entry.Path == src && !srcInfo.IsDir():
+			to = dst
+		case srcInfo.IsDir() && strings.HasPrefix(entry.Path, src+"/"):
+			to = dst + strings.TrimPrefix(entry.Path, src)
+		default:
+			continue
+		}
+		if entry.StageFlag != 0 {
+			return nil, fmt.Errorf("cannot move '%s': it has merge conflicts", entry.Path)
+		}
+		moved = append(moved, MovedPath{From: entry.Path, To: to})
+	}
+	if len(moved) == 0 {
+		return nil, fmt.Errorf("not under version control: %s", src)
+	}
+	for _, m := range moved {
+		if idx.HasEntry(m.To) {
+			return nil, fmt.Errorf("destination '%s' is already tracked", m.To)
+		}
+	}
+
+	if err := renamePath(srcPath, dstPath, caseOnly); err != nil {
+		return nil, fmt.Errorf("failed to rename %s to %s: %w", src, dst, err)
+	}
+
+	for _, m := range moved {
+		entry, _ := idx.GetEntry(m.From)
+		entry.Path = m.To
+	}
+	idx.Sort()
+
+	if err := idx.Save(indexPath); err != nil {
+		// Keep the worktree consistent with the unchanged index
+		renamePath(dstPath, srcPath, caseOnly)
+		return nil, fmt.Errorf("failed to save index: %w", err)
+	}
+
+	return &MoveResult{Source: src, Destination: dst, Moved: moved}, nil
+}
+
+// renamePath renames a file or directory. Case-only renames go through a
+// temporary name, since a case-insensitive filesystem may otherwise treat
+// the rename as a no-op.
+func renamePath(from, to string, caseOnly bool) error {
+	if !caseOnly {
+		return os.Rename(from, to)
+	}
+
+	tmp := from + ".mv-tmp"
+	if err := os.Rename(from, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, to); err != nil {
+		os.Rename(tmp, from)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+)
+
+// TestMove tests renaming files and directories in the worktree and index
+func TestMove(t *testing.T) {
+	repo, _ := setupUndoRepo(t, "one")
+
+	write := func(rel, content string) {
+		t.Helper()
+		full := filepath.Join(repo.Path, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(rel string) bool {
+		_, err := os.Lstat(filepath.Join(repo.Path, filepath.FromSlash(rel)))
+		return err == nil
+	}
+	indexPaths := func() []string {
+		idx, err := index.Load(filepath.Join(repo.GitDir, "index"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths := []string{}
+		for _, entry := range idx.Entries {
+			paths = append(paths, entry.Path)
+		}
+		return paths
+	}
+
+	for _, rel := range []string{"src/a.go", "src/sub/b.go", "README"} {
+		write(rel, rel+"\n")
+		if err := addFile(repo, rel); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := createCommit(repo, "Add files"); err != nil {
+		t.Fatal(err)
+	}
+	write("src/untracked.txt", "new\n")
+	if err := os.Mkdir(filepath.Join(repo.Path, "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A file
+	result, err := repo.Move("file.txt", "renamed.txt")
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if !reflect.DeepEqual(result.Moved, []MovedPath{{From: "file.txt", To: "renamed.txt"}}) {
+		t.Errorf("Unexpected moves %v", result.Moved)
+	}
+	if exists("file.txt") || !exists("renamed.txt") {
+		t.Error("file.txt was not renamed in the worktree")
+	}
+
+	// A directory into an existing directory, taking untracked files along
+	result, err = repo.Move("src", "lib")
+	if err != nil {
+		t.Fatalf("Move directory failed: %v", err)
+	}
+	if result.Destination != "lib/src" || len(result.Moved) != 2 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if !exists("lib/src/sub/b.go") || !exists("lib/src/untracked.txt") || exists("src") {
+		t.Error("src was not moved into lib")
+	}
+	expected := []string{"README", "lib/src/a.go", "lib/src/sub/b.go", "renamed.txt"}
+	if paths := indexPaths(); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Index paths = %v, expected %v", paths, expected)
+	}
+
+	// A rename that only changes case
+	if _, err := repo.Move("README", "readme"); err != nil {
+		t.Fatalf("Case-only move failed: %v", err)
+	}
+	if !exists("readme") {
+		t.Error("README was not renamed to readme")
+	}
+	expected = []string{"lib/src/a.go", "lib/src/sub/b.go", "readme", "renamed.txt"}
+	if paths := indexPaths(); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Index paths = %v, expected %v", paths, expected)
+	}
+
+	// Invalid moves leave everything in place
+	errorCases := []struct {
+		name     string
+		src, dst string
+	}{
+		{"untracked source", "lib/src/untracked.txt", "untracked.txt"},
+		{"missing source", "missing.txt", "other.txt"},
+		{"existing destination", "renamed.txt", "readme"},
+		{"into itself", "lib", "lib/src/inner"},
+		{"missing destination directory", "readme", "nowhere/readme"},
+	}
+	for _, tc := range errorCases {
+		if _, err := repo.Move(tc.src, tc.dst); err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+	if paths := indexPaths(); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Index changed by failed moves: %v", paths)
+	}
+}
@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// mergeTraversalWeight is the distance a step to a second or later
+// parent counts as, so first-parent names are preferred
+const mergeTraversalWeight = 65535
+
+// NameRevOptions contains options for NameRev
+type NameRevOptions struct {
+	// Tags only uses tags to name commits, which are then named without
+	// the "tags/" prefix
+	Tags bool
+	// Refs limits the refs used to those matching these patterns
+	Refs []string
+	// Exclude leaves out refs matching these patterns
+	Exclude []string
+}
+
+// DefaultNameRevOptions returns default name-rev options, which use all refs
+func DefaultNameRevOptions() NameRevOptions {
+	return NameRevOptions{
+		Tags:    false,
+		Refs:    nil,
+		Exclude: nil,
+	}
+}
+
+// revName is the best name found so far for a commit
+type revName struct {
+	tipName    string
+	taggerDate time.Time
+	generation int
+	distance   int
+	fromTag    bool
+}
+
+// String returns the name, such as "main~3" or "tags/v1.0^2~1"
+func (n *revName) String() string {
+	if n.generation == 0 {
+		return n.tipName
+	}
+	return fmt.Sprintf("%s~%d", strings.TrimSuffix(n.tipName, "^0"), n.generation)
+}
+
+// betterThan reports whether n should replace other. Like git name-rev,
+// tags beat branches, older tags beat newer ones, and shorter paths win
+// otherwise.
+func (n *revName) betterThan(other *revName) bool {
+	if other.fromTag && n.fromTag {
+		return other.taggerDate.After(n.taggerDate) ||
+			other.taggerDate.Equal(n.taggerDate) && other.distance > n.distance
+	}
+	if other.fromTag != n.fromTag {
+		return n.fromTag
+	}
+	if other.distance != n.distance {
+		return other.distance > n.distance
+	}
+	if !other.taggerDate.Equal(n.taggerDate) {
+		return other.taggerDate.After(n.taggerDate)
+	}
+	return other.generation > n.generation
+}
+
+// nameRevTip is a ref that names the commits it reaches
+type nameRevTip struct {
+	name       string
+	commit     hash.Hash
+	taggerDate time.Time
+	fromTag    bool
+	// deref marks an annotated tag, whose commit is named "tag^0"
+	deref bool
+}
+
+// NameRev names a commit relative to the refs that reach it, like git
+// name-rev, e.g. "main~3" or "tags/v1.0^2~1". It returns an empty string
+// when no ref reaches the commit.
+func (r *Repository) NameRev(h hash.Hash, opts NameRevOptions) (string, error) {
+	names, err := r.NameRevs([]hash.Hash{h}, opts)
+	if err != nil {
+		return "", err
+	}
+	return names[h.String()], nil
+}
+
+// NameRevs names several commits at once, walking the history only once.
+// The result maps each named commit's hash string to its name; commits no
+// ref reaches are left out.
+func (r *Repository) NameRevs(hashes []hash.Hash, opts NameRevOptions) (map[string]string, error) {
+	tips, err := r.nameRevTips(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]*revName)
+	commits := make(map[string]*object.Commit)
+	for _, tip := range tips {
+		if err := r.nameFromTip(tip, names, commits); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make(map[string]string)
+	for _, h := range hashes {
+		commitHash, _, err := r.peelToCommit(h)
+		if err != nil {
+			return nil, err
+		}
+		if name, ok := names[commitHash.String()]; ok {
+			result[h.String()] = name.String()
+		}
+	}
+	return result, nil
+}
+
+// nameRevTips returns the refs that name commits, tags first and then
+// oldest first
+func (r *Repository) nameRevTips(opts NameRevOptions) ([]nameRevTip, error) {
+	refs, err := r.ListRefs("refs/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs: %w", err)
+	}
+
+	tips := []nameRevTip{}
+	for _, ref := range refs {
+		fromTag := strings.HasPrefix(ref, "refs/tags/")
+		if opts.Tags && !fromTag || !matchRefPatterns(ref, opts.Refs) {
+			continue
+		}
+		if len(opts.Exclude) > 0 && matchRefPatterns(ref, opts.Exclude) {
+			continue
+		}
+
+		h, err := r.ResolveRef(ref)
+		if err != nil {
+			// Like Git, skip broken refs
+			continue
+		}
+		obj, err := r.ObjectDB.Get(h)
+		if err != nil {
+			continue
+		}
+		tag, deref := obj.(*object.Tag)
+		commitHash, commit, err := r.peelToCommit(h)
+		if err != nil {
+			// Refs to trees and blobs name nothing
+			continue
+		}
+
+		// With only tags in use the "tags/" prefix is left out, as git
+		// name-rev --tags --name-only does
+		name := strings.TrimPrefix(ref, "refs/")
+		name = strings.TrimPrefix(name, "heads/")
+		if opts.Tags {
+			name = strings.TrimPrefix(name, "tags/")
+		}
+		tip := nameRevTip{name: name, commit: commitHash, taggerDate: commit.Committer.When, fromTag: fromTag, deref: deref}
+		if deref {
+			tip.name += "^0"
+			tip.taggerDate = tag.Tagger.When
+		}
+		tips = append(tips, tip)
+	}
+
+	sort.SliceStable(tips, func(i, j int) bool {
+		if tips[i].fromTag != tips[j].fromTag {
+			return tips[i].fromTag
+		}
+		return tips[i].taggerDate.Before(tips[j].taggerDate)
+	})
+	return tips, nil
+}
+
+// nameFromTip names the commits reachable from a tip wherever the tip
+// gives a better name than the one already found
+func (r *Repository) nameFromTip(tip nameRevTip, names map[string]*revName, commits map[string]*object.Commit) error {
+	type pending struct {
+		hash hash.Hash
+		name *revName
+	}
+	stack := []pending{{
+		hash: tip.commit,
+		name: &revName{tipName: tip.name, taggerDate: tip.taggerDate, fromTag: tip.fromTag},
+	}}
+
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		key := current.hash.String()
+		if existing, ok := names[key]; ok && !current.name.betterThan(existing) {
+			continue
+		}
+		names[key] = current.name
+
+		commit, ok := commits[key]
+		if !ok {
+			_, c, err := r.peelToCommit(current.hash)
+			if err != nil {
+				return err
+			}
+			commit = c
+			commits[key] = c
+		}
+
+		// Pushed last to first so the first parent is walked first
+		for i := len(commit.Parents) - 1; i >= 0; i-- {
+			parent := &revName{
+				tipName:    current.name.tipName,
+				taggerDate: current.name.taggerDate,
+				generation: current.name.generation + 1,
+				distance:   current.name.distance + 1,
+				fromTag:    current.name.fromTag,
+			}
+			if i > 0 {
+				base := strings.TrimSuffix(current.name.tipName, "^0")
+				if current.name.generation > 0 {
+					base = fmt.Sprintf("%s~%d", base, current.name.generation)
+				}
+				parent.tipName = fmt.Sprintf("%s^%d", base, i+1)
+				parent.generation = 0
+				parent.distance = current.name.distance + mergeTraversalWeight
+			}
+			stack = append(stack, pending{hash: commit.Parents[i], name: parent})
+		}
+	}
+	return nil
+}
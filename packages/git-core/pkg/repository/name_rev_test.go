@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// TestNameRev tests naming commits through first parents, merges and tags
+func TestNameRev(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "c0\n", "c1\n")
+	_, root, err := repo.peelToCommit(commits[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitWithParents := func(message string, parents ...hash.Hash) hash.Hash {
+		t.Helper()
+		c := object.NewCommit()
+		c.Tree = root.Tree
+		c.Parents = parents
+		c.Author = root.Author
+		c.Committer = root.Committer
+		c.Message = message + "\n"
+		h, err := repo.ObjectDB.Put(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	// c0 - c1 - m1 - M - m2
+	//        \       /
+	//         s1 - s2
+	s1 := commitWithParents("s1", commits[1])
+	s2 := commitWithParents("s2", s1)
+	m1 := commitWithParents("m1", commits[1])
+	merge := commitWithParents("M", m1, s2)
+	m2 := commitWithParents("m2", merge)
+	if err := repo.UpdateRef("refs/heads/main", m2); err != nil {
+		t.Fatal(err)
+	}
+
+	type named struct {
+		hash hash.Hash
+		name string
+	}
+	expectNames := func(opts NameRevOptions, want []named) {
+		t.Helper()
+		for _, w := range want {
+			got, err := repo.NameRev(w.hash, opts)
+			if err != nil {
+				t.Fatalf("NameRev failed: %v", err)
+			}
+			if got != w.name {
+				t.Errorf("NameRev(%s) = %q, want %q", shortHash(w.hash), got, w.name)
+			}
+		}
+	}
+
+	expectNames(DefaultNameRevOptions(), []named{
+		{m2, "main"},
+		{merge, "main~1"},
+		{m1, "main~2"},
+		{s2, "main~1^2"},
+		{s1, "main~1^2~1"},
+		{commits[1], "main~3"},
+		{commits[0], "main~4"},
+	})
+
+	// Tags beat branches, and the older of two tags wins
+	if err := repo.UpdateRef("refs/tags/v1", commits[1]); err != nil {
+		t.Fatal(err)
+	}
+	tag := object.NewTag()
+	tag.Target = merge
+	tag.TargetType = object.CommitType
+	tag.Name = "ann"
+	tag.Tagger = object.Signature{Name: "Test", Email: "test@example.com", When: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)}
+	tag.Message = "Annotated\n"
+	tagHash, err := repo.ObjectDB.Put(tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateRef("refs/tags/ann", tagHash); err != nil {
+		t.Fatal(err)
+	}
+
+	expectNames(DefaultNameRevOptions(), []named{
+		{m2, "main"},
+		{merge, "tags/ann^0"},
+		{s2, "tags/ann^2"},
+		{s1, "tags/ann^2~1"},
+		{commits[1], "tags/ann~2"},
+	})
+	expectNames(NameRevOptions{Tags: true}, []named{
+		{m2, ""},
+		{merge, "ann^0"},
+		{s1, "ann^2~1"},
+	})
+	expectNames(NameRevOptions{Exclude: []string{"refs/tags/ann"}}, []named{
+		{merge, "main~1"},
+		{commits[0], "tags/v1~1"},
+	})
+	expectNames(NameRevOptions{Refs: []string{"refs/heads/*"}}, []named{
+		{commits[1], "main~3"},
+	})
+
+	// A tag object names the commit it points at
+	names, err := repo.NameRevs([]hash.Hash{tagHash, m2}, DefaultNameRevOptions())
+	if err != nil {
+		t.Fatalf("NameRevs failed: %v", err)
+	}
+	if names[tagHash.String()] != "tags/ann^0" || names[m2.String()] != "main" {
+		t.Errorf("Unexpected names %v", names)
+	}
+}
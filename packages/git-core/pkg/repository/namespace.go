@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SetNamespace switches the repository to the refs of a namespace, or back
+// to the top-level refs with "". A namespace keeps its refs, HEAD included,
+// below refs/namespaces/<namespace>/, so several logical repositories can
+// share one object store; a/b nests b inside a, as with GIT_NAMESPACE.
+func (r *Repository) SetNamespace(namespace string) error {
+	namespace = strings.Trim(namespace, "/")
+	if namespace != "" {
+		if err := checkRefName("refs/namespaces/" + namespace + "/HEAD"); err != nil {
+			return fmt.Errorf("invalid namespace %q: %w", namespace, err)
+		}
+	}
+	r.Namespace = namespace
+	return nil
+}
+
+// namespacePrefix returns where the namespace's refs are stored, such as
+// refs/namespaces/a/refs/namespaces/b/ for a/b, or "" without a namespace
+func (r *Repository) namespacePrefix() string {
+	if r.Namespace == "" {
+		return ""
+	}
+	var b strings.Builder
+	for _, part := range strings.Split(r.Namespace, "/") {
+		b.WriteString("refs/namespaces/" + part + "/")
+	}
+	return b.String()
+}
+
+// storedRefName returns the name a ref of the namespace is stored under
+func (r *Repository) storedRefName(name string) string {
+	return r.namespacePrefix() + name
+}
+
+// refPath returns the file a ref of the namespace is stored in
+func (r *Repository) refPath(name string) string {
+	return filepath.Join(r.GitDir, filepath.FromSlash(r.storedRefName(name)))
+}
+
+// readRef returns the content of a ref file, naming the target of a
+// symbolic ref as the namespace sees it. A namespace without a HEAD yet
+// is on an unborn branch, like a new repository.
+func (r *Repository) readRef(name string) ([]byte, error) {
+	content, err := os.ReadFile(r.refPath(name))
+	if err != nil {
+		if name == "HEAD" && r.Namespace != "" && os.IsNotExist(err) {
+			return []byte("ref: refs/heads/" + r.Config.GetInitialBranch() + "\n"), nil
+		}
+		return nil, err
+	}
+	if target, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "ref: "); ok {
+		if name, ok := strings.CutPrefix(target, r.namespacePrefix()); ok {
+			return []byte("ref: " + name + "\n"), nil
+		}
+	}
+	return content, nil
+}
+
+// withoutNamespace returns a view of the repository that sees every ref
+// under its stored name. Work on the shared object store, such as gc,
+// must see the refs of all namespaces.
+func (r *Repository) withoutNamespace() *Repository {
+	whole := *r
+	whole.Namespace = ""
+	return &whole
+}
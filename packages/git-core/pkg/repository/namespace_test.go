@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestNamespace tests that namespaces keep their refs apart while sharing
+// the object store
+func TestNamespace(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "one")
+
+	if err := repo.SetNamespace("site"); err != nil {
+		t.Fatalf("SetNamespace failed: %v", err)
+	}
+	if head, err := repo.HEAD(); err != nil || head != "ref: refs/heads/main" {
+		t.Errorf("HEAD of a new namespace = %q, %v, want an unborn main", head, err)
+	}
+	if _, err := repo.GetBranch("main"); err == nil {
+		t.Error("expected main not to exist in a new namespace")
+	}
+
+	site := commitTestTree(t, repo, "site", map[string]string{"index.html": "site"})
+	if err := repo.UpdateRef("refs/heads/main", site); err != nil {
+		t.Fatalf("UpdateRef failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repo.GitDir, "refs", "namespaces", "site", "refs", "heads", "main")); err != nil {
+		t.Errorf("namespaced ref was not stored below refs/namespaces: %v", err)
+	}
+	if h, err := repo.ResolveRevision("HEAD"); err != nil || !h.Equals(site) {
+		t.Errorf("HEAD in the namespace = %v, %v, want the site commit", h, err)
+	}
+	if refs, err := repo.ListRefs("refs/"); err != nil || len(refs) != 1 || refs[0] != "refs/heads/main" {
+		t.Errorf("ListRefs in the namespace = %v, %v", refs, err)
+	}
+
+	// Symbolic refs name their targets as the namespace sees them
+	if err := repo.SetSymbolicRef("HEAD", "refs/heads/dev"); err != nil {
+		t.Fatalf("SetSymbolicRef failed: %v", err)
+	}
+	if head, err := repo.HEAD(); err != nil || head != "ref: refs/heads/dev" {
+		t.Errorf("HEAD = %q, %v, want refs/heads/dev", head, err)
+	}
+	stored, err := os.ReadFile(filepath.Join(repo.GitDir, "refs", "namespaces", "site", "HEAD"))
+	if err != nil || string(stored) != "ref: refs/namespaces/site/refs/heads/dev\n" {
+		t.Errorf("stored HEAD = %q, %v", stored, err)
+	}
+
+	// Namespaces nest, and each only sees its own refs
+	if err := repo.SetNamespace("a/b"); err != nil {
+		t.Fatalf("SetNamespace failed: %v", err)
+	}
+	if err := repo.CreateBranch("main", commits[0]); err != nil {
+		t.Fatalf("CreateBranch failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repo.GitDir, "refs", "namespaces", "a", "refs", "namespaces", "b", "refs", "heads", "main")); err != nil {
+		t.Errorf("nested namespace ref was not stored: %v", err)
+	}
+	if h, err := repo.GetBranch("main"); err != nil || !h.Equals(commits[0]) {
+		t.Errorf("main in a/b = %v, %v", h, err)
+	}
+
+	if err := repo.SetNamespace(""); err != nil {
+		t.Fatal(err)
+	}
+	if h, err := repo.GetBranch("main"); err != nil || !h.Equals(commits[0]) {
+		t.Errorf("top-level main = %v, %v, want the first commit", h, err)
+	}
+	if h, err := repo.ResolveRef("refs/namespaces/site/refs/heads/main"); err != nil || !h.Equals(site) {
+		t.Errorf("namespaced ref seen from the top level = %v, %v", h, err)
+	}
+
+	if err := repo.SetNamespace("bad..name"); err == nil {
+		t.Error("expected an error for an invalid namespace")
+	}
+}
+
+// TestNamespaceGC tests that gc in one namespace keeps the objects of the
+// others
+func TestNamespaceGC(t *testing.T) {
+	repo, _ := setupUndoRepo(t, "one")
+	if err := repo.SetNamespace("site"); err != nil {
+		t.Fatal(err)
+	}
+	site := commitTestTree(t, repo, "site", map[string]string{"index.html": "site"})
+	if err := repo.UpdateRef("refs/heads/main", site); err != nil {
+		t.Fatal(err)
+	}
+	ageObject(t, repo, site, 30*24*time.Hour)
+
+	if err := repo.SetNamespace("other"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GC(DefaultGCOptions()); err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+	if !repo.ObjectDB.Has(site) {
+		t.Error("GC pruned a commit another namespace points to")
+	}
+	report, err := repo.Fsck(DefaultFsckOptions())
+	if err != nil {
+		t.Fatalf("Fsck failed: %v", err)
+	}
+	if len(report.Dangling) != 0 {
+		t.Errorf("Fsck reported the other namespace's commit as dangling: %v", report.Dangling)
+	}
+}
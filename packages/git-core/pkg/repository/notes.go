@@ -0,0 +1,254 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// DefaultNotesRef is the notes ref used when none is given, as in Git
+const DefaultNotesRef = "refs/notes/commits"
+
+// ErrNoNote is returned when an object has no note
+var ErrNoNote = errors.New("no note found")
+
+// NoteOptions configures AddNote
+type NoteOptions struct {
+	// Ref is the notes ref, a full ref or a name under refs/notes/.
+	// Defaults to refs/notes/commits.
+	Ref string
+	// Force replaces an existing note, like git notes add -f
+	Force bool
+	// Append adds to an existing note, like git notes append
+	Append bool
+}
+
+// DefaultNoteOptions returns default note options
+func DefaultNoteOptions() NoteOptions {
+	return NoteOptions{
+		Ref:    DefaultNotesRef,
+		Force:  false,
+		Append: false,
+	}
+}
+
+// Note is a note attached to an object
+type Note struct {
+	// Object is the annotated object, usually a commit
+	Object hash.Hash
+	// Blob holds the note's text
+	Blob hash.Hash
+}
+
+// AddNote attaches a note to the object named by rev, like git notes add.
+// Adding to an object that already has a note fails unless opts.Force or
+// opts.Append is set. Returns the new notes commit.
+func (r *Repository) AddNote(rev, message string, opts NoteOptions) (hash.Hash, error) {
+	ref := notesRef(opts.Ref)
+	target, err := r.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	notes, parent, err := r.loadNotes(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	content := strings.TrimRight(message, " \t\r\n") + "\n"
+	action := "add"
+	if existing, ok := notes[target.String()]; ok {
+		switch {
+		case opts.Append:
+			old, err := r.readBlobContent(existing)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read note: %w", err)
+			}
+			content = string(old) + "\n" + content
+			action = "append"
+		case !opts.Force:
+			return nil, fmt.Errorf("object %s already has a note in %s (use force to overwrite it)", shortHash(target), ref)
+		}
+	} else if opts.Append {
+		action = "append"
+	}
+
+	blob, err := r.ObjectDB.Put(object.NewBlobFromString(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to write note: %w", err)
+	}
+	notes[target.String()] = blob
+
+	return r.writeNotes(ref, notes, parent, fmt.Sprintf("Notes added by 'git notes %s'", action))
+}
+
+// ReadNote returns the text of the note attached to the object named by
+// rev, or ErrNoNote
+func (r *Repository) ReadNote(rev, ref string) (string, error) {
+	target, err := r.ResolveRevision(rev)
+	if err != nil {
+		return "", err
+	}
+
+	notes, _, err := r.loadNotes(notesRef(ref))
+	if err != nil {
+		return "", err
+	}
+	blob, ok := notes[target.String()]
+	if !ok {
+		return "", fmt.Errorf("%w for object %s", ErrNoNote, shortHash(target))
+	}
+
+	content, err := r.readBlobContent(blob)
+	if err != nil {
+		return "", fmt.Errorf("failed to read note: %w", err)
+	}
+	return string(content), nil
+}
+
+// RemoveNote removes the note attached to the object named by rev, like git
+// notes remove
+func (r *Repository) RemoveNote(rev, ref string) (hash.Hash, error) {
+	ref = notesRef(ref)
+	target, err := r.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	notes, parent, err := r.loadNotes(ref)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := notes[target.String()]; !ok {
+		return nil, fmt.Errorf("%w for object %s", ErrNoNote, shortHash(target))
+	}
+	delete(notes, target.String())
+
+	return r.writeNotes(ref, notes, parent, "Notes removed by 'git notes remove'")
+}
+
+// ListNotes returns the notes in a notes ref, ordered by annotated object
+func (r *Repository) ListNotes(ref string) ([]Note, error) {
+	notes, _, err := r.loadNotes(notesRef(ref))
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Note, 0, len(notes))
+	for name, blob := range notes {
+		h, err := hash.ParseHash(name)
+		if err != nil {
+			continue
+		}
+		list = append(list, Note{Object: h, Blob: blob})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Object.String() < list[j].Object.String()
+	})
+	return list, nil
+}
+
+// notesRef expands a notes ref name the way Git does
+func notesRef(ref string) string {
+	switch {
+	case ref == "":
+		return DefaultNotesRef
+	case strings.HasPrefix(ref, "refs/"):
+		return ref
+	default:
+		return "refs/notes/" + ref
+	}
+}
+
+// loadNotes reads a notes ref into a map from annotated object to note
+// blob, along with the notes commit. A missing ref has no notes.
+func (r *Repository) loadNotes(ref string) (map[string]hash.Hash, hash.Hash, error) {
+	notes := make(map[string]hash.Hash)
+
+	tip, err := r.ResolveRef(ref)
+	if err != nil {
+		return notes, nil, nil
+	}
+	tree, _, err := r.peelToTree(tip)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", ref, err)
+	}
+	if err := r.collectNotes(tree, "", notes); err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", ref, err)
+	}
+	return notes, tip, nil
+}
+
+// collectNotes walks a notes tree. Notes are named by the annotated
+// object's hash, which Git splits into fan-out directories such as
+// ab/cdef... once a notes tree grows large.
+func (r *Repository) collectNotes(tree *object.Tree, prefix string, notes map[string]hash.Hash) error {
+	hexSize := 2 * r.Hasher.Size()
+	for _, entry := range tree.Entries() {
+		name := prefix + entry.Name
+		if !isHexString(name) || len(name) > hexSize {
+			// Not part of a note's path
+			continue
+		}
+
+		if entry.Mode == object.ModeDir {
+			obj, err := r.ObjectDB.Get(entry.Hash)
+			if err != nil {
+				return fmt.Errorf("failed to load tree %s: %w", name, err)
+			}
+			subtree, ok := obj.(*object.Tree)
+			if !ok {
+				return fmt.Errorf("object %s is not a tree", shortHash(entry.Hash))
+			}
+			if err := r.collectNotes(subtree, name, notes); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if len(name) == hexSize {
+			notes[strings.ToLower(name)] = entry.Hash
+		}
+	}
+	return nil
+}
+
+// writeNotes writes the notes as a new notes commit on ref. The notes
+// tree is written flat, which Git reads at any size.
+func (r *Repository) writeNotes(ref string, notes map[string]hash.Hash, parent hash.Hash, message string) (hash.Hash, error) {
+	tree := object.NewTree()
+	for name, blob := range notes {
+		tree.AddEntryWithMode(object.ModeRegular, name, blob)
+	}
+	tree.Sort()
+
+	treeHash, err := r.ObjectDB.Put(tree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write notes tree: %w", err)
+	}
+
+	name, email := r.Config.GetUser()
+	commit := object.NewCommit()
+	commit.Tree = treeHash
+	if parent != nil {
+		commit.AddParent(parent)
+	}
+	commit.Author = object.Signature{Name: name, Email: email, When: time.Now()}
+	commit.Committer = commit.Author
+	commit.Message = message + "\n"
+
+	commitHash, err := r.ObjectDB.Put(commit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write notes commit: %w", err)
+	}
+
+	if err := r.UpdateRefWithLog(ref, commitHash, "notes: "+message); err != nil {
+		return nil, fmt.Errorf("failed to update %s: %w", ref, err)
+	}
+	return commitHash, nil
+}
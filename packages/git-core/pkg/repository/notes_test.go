@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// TestNotes tests adding, appending, reading and removing notes
+func TestNotes(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "a\n", "b\n")
+
+	if _, err := repo.ReadNote("HEAD", ""); !errors.Is(err, ErrNoNote) {
+		t.Fatalf("Expected ErrNoNote before any notes, got %v", err)
+	}
+
+	first, err := repo.AddNote("HEAD", "Reviewed-by: Alice", DefaultNoteOptions())
+	if err != nil {
+		t.Fatalf("AddNote failed: %v", err)
+	}
+	note, err := repo.ReadNote(commits[1].String(), "")
+	if err != nil {
+		t.Fatalf("ReadNote failed: %v", err)
+	}
+	if note != "Reviewed-by: Alice\n" {
+		t.Errorf("Expected the note text, got %q", note)
+	}
+
+	if _, err := repo.AddNote("HEAD", "again", DefaultNoteOptions()); err == nil {
+		t.Error("Expected an error adding a second note without force")
+	}
+
+	opts := DefaultNoteOptions()
+	opts.Append = true
+	second, err := repo.AddNote("HEAD", "Tested-by: Bob\n", opts)
+	if err != nil {
+		t.Fatalf("Appending failed: %v", err)
+	}
+	if note, _ := repo.ReadNote("HEAD", ""); note != "Reviewed-by: Alice\n\nTested-by: Bob\n" {
+		t.Errorf("Expected the appended note, got %q", note)
+	}
+
+	// Each change is a commit on the notes ref
+	commit, _, err := repo.GetCommit(second.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commit.Parents) != 1 || !commit.Parents[0].Equals(first) {
+		t.Error("Expected the notes commit to follow the previous one")
+	}
+	if commit.Message != "Notes added by 'git notes append'\n" {
+		t.Errorf("Unexpected notes commit message %q", commit.Message)
+	}
+
+	opts = DefaultNoteOptions()
+	opts.Force = true
+	if _, err := repo.AddNote("HEAD", "replaced", opts); err != nil {
+		t.Fatalf("Forced AddNote failed: %v", err)
+	}
+	if note, _ := repo.ReadNote("HEAD", ""); note != "replaced\n" {
+		t.Errorf("Expected the replaced note, got %q", note)
+	}
+
+	// Notes in another ref are separate
+	opts = DefaultNoteOptions()
+	opts.Ref = "review"
+	if _, err := repo.AddNote("HEAD~1", "lgtm", opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.ResolveRef("refs/notes/review"); err != nil {
+		t.Errorf("Expected refs/notes/review to exist: %v", err)
+	}
+	if _, err := repo.ReadNote("HEAD~1", ""); !errors.Is(err, ErrNoNote) {
+		t.Error("Expected no note for HEAD~1 in the default notes ref")
+	}
+
+	list, err := repo.ListNotes("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || !list[0].Object.Equals(commits[1]) {
+		t.Errorf("Expected one note on HEAD, got %v", list)
+	}
+
+	if _, err := repo.RemoveNote("HEAD", ""); err != nil {
+		t.Fatalf("RemoveNote failed: %v", err)
+	}
+	if _, err := repo.ReadNote("HEAD", ""); !errors.Is(err, ErrNoNote) {
+		t.Errorf("Expected the note to be removed, got %v", err)
+	}
+	if _, err := repo.RemoveNote("HEAD", ""); !errors.Is(err, ErrNoNote) {
+		t.Errorf("Expected ErrNoNote removing a missing note, got %v", err)
+	}
+}
+
+// TestNotesFanout tests reading a notes tree split into fan-out directories
+func TestNotesFanout(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "a\n")
+
+	name := commits[0].String()
+	blob, err := repo.ObjectDB.Put(object.NewBlobFromString("fanned out\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subtree := object.NewTree()
+	subtree.AddEntryWithMode(object.ModeRegular, name[2:], blob)
+	subtreeHash, err := repo.ObjectDB.Put(subtree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := object.NewTree()
+	tree.AddEntryWithMode(object.ModeDir, name[:2], subtreeHash)
+	treeHash, err := repo.ObjectDB.Put(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := object.NewCommit()
+	commit.Tree = treeHash
+	commit.Message = "Notes added by 'git notes add'\n"
+	commitHash, err := repo.ObjectDB.Put(commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateRef(DefaultNotesRef, commitHash); err != nil {
+		t.Fatal(err)
+	}
+
+	note, err := repo.ReadNote("HEAD", "")
+	if err != nil {
+		t.Fatalf("ReadNote failed: %v", err)
+	}
+	if note != "fanned out\n" {
+		t.Errorf("Expected the fanned-out note, got %q", note)
+	}
+}
+
+// TestLogNotes tests that log entries carry their notes
+func TestLogNotes(t *testing.T) {
+	repo, _ := setupUndoRepo(t, "a\n", "b\n")
+
+	if _, err := repo.AddNote("HEAD", "Reviewed-by: Alice", DefaultNoteOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := repo.Log("", DefaultLogOptions())
+	if err != nil {
+		t.Fatalf("Log failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Notes != "Reviewed-by: Alice\n" || entries[1].Notes != "" {
+		t.Errorf("Expected a note on HEAD only, got %q and %q", entries[0].Notes, entries[1].Notes)
+	}
+	if out := FormatLogEntry(entries[0], LogFormatFull); !strings.Contains(out, "\nNotes:\n    Reviewed-by: Alice\n") {
+		t.Errorf("Expected notes in the full format, got:\n%s", out)
+	}
+
+	opts := DefaultLogOptions()
+	opts.NotesRef = ""
+	entries, err = repo.Log("", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries[0].Notes != "" {
+		t.Error("Expected no notes without a notes ref")
+	}
+}
@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+)
+
+// Operation identifies a multi-step operation that is in progress
+type Operation string
+
+const (
+	// OperationNone means no operation is in progress
+	OperationNone Operation = ""
+	// OperationMerge is a merge stopped for conflict resolution
+	OperationMerge Operation = "merge"
+	// OperationRebase is an interactive or merge-based rebase
+	OperationRebase Operation = "rebase"
+	// OperationApplyMailbox is a patch series being applied with am
+	OperationApplyMailbox Operation = "am"
+	// OperationCherryPick is a cherry-pick of one or more commits
+	OperationCherryPick Operation = "cherry-pick"
+	// OperationRevert is a revert of one or more commits
+	OperationRevert Operation = "revert"
+	// OperationBisect is a bisect session
+	OperationBisect Operation = "bisect"
+)
+
+// Continuation is an action that resumes or ends an operation
+type Continuation string
+
+const (
+	// ContinuationContinue resumes the operation after conflicts are resolved
+	ContinuationContinue Continuation = "continue"
+	// ContinuationSkip drops the current step and moves on
+	ContinuationSkip Continuation = "skip"
+	// ContinuationAbort cancels the operation and restores the original state
+	ContinuationAbort Continuation = "abort"
+)
+
+// OperationState describes the multi-step operation in progress, using
+// the same state files as Git so it can be inspected after a reload
+type OperationState struct {
+	// Operation is the operation in progress (OperationNone if idle)
+	Operation Operation
+	// Step is the 1-based step being applied (0 if unknown)
+	Step int
+	// Total is the number of steps (0 if unknown)
+	Total int
+	// Remaining is the number of steps left after the current one
+	Remaining int
+	// Head is the commit being merged or applied, if known
+	Head hash.Hash
+	// Branch is the branch being rebased, if any
+	Branch string
+	// Conflicts lists paths that still have unresolved conflicts
+	Conflicts []string
+	// Continuations are the actions currently available
+	Continuations []Continuation
+}
+
+// InProgress reports whether any operation is in progress
+func (s *OperationState) InProgress() bool {
+	return s.Operation != OperationNone
+}
+
+// OperationState reports which multi-step operation is in progress
+func (r *Repository) OperationState() (*OperationState, error) {
+	state := &OperationState{
+		Conflicts:     []string{},
+		Continuations: []Continuation{},
+	}
+
+	switch {
+	case dirExistsIn(r.GitDir, "rebase-merge"):
+		state.Operation = OperationRebase
+		state.Step = r.readStateInt("rebase-merge/msgnum")
+		state.Total = r.readStateInt("rebase-merge/end")
+		state.Branch = strings.TrimPrefix(r.readStateLine("rebase-merge/head-name"), "refs/heads/")
+		state.Head = r.readStateHash("REBASE_HEAD")
+
+	case dirExistsIn(r.GitDir, "rebase-apply"):
+		state.Operation = OperationRebase
+		if _, err := os.Stat(filepath.Join(r.GitDir, "rebase-apply", "applying")); err == nil {
+			state.Operation = OperationApplyMailbox
+		}
+		state.Step = r.readStateInt("rebase-apply/next")
+		state.Total = r.readStateInt("rebase-apply/last")
+		state.Branch = strings.TrimPrefix(r.readStateLine("rebase-apply/head-name"), "refs/heads/")
+		state.Head = r.readStateHash("REBASE_HEAD")
+
+	case r.readStateHash("MERGE_HEAD") != nil:
+		state.Operation = OperationMerge
+		state.Head = r.readStateHash("MERGE_HEAD")
+
+	case r.readStateHash("CHERRY_PICK_HEAD") != nil:
+		state.Operation = OperationCherryPick
+		state.Head = r.readStateHash("CHERRY_PICK_HEAD")
+
+	case r.readStateHash("REVERT_HEAD") != nil:
+		state.Operation = OperationRevert
+		state.Head = r.readStateHash("REVERT_HEAD")
+
+	case fileExistsIn(r.GitDir, "BISECT_START"):
+		state.Operation = OperationBisect
+		state.Continuations = []Continuation{ContinuationSkip, ContinuationAbort}
+		return state, nil
+
+	default:
+		return state, nil
+	}
+
+	if state.Total > 0 && state.Step > 0 {
+		state.Remaining = state.Total - state.Step
+	}
+
+	// Multi-commit cherry-picks and reverts keep a todo list whose first
+	// entry is the commit currently being applied
+	if state.Operation == OperationCherryPick || state.Operation == OperationRevert {
+		if todo := r.readSequencerTodo(); len(todo) > 0 {
+			state.Remaining = len(todo) - 1
+		}
+	}
+
+	conflicts, err := r.unresolvedConflicts()
+	if err != nil {
+		return nil, err
+	}
+	state.Conflicts = conflicts
+
+	if len(conflicts) == 0 {
+		state.Continuations = append(state.Continuations, ContinuationContinue)
+	}
+	if state.Operation != OperationMerge {
+		state.Continuations = append(state.Continuations, ContinuationSkip)
+	}
+	state.Continuations = append(state.Continuations, ContinuationAbort)
+
+	return state, nil
+}
+
+// unresolvedConflicts returns paths recorded as conflicted by a merge or
+// left at a conflict stage in the index
+func (r *Repository) unresolvedConflicts() ([]string, error) {
+	paths := make(map[string]bool)
+
+	if data, err := os.ReadFile(filepath.Join(r.GitDir, "MERGE_CONFLICTS")); err == nil {
+		for _, line := range splitLines(data) {
+			if line != "" {
+				paths[line] = true
+			}
+		}
+	}
+
+	indexPath := filepath.Join(r.GitDir, "index")
+	if _, err := os.Stat(indexPath); err == nil {
+		idx, err := index.Load(indexPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range idx.Entries {
+			if entry.StageFlag > 0 {
+				paths[entry.Path] = true
+			}
+		}
+	}
+
+	conflicts := make([]string, 0, len(paths))
+	for path := range paths {
+		conflicts = append(conflicts, path)
+	}
+	sort.Strings(conflicts)
+
+	return conflicts, nil
+}
+
+// readSequencerTodo returns the pending cherry-pick or revert commands
+func (r *Repository) readSequencerTodo() []string {
+	data, err := os.ReadFile(filepath.Join(r.GitDir, "sequencer", "todo"))
+	if err != nil {
+		return nil
+	}
+
+	todo := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			todo = append(todo, line)
+		}
+	}
+	return todo
+}
+
+// readStateLine returns the first line of a state file relative to GitDir
+func (r *Repository) readStateLine(name string) string {
+	data, err := os.ReadFile(filepath.Join(r.GitDir, filepath.FromSlash(name)))
+	if err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	return strings.TrimSpace(line)
+}
+
+// readStateInt returns a state file holding a number, or 0
+func (r *Repository) readStateInt(name string) int {
+	n, err := strconv.Atoi(r.readStateLine(name))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// readStateHash returns a state file holding a commit hash, or nil
+func (r *Repository) readStateHash(name string) hash.Hash {
+	// FETCH_HEAD lines go on with a description of the ref
+	line, _, _ := strings.Cut(r.readStateLine(name), "\t")
+	h, err := hash.ParseHash(line)
+	if err != nil {
+		return nil
+	}
+	return h
+}
+
+// dirExistsIn reports whether a directory exists below base
+func dirExistsIn(base, name string) bool {
+	info, err := os.Stat(filepath.Join(base, name))
+	return err == nil && info.IsDir()
+}
+
+// fileExistsIn reports whether a regular file exists below base
+func fileExistsIn(base, name string) bool {
+	info, err := os.Stat(filepath.Join(base, name))
+	return err == nil && !info.IsDir()
+}
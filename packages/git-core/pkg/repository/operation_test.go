@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeStateFile writes a state file relative to GitDir
+func writeStateFile(t *testing.T, repo *Repository, name, content string) {
+	t.Helper()
+
+	path := filepath.Join(repo.GitDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestOperationStateIdle tests a repository with no operation in progress
+func TestOperationStateIdle(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	state, err := repo.OperationState()
+	if err != nil {
+		t.Fatalf("OperationState failed: %v", err)
+	}
+	if state.InProgress() || len(state.Continuations) != 0 {
+		t.Errorf("Expected idle state, got %+v", state)
+	}
+}
+
+// TestOperationState tests detection of each operation from its state files
+func TestOperationState(t *testing.T) {
+	const commit = "3b18e512dba79e4c8300dd08aeb37f8e728b8dad"
+
+	tests := []struct {
+		name          string
+		files         map[string]string
+		operation     Operation
+		step, total   int
+		remaining     int
+		branch        string
+		conflicts     []string
+		continuations []Continuation
+	}{
+		{
+			name:          "merge with conflicts",
+			files:         map[string]string{"MERGE_HEAD": commit + "\n", "MERGE_CONFLICTS": "b.txt\na.txt\n"},
+			operation:     OperationMerge,
+			conflicts:     []string{"a.txt", "b.txt"},
+			continuations: []Continuation{ContinuationAbort},
+		},
+		{
+			name:          "resolved merge",
+			files:         map[string]string{"MERGE_HEAD": commit + "\n"},
+			operation:     OperationMerge,
+			conflicts:     []string{},
+			continuations: []Continuation{ContinuationContinue, ContinuationAbort},
+		},
+		{
+			name: "rebase",
+			files: map[string]string{
+				"rebase-merge/msgnum":    "2\n",
+				"rebase-merge/end":       "5\n",
+				"rebase-merge/head-name": "refs/heads/feature\n",
+				"REBASE_HEAD":            commit + "\n",
+			},
+			operation:     OperationRebase,
+			step:          2,
+			total:         5,
+			remaining:     3,
+			branch:        "feature",
+			conflicts:     []string{},
+			continuations: []Continuation{ContinuationContinue, ContinuationSkip, ContinuationAbort},
+		},
+		{
+			name: "am",
+			files: map[string]string{
+				"rebase-apply/next":     "1\n",
+				"rebase-apply/last":     "3\n",
+				"rebase-apply/applying": "",
+			},
+			operation:     OperationApplyMailbox,
+			step:          1,
+			total:         3,
+			remaining:     2,
+			conflicts:     []string{},
+			continuations: []Continuation{ContinuationContinue, ContinuationSkip, ContinuationAbort},
+		},
+		{
+			name: "cherry-pick sequence",
+			files: map[string]string{
+				"CHERRY_PICK_HEAD": commit + "\n",
+				"sequencer/todo":   "pick " + commit + " one\npick " + commit + " two\n# comment\n",
+				"MERGE_CONFLICTS":  "file.txt\n",
+			},
+			operation:     OperationCherryPick,
+			remaining:     1,
+			conflicts:     []string{"file.txt"},
+			continuations: []Continuation{ContinuationSkip, ContinuationAbort},
+		},
+		{
+			name:          "revert",
+			files:         map[string]string{"REVERT_HEAD": commit + "\n"},
+			operation:     OperationRevert,
+			conflicts:     []string{},
+			continuations: []Continuation{ContinuationContinue, ContinuationSkip, ContinuationAbort},
+		},
+		{
+			name:          "bisect",
+			files:         map[string]string{"BISECT_START": "main\n"},
+			operation:     OperationBisect,
+			conflicts:     []string{},
+			continuations: []Continuation{ContinuationSkip, ContinuationAbort},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+			if err != nil {
+				t.Fatalf("Failed to create repository: %v", err)
+			}
+			for name, content := range tt.files {
+				writeStateFile(t, repo, name, content)
+			}
+
+			state, err := repo.OperationState()
+			if err != nil {
+				t.Fatalf("OperationState failed: %v", err)
+			}
+
+			if state.Operation != tt.operation || !state.InProgress() {
+				t.Errorf("Operation = %q, want %q", state.Operation, tt.operation)
+			}
+			if state.Step != tt.step || state.Total != tt.total || state.Remaining != tt.remaining {
+				t.Errorf("Progress = %d/%d (%d left), want %d/%d (%d left)",
+					state.Step, state.Total, state.Remaining, tt.step, tt.total, tt.remaining)
+			}
+			if state.Branch != tt.branch {
+				t.Errorf("Branch = %q, want %q", state.Branch, tt.branch)
+			}
+			if !reflect.DeepEqual(state.Conflicts, tt.conflicts) {
+				t.Errorf("Conflicts = %v, want %v", state.Conflicts, tt.conflicts)
+			}
+			if !reflect.DeepEqual(state.Continuations, tt.continuations) {
+				t.Errorf("Continuations = %v, want %v", state.Continuations, tt.continuations)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+const (
+	// packWindow is how many of the objects sorted before one are tried
+	// as its delta base, git's pack.window default
+	packWindow = 10
+	// packDepth is the longest chain of deltas on deltas, git's
+	// pack.depth default
+	packDepth = 50
+)
+
+// packEntry is an object to write to a pack
+type packEntry struct {
+	hash    hash.Hash
+	objType uint8
+	data    []byte
+	// path is where the tree or blob was reached, which suggests
+	// similar objects to delta against
+	path string
+	// preferred entries are objects the receiver already has: they are
+	// only delta bases, and are not written, which makes the pack thin
+	preferred bool
+	// base is the entry this one is stored as a delta of, with the
+	// encoded delta and the length of the chain it ends
+	base  *packEntry
+	delta []byte
+	depth int
+}
+
+// newPackEntry serializes an object for a pack
+func newPackEntry(h hash.Hash, obj object.Object, path string) (*packEntry, error) {
+	objType, err := packObjectType(obj)
+	if err != nil {
+		return nil, err
+	}
+	var data bytes.Buffer
+	if err := obj.Serialize(&data); err != nil {
+		return nil, fmt.Errorf("failed to serialize object: %w", err)
+	}
+	return &packEntry{hash: h, objType: objType, data: data.Bytes(), path: path}, nil
+}
+
+// deltifyPackEntries chooses delta bases for the trees and blobs among
+// entries, as git pack-objects does: the entries are sorted so similar
+// objects, of the same type and file name, sit next to each other with
+// preferred entries and then larger ones first, and each is compared with
+// the packWindow entries before it, keeping the smallest delta that saves
+// enough. Preferred entries take part only as bases.
+func deltifyPackEntries(entries []*packEntry) error {
+	sorted := make([]*packEntry, 0, len(entries))
+	for _, entry := range entries {
+		// REF_DELTA names bases with 20-byte hashes only
+		if (entry.objType == protocol.ObjTree || entry.objType == protocol.ObjBlob) && len(entry.hash) == 20 {
+			sorted = append(sorted, entry)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.objType != b.objType {
+			return a.objType < b.objType
+		}
+		if nameA, nameB := path.Base(a.path), path.Base(b.path); nameA != nameB {
+			return nameA < nameB
+		}
+		if a.preferred != b.preferred {
+			return a.preferred
+		}
+		return len(a.data) > len(b.data)
+	})
+
+	for i, target := range sorted {
+		if target.preferred {
+			continue
+		}
+		for j := i - 1; j >= 0 && j >= i-packWindow; j-- {
+			base := sorted[j]
+			if base.objType != target.objType || base.depth >= packDepth || base.hash.Equals(target.hash) {
+				continue
+			}
+			// A much smaller base cannot make a useful delta
+			if len(base.data) < len(target.data)/32 {
+				continue
+			}
+
+			// Deeper chains are slower to read, so they must save more
+			maxSize := (len(target.data)/2 - 20) * (packDepth - base.depth) / packDepth
+			if target.delta != nil {
+				maxSize = len(target.delta) - 1
+			}
+			if maxSize <= 0 {
+				continue
+			}
+
+			delta, err := protocol.CreateAndEncodeDelta(base.data, target.data)
+			if err != nil {
+				return fmt.Errorf("failed to create delta: %w", err)
+			}
+			if len(delta) <= maxSize {
+				target.base = base
+				target.delta = delta
+				target.depth = base.depth + 1
+			}
+		}
+	}
+	return nil
+}
+
+// writePackEntries writes the entries that are not preferred as a
+// packfile: whole objects first, then deltas in order of depth, so every
+// base in the pack comes before its deltas. The pack's checksum is of the
+// given object format.
+func writePackEntries(entries []*packEntry, hasher hash.Hasher) ([]byte, error) {
+	objects := make([]protocol.PackfileObject, 0, len(entries))
+	deltas := []*packEntry{}
+	for _, entry := range entries {
+		if entry.preferred {
+			continue
+		}
+		if entry.base != nil {
+			deltas = append(deltas, entry)
+			continue
+		}
+		objects = append(objects, protocol.PackfileObject{
+			Type: entry.objType,
+			Size: uint64(len(entry.data)),
+			Data: entry.data,
+		})
+	}
+
+	sort.SliceStable(deltas, func(i, j int) bool { return deltas[i].depth < deltas[j].depth })
+	for _, entry := range deltas {
+		objects = append(objects, protocol.PackfileObject{
+			Type:     protocol.ObjRefDelta,
+			Size:     uint64(len(entry.delta)),
+			Data:     entry.delta,
+			BaseHash: entry.base.hash.Bytes(),
+			IsDelta:  true,
+		})
+	}
+
+	var buf bytes.Buffer
+	writer := protocol.NewPackfileWriter(&buf)
+	writer.SetHasher(hasher)
+	if err := writer.WritePackfile(objects); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// packRevList packs the commits and objects of a rev-list as deltas where
+// that is smaller. When thin is set, the trees and blobs at the same paths
+// in the commits the list stops at, which the receiver has, are delta
+// bases too without being sent.
+func (r *Repository) packRevList(list *RevListResult, thin bool) ([]byte, error) {
+	objects := r.unreplacedObjects()
+	entries := make([]*packEntry, 0, len(list.Commits)+len(list.Objects))
+	sent := make(map[string]bool)
+	add := func(h hash.Hash, path string) error {
+		obj, err := objects.Get(h)
+		if err != nil {
+			return fmt.Errorf("failed to load object %s: %w", h.String(), err)
+		}
+		entry, err := newPackEntry(h, obj, path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		sent[h.String()] = true
+		return nil
+	}
+	for _, h := range list.Commits {
+		if err := add(h, ""); err != nil {
+			return nil, err
+		}
+	}
+	for _, o := range list.Objects {
+		if err := add(o.Hash, o.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	if thin {
+		bases, err := r.thinPackBases(list, sent)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, bases...)
+	}
+
+	if err := deltifyPackEntries(entries); err != nil {
+		return nil, err
+	}
+	return writePackEntries(entries, r.Hasher)
+}
+
+// thinPackBases returns, as preferred entries, the trees and blobs found
+// at the paths of the listed objects in the trees of the boundary commits:
+// the parents of listed commits that are not listed themselves
+func (r *Repository) thinPackBases(list *RevListResult, sent map[string]bool) ([]*packEntry, error) {
+	objects := r.unreplacedObjects()
+	boundary := []hash.Hash{}
+	seen := make(map[string]bool)
+	for _, h := range list.Commits {
+		obj, err := objects.Get(h)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load commit %s: %w", h.String(), err)
+		}
+		commit, ok := obj.(*object.Commit)
+		if !ok {
+			continue
+		}
+		for _, parent := range commit.Parents {
+			if !sent[parent.String()] && !seen[parent.String()] && objects.Has(parent) {
+				seen[parent.String()] = true
+				boundary = append(boundary, parent)
+			}
+		}
+	}
+
+	bases := []*packEntry{}
+	for _, parent := range boundary {
+		obj, err := objects.Get(parent)
+		if err != nil {
+			continue
+		}
+		commit, ok := obj.(*object.Commit)
+		if !ok {
+			continue
+		}
+		for _, o := range list.Objects {
+			if o.Type == object.TagType {
+				continue
+			}
+			entry, err := r.pathEntry(commit.Tree, o.Path)
+			if err != nil || entry == nil || entry.Mode == object.ModeGitlink {
+				continue
+			}
+			key := entry.Hash.String()
+			if sent[key] || seen[key] || !objects.Has(entry.Hash) {
+				continue
+			}
+			seen[key] = true
+
+			baseObj, err := objects.Get(entry.Hash)
+			if err != nil {
+				continue
+			}
+			base, err := newPackEntry(entry.Hash, baseObj, o.Path)
+			if err != nil {
+				continue
+			}
+			base.preferred = true
+			bases = append(bases, base)
+		}
+	}
+	return bases, nil
+}
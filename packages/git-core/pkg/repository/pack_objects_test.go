@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+// largeTestFile returns a file of numbered lines
+func largeTestFile(lines int) string {
+	var b strings.Builder
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&b, "line %d of the file\n", i)
+	}
+	return b.String()
+}
+
+// readTestPack parses a packfile written for a test
+func readTestPack(t *testing.T, data []byte) *protocol.Packfile {
+	t.Helper()
+	pack, err := protocol.NewPackfileReader(bytes.NewReader(data)).ReadPackfile()
+	if err != nil {
+		t.Fatalf("Failed to read packfile: %v", err)
+	}
+	return pack
+}
+
+// TestCreatePackfileForPushDeltas tests that similar objects are stored
+// as deltas of each other and unpack to the same objects
+func TestCreatePackfileForPushDeltas(t *testing.T) {
+	repo, _ := setupUndoRepo(t)
+
+	content := largeTestFile(500)
+	objects := []object.Object{
+		object.NewBlob([]byte(content)),
+		object.NewBlob([]byte(content + "one more line\n")),
+		object.NewBlob([]byte("something else entirely\n")),
+	}
+	hashes := []hash.Hash{}
+	for _, obj := range objects {
+		h, err := repo.ObjectDB.Put(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, h)
+	}
+
+	data, err := repo.createPackfileForPush(objects)
+	if err != nil {
+		t.Fatalf("createPackfileForPush failed: %v", err)
+	}
+	if len(data) > len(content) {
+		t.Errorf("pack is %d bytes for a %d byte file and a copy", len(data), len(content))
+	}
+	deltas := 0
+	for _, obj := range readTestPack(t, data).Objects {
+		if obj.IsDelta {
+			deltas++
+		}
+	}
+	if deltas != 1 {
+		t.Errorf("Expected one delta, got %d", deltas)
+	}
+
+	clone, _ := setupUndoRepo(t)
+	if err := unpackPackfile(clone, data); err != nil {
+		t.Fatalf("unpackPackfile failed: %v", err)
+	}
+	for _, h := range hashes {
+		if !clone.ObjectDB.Has(h) {
+			t.Errorf("Object %s did not survive the round trip", h)
+		}
+	}
+}
+
+// TestPackRevListThin tests that a thin pack deltas changed files against
+// the versions the receiver has, without sending them
+func TestPackRevListThin(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	content := largeTestFile(500)
+	first := commitTestTree(t, repo, "first", map[string]string{"dir/big.txt": content})
+	second := commitTestTree(t, repo, "second", map[string]string{"dir/big.txt": content + "appended\n"}, first)
+	oldBlob := hash.HashBlob(repo.Hasher, []byte(content))
+
+	list, err := repo.RevList(RevListOptions{Include: []hash.Hash{second}, Exclude: []hash.Hash{first}, Objects: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := repo.packRevList(list, true)
+	if err != nil {
+		t.Fatalf("packRevList failed: %v", err)
+	}
+	pack := readTestPack(t, data)
+	if len(pack.Objects) != len(list.Commits)+len(list.Objects) {
+		t.Fatalf("Expected %d objects, got %d", len(list.Commits)+len(list.Objects), len(pack.Objects))
+	}
+	thinDeltas := 0
+	for _, obj := range pack.Objects {
+		if obj.IsDelta && bytes.Equal(obj.BaseHash, oldBlob.Bytes()) {
+			thinDeltas++
+		}
+	}
+	if thinDeltas != 1 || len(data) > len(content)/2 {
+		t.Errorf("Expected the file as a delta of the old version, got %d such deltas in %d bytes", thinDeltas, len(data))
+	}
+
+	// A receiver with the first commit completes the pack
+	receiver, err := Create(filepath.Join(t.TempDir(), "receiver"), DefaultInitOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := repo.RevList(RevListOptions{Include: []hash.Hash{first}, Objects: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseObjects, err := repo.loadRevList(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range baseObjects {
+		if _, err := receiver.ObjectDB.Put(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := unpackPackfile(receiver, data); err != nil {
+		t.Fatalf("unpackPackfile failed: %v", err)
+	}
+	newContent := []byte(content + "appended\n")
+	obj, err := receiver.ObjectDB.Get(hash.HashBlob(repo.Hasher, newContent))
+	if err != nil {
+		t.Fatalf("The new version was not stored: %v", err)
+	}
+	if blob, ok := obj.(*object.Blob); !ok || !bytes.Equal(blob.Content(), newContent) {
+		t.Errorf("Unexpected new version %#v", obj)
+	}
+
+	// Without thin packs every base is in the pack
+	data, err = repo.packRevList(list, false)
+	if err != nil {
+		t.Fatalf("packRevList failed: %v", err)
+	}
+	for _, obj := range readTestPack(t, data).Objects {
+		if obj.IsDelta {
+			t.Errorf("Unexpected delta in a pack without bases")
+		}
+	}
+}
+
+// TestCheckPack tests that a pack is checked before it is stored or sent,
+// its objects resolving against the repository's for a thin pack
+func TestCheckPack(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	content := largeTestFile(500)
+	first := commitTestTree(t, repo, "first", map[string]string{"dir/big.txt": content})
+	second := commitTestTree(t, repo, "second", map[string]string{"dir/big.txt": content + "appended\n"}, first)
+	list, err := repo.RevList(RevListOptions{Include: []hash.Hash{second}, Exclude: []hash.Hash{first}, Objects: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := repo.packRevList(list, true)
+	if err != nil {
+		t.Fatalf("packRevList failed: %v", err)
+	}
+
+	packed, err := repo.checkPack(data, true)
+	if err != nil {
+		t.Fatalf("checkPack failed: %v", err)
+	}
+	if err := checkPackedObjects(list, packed); err != nil {
+		t.Errorf("checkPackedObjects failed: %v", err)
+	}
+	if err := checkPackedObjects(&RevListResult{Commits: []hash.Hash{first}}, packed); !errors.Is(err, protocol.ErrCorruptPack) {
+		t.Errorf("Expected an object missing from the pack, got %v", err)
+	}
+
+	// The thin pack's bases are not in an empty repository
+	receiver, err := Create(filepath.Join(t.TempDir(), "receiver"), DefaultInitOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := receiver.checkPack(data, true); err == nil {
+		t.Error("Expected the thin pack's objects not to resolve")
+	}
+
+	// A corrupt pack stores nothing
+	corrupt := append([]byte{}, data...)
+	corrupt[len(corrupt)/2] ^= 0xff
+	if err := unpackPackfile(receiver, corrupt); !errors.Is(err, protocol.ErrCorruptPack) {
+		t.Fatalf("Expected a corrupt pack error, got %v", err)
+	}
+	if stored, _ := receiver.ObjectDB.List(); len(stored) != 0 {
+		t.Errorf("Expected nothing stored from a corrupt pack, got %d objects", len(stored))
+	}
+}
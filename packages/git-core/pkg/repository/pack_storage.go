@@ -0,0 +1,480 @@
+package repository
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+// deltaBaseCacheSize bounds the bytes of resolved delta bases PackStorage
+// keeps, like git's core.deltaBaseCacheLimit but sized for a browser tab
+const deltaBaseCacheSize = 16 << 20
+
+// PackStorage is object storage that reads the packs in a pack directory
+// as well as the loose objects of the storage it wraps. Objects are found
+// through the packs' .idx files, inflated at their offsets, and delta
+// chains are resolved with a small cache of recent bases. Writes and
+// deletes only touch loose objects, since packs are only replaced whole.
+type PackStorage struct {
+	object.Storage
+	packDir string
+	hasher  hash.Hasher
+	limits  protocol.Limits
+
+	mu      sync.Mutex
+	packs   []*packFile
+	loaded  time.Time // modification time of packDir when packs were loaded
+	indexes []string  // the .idx files in packDir when packs were loaded
+	cache   *deltaBaseCache
+}
+
+// packFile is an open pack and its index
+type packFile struct {
+	path  string
+	index *protocol.PackIndex
+	file  *os.File
+	size  int64
+}
+
+// NewPackStorage creates storage reading the packs in packDir and the
+// loose objects in loose
+func NewPackStorage(loose object.Storage, packDir string, hasher hash.Hasher) *PackStorage {
+	return &PackStorage{
+		Storage: loose,
+		packDir: packDir,
+		hasher:  hasher,
+		// Local packs are trusted, but a corrupt one must not loop forever
+		limits: protocol.Limits{MaxDeltaDepth: protocol.DefaultLimits().MaxDeltaDepth},
+		cache:  newDeltaBaseCache(deltaBaseCacheSize),
+	}
+}
+
+// newPackStorage creates storage for the repository's loose and packed
+// objects
+func (r *Repository) newPackStorage() *PackStorage {
+	return NewPackStorage(newFileStorage(r.ObjectsPath(), r.Hasher), filepath.Join(r.ObjectsPath(), "pack"), r.Hasher)
+}
+
+// Read reads compressed object data, from a loose object if there is one
+// and otherwise from a pack
+func (s *PackStorage) Read(h hash.Hash) ([]byte, error) {
+	data, err := s.Storage.Read(h)
+	if err == nil {
+		return data, nil
+	}
+
+	s.mu.Lock()
+	objType, content, found, packErr := s.readPacked(h)
+	s.mu.Unlock()
+	if packErr != nil {
+		return nil, packErr
+	}
+	if !found {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %d\x00", protocol.ObjectTypeName(objType), len(content))
+	buf.Write(content)
+	return object.Compress(buf.Bytes())
+}
+
+// ReadRaw reads an object's type and content, from a loose object if
+// there is one and otherwise from a pack. Unlike Read, it does not
+// compress packed objects again.
+func (s *PackStorage) ReadRaw(h hash.Hash) (object.Type, []byte, error) {
+	compressed, err := s.Storage.Read(h)
+	if err == nil {
+		header, content, err := decodeLoose(compressed)
+		if err != nil {
+			return "", nil, err
+		}
+		return header.Type, content, nil
+	}
+
+	s.mu.Lock()
+	packType, content, found, packErr := s.readPacked(h)
+	s.mu.Unlock()
+	if packErr != nil {
+		return "", nil, packErr
+	}
+	if !found {
+		return "", nil, err
+	}
+
+	objType, err := object.ParseType(protocol.ObjectTypeName(packType))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read object %s: %w", h.String(), err)
+	}
+	return objType, content, nil
+}
+
+// Has checks if an object exists loose or in a pack
+func (s *PackStorage) Has(h hash.Hash) bool {
+	if s.Storage.Has(h) {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, _, found := s.find(h)
+	return found
+}
+
+// List returns the hashes of loose and packed objects
+func (s *PackStorage) List() ([]hash.Hash, error) {
+	hashes, err := s.Storage.List()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(hashes))
+	for _, h := range hashes {
+		seen[string(h)] = true
+	}
+	for _, pack := range s.packs {
+		for _, entry := range pack.index.Entries {
+			if !seen[string(entry.Hash)] {
+				seen[string(entry.Hash)] = true
+				hashes = append(hashes, hash.NewHash(entry.Hash))
+			}
+		}
+	}
+	return hashes, nil
+}
+
+// countPacked returns the number of objects in the packs, counting an
+// object once for each pack holding it, like git count-objects
+func (s *PackStorage) countPacked() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, pack := range s.packs {
+		count += len(pack.index.Entries)
+	}
+	return count, nil
+}
+
+// Close closes the packs and the loose storage
+func (s *PackStorage) Close() error {
+	s.mu.Lock()
+	s.closePacks()
+	s.mu.Unlock()
+	return s.Storage.Close()
+}
+
+// refresh loads the packs again when the pack directory has changed
+func (s *PackStorage) refresh() error {
+	info, err := os.Stat(s.packDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.closePacks()
+			return nil
+		}
+		return fmt.Errorf("failed to read pack directory: %w", err)
+	}
+
+	// A pack written within the directory's timestamp granularity leaves
+	// its modification time alone, so the indexes are compared as well
+	indexes, err := filepath.Glob(filepath.Join(s.packDir, "pack-*.idx"))
+	if err != nil {
+		return fmt.Errorf("failed to list pack indexes: %w", err)
+	}
+	if s.packs != nil && info.ModTime().Equal(s.loaded) && equalStrings(indexes, s.indexes) {
+		return nil
+	}
+
+	s.closePacks()
+	s.packs = []*packFile{}
+	for _, idxPath := range indexes {
+		pack, err := openPackFile(idxPath, s.hasher)
+		if err != nil {
+			// A pack still being written has no usable index yet
+			continue
+		}
+		s.packs = append(s.packs, pack)
+	}
+	s.loaded = info.ModTime()
+	s.indexes = indexes
+	return nil
+}
+
+// equalStrings reports whether two sorted lists hold the same strings
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// closePacks closes the open packs and forgets their cached bases
+func (s *PackStorage) closePacks() {
+	for _, pack := range s.packs {
+		pack.file.Close()
+	}
+	s.packs = nil
+	s.cache = newDeltaBaseCache(deltaBaseCacheSize)
+}
+
+// openPackFile opens the pack of an .idx file
+func openPackFile(idxPath string, hasher hash.Hasher) (*packFile, error) {
+	data, err := os.ReadFile(idxPath)
+	if err != nil {
+		return nil, err
+	}
+	index, err := protocol.ReadPackIndex(data, hasher)
+	if err != nil {
+		return nil, err
+	}
+
+	path := strings.TrimSuffix(idxPath, ".idx") + ".pack"
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &packFile{path: path, index: index, file: file, size: info.Size()}, nil
+}
+
+// find returns the pack and offset an object is stored at, loading the
+// packs again if they changed
+func (s *PackStorage) find(h hash.Hash) (*packFile, uint64, bool) {
+	if err := s.refresh(); err != nil {
+		return nil, 0, false
+	}
+	return s.findLoaded(h)
+}
+
+// findLoaded is find among the packs already loaded
+func (s *PackStorage) findLoaded(h hash.Hash) (*packFile, uint64, bool) {
+	for _, pack := range s.packs {
+		if offset, ok := pack.index.Find(h); ok {
+			return pack, offset, true
+		}
+	}
+	return nil, 0, false
+}
+
+// readPacked reads a packed object's type and content, reporting whether
+// it is in a pack
+func (s *PackStorage) readPacked(h hash.Hash) (uint8, []byte, bool, error) {
+	pack, offset, found := s.find(h)
+	if !found {
+		return 0, nil, false, nil
+	}
+	objType, data, err := s.unpack(pack, offset)
+	if err != nil {
+		return 0, nil, true, fmt.Errorf("failed to read object %s from %s: %w", h.String(), filepath.Base(pack.path), err)
+	}
+	return objType, data, true, nil
+}
+
+// packedDelta is a delta met walking down a chain, and where it is stored
+type packedDelta struct {
+	pack   *packFile
+	offset uint64
+	data   []byte
+}
+
+// unpack reads the object at an offset in a pack. Deltas are followed
+// down to a whole object or a cached base, then applied upwards, caching
+// each intermediate object since its siblings are likely read next.
+func (s *PackStorage) unpack(pack *packFile, offset uint64) (uint8, []byte, error) {
+	chain := []packedDelta{}
+	var objType uint8
+	var data []byte
+	for {
+		if cached, ok := s.cache.get(pack, offset); ok {
+			objType, data = cached.objType, cached.data
+			break
+		}
+		if max := s.limits.MaxDeltaDepth; max > 0 && len(chain) > max {
+			return 0, nil, &protocol.LimitError{Limit: "delta chain depth", Value: uint64(len(chain)), Max: uint64(max)}
+		}
+
+		obj, err := pack.readObject(offset, s.limits)
+		if err != nil {
+			return 0, nil, err
+		}
+		if !obj.IsDelta {
+			objType, data = obj.Type, obj.Data
+			if len(chain) > 0 {
+				s.cache.add(pack, offset, objType, data)
+			}
+			break
+		}
+		chain = append(chain, packedDelta{pack: pack, offset: offset, data: obj.Data})
+
+		if obj.Type == protocol.ObjOfsDelta {
+			if obj.Offset < 0 || uint64(obj.Offset) >= offset {
+				return 0, nil, fmt.Errorf("invalid delta base offset %d for object at %d", obj.Offset, offset)
+			}
+			offset = uint64(obj.Offset)
+			continue
+		}
+
+		// A REF_DELTA base may be in another pack, or loose
+		base := hash.NewHash(obj.BaseHash)
+		if baseOffset, ok := pack.index.Find(base); ok {
+			offset = baseOffset
+			continue
+		}
+		if basePack, baseOffset, ok := s.findLoaded(base); ok {
+			pack, offset = basePack, baseOffset
+			continue
+		}
+		objType, data, err = s.readLoose(base)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to read delta base %s: %w", base.String(), err)
+		}
+		break
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		delta, err := protocol.ParseDelta(chain[i].data)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to parse delta: %w", err)
+		}
+		data, err = protocol.ApplyDeltaWithLimits(data, delta, s.limits)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to apply delta: %w", err)
+		}
+		if i > 0 {
+			s.cache.add(chain[i].pack, chain[i].offset, objType, data)
+		}
+	}
+	return objType, data, nil
+}
+
+// readLoose reads the type and content of a loose object
+func (s *PackStorage) readLoose(h hash.Hash) (uint8, []byte, error) {
+	compressed, err := s.Storage.Read(h)
+	if err != nil {
+		return 0, nil, err
+	}
+	header, content, err := decodeLoose(compressed)
+	if err != nil {
+		return 0, nil, err
+	}
+	switch header.Type {
+	case object.CommitType:
+		return protocol.ObjCommit, content, nil
+	case object.TreeType:
+		return protocol.ObjTree, content, nil
+	case object.BlobType:
+		return protocol.ObjBlob, content, nil
+	case object.TagType:
+		return protocol.ObjTag, content, nil
+	}
+	return 0, nil, fmt.Errorf("unsupported object type: %s", header.Type)
+}
+
+// decodeLoose decompresses a loose object and splits it into its header
+// and content
+func decodeLoose(compressed []byte) (object.ObjectHeader, []byte, error) {
+	data, err := object.Decompress(compressed)
+	if err != nil {
+		return object.ObjectHeader{}, nil, err
+	}
+	header, start, err := object.ParseObjectHeader(data)
+	if err != nil {
+		return object.ObjectHeader{}, nil, err
+	}
+	return header, data[start:], nil
+}
+
+// readObject inflates the object stored at an offset in the pack
+func (p *packFile) readObject(offset uint64, limits protocol.Limits) (*protocol.PackfileObject, error) {
+	if offset >= uint64(p.size) {
+		return nil, fmt.Errorf("offset %d is past the end of the pack", offset)
+	}
+	section := io.NewSectionReader(p.file, int64(offset), p.size-int64(offset))
+	reader := protocol.NewPackfileReaderAt(section, int64(offset))
+	reader.SetLimits(limits)
+	return reader.ReadObject()
+}
+
+// deltaBaseCache keeps recently resolved delta bases up to a total size,
+// dropping the least recently used first
+type deltaBaseCache struct {
+	max     int
+	size    int
+	order   *list.List
+	entries map[deltaBaseKey]*list.Element
+}
+
+// deltaBaseKey is where a cached base is stored
+type deltaBaseKey struct {
+	pack   *packFile
+	offset uint64
+}
+
+// deltaBase is a cached base
+type deltaBase struct {
+	key     deltaBaseKey
+	objType uint8
+	data    []byte
+}
+
+// newDeltaBaseCache creates a cache holding up to max bytes
+func newDeltaBaseCache(max int) *deltaBaseCache {
+	return &deltaBaseCache{
+		max:     max,
+		order:   list.New(),
+		entries: make(map[deltaBaseKey]*list.Element),
+	}
+}
+
+// get returns a cached base, marking it recently used
+func (c *deltaBaseCache) get(pack *packFile, offset uint64) (*deltaBase, bool) {
+	element, ok := c.entries[deltaBaseKey{pack, offset}]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*deltaBase), true
+}
+
+// add caches a base, evicting older ones to make room. Bases larger than
+// the whole cache are not kept.
+func (c *deltaBaseCache) add(pack *packFile, offset uint64, objType uint8, data []byte) {
+	key := deltaBaseKey{pack, offset}
+	if _, ok := c.entries[key]; ok || len(data) > c.max {
+		return
+	}
+	for c.size+len(data) > c.max {
+		oldest := c.order.Back()
+		base := c.order.Remove(oldest).(*deltaBase)
+		delete(c.entries, base.key)
+		c.size -= len(base.data)
+	}
+	c.entries[key] = c.order.PushFront(&deltaBase{key: key, objType: objType, data: data})
+	c.size += len(data)
+}
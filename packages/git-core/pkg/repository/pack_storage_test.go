@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+// writeTestPack stores a pack and its index in the repository
+func writeTestPack(t *testing.T, repo *Repository, pack []byte) {
+	t.Helper()
+	name := "pack-" + hex.EncodeToString(pack[len(pack)-protocol.PackfileChecksumSize:]) + ".pack"
+	packPath := filepath.ToSlash(filepath.Join("objects", "pack", name))
+	if err := WriteFileInRepo(repo.GitDir, packPath, pack, 0444); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.IndexPack(packPath); err != nil {
+		t.Fatalf("IndexPack failed: %v", err)
+	}
+}
+
+// TestPackStorage tests that objects only stored in packs are read through
+// their index, whole or as deltas of either kind
+func TestPackStorage(t *testing.T) {
+	repo, _ := setupUndoRepo(t)
+
+	// The first version is whole, the second a ref delta of it and the
+	// third an offset delta of the second
+	v1 := []byte(largeTestFile(300))
+	v2 := append(append([]byte{}, v1...), "one more line\n"...)
+	v3 := append([]byte("a new first line\n"), v2...)
+	toV2, err := protocol.CreateAndEncodeDelta(v1, v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	toV3, err := protocol.CreateAndEncodeDelta(v2, v3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second version starts after the header and the first one, so
+	// write the pack once without it to learn where that is
+	objects := []protocol.PackfileObject{
+		{Type: protocol.ObjBlob, Size: uint64(len(v1)), Data: v1},
+	}
+	var buf bytes.Buffer
+	if err := protocol.NewPackfileWriter(&buf).WritePackfile(objects); err != nil {
+		t.Fatal(err)
+	}
+	v2Offset := int64(buf.Len() - protocol.PackfileChecksumSize)
+	objects = append(objects,
+		protocol.PackfileObject{Type: protocol.ObjRefDelta, Size: uint64(len(toV2)), Data: toV2, BaseHash: hash.HashBlob(repo.Hasher, v1).Bytes(), IsDelta: true},
+		protocol.PackfileObject{Type: protocol.ObjOfsDelta, Size: uint64(len(toV3)), Data: toV3, Offset: v2Offset, IsDelta: true},
+	)
+	buf.Reset()
+	if err := protocol.NewPackfileWriter(&buf).WritePackfile(objects); err != nil {
+		t.Fatal(err)
+	}
+	writeTestPack(t, repo, buf.Bytes())
+
+	for _, content := range [][]byte{v1, v2, v3, v2} {
+		h := hash.HashBlob(repo.Hasher, content)
+		if !repo.ObjectDB.Has(h) {
+			t.Fatalf("Packed object %s is missing", h)
+		}
+		obj, err := repo.ObjectDB.Get(h)
+		if err != nil {
+			t.Fatalf("Failed to read packed object: %v", err)
+		}
+		if blob, ok := obj.(*object.Blob); !ok || !bytes.Equal(blob.Content(), content) {
+			t.Errorf("Unexpected packed object %#v", obj)
+		}
+	}
+
+	hashes, err := repo.ObjectDB.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hash.ContainsHash(hashes, hash.HashBlob(repo.Hasher, v3)) {
+		t.Error("Expected packed objects to be listed")
+	}
+	if repo.ObjectDB.Has(hash.HashBlob(repo.Hasher, []byte("not stored"))) {
+		t.Error("Found an object that is neither loose nor packed")
+	}
+}
+
+// TestPackStorageNewPackSameModTime tests that a pack added without
+// changing the pack directory's modification time is still found, and
+// that packed objects are read without going through Read
+func TestPackStorageNewPackSameModTime(t *testing.T) {
+	repo, _ := setupUndoRepo(t)
+	packDir := filepath.Join(repo.ObjectsPath(), "pack")
+
+	writeBlobPack := func(content []byte) hash.Hash {
+		var buf bytes.Buffer
+		err := protocol.NewPackfileWriter(&buf).WritePackfile([]protocol.PackfileObject{
+			{Type: protocol.ObjBlob, Size: uint64(len(content)), Data: content},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeTestPack(t, repo, buf.Bytes())
+		return hash.HashBlob(repo.Hasher, content)
+	}
+
+	first := writeBlobPack([]byte("first packed blob\n"))
+	if !repo.ObjectDB.Has(first) {
+		t.Fatal("Expected the first packed blob to be found")
+	}
+	info, err := os.Stat(packDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second := writeBlobPack([]byte("second packed blob\n"))
+	if err := os.Chtimes(packDir, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if !repo.ObjectDB.Has(second) {
+		t.Fatal("Expected a pack added within the same modification time to be found")
+	}
+
+	storage := repo.newPackStorage()
+	defer storage.Close()
+	objType, content, err := storage.ReadRaw(second)
+	if err != nil {
+		t.Fatalf("ReadRaw failed: %v", err)
+	}
+	if objType != object.BlobType || string(content) != "second packed blob\n" {
+		t.Errorf("ReadRaw = %s %q", objType, content)
+	}
+	header, err := object.GetHeader(repo.ObjectDB, second)
+	if err != nil {
+		t.Fatalf("GetHeader failed: %v", err)
+	}
+	if header.Type != object.BlobType || header.Size != int64(len(content)) {
+		t.Errorf("GetHeader = %+v", header)
+	}
+}
+
+// TestPackStorageAfterRepack tests that history survives losing its loose
+// objects once GC has packed them
+func TestPackStorageAfterRepack(t *testing.T) {
+	repo, _ := setupUndoRepo(t, "one", "two")
+
+	opts := DefaultGCOptions()
+	opts.Repack = true
+	if _, err := repo.GC(opts); err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+
+	loose, err := newFileStorage(repo.ObjectsPath(), repo.Hasher).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range loose {
+		if err := os.Remove(objectFilePath(repo, h)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reopened, err := Open(repo.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err := reopened.Log("HEAD", DefaultLogOptions())
+	if err != nil {
+		t.Fatalf("Failed to walk packed history: %v", err)
+	}
+	if len(log) != 2 {
+		t.Errorf("Expected 2 commits, got %d", len(log))
+	}
+}
+
+// TestVerifyPack tests that a pack GC wrote verifies against its index,
+// and that a damaged one does not
+func TestVerifyPack(t *testing.T) {
+	repo, _ := setupUndoRepo(t, "one", "two")
+	opts := DefaultGCOptions()
+	opts.Repack = true
+	if _, err := repo.GC(opts); err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+	packs, err := filepath.Glob(filepath.Join(repo.GitDir, "objects", "pack", "*.pack"))
+	if err != nil || len(packs) != 1 {
+		t.Fatalf("Expected one pack, got %v, %v", packs, err)
+	}
+	packPath := filepath.ToSlash(filepath.Join("objects", "pack", filepath.Base(packs[0])))
+	if err := repo.VerifyPack(packPath); err != nil {
+		t.Fatalf("VerifyPack failed: %v", err)
+	}
+
+	data, err := os.ReadFile(packs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xff
+	if err := os.Chmod(packs[0], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(packs[0], data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var corruptErr *protocol.CorruptPackError
+	if err := repo.VerifyPack(packPath); !errors.As(err, &corruptErr) {
+		t.Errorf("Expected a corrupt pack error, got %v", err)
+	}
+}
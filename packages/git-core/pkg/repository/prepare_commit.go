@@ -0,0 +1,564 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// ChangeType describes how a file differs between two versions
+type ChangeType string
+
+const (
+	// ChangeAdded is a file that did not exist before
+	ChangeAdded ChangeType = "added"
+	// ChangeModified is a file whose content or mode changed
+	ChangeModified ChangeType = "modified"
+	// ChangeDeleted is a file that no longer exists
+	ChangeDeleted ChangeType = "deleted"
+	// ChangeRenamed is a file that moved to a new path, possibly with
+	// changes
+	ChangeRenamed ChangeType = "renamed"
+	// ChangeCopied is a new file copied from one that still exists,
+	// possibly with changes
+	ChangeCopied ChangeType = "copied"
+)
+
+// scissorsLine marks the start of text that commit message cleanup drops
+const scissorsLine = "# ------------------------ >8 ------------------------"
+
+// PrepareCommitOptions contains options for PrepareCommit
+type PrepareCommitOptions struct {
+	// Verbose appends the diffstat below a scissors line in the template,
+	// like git commit -v
+	Verbose bool
+	// IncludeUntracked lists untracked files in the template
+	IncludeUntracked bool
+}
+
+// DefaultPrepareCommitOptions returns default prepare commit options
+func DefaultPrepareCommitOptions() PrepareCommitOptions {
+	return PrepareCommitOptions{
+		Verbose:          false,
+		IncludeUntracked: true,
+	}
+}
+
+// CommitFileChange describes one file staged for the next commit
+type CommitFileChange struct {
+	Path       string
+	Change     ChangeType
+	OldHash    hash.Hash // Blob in HEAD (nil if added)
+	NewHash    hash.Hash // Blob in the index (nil if deleted)
+	OldMode    object.FileMode
+	NewMode    object.FileMode
+	Insertions int
+	Deletions  int
+	Binary     bool
+	OldSize    int
+	NewSize    int
+}
+
+// CommitPreparation describes the commit that would be created from the
+// current index, with the context git shows in its commit message editor
+type CommitPreparation struct {
+	// Branch is the branch the commit would be made on ("" if detached)
+	Branch string
+	// Head is the current HEAD commit (nil before the first commit)
+	Head hash.Hash
+	// Parents are the would-be commit's parents, including MERGE_HEAD
+	Parents []hash.Hash
+	// Merging reports whether a merge is being concluded
+	Merging bool
+	// Files are the staged changes, sorted by path
+	Files []CommitFileChange
+	// Insertions and Deletions are the diffstat totals
+	Insertions int
+	Deletions  int
+	// Conflicts are the paths that conflicted in the merge being concluded
+	Conflicts []string
+	// Unmerged are the paths that still have unresolved conflicts
+	Unmerged []string
+	// NotStaged are tracked files changed in the work tree but not staged
+	NotStaged []CommitFileChange
+	// Untracked are files not known to the index
+	Untracked []string
+	// Template is the generated commit message template
+	Template string
+}
+
+// PrepareCommit describes the commit that would be created from the index
+// without creating it: the staged files with their diffstat, the merge
+// conflicts being resolved, and a commit message template
+func (r *Repository) PrepareCommit(opts PrepareCommitOptions) (*CommitPreparation, error) {
+	prep := &CommitPreparation{
+		Parents:   []hash.Hash{},
+		Files:     []CommitFileChange{},
+		Conflicts: []string{},
+		NotStaged: []CommitFileChange{},
+		Untracked: []string{},
+	}
+
+	if branch, err := r.CurrentBranch(); err == nil {
+		prep.Branch = branch
+	}
+
+	var headCommit *object.Commit
+	headFiles := make(map[string]struct {
+		hash hash.Hash
+		mode object.FileMode
+	})
+	if head, err := r.ResolveHEAD(); err == nil {
+		_, commit, err := r.peelToCommit(head)
+		if err != nil {
+			return nil, err
+		}
+		tree, _, err := r.peelToTree(head)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.collectTreeFiles(tree, "", headFiles); err != nil {
+			return nil, err
+		}
+		headCommit = commit
+		prep.Head = head
+		prep.Parents = append(prep.Parents, head)
+	}
+
+	if mergeHead := r.readStateHash("MERGE_HEAD"); mergeHead != nil {
+		prep.Merging = true
+		prep.Parents = append(prep.Parents, mergeHead)
+	}
+
+	idx, err := index.Load(filepath.Join(r.GitDir, "index"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	indexEntries := make(map[string]*index.Entry)
+	for _, entry := range idx.Entries {
+		indexEntries[entry.Path] = entry
+	}
+
+	statusOpts := index.DefaultStatusOptions()
+	statusOpts.IncludeUntracked = opts.IncludeUntracked
+	statusOpts.Sparse, err = r.SparseCheckout()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sparse-checkout: %w", err)
+	}
+	status, err := index.GetStatus(r.WorkTree(), idx, headCommit, r.ObjectDB, statusOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status: %w", err)
+	}
+
+	for _, entry := range status.Entries {
+		old, inHead := headFiles[entry.Path]
+		staged := indexEntries[entry.Path]
+
+		switch entry.IndexStatus {
+		case index.StatusAdded, index.StatusStaged, index.StatusDeleted:
+			change := CommitFileChange{Path: entry.Path}
+			if inHead {
+				change.OldHash = old.hash
+				change.OldMode = old.mode
+			}
+			if staged != nil {
+				change.NewHash = staged.Hash
+				change.NewMode = object.FileMode(staged.Mode)
+			}
+			switch {
+			case !inHead:
+				change.Change = ChangeAdded
+			case staged == nil:
+				change.Change = ChangeDeleted
+			default:
+				change.Change = ChangeModified
+			}
+			if err := r.countFileChange(&change); err != nil {
+				return nil, err
+			}
+			prep.Files = append(prep.Files, change)
+			prep.Insertions += change.Insertions
+			prep.Deletions += change.Deletions
+
+		case index.StatusUntracked:
+			prep.Untracked = append(prep.Untracked, entry.Path)
+			continue
+		}
+
+		if staged != nil && (entry.WorkStatus == index.StatusModified || entry.WorkStatus == index.StatusDeleted) {
+			change := CommitFileChange{Path: entry.Path, Change: ChangeModified}
+			if entry.WorkStatus == index.StatusDeleted {
+				change.Change = ChangeDeleted
+			}
+			prep.NotStaged = append(prep.NotStaged, change)
+		}
+	}
+
+	sort.Slice(prep.Files, func(i, j int) bool { return prep.Files[i].Path < prep.Files[j].Path })
+	sort.Slice(prep.NotStaged, func(i, j int) bool { return prep.NotStaged[i].Path < prep.NotStaged[j].Path })
+	sort.Strings(prep.Untracked)
+
+	message := ""
+	if prep.Merging {
+		message, prep.Conflicts = r.readMergeMessage()
+	}
+	prep.Unmerged, err = r.unresolvedConflicts()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range prep.Unmerged {
+		if !containsString(prep.Conflicts, path) {
+			prep.Conflicts = append(prep.Conflicts, path)
+		}
+	}
+	sort.Strings(prep.Conflicts)
+
+	prep.Template = prep.buildTemplate(message, opts)
+	return prep, nil
+}
+
+// countFileChange fills in the line counts of a staged change
+func (r *Repository) countFileChange(change *CommitFileChange) error {
+	var oldContent, newContent []byte
+	if change.OldHash != nil {
+		content, err := r.readBlobContent(change.OldHash)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", change.Path, err)
+		}
+		oldContent = content
+	}
+	if change.NewHash != nil {
+		content, err := r.readBlobContent(change.NewHash)
+		if err != nil {
+			// Blobs are written at commit time from the work tree, so the
+			// work tree holds the content that would be committed
+			content, err = os.ReadFile(filepath.Join(r.WorkTree(), change.Path))
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", change.Path, err)
+			}
+		}
+		newContent = content
+	}
+
+	change.OldSize = len(oldContent)
+	change.NewSize = len(newContent)
+	if isBinaryContent(oldContent) || isBinaryContent(newContent) {
+		change.Binary = true
+		return nil
+	}
+
+	change.Insertions, change.Deletions = countLineChanges(oldContent, newContent)
+	return nil
+}
+
+// readBlobContent returns the content of a blob
+func (r *Repository) readBlobContent(h hash.Hash) ([]byte, error) {
+	obj, err := r.ObjectDB.Get(h)
+	if err != nil {
+		return nil, err
+	}
+	blob, ok := obj.(*object.Blob)
+	if !ok {
+		return nil, fmt.Errorf("object %s is not a blob", shortHash(h))
+	}
+	return blob.Content(), nil
+}
+
+// readMergeMessage returns the message a merge left in MERGE_MSG, without
+// its trailing conflicts list, and the paths in that list
+func (r *Repository) readMergeMessage() (string, []string) {
+	data, err := os.ReadFile(filepath.Join(r.GitDir, "MERGE_MSG"))
+	if err != nil {
+		return "", []string{}
+	}
+
+	message := []string{}
+	conflicts := []string{}
+	inConflicts := false
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimPrefix(line, "# ")
+		if trimmed == "Conflicts:" {
+			inConflicts = true
+			continue
+		}
+		if inConflicts {
+			path := strings.TrimSpace(strings.TrimPrefix(line, "#"))
+			if path != "" {
+				conflicts = append(conflicts, path)
+			}
+			continue
+		}
+		message = append(message, line)
+	}
+
+	return strings.TrimSpace(strings.Join(message, "\n")), conflicts
+}
+
+// buildTemplate generates the commit message template git opens in the
+// editor: the prepared message followed by commented-out status
+func (p *CommitPreparation) buildTemplate(message string, opts PrepareCommitOptions) string {
+	var b strings.Builder
+
+	if message != "" {
+		b.WriteString(message + "\n")
+	}
+	b.WriteString("\n")
+
+	if len(p.Conflicts) > 0 {
+		b.WriteString("# Conflicts:\n")
+		for _, path := range p.Conflicts {
+			b.WriteString("#\t" + path + "\n")
+		}
+		b.WriteString("#\n")
+	}
+
+	b.WriteString("# Please enter the commit message for your changes. Lines starting\n")
+	b.WriteString("# with '#' will be ignored, and an empty message aborts the commit.\n")
+	b.WriteString("#\n")
+
+	if p.Branch != "" {
+		b.WriteString("# On branch " + p.Branch + "\n")
+	} else if p.Head != nil {
+		b.WriteString("# HEAD detached at " + shortHash(p.Head) + "\n")
+	}
+	if p.Merging {
+		if len(p.Unmerged) > 0 {
+			b.WriteString("# You have unmerged paths.\n")
+		} else {
+			b.WriteString("# All conflicts fixed but you are still merging.\n")
+		}
+	}
+	b.WriteString("#\n")
+	if p.Head == nil {
+		b.WriteString("# Initial commit\n#\n")
+	}
+
+	if len(p.Files) > 0 {
+		b.WriteString("# Changes to be committed:\n")
+		for _, file := range p.Files {
+			b.WriteString("#\t" + changeLabel(file.Change) + file.Path + "\n")
+		}
+		b.WriteString("#\n")
+	}
+
+	if len(p.Unmerged) > 0 {
+		b.WriteString("# Unmerged paths:\n")
+		for _, path := range p.Unmerged {
+			b.WriteString("#\tboth modified:   " + path + "\n")
+		}
+		b.WriteString("#\n")
+	}
+
+	if len(p.NotStaged) > 0 {
+		b.WriteString("# Changes not staged for commit:\n")
+		for _, file := range p.NotStaged {
+			b.WriteString("#\t" + changeLabel(file.Change) + file.Path + "\n")
+		}
+		b.WriteString("#\n")
+	}
+
+	if len(p.Untracked) > 0 {
+		b.WriteString("# Untracked files:\n")
+		for _, path := range p.Untracked {
+			b.WriteString("#\t" + path + "\n")
+		}
+		b.WriteString("#\n")
+	}
+
+	if opts.Verbose {
+		b.WriteString(scissorsLine + "\n")
+		b.WriteString("# Do not modify or remove the line above.\n")
+		b.WriteString("# Everything below it will be ignored.\n")
+		b.WriteString(p.DiffStat())
+	}
+
+	return b.String()
+}
+
+// changeLabel returns the status label git uses in commit templates
+func changeLabel(change ChangeType) string {
+	switch change {
+	case ChangeAdded:
+		return "new file:   "
+	case ChangeDeleted:
+		return "deleted:    "
+	default:
+		return "modified:   "
+	}
+}
+
+// DiffStat formats the staged changes like git diff --stat
+func (p *CommitPreparation) DiffStat() string {
+	if len(p.Files) == 0 {
+		return ""
+	}
+
+	nameWidth := 0
+	maxChanges := 0
+	for _, file := range p.Files {
+		if len(file.Path) > nameWidth {
+			nameWidth = len(file.Path)
+		}
+		if n := file.Insertions + file.Deletions; n > maxChanges {
+			maxChanges = n
+		}
+	}
+	countWidth := len(fmt.Sprint(maxChanges))
+
+	// Scale the +/- graph down when the largest change would not fit
+	const graphWidth = 50
+	scale := func(n int) int {
+		if maxChanges <= graphWidth || n == 0 {
+			return n
+		}
+		scaled := n * graphWidth / maxChanges
+		if scaled == 0 {
+			scaled = 1
+		}
+		return scaled
+	}
+
+	var b strings.Builder
+	for _, file := range p.Files {
+		if file.Binary {
+			fmt.Fprintf(&b, " %-*s | Bin %d -> %d bytes\n", nameWidth, file.Path, file.OldSize, file.NewSize)
+			continue
+		}
+		fmt.Fprintf(&b, " %-*s | %*d %s%s\n", nameWidth, file.Path, countWidth, file.Insertions+file.Deletions,
+			strings.Repeat("+", scale(file.Insertions)), strings.Repeat("-", scale(file.Deletions)))
+	}
+
+	fmt.Fprintf(&b, " %d file%s changed", len(p.Files), plural(len(p.Files)))
+	if p.Insertions > 0 || p.Deletions == 0 {
+		fmt.Fprintf(&b, ", %d insertion%s(+)", p.Insertions, plural(p.Insertions))
+	}
+	if p.Deletions > 0 {
+		fmt.Fprintf(&b, ", %d deletion%s(-)", p.Deletions, plural(p.Deletions))
+	}
+	b.WriteString("\n")
+
+	return b.String()
+}
+
+// CleanupCommitMessage turns an edited template into a commit message by
+// dropping everything below the scissors line, comment lines and
+// surrounding blank lines
+func CleanupCommitMessage(message string) string {
+	if i := strings.Index(message, scissorsLine); i >= 0 {
+		message = message[:i]
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(message, "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, strings.TrimRight(line, " \t"))
+	}
+
+	message = strings.TrimSpace(strings.Join(lines, "\n"))
+	if message == "" {
+		return ""
+	}
+	return message + "\n"
+}
+
+// plural returns "s" unless n is 1
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// isBinaryContent uses Git's heuristic: a NUL byte in the first 8000 bytes
+func isBinaryContent(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
+
+// countLineChanges returns the number of lines added and removed between
+// two versions of a file, using the length of Myers' shortest edit script
+func countLineChanges(oldContent, newContent []byte) (int, int) {
+	ids := make(map[string]int)
+	toIDs := func(content []byte) []int {
+		lines := []int{}
+		for len(content) > 0 {
+			end := bytes.IndexByte(content, '\n') + 1
+			if end == 0 {
+				end = len(content)
+			}
+			line := string(content[:end])
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			lines = append(lines, id)
+			content = content[end:]
+		}
+		return lines
+	}
+	a := toIDs(oldContent)
+	b := toIDs(newContent)
+
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return 0, 0
+	}
+
+	// v[k] is the furthest x reached on diagonal k = x - y
+	v := make([]int, 2*max+2)
+	edits := max
+	for d := 0; d <= max; d++ {
+		found := false
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+				x = v[max+k+1]
+			} else {
+				x = v[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[max+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+		if found {
+			edits = d
+			break
+		}
+	}
+
+	// Every edit is an insertion or a deletion, and their difference is
+	// the change in line count
+	insertions := (edits + m - n) / 2
+	deletions := (edits - m + n) / 2
+	return insertions, deletions
+}
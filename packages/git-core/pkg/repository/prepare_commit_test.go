@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPrepareCommit tests the file list, diffstat and template of staged changes
+func TestPrepareCommit(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "one\ntwo\nthree\n")
+
+	if err := os.WriteFile(filepath.Join(repo.Path, "file.txt"), []byte("one\n2\nthree\nfour\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo.Path, "new.txt"), []byte("a\nb\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo.Path, "image.bin"), []byte{0x89, 0, 1, 2}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"file.txt", "new.txt", "image.bin"} {
+		if err := addFile(repo, path); err != nil {
+			t.Fatalf("Failed to add %s: %v", path, err)
+		}
+	}
+	// Unstaged and untracked changes are listed but not counted
+	if err := os.WriteFile(filepath.Join(repo.Path, "new.txt"), []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo.Path, "notes.txt"), []byte("x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultPrepareCommitOptions()
+	opts.Verbose = true
+	prep, err := repo.PrepareCommit(opts)
+	if err != nil {
+		t.Fatalf("PrepareCommit failed: %v", err)
+	}
+
+	if prep.Branch != "main" || len(prep.Parents) != 1 || !prep.Parents[0].Equals(commits[0]) {
+		t.Errorf("Unexpected branch %q and parents %v", prep.Branch, prep.Parents)
+	}
+	if len(prep.Files) != 3 {
+		t.Fatalf("Expected 3 staged files, got %+v", prep.Files)
+	}
+	if f := prep.Files[0]; f.Path != "file.txt" || f.Change != ChangeModified || f.Insertions != 2 || f.Deletions != 1 {
+		t.Errorf("Unexpected file.txt change %+v", f)
+	}
+	if f := prep.Files[1]; f.Path != "image.bin" || !f.Binary || f.NewSize != 4 {
+		t.Errorf("Unexpected image.bin change %+v", f)
+	}
+	if f := prep.Files[2]; f.Path != "new.txt" || f.Change != ChangeAdded || f.Insertions != 2 {
+		t.Errorf("Unexpected new.txt change %+v", f)
+	}
+	if prep.Insertions != 4 || prep.Deletions != 1 {
+		t.Errorf("Totals = +%d -%d, expected +4 -1", prep.Insertions, prep.Deletions)
+	}
+	if len(prep.NotStaged) != 1 || prep.NotStaged[0].Path != "new.txt" {
+		t.Errorf("Unexpected not staged files %+v", prep.NotStaged)
+	}
+	if len(prep.Untracked) != 1 || prep.Untracked[0] != "notes.txt" {
+		t.Errorf("Unexpected untracked files %v", prep.Untracked)
+	}
+
+	expected := []string{
+		"# On branch main\n",
+		"# Changes to be committed:\n#\tmodified:   file.txt\n#\tnew file:   image.bin\n#\tnew file:   new.txt\n",
+		"# Changes not staged for commit:\n#\tmodified:   new.txt\n",
+		"# Untracked files:\n#\tnotes.txt\n",
+		scissorsLine + "\n",
+		" file.txt  | 3 ++-\n image.bin | Bin 0 -> 4 bytes\n new.txt   | 2 ++\n 3 files changed, 4 insertions(+), 1 deletion(-)\n",
+	}
+	for _, part := range expected {
+		if !strings.Contains(prep.Template, part) {
+			t.Errorf("Template is missing %q:\n%s", part, prep.Template)
+		}
+	}
+	if CleanupCommitMessage(prep.Template) != "" {
+		t.Errorf("Expected an empty message from the bare template, got %q", CleanupCommitMessage(prep.Template))
+	}
+}
+
+// TestPrepareCommitMerge tests the template for concluding a conflicted merge
+func TestPrepareCommitMerge(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "base")
+
+	if err := repo.CreateBranch("feature", commits[0]); err != nil {
+		t.Fatalf("Failed to create branch: %v", err)
+	}
+	if err := switchBranch(repo, "feature"); err != nil {
+		t.Fatal(err)
+	}
+	feature := commitFileContent(t, repo, "feature")
+	if err := switchBranch(repo, "main"); err != nil {
+		t.Fatal(err)
+	}
+	commitFileContent(t, repo, "main")
+
+	result, err := repo.Merge("feature", DefaultMergeOptions())
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if result.Success {
+		t.Fatal("Expected merge conflicts")
+	}
+
+	prep, err := repo.PrepareCommit(DefaultPrepareCommitOptions())
+	if err != nil {
+		t.Fatalf("PrepareCommit failed: %v", err)
+	}
+	if !prep.Merging || len(prep.Parents) != 2 || !prep.Parents[1].Equals(feature) {
+		t.Errorf("Expected a merge with feature as second parent, got %+v", prep)
+	}
+	if len(prep.Unmerged) != 1 || !strings.Contains(prep.Template, "# You have unmerged paths.") {
+		t.Errorf("Expected unmerged file.txt, got %v:\n%s", prep.Unmerged, prep.Template)
+	}
+
+	// Staging a resolution leaves the path in the conflicts summary only
+	if err := os.WriteFile(filepath.Join(repo.Path, "file.txt"), []byte("resolved"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := addFile(repo, "file.txt"); err != nil {
+		t.Fatalf("Failed to add file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repo.GitDir, "MERGE_CONFLICTS"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	prep, err = repo.PrepareCommit(DefaultPrepareCommitOptions())
+	if err != nil {
+		t.Fatalf("PrepareCommit failed: %v", err)
+	}
+	if len(prep.Unmerged) != 0 || len(prep.Conflicts) != 1 || prep.Conflicts[0] != "file.txt" {
+		t.Errorf("Unexpected conflicts %v and unmerged %v", prep.Conflicts, prep.Unmerged)
+	}
+	if !strings.HasPrefix(prep.Template, "Merge branch 'feature'\n\n# Conflicts:\n#\tfile.txt\n") {
+		t.Errorf("Unexpected template:\n%s", prep.Template)
+	}
+	if !strings.Contains(prep.Template, "# All conflicts fixed but you are still merging.") {
+		t.Errorf("Expected merge status in template:\n%s", prep.Template)
+	}
+	if msg := CleanupCommitMessage(prep.Template); msg != "Merge branch 'feature'\n" {
+		t.Errorf("CleanupCommitMessage = %q", msg)
+	}
+}
+
+// TestCountLineChanges tests line counting on edge cases
+func TestCountLineChanges(t *testing.T) {
+	tests := []struct {
+		old, new string
+		ins, del int
+	}{
+		{"", "", 0, 0},
+		{"", "a\nb\n", 2, 0},
+		{"a\nb\n", "", 0, 2},
+		{"a\nb\nc\n", "a\nc\n", 0, 1},
+		{"a\nb\nc\n", "c\nb\na\n", 2, 2},
+		{"a", "a\n", 1, 1},
+	}
+
+	for _, tt := range tests {
+		ins, del := countLineChanges([]byte(tt.old), []byte(tt.new))
+		if ins != tt.ins || del != tt.del {
+			t.Errorf("countLineChanges(%q, %q) = +%d -%d, expected +%d -%d", tt.old, tt.new, ins, del, tt.ins, tt.del)
+		}
+	}
+}
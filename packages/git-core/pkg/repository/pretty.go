@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// prettyDateFormats maps the letters after %a and %c to date formats
+var prettyDateFormats = map[byte]string{
+	'd': "",
+	'D': "rfc",
+	'r': "relative",
+	't': "unix",
+	'i': "iso",
+	'I': "iso-strict",
+	's': "short",
+}
+
+// prettyColors are the named color placeholders, which are left out
+var prettyColors = []string{"Cred", "Cgreen", "Cblue", "Creset"}
+
+// formatPretty expands the placeholders of a git log --pretty=format:
+// string for an entry. Unknown placeholders are kept as they are, as git
+// does.
+func formatPretty(entry *LogEntry, format string) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			b.WriteByte(format[i])
+			continue
+		}
+		n := expandPlaceholder(&b, entry, format[i+1:])
+		if n == 0 {
+			b.WriteByte('%')
+			continue
+		}
+		i += n
+	}
+	return b.String()
+}
+
+// expandPlaceholder writes the value of the placeholder at the start of
+// spec, the text after a %, and returns its length, or 0 when it is not a
+// placeholder
+func expandPlaceholder(b *strings.Builder, entry *LogEntry, spec string) int {
+	if spec == "" {
+		return 0
+	}
+	commit := entry.Commit
+
+	switch spec[0] {
+	case '%':
+		b.WriteByte('%')
+	case 'n':
+		b.WriteByte('\n')
+	case 'x':
+		if len(spec) < 3 {
+			return 0
+		}
+		c, err := strconv.ParseUint(spec[1:3], 16, 8)
+		if err != nil {
+			return 0
+		}
+		b.WriteByte(byte(c))
+		return 3
+	case 'H':
+		b.WriteString(entry.Hash.String())
+	case 'h':
+		b.WriteString(shortHash(entry.Hash))
+	case 'T':
+		b.WriteString(commit.Tree.String())
+	case 't':
+		b.WriteString(shortHash(commit.Tree))
+	case 'P', 'p':
+		for i, parent := range entry.Parents {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			if spec[0] == 'P' {
+				b.WriteString(parent.String())
+			} else {
+				b.WriteString(shortHash(parent))
+			}
+		}
+	case 'a', 'c':
+		who := &commit.Author
+		if spec[0] == 'c' {
+			who = &commit.Committer
+		}
+		if len(spec) < 2 || !writePerson(b, who, spec[1]) {
+			return 0
+		}
+		return 2
+	case 's':
+		subject, _ := formatRefMessage(commit.Message, "subject")
+		b.WriteString(subject.text)
+	case 'f':
+		// Only the first line of the subject goes into the name
+		line, _, _ := strings.Cut(strings.TrimLeft(commit.Message, "\n"), "\n")
+		b.WriteString(sanitizeSubject(line))
+	case 'b':
+		body, _ := formatRefMessage(commit.Message, "body")
+		b.WriteString(body.text)
+	case 'B':
+		b.WriteString(commit.Message)
+	case 'N':
+		b.WriteString(entry.Notes)
+	case 'd':
+		if len(entry.Refs) > 0 {
+			b.WriteString(" (" + strings.Join(entry.Refs, ", ") + ")")
+		}
+	case 'D':
+		b.WriteString(strings.Join(entry.Refs, ", "))
+	case 'C':
+		// Colors are left out
+		if strings.HasPrefix(spec, "C(") {
+			end := strings.IndexByte(spec, ')')
+			if end < 0 {
+				return 0
+			}
+			return end + 1
+		}
+		for _, color := range prettyColors {
+			if strings.HasPrefix(spec, color) {
+				return len(color)
+			}
+		}
+		return 0
+	default:
+		return 0
+	}
+	return 1
+}
+
+// writePerson writes the field of an author or committer that a letter
+// after %a or %c stands for, and reports whether it is one
+func writePerson(b *strings.Builder, who *object.Signature, field byte) bool {
+	switch field {
+	case 'n', 'N':
+		b.WriteString(who.Name)
+	case 'e', 'E':
+		b.WriteString(who.Email)
+	case 'l', 'L':
+		local, _, _ := strings.Cut(who.Email, "@")
+		b.WriteString(local)
+	default:
+		format, ok := prettyDateFormats[field]
+		if !ok {
+			return false
+		}
+		date, _ := formatRefDate(who.When, format)
+		b.WriteString(date)
+	}
+	return true
+}
+
+// relativeDate describes how long before now t was, the way git's
+// --date=relative does
+func relativeDate(t, now time.Time) string {
+	if now.Before(t) {
+		return "in the future"
+	}
+	diff := int64(now.Sub(t) / time.Second)
+	ago := func(n int64, unit string) string {
+		return fmt.Sprintf("%d %s%s ago", n, unit, plural(int(n)))
+	}
+	if diff < 90 {
+		return ago(diff, "second")
+	}
+	if diff = (diff + 30) / 60; diff < 90 {
+		return ago(diff, "minute")
+	}
+	if diff = (diff + 30) / 60; diff < 36 {
+		return ago(diff, "hour")
+	}
+	// Days from here on
+	diff = (diff + 12) / 24
+	switch {
+	case diff < 14:
+		return ago(diff, "day")
+	case diff < 70:
+		return ago((diff+3)/7, "week")
+	case diff < 365:
+		return ago((diff+15)/30, "month")
+	case diff < 1825:
+		totalMonths := (diff*12*2 + 365) / (365 * 2)
+		years, months := totalMonths/12, totalMonths%12
+		if months == 0 {
+			return ago(years, "year")
+		}
+		return fmt.Sprintf("%d year%s, %s", years, plural(int(years)), ago(months, "month"))
+	}
+	return ago((diff+183)/365, "year")
+}
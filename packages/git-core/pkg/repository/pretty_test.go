@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// The expected output was made by git log with the same formats
+func TestFormatLogEntryPretty(t *testing.T) {
+	commit := object.NewCommit()
+	commit.Author = object.Signature{Name: "Ada Lovelace", Email: "ada@example.com", When: time.Unix(1577836800, 0).In(time.FixedZone("", 19800))}
+	commit.Committer = object.Signature{Name: "Bob", Email: "bob@example.org", When: time.Unix(1577840400, 0).In(time.FixedZone("", -28800))}
+	commit.Message = "Fix: the [parser]'s bug..!\ncontinued subject\n\nBody line one.\n\nBody line two.\n"
+	commit.Tree, _ = hash.ParseHash("4b825dc642cb6eb9a060e54bf8d69288fbee4904")
+	h, _ := hash.ParseHash("1234567890abcdef1234567890abcdef12345678")
+	parent, _ := hash.ParseHash("abcdef1234567890abcdef1234567890abcdef12")
+	entry := &LogEntry{Commit: commit, Hash: h, Parents: []hash.Hash{parent}, Refs: []string{"main"}}
+
+	tests := []struct {
+		format LogFormat
+		want   string
+	}{
+		{
+			format: "format:%an|%ae|%al|%ad|%aD|%ai|%aI|%at|%as|",
+			want:   "Ada Lovelace|ada@example.com|ada|Wed Jan 1 05:30:00 2020 +0530|Wed, 1 Jan 2020 05:30:00 +0530|2020-01-01 05:30:00 +0530|2020-01-01T05:30:00+05:30|1577836800|2020-01-01|",
+		},
+		{
+			format: "format:%cn|%ce|%cl|%cd|%cD|%ci|%cI|%ct|%cs|",
+			want:   "Bob|bob@example.org|bob|Tue Dec 31 17:00:00 2019 -0800|Tue, 31 Dec 2019 17:00:00 -0800|2019-12-31 17:00:00 -0800|2019-12-31T17:00:00-08:00|1577840400|2019-12-31|",
+		},
+		{
+			format: "format:%s|%f|%x41%%|%Cred%C(bold blue)x%Creset|%q|%",
+			want:   "Fix: the [parser]'s bug..! continued subject|Fix-the-parser-s-bug|A%|x|%q|%",
+		},
+		{
+			format: "format:%b",
+			want:   "Body line one.\n\nBody line two.\n",
+		},
+		{
+			format: "format:%h %t %p%d|%D|%H",
+			want:   "1234567 4b825dc abcdef1 (main)|main|1234567890abcdef1234567890abcdef12345678",
+		},
+		// tformat and bare format strings end with a newline
+		{format: "tformat:%h", want: "1234567\n"},
+		{format: "%h%n%an", want: "1234567\nAda Lovelace\n"},
+	}
+	for _, tt := range tests {
+		if got := FormatLogEntry(entry, tt.format); got != tt.want {
+			t.Errorf("FormatLogEntry(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+
+	// Named formats are unaffected
+	if got := FormatLogEntry(entry, LogFormatOneline); !strings.HasPrefix(got, "1234567 (main) Fix:") {
+		t.Errorf("Unexpected oneline format %q", got)
+	}
+}
+
+func TestRelativeDate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		ago  time.Duration
+		want string
+	}{
+		{-time.Hour, "in the future"},
+		{time.Second, "1 second ago"},
+		{89 * time.Second, "89 seconds ago"},
+		{90 * time.Second, "2 minutes ago"},
+		{3 * time.Hour, "3 hours ago"},
+		{36 * time.Hour, "2 days ago"},
+		{20 * 24 * time.Hour, "3 weeks ago"},
+		{100 * 24 * time.Hour, "3 months ago"},
+		{400 * 24 * time.Hour, "1 year, 1 month ago"},
+		{730 * 24 * time.Hour, "2 years ago"},
+		{3000 * 24 * time.Hour, "8 years ago"},
+	}
+	for _, tt := range tests {
+		if got := relativeDate(now.Add(-tt.ago), now); got != tt.want {
+			t.Errorf("relativeDate(%v ago) = %q, want %q", tt.ago, got, tt.want)
+		}
+	}
+}
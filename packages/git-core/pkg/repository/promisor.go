@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+// promisorStorage wraps object storage in a partial clone. Objects the
+// clone filter omitted are fetched from the promisor remote on first read.
+type promisorStorage struct {
+	object.Storage
+	repo *Repository
+}
+
+// Read reads an object, fetching it from the promisor remote if missing
+func (s *promisorStorage) Read(h hash.Hash) ([]byte, error) {
+	data, err := s.Storage.Read(h)
+	if err == nil || s.Storage.Has(h) {
+		return data, err
+	}
+
+	if err := s.repo.FetchMissingObjects([]hash.Hash{h}); err != nil {
+		return nil, fmt.Errorf("object %s not found and lazy fetch failed: %w", h.String(), err)
+	}
+
+	return s.Storage.Read(h)
+}
+
+// ReadRaw reads an object's type and content, fetching it from the
+// promisor remote if missing
+func (s *promisorStorage) ReadRaw(h hash.Hash) (object.Type, []byte, error) {
+	objType, content, err := object.ReadRaw(s.Storage, h)
+	if err == nil || s.Storage.Has(h) {
+		return objType, content, err
+	}
+
+	if err := s.repo.FetchMissingObjects([]hash.Hash{h}); err != nil {
+		return "", nil, fmt.Errorf("object %s not found and lazy fetch failed: %w", h.String(), err)
+	}
+
+	return object.ReadRaw(s.Storage, h)
+}
+
+// newObjectDatabase creates the repository's database of loose and packed
+// objects, with lazy fetching when a promisor remote is configured and replace refs
+// honoured unless core.useReplaceRefs is off
+func (r *Repository) newObjectDatabase() object.Database {
+	var storage object.Storage = r.newPackStorage()
+
+	if _, ok := r.Config.GetPromisorRemote(); ok {
+		storage = &promisorStorage{Storage: storage, repo: r}
+	}
+
+	db := object.NewObjectDatabase(storage, r.Hasher)
+	if !r.useReplaceRefs() {
+		return db
+	}
+	return &replaceDatabase{Database: db, repo: r}
+}
+
+// IsPartialClone reports whether objects may be missing locally and
+// available from a promisor remote
+func (r *Repository) IsPartialClone() bool {
+	_, ok := r.Config.GetPromisorRemote()
+	return ok
+}
+
+// FetchMissingObjects fetches the given objects from the promisor remote
+func (r *Repository) FetchMissingObjects(hashes []hash.Hash) error {
+	remote, ok := r.Config.GetPromisorRemote()
+	if !ok {
+		return fmt.Errorf("no promisor remote configured")
+	}
+
+	remoteURL, err := r.Config.GetRemoteURL(remote)
+	if err != nil {
+		return fmt.Errorf("failed to get promisor remote URL: %w", err)
+	}
+
+	wants := make([]string, len(hashes))
+	for i, h := range hashes {
+		wants[i] = h.String()
+	}
+
+	client := r.newClient()
+	uploadPackClient := protocol.NewUploadPackClient(client, remoteURL)
+	stream := newPackStream(r, uploadPackClient, false)
+	resp, err := uploadPackClient.Fetch(&protocol.NegotiationRequest{
+		Wants:        wants,
+		Capabilities: protocol.BuildCapabilities(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fetch packfile: %w", err)
+	}
+	if err := stream.finish(resp); err != nil {
+		return err
+	}
+
+	for _, h := range hashes {
+		if !r.ObjectDB.Has(h) {
+			return fmt.Errorf("promisor remote did not send object %s", h.String())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+// newPromisorServer serves a single packfile for every upload-pack request
+func newPromisorServer(t *testing.T, objects []protocol.PackfileObject, requests *[]string) *httptest.Server {
+	t.Helper()
+
+	var pack bytes.Buffer
+	if err := protocol.NewPackfileWriter(&pack).WritePackfile(objects); err != nil {
+		t.Fatalf("Failed to write packfile: %v", err)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body bytes.Buffer
+		body.ReadFrom(req.Body)
+		*requests = append(*requests, body.String())
+
+		writer := protocol.NewPktLineWriter(w)
+		writer.WriteString("NAK\n")
+		writer.WriteLine(append([]byte{1}, pack.Bytes()...))
+		writer.WriteFlush()
+	}))
+}
+
+// TestPartialCloneLazyFetch tests that missing blobs are fetched on first access
+func TestPartialCloneLazyFetch(t *testing.T) {
+	content := []byte("fetched on demand\n")
+	var requests []string
+	server := newPromisorServer(t, []protocol.PackfileObject{
+		{Type: protocol.ObjBlob, Size: uint64(len(content)), Data: content},
+	}, &requests)
+	defer server.Close()
+
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	repo.Config.SetRemoteURL("origin", server.URL+"/repo.git")
+	repo.Config.SetPromisorRemote("origin", "blob:none")
+	if err := repo.Config.Save(filepath.Join(repo.GitDir, "config")); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	// Reopen so the promisor storage is attached
+	repo, err = Open(repo.Path)
+	if err != nil {
+		t.Fatalf("Failed to open repository: %v", err)
+	}
+	if !repo.IsPartialClone() {
+		t.Fatal("Expected repository to be a partial clone")
+	}
+
+	blobHash := hash.HashBlob(repo.Hasher, content)
+	if repo.ObjectDB.Has(blobHash) {
+		t.Fatal("Blob should not be present before first access")
+	}
+
+	obj, err := repo.ObjectDB.Get(blobHash)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	blob, ok := obj.(*object.Blob)
+	if !ok || !bytes.Equal(blob.Content(), content) {
+		t.Fatalf("Unexpected object: %v", obj)
+	}
+
+	if len(requests) != 1 || !strings.Contains(requests[0], "want "+blobHash.String()) {
+		t.Errorf("Expected one request wanting the blob, got %q", requests)
+	}
+
+	// Subsequent reads are served locally
+	if _, err := repo.ObjectDB.Get(blobHash); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if len(requests) != 1 {
+		t.Errorf("Expected no further requests, got %d", len(requests))
+	}
+}
+
+// TestPartialCloneMissingObject tests the error when the remote omits an object
+func TestPartialCloneMissingObject(t *testing.T) {
+	var requests []string
+	server := newPromisorServer(t, []protocol.PackfileObject{
+		{Type: protocol.ObjBlob, Size: 5, Data: []byte("other")},
+	}, &requests)
+	defer server.Close()
+
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	repo.Config.SetRemoteURL("origin", server.URL+"/repo.git")
+	repo.Config.SetPromisorRemote("origin", "blob:none")
+	repo.ObjectDB = repo.newObjectDatabase()
+
+	missing := hash.HashBlob(repo.Hasher, []byte("never sent"))
+	if _, err := repo.ObjectDB.Get(missing); err == nil {
+		t.Error("Expected error for object the remote did not send")
+	}
+}
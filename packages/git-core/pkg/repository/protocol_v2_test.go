@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+// newUploadPackV2Server serves the source repository over protocol v2,
+// answering ls-refs from its refs and fetch with a pack of every object.
+// The bodies of the commands received are appended to requests.
+func newUploadPackV2Server(t *testing.T, source *Repository, requests *[]string) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Git-Protocol") != "version=2" {
+			http.Error(w, "protocol v2 only", http.StatusBadRequest)
+			return
+		}
+		writer := protocol.NewPktLineWriter(w)
+
+		if req.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+			writer.WriteString("# service=git-upload-pack\n")
+			writer.WriteFlush()
+			writer.WriteString("version 2\n")
+			writer.WriteString("ls-refs=unborn\n")
+			writer.WriteString("fetch=shallow filter\n")
+			writer.WriteFlush()
+			return
+		}
+
+		var body bytes.Buffer
+		body.ReadFrom(req.Body)
+		*requests = append(*requests, body.String())
+
+		if strings.Contains(body.String(), "command=ls-refs\n") {
+			refs, err := source.ListRefs("refs/")
+			if err != nil {
+				t.Errorf("Failed to list refs: %v", err)
+			}
+			head, _ := source.ResolveRef("HEAD")
+			writer.WriteString(head.String() + " HEAD symref-target:refs/heads/main\n")
+			for _, name := range refs {
+				h, _ := source.ResolveRef(name)
+				if lsRefsWants(body.String(), name) {
+					writer.WriteString(h.String() + " " + name + "\n")
+				}
+			}
+			writer.WriteFlush()
+			return
+		}
+
+		writer.WriteString("packfile\n")
+		writer.WriteLine([]byte("\x02Enumerating objects: done.\n"))
+		writer.WriteLine(append([]byte{1}, testPackfile(t, source)...))
+		writer.WriteFlush()
+	}))
+}
+
+// lsRefsWants reports whether an ls-refs request asks for a ref
+func lsRefsWants(request, name string) bool {
+	if !strings.Contains(request, "ref-prefix ") {
+		return true
+	}
+	for _, line := range strings.Split(request, "\n") {
+		if i := strings.Index(line, "ref-prefix "); i >= 0 && strings.HasPrefix(name, line[i+len("ref-prefix "):]) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestFetchProtocolV2 tests cloning and fetching from a server that only
+// speaks protocol v2
+func TestFetchProtocolV2(t *testing.T) {
+	source := setupLocalCloneSource(t)
+	main, _ := source.GetBranch("main")
+
+	var requests []string
+	server := newUploadPackV2Server(t, source, &requests)
+	defer server.Close()
+
+	repo, err := Clone(server.URL+"/repo.git", t.TempDir(), DefaultCloneOptions())
+	if err != nil {
+		t.Fatalf("Clone over protocol v2 failed: %v", err)
+	}
+	if h, err := repo.GetBranch("main"); err != nil || !h.Equals(main) {
+		t.Errorf("main = %v, %v, want the source's main", h, err)
+	}
+	if len(requests) != 2 || !strings.Contains(requests[1], "command=fetch\n") || !strings.Contains(requests[1], "want "+main.String()) {
+		t.Fatalf("Unexpected clone requests %q", requests)
+	}
+
+	newMain := commitTestTree(t, source, "three", map[string]string{"dir/file.txt": "three\n"}, main)
+	if err := source.UpdateRef("refs/heads/main", newMain); err != nil {
+		t.Fatal(err)
+	}
+	requests = nil
+	var messages []string
+	opts := DefaultFetchOptions()
+	opts.ProgressCallback = func(message string) {
+		messages = append(messages, message)
+	}
+	if _, err := repo.Fetch(opts); err != nil {
+		t.Fatalf("Fetch over protocol v2 failed: %v", err)
+	}
+	if h, err := repo.GetRef("refs/remotes/origin/main"); err != nil || !h.Equals(newMain) {
+		t.Errorf("origin/main = %v, %v, want the new commit", h, err)
+	}
+
+	// Only the refs the refspecs can match are listed
+	if len(requests) != 2 || !strings.Contains(requests[0], "ref-prefix refs/heads/\n") || strings.Contains(requests[0], "ref-prefix refs/tags/") {
+		t.Errorf("Unexpected ls-refs request %q", requests[0])
+	}
+	if !strings.Contains(requests[1], "have "+main.String()) {
+		t.Errorf("Expected the fetch to send haves, got %q", requests[1])
+	}
+
+	// The server's side-band messages reach the progress callback
+	if !stringSliceContains(messages, "remote: Enumerating objects: done.") {
+		t.Errorf("Remote progress was not reported: %q", messages)
+	}
+
+	// A fetch that checks every object first stores the same
+	latest := commitTestTree(t, source, "four", map[string]string{"dir/file.txt": "four\n"}, newMain)
+	if err := source.UpdateRef("refs/heads/main", latest); err != nil {
+		t.Fatal(err)
+	}
+	opts = DefaultFetchOptions()
+	opts.VerifyObjects = true
+	if _, err := repo.Fetch(opts); err != nil {
+		t.Fatalf("Verified fetch failed: %v", err)
+	}
+	if !repo.ObjectDB.Has(latest) {
+		t.Error("Expected the verified fetch to store the new commit")
+	}
+}
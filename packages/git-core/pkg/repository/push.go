@@ -5,9 +5,9 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
-	"github.com/nseba/browser-git/git-core/pkg/object"
-	"github.com/nseba/browser-git/git-core/pkg/protocol"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
 )
 
 // PushOptions contains options for pushing to a remote
@@ -22,19 +22,98 @@ type PushOptions struct {
 	AuthProvider interface{}
 	// ProgressCallback is called with progress updates
 	ProgressCallback func(message string)
+	// NoVerify skips the pre-push hook
+	NoVerify bool
+	// SetUpstream makes each pushed branch track the branch it was pushed
+	// to, like -u
+	SetUpstream bool
+	// VerifyObjects resolves every object in the packfile before it is
+	// sent and checks they are the objects being pushed
+	VerifyObjects bool
 }
 
 // DefaultPushOptions returns default push options
 func DefaultPushOptions() PushOptions {
 	return PushOptions{
-		Remote:   "origin",
-		RefSpecs: []string{},
-		Force:    false,
+		Remote:      "origin",
+		RefSpecs:    []string{},
+		Force:       false,
+		NoVerify:    false,
+		SetUpstream: false,
 	}
 }
 
-// Push pushes local commits to a remote repository
+// PushResult describes what the remote did with a push
+type PushResult struct {
+	// UpToDate is set when the remote already had everything, so nothing
+	// was sent
+	UpToDate bool
+	// UnpackStatus is "ok", or why the remote could not unpack the
+	// packfile, in which case no ref was updated
+	UnpackStatus string
+	// Refs is the result of each ref update, in the order they were sent
+	Refs []PushRefResult
+	// Messages are the remote's messages, such as the output of its hooks,
+	// each prefixed with "remote: "
+	Messages []string
+	// TrackingError is why the remote tracking branches of the refs the
+	// remote updated could not be updated in turn. The push itself went
+	// through, so Err does not report it.
+	TrackingError error
+}
+
+// PushRefResult is the result of one ref update of a push
+type PushRefResult struct {
+	// LocalRef is the local ref pushed, empty for a deletion
+	LocalRef string
+	// RemoteRef is the remote ref updated
+	RemoteRef string
+	// OldHash is the remote ref's hash before the push (zeros if new), or
+	// the one the remote reports for the ref it updated
+	OldHash string
+	// NewHash is the hash pushed (zeros to delete the remote ref), or the
+	// one the remote reports the ref it updated has now
+	NewHash string
+	// OK is set when the remote updated the ref
+	OK bool
+	// Message is why the remote refused the update, e.g.
+	// "non-fast-forward" or the reason a hook gave
+	Message string
+	// RewrittenRef is the ref the remote updated instead of RemoteRef,
+	// when it reports one, as servers running proc-receive hooks do
+	RewrittenRef string
+	// ForcedUpdate is set when the remote reports a non-fast-forward update
+	ForcedUpdate bool
+}
+
+// Err returns the error a push with this result failed with: a packfile
+// the remote could not unpack or the first ref it refused to update
+func (res *PushResult) Err() error {
+	if res.UnpackStatus != "" && res.UnpackStatus != "ok" {
+		return fmt.Errorf("unpack failed: %s", res.UnpackStatus)
+	}
+	for _, ref := range res.Refs {
+		if !ref.OK {
+			return fmt.Errorf("failed to update %s: %s", ref.RemoteRef, ref.Message)
+		}
+	}
+	return nil
+}
+
+// Push pushes local commits to a remote repository. A ref the remote
+// refuses to update fails the push; PushWithResult reports each ref.
 func (r *Repository) Push(opts PushOptions) error {
+	result, err := r.PushWithResult(opts)
+	if err != nil {
+		return err
+	}
+	return result.Err()
+}
+
+// PushWithResult pushes like Push, reporting which refs the remote updated
+// and why it refused the others rather than failing. Only the remote
+// tracking branches of the refs it updated are moved.
+func (r *Repository) PushWithResult(opts PushOptions) (*PushResult, error) {
 	// Progress callback helper
 	progress := func(msg string) {
 		if opts.ProgressCallback != nil {
@@ -47,11 +126,11 @@ func (r *Repository) Push(opts PushOptions) error {
 	// Get remote URL from config
 	remoteURL, err := r.GetRemoteURL(opts.Remote)
 	if err != nil {
-		return fmt.Errorf("failed to get remote URL: %w", err)
+		return nil, fmt.Errorf("failed to get remote URL: %w", err)
 	}
 
 	// Create protocol client
-	client := protocol.NewClient()
+	client := r.newClient()
 
 	// Set authentication if provided
 	if opts.AuthProvider != nil {
@@ -62,7 +141,7 @@ func (r *Repository) Push(opts PushOptions) error {
 	progress("Fetching remote references...")
 	discovery, err := client.Discover(remoteURL, protocol.ReceivePackService)
 	if err != nil {
-		return fmt.Errorf("failed to discover remote: %w", err)
+		return nil, fmt.Errorf("failed to discover remote: %w", err)
 	}
 
 	// Build remote references map for easy lookup
@@ -77,19 +156,26 @@ func (r *Repository) Push(opts PushOptions) error {
 		// If no refspecs provided, push current branch
 		currentBranch, err := r.CurrentBranch()
 		if err != nil {
-			return fmt.Errorf("failed to get current branch: %w", err)
+			return nil, fmt.Errorf("failed to get current branch: %w", err)
 		}
 
 		refsToPush, err = r.buildRefsToPushForBranch(currentBranch, remoteRefs, opts.Force)
 		if err != nil {
-			return err
+			return nil, err
+		}
+
+		// Like git, -u applies to a branch that is already up to date too
+		if len(refsToPush) == 0 && opts.SetUpstream {
+			if err := r.SetUpstream(currentBranch, opts.Remote, currentBranch); err != nil {
+				return nil, fmt.Errorf("failed to set upstream: %w", err)
+			}
 		}
 	} else {
 		// Parse and process refspecs
 		for _, refspec := range opts.RefSpecs {
 			refs, err := r.parseAndBuildRefsToPush(refspec, remoteRefs, opts.Force)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			refsToPush = append(refsToPush, refs...)
 		}
@@ -97,41 +183,53 @@ func (r *Repository) Push(opts PushOptions) error {
 
 	if len(refsToPush) == 0 {
 		progress("Everything up-to-date")
-		return nil
+		return &PushResult{UpToDate: true}, nil
 	}
 
 	// Find commits to send
 	progress("Determining commits to send...")
-	commitsToSend, err := r.findCommitsToSend(refsToPush, remoteRefs)
+	toSend, err := r.revListToSend(refsToPush, remoteRefs)
 	if err != nil {
-		return fmt.Errorf("failed to find commits to send: %w", err)
+		return nil, fmt.Errorf("failed to find commits to send: %w", err)
 	}
 
-	if len(commitsToSend) == 0 && !hasNewOrDeletedRefs(refsToPush) {
+	if len(toSend.Commits) == 0 && !hasNewOrDeletedRefs(refsToPush) {
 		progress("Everything up-to-date")
-		return nil
+		return &PushResult{UpToDate: true}, nil
 	}
 
-	progress(fmt.Sprintf("Found %d commits to send", len(commitsToSend)))
-
-	// Collect all objects to send
-	progress("Collecting objects...")
-	objectsToSend, err := r.collectObjectsForCommits(commitsToSend)
-	if err != nil {
-		return fmt.Errorf("failed to collect objects: %w", err)
+	if !opts.NoVerify {
+		if err := r.runHook(HookPrePush, prePushInput(refsToPush), opts.Remote, remoteURL); err != nil {
+			return nil, err
+		}
 	}
 
-	progress(fmt.Sprintf("Collected %d objects", len(objectsToSend)))
+	progress(fmt.Sprintf("Found %d commits to send", len(toSend.Commits)))
 
-	// Create packfile
+	progress(fmt.Sprintf("Collected %d objects", len(toSend.Commits)+len(toSend.Objects)))
+
+	// Create packfile, thin unless the remote refuses: its deltas may be
+	// based on objects the remote already has
 	progress("Creating packfile...")
-	packfileData, err := r.createPackfileForPush(objectsToSend)
+	thin := !containsString(discovery.Capabilities, "no-thin")
+	packfileData, err := r.packRevList(toSend, thin)
 	if err != nil {
-		return fmt.Errorf("failed to create packfile: %w", err)
+		return nil, fmt.Errorf("failed to create packfile: %w", err)
 	}
 
 	progress(fmt.Sprintf("Created packfile with %d bytes", len(packfileData)))
 
+	// A corrupt packfile never reaches the remote
+	packed, err := r.checkPack(packfileData, opts.VerifyObjects)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify packfile: %w", err)
+	}
+	if opts.VerifyObjects {
+		if err := checkPackedObjects(toSend, packed); err != nil {
+			return nil, err
+		}
+	}
+
 	// Build ref updates for push request
 	refUpdates := make([]protocol.RefUpdate, 0, len(refsToPush))
 	for _, ref := range refsToPush {
@@ -142,52 +240,139 @@ func (r *Repository) Push(opts PushOptions) error {
 		})
 	}
 
+	// Ask for the options report-status-v2 adds where the remote has it
+	capabilities := protocol.BuildPushCapabilities()
+	if containsString(discovery.Capabilities, "report-status-v2") {
+		capabilities = append(capabilities, "report-status-v2")
+	}
+
 	// Create push request
 	pushReq := &protocol.PushRequest{
 		Updates:      refUpdates,
-		Capabilities: protocol.BuildPushCapabilities(),
+		Capabilities: capabilities,
 		Packfile:     packfileData,
 		Force:        opts.Force,
 		ReportStatus: true,
 	}
 
-	// Send push request
+	// Send push request, keeping the remote's messages
 	progress("Sending packfile to remote...")
+	result := &PushResult{}
 	receivePackClient := protocol.NewReceivePackClient(client, remoteURL)
+	receivePackClient.SetProgressCallback(func(message string) {
+		result.Messages = append(result.Messages, message)
+		progress(message)
+	})
 	pushResp, err := receivePackClient.Push(pushReq)
 	if err != nil {
-		return fmt.Errorf("push failed: %w", err)
+		return nil, fmt.Errorf("push failed: %w", err)
 	}
+	result.UnpackStatus = pushResp.UnpackStatus
+	result.Refs = pushRefResults(refsToPush, pushResp)
 
-	// Check response
-	if pushResp.UnpackStatus != "ok" {
-		return fmt.Errorf("unpack failed: %s", pushResp.UnpackStatus)
+	// Update the remote tracking branches of the refs the remote updated,
+	// which may not be the refs pushed to, nor to the hashes pushed, when
+	// it rewrote them
+	progress("Updating remote tracking branches...")
+	trackingUpdates := []RefUpdate{}
+	pushed := []refToPush{}
+	for i, ref := range refsToPush {
+		if !result.Refs[i].OK {
+			continue
+		}
+		pushed = append(pushed, ref)
+		remoteName := ref.remoteName
+		if result.Refs[i].RewrittenRef != "" {
+			remoteName = result.Refs[i].RewrittenRef
+		}
+		if branchName, ok := strings.CutPrefix(remoteName, "refs/heads/"); ok {
+			// A deleted remote branch takes its tracking branch with it
+			trackingUpdates = append(trackingUpdates, RefUpdate{
+				RefName: fmt.Sprintf("refs/remotes/%s/%s", opts.Remote, branchName),
+				NewHash: result.Refs[i].NewHash,
+			})
+		}
 	}
+	// The push went through, so a tracking branch that cannot be updated
+	// is reported rather than failing it; the next fetch sets it right
+	result.TrackingError = r.UpdateRefs(trackingUpdates, false)
 
-	// Update remote tracking branches
-	progress("Updating remote tracking branches...")
-	for _, ref := range refsToPush {
-		if ref.newHash != "0000000000000000000000000000000000000000" {
-			// Parse hash
-			h, err := hash.ParseHash(ref.newHash)
-			if err != nil {
-				continue
-			}
+	if opts.SetUpstream {
+		if err := r.setPushedUpstreams(opts.Remote, pushed); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := result.Err(); err != nil {
+		progress(fmt.Sprintf("Push failed: %v", err))
+	} else {
+		if result.TrackingError != nil {
+			progress(fmt.Sprintf("Failed to update remote tracking branches: %v", result.TrackingError))
+		}
+		progress("Push successful!")
+	}
+	return result, nil
+}
 
-			// Update remote tracking branch
-			remoteBranch := ref.remoteName
-			if strings.HasPrefix(remoteBranch, "refs/heads/") {
-				branchName := strings.TrimPrefix(remoteBranch, "refs/heads/")
-				trackingBranch := fmt.Sprintf("refs/remotes/%s/%s", opts.Remote, branchName)
-				if err := r.UpdateRef(trackingBranch, h); err != nil {
-					// Log error but continue
-					continue
-				}
+// pushRefResults matches the status the remote reported for each ref to
+// the refs pushed. Without a status for a ref, the remote did not update
+// it; when it could not unpack the packfile, it updated none.
+func pushRefResults(refs []refToPush, resp *protocol.PushResponse) []PushRefResult {
+	statuses := make(map[string]protocol.RefUpdateStatus, len(resp.RefStatuses))
+	for _, status := range resp.RefStatuses {
+		if _, ok := statuses[status.RefName]; !ok {
+			statuses[status.RefName] = status
+		}
+	}
+
+	results := make([]PushRefResult, len(refs))
+	for i, ref := range refs {
+		result := PushRefResult{
+			LocalRef:  ref.localName,
+			RemoteRef: ref.remoteName,
+			OldHash:   ref.oldHash,
+			NewHash:   ref.newHash,
+		}
+		status, ok := statuses[ref.remoteName]
+		switch {
+		case ok && status.OK() && resp.UnpackStatus == "ok":
+			result.OK = true
+			result.RewrittenRef = status.RewrittenRef
+			result.ForcedUpdate = status.ForcedUpdate
+			if status.OldHash != "" {
+				result.OldHash = status.OldHash
+			}
+			if status.NewHash != "" {
+				result.NewHash = status.NewHash
 			}
+		case ok && !status.OK():
+			result.Message = status.Status
+		case resp.UnpackStatus != "ok" && resp.UnpackStatus != "":
+			result.Message = "unpacker error"
+		default:
+			result.Message = "no status reported by the remote"
 		}
+		results[i] = result
 	}
+	return results
+}
 
-	progress("Push successful!")
+// checkPackedObjects checks that every object of a rev-list is among the
+// objects a packfile was found to hold
+func checkPackedObjects(list *RevListResult, packed []hash.Hash) error {
+	ids := make(map[string]bool, len(packed))
+	for _, h := range packed {
+		ids[h.String()] = true
+	}
+	want := append([]hash.Hash{}, list.Commits...)
+	for _, o := range list.Objects {
+		want = append(want, o.Hash)
+	}
+	for _, h := range want {
+		if !ids[h.String()] {
+			return fmt.Errorf("%w: object %s is not in the packfile", protocol.ErrCorruptPack, h.String())
+		}
+	}
 	return nil
 }
 
@@ -341,234 +526,61 @@ func (r *Repository) parseAndBuildRefsToPush(refspec string, remoteRefs map[stri
 	}}, nil
 }
 
-// isAncestor checks if oldHash is an ancestor of newHash
-func (r *Repository) isAncestor(oldHashStr string, newHashStr string) (bool, error) {
-	// Parse hashes
-	oldHash, err := hash.ParseHash(oldHashStr)
-	if err != nil {
-		return false, err
-	}
-
-	newHash, err := hash.ParseHash(newHashStr)
-	if err != nil {
-		return false, err
-	}
-
-	// Walk from newHash back to find oldHash
-	visited := make(map[string]bool)
-	queue := []hash.Hash{newHash}
-
-	for len(queue) > 0 {
-		current := queue[0]
-		queue = queue[1:]
-
-		if current.String() == oldHash.String() {
-			return true, nil
-		}
+// revListToSend lists the commits and objects the pushed refs need that
+// the remote refs do not already reach
+func (r *Repository) revListToSend(refs []refToPush, remoteRefs map[string]string) (*RevListResult, error) {
+	opts := RevListOptions{Objects: true}
 
-		if visited[current.String()] {
-			continue
-		}
-		visited[current.String()] = true
-
-		// Get commit
-		obj, err := r.ObjectDB.Get(current)
-		if err != nil {
-			continue
-		}
-
-		commit, ok := obj.(*object.Commit)
-		if !ok {
+	// Exclude what the remote has; ones we lack are skipped by RevList
+	for _, remoteHash := range remoteRefs {
+		if remoteHash == "0000000000000000000000000000000000000000" {
 			continue
 		}
-
-		// Add parents to queue
-		for _, parent := range commit.Parents {
-			queue = append(queue, parent)
+		if h, err := hash.ParseHash(remoteHash); err == nil {
+			opts.Exclude = append(opts.Exclude, h)
 		}
 	}
 
-	return false, nil
-}
-
-// findCommitsToSend finds all commits that need to be sent
-func (r *Repository) findCommitsToSend(refs []refToPush, remoteRefs map[string]string) ([]hash.Hash, error) {
-	commits := []hash.Hash{}
-	seen := make(map[string]bool)
-
-	// Collect all remote commit hashes (what they have)
-	remoteHaves := make(map[string]bool)
-	for _, remoteHash := range remoteRefs {
-		if remoteHash != "0000000000000000000000000000000000000000" {
-			remoteHaves[remoteHash] = true
-		}
-	}
-
-	// For each ref, walk back from newHash until we hit remoteHash or a commit they have
 	for _, ref := range refs {
 		if ref.newHash == "0000000000000000000000000000000000000000" {
 			// Delete - no commits to send
 			continue
 		}
-
-		newHash, err := hash.ParseHash(ref.newHash)
-		if err != nil {
-			continue
-		}
-
-		// Walk commits
-		if err := r.walkCommitsToSend(newHash, remoteHaves, seen, &commits); err != nil {
-			return nil, err
+		if h, err := hash.ParseHash(ref.newHash); err == nil {
+			opts.Include = append(opts.Include, h)
 		}
 	}
 
-	return commits, nil
-}
-
-// walkCommitsToSend recursively walks commits to find ones to send
-func (r *Repository) walkCommitsToSend(commitHash hash.Hash, remoteHaves map[string]bool, seen map[string]bool, commits *[]hash.Hash) error {
-	hashStr := commitHash.String()
-
-	// Skip if already processed
-	if seen[hashStr] {
-		return nil
-	}
-	seen[hashStr] = true
-
-	// Skip if remote has this commit
-	if remoteHaves[hashStr] {
-		return nil
+	if len(opts.Include) == 0 {
+		return &RevListResult{}, nil
 	}
-
-	// Get commit object
-	obj, err := r.ObjectDB.Get(commitHash)
-	if err != nil {
-		return err
-	}
-
-	commit, ok := obj.(*object.Commit)
-	if !ok {
-		return fmt.Errorf("expected commit, got %T", obj)
-	}
-
-	// Add to commits to send
-	*commits = append(*commits, commitHash)
-
-	// Recurse into parents
-	for _, parent := range commit.Parents {
-		if err := r.walkCommitsToSend(parent, remoteHaves, seen, commits); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return r.RevList(opts)
 }
 
-// collectObjectsForCommits collects all objects (commits, trees, blobs) for the given commits
-func (r *Repository) collectObjectsForCommits(commits []hash.Hash) ([]object.Object, error) {
-	objects := []object.Object{}
-	seen := make(map[string]bool)
-
-	for _, commitHash := range commits {
-		if err := r.collectObjectsRecursive(commitHash, seen, &objects); err != nil {
-			return nil, err
-		}
-	}
-
-	return objects, nil
-}
-
-// collectObjectsRecursive recursively collects all objects
-func (r *Repository) collectObjectsRecursive(h hash.Hash, seen map[string]bool, objects *[]object.Object) error {
-	hashStr := h.String()
-	if seen[hashStr] {
-		return nil
-	}
-	seen[hashStr] = true
-
-	// Get object
-	obj, err := r.ObjectDB.Get(h)
-	if err != nil {
-		return err
-	}
-
-	// Add to objects
-	*objects = append(*objects, obj)
-
-	// Recurse based on type
-	switch o := obj.(type) {
-	case *object.Commit:
-		// Recurse into tree
-		if err := r.collectObjectsRecursive(o.Tree, seen, objects); err != nil {
-			return err
-		}
-		// Note: We don't recurse into parents since we already walked commits
-
-	case *object.Tree:
-		// Recurse into all entries
-		for _, entry := range o.Entries() {
-			if err := r.collectObjectsRecursive(entry.Hash, seen, objects); err != nil {
-				return err
-			}
-		}
-
-	case *object.Blob:
-		// Leaf node - nothing to recurse
-
-	case *object.Tag:
-		// Recurse into target
-		if err := r.collectObjectsRecursive(o.Target, seen, objects); err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-// createPackfileForPush creates a packfile with the given objects
+// createPackfileForPush creates a packfile with the given objects, stored
+// as deltas of each other where that is smaller
 func (r *Repository) createPackfileForPush(objects []object.Object) ([]byte, error) {
-	// Convert objects to packfile objects
-	packfileObjects := make([]protocol.PackfileObject, 0, len(objects))
-
+	entries := make([]*packEntry, 0, len(objects))
 	for _, obj := range objects {
-		// Serialize object
-		var buf bytes.Buffer
-		if err := obj.Serialize(&buf); err != nil {
-			return nil, fmt.Errorf("failed to serialize object: %w", err)
-		}
-		data := buf.Bytes()
-
-		// Determine type
-		var objType uint8
-		switch obj.(type) {
-		case *object.Commit:
-			objType = protocol.ObjCommit
-		case *object.Tree:
-			objType = protocol.ObjTree
-		case *object.Blob:
-			objType = protocol.ObjBlob
-		case *object.Tag:
-			objType = protocol.ObjTag
-		default:
-			return nil, fmt.Errorf("unknown object type: %T", obj)
+		h := obj.Hash()
+		if h == nil {
+			var raw bytes.Buffer
+			if err := obj.SerializeWithHeader(&raw); err != nil {
+				return nil, fmt.Errorf("failed to serialize object: %w", err)
+			}
+			h = r.Hasher.Hash(raw.Bytes())
 		}
-
-		packfileObjects = append(packfileObjects, protocol.PackfileObject{
-			Type:    objType,
-			Size:    uint64(len(data)),
-			Data:    data,
-			IsDelta: false,
-		})
+		entry, err := newPackEntry(h, obj, "")
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
 	}
 
-	// Write packfile
-	var buf bytes.Buffer
-	writer := protocol.NewPackfileWriter(&buf)
-	if err := writer.WritePackfile(packfileObjects); err != nil {
+	if err := deltifyPackEntries(entries); err != nil {
 		return nil, err
 	}
-
-	return buf.Bytes(), nil
+	return writePackEntries(entries, r.Hasher)
 }
 
 // hasNewOrDeletedRefs checks if any refs are new or deleted
@@ -593,3 +605,19 @@ func (r *Repository) GetRemoteURL(remoteName string) (string, error) {
 
 	return url, nil
 }
+
+// packObjectType returns the packfile type of an object
+func packObjectType(obj object.Object) (uint8, error) {
+	switch obj.(type) {
+	case *object.Commit:
+		return protocol.ObjCommit, nil
+	case *object.Tree:
+		return protocol.ObjTree, nil
+	case *object.Blob:
+		return protocol.ObjBlob, nil
+	case *object.Tag:
+		return protocol.ObjTag, nil
+	default:
+		return 0, fmt.Errorf("unknown object type: %T", obj)
+	}
+}
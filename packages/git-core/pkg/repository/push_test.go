@@ -1,10 +1,16 @@
 package repository
 
 import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
-	"github.com/nseba/browser-git/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
 )
 
 func TestDefaultPushOptions(t *testing.T) {
@@ -58,7 +64,7 @@ func TestPushIsAncestor(t *testing.T) {
 	}
 }
 
-func TestParseRefSpec(t *testing.T) {
+func TestPushParseRefSpec(t *testing.T) {
 	tests := []struct {
 		name     string
 		refspec  string
@@ -215,9 +221,9 @@ func TestGetRemoteURL(t *testing.T) {
 	}
 }
 
-func TestCollectObjectsForCommits(t *testing.T) {
+func TestLoadRevList(t *testing.T) {
 	// This test would require creating a full repository with commits
-	// For now, we'll just verify the function exists and handles empty input
+	// For now, we'll just verify the function exists and handles an empty list
 
 	// Create a temporary test repository
 	tmpDir := t.TempDir()
@@ -240,7 +246,7 @@ func TestCollectObjectsForCommits(t *testing.T) {
 	}
 
 	// Test with empty commits list
-	objects, err := repo.collectObjectsForCommits([]hash.Hash{})
+	objects, err := repo.loadRevList(&RevListResult{})
 	if err != nil {
 		t.Fatalf("failed to collect objects: %v", err)
 	}
@@ -282,3 +288,101 @@ func TestCreatePackfileForPush(t *testing.T) {
 		t.Error("expected non-empty packfile")
 	}
 }
+
+// TestPushWithResult tests that the remote's status for each ref is
+// reported, and only the refs it updated move their tracking branches
+func TestPushWithResult(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "one", "two")
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writer := protocol.NewPktLineWriter(w)
+		if req.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/x-git-receive-pack-advertisement")
+			writer.WriteString("# service=git-receive-pack\n")
+			writer.WriteFlush()
+			writer.WriteString(commits[0].String() + " refs/heads/main\x00report-status report-status-v2 side-band-64k\n")
+			writer.WriteFlush()
+			return
+		}
+
+		var body bytes.Buffer
+		body.ReadFrom(req.Body)
+		requests = append(requests, body.String())
+
+		var status bytes.Buffer
+		statusWriter := protocol.NewPktLineWriter(&status)
+		statusWriter.WriteString("unpack ok\n")
+		statusWriter.WriteString("ok refs/heads/main\n")
+		statusWriter.WriteString("ng refs/heads/topic hook declined\n")
+		statusWriter.WriteString("ok refs/for/main\n")
+		statusWriter.WriteString("option refname refs/heads/review\n")
+		statusWriter.WriteString("option new-oid " + commits[0].String() + "\n")
+		statusWriter.WriteFlush()
+		writer.WriteLine([]byte("\x02topic is frozen\n"))
+		writer.WriteLine(append([]byte{1}, status.Bytes()...))
+		writer.WriteFlush()
+	}))
+	defer server.Close()
+	if err := setupRemote(repo, "origin", server.URL+"/repo.git"); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultPushOptions()
+	opts.RefSpecs = []string{"refs/heads/main:refs/heads/main", "refs/heads/main:refs/heads/topic", "refs/heads/main:refs/for/main"}
+	result, err := repo.PushWithResult(opts)
+	if err != nil {
+		t.Fatalf("PushWithResult failed: %v", err)
+	}
+	if len(requests) != 1 || !strings.Contains(requests[0], "report-status-v2") {
+		t.Errorf("Expected report-status-v2 to be requested, got %q", requests)
+	}
+	if result.UnpackStatus != "ok" || len(result.Refs) != 3 {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+	if main := result.Refs[0]; !main.OK || main.RemoteRef != "refs/heads/main" || main.NewHash != commits[1].String() {
+		t.Errorf("Unexpected main result %+v", main)
+	}
+	if topic := result.Refs[1]; topic.OK || topic.RemoteRef != "refs/heads/topic" || topic.Message != "hook declined" {
+		t.Errorf("Unexpected topic result %+v", topic)
+	}
+	if review := result.Refs[2]; !review.OK || review.RewrittenRef != "refs/heads/review" || review.NewHash != commits[0].String() {
+		t.Errorf("Unexpected review result %+v", review)
+	}
+	if len(result.Messages) != 1 || result.Messages[0] != "remote: topic is frozen" {
+		t.Errorf("Messages = %q", result.Messages)
+	}
+
+	if h, err := repo.GetRef("refs/remotes/origin/main"); err != nil || !h.Equals(commits[1]) {
+		t.Errorf("origin/main = %v, %v, want the pushed commit", h, err)
+	}
+	if _, err := repo.GetRef("refs/remotes/origin/topic"); err == nil {
+		t.Error("Expected no tracking branch for the refused ref")
+	}
+	if h, err := repo.GetRef("refs/remotes/origin/review"); err != nil || !h.Equals(commits[0]) {
+		t.Errorf("origin/review = %v, %v, want the commit the remote reports for the rewritten ref", h, err)
+	}
+	if err := repo.Push(opts); err == nil || !strings.Contains(err.Error(), "refs/heads/topic: hook declined") {
+		t.Errorf("Push() = %v, want the refused ref", err)
+	}
+
+	// A tracking branch that cannot be written is reported without
+	// failing a push the remote has taken
+	if err := repo.DeleteRef("refs/remotes/origin/main"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(repo.GitDir, "refs", "remotes", "origin", "main", "blocked"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	opts.RefSpecs = []string{"refs/heads/main:refs/heads/main"}
+	result, err = repo.PushWithResult(opts)
+	if err != nil {
+		t.Fatalf("PushWithResult failed: %v", err)
+	}
+	if !result.Refs[0].OK || result.TrackingError == nil {
+		t.Fatalf("Expected the tracking branch to fail alone, got %+v", result)
+	}
+	if err := result.Err(); err != nil {
+		t.Errorf("Err() = %v, want no error for a push the remote took", err)
+	}
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// WalkRefsOptions selects the refs WalkRefs lists
+type WalkRefsOptions struct {
+	// Patterns are ref name prefixes such as refs/heads/, or glob patterns
+	// such as refs/tags/v1.* where * does not match a slash. A ref matching
+	// any of them is listed; with none, every ref is.
+	Patterns []string
+
+	// Peel also gives the object each annotated tag points to
+	Peel bool
+}
+
+// Ref is a local ref and its value
+type Ref struct {
+	// Name is the full ref name
+	Name string
+	// Hash is the object the ref resolves to
+	Hash hash.Hash
+	// Peeled is the object an annotated tag points to when peeling, after
+	// following tags of tags; nil otherwise
+	Peeled hash.Hash
+	// Target is the ref a symbolic ref points to
+	Target string
+}
+
+// WalkRefs calls fn for each ref matching the options, in name order,
+// reading each ref's value only when its turn comes. An error from fn
+// stops the walk and is returned. Refs that do not resolve are skipped,
+// like git for-each-ref does.
+func (r *Repository) WalkRefs(opts WalkRefsOptions, fn func(Ref) error) error {
+	names, err := r.ListRefs("refs/")
+	if err != nil {
+		return fmt.Errorf("failed to list refs: %w", err)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !matchRefPatterns(name, opts.Patterns) {
+			continue
+		}
+		h, err := r.ResolveRef(name)
+		if err != nil {
+			continue
+		}
+		ref := Ref{Name: name, Hash: h}
+		if target, err := r.readSymbolicRef(name); err == nil {
+			ref.Target = target
+		}
+		if opts.Peel {
+			ref.Peeled = r.peelTag(h)
+		}
+		if err := fn(ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// peelTag returns the object an annotated tag points to after following
+// tags of tags, or nil when h is not a tag
+func (r *Repository) peelTag(h hash.Hash) hash.Hash {
+	obj, err := r.ObjectDB.Get(h)
+	if err != nil {
+		return nil
+	}
+	var peeled hash.Hash
+	for {
+		tag, ok := obj.(*object.Tag)
+		if !ok {
+			return peeled
+		}
+		peeled = tag.Target
+		if obj, err = r.ObjectDB.Get(peeled); err != nil {
+			return peeled
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// TestWalkRefs tests listing refs by glob pattern with their values and
+// peeled tags, and stopping a walk early
+func TestWalkRefs(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	a := commitTestTree(t, repo, "A", map[string]string{"f": "a\n"})
+
+	putTag := func(name string, target hash.Hash, targetType object.Type) hash.Hash {
+		tag := object.NewTag()
+		tag.Target = target
+		tag.TargetType = targetType
+		tag.Name = name
+		tag.Tagger = object.Signature{Name: "Test User", Email: "test@example.com", When: time.Unix(1577836800, 0)}
+		tag.Message = name + "\n"
+		h, err := repo.ObjectDB.Put(tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	annotated := putTag("v1.1", a, object.CommitType)
+	for name, h := range map[string]hash.Hash{
+		"refs/heads/main":          a,
+		"refs/heads/feature/x":     a,
+		"refs/remotes/origin/main": a,
+		"refs/tags/v1.0":           a,
+		"refs/tags/v1.1":           annotated,
+		"refs/tags/v1.1.1":         a,
+		"refs/tags/v2.0":           putTag("v2.0", annotated, object.TagType),
+	} {
+		if err := repo.UpdateRef(name, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.SetSymbolicRef("refs/remotes/origin/HEAD", "refs/remotes/origin/main"); err != nil {
+		t.Fatal(err)
+	}
+	// A ref being updated elsewhere is not listed twice
+	if err := os.WriteFile(filepath.Join(repo.GitDir, "refs/heads/main.lock"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{pattern: "refs/tags/v1.*", want: "refs/tags/v1.0 refs/tags/v1.1 refs/tags/v1.1.1"},
+		{pattern: "refs/tags/v?.?", want: "refs/tags/v1.0 refs/tags/v1.1 refs/tags/v2.0"},
+		{pattern: "refs/heads/", want: "refs/heads/feature/x refs/heads/main"},
+		{pattern: "refs/*/main", want: "refs/heads/main"},
+		{pattern: "refs/heads/*", want: "refs/heads/main"},
+	}
+	for _, tt := range tests {
+		names, err := repo.ListRefs(tt.pattern)
+		if err != nil {
+			t.Fatalf("ListRefs failed: %v", err)
+		}
+		sort.Strings(names)
+		if got := strings.Join(names, " "); got != tt.want {
+			t.Errorf("ListRefs(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+
+	var got []string
+	err = repo.WalkRefs(WalkRefsOptions{Patterns: []string{"refs/tags/v*.?", "refs/remotes/"}, Peel: true}, func(ref Ref) error {
+		entry := ref.Name
+		if ref.Peeled != nil {
+			entry += " peeled"
+			if !ref.Peeled.Equals(a) {
+				t.Errorf("%s peels to %s, want A", ref.Name, ref.Peeled)
+			}
+		}
+		if ref.Target != "" {
+			entry += " -> " + ref.Target
+		}
+		if !ref.Hash.Equals(a) && ref.Peeled == nil {
+			t.Errorf("%s = %s, want A", ref.Name, ref.Hash)
+		}
+		got = append(got, entry)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkRefs failed: %v", err)
+	}
+	want := "refs/remotes/origin/HEAD -> refs/remotes/origin/main, refs/remotes/origin/main, refs/tags/v1.0, refs/tags/v1.1 peeled, refs/tags/v1.1.1, refs/tags/v2.0 peeled"
+	if strings.Join(got, ", ") != want {
+		t.Errorf("WalkRefs = %q, want %q", strings.Join(got, ", "), want)
+	}
+
+	stop := errors.New("stop")
+	visited := 0
+	err = repo.WalkRefs(WalkRefsOptions{}, func(ref Ref) error {
+		visited++
+		return stop
+	})
+	if err != stop || visited != 1 {
+		t.Errorf("WalkRefs stopped with %v after %d refs", err, visited)
+	}
+	if _, err := repo.ListRefs("heads/*"); err == nil {
+		t.Error("expected an error for a pattern outside refs/")
+	}
+}
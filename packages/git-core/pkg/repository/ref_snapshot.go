@@ -0,0 +1,270 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// refSnapshotVersion is the version of the ref snapshot document format
+const refSnapshotVersion = 1
+
+// RefSnapshot is a point-in-time copy of a repository's refs, serialized
+// as a single JSON document by ExportRefs and applied by ImportRefs
+type RefSnapshot struct {
+	// Version is the document format version
+	Version int `json:"version"`
+	// Head is the content of HEAD: "ref: <name>" or a commit hash
+	Head string `json:"head,omitempty"`
+	// Refs are the refs under refs/, sorted by name
+	Refs []RefSnapshotEntry `json:"refs"`
+}
+
+// RefSnapshotEntry is one ref in a RefSnapshot. Exactly one of Hash and
+// Symref is set.
+type RefSnapshotEntry struct {
+	// Name is the full ref name, e.g. refs/heads/main
+	Name string `json:"name"`
+	// Hash is the object the ref points to
+	Hash string `json:"hash,omitempty"`
+	// Symref is the ref a symbolic ref points to
+	Symref string `json:"symref,omitempty"`
+}
+
+// ImportRefsOptions contains options for ImportRefs
+type ImportRefsOptions struct {
+	// Prune deletes refs that are not in the snapshot
+	Prune bool
+	// UpdateHEAD sets HEAD from the snapshot
+	UpdateHEAD bool
+	// AllowMissing accepts refs to objects that are not stored locally
+	AllowMissing bool
+}
+
+// DefaultImportRefsOptions returns default import refs options
+func DefaultImportRefsOptions() ImportRefsOptions {
+	return ImportRefsOptions{
+		Prune:        false,
+		UpdateHEAD:   true,
+		AllowMissing: false,
+	}
+}
+
+// ImportRefsResult describes the changes made by ImportRefs
+type ImportRefsResult struct {
+	// Updated lists refs that were created or changed
+	Updated []string
+	// Deleted lists refs removed because of Prune
+	Deleted []string
+	// HeadUpdated reports whether HEAD was changed
+	HeadUpdated bool
+}
+
+// ExportRefs captures HEAD and every ref under refs/, keeping symbolic
+// refs symbolic
+func (r *Repository) ExportRefs() (*RefSnapshot, error) {
+	snapshot := &RefSnapshot{
+		Version: refSnapshotVersion,
+		Refs:    []RefSnapshotEntry{},
+	}
+
+	head, err := r.HEAD()
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Head = head
+
+	refs, err := r.ListRefs("refs/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs: %w", err)
+	}
+	sort.Strings(refs)
+
+	for _, ref := range refs {
+		content, err := r.readRef(ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ref %s: %w", ref, err)
+		}
+		value := strings.TrimSpace(string(content))
+
+		entry := RefSnapshotEntry{Name: ref}
+		if target, ok := strings.CutPrefix(value, "ref: "); ok {
+			entry.Symref = target
+		} else {
+			h, err := hash.ParseHash(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ref %s: %w", ref, err)
+			}
+			entry.Hash = h.String()
+		}
+		snapshot.Refs = append(snapshot.Refs, entry)
+	}
+
+	return snapshot, nil
+}
+
+// ImportRefs applies a snapshot, creating or updating every ref in it.
+// The snapshot is validated completely before any ref is written.
+func (r *Repository) ImportRefs(snapshot *RefSnapshot, opts ImportRefsOptions) (*ImportRefsResult, error) {
+	if err := r.validateRefSnapshot(snapshot, opts); err != nil {
+		return nil, err
+	}
+
+	result := &ImportRefsResult{
+		Updated: []string{},
+		Deleted: []string{},
+	}
+
+	wanted := make(map[string]bool, len(snapshot.Refs))
+	for _, entry := range snapshot.Refs {
+		wanted[entry.Name] = true
+
+		content := ""
+		if entry.Symref != "" {
+			content = "ref: " + entry.Symref
+		} else {
+			content = entry.Hash
+		}
+		if current, err := r.readRef(entry.Name); err == nil && strings.TrimSpace(string(current)) == content {
+			continue
+		}
+
+		if entry.Symref != "" {
+			if err := r.SetSymbolicRef(entry.Name, entry.Symref); err != nil {
+				return nil, fmt.Errorf("failed to write ref %s: %w", entry.Name, err)
+			}
+		} else {
+			h, _ := hash.ParseHash(entry.Hash)
+			if err := r.UpdateRefWithLog(entry.Name, h, "import-refs"); err != nil {
+				return nil, fmt.Errorf("failed to update ref %s: %w", entry.Name, err)
+			}
+		}
+		result.Updated = append(result.Updated, entry.Name)
+	}
+
+	if opts.Prune {
+		refs, err := r.ListRefs("refs/")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list refs: %w", err)
+		}
+		sort.Strings(refs)
+		for _, ref := range refs {
+			if wanted[ref] {
+				continue
+			}
+			if err := r.DeleteRef(ref); err != nil {
+				return nil, fmt.Errorf("failed to delete ref %s: %w", ref, err)
+			}
+			result.Deleted = append(result.Deleted, ref)
+		}
+	}
+
+	if opts.UpdateHEAD && snapshot.Head != "" {
+		if current, err := r.HEAD(); err != nil || current != snapshot.Head {
+			if err := r.SetHEAD(snapshot.Head); err != nil {
+				return nil, fmt.Errorf("failed to update HEAD: %w", err)
+			}
+			result.HeadUpdated = true
+		}
+	}
+
+	return result, nil
+}
+
+// validateRefSnapshot checks ref names, hashes and symbolic targets
+func (r *Repository) validateRefSnapshot(snapshot *RefSnapshot, opts ImportRefsOptions) error {
+	if snapshot == nil {
+		return fmt.Errorf("missing ref snapshot")
+	}
+	if snapshot.Version != refSnapshotVersion {
+		return fmt.Errorf("unsupported ref snapshot version: %d", snapshot.Version)
+	}
+
+	seen := make(map[string]bool, len(snapshot.Refs))
+	for _, entry := range snapshot.Refs {
+		if err := checkRefName(entry.Name); err != nil {
+			return err
+		}
+		if seen[entry.Name] {
+			return fmt.Errorf("duplicate ref in snapshot: %s", entry.Name)
+		}
+		seen[entry.Name] = true
+
+		switch {
+		case entry.Hash != "" && entry.Symref != "":
+			return fmt.Errorf("ref %s has both a hash and a symref", entry.Name)
+		case entry.Symref != "":
+			if err := checkRefName(entry.Symref); err != nil {
+				return fmt.Errorf("invalid symref target for %s: %w", entry.Name, err)
+			}
+		case entry.Hash != "":
+			h, err := hash.ParseHash(entry.Hash)
+			if err != nil || len(entry.Hash) != 2*r.Hasher.Size() {
+				return fmt.Errorf("invalid hash for ref %s: %q", entry.Name, entry.Hash)
+			}
+			if !opts.AllowMissing && !r.ObjectDB.Has(h) {
+				return fmt.Errorf("ref %s points to missing object %s", entry.Name, entry.Hash)
+			}
+		default:
+			return fmt.Errorf("ref %s has neither a hash nor a symref", entry.Name)
+		}
+	}
+
+	if opts.UpdateHEAD && snapshot.Head != "" {
+		if target, ok := strings.CutPrefix(snapshot.Head, "ref: "); ok {
+			if err := checkRefName(target); err != nil {
+				return fmt.Errorf("invalid HEAD: %w", err)
+			}
+		} else if _, err := hash.ParseHash(snapshot.Head); err != nil || len(snapshot.Head) != 2*r.Hasher.Size() {
+			return fmt.Errorf("invalid HEAD: %q", snapshot.Head)
+		}
+	}
+
+	return nil
+}
+
+// Marshal encodes the snapshot as an indented JSON document
+func (s *RefSnapshot) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode ref snapshot: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// ParseRefSnapshot decodes a JSON document written by RefSnapshot.Marshal
+func ParseRefSnapshot(data []byte) (*RefSnapshot, error) {
+	var snapshot RefSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse ref snapshot: %w", err)
+	}
+	if snapshot.Refs == nil {
+		snapshot.Refs = []RefSnapshotEntry{}
+	}
+	return &snapshot, nil
+}
+
+// checkRefName rejects ref names Git would not accept, including any that
+// could escape the refs directory
+func checkRefName(name string) error {
+	if !strings.HasPrefix(name, "refs/") || strings.HasSuffix(name, "/") {
+		return fmt.Errorf("invalid ref name: %q", name)
+	}
+	if strings.HasSuffix(name, ".lock") || strings.Contains(name, "..") || strings.Contains(name, "@{") {
+		return fmt.Errorf("invalid ref name: %q", name)
+	}
+	for _, component := range strings.Split(name, "/") {
+		if component == "" || strings.HasPrefix(component, ".") {
+			return fmt.Errorf("invalid ref name: %q", name)
+		}
+	}
+	for _, c := range name {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(" ~^:?*[\\", c) {
+			return fmt.Errorf("invalid ref name: %q", name)
+		}
+	}
+	return nil
+}
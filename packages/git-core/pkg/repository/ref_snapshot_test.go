@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestExportImportRefs tests a snapshot round trip into another repository
+func TestExportImportRefs(t *testing.T) {
+	source := setupLocalCloneSource(t)
+	if err := WriteFileInRepo(source.GitDir, "refs/remotes/origin/HEAD", []byte("ref: refs/remotes/origin/main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	main, _ := source.GetBranch("main")
+	if err := source.UpdateRef("refs/remotes/origin/main", main); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := source.ExportRefs()
+	if err != nil {
+		t.Fatalf("ExportRefs failed: %v", err)
+	}
+	if snapshot.Head != "ref: refs/heads/main" {
+		t.Errorf("Head = %q", snapshot.Head)
+	}
+	names := []string{}
+	for _, entry := range snapshot.Refs {
+		names = append(names, entry.Name)
+	}
+	expected := []string{"refs/heads/feature", "refs/heads/main", "refs/remotes/origin/HEAD", "refs/remotes/origin/main", "refs/tags/v1"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Refs = %v, expected %v", names, expected)
+	}
+	if snapshot.Refs[2].Symref != "refs/remotes/origin/main" || snapshot.Refs[2].Hash != "" {
+		t.Errorf("Expected origin/HEAD to stay symbolic, got %+v", snapshot.Refs[2])
+	}
+
+	data, err := snapshot.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	parsed, err := ParseRefSnapshot(data)
+	if err != nil {
+		t.Fatalf("ParseRefSnapshot failed: %v", err)
+	}
+	if !reflect.DeepEqual(parsed, snapshot) {
+		t.Errorf("Round trip changed the snapshot:\n%s", data)
+	}
+
+	// Objects are shared by pointing the target at the source's objects
+	target, err := Create(filepath.Join(t.TempDir(), "target"), DefaultInitOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	target.ObjectDB = source.ObjectDB
+	if err := target.UpdateRef("refs/heads/stale", main); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultImportRefsOptions()
+	opts.Prune = true
+	result, err := target.ImportRefs(parsed, opts)
+	if err != nil {
+		t.Fatalf("ImportRefs failed: %v", err)
+	}
+	if len(result.Updated) != 5 || !reflect.DeepEqual(result.Deleted, []string{"refs/heads/stale"}) {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	exported, err := target.ExportRefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(exported, snapshot) {
+		t.Errorf("Imported refs differ: %+v", exported)
+	}
+
+	// Importing again changes nothing
+	result, err = target.ImportRefs(parsed, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Updated) != 0 || len(result.Deleted) != 0 || result.HeadUpdated {
+		t.Errorf("Expected no changes, got %+v", result)
+	}
+}
+
+// TestImportRefsValidation tests that invalid snapshots are rejected before any write
+func TestImportRefsValidation(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "one")
+	valid := RefSnapshotEntry{Name: "refs/heads/ok", Hash: commits[0].String()}
+	missing := strings.Repeat("1", len(commits[0].String()))
+
+	tests := []struct {
+		name  string
+		entry RefSnapshotEntry
+	}{
+		{"escape", RefSnapshotEntry{Name: "refs/../../config", Hash: commits[0].String()}},
+		{"outside refs", RefSnapshotEntry{Name: "HEAD", Hash: commits[0].String()}},
+		{"bad hash", RefSnapshotEntry{Name: "refs/heads/x", Hash: "xyz"}},
+		{"missing object", RefSnapshotEntry{Name: "refs/heads/x", Hash: missing}},
+		{"both", RefSnapshotEntry{Name: "refs/heads/x", Hash: commits[0].String(), Symref: "refs/heads/main"}},
+		{"neither", RefSnapshotEntry{Name: "refs/heads/x"}},
+		{"bad symref", RefSnapshotEntry{Name: "refs/heads/x", Symref: "refs/heads/a b"}},
+	}
+
+	for _, tt := range tests {
+		snapshot := &RefSnapshot{Version: 1, Refs: []RefSnapshotEntry{valid, tt.entry}}
+		if _, err := repo.ImportRefs(snapshot, DefaultImportRefsOptions()); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(repo.GitDir, "refs", "heads", "ok")); err == nil {
+		t.Error("No ref should be written when validation fails")
+	}
+
+	if _, err := repo.ImportRefs(&RefSnapshot{Version: 2}, DefaultImportRefsOptions()); err == nil {
+		t.Error("Expected an error for an unknown version")
+	}
+
+	opts := DefaultImportRefsOptions()
+	opts.AllowMissing = true
+	snapshot := &RefSnapshot{Version: 1, Head: "ref: refs/heads/fixture", Refs: []RefSnapshotEntry{{Name: "refs/heads/fixture", Hash: missing}}}
+	if _, err := repo.ImportRefs(snapshot, opts); err != nil {
+		t.Fatalf("ImportRefs with AllowMissing failed: %v", err)
+	}
+	if branch, _ := repo.CurrentBranch(); branch != "fixture" {
+		t.Errorf("Expected HEAD on fixture, got %q", branch)
+	}
+}
@@ -0,0 +1,366 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// RefTransaction queues ref updates and applies them all or none, like
+// git update-ref --stdin. Commit takes a .lock file next to each ref, so
+// a ref another tab or worker is updating is left alone, and checks the
+// expected old values before anything is written.
+type RefTransaction struct {
+	repo    *Repository
+	updates []*refTxUpdate
+	closed  bool
+}
+
+// refTxUpdate is a queued ref update
+type refTxUpdate struct {
+	name string
+	// new is the value to set, or nil to delete the ref
+	new hash.Hash
+	// old is the value the ref must have, the zero hash when it must not
+	// exist, or nil for any value
+	old     hash.Hash
+	verify  bool
+	message string
+	// symref makes the ref a symbolic ref pointing to it
+	symref string
+	// noDeref updates a symbolic ref itself rather than the ref it points to
+	noDeref bool
+
+	// lock is the path of the lock file once taken, current the value the
+	// ref had then and previous its content, to restore on failure
+	lock     string
+	current  hash.Hash
+	previous []byte
+}
+
+// BeginRefTx starts a ref transaction
+func (r *Repository) BeginRefTx() *RefTransaction {
+	return &RefTransaction{repo: r}
+}
+
+// Update queues setting ref to newHash. When oldHash is not nil the ref
+// must have that value, or not exist when it is the zero hash. The update
+// is recorded in the reflog when message is not empty. HEAD updates the
+// branch it points at, or HEAD itself when it is detached.
+func (tx *RefTransaction) Update(ref string, newHash, oldHash hash.Hash, message string) error {
+	if newHash == nil {
+		return fmt.Errorf("missing new value for ref %s", ref)
+	}
+	return tx.queue(&refTxUpdate{name: ref, new: newHash, old: oldHash, message: message})
+}
+
+// Create queues creating ref at newHash, failing if it already exists
+func (tx *RefTransaction) Create(ref string, newHash hash.Hash, message string) error {
+	return tx.Update(ref, newHash, hash.ZeroHash(tx.repo.Hasher.Algorithm()), message)
+}
+
+// Delete queues deleting ref, which must have oldHash unless it is nil
+func (tx *RefTransaction) Delete(ref string, oldHash hash.Hash) error {
+	return tx.queue(&refTxUpdate{name: ref, old: oldHash})
+}
+
+// Verify queues a check that ref has oldHash, or does not exist when it
+// is the zero hash, without changing it
+func (tx *RefTransaction) Verify(ref string, oldHash hash.Hash) error {
+	if oldHash == nil {
+		return fmt.Errorf("missing value to verify for ref %s", ref)
+	}
+	return tx.queue(&refTxUpdate{name: ref, old: oldHash, verify: true})
+}
+
+// queue adds an update, allowing each ref once per transaction
+func (tx *RefTransaction) queue(update *refTxUpdate) error {
+	if tx.closed {
+		return fmt.Errorf("ref transaction is closed")
+	}
+	if update.name != "HEAD" {
+		if err := checkRefName(update.name); err != nil {
+			return err
+		}
+	}
+	for _, queued := range tx.updates {
+		if queued.name == update.name {
+			return fmt.Errorf("multiple updates for ref %s not allowed", update.name)
+		}
+	}
+	tx.updates = append(tx.updates, update)
+	return nil
+}
+
+// Abort drops the queued updates
+func (tx *RefTransaction) Abort() {
+	tx.closed = true
+	tx.updates = nil
+}
+
+// Commit locks every ref, checks the old values and applies the updates.
+// When a check fails or a ref is locked nothing changes. A failure while
+// writing restores the refs already written.
+func (tx *RefTransaction) Commit() error {
+	if tx.closed {
+		return fmt.Errorf("ref transaction is closed")
+	}
+	tx.closed = true
+	r := tx.repo
+
+	// Symbolic refs such as HEAD stand for the ref they point at
+	head, _ := r.HEAD()
+	for _, update := range tx.updates {
+		if update.symref != "" || update.noDeref {
+			continue
+		}
+		target, err := r.followSymbolicRefs(update.name)
+		if err != nil {
+			return err
+		}
+		update.name = target
+	}
+	// Locks are taken in name order, so transactions wait on each other
+	// the same way
+	sort.SliceStable(tx.updates, func(i, j int) bool { return tx.updates[i].name < tx.updates[j].name })
+	for i := 1; i < len(tx.updates); i++ {
+		if tx.updates[i].name == tx.updates[i-1].name {
+			return fmt.Errorf("multiple updates for ref %s not allowed", tx.updates[i].name)
+		}
+	}
+
+	defer tx.unlock()
+	for _, update := range tx.updates {
+		if err := tx.lock(update); err != nil {
+			return err
+		}
+	}
+
+	// Apply, remembering what to restore if a later write fails
+	var applied []*refTxUpdate
+	for _, update := range tx.updates {
+		if update.verify {
+			continue
+		}
+		if err := tx.apply(update); err != nil {
+			for i := len(applied) - 1; i >= 0; i-- {
+				tx.restore(applied[i])
+			}
+			return err
+		}
+		applied = append(applied, update)
+	}
+
+	for _, update := range applied {
+		if update.new == nil || update.message == "" {
+			continue
+		}
+		if err := r.appendReflog(update.name, update.current, update.new, update.message); err != nil {
+			return err
+		}
+		if update.name != "HEAD" && head == "ref: "+update.name {
+			if err := r.appendReflog("HEAD", update.current, update.new, update.message); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lock takes the lock file of a ref and checks its old value
+func (tx *RefTransaction) lock(update *refTxUpdate) error {
+	path := tx.repo.refPath(update.name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to lock ref %s: %w", update.name, err)
+	}
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("unable to lock ref %s: %s.lock exists; another process may be updating it", update.name, update.name)
+		}
+		return fmt.Errorf("failed to lock ref %s: %w", update.name, err)
+	}
+	update.lock = path + ".lock"
+
+	switch {
+	case update.symref != "":
+		_, err = f.WriteString("ref: " + tx.repo.storedRefName(update.symref) + "\n")
+	case update.new != nil:
+		_, err = f.WriteString(update.new.String() + "\n")
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write ref %s: %w", update.name, err)
+	}
+
+	previous, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read ref %s: %w", update.name, err)
+	}
+	update.previous = previous
+	if update.symref != "" || update.noDeref {
+		return nil
+	}
+
+	current, err := tx.repo.readRefValue(update.name)
+	if err != nil {
+		return err
+	}
+	update.current = current
+	if update.old == nil {
+		return nil
+	}
+	switch {
+	case update.old.IsZero() && current != nil:
+		return fmt.Errorf("ref %s already exists", update.name)
+	case !update.old.IsZero() && current == nil:
+		return fmt.Errorf("ref %s does not exist, expected %s", update.name, update.old.String())
+	case !update.old.IsZero() && !current.Equals(update.old):
+		return fmt.Errorf("ref %s is at %s, expected %s", update.name, current.String(), update.old.String())
+	}
+	return nil
+}
+
+// apply moves a locked update into place
+func (tx *RefTransaction) apply(update *refTxUpdate) error {
+	path := strings.TrimSuffix(update.lock, ".lock")
+	if update.new == nil && update.symref == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete ref %s: %w", update.name, err)
+		}
+		return nil
+	}
+	if err := os.Rename(update.lock, path); err != nil {
+		return fmt.Errorf("failed to update ref %s: %w", update.name, err)
+	}
+	update.lock = ""
+	return nil
+}
+
+// restore puts back the value an applied update replaced
+func (tx *RefTransaction) restore(update *refTxUpdate) {
+	path := tx.repo.refPath(update.name)
+	if update.previous == nil {
+		os.Remove(path)
+		return
+	}
+	writeFile(path, update.previous, 0644)
+}
+
+// unlock removes the lock files still held
+func (tx *RefTransaction) unlock() {
+	for _, update := range tx.updates {
+		if update.lock != "" {
+			os.Remove(update.lock)
+			update.lock = ""
+		}
+	}
+}
+
+// readRefValue returns the hash a ref file holds, or nil when the ref does
+// not exist
+func (r *Repository) readRefValue(name string) (hash.Hash, error) {
+	content, err := r.readRef(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read ref %s: %w", name, err)
+	}
+	value := strings.TrimSpace(string(content))
+	if strings.HasPrefix(value, "ref: ") {
+		return nil, fmt.Errorf("ref %s is a symbolic ref", name)
+	}
+	h, err := hash.ParseHash(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ref %s: %w", name, err)
+	}
+	return h, nil
+}
+
+// RefUpdateError lists the refs a non-atomic UpdateRefs left as they were
+type RefUpdateError struct {
+	// Failed maps each ref that was not updated to the reason
+	Failed map[string]error
+}
+
+func (e *RefUpdateError) Error() string {
+	names := make([]string, 0, len(e.Failed))
+	for name := range e.Failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	reasons := make([]string, 0, len(names))
+	for _, name := range names {
+		reasons = append(reasons, e.Failed[name].Error())
+	}
+	return "failed to update refs: " + strings.Join(reasons, "; ")
+}
+
+// UpdateRefs applies several ref updates. Each sets RefName to NewHash, or
+// deletes the ref when NewHash is empty or the zero hash, provided the ref
+// has OldHash; an empty OldHash skips the check and the zero hash requires
+// that the ref does not exist. When atomic, the updates go through one
+// transaction and either all are applied or none is. Otherwise each is
+// applied on its own, and a *RefUpdateError lists the ones that failed.
+func (r *Repository) UpdateRefs(updates []RefUpdate, atomic bool) error {
+	if atomic {
+		tx := r.BeginRefTx()
+		for _, update := range updates {
+			if err := tx.queueRefUpdate(update); err != nil {
+				tx.Abort()
+				return err
+			}
+		}
+		return tx.Commit()
+	}
+
+	failed := make(map[string]error)
+	for _, update := range updates {
+		tx := r.BeginRefTx()
+		err := tx.queueRefUpdate(update)
+		if err == nil {
+			err = tx.Commit()
+		} else {
+			tx.Abort()
+		}
+		if err != nil {
+			failed[update.RefName] = err
+		}
+	}
+	if len(failed) > 0 {
+		return &RefUpdateError{Failed: failed}
+	}
+	return nil
+}
+
+// queueRefUpdate queues a RefUpdate given with hex hashes
+func (tx *RefTransaction) queueRefUpdate(update RefUpdate) error {
+	var oldHash hash.Hash
+	if update.OldHash != "" {
+		h, err := hash.ParseHash(update.OldHash)
+		if err != nil {
+			return fmt.Errorf("invalid old hash for ref %s: %w", update.RefName, err)
+		}
+		oldHash = h
+	}
+
+	if update.NewHash == "" {
+		return tx.Delete(update.RefName, oldHash)
+	}
+	newHash, err := hash.ParseHash(update.NewHash)
+	if err != nil {
+		return fmt.Errorf("invalid new hash for ref %s: %w", update.RefName, err)
+	}
+	if newHash.IsZero() {
+		return tx.Delete(update.RefName, oldHash)
+	}
+	return tx.Update(update.RefName, newHash, oldHash, "")
+}
@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// TestRefTransaction tests that queued updates are applied together, with
+// reflog entries, and that HEAD stands for its branch
+func TestRefTransaction(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	a := commitTestTree(t, repo, "A", map[string]string{"f": "a\n"})
+	b := commitTestTree(t, repo, "B", map[string]string{"f": "b\n"}, a)
+	if err := repo.UpdateRef("refs/heads/main", a); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateRef("refs/heads/old", a); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := repo.BeginRefTx()
+	for _, err := range []error{
+		tx.Update("HEAD", b, a, "commit: B"),
+		tx.Create("refs/heads/topic", a, "branch: Created from A"),
+		tx.Delete("refs/heads/old", a),
+		tx.Verify("refs/tags/none", hash.ZeroHash(repo.Hasher.Algorithm())),
+	} {
+		if err != nil {
+			t.Fatalf("queueing failed: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	if h, err := repo.GetBranch("main"); err != nil || !h.Equals(b) {
+		t.Errorf("main = %v, %v, want B", h, err)
+	}
+	if h, err := repo.GetBranch("topic"); err != nil || !h.Equals(a) {
+		t.Errorf("topic = %v, %v, want A", h, err)
+	}
+	if repo.BranchExists("old") {
+		t.Error("old was not deleted")
+	}
+	for _, ref := range []string{"HEAD", "refs/heads/main"} {
+		entries, err := repo.Reflog(ref)
+		if err != nil || len(entries) != 1 || entries[0].Message != "commit: B" || !entries[0].Old.Equals(a) {
+			t.Errorf("reflog of %s = %+v, %v", ref, entries, err)
+		}
+	}
+
+	if err := tx.Commit(); err == nil {
+		t.Error("expected an error committing a transaction twice")
+	}
+	if err := repo.BeginRefTx().Update("refs/heads/../x", a, nil, ""); err == nil {
+		t.Error("expected an error for an invalid ref name")
+	}
+}
+
+// TestRefTransactionFailure tests that a failed check or a held lock
+// leaves every ref as it was
+func TestRefTransactionFailure(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	a := commitTestTree(t, repo, "A", map[string]string{"f": "a\n"})
+	b := commitTestTree(t, repo, "B", map[string]string{"f": "b\n"}, a)
+	if err := repo.UpdateRef("refs/heads/main", a); err != nil {
+		t.Fatal(err)
+	}
+
+	unchanged := func() {
+		t.Helper()
+		if h, err := repo.GetBranch("main"); err != nil || !h.Equals(a) {
+			t.Errorf("main = %v, %v, want A", h, err)
+		}
+		if repo.BranchExists("topic") {
+			t.Error("topic was created")
+		}
+		if _, err := os.Stat(filepath.Join(repo.GitDir, "refs/heads/main.lock")); err == nil {
+			t.Error("lock file left behind")
+		}
+	}
+
+	tests := []struct {
+		name  string
+		old   hash.Hash
+		topic hash.Hash
+		want  string
+	}{
+		{name: "stale old value", old: b, want: "is at"},
+		{name: "created twice", old: a, topic: a, want: "already exists"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.topic != nil {
+				if err := repo.UpdateRef("refs/heads/topic", tt.topic); err != nil {
+					t.Fatal(err)
+				}
+				defer repo.DeleteRef("refs/heads/topic")
+			}
+			tx := repo.BeginRefTx()
+			if err := tx.Update("refs/heads/main", b, tt.old, "update"); err != nil {
+				t.Fatal(err)
+			}
+			if err := tx.Create("refs/heads/topic", b, "create"); err != nil {
+				t.Fatal(err)
+			}
+			err := tx.Commit()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Commit error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+	unchanged()
+
+	// A lock held by someone else is left alone
+	lock := filepath.Join(repo.GitDir, "refs/heads/topic.lock")
+	if err := os.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tx := repo.BeginRefTx()
+	tx.Update("refs/heads/main", b, a, "update")
+	tx.Create("refs/heads/topic", b, "create")
+	if err := tx.Commit(); err == nil || !strings.Contains(err.Error(), "unable to lock") {
+		t.Fatalf("Commit error = %v, want a lock error", err)
+	}
+	if _, err := os.Stat(lock); err != nil {
+		t.Error("the other lock was removed")
+	}
+	if err := repo.UpdateRef("refs/heads/topic", b); err == nil {
+		t.Error("expected UpdateRef to fail while the ref is locked")
+	}
+	os.Remove(lock)
+	unchanged()
+}
+
+// TestUpdateRefs tests applying ref updates all or none, and one by one
+func TestUpdateRefs(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	a := commitTestTree(t, repo, "A", map[string]string{"f": "a\n"})
+	b := commitTestTree(t, repo, "B", map[string]string{"f": "b\n"}, a)
+	for _, ref := range []string{"refs/heads/main", "refs/heads/old", "refs/remotes/origin/main"} {
+		if err := repo.UpdateRef(ref, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zero := hash.ZeroHash(repo.Hasher.Algorithm()).String()
+
+	// A stale old value fails the whole atomic update
+	updates := []RefUpdate{
+		{RefName: "refs/heads/main", OldHash: a.String(), NewHash: b.String()},
+		{RefName: "refs/heads/old", NewHash: zero},
+		{RefName: "refs/remotes/origin/main", OldHash: b.String(), NewHash: b.String()},
+	}
+	if err := repo.UpdateRefs(updates, true); err == nil {
+		t.Fatal("expected an error for a stale old value")
+	}
+	for _, ref := range []string{"refs/heads/main", "refs/heads/old", "refs/remotes/origin/main"} {
+		if h, err := repo.ResolveRef(ref); err != nil || !h.Equals(a) {
+			t.Errorf("%s = %v, %v after a failed atomic update, want A", ref, h, err)
+		}
+	}
+
+	// Without atomic the others are applied and the failure reported
+	err = repo.UpdateRefs(updates, false)
+	var updateErr *RefUpdateError
+	if !errors.As(err, &updateErr) || len(updateErr.Failed) != 1 || updateErr.Failed["refs/remotes/origin/main"] == nil {
+		t.Fatalf("UpdateRefs = %v, want only origin/main to fail", err)
+	}
+	if h, err := repo.GetBranch("main"); err != nil || !h.Equals(b) {
+		t.Errorf("main = %v, %v, want B", h, err)
+	}
+	if repo.BranchExists("old") {
+		t.Error("old was not deleted")
+	}
+
+	updates = []RefUpdate{
+		{RefName: "refs/remotes/origin/main", OldHash: a.String(), NewHash: b.String()},
+		{RefName: "refs/tags/v1", OldHash: zero, NewHash: a.String()},
+	}
+	if err := repo.UpdateRefs(updates, true); err != nil {
+		t.Fatalf("UpdateRefs failed: %v", err)
+	}
+	if h, err := repo.ResolveRef("refs/tags/v1"); err != nil || !h.Equals(a) {
+		t.Errorf("v1 = %v, %v, want A", h, err)
+	}
+	if err := repo.UpdateRefs([]RefUpdate{{RefName: "refs/tags/v1", OldHash: zero, NewHash: b.String()}}, true); err == nil {
+		t.Error("expected an error creating a ref that exists")
+	}
+}
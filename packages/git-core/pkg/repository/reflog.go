@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// ReflogEntry is one recorded movement of a ref
+type ReflogEntry struct {
+	// Old is the previous value of the ref (zero when the ref was created)
+	Old hash.Hash
+	// New is the value the ref was set to
+	New hash.Hash
+	// Committer is who moved the ref, and when
+	Committer object.Signature
+	// Message describes the operation, e.g. "commit: Add file"
+	Message string
+}
+
+// Reflog returns the reflog of a ref ("HEAD" or a full ref name), newest
+// entry first. A ref without a reflog has no entries.
+func (r *Repository) Reflog(ref string) ([]ReflogEntry, error) {
+	data, err := os.ReadFile(r.reflogPath(ref))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []ReflogEntry{}, nil
+		}
+		return nil, fmt.Errorf("failed to read reflog: %w", err)
+	}
+
+	entries := []ReflogEntry{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		entry, err := parseReflogLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reflog entry for %s: %w", ref, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	// Reflogs are appended to, so reverse for newest first
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	return entries, nil
+}
+
+// UpdateRefWithLog updates a ref and records the move in its reflog, and
+// in the HEAD reflog if HEAD points at the ref
+func (r *Repository) UpdateRefWithLog(ref string, h hash.Hash, message string) error {
+	tx := r.BeginRefTx()
+	if err := tx.Update(ref, h, nil, message); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateHEAD moves the current branch, or HEAD itself when detached, to a
+// commit and records the move in the reflog
+func (r *Repository) UpdateHEAD(h hash.Hash, message string) error {
+	return r.UpdateRefWithLog("HEAD", h, message)
+}
+
+// appendReflog appends an entry to a ref's reflog
+func (r *Repository) appendReflog(ref string, old, new hash.Hash, message string) error {
+	if old == nil {
+		old = hash.ZeroHash(r.Hasher.Algorithm())
+	}
+
+	name, email := r.Config.GetUser()
+	committer := object.Signature{Name: name, Email: email, When: time.Now()}
+
+	// Reflog messages are single lines
+	message = strings.ReplaceAll(strings.TrimSpace(message), "\n", " ")
+	line := fmt.Sprintf("%s %s %s\t%s\n", old.String(), new.String(), committer.Format(), message)
+
+	path := r.reflogPath(ref)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create reflog directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open reflog: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(line); err != nil {
+		return fmt.Errorf("failed to write reflog: %w", err)
+	}
+
+	return nil
+}
+
+// writeOrigHead records the commit HEAD pointed at before a ref-moving
+// operation, so the operation can be undone
+func (r *Repository) writeOrigHead(h hash.Hash) error {
+	if err := os.WriteFile(filepath.Join(r.GitDir, "ORIG_HEAD"), []byte(h.String()+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write ORIG_HEAD: %w", err)
+	}
+	return nil
+}
+
+// reflogPath returns the reflog file for a ref
+func (r *Repository) reflogPath(ref string) string {
+	return filepath.Join(r.GitDir, "logs", filepath.FromSlash(r.storedRefName(ref)))
+}
+
+// parseReflogLine parses "<old> <new> <committer>\t<message>"
+func parseReflogLine(line string) (ReflogEntry, error) {
+	header, message, _ := strings.Cut(line, "\t")
+
+	fields := strings.SplitN(header, " ", 3)
+	if len(fields) < 3 {
+		return ReflogEntry{}, fmt.Errorf("malformed line %q", line)
+	}
+
+	old, err := hash.ParseHash(fields[0])
+	if err != nil {
+		return ReflogEntry{}, fmt.Errorf("invalid old hash: %w", err)
+	}
+	new, err := hash.ParseHash(fields[1])
+	if err != nil {
+		return ReflogEntry{}, fmt.Errorf("invalid new hash: %w", err)
+	}
+	committer, err := object.ParseSignature(fields[2])
+	if err != nil {
+		return ReflogEntry{}, fmt.Errorf("invalid committer: %w", err)
+	}
+
+	return ReflogEntry{Old: old, New: new, Committer: committer, Message: message}, nil
+}
+
+// commitReflogMessage returns the reflog message for a new commit
+func commitReflogMessage(kind string, message string) string {
+	subject, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	return kind + ": " + subject
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+// RemoteDefaultBranch returns the name of a remote's default branch, such
+// as "main", as clone and fetch recorded it in refs/remotes/<remote>/HEAD.
+// The remote is not contacted.
+func (r *Repository) RemoteDefaultBranch(remote string) (string, error) {
+	target, err := r.SymbolicRef(remoteHEADRef(remote))
+	if err != nil {
+		return "", fmt.Errorf("no default branch recorded for remote %s", remote)
+	}
+	branch, ok := strings.CutPrefix(target, "refs/remotes/"+remote+"/")
+	if !ok {
+		return "", fmt.Errorf("%s points outside remote %s: %s", remoteHEADRef(remote), remote, target)
+	}
+	return branch, nil
+}
+
+// recordRemoteHEAD points refs/remotes/<remote>/HEAD at the tracking branch
+// of the branch the remote advertises as its HEAD, when that branch is
+// tracked. A remote that does not advertise HEAD as a symref leaves the
+// recorded one as it is.
+func (r *Repository) recordRemoteHEAD(discovery *protocol.DiscoveryResponse, remote string) error {
+	head, ok := discovery.SymRefs["HEAD"]
+	if !ok {
+		return nil
+	}
+	branch, ok := strings.CutPrefix(head, "refs/heads/")
+	if !ok {
+		return nil
+	}
+	return r.setRemoteHEAD(remote, branch)
+}
+
+// setRemoteHEAD points refs/remotes/<remote>/HEAD at the tracking branch
+// of branch, if there is one
+func (r *Repository) setRemoteHEAD(remote, branch string) error {
+	target := "refs/remotes/" + remote + "/" + branch
+	if _, err := r.ResolveRef(target); err != nil {
+		return nil
+	}
+	if current, err := r.SymbolicRef(remoteHEADRef(remote)); err == nil && current == target {
+		return nil
+	}
+	if err := r.SetSymbolicRef(remoteHEADRef(remote), target); err != nil {
+		return fmt.Errorf("failed to record the default branch of %s: %w", remote, err)
+	}
+	return nil
+}
+
+// remoteHEADRef is the symbolic ref naming a remote's default branch
+func remoteHEADRef(remote string) string {
+	return "refs/remotes/" + remote + "/HEAD"
+}
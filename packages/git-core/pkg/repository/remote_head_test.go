@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
+)
+
+// TestRemoteDefaultBranch tests that a clone records the remote's default
+// branch and that fetch keeps it in step with the remote's HEAD
+func TestRemoteDefaultBranch(t *testing.T) {
+	source := setupLocalCloneSource(t)
+	repo, err := Clone(source.Path, filepath.Join(t.TempDir(), "clone"), DefaultCloneOptions())
+	if err != nil {
+		t.Fatalf("Local clone failed: %v", err)
+	}
+
+	if branch, err := repo.RemoteDefaultBranch("origin"); err != nil || branch != "main" {
+		t.Errorf("RemoteDefaultBranch = %q, %v, want main", branch, err)
+	}
+	if _, err := repo.RemoteDefaultBranch("upstream"); err == nil {
+		t.Error("expected an error for a remote without a recorded default branch")
+	}
+
+	feature, err := source.GetBranch("feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	discovery := &protocol.DiscoveryResponse{
+		SymRefs:    map[string]string{"HEAD": "refs/heads/feature"},
+		References: []protocol.Reference{{Name: "refs/heads/feature", Hash: feature.String()}},
+	}
+	if err := repo.recordRemoteHEAD(discovery, "origin"); err != nil {
+		t.Fatalf("recordRemoteHEAD failed: %v", err)
+	}
+	if branch, err := repo.RemoteDefaultBranch("origin"); err != nil || branch != "feature" {
+		t.Errorf("RemoteDefaultBranch = %q, %v, want feature", branch, err)
+	}
+
+	// Pruning keeps <remote>/HEAD while its branch is there
+	pruned, err := repo.pruneRemoteRefs(discovery, "origin")
+	if err != nil {
+		t.Fatalf("pruneRemoteRefs failed: %v", err)
+	}
+	if len(pruned) != 1 || pruned[0] != "refs/remotes/origin/main" {
+		t.Errorf("pruned = %v, want only origin/main", pruned)
+	}
+	if branch, err := repo.RemoteDefaultBranch("origin"); err != nil || branch != "feature" {
+		t.Errorf("RemoteDefaultBranch after pruning = %q, %v, want feature", branch, err)
+	}
+
+	discovery.References = nil
+	pruned, err = repo.pruneRemoteRefs(discovery, "origin")
+	if err != nil {
+		t.Fatalf("pruneRemoteRefs failed: %v", err)
+	}
+	if len(pruned) != 2 || pruned[1] != "refs/remotes/origin/HEAD" {
+		t.Errorf("pruned = %v, want origin/feature and origin/HEAD", pruned)
+	}
+}
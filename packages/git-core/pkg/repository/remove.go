@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+)
+
+// RemoveOptions contains options for Remove
+type RemoveOptions struct {
+	// Cached only removes paths from the index and keeps the worktree
+	// files (git rm --cached)
+	Cached bool
+	// Force skips the checks that protect uncommitted changes
+	Force bool
+	// Recursive allows removing directories (git rm -r)
+	Recursive bool
+	// IgnoreUnmatch succeeds when a path matches nothing in the index
+	IgnoreUnmatch bool
+	// DryRun only reports what would be removed
+	DryRun bool
+}
+
+// DefaultRemoveOptions returns default remove options
+func DefaultRemoveOptions() RemoveOptions {
+	return RemoveOptions{
+		Cached:        false,
+		Force:         false,
+		Recursive:     false,
+		IgnoreUnmatch: false,
+		DryRun:        false,
+	}
+}
+
+// RemoveResult describes what Remove removed
+type RemoveResult struct {
+	// Removed lists the index paths that were removed, or would be in a
+	// dry run
+	Removed []string
+}
+
+// Remove removes paths from the index and, unless Cached is set, from the
+// worktree, like git rm. Without Force it refuses to remove files whose
+// staged or unstaged changes would be lost, and removes nothing at all if
+// any path fails the check.
+func (r *Repository) Remove(paths []string, opts RemoveOptions) (*RemoveResult, error) {
+	if r.IsBare() {
+		return nil, fmt.Errorf("cannot remove files in a bare repository")
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no paths specified")
+	}
+
+	indexPath := filepath.Join(r.GitDir, "index")
+	idx, err := index.Load(indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+
+	matched := make(map[string]bool)
+	for _, p := range paths {
+		p = strings.Trim(path.Clean(filepath.ToSlash(p)), "/")
+		found := false
+		for _, entry := range idx.Entries {
+			if entry.Path == p {
+				matched[entry.Path] = true
+				found = true
+			} else if p == "." || strings.HasPrefix(entry.Path, p+"/") {
+				if !opts.Recursive {
+					return nil, fmt.Errorf("not removing '%s' recursively without Recursive", p)
+				}
+				matched[entry.Path] = true
+				found = true
+			}
+		}
+		if !found && !opts.IgnoreUnmatch {
+			return nil, fmt.Errorf("pathspec '%s' did not match any files", p)
+		}
+	}
+
+	removed := make([]string, 0, len(matched))
+	for p := range matched {
+		removed = append(removed, p)
+	}
+	sort.Strings(removed)
+
+	if !opts.Force {
+		if err := r.checkRemovable(idx, removed, opts.Cached); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.DryRun {
+		return &RemoveResult{Removed: removed}, nil
+	}
+
+	workTree := r.WorkTree()
+	for _, p := range removed {
+		idx.RemoveEntry(p)
+		if opts.Cached {
+			continue
+		}
+		fullPath := filepath.Join(workTree, filepath.FromSlash(p))
+		if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove %s: %w", p, err)
+		}
+		removeEmptyParents(workTree, filepath.Dir(fullPath))
+	}
+
+	if err := idx.Save(indexPath); err != nil {
+		return nil, fmt.Errorf("failed to save index: %w", err)
+	}
+
+	return &RemoveResult{Removed: removed}, nil
+}
+
+// checkRemovable refuses to remove files whose changes would be lost. The
+// index may only differ from HEAD if the file is kept, and the worktree
+// may only differ from the index if the file is kept and the index still
+// matches HEAD, so the content survives somewhere.
+func (r *Repository) checkRemovable(idx *index.Index, paths []string, cached bool) error {
+	headFiles, err := r.headTreeFiles()
+	if err != nil {
+		return err
+	}
+
+	var staged, modified, both []string
+	for _, p := range paths {
+		entry, _ := idx.GetEntry(p)
+		headFile, inHead := headFiles[p]
+		stagedChange := !inHead || !headFile.hash.Equals(entry.Hash)
+
+		localChange := false
+		if _, err := os.Lstat(filepath.Join(r.WorkTree(), filepath.FromSlash(p))); err == nil {
+			localChange, err = entry.IsModified(r.WorkTree())
+			if err != nil {
+				return fmt.Errorf("failed to check %s: %w", p, err)
+			}
+		}
+
+		switch {
+		case stagedChange && localChange:
+			both = append(both, p)
+		case cached:
+		case stagedChange:
+			staged = append(staged, p)
+		case localChange:
+			modified = append(modified, p)
+		}
+	}
+
+	switch {
+	case len(both) > 0:
+		return fmt.Errorf("the following files have staged content different from both the file and HEAD: %s (use Force to remove anyway)", strings.Join(both, ", "))
+	case len(staged) > 0:
+		return fmt.Errorf("the following files have changes staged in the index: %s (use Cached to keep the files, or Force to remove anyway)", strings.Join(staged, ", "))
+	case len(modified) > 0:
+		return fmt.Errorf("the following files have local modifications: %s (use Cached to keep the files, or Force to remove anyway)", strings.Join(modified, ", "))
+	}
+	return nil
+}
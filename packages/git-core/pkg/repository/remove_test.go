@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+)
+
+// TestRemove tests removing files from the index and worktree and the
+// checks that protect uncommitted changes
+func TestRemove(t *testing.T) {
+	repo, _ := setupUndoRepo(t, "one")
+
+	write := func(rel, content string) {
+		t.Helper()
+		full := filepath.Join(repo.Path, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(rel string) bool {
+		_, err := os.Stat(filepath.Join(repo.Path, filepath.FromSlash(rel)))
+		return err == nil
+	}
+	inIndex := func(rel string) bool {
+		idx, err := index.Load(filepath.Join(repo.GitDir, "index"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return idx.HasEntry(rel)
+	}
+
+	for _, rel := range []string{"staged.txt", "modified.txt", "dir/a.txt", "dir/sub/b.txt"} {
+		write(rel, "original\n")
+		if err := addFile(repo, rel); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := createCommit(repo, "Add files"); err != nil {
+		t.Fatal(err)
+	}
+
+	write("staged.txt", "staged\n")
+	if err := addFile(repo, "staged.txt"); err != nil {
+		t.Fatal(err)
+	}
+	write("modified.txt", "modified\n")
+
+	// A committed, unmodified file is removed from both
+	result, err := repo.Remove([]string{"file.txt"}, DefaultRemoveOptions())
+	if err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if !reflect.DeepEqual(result.Removed, []string{"file.txt"}) || exists("file.txt") || inIndex("file.txt") {
+		t.Errorf("file.txt not removed: %v", result.Removed)
+	}
+
+	// Changes that would be lost are refused without Force
+	for _, rel := range []string{"staged.txt", "modified.txt"} {
+		if _, err := repo.Remove([]string{rel}, DefaultRemoveOptions()); err == nil || !strings.Contains(err.Error(), rel) {
+			t.Errorf("Expected %s to be refused, got %v", rel, err)
+		}
+		if !exists(rel) || !inIndex(rel) {
+			t.Errorf("%s should be untouched after a refused remove", rel)
+		}
+	}
+
+	// A refused path keeps the whole remove from happening
+	if _, err := repo.Remove([]string{"dir/a.txt", "modified.txt"}, DefaultRemoveOptions()); err == nil {
+		t.Error("Expected the remove to be refused")
+	}
+	if !inIndex("dir/a.txt") {
+		t.Error("dir/a.txt should be untouched after a refused remove")
+	}
+
+	// Cached keeps the file, so staged content is not lost
+	opts := DefaultRemoveOptions()
+	opts.Cached = true
+	if _, err := repo.Remove([]string{"staged.txt"}, opts); err != nil {
+		t.Fatalf("Remove --cached failed: %v", err)
+	}
+	if !exists("staged.txt") || inIndex("staged.txt") {
+		t.Error("staged.txt should only be removed from the index")
+	}
+
+	opts = DefaultRemoveOptions()
+	opts.Force = true
+	if _, err := repo.Remove([]string{"modified.txt"}, opts); err != nil {
+		t.Fatalf("Remove --force failed: %v", err)
+	}
+	if exists("modified.txt") || inIndex("modified.txt") {
+		t.Error("modified.txt should be removed with Force")
+	}
+
+	// Directories need Recursive
+	if _, err := repo.Remove([]string{"dir"}, DefaultRemoveOptions()); err == nil {
+		t.Error("Expected a directory to need Recursive")
+	}
+	opts = DefaultRemoveOptions()
+	opts.Recursive = true
+	opts.DryRun = true
+	result, err = repo.Remove([]string{"dir/"}, opts)
+	if err != nil {
+		t.Fatalf("Remove -r --dry-run failed: %v", err)
+	}
+	if !reflect.DeepEqual(result.Removed, []string{"dir/a.txt", "dir/sub/b.txt"}) || !exists("dir/sub/b.txt") {
+		t.Errorf("Unexpected dry run result %v", result.Removed)
+	}
+	opts.DryRun = false
+	if _, err := repo.Remove([]string{"dir"}, opts); err != nil {
+		t.Fatalf("Remove -r failed: %v", err)
+	}
+	if exists("dir") || inIndex("dir/sub/b.txt") {
+		t.Error("dir should be removed along with its empty subdirectories")
+	}
+
+	// Unmatched paths
+	if _, err := repo.Remove([]string{"missing.txt"}, DefaultRemoveOptions()); err == nil {
+		t.Error("Expected an error for an unmatched path")
+	}
+	opts = DefaultRemoveOptions()
+	opts.IgnoreUnmatch = true
+	if _, err := repo.Remove([]string{"missing.txt"}, opts); err != nil {
+		t.Errorf("IgnoreUnmatch failed: %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// replaceRefPrefix holds replacement refs, each named by the hash of the
+// object it replaces
+const replaceRefPrefix = "refs/replace/"
+
+// maxReplaceDepth bounds chains of replacements, as in Git
+const maxReplaceDepth = 5
+
+// Replacement is a replace ref: reads of Original return Replacement
+type Replacement struct {
+	Original    hash.Hash
+	Replacement hash.Hash
+}
+
+// replaceDatabase is an object database that honours refs/replace/*.
+// Reads of a replaced object return the replacement's content under the
+// original's hash, so history walks follow the replacement transparently.
+type replaceDatabase struct {
+	object.Database
+	repo *Repository
+
+	mu           sync.Mutex
+	replacements map[string]hash.Hash
+}
+
+// Get retrieves an object, or its replacement
+func (db *replaceDatabase) Get(h hash.Hash) (object.Object, error) {
+	target, err := db.resolve(h)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := db.Database.Get(target)
+	if err != nil {
+		return nil, err
+	}
+	obj.SetHash(h)
+	return obj, nil
+}
+
+// GetHeader reads the header of an object, or of its replacement
+func (db *replaceDatabase) GetHeader(h hash.Hash) (object.ObjectHeader, error) {
+	target, err := db.resolve(h)
+	if err != nil {
+		return object.ObjectHeader{}, err
+	}
+	return object.GetHeader(db.Database, target)
+}
+
+// resolve follows replace refs from h to the object to read
+func (db *replaceDatabase) resolve(h hash.Hash) (hash.Hash, error) {
+	db.mu.Lock()
+	if db.replacements == nil {
+		db.replacements = db.repo.loadReplacements()
+	}
+	replacements := db.replacements
+	db.mu.Unlock()
+
+	if len(replacements) == 0 {
+		return h, nil
+	}
+	for depth := 0; depth < maxReplaceDepth; depth++ {
+		next, ok := replacements[h.String()]
+		if !ok {
+			return h, nil
+		}
+		h = next
+	}
+	return nil, fmt.Errorf("replace depth too high for object %s", h.String())
+}
+
+// reset forgets the cached replace refs after they change
+func (db *replaceDatabase) reset() {
+	db.mu.Lock()
+	db.replacements = nil
+	db.mu.Unlock()
+}
+
+// loadReplacements reads the replace refs into a map from original to
+// replacement hash
+func (r *Repository) loadReplacements() map[string]hash.Hash {
+	replacements := make(map[string]hash.Hash)
+
+	refs, err := r.ListRefs(replaceRefPrefix)
+	if err != nil {
+		return replacements
+	}
+	for _, ref := range refs {
+		original := strings.TrimPrefix(ref, replaceRefPrefix)
+		if _, err := hash.ParseHash(original); err != nil {
+			continue
+		}
+		if h, err := r.ResolveRef(ref); err == nil {
+			replacements[strings.ToLower(original)] = h
+		}
+	}
+	return replacements
+}
+
+// unreplacedObjects returns the object database without replacements.
+// Reachability, packing and verification must see objects as stored, as
+// in Git, so that replaced history is neither pruned nor sent.
+func (r *Repository) unreplacedObjects() object.Database {
+	if db, ok := r.ObjectDB.(*replaceDatabase); ok {
+		return db.Database
+	}
+	return r.ObjectDB
+}
+
+// useReplaceRefs reports whether replace refs are honoured, which
+// core.useReplaceRefs can turn off
+func (r *Repository) useReplaceRefs() bool {
+	if use, ok := r.Config.GetBool("core", "useReplaceRefs"); ok {
+		return use
+	}
+	return true
+}
+
+// ReplaceObject makes reads of the object named by original return the
+// object named by replacement instead, like git replace. Both must be the
+// same type. An existing replacement is only overwritten with force.
+func (r *Repository) ReplaceObject(original, replacement string, force bool) error {
+	from, err := r.ResolveRevision(original)
+	if err != nil {
+		return err
+	}
+	to, err := r.ResolveRevision(replacement)
+	if err != nil {
+		return err
+	}
+	return r.replaceObject(from, to, force)
+}
+
+// replaceObject writes the replace ref for from
+func (r *Repository) replaceObject(from, to hash.Hash, force bool) error {
+	if from.Equals(to) {
+		return fmt.Errorf("new object is the same as the old one: %s", shortHash(from))
+	}
+
+	objects := r.unreplacedObjects()
+	fromHeader, err := object.GetHeader(objects, from)
+	if err != nil {
+		return fmt.Errorf("failed to read object %s: %w", shortHash(from), err)
+	}
+	toHeader, err := object.GetHeader(objects, to)
+	if err != nil {
+		return fmt.Errorf("failed to read object %s: %w", shortHash(to), err)
+	}
+	if fromHeader.Type != toHeader.Type {
+		return fmt.Errorf("objects must be of the same type: %s is a %s, %s is a %s",
+			shortHash(from), fromHeader.Type, shortHash(to), toHeader.Type)
+	}
+
+	ref := replaceRefPrefix + from.String()
+	if _, err := r.ResolveRef(ref); err == nil && !force {
+		return fmt.Errorf("replace ref %s already exists (use force to overwrite it)", ref)
+	}
+	if err := r.UpdateRef(ref, to); err != nil {
+		return fmt.Errorf("failed to write %s: %w", ref, err)
+	}
+
+	r.resetReplacements()
+	return nil
+}
+
+// GraftCommit replaces a commit with a copy that has different parents,
+// like git replace --graft. No parents makes it a root commit. Returns the
+// replacement commit.
+func (r *Repository) GraftCommit(rev string, parents []string, force bool) (hash.Hash, error) {
+	h, err := r.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	h, _, err = r.peelToCommit(h)
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy the commit as stored, not as currently replaced
+	obj, err := r.unreplacedObjects().Get(h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load commit %s: %w", shortHash(h), err)
+	}
+	commit, ok := obj.(*object.Commit)
+	if !ok {
+		return nil, fmt.Errorf("object %s is not a commit", shortHash(h))
+	}
+
+	graft := object.NewCommit()
+	graft.Tree = commit.Tree
+	graft.Author = commit.Author
+	graft.Committer = commit.Committer
+	graft.Message = commit.Message
+	for _, parent := range parents {
+		p, err := r.ResolveRevision(parent)
+		if err != nil {
+			return nil, err
+		}
+		p, _, err = r.peelToCommit(p)
+		if err != nil {
+			return nil, err
+		}
+		graft.AddParent(p)
+	}
+
+	graftHash, err := r.ObjectDB.Put(graft)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write graft commit: %w", err)
+	}
+	if err := r.replaceObject(h, graftHash, force); err != nil {
+		return nil, err
+	}
+	return graftHash, nil
+}
+
+// DeleteReplacement removes the replacement of the object named by rev,
+// like git replace -d
+func (r *Repository) DeleteReplacement(rev string) error {
+	h, err := hash.ParseHash(rev)
+	if err != nil || len(rev) != 2*r.Hasher.Size() {
+		if h, err = r.ResolveRevision(rev); err != nil {
+			return err
+		}
+	}
+
+	ref := replaceRefPrefix + h.String()
+	if _, err := os.Stat(r.refPath(ref)); err != nil {
+		return fmt.Errorf("no replace ref for %s", shortHash(h))
+	}
+	if err := r.DeleteRef(ref); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", ref, err)
+	}
+
+	r.resetReplacements()
+	return nil
+}
+
+// ListReplacements returns the repository's replace refs, ordered by the
+// replaced object
+func (r *Repository) ListReplacements() ([]Replacement, error) {
+	replacements := r.loadReplacements()
+
+	list := make([]Replacement, 0, len(replacements))
+	for original, replacement := range replacements {
+		h, err := hash.ParseHash(original)
+		if err != nil {
+			continue
+		}
+		list = append(list, Replacement{Original: h, Replacement: replacement})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Original.String() < list[j].Original.String()
+	})
+	return list, nil
+}
+
+// resetReplacements makes the object database reload replace refs
+func (r *Repository) resetReplacements() {
+	if db, ok := r.ObjectDB.(*replaceDatabase); ok {
+		db.reset()
+	}
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestReplaceObject tests that reads of a replaced commit return the
+// replacement under the original's hash
+func TestReplaceObject(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "a\n", "b\n", "c\n")
+
+	if err := repo.ReplaceObject(commits[1].String(), commits[2].String(), false); err != nil {
+		t.Fatalf("ReplaceObject failed: %v", err)
+	}
+
+	commit, _, err := repo.GetCommit(commits[1].String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit.Message != "Write c\n" {
+		t.Errorf("Expected the replacement's message, got %q", commit.Message)
+	}
+
+	raw, err := repo.ReadObject(commits[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !raw.Hash.Equals(commits[1]) {
+		t.Error("Expected the object to keep its own name")
+	}
+
+	list, err := repo.ListReplacements()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || !list[0].Original.Equals(commits[1]) || !list[0].Replacement.Equals(commits[2]) {
+		t.Errorf("Unexpected replacements %v", list)
+	}
+
+	if err := repo.ReplaceObject(commits[1].String(), commits[0].String(), false); err == nil {
+		t.Error("Expected an error replacing again without force")
+	}
+	if err := repo.ReplaceObject(commits[1].String(), commits[0].String(), true); err != nil {
+		t.Errorf("Forced ReplaceObject failed: %v", err)
+	}
+	if err := repo.ReplaceObject(commits[0].String(), commits[0].String(), false); err == nil {
+		t.Error("Expected an error replacing an object with itself")
+	}
+
+	head, _, err := repo.GetCommit(commits[2].String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.ReplaceObject(commits[2].String(), head.Tree.String(), false); err == nil {
+		t.Error("Expected an error replacing a commit with a tree")
+	}
+
+	if err := repo.DeleteReplacement(commits[1].String()); err != nil {
+		t.Fatalf("DeleteReplacement failed: %v", err)
+	}
+	if commit, _, _ := repo.GetCommit(commits[1].String()); commit.Message != "Write b\n" {
+		t.Errorf("Expected the original message after deleting, got %q", commit.Message)
+	}
+	if err := repo.DeleteReplacement(commits[1].String()); err == nil {
+		t.Error("Expected an error deleting a missing replacement")
+	}
+}
+
+// TestGraftCommit tests grafting history with a replacement commit
+func TestGraftCommit(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "a\n", "b\n", "c\n", "d\n")
+
+	if _, err := repo.GraftCommit(commits[2].String(), nil, false); err != nil {
+		t.Fatalf("GraftCommit failed: %v", err)
+	}
+
+	entries, err := repo.Log("", DefaultLogOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || !entries[1].Hash.Equals(commits[2]) {
+		t.Fatalf("Expected history to stop at the grafted commit, got %d entries", len(entries))
+	}
+
+	// The cut-off history is still stored and reachable for gc
+	reachable, err := repo.reachableObjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reachable[commits[0].String()] {
+		t.Error("Expected the original history to stay reachable")
+	}
+
+	// Honouring replace refs can be turned off
+	repo.Config.SetBool("core", "useReplaceRefs", false)
+	if err := repo.Config.Save(filepath.Join(repo.GitDir, "config")); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := Open(repo.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := reopened.Log("", DefaultLogOptions()); len(entries) != 4 {
+		t.Errorf("Expected the full history without replace refs, got %d entries", len(entries))
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
-	"github.com/nseba/browser-git/git-core/pkg/hash"
-	"github.com/nseba/browser-git/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+	"github.com/nseba/browser-git/packages/git-core/pkg/protocol"
 )
 
 // Repository represents a Git repository
@@ -25,6 +27,19 @@ type Repository struct {
 
 	// ObjectDB is the object database
 	ObjectDB object.Database
+
+	// Events receives lifecycle notifications for this repository
+	Events *EventBus
+
+	// Hooks are run at Git's hook points, such as pre-commit
+	Hooks *HookRegistry
+
+	// Limits caps the responses and packfiles accepted from remotes
+	Limits protocol.Limits
+
+	// Namespace is the ref namespace the repository works in, set with
+	// SetNamespace; empty for the top-level refs
+	Namespace string
 }
 
 // Open opens an existing repository at the specified path
@@ -59,6 +74,17 @@ func Open(path string) (*Repository, error) {
 		GitDir: gitDir,
 		Config: config,
 		Hasher: hasher,
+		Events: DefaultEventBus,
+		Hooks:  DefaultHooks,
+		Limits: protocol.DefaultLimits(),
+	}
+
+	// Use loose object storage by default
+	repo.ObjectDB = repo.newObjectDatabase()
+
+	// Like git, GIT_NAMESPACE selects a ref namespace
+	if err := repo.SetNamespace(os.Getenv("GIT_NAMESPACE")); err != nil {
+		return nil, err
 	}
 
 	return repo, nil
@@ -77,7 +103,7 @@ func Create(path string, opts InitOptions) (*Repository, error) {
 
 // HEAD returns the current HEAD reference
 func (r *Repository) HEAD() (string, error) {
-	content, err := ReadFile(r.GitDir, "HEAD")
+	content, err := r.readRef("HEAD")
 	if err != nil {
 		return "", fmt.Errorf("failed to read HEAD: %w", err)
 	}
@@ -93,8 +119,11 @@ func (r *Repository) HEAD() (string, error) {
 
 // SetHEAD sets the HEAD reference
 func (r *Repository) SetHEAD(ref string) error {
+	if target, ok := strings.CutPrefix(ref, "ref: "); ok {
+		ref = "ref: " + r.storedRefName(target)
+	}
 	content := []byte(ref + "\n")
-	return WriteFileInRepo(r.GitDir, "HEAD", content, 0644)
+	return WriteFileInRepo(r.GitDir, r.storedRefName("HEAD"), content, 0644)
 }
 
 // CurrentBranch returns the name of the current branch
@@ -110,17 +139,21 @@ func (r *Repository) CurrentBranch() (string, error) {
 		return head[len(prefix):], nil
 	}
 
-	// Detached HEAD
-	return "", fmt.Errorf("HEAD is detached")
+	return "", ErrDetachedHEAD
 }
 
-// ResolveRef resolves a reference to a hash
+// ResolveRef resolves a reference to a hash, following symbolic refs such
+// as HEAD
 func (r *Repository) ResolveRef(ref string) (hash.Hash, error) {
-	// If ref starts with "refs/", read the ref file
-	if len(ref) >= 5 && ref[:5] == "refs/" {
-		content, err := ReadFile(r.GitDir, ref)
+	// If ref is HEAD or starts with "refs/", read the ref file
+	if ref == "HEAD" || len(ref) >= 5 && ref[:5] == "refs/" {
+		name, err := r.followSymbolicRefs(ref)
+		if err != nil {
+			return nil, err
+		}
+		content, err := r.readRef(name)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read ref %s: %w", ref, err)
+			return nil, fmt.Errorf("failed to read ref %s: %w", name, err)
 		}
 
 		hashStr := string(content)
@@ -147,19 +180,33 @@ func (r *Repository) DeleteRef(ref string) error {
 		return fmt.Errorf("invalid ref: must start with refs/")
 	}
 
-	refPath := filepath.Join(r.GitDir, ref)
-	return removeFile(refPath)
+	// A symbolic ref is deleted itself, not the ref it points to
+	tx := r.BeginRefTx()
+	if err := tx.queue(&refTxUpdate{name: ref, noDeref: true}); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// ListRefs lists all references under a given prefix
+// ListRefs lists all references under a given prefix, or matching a glob
+// pattern such as refs/tags/v1.* where * does not match a slash. WalkRefs
+// lists refs with their values.
 func (r *Repository) ListRefs(prefix string) ([]string, error) {
 	// Ensure prefix starts with refs/
 	if len(prefix) < 5 || prefix[:5] != "refs/" {
 		return nil, fmt.Errorf("invalid ref prefix: must start with refs/")
 	}
 
+	// A pattern is matched below the directory before its first wildcard
+	pattern := ""
+	if i := strings.IndexAny(prefix, "*?["); i >= 0 {
+		pattern = prefix
+		prefix = prefix[:strings.LastIndex(prefix[:i], "/")+1]
+	}
+
 	refs := []string{}
-	refPath := filepath.Join(r.GitDir, prefix)
+	refPath := r.refPath(prefix)
+	nsDir := filepath.Join(r.GitDir, filepath.FromSlash(r.namespacePrefix()))
 
 	// Walk the directory tree
 	err := filepath.Walk(refPath, func(path string, info os.FileInfo, err error) error {
@@ -176,14 +223,22 @@ func (r *Repository) ListRefs(prefix string) ([]string, error) {
 			return nil
 		}
 
-		// Get relative path from GitDir
-		relPath, err := filepath.Rel(r.GitDir, path)
+		// Skip the lock files of refs being updated
+		if strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+
+		// Get relative path from GitDir, or the namespace's directory
+		relPath, err := filepath.Rel(nsDir, path)
 		if err != nil {
 			return err
 		}
 
 		// Add to refs list (use forward slashes for consistency)
-		refs = append(refs, filepath.ToSlash(relPath))
+		name := filepath.ToSlash(relPath)
+		if pattern == "" || matchRefPatterns(name, []string{pattern}) {
+			refs = append(refs, name)
+		}
 		return nil
 	})
 
@@ -204,14 +259,17 @@ func (r *Repository) UpdateRef(ref string, h hash.Hash) error {
 		return fmt.Errorf("invalid ref: must start with refs/")
 	}
 
-	content := []byte(h.String() + "\n")
-	return WriteFileInRepo(r.GitDir, ref, content, 0644)
+	tx := r.BeginRefTx()
+	if err := tx.Update(ref, h, nil, ""); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // BranchExists checks if a branch exists
 func (r *Repository) BranchExists(name string) bool {
 	ref := fmt.Sprintf("refs/heads/%s", name)
-	_, err := ReadFile(r.GitDir, ref)
+	_, err := os.Stat(r.refPath(ref))
 	return err == nil
 }
 
@@ -240,8 +298,19 @@ func (r *Repository) DeleteBranch(name string) error {
 	}
 
 	ref := fmt.Sprintf("refs/heads/%s", name)
-	refPath := filepath.Join(r.GitDir, ref)
-	return removeFile(refPath)
+	tip, resolveErr := r.ResolveRef(ref)
+	if err := r.DeleteRef(ref); err != nil {
+		return err
+	}
+
+	// Keep the last tip in the branch's reflog so RecoverBranch can bring
+	// the branch back
+	if resolveErr == nil {
+		if err := r.appendReflog(ref, tip, hash.ZeroHash(r.Hasher.Algorithm()), "branch: deleted"); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // RenameBranch renames a branch
@@ -290,18 +359,20 @@ func (r *Repository) RenameBranch(oldName, newName string) error {
 	return nil
 }
 
-// ListBranches lists all branches
+// ListBranches lists all branches by name, including names with slashes
+// such as release/1.x. ForEachRef lists them with more detail.
 func (r *Repository) ListBranches() ([]string, error) {
-	entries, err := ListDirectory(r.GitDir, "refs/heads")
+	refs, err := r.ForEachRef(ForEachRefOptions{
+		Patterns: []string{"refs/heads/"},
+		Format:   "%(refname:lstrip=2)",
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	branches := make([]string, 0, len(entries))
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			branches = append(branches, entry.Name())
-		}
+	branches := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		branches = append(branches, ref.Output)
 	}
 
 	return branches, nil
@@ -330,7 +401,9 @@ func (r *Repository) RefsPath() string {
 	return filepath.Join(r.GitDir, "refs")
 }
 
-// removeFile removes a file
-func removeFile(path string) error {
-	return os.Remove(path)
+// newClient creates a protocol client enforcing the repository's limits
+func (r *Repository) newClient() *protocol.Client {
+	client := protocol.NewClient()
+	client.SetLimits(r.Limits)
+	return client
 }
@@ -0,0 +1,274 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// RestoreOptions contains options for Restore
+type RestoreOptions struct {
+	// Source is the revision to restore from. When empty the worktree is
+	// restored from the index, and the index from HEAD.
+	Source string
+	// Staged restores the index (git restore --staged)
+	Staged bool
+	// Worktree restores the worktree (git restore --worktree)
+	Worktree bool
+	// Overlay keeps tracked paths the source lacks instead of removing
+	// them, as git checkout <rev> -- <paths> does
+	Overlay bool
+}
+
+// DefaultRestoreOptions returns default restore options, which discard
+// unstaged changes
+func DefaultRestoreOptions() RestoreOptions {
+	return RestoreOptions{
+		Source:   "",
+		Staged:   false,
+		Worktree: true,
+		Overlay:  false,
+	}
+}
+
+// RestoreResult describes what Restore changed
+type RestoreResult struct {
+	// Restored lists the paths written from the source
+	Restored []string
+	// Removed lists the paths removed because the source lacks them
+	Removed []string
+}
+
+// Restore restores paths in the worktree and/or the index from a source,
+// like git restore. Paths may name files or directories, and "." matches
+// everything. Tracked paths missing from the source are removed unless
+// Overlay is set.
+func (r *Repository) Restore(paths []string, opts RestoreOptions) (*RestoreResult, error) {
+	if !opts.Staged && !opts.Worktree {
+		return nil, fmt.Errorf("nothing to restore: neither Staged nor Worktree is set")
+	}
+	if opts.Worktree && r.IsBare() {
+		return nil, fmt.Errorf("cannot restore the worktree in a bare repository")
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no paths specified")
+	}
+
+	indexPath := filepath.Join(r.GitDir, "index")
+	idx, err := index.Load(indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+
+	source, err := r.restoreSource(idx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tracked paths count even when the source lacks them, so they can be
+	// removed to match it
+	candidates := make(map[string]bool)
+	for p := range source {
+		candidates[p] = true
+	}
+	if !opts.Overlay {
+		for _, entry := range idx.Entries {
+			candidates[entry.Path] = true
+		}
+	}
+
+	matched, err := matchRestorePaths(paths, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	sparse, err := r.SparseCheckout()
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmerged paths have no single version to restore from the index
+	if opts.Source == "" && !opts.Staged {
+		for _, entry := range idx.Entries {
+			if entry.StageFlag > 0 && stringSliceContains(matched, entry.Path) {
+				return nil, fmt.Errorf("path '%s' is unmerged", entry.Path)
+			}
+		}
+	}
+
+	result := &RestoreResult{Restored: []string{}, Removed: []string{}}
+	workTree := r.WorkTree()
+	for _, p := range matched {
+		file, inSource := source[p]
+		if !inSource {
+			if opts.Staged {
+				for idx.RemoveEntry(p) {
+					// Drop every conflict stage
+				}
+			}
+			if opts.Worktree {
+				fullPath := filepath.Join(workTree, filepath.FromSlash(p))
+				if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+					return nil, fmt.Errorf("failed to remove %s: %w", p, err)
+				}
+				removeEmptyParents(workTree, filepath.Dir(fullPath))
+			}
+			result.Removed = append(result.Removed, p)
+			continue
+		}
+
+		// Submodule commits are only recorded in the index
+		var content []byte
+		if file.mode != object.ModeGitlink {
+			obj, err := r.ObjectDB.Get(file.hash)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load blob for %s: %w", p, err)
+			}
+			blob, ok := obj.(*object.Blob)
+			if !ok {
+				return nil, fmt.Errorf("object is not a blob: %s", p)
+			}
+			content = blob.Content()
+		}
+
+		var info os.FileInfo
+		if opts.Worktree && file.mode != object.ModeGitlink && (sparse == nil || sparse.Includes(p)) {
+			if info, err = writeWorkTreeFile(workTree, p, content, file.mode); err != nil {
+				return nil, err
+			}
+		}
+
+		if opts.Staged {
+			entry := &index.Entry{
+				Mode: uint32(file.mode),
+				Hash: file.hash,
+				Path: p,
+				Size: uint32(len(content)),
+			}
+			if info != nil {
+				entry.MTime = info.ModTime()
+				entry.CTime = info.ModTime()
+			}
+			for idx.RemoveEntry(p) {
+				// Drop every conflict stage
+			}
+			idx.AddEntry(entry)
+		}
+		result.Restored = append(result.Restored, p)
+	}
+
+	if opts.Staged {
+		if err := idx.Save(indexPath); err != nil {
+			return nil, fmt.Errorf("failed to save index: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// restoreSource returns the files Restore copies from: the given
+// revision, HEAD when restoring the index, or else the index
+func (r *Repository) restoreSource(idx *index.Index, opts RestoreOptions) (map[string]struct {
+	hash hash.Hash
+	mode object.FileMode
+}, error) {
+	files := make(map[string]struct {
+		hash hash.Hash
+		mode object.FileMode
+	})
+
+	switch {
+	case opts.Source != "":
+		h, err := r.ResolveRevision(opts.Source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source %s: %w", opts.Source, err)
+		}
+		tree, _, err := r.peelToTree(h)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source %s: %w", opts.Source, err)
+		}
+		if err := r.collectTreeFiles(tree, "", files); err != nil {
+			return nil, err
+		}
+		return files, nil
+
+	case opts.Staged:
+		return r.headTreeFiles()
+	}
+
+	for _, entry := range idx.Entries {
+		if entry.StageFlag == 0 {
+			files[entry.Path] = struct {
+				hash hash.Hash
+				mode object.FileMode
+			}{hash: entry.Hash, mode: object.FileMode(entry.Mode)}
+		}
+	}
+	return files, nil
+}
+
+// matchRestorePaths returns the sorted candidates matched by paths, which
+// name files or directories. Every path must match something.
+func matchRestorePaths(paths []string, candidates map[string]bool) ([]string, error) {
+	matched := make(map[string]bool)
+	for _, p := range paths {
+		p = strings.Trim(path.Clean(filepath.ToSlash(p)), "/")
+		found := false
+		for candidate := range candidates {
+			if p == "." || candidate == p || strings.HasPrefix(candidate, p+"/") {
+				matched[candidate] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("pathspec '%s' did not match any file(s) known to git", p)
+		}
+	}
+
+	result := make([]string, 0, len(matched))
+	for p := range matched {
+		result = append(result, p)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// writeWorkTreeFile writes a blob to the worktree with the permissions or
+// link type of its mode and returns the file's new metadata
+func writeWorkTreeFile(workTree, p string, content []byte, mode object.FileMode) (os.FileInfo, error) {
+	fullPath := filepath.Join(workTree, filepath.FromSlash(p))
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directories: %w", err)
+	}
+
+	if mode == object.ModeSymlink {
+		os.Remove(fullPath)
+		if err := os.Symlink(string(content), fullPath); err != nil {
+			return nil, fmt.Errorf("failed to create symlink %s: %w", p, err)
+		}
+	} else {
+		perm := os.FileMode(0644)
+		if mode == object.ModeExecutable {
+			perm = 0755
+		}
+		if err := os.WriteFile(fullPath, content, perm); err != nil {
+			return nil, fmt.Errorf("failed to write file %s: %w", p, err)
+		}
+		if err := os.Chmod(fullPath, perm); err != nil {
+			return nil, fmt.Errorf("failed to set mode of %s: %w", p, err)
+		}
+	}
+
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file %s: %w", p, err)
+	}
+	return info, nil
+}
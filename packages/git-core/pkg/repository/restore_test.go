@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+)
+
+// TestRestore tests discarding worktree changes, unstaging and restoring
+// from an older commit
+func TestRestore(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "a\n", "b\n")
+	filePath := filepath.Join(repo.Path, "file.txt")
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repo.Path, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectFile := func(content string) {
+		t.Helper()
+		data, err := os.ReadFile(filePath)
+		if err != nil || string(data) != content {
+			t.Errorf("Expected file.txt to contain %q, got %q (%v)", content, data, err)
+		}
+	}
+	status := func() *Status {
+		t.Helper()
+		s, err := repo.Status(index.DefaultStatusOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	// Discard an unstaged change
+	write("file.txt", "local\n")
+	if _, err := repo.Restore([]string{"file.txt"}, DefaultRestoreOptions()); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	expectFile("b\n")
+
+	// Unstage a change and a new file, keeping both in the worktree
+	write("file.txt", "staged\n")
+	write("new.txt", "new\n")
+	if err := addFile(repo, "file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := addFile(repo, "new.txt"); err != nil {
+		t.Fatal(err)
+	}
+	opts := RestoreOptions{Staged: true}
+	result, err := repo.Restore([]string{"."}, opts)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if !reflect.DeepEqual(result, &RestoreResult{Restored: []string{"file.txt"}, Removed: []string{"new.txt"}}) {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	expectFile("staged\n")
+	s := status()
+	if !reflect.DeepEqual(s.Modified, []string{"file.txt"}) || !reflect.DeepEqual(s.Untracked, []string{"new.txt"}) || s.HasStagedChanges() {
+		t.Errorf("Expected only unstaged changes, got %+v", s.Status)
+	}
+
+	// Restore both the index and the worktree from the first commit
+	opts = RestoreOptions{Source: commits[0].String(), Staged: true, Worktree: true}
+	if _, err := repo.Restore([]string{"file.txt"}, opts); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	expectFile("a\n")
+	s = status()
+	if !reflect.DeepEqual(s.Staged, []string{"file.txt"}) || len(s.Modified) != 0 {
+		t.Errorf("Expected file.txt to be staged only, got %+v", s.Status)
+	}
+
+	for _, tt := range []struct {
+		paths []string
+		opts  RestoreOptions
+	}{
+		{[]string{"missing.txt"}, DefaultRestoreOptions()},
+		{[]string{"file.txt"}, RestoreOptions{}},
+		{nil, DefaultRestoreOptions()},
+		{[]string{"file.txt"}, RestoreOptions{Source: "nosuchrev", Worktree: true}},
+	} {
+		if _, err := repo.Restore(tt.paths, tt.opts); err == nil {
+			t.Errorf("Expected an error restoring %v with %+v", tt.paths, tt.opts)
+		}
+	}
+}
+
+// TestRestoreRemovesPathsMissingFromSource tests that tracked files the
+// source lacks are removed from the worktree
+func TestRestoreRemovesPathsMissingFromSource(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "a\n")
+	if err := os.MkdirAll(filepath.Join(repo.Path, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo.Path, "dir", "extra.txt"), []byte("x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := addFile(repo, "dir/extra.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createCommit(repo, "Add extra"); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultRestoreOptions()
+	opts.Source = commits[0].String()
+	result, err := repo.Restore([]string{"dir"}, opts)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if !reflect.DeepEqual(result.Removed, []string{"dir/extra.txt"}) {
+		t.Errorf("Expected dir/extra.txt to be removed, got %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(repo.Path, "dir")); !os.IsNotExist(err) {
+		t.Errorf("Expected the emptied directory to be removed, got %v", err)
+	}
+}
+
+// TestCheckoutPaths tests checking files out of an older commit without
+// moving HEAD or removing files the commit lacks
+func TestCheckoutPaths(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "a\n", "b\n")
+	repo.Hooks = NewHookRegistry()
+	var hookArgs [][]string
+	repo.Hooks.Register(HookPostCheckout, func(inv *HookInvocation) error {
+		hookArgs = append(hookArgs, inv.Args)
+		return nil
+	})
+
+	if err := os.WriteFile(filepath.Join(repo.Path, "other.txt"), []byte("other\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := addFile(repo, "other.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := repo.CheckoutPaths(commits[0].String(), []string{"."})
+	if err != nil {
+		t.Fatalf("CheckoutPaths failed: %v", err)
+	}
+	if !reflect.DeepEqual(result, &RestoreResult{Restored: []string{"file.txt"}, Removed: []string{}}) {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	expectHead(t, repo, commits[1], "a\n")
+	status, err := repo.Status(index.DefaultStatusOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(status.Staged, []string{"file.txt"}) || !reflect.DeepEqual(status.Added, []string{"other.txt"}) || len(status.Modified) != 0 {
+		t.Errorf("Expected file.txt staged and other.txt kept, got %+v", status.Status)
+	}
+
+	// Without a revision the paths come from the index
+	if err := os.WriteFile(filepath.Join(repo.Path, "file.txt"), []byte("local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CheckoutPaths("", []string{"file.txt"}); err != nil {
+		t.Fatalf("CheckoutPaths failed: %v", err)
+	}
+	expectHead(t, repo, commits[1], "a\n")
+
+	if _, err := repo.CheckoutPaths(commits[0].String(), []string{"other.txt"}); err == nil {
+		t.Error("Expected an error for a path missing from the revision")
+	}
+
+	want := [][]string{{commits[1].String(), commits[1].String(), "0"}, {commits[1].String(), commits[1].String(), "0"}}
+	if !reflect.DeepEqual(hookArgs, want) {
+		t.Errorf("Expected post-checkout args %v, got %v", want, hookArgs)
+	}
+}
@@ -0,0 +1,393 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// RevListOptions contains options for listing revisions
+type RevListOptions struct {
+	// Specs are revisions, "^rev" exclusions and "A..B" or "A...B"
+	// ranges, as CommitsInRange takes them
+	Specs []string
+
+	// Include and Exclude add tips by hash, as a revision and a ^rev
+	// exclusion do. Excluded commits missing from the repository are
+	// skipped, so the refs of a remote can be excluded as they are.
+	Include []hash.Hash
+	Exclude []hash.Hash
+
+	// Objects also lists the tags, trees and blobs that the listed commits
+	// need and the excluded ones lack, like git rev-list --objects
+	Objects bool
+
+	// Count only counts the commits and objects, like --count
+	Count bool
+}
+
+// RevListObject is a tag, tree or blob listed by RevList
+type RevListObject struct {
+	Hash hash.Hash
+	Type object.Type
+	// Path is where the tree or blob was first reached, empty for root
+	// trees and tags
+	Path string
+}
+
+// RevListResult is the outcome of RevList
+type RevListResult struct {
+	// Commits are the commits of the range, newest first by committer date
+	Commits []hash.Hash
+	// Objects are the other objects, with RevListOptions.Objects
+	Objects []RevListObject
+
+	CommitCount int
+	ObjectCount int
+}
+
+// revListSlop is how many commits the walk goes on for once only excluded
+// ones are left, to catch commits whose dates are skewed, as in Git
+const revListSlop = 5
+
+// RevList lists the commits of a revision range and optionally the
+// objects they need, like git rev-list. Objects are read as stored,
+// without replacements, so the list is what a pack or bundle of the range
+// holds. With no tips at all, HEAD is listed.
+func (r *Repository) RevList(opts RevListOptions) (*RevListResult, error) {
+	include := append([]hash.Hash{}, opts.Include...)
+	exclude := append([]hash.Hash{}, opts.Exclude...)
+	if len(opts.Specs) > 0 || len(include) == 0 && len(exclude) == 0 {
+		specs, err := r.parseRangeSpecs(opts.Specs)
+		if err != nil {
+			return nil, err
+		}
+		include = append(include, specs.include...)
+		exclude = append(exclude, specs.exclude...)
+	}
+
+	w := r.newRevWalk(r.unreplacedObjects())
+	var roots []RevListObject
+	for _, tip := range exclude {
+		if err := w.addTip(tip, true, nil); err != nil {
+			return nil, err
+		}
+	}
+	for _, tip := range include {
+		if err := w.addTip(tip, false, &roots); err != nil {
+			return nil, err
+		}
+	}
+	commits, err := w.limit()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RevListResult{CommitCount: len(commits)}
+	if !opts.Count {
+		result.Commits = make([]hash.Hash, len(commits))
+		for i, c := range commits {
+			result.Commits[i] = c.hash
+		}
+	}
+	if !opts.Objects {
+		return result, nil
+	}
+
+	objects, err := w.listObjects(commits, roots)
+	if err != nil {
+		return nil, err
+	}
+	result.ObjectCount = len(objects)
+	if !opts.Count {
+		result.Objects = objects
+	}
+	return result, nil
+}
+
+// revCommit is a commit met by the rev-list walk
+type revCommit struct {
+	hash          hash.Hash
+	commit        *object.Commit
+	uninteresting bool
+	// popped is set once the walk has queued the commit's parents
+	popped bool
+}
+
+// revWalk walks from included and excluded commits together, newest
+// first, until only excluded history is left, like Git's limit_list
+type revWalk struct {
+	objects object.Database
+	shallow map[string]bool
+	commits map[string]*revCommit
+	queue   commitQueue
+}
+
+// newRevWalk starts a walk that reads commits from objects
+func (r *Repository) newRevWalk(objects object.Database) *revWalk {
+	return &revWalk{objects: objects, shallow: r.shallowSet(), commits: make(map[string]*revCommit)}
+}
+
+// addTip starts the walk at a tip, peeling tags. The tags of included tips
+// and trees or blobs they point at are added to roots.
+func (w *revWalk) addTip(tip hash.Hash, uninteresting bool, roots *[]RevListObject) error {
+	h := tip
+	for {
+		if uninteresting && !w.objects.Has(h) {
+			return nil // The other side may have what we lack
+		}
+		obj, err := w.objects.Get(h)
+		if err != nil {
+			return fmt.Errorf("failed to load object %s: %w", h.String(), err)
+		}
+		switch o := obj.(type) {
+		case *object.Tag:
+			if roots != nil {
+				*roots = append(*roots, RevListObject{Hash: h, Type: object.TagType})
+			}
+			h = o.Target
+			continue
+		case *object.Commit:
+			w.add(h, o, uninteresting)
+		default:
+			if roots != nil {
+				*roots = append(*roots, RevListObject{Hash: h, Type: obj.Type()})
+			}
+		}
+		return nil
+	}
+}
+
+// add queues a commit the walk has not met yet, or marks a known one
+// uninteresting
+func (w *revWalk) add(h hash.Hash, commit *object.Commit, uninteresting bool) {
+	if c, ok := w.commits[h.String()]; ok {
+		if uninteresting {
+			w.markUninteresting(c)
+		}
+		return
+	}
+	c := &revCommit{hash: h, commit: commit, uninteresting: uninteresting}
+	w.commits[h.String()] = c
+	w.queue.push(&logCommit{hash: h, commit: commit})
+}
+
+// parents returns the parents the walk follows from a commit
+func (w *revWalk) parents(c *revCommit) []hash.Hash {
+	if w.shallow[c.hash.String()] {
+		return nil
+	}
+	return c.commit.Parents
+}
+
+// markUninteresting marks a commit and the ancestors the walk has already
+// met as uninteresting
+func (w *revWalk) markUninteresting(c *revCommit) {
+	stack := []*revCommit{c}
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if c.uninteresting {
+			continue
+		}
+		c.uninteresting = true
+		if !c.popped {
+			continue // Its parents are marked when it is popped
+		}
+		for _, parent := range w.parents(c) {
+			if p, ok := w.commits[parent.String()]; ok {
+				stack = append(stack, p)
+			}
+		}
+	}
+}
+
+// limit walks until only uninteresting commits are queued and returns the
+// interesting commits, newest first by committer date
+func (w *revWalk) limit() ([]*revCommit, error) {
+	var walked []*revCommit
+	slop := revListSlop
+	for w.queue.len() > 0 {
+		if w.everybodyUninteresting() {
+			if slop == 0 {
+				break
+			}
+			slop--
+		} else {
+			slop = revListSlop
+		}
+
+		c := w.commits[w.queue.pop().hash.String()]
+		c.popped = true
+		for _, parent := range w.parents(c) {
+			if p, ok := w.commits[parent.String()]; ok {
+				if c.uninteresting {
+					w.markUninteresting(p)
+				}
+				continue
+			}
+			obj, err := w.objects.Get(parent)
+			if err != nil {
+				if c.uninteresting {
+					continue
+				}
+				return nil, fmt.Errorf("failed to load commit %s: %w", parent.String(), err)
+			}
+			commit, ok := obj.(*object.Commit)
+			if !ok {
+				return nil, fmt.Errorf("object %s is a %s, not a commit", shortHash(parent), obj.Type())
+			}
+			w.add(parent, commit, c.uninteresting)
+		}
+		walked = append(walked, c)
+	}
+
+	commits := make([]*revCommit, 0, len(walked))
+	for _, c := range walked {
+		if !c.uninteresting {
+			commits = append(commits, c)
+		}
+	}
+	sort.SliceStable(commits, func(i, j int) bool {
+		return commits[i].commit.Committer.When.After(commits[j].commit.Committer.When)
+	})
+	return commits, nil
+}
+
+// everybodyUninteresting reports whether only uninteresting commits are
+// queued
+func (w *revWalk) everybodyUninteresting() bool {
+	for _, queued := range w.queue.heap {
+		if !w.commits[queued.hash.String()].uninteresting {
+			return false
+		}
+	}
+	return true
+}
+
+// listObjects lists the trees and blobs of the commits, after the roots,
+// leaving out those the uninteresting parents of the commits have
+func (w *revWalk) listObjects(commits []*revCommit, roots []RevListObject) ([]RevListObject, error) {
+	seen := make(map[string]bool)
+
+	// The trees at the edge of the range are what the other side has
+	for _, c := range commits {
+		for _, parent := range w.parents(c) {
+			if p, ok := w.commits[parent.String()]; ok && p.uninteresting && !seen[p.commit.Tree.String()] {
+				if err := w.walkTree(p.commit.Tree, "", seen, nil); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	objects := []RevListObject{}
+	for _, root := range roots {
+		if seen[root.Hash.String()] {
+			continue
+		}
+		if root.Type == object.TreeType {
+			if err := w.walkTree(root.Hash, "", seen, &objects); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		seen[root.Hash.String()] = true
+		objects = append(objects, root)
+	}
+	for _, c := range commits {
+		if err := w.walkTree(c.commit.Tree, "", seen, &objects); err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
+
+// walkTree marks a tree and everything below it as seen, listing those not
+// seen before in objects when it is not nil. Submodule commits live in
+// another repository and are left out.
+func (w *revWalk) walkTree(treeHash hash.Hash, path string, seen map[string]bool, objects *[]RevListObject) error {
+	if seen[treeHash.String()] {
+		return nil
+	}
+	seen[treeHash.String()] = true
+	if objects != nil {
+		*objects = append(*objects, RevListObject{Hash: treeHash, Type: object.TreeType, Path: path})
+	}
+
+	obj, err := w.objects.Get(treeHash)
+	if err != nil {
+		return fmt.Errorf("failed to load tree %s: %w", treeHash.String(), err)
+	}
+	tree, ok := obj.(*object.Tree)
+	if !ok {
+		return fmt.Errorf("object %s is not a tree", shortHash(treeHash))
+	}
+	for _, entry := range tree.Entries() {
+		entryPath := entry.Name
+		if path != "" {
+			entryPath = path + "/" + entry.Name
+		}
+		switch entry.Mode {
+		case object.ModeGitlink:
+		case object.ModeDir:
+			if err := w.walkTree(entry.Hash, entryPath, seen, objects); err != nil {
+				return err
+			}
+		default:
+			if seen[entry.Hash.String()] {
+				continue
+			}
+			seen[entry.Hash.String()] = true
+			if objects != nil {
+				*objects = append(*objects, RevListObject{Hash: entry.Hash, Type: object.BlobType, Path: entryPath})
+			}
+		}
+	}
+	return nil
+}
+
+// loadRevList loads the commits and objects of a rev-list as stored, for
+// packing them
+func (r *Repository) loadRevList(list *RevListResult) ([]object.Object, error) {
+	objects := r.unreplacedObjects()
+	loaded := make([]object.Object, 0, len(list.Commits)+len(list.Objects))
+	load := func(h hash.Hash) error {
+		obj, err := objects.Get(h)
+		if err != nil {
+			return fmt.Errorf("failed to load object %s: %w", h.String(), err)
+		}
+		loaded = append(loaded, obj)
+		return nil
+	}
+	for _, h := range list.Commits {
+		if err := load(h); err != nil {
+			return nil, err
+		}
+	}
+	for _, o := range list.Objects {
+		if err := load(o.Hash); err != nil {
+			return nil, err
+		}
+	}
+	return loaded, nil
+}
+
+// reachable returns the interesting commits reachable from tips
+func (w *revWalk) reachable(tips []hash.Hash) map[string]bool {
+	reached := make(map[string]bool)
+	stack := append([]hash.Hash{}, tips...)
+	for len(stack) > 0 {
+		h := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		c, ok := w.commits[h.String()]
+		if !ok || c.uninteresting || reached[h.String()] {
+			continue
+		}
+		reached[h.String()] = true
+		stack = append(stack, w.parents(c)...)
+	}
+	return reached
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// TestRevList tests listing the commits and objects of a range, leaving
+// out the objects the excluded commits already have
+func TestRevList(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	a := commitTestTree(t, repo, "A", map[string]string{"a": "1\n", "dir/b": "2\n"})
+	b := commitTestTree(t, repo, "B", map[string]string{"a": "1\n", "dir/b": "3\n"}, a)
+	c := commitTestTree(t, repo, "C", map[string]string{"a": "4\n", "dir/b": "3\n"}, b)
+
+	describe := func(list *RevListResult) string {
+		t.Helper()
+		var commits, objects []string
+		for _, h := range list.Commits {
+			obj, err := repo.ObjectDB.Get(h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			commits = append(commits, strings.TrimSpace(obj.(*object.Commit).Message))
+		}
+		for _, o := range list.Objects {
+			objects = append(objects, string(o.Type)+":"+o.Path)
+		}
+		sort.Strings(objects)
+		return strings.Join(commits, " ") + " | " + strings.Join(objects, " ")
+	}
+
+	list, err := repo.RevList(RevListOptions{Specs: []string{a.String() + ".." + c.String()}, Objects: true})
+	if err != nil {
+		t.Fatalf("RevList failed: %v", err)
+	}
+	if got, want := describe(list), "C B | blob:a blob:dir/b tree: tree: tree:dir"; got != want {
+		t.Errorf("RevList A..C = %q, want %q", got, want)
+	}
+	if list.CommitCount != 2 || list.ObjectCount != 5 {
+		t.Errorf("counts = %d commits, %d objects, want 2 and 5", list.CommitCount, list.ObjectCount)
+	}
+
+	// Without objects only the commits are listed
+	list, err = repo.RevList(RevListOptions{Include: []hash.Hash{c}, Exclude: []hash.Hash{b}})
+	if err != nil {
+		t.Fatalf("RevList failed: %v", err)
+	}
+	if got, want := describe(list), "C | "; got != want {
+		t.Errorf("RevList ^B C = %q, want %q", got, want)
+	}
+
+	// Excluded commits the repository lacks are skipped
+	missing, _ := hash.ParseHash("1111111111111111111111111111111111111111")
+	list, err = repo.RevList(RevListOptions{Include: []hash.Hash{c}, Exclude: []hash.Hash{missing}, Objects: true, Count: true})
+	if err != nil {
+		t.Fatalf("RevList failed: %v", err)
+	}
+	if list.Commits != nil || list.Objects != nil || list.CommitCount != 3 || list.ObjectCount != 9 {
+		t.Errorf("RevList --count = %d commits, %d objects, lists %v %v", list.CommitCount, list.ObjectCount, list.Commits, list.Objects)
+	}
+
+	// An annotated tag is listed along with the history it points at
+	tag := object.NewTag()
+	tag.Target = c
+	tag.TargetType = object.CommitType
+	tag.Name = "v1"
+	tag.Tagger = object.Signature{Name: "Test User", Email: "test@example.com", When: time.Unix(1577836800, 0)}
+	tag.Message = "v1\n"
+	tagHash, err := repo.ObjectDB.Put(tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err = repo.RevList(RevListOptions{Include: []hash.Hash{tagHash}, Exclude: []hash.Hash{b}, Objects: true})
+	if err != nil {
+		t.Fatalf("RevList failed: %v", err)
+	}
+	if got, want := describe(list), "C | blob:a tag: tree:"; got != want {
+		t.Errorf("RevList of a tag = %q, want %q", got, want)
+	}
+}
+
+// TestRevListDateOrder tests that the commits of a range come newest first
+// by committer date, including those dated before their parents
+func TestRevListDateOrder(t *testing.T) {
+	repo := setupBranchyRepo(t)
+
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{spec: "main~1..main", want: "I"},
+		{spec: "main~2..main~1", want: "H G G2"},
+		{spec: "main~3^2..main~2", want: "F M D B"},
+	}
+	for _, tt := range tests {
+		list, err := repo.RevList(RevListOptions{Specs: []string{tt.spec}})
+		if err != nil {
+			t.Fatalf("RevList failed: %v", err)
+		}
+		var got []string
+		for _, h := range list.Commits {
+			obj, err := repo.ObjectDB.Get(h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, strings.TrimSpace(obj.(*object.Commit).Message))
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("RevList %s = %q, want %q", tt.spec, strings.Join(got, " "), tt.want)
+		}
+	}
+}
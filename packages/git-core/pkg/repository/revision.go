@@ -0,0 +1,323 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/merge"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// ResolveRevision resolves a revision to an object hash. A revision is HEAD
+// or another *_HEAD file, a full ref, a tag, branch or remote-tracking
+// branch name, or a full or abbreviated commit hash, optionally followed by
+// ~N (Nth first-parent ancestor) and ^N (Nth parent) suffixes.
+func (r *Repository) ResolveRevision(rev string) (hash.Hash, error) {
+	if rev == "" {
+		return nil, fmt.Errorf("empty revision")
+	}
+
+	base := rev
+	suffix := ""
+	if i := strings.IndexAny(rev, "~^"); i > 0 {
+		base, suffix = rev[:i], rev[i:]
+	}
+
+	h, err := r.resolveRevisionBase(base)
+	if err != nil {
+		return nil, err
+	}
+
+	for suffix != "" {
+		op := suffix[0]
+		suffix = suffix[1:]
+
+		digits := 0
+		for digits < len(suffix) && suffix[digits] >= '0' && suffix[digits] <= '9' {
+			digits++
+		}
+		n := 1
+		if digits > 0 {
+			n, err = strconv.Atoi(suffix[:digits])
+			if err != nil {
+				return nil, fmt.Errorf("invalid revision %q: %w", rev, err)
+			}
+		}
+		suffix = suffix[digits:]
+
+		commitHash, commit, err := r.peelToCommit(h)
+		if err != nil {
+			return nil, fmt.Errorf("invalid revision %q: %w", rev, err)
+		}
+
+		switch op {
+		case '~':
+			for i := 0; i < n; i++ {
+				if len(commit.Parents) == 0 {
+					return nil, fmt.Errorf("invalid revision %q: %s has no parent", rev, shortHash(commitHash))
+				}
+				commitHash, commit, err = r.peelToCommit(commit.Parents[0])
+				if err != nil {
+					return nil, err
+				}
+			}
+			h = commitHash
+
+		case '^':
+			if n == 0 {
+				h = commitHash
+				continue
+			}
+			if n > len(commit.Parents) {
+				return nil, fmt.Errorf("invalid revision %q: %s has no parent %d", rev, shortHash(commitHash), n)
+			}
+			h = commit.Parents[n-1]
+		}
+	}
+
+	return h, nil
+}
+
+// resolveRevisionBase resolves a revision without ancestry suffixes
+func (r *Repository) resolveRevisionBase(rev string) (hash.Hash, error) {
+	// A full hash names an object directly
+	if h, err := hash.ParseHash(rev); err == nil && len(rev) == 2*r.Hasher.Size() {
+		if r.ObjectDB.Has(h) {
+			return h, nil
+		}
+	}
+
+	if rev == "HEAD" {
+		h, err := r.ResolveHEAD()
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve HEAD: %w", err)
+		}
+		return h, nil
+	}
+
+	// Pseudo-refs such as ORIG_HEAD and MERGE_HEAD
+	if strings.HasSuffix(rev, "_HEAD") && strings.ToUpper(rev) == rev {
+		if h := r.readStateHash(rev); h != nil {
+			return h, nil
+		}
+	}
+
+	// Refs in the order Git searches them
+	candidates := []string{rev}
+	if !strings.HasPrefix(rev, "refs/") {
+		candidates = []string{
+			"refs/" + rev,
+			"refs/tags/" + rev,
+			"refs/heads/" + rev,
+			"refs/remotes/" + rev,
+			"refs/remotes/" + rev + "/HEAD",
+		}
+	}
+	for _, ref := range candidates {
+		if h, err := r.ResolveRef(ref); err == nil {
+			return h, nil
+		}
+	}
+
+	// Abbreviated commit hashes
+	if len(rev) >= 4 && isHexString(rev) {
+		if _, h, err := r.GetCommit(rev); err == nil {
+			return h, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown revision: %s", rev)
+}
+
+// RangeSide tells which side of a symmetric difference reaches a commit
+type RangeSide int
+
+const (
+	// RangeSideNone is the side of commits of other ranges
+	RangeSideNone RangeSide = iota
+	// RangeSideLeft marks commits only A reaches in A...B
+	RangeSideLeft
+	// RangeSideRight marks commits only B reaches in A...B
+	RangeSideRight
+)
+
+// CommitsInRange returns the commits of a revision range, newest first by
+// committer date, like git rev-list. Each spec is a revision whose history
+// is included, "^rev" to exclude the history of rev, "A..B" for commits
+// reachable from B but not from A, or "A...B" for commits reachable from
+// either A or B but not both, whose entries tell the side they are on.
+// Either side of ".." and "..." defaults to HEAD, and no spec or an empty
+// one means HEAD.
+func (r *Repository) CommitsInRange(specs ...string) ([]*LogEntry, error) {
+	parsed, err := r.parseRangeSpecs(specs)
+	if err != nil {
+		return nil, err
+	}
+
+	w := r.newRevWalk(r.ObjectDB)
+	for _, tip := range parsed.exclude {
+		if err := w.addTip(tip, true, nil); err != nil {
+			return nil, err
+		}
+	}
+	for _, tip := range parsed.include {
+		if err := w.addTip(tip, false, nil); err != nil {
+			return nil, err
+		}
+	}
+	commits, err := w.limit()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*LogEntry, len(commits))
+	for i, c := range commits {
+		entries[i] = &LogEntry{Commit: c.commit, Hash: c.hash, Parents: w.parents(c)}
+	}
+	if len(parsed.left) > 0 {
+		left, right := w.reachable(parsed.left), w.reachable(parsed.right)
+		for _, entry := range entries {
+			switch key := entry.Hash.String(); {
+			case left[key] && !right[key]:
+				entry.Side = RangeSideLeft
+			case right[key] && !left[key]:
+				entry.Side = RangeSideRight
+			}
+		}
+	}
+	return entries, nil
+}
+
+// rangeSpecs are the tips of a parsed revision range
+type rangeSpecs struct {
+	include []hash.Hash
+	exclude []hash.Hash
+	// left and right are the sides of A...B ranges
+	left  []hash.Hash
+	right []hash.Hash
+}
+
+// parseRangeSpecs resolves the specs of a revision range as CommitsInRange
+// takes them
+func (r *Repository) parseRangeSpecs(specs []string) (*rangeSpecs, error) {
+	if len(specs) == 0 {
+		specs = []string{"HEAD"}
+	}
+
+	parsed := &rangeSpecs{}
+	for _, spec := range specs {
+		if from, to, ok := strings.Cut(spec, "..."); ok {
+			a, err := r.resolveRangeEnd(from)
+			if err != nil {
+				return nil, err
+			}
+			b, err := r.resolveRangeEnd(to)
+			if err != nil {
+				return nil, err
+			}
+			bases, err := merge.FindMergeBases(r.ObjectDB, a, b)
+			if err != nil {
+				return nil, err
+			}
+			parsed.include = append(parsed.include, a, b)
+			parsed.exclude = append(parsed.exclude, bases...)
+			parsed.left, parsed.right = append(parsed.left, a), append(parsed.right, b)
+			continue
+		}
+		if from, to, ok := strings.Cut(spec, ".."); ok {
+			a, err := r.resolveRangeEnd(from)
+			if err != nil {
+				return nil, err
+			}
+			b, err := r.resolveRangeEnd(to)
+			if err != nil {
+				return nil, err
+			}
+			parsed.include, parsed.exclude = append(parsed.include, b), append(parsed.exclude, a)
+			continue
+		}
+		if rev, ok := strings.CutPrefix(spec, "^"); ok {
+			h, err := r.resolveRangeEnd(rev)
+			if err != nil {
+				return nil, err
+			}
+			parsed.exclude = append(parsed.exclude, h)
+			continue
+		}
+		h, err := r.resolveRangeEnd(spec)
+		if err != nil {
+			return nil, err
+		}
+		parsed.include = append(parsed.include, h)
+	}
+	return parsed, nil
+}
+
+// resolveRangeEnd resolves a revision of a range to a commit, HEAD when it
+// is empty
+func (r *Repository) resolveRangeEnd(rev string) (hash.Hash, error) {
+	if rev == "" {
+		rev = "HEAD"
+	}
+	h, err := r.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	h, _, err = r.peelToCommit(h)
+	return h, err
+}
+
+// peelToCommit follows tags until it reaches a commit
+func (r *Repository) peelToCommit(h hash.Hash) (hash.Hash, *object.Commit, error) {
+	for {
+		obj, err := r.ObjectDB.Get(h)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load object %s: %w", h.String(), err)
+		}
+
+		switch o := obj.(type) {
+		case *object.Commit:
+			return h, o, nil
+		case *object.Tag:
+			h = o.Target
+		default:
+			return nil, nil, fmt.Errorf("object %s is a %s, not a commit", shortHash(h), obj.Type())
+		}
+	}
+}
+
+// peelToTree follows tags and commits until it reaches a tree. The commit
+// is returned too when there was one.
+func (r *Repository) peelToTree(h hash.Hash) (*object.Tree, *object.Commit, error) {
+	var commit *object.Commit
+	for {
+		obj, err := r.ObjectDB.Get(h)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load object %s: %w", h.String(), err)
+		}
+
+		switch o := obj.(type) {
+		case *object.Tree:
+			return o, commit, nil
+		case *object.Commit:
+			commit = o
+			h = o.Tree
+		case *object.Tag:
+			h = o.Target
+		default:
+			return nil, nil, fmt.Errorf("object %s is a %s, not a tree", shortHash(h), obj.Type())
+		}
+	}
+}
+
+// isHexString reports whether s contains only hexadecimal digits
+func isHexString(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
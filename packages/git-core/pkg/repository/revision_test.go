@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// TestResolveRevision tests names, abbreviations and ancestry suffixes
+func TestResolveRevision(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "one", "two", "three")
+	if err := repo.UpdateRef("refs/tags/v1", commits[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]hash.Hash{
+		"HEAD":                    commits[2],
+		"main":                    commits[2],
+		"refs/heads/main":         commits[2],
+		"heads/main":              commits[2],
+		"v1":                      commits[0],
+		"HEAD~1":                  commits[1],
+		"main~2":                  commits[0],
+		"HEAD^":                   commits[1],
+		"HEAD^^":                  commits[0],
+		"HEAD~1^0":                commits[1],
+		commits[1].String():       commits[1],
+		commits[1].String()[:7]:   commits[1],
+		commits[2].String() + "~": commits[1],
+	}
+	for rev, want := range tests {
+		h, err := repo.ResolveRevision(rev)
+		if err != nil || !h.Equals(want) {
+			t.Errorf("ResolveRevision(%q) = %v (%v), expected %s", rev, h, err, want.String())
+		}
+	}
+
+	for _, rev := range []string{"", "missing", "HEAD~3", "HEAD^2", "v1^2"} {
+		if _, err := repo.ResolveRevision(rev); err == nil {
+			t.Errorf("Expected error resolving %q", rev)
+		}
+	}
+}
+
+// TestCommitsInRange tests two- and three-dot ranges and exclusions
+func TestCommitsInRange(t *testing.T) {
+	repo := setupBranchyRepo(t)
+	entries, err := repo.Log("", DefaultLogOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits := make(map[string]string)
+	for _, entry := range entries {
+		commits[strings.TrimSpace(entry.Commit.Message)] = entry.Hash.String()
+	}
+
+	sides := map[RangeSide]string{RangeSideNone: "", RangeSideLeft: "<", RangeSideRight: ">"}
+	tests := []struct {
+		specs []string
+		want  string
+	}{
+		{specs: []string{commits["F"] + ".." + commits["G2"]}, want: "G G2"},
+		{specs: []string{commits["F"] + "..." + commits["G2"]}, want: ">G <F <M <D >G2 <B <E"},
+		{specs: []string{"^" + commits["B"], commits["F"], "^" + commits["E"]}, want: "F M D"},
+		{specs: []string{commits["C"] + "..." + commits["C"]}, want: ""},
+		{specs: []string{commits["H"] + "..."}, want: ">I"},
+	}
+	for _, tt := range tests {
+		entries, err := repo.CommitsInRange(tt.specs...)
+		if err != nil {
+			t.Fatalf("CommitsInRange(%q) failed: %v", tt.specs, err)
+		}
+		var got []string
+		for _, entry := range entries {
+			got = append(got, sides[entry.Side]+strings.TrimSpace(entry.Commit.Message))
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("CommitsInRange(%q) = %q, want %q", tt.specs, strings.Join(got, " "), tt.want)
+		}
+	}
+
+	if _, err := repo.CommitsInRange("missing...HEAD"); err == nil {
+		t.Error("expected an error for an unknown revision")
+	}
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// shallowFile lists the commits whose parents were not fetched, relative to GitDir
+const shallowFile = "shallow"
+
+// ShallowCommits returns the shallow boundary commits, sorted
+func (r *Repository) ShallowCommits() ([]hash.Hash, error) {
+	lines, err := r.readShallowFile()
+	if err != nil {
+		return nil, err
+	}
+
+	commits := make([]hash.Hash, 0, len(lines))
+	for _, line := range lines {
+		h, err := hash.ParseHash(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid shallow entry %q: %w", line, err)
+		}
+		commits = append(commits, h)
+	}
+
+	return commits, nil
+}
+
+// IsShallow reports whether the repository has truncated history
+func (r *Repository) IsShallow() bool {
+	lines, err := r.readShallowFile()
+	return err == nil && len(lines) > 0
+}
+
+// shallowSet returns the shallow boundary commits as a set of hex hashes.
+// History walks treat these commits as having no parents.
+func (r *Repository) shallowSet() map[string]bool {
+	set := make(map[string]bool)
+
+	lines, err := r.readShallowFile()
+	if err != nil {
+		return set
+	}
+	for _, line := range lines {
+		set[line] = true
+	}
+
+	return set
+}
+
+// updateShallow adds and removes boundary commits in the shallow file.
+// The file is deleted once no boundaries remain.
+func (r *Repository) updateShallow(add, remove []string) error {
+	if len(add) == 0 && len(remove) == 0 {
+		return nil
+	}
+
+	lines, err := r.readShallowFile()
+	if err != nil {
+		return err
+	}
+
+	set := make(map[string]bool, len(lines)+len(add))
+	for _, line := range lines {
+		set[line] = true
+	}
+	for _, h := range add {
+		set[h] = true
+	}
+	for _, h := range remove {
+		delete(set, h)
+	}
+
+	shallowPath := filepath.Join(r.GitDir, shallowFile)
+	if len(set) == 0 {
+		if err := os.Remove(shallowPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove shallow file: %w", err)
+		}
+		return nil
+	}
+
+	commits := make([]string, 0, len(set))
+	for h := range set {
+		commits = append(commits, h)
+	}
+	sort.Strings(commits)
+
+	content := strings.Join(commits, "\n") + "\n"
+	if err := WriteFileInRepo(r.GitDir, shallowFile, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write shallow file: %w", err)
+	}
+
+	return nil
+}
+
+// readShallowFile returns the non-empty lines of the shallow file
+func (r *Repository) readShallowFile() ([]string, error) {
+	content, err := os.ReadFile(filepath.Join(r.GitDir, shallowFile))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read shallow file: %w", err)
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+
+	return lines, nil
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// TestUpdateShallow tests adding and removing shallow boundaries
+func TestUpdateShallow(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	if repo.IsShallow() {
+		t.Fatal("New repository should not be shallow")
+	}
+
+	first := "1111111111111111111111111111111111111111"
+	second := "2222222222222222222222222222222222222222"
+
+	if err := repo.updateShallow([]string{second, first, first}, nil); err != nil {
+		t.Fatalf("updateShallow failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(repo.GitDir, "shallow"))
+	if err != nil {
+		t.Fatalf("Failed to read shallow file: %v", err)
+	}
+	if string(content) != first+"\n"+second+"\n" {
+		t.Errorf("Shallow file = %q", content)
+	}
+
+	commits, err := repo.ShallowCommits()
+	if err != nil {
+		t.Fatalf("ShallowCommits failed: %v", err)
+	}
+	if len(commits) != 2 || commits[0].String() != first {
+		t.Errorf("ShallowCommits = %v", commits)
+	}
+	if !repo.IsShallow() {
+		t.Error("Expected repository to be shallow")
+	}
+
+	// Removing every boundary deletes the file
+	if err := repo.updateShallow(nil, []string{first, second}); err != nil {
+		t.Fatalf("updateShallow failed: %v", err)
+	}
+	if repo.IsShallow() {
+		t.Error("Expected repository to no longer be shallow")
+	}
+	if _, err := os.Stat(filepath.Join(repo.GitDir, "shallow")); !os.IsNotExist(err) {
+		t.Error("Expected shallow file to be removed")
+	}
+}
+
+// TestExcludeStrings tests filtering shallow boundaries out of haves
+func TestExcludeStrings(t *testing.T) {
+	result := excludeStrings([]string{"a", "b", "c"}, []string{"b"})
+	if len(result) != 2 || result[0] != "a" || result[1] != "c" {
+		t.Errorf("excludeStrings = %v, want [a c]", result)
+	}
+}
+
+// TestLogStopsAtShallowBoundary tests that shallow commits are treated as roots
+func TestLogStopsAtShallowBoundary(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	commit1 := createTestCommitForHistory(t, repo, "file1.txt", "content1\n", "Commit 1", nil)
+	commit2 := createTestCommitForHistory(t, repo, "file2.txt", "content2\n", "Commit 2", []hash.Hash{commit1})
+	commit3 := createTestCommitForHistory(t, repo, "file3.txt", "content3\n", "Commit 3", []hash.Hash{commit2})
+	if err := repo.UpdateRef("refs/heads/main", commit3); err != nil {
+		t.Fatalf("Failed to update branch: %v", err)
+	}
+
+	if err := repo.updateShallow([]string{commit2.String()}, nil); err != nil {
+		t.Fatalf("updateShallow failed: %v", err)
+	}
+
+	entries, err := repo.Log("", DefaultLogOptions())
+	if err != nil {
+		t.Fatalf("Log failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 log entries, got %d", len(entries))
+	}
+	if len(entries[1].Parents) != 0 {
+		t.Errorf("Expected shallow commit to have no parents, got %v", entries[1].Parents)
+	}
+
+	isAnc, err := repo.isAncestor(commit1.String(), commit3.String())
+	if err != nil {
+		t.Fatalf("isAncestor failed: %v", err)
+	}
+	if isAnc {
+		t.Error("Expected history beyond the shallow boundary to be hidden")
+	}
+
+	// Unshallowing restores the full history
+	if err := repo.updateShallow(nil, []string{commit2.String()}); err != nil {
+		t.Fatalf("updateShallow failed: %v", err)
+	}
+	entries, err = repo.Log("", DefaultLogOptions())
+	if err != nil {
+		t.Fatalf("Log failed: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("Expected 3 log entries, got %d", len(entries))
+	}
+}
+
+// TestValidateShallowOptions tests rejection of contradictory fetch options
+func TestValidateShallowOptions(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	opts := DefaultFetchOptions()
+	opts.Unshallow = true
+	if err := repo.validateShallowOptions(opts); err == nil {
+		t.Error("Expected unshallow of a complete repository to fail")
+	}
+
+	opts = DefaultFetchOptions()
+	opts.Deepen = 2
+	if err := repo.validateShallowOptions(opts); err == nil {
+		t.Error("Expected deepen of a complete repository to fail")
+	}
+
+	if err := repo.updateShallow([]string{"1111111111111111111111111111111111111111"}, nil); err != nil {
+		t.Fatalf("updateShallow failed: %v", err)
+	}
+
+	if err := repo.validateShallowOptions(opts); err != nil {
+		t.Errorf("Expected deepen of a shallow repository to pass: %v", err)
+	}
+
+	opts.Depth = 1
+	if err := repo.validateShallowOptions(opts); err == nil {
+		t.Error("Expected depth and deepen together to fail")
+	}
+
+	opts = DefaultFetchOptions()
+	opts.Unshallow = true
+	opts.ShallowSince = time.Now()
+	if err := repo.validateShallowOptions(opts); err == nil {
+		t.Error("Expected unshallow with shallow-since to fail")
+	}
+
+	if !(FetchOptions{ShallowExclude: []string{"v1.0"}}).reshapesHistory() {
+		t.Error("Expected shallow-exclude to reshape history")
+	}
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"sort"
+	"strings"
+)
+
+// ShortlogOptions configures Shortlog
+type ShortlogOptions struct {
+	// Email groups by email as well as name and reports it, like -e
+	Email bool
+	// Committer groups by committer instead of author, like -c
+	Committer bool
+	// NoMerges leaves out merge commits, like --no-merges
+	NoMerges bool
+	// SortByCount orders contributors by commit count instead of by name,
+	// like -n
+	SortByCount bool
+}
+
+// DefaultShortlogOptions returns default shortlog options
+func DefaultShortlogOptions() ShortlogOptions {
+	return ShortlogOptions{
+		Email:       false,
+		Committer:   false,
+		NoMerges:    false,
+		SortByCount: false,
+	}
+}
+
+// ShortlogEntry summarises one contributor's commits
+type ShortlogEntry struct {
+	Name string
+	// Email is set when grouping by email
+	Email string
+	Count int
+	// Subjects are the first lines of the contributor's commit messages,
+	// oldest first
+	Subjects []string
+}
+
+// Shortlog counts the commits in a revision range per contributor, like
+// git shortlog. revRange is "A..B", "A...B", a single revision, or empty
+// for HEAD. Identities are canonicalized with the repository's .mailmap.
+func (r *Repository) Shortlog(revRange string, opts ShortlogOptions) ([]ShortlogEntry, error) {
+	commits, err := r.CommitsInRange(revRange)
+	if err != nil {
+		return nil, err
+	}
+
+	mailmap, err := r.Mailmap()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*ShortlogEntry
+	byKey := make(map[string]*ShortlogEntry)
+
+	// Walk oldest first so each contributor's subjects are in order
+	for i := len(commits) - 1; i >= 0; i-- {
+		commit := commits[i].Commit
+		if opts.NoMerges && len(commit.Parents) > 1 {
+			continue
+		}
+
+		who := commit.Author
+		if opts.Committer {
+			who = commit.Committer
+		}
+		name, email := mailmap.Resolve(who.Name, who.Email)
+
+		key := name
+		if opts.Email {
+			key = name + " <" + email + ">"
+		} else {
+			email = ""
+		}
+
+		entry, ok := byKey[key]
+		if !ok {
+			entry = &ShortlogEntry{Name: name, Email: email}
+			byKey[key] = entry
+			entries = append(entries, entry)
+		}
+		entry.Count++
+		entry.Subjects = append(entry.Subjects, commitSubject(commit.Message))
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if opts.SortByCount && entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		return entries[i].Email < entries[j].Email
+	})
+
+	result := make([]ShortlogEntry, len(entries))
+	for i, entry := range entries {
+		result[i] = *entry
+	}
+	return result, nil
+}
+
+// commitSubject returns the first line of a commit message
+func commitSubject(message string) string {
+	subject, _, _ := strings.Cut(strings.TrimLeft(message, "\n"), "\n")
+	return subject
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// commitAs commits a change to file.txt with the given author, n minutes
+// after a fixed base time
+func commitAs(t *testing.T, repo *Repository, name, email, message string, n int) hash.Hash {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(repo.Path, "file.txt"), []byte(message+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := addFile(repo, "file.txt"); err != nil {
+		t.Fatalf("Failed to add file: %v", err)
+	}
+
+	idx, err := index.Load(filepath.Join(repo.GitDir, "index"))
+	if err != nil {
+		t.Fatalf("Failed to load index: %v", err)
+	}
+	var parents []hash.Hash
+	if head, err := repo.ResolveHEAD(); err == nil {
+		parents = append(parents, head)
+	}
+	author := object.Signature{Name: name, Email: email, When: time.Date(2024, 1, 1, 0, n, 0, 0, time.UTC)}
+	commitHash, err := idx.CreateCommit(repo.Hasher, repo.ObjectDB, index.CommitOptions{
+		Message:   message + "\n",
+		Author:    author,
+		Committer: author,
+		Parents:   parents,
+	})
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if err := repo.UpdateHEAD(commitHash, commitReflogMessage("commit", message)); err != nil {
+		t.Fatalf("Failed to update HEAD: %v", err)
+	}
+	return commitHash
+}
+
+func TestShortlog(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	commitAs(t, repo, "Bob", "bob@example.com", "bob 1", 1)
+	base := commitAs(t, repo, "Bob", "bob@example.com", "bob 2", 2)
+	commitAs(t, repo, "alice", "Alice@Example.com", "alice 1", 3)
+	commitAs(t, repo, "Bob", "bob@work.example.com", "bob 3", 4)
+
+	entries, err := repo.Shortlog("", DefaultShortlogOptions())
+	if err != nil {
+		t.Fatalf("Shortlog failed: %v", err)
+	}
+	expected := []ShortlogEntry{
+		{Name: "Bob", Count: 3, Subjects: []string{"bob 1", "bob 2", "bob 3"}},
+		{Name: "alice", Count: 1, Subjects: []string{"alice 1"}},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+
+	// Grouping by email splits Bob's work address off
+	opts := DefaultShortlogOptions()
+	opts.Email = true
+	opts.SortByCount = true
+	entries, err = repo.Shortlog("", opts)
+	if err != nil {
+		t.Fatalf("Shortlog failed: %v", err)
+	}
+	if len(entries) != 3 || entries[0].Email != "bob@example.com" || entries[0].Count != 2 {
+		t.Errorf("unexpected entries grouped by email: %+v", entries)
+	}
+
+	// A range leaves out commits reachable from its base
+	entries, err = repo.Shortlog(base.String()+"..HEAD", DefaultShortlogOptions())
+	if err != nil {
+		t.Fatalf("Shortlog failed: %v", err)
+	}
+	expected = []ShortlogEntry{
+		{Name: "Bob", Count: 1, Subjects: []string{"bob 3"}},
+		{Name: "alice", Count: 1, Subjects: []string{"alice 1"}},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+}
+
+func TestShortlogMailmap(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	commitAs(t, repo, "Bob", "bob@example.com", "bob 1", 1)
+	commitAs(t, repo, "bobby", "bob@work.example.com", "bob 2", 2)
+	commitAs(t, repo, "alice", "Alice@Example.com", "alice 1", 3)
+
+	mailmap := "Alice Smith <alice@example.com>\nBob <bob@example.com> <bob@work.example.com>\n"
+	if err := os.WriteFile(filepath.Join(repo.Path, ".mailmap"), []byte(mailmap), 0644); err != nil {
+		t.Fatalf("Failed to write .mailmap: %v", err)
+	}
+
+	opts := DefaultShortlogOptions()
+	opts.Email = true
+	entries, err := repo.Shortlog("", opts)
+	if err != nil {
+		t.Fatalf("Shortlog failed: %v", err)
+	}
+	expected := []ShortlogEntry{
+		{Name: "Alice Smith", Email: "Alice@Example.com", Count: 1, Subjects: []string{"alice 1"}},
+		{Name: "Bob", Email: "bob@example.com", Count: 2, Subjects: []string{"bob 1", "bob 2"}},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+}
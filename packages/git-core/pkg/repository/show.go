@@ -0,0 +1,265 @@
+package repository
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/diff"
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// DiffHunk is one hunk of a unified diff
+type DiffHunk = diff.Hunk
+
+// FileDiff describes how one file differs between two trees
+type FileDiff struct {
+	Path string
+	// OldPath is the path a file was renamed or copied from ("" for other
+	// changes)
+	OldPath    string
+	Change     ChangeType
+	OldHash    hash.Hash // nil if added
+	NewHash    hash.Hash // nil if deleted
+	OldMode    object.FileMode
+	NewMode    object.FileMode
+	Binary     bool
+	Insertions int
+	Deletions  int
+	// OldSize and NewSize are the sizes of the two versions in bytes
+	OldSize int
+	NewSize int
+	Hunks   []DiffHunk
+	// Similarity is the percentage of a renamed or copied file's content
+	// that matches its source
+	Similarity int
+
+	// binaryPatch is the Git binary patch of a binary change, when
+	// DiffOptions.BinaryPatches asked for one
+	binaryPatch string
+}
+
+// ShowResult is a commit together with its changes, like git show
+type ShowResult struct {
+	Hash   hash.Hash
+	Commit *object.Commit
+	// Parent is the first parent the diff is against (nil for a root commit)
+	Parent hash.Hash
+	// Files are the changed files, sorted by path
+	Files []FileDiff
+	// Patch is the unified diff of all files
+	Patch string
+}
+
+// Show returns a commit's metadata and its diff against its first parent.
+// Root commits are diffed against the empty tree.
+func (r *Repository) Show(rev string) (*ShowResult, error) {
+	opts := DefaultDiffOptions()
+	opts.Renames = false
+	opts.Hunks = true
+	return r.showCommit(rev, opts)
+}
+
+// showCommit is Show with the given diff options
+func (r *Repository) showCommit(rev string, opts DiffOptions) (*ShowResult, error) {
+	h, err := r.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	commitHash, commit, err := r.peelToCommit(h)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ShowResult{Hash: commitHash, Commit: commit}
+
+	var parentTree hash.Hash
+	if len(commit.Parents) > 0 {
+		result.Parent = commit.Parents[0]
+		tree, _, err := r.peelToTree(commit.Parents[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to load parent tree: %w", err)
+		}
+		parentTree = tree.Hash()
+	}
+
+	result.Files, err = r.DiffTrees(parentTree, commit.Tree, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var patch strings.Builder
+	for i := range result.Files {
+		patch.WriteString(result.Files[i].Patch())
+	}
+	result.Patch = patch.String()
+
+	return result, nil
+}
+
+// ShowFile returns the content of a file at a revision, like git show rev:path
+func (r *Repository) ShowFile(rev, filePath string) ([]byte, error) {
+	h, err := r.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	_, commit, err := r.peelToCommit(h)
+	if err != nil {
+		return nil, err
+	}
+
+	filePath = strings.Trim(path.Clean("/"+strings.ReplaceAll(filePath, "\\", "/")), "/")
+	if filePath == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+
+	content, err := r.getFileAtCommit(filePath, commit)
+	if err != nil {
+		return nil, fmt.Errorf("path '%s' does not exist in '%s': %w", filePath, rev, err)
+	}
+	return content, nil
+}
+
+// diffFile fills in the sizes, line counts and hunks of a file change,
+// or the binary patch of a binary one when opts ask, reading its content
+// with read
+func diffFile(file *FileDiff, opts DiffOptions, read blobReader) error {
+	// Submodule entries point at commits in another repository
+	if file.OldMode == object.ModeGitlink || file.NewMode == object.ModeGitlink {
+		return nil
+	}
+
+	var oldContent, newContent []byte
+	if file.OldHash != nil {
+		content, err := read(file.OldHash)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file.Path, err)
+		}
+		oldContent = content
+	}
+	if file.NewHash != nil {
+		content, err := read(file.NewHash)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file.Path, err)
+		}
+		newContent = content
+	}
+
+	file.OldSize, file.NewSize = len(oldContent), len(newContent)
+	if isBinaryContent(oldContent) || isBinaryContent(newContent) {
+		file.Binary = true
+		if opts.BinaryPatches {
+			patch, err := encodeBinaryPatch(oldContent, newContent)
+			if err != nil {
+				return fmt.Errorf("failed to encode %s: %w", file.Path, err)
+			}
+			file.binaryPatch = patch
+		}
+		return nil
+	}
+
+	file.Hunks = diff.Hunks(diff.SplitLines(oldContent), diff.SplitLines(newContent), opts.LineDiff)
+	for _, hunk := range file.Hunks {
+		for _, line := range hunk.Lines {
+			switch line[0] {
+			case '+':
+				file.Insertions++
+			case '-':
+				file.Deletions++
+			}
+		}
+	}
+	return nil
+}
+
+// Patch formats the change as a git-style unified diff
+func (d *FileDiff) Patch() string {
+	var b strings.Builder
+
+	oldPath := d.Path
+	if d.OldPath != "" {
+		oldPath = d.OldPath
+	}
+	fmt.Fprintf(&b, "diff --git a/%s b/%s\n", oldPath, d.Path)
+	switch d.Change {
+	case ChangeAdded:
+		fmt.Fprintf(&b, "new file mode %06o\n", uint32(d.NewMode))
+	case ChangeDeleted:
+		fmt.Fprintf(&b, "deleted file mode %06o\n", uint32(d.OldMode))
+	default:
+		if d.OldMode != d.NewMode {
+			fmt.Fprintf(&b, "old mode %06o\nnew mode %06o\n", uint32(d.OldMode), uint32(d.NewMode))
+		}
+	}
+	if d.Change == ChangeRenamed {
+		fmt.Fprintf(&b, "similarity index %d%%\nrename from %s\nrename to %s\n", d.Similarity, oldPath, d.Path)
+	}
+	if d.Change == ChangeCopied {
+		fmt.Fprintf(&b, "similarity index %d%%\ncopy from %s\ncopy to %s\n", d.Similarity, oldPath, d.Path)
+	}
+
+	oldHash, newHash := abbrevOrZero(d.OldHash), abbrevOrZero(d.NewHash)
+	if d.OldHash != nil && d.NewHash != nil && d.OldHash.Equals(d.NewHash) {
+		// Mode-only change or exact rename or copy
+		return b.String()
+	}
+	if d.binaryPatch != "" {
+		// Binary patches name the full hashes so they can be checked
+		oldHash, newHash = fullOrZero(d.OldHash, d.NewHash), fullOrZero(d.NewHash, d.OldHash)
+	}
+	if d.Change != ChangeAdded && d.Change != ChangeDeleted && d.OldMode == d.NewMode {
+		fmt.Fprintf(&b, "index %s..%s %06o\n", oldHash, newHash, uint32(d.NewMode))
+	} else {
+		fmt.Fprintf(&b, "index %s..%s\n", oldHash, newHash)
+	}
+
+	oldName, newName := "a/"+oldPath, "b/"+d.Path
+	if d.Change == ChangeAdded {
+		oldName = "/dev/null"
+	}
+	if d.Change == ChangeDeleted {
+		newName = "/dev/null"
+	}
+
+	if d.binaryPatch != "" {
+		b.WriteString("GIT binary patch\n" + d.binaryPatch)
+		return b.String()
+	}
+	if d.Binary {
+		fmt.Fprintf(&b, "Binary files %s and %s differ\n", oldName, newName)
+		return b.String()
+	}
+	if len(d.Hunks) == 0 {
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	for _, hunk := range d.Hunks {
+		b.WriteString(hunk.Header() + "\n")
+		for _, line := range hunk.Lines {
+			b.WriteString(line)
+			if !strings.HasSuffix(line, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+// abbrevOrZero abbreviates a hash to seven digits, or returns zeros for nil
+func abbrevOrZero(h hash.Hash) string {
+	if h == nil {
+		return "0000000"
+	}
+	return shortHash(h)
+}
+
+// fullOrZero returns a hash in full, or as many zeros as other has digits
+// for nil
+func fullOrZero(h, other hash.Hash) string {
+	if h == nil {
+		return strings.Repeat("0", len(other.String()))
+	}
+	return h.String()
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestShow tests a commit's diff against its first parent
+func TestShow(t *testing.T) {
+	repo, commits := setupUndoRepo(t,
+		"one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\n",
+		"one\ntwo\nTHREE\nfour\nfive\nsix\nseven\neight\nnine",
+	)
+
+	if err := os.WriteFile(filepath.Join(repo.Path, "new.txt"), []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := addFile(repo, "new.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createCommit(repo, "Add new.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A modified file, with a missing newline at the end
+	result, err := repo.Show("HEAD~1")
+	if err != nil {
+		t.Fatalf("Show failed: %v", err)
+	}
+	if !result.Hash.Equals(commits[1]) || !result.Parent.Equals(commits[0]) {
+		t.Errorf("Unexpected commit %s with parent %v", result.Hash, result.Parent)
+	}
+	if len(result.Files) != 1 {
+		t.Fatalf("Expected 1 file, got %d", len(result.Files))
+	}
+	file := result.Files[0]
+	if file.Change != ChangeModified || file.Insertions != 2 || file.Deletions != 1 {
+		t.Errorf("Unexpected change %+v", file)
+	}
+	expected := "diff --git a/file.txt b/file.txt\n" +
+		"index " + shortHash(file.OldHash) + ".." + shortHash(file.NewHash) + " 100644\n" +
+		"--- a/file.txt\n" +
+		"+++ b/file.txt\n" +
+		"@@ -1,8 +1,9 @@\n" +
+		" one\n" +
+		" two\n" +
+		"-three\n" +
+		"+THREE\n" +
+		" four\n" +
+		" five\n" +
+		" six\n" +
+		" seven\n" +
+		" eight\n" +
+		"+nine\n" +
+		"\\ No newline at end of file\n"
+	if result.Patch != expected {
+		t.Errorf("Patch =\n%s\nexpected\n%s", result.Patch, expected)
+	}
+
+	// An added file
+	result, err = repo.Show("HEAD")
+	if err != nil {
+		t.Fatalf("Show failed: %v", err)
+	}
+	if len(result.Files) != 1 || result.Files[0].Path != "new.txt" || result.Files[0].Change != ChangeAdded {
+		t.Fatalf("Unexpected files %+v", result.Files)
+	}
+	if hunk := result.Files[0].Hunks[0]; hunk.Header() != "@@ -0,0 +1 @@" {
+		t.Errorf("Unexpected hunk header %s", hunk.Header())
+	}
+
+	// The root commit is diffed against the empty tree
+	result, err = repo.Show(commits[0].String())
+	if err != nil {
+		t.Fatalf("Show of the root commit failed: %v", err)
+	}
+	if result.Parent != nil || len(result.Files) != 1 || result.Files[0].Insertions != 8 {
+		t.Errorf("Unexpected root commit result %+v", result.Files)
+	}
+
+	if _, err := repo.Show("missing"); err == nil {
+		t.Error("Expected an error for an unknown revision")
+	}
+}
+
+// TestShowFile tests reading a file as of a revision
+func TestShowFile(t *testing.T) {
+	repo, _ := setupUndoRepo(t, "first\n", "second\n")
+
+	content, err := repo.ShowFile("HEAD~1", "file.txt")
+	if err != nil {
+		t.Fatalf("ShowFile failed: %v", err)
+	}
+	if string(content) != "first\n" {
+		t.Errorf("ShowFile = %q, expected %q", content, "first\n")
+	}
+
+	content, err = repo.ShowFile("HEAD", "./file.txt")
+	if err != nil || string(content) != "second\n" {
+		t.Errorf("ShowFile = %q (%v), expected %q", content, err, "second\n")
+	}
+
+	if _, err := repo.ShowFile("HEAD", "missing.txt"); err == nil {
+		t.Error("Expected an error for a missing path")
+	}
+}
@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// sparseCheckoutFile is the sparse-checkout pattern file, relative to GitDir
+const sparseCheckoutFile = "info/sparse-checkout"
+
+// SparseCheckout returns the active cone-mode patterns, or nil when
+// sparse-checkout is disabled
+func (r *Repository) SparseCheckout() (*index.SparseCheckout, error) {
+	if enabled, _ := r.Config.GetBool("core", "sparsecheckout"); !enabled {
+		return nil, nil
+	}
+
+	sc, err := index.LoadSparseCheckout(filepath.Join(r.GitDir, sparseCheckoutFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Enabled without patterns: only root files are checked out
+			return index.NewSparseCheckout(nil), nil
+		}
+		return nil, fmt.Errorf("failed to load sparse-checkout patterns: %w", err)
+	}
+
+	return sc, nil
+}
+
+// SetSparseCheckout enables cone-mode sparse-checkout for the given
+// directories and updates the working directory to match
+func (r *Repository) SetSparseCheckout(dirs []string) error {
+	if r.IsBare() {
+		return fmt.Errorf("sparse-checkout requires a working tree")
+	}
+
+	sc := index.NewSparseCheckout(dirs)
+	if err := WriteFileInRepo(r.GitDir, sparseCheckoutFile, sc.Serialize(), 0644); err != nil {
+		return fmt.Errorf("failed to write sparse-checkout patterns: %w", err)
+	}
+
+	r.Config.SetBool("core", "sparsecheckout", true)
+	r.Config.SetBool("core", "sparsecheckoutcone", true)
+	if err := r.Config.Save(filepath.Join(r.GitDir, "config")); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	return r.applySparseCheckout(sc)
+}
+
+// DisableSparseCheckout turns sparse-checkout off and restores all tracked files
+func (r *Repository) DisableSparseCheckout() error {
+	r.Config.SetBool("core", "sparsecheckout", false)
+	if err := r.Config.Save(filepath.Join(r.GitDir, "config")); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	return r.applySparseCheckout(nil)
+}
+
+// applySparseCheckout reconciles the working directory with the index:
+// tracked files inside the cone are written, unmodified files outside it
+// are removed. Locally modified files are left in place.
+func (r *Repository) applySparseCheckout(sc *index.SparseCheckout) error {
+	indexPath := filepath.Join(r.GitDir, "index")
+	idx, err := index.Load(indexPath)
+	if err != nil {
+		return fmt.Errorf("failed to load index: %w", err)
+	}
+
+	workTreePath := r.WorkTree()
+
+	for _, entry := range idx.Entries {
+		// Submodule commits are only recorded in the index
+		if entry.Mode == index.FileModeGitlink {
+			continue
+		}
+
+		filePath := filepath.Join(workTreePath, entry.Path)
+		_, statErr := os.Lstat(filePath)
+		present := statErr == nil
+
+		if sc == nil || sc.Includes(entry.Path) {
+			if present {
+				continue
+			}
+
+			// Restore the file from the object database
+			blobObj, err := r.ObjectDB.Get(entry.Hash)
+			if err != nil {
+				return fmt.Errorf("failed to load blob for %s: %w", entry.Path, err)
+			}
+
+			blob, ok := blobObj.(*object.Blob)
+			if !ok {
+				return fmt.Errorf("object is not a blob: %s", entry.Path)
+			}
+
+			info, err := writeWorkTreeFile(workTreePath, entry.Path, blob.Content(), object.FileMode(entry.Mode))
+			if err != nil {
+				return err
+			}
+
+			// Refresh stat data so status sees the file as unmodified
+			entry.CTime = info.ModTime()
+			entry.MTime = info.ModTime()
+			entry.Size = uint32(info.Size())
+			continue
+		}
+
+		if !present {
+			continue
+		}
+
+		// Keep local modifications rather than losing them
+		modified, err := entry.IsModified(workTreePath)
+		if err != nil {
+			return fmt.Errorf("failed to check %s: %w", entry.Path, err)
+		}
+		if modified {
+			continue
+		}
+
+		if err := os.Remove(filePath); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", entry.Path, err)
+		}
+		removeEmptyParents(workTreePath, filepath.Dir(filePath))
+	}
+
+	if err := idx.Save(indexPath); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+
+	return nil
+}
+
+// removeEmptyParents removes empty directories from dir up to (not including) root
+func removeEmptyParents(root, dir string) {
+	for dir != root && len(dir) > len(root) {
+		if err := os.Remove(dir); err != nil {
+			// Not empty or already gone
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// setupSparseRepo creates a repository with files in several top-level directories
+func setupSparseRepo(t *testing.T) *Repository {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	if err := Init(tmpDir, DefaultInitOptions()); err != nil {
+		t.Fatalf("Failed to initialize repository: %v", err)
+	}
+
+	repo, err := Open(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to open repository: %v", err)
+	}
+
+	for _, file := range []string{"README.md", "app/main.go", "lib/lib.go", "lib/util/util.go"} {
+		fullPath := filepath.Join(tmpDir, file)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(fullPath, []byte(file+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if err := addFile(repo, file); err != nil {
+			t.Fatalf("Failed to add file: %v", err)
+		}
+	}
+
+	if _, err := createCommit(repo, "Initial commit"); err != nil {
+		t.Fatalf("Failed to create commit: %v", err)
+	}
+
+	return repo
+}
+
+// TestSetSparseCheckout tests narrowing and restoring the working directory
+func TestSetSparseCheckout(t *testing.T) {
+	repo := setupSparseRepo(t)
+
+	if err := repo.SetSparseCheckout([]string{"app"}); err != nil {
+		t.Fatalf("SetSparseCheckout failed: %v", err)
+	}
+
+	if !fileExists(filepath.Join(repo.Path, "README.md")) || !fileExists(filepath.Join(repo.Path, "app/main.go")) {
+		t.Error("Expected files inside the cone to remain")
+	}
+	if dirExists(filepath.Join(repo.Path, "lib")) {
+		t.Error("Expected lib directory to be removed")
+	}
+
+	// Patterns persist across opens
+	reopened, err := Open(repo.Path)
+	if err != nil {
+		t.Fatalf("Failed to reopen repository: %v", err)
+	}
+	sparse, err := reopened.SparseCheckout()
+	if err != nil {
+		t.Fatalf("SparseCheckout failed: %v", err)
+	}
+	if sparse == nil || len(sparse.Directories()) != 1 || sparse.Directories()[0] != "app" {
+		t.Fatalf("Unexpected sparse-checkout state: %v", sparse)
+	}
+
+	// Excluded files are not reported as deleted
+	idx, err := index.Load(filepath.Join(repo.GitDir, "index"))
+	if err != nil {
+		t.Fatalf("Failed to load index: %v", err)
+	}
+	if err := reopened.checkUncommittedChanges(idx); err != nil {
+		t.Errorf("Expected no uncommitted changes: %v", err)
+	}
+
+	result, err := reopened.VerifyCheckout()
+	if err != nil {
+		t.Fatalf("VerifyCheckout failed: %v", err)
+	}
+	if !result.Clean {
+		t.Errorf("Expected clean checkout, mismatches: %v", result.Mismatches())
+	}
+
+	if err := reopened.DisableSparseCheckout(); err != nil {
+		t.Fatalf("DisableSparseCheckout failed: %v", err)
+	}
+	if !fileExists(filepath.Join(repo.Path, "lib/lib.go")) || !fileExists(filepath.Join(repo.Path, "lib/util/util.go")) {
+		t.Error("Expected excluded files to be restored")
+	}
+}
+
+// TestSparseCheckoutKeepsModifiedFiles tests that local changes are not discarded
+func TestSparseCheckoutKeepsModifiedFiles(t *testing.T) {
+	repo := setupSparseRepo(t)
+
+	if err := os.WriteFile(filepath.Join(repo.Path, "lib/lib.go"), []byte("changed\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := repo.SetSparseCheckout([]string{"app"}); err != nil {
+		t.Fatalf("SetSparseCheckout failed: %v", err)
+	}
+
+	if !fileExists(filepath.Join(repo.Path, "lib/lib.go")) {
+		t.Error("Expected modified file to be kept")
+	}
+	if fileExists(filepath.Join(repo.Path, "lib/util/util.go")) {
+		t.Error("Expected unmodified file to be removed")
+	}
+}
+
+// TestSparseCheckoutRestoresSymlinksAndSkipsGitlinks tests that entries
+// coming back into the cone keep their type
+func TestSparseCheckoutRestoresSymlinksAndSkipsGitlinks(t *testing.T) {
+	repo := setupSparseRepo(t)
+
+	target, err := repo.ObjectDB.Put(object.NewBlobFromString("lib.go"))
+	if err != nil {
+		t.Fatalf("Failed to store blob: %v", err)
+	}
+	submodule, err := hash.ParseHash("0123456789abcdef0123456789abcdef01234567")
+	if err != nil {
+		t.Fatalf("Failed to parse hash: %v", err)
+	}
+
+	indexPath := filepath.Join(repo.GitDir, "index")
+	idx, err := index.Load(indexPath)
+	if err != nil {
+		t.Fatalf("Failed to load index: %v", err)
+	}
+	idx.AddEntry(&index.Entry{Mode: index.FileModeSymlink, Hash: target, Path: "lib/link"})
+	idx.AddEntry(&index.Entry{Mode: index.FileModeGitlink, Hash: submodule, Path: "lib/sub"})
+	if err := idx.Save(indexPath); err != nil {
+		t.Fatalf("Failed to save index: %v", err)
+	}
+
+	if err := repo.SetSparseCheckout([]string{"app"}); err != nil {
+		t.Fatalf("SetSparseCheckout failed: %v", err)
+	}
+	if err := repo.DisableSparseCheckout(); err != nil {
+		t.Fatalf("DisableSparseCheckout failed: %v", err)
+	}
+
+	link, err := os.Readlink(filepath.Join(repo.Path, "lib/link"))
+	if err != nil {
+		t.Fatalf("Expected lib/link to be restored as a symlink: %v", err)
+	}
+	if link != "lib.go" {
+		t.Errorf("Symlink target = %q, want %q", link, "lib.go")
+	}
+	if _, err := os.Lstat(filepath.Join(repo.Path, "lib/sub")); !os.IsNotExist(err) {
+		t.Errorf("Expected gitlink to be left out of the worktree, got %v", err)
+	}
+}
+
+// TestCheckoutRespectsSparseCheckout tests that branch switches skip excluded files
+func TestCheckoutRespectsSparseCheckout(t *testing.T) {
+	repo := setupSparseRepo(t)
+
+	head, err := repo.ResolveHEAD()
+	if err != nil {
+		t.Fatalf("Failed to resolve HEAD: %v", err)
+	}
+	if err := repo.CreateBranch("feature", head); err != nil {
+		t.Fatalf("Failed to create branch: %v", err)
+	}
+	if err := repo.SetSparseCheckout([]string{"app"}); err != nil {
+		t.Fatalf("SetSparseCheckout failed: %v", err)
+	}
+
+	if err := switchBranch(repo, "feature"); err != nil {
+		t.Fatalf("Failed to switch branch: %v", err)
+	}
+
+	if !fileExists(filepath.Join(repo.Path, "app/main.go")) {
+		t.Error("Expected included file to be checked out")
+	}
+	if fileExists(filepath.Join(repo.Path, "lib/lib.go")) {
+		t.Error("Expected excluded file to stay absent")
+	}
+
+	// Excluded files stay tracked so the next commit keeps them
+	idx, err := index.Load(filepath.Join(repo.GitDir, "index"))
+	if err != nil {
+		t.Fatalf("Failed to load index: %v", err)
+	}
+	if !idx.HasEntry("lib/lib.go") {
+		t.Error("Expected excluded file to remain in the index")
+	}
+}
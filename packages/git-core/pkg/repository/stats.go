@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RepositoryStats summarizes storage use and refs, like git count-objects -v.
+// Sizes are in bytes as stored, so they can be compared against storage quotas.
+type RepositoryStats struct {
+	// LooseObjects is the number of loose objects
+	LooseObjects int
+	// LooseSize is the size of all loose objects
+	LooseSize int64
+	// InPack is the number of objects in packs
+	InPack int
+	// Packs is the number of packfiles
+	Packs int
+	// PackSize is the size of all files in objects/pack
+	PackSize int64
+	// TotalSize is the size of every file in the git directory
+	TotalSize int64
+	// Branches is the number of refs under refs/heads/
+	Branches int
+	// RemoteBranches is the number of refs under refs/remotes/
+	RemoteBranches int
+	// Tags is the number of refs under refs/tags/
+	Tags int
+	// OtherRefs is the number of other refs, such as notes or stash
+	OtherRefs int
+}
+
+// Stats counts objects, packs and refs and measures the repository's size
+func (r *Repository) Stats() (*RepositoryStats, error) {
+	stats := &RepositoryStats{}
+
+	storage := newFileStorage(r.ObjectsPath(), r.Hasher)
+	loose, err := storage.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	for _, h := range loose {
+		info, err := os.Stat(storage.objectPath(h))
+		if err != nil {
+			continue
+		}
+		stats.LooseObjects++
+		stats.LooseSize += info.Size()
+	}
+	packs := NewPackStorage(storage, filepath.Join(r.ObjectsPath(), "pack"), r.Hasher)
+	defer packs.Close()
+	stats.InPack, err = packs.countPacked()
+	if err != nil {
+		return nil, err
+	}
+
+	packDir := filepath.Join(r.ObjectsPath(), "pack")
+	entries, err := os.ReadDir(packDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read pack directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if strings.HasSuffix(entry.Name(), ".pack") {
+			stats.Packs++
+		}
+		stats.PackSize += info.Size()
+	}
+
+	err = filepath.Walk(r.GitDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			stats.TotalSize += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure repository: %w", err)
+	}
+
+	refs, err := r.ListRefs("refs/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs: %w", err)
+	}
+	for _, ref := range refs {
+		switch {
+		case strings.HasPrefix(ref, "refs/heads/"):
+			stats.Branches++
+		case strings.HasPrefix(ref, "refs/remotes/"):
+			stats.RemoteBranches++
+		case strings.HasPrefix(ref, "refs/tags/"):
+			stats.Tags++
+		default:
+			stats.OtherRefs++
+		}
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"testing"
+)
+
+// TestStats tests object, pack and ref counts before and after a repack
+func TestStats(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "one", "two")
+	if err := repo.UpdateRef("refs/tags/v1", commits[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateRef("refs/remotes/origin/main", commits[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateRef("refs/notes/commits", commits[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := repo.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.LooseObjects != 6 || stats.LooseSize == 0 || stats.InPack != 0 || stats.Packs != 0 || stats.PackSize != 0 {
+		t.Errorf("Unexpected object stats %+v", stats)
+	}
+	if stats.Branches != 1 || stats.RemoteBranches != 1 || stats.Tags != 1 || stats.OtherRefs != 1 {
+		t.Errorf("Unexpected ref counts %+v", stats)
+	}
+	if stats.TotalSize <= stats.LooseSize {
+		t.Errorf("TotalSize %d should include more than the objects", stats.TotalSize)
+	}
+
+	opts := DefaultGCOptions()
+	opts.Repack = true
+	if _, err := repo.GC(opts); err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+
+	stats, err = repo.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.Packs != 1 || stats.InPack != 6 || stats.LooseObjects != 0 || stats.PackSize == 0 || stats.TotalSize < stats.LooseSize+stats.PackSize {
+		t.Errorf("Unexpected stats after repack %+v", stats)
+	}
+}
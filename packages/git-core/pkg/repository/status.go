@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/merge"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// Status is the work tree status together with what git status prints
+// above the file lists: the current branch, its upstream and any
+// operation in progress
+type Status struct {
+	*index.Status
+
+	// Head is the commit HEAD points to, or nil on an unborn branch
+	Head hash.Hash
+
+	// Branch is the current branch, empty when HEAD is detached
+	Branch string
+
+	// Detached reports whether HEAD points directly at a commit
+	Detached bool
+
+	// Upstream is the branch the current branch tracks, or nil
+	Upstream *Upstream
+
+	// UpstreamGone reports that the upstream's tracking ref no longer
+	// exists, so Ahead and Behind are unknown
+	UpstreamGone bool
+
+	// Ahead is the number of commits on HEAD that the upstream lacks
+	Ahead int
+
+	// Behind is the number of commits on the upstream that HEAD lacks
+	Behind int
+
+	// Operation is the multi-step operation in progress, if any
+	Operation *OperationState
+}
+
+// Status computes the work tree status and the branch, upstream and
+// operation headers shown by git status
+func (r *Repository) Status(opts index.StatusOptions) (*Status, error) {
+	head, err := r.HEAD()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HEAD: %w", err)
+	}
+
+	status := &Status{}
+	if ref, ok := strings.CutPrefix(head, "ref: "); ok {
+		status.Branch = strings.TrimPrefix(ref, "refs/heads/")
+		// An unborn branch has no commit yet
+		status.Head, _ = r.ResolveRef(ref)
+	} else {
+		status.Detached = true
+		status.Head, err = hash.ParseHash(head)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HEAD: %w", err)
+		}
+	}
+
+	var headCommit *object.Commit
+	if status.Head != nil {
+		if _, headCommit, err = r.peelToCommit(status.Head); err != nil {
+			return nil, fmt.Errorf("failed to load HEAD commit: %w", err)
+		}
+	}
+
+	idx, err := index.Load(filepath.Join(r.GitDir, "index"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	if opts.Sparse == nil {
+		if opts.Sparse, err = r.SparseCheckout(); err != nil {
+			return nil, fmt.Errorf("failed to load sparse-checkout: %w", err)
+		}
+	}
+	status.Status, err = index.GetStatus(r.WorkTree(), idx, headCommit, r.ObjectDB, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status: %w", err)
+	}
+
+	if status.Branch != "" && r.BranchExists(status.Branch) {
+		if err := r.fillUpstreamStatus(status); err != nil {
+			return nil, err
+		}
+	}
+
+	status.Operation, err = r.OperationState()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read operation state: %w", err)
+	}
+
+	return status, nil
+}
+
+// fillUpstreamStatus records the current branch's upstream and how far
+// HEAD has diverged from it
+func (r *Repository) fillUpstreamStatus(status *Status) error {
+	upstream, err := r.GetUpstream(status.Branch)
+	if err != nil || upstream == nil {
+		return err
+	}
+	status.Upstream = upstream
+
+	tip, err := r.ResolveRef(upstream.TrackingRef())
+	if err != nil {
+		status.UpstreamGone = true
+		return nil
+	}
+	tip, _, err = r.peelToCommit(tip)
+	if err != nil {
+		return fmt.Errorf("failed to load upstream commit: %w", err)
+	}
+
+	status.Ahead, status.Behind, err = merge.AheadBehind(r.ObjectDB, status.Head, tip)
+	if err != nil {
+		return fmt.Errorf("failed to count commits: %w", err)
+	}
+	return nil
+}
+
+// PorcelainV2 renders the status like git status --porcelain=v2
+// --branch: the branch headers followed by one record per changed file
+func (s *Status) PorcelainV2() string {
+	var sb strings.Builder
+
+	if s.Head != nil {
+		fmt.Fprintf(&sb, "# branch.oid %s\n", s.Head.String())
+	} else {
+		sb.WriteString("# branch.oid (initial)\n")
+	}
+	if s.Detached {
+		sb.WriteString("# branch.head (detached)\n")
+	} else {
+		fmt.Fprintf(&sb, "# branch.head %s\n", s.Branch)
+	}
+	if s.Upstream != nil {
+		fmt.Fprintf(&sb, "# branch.upstream %s\n", shortRefName(s.Upstream.TrackingRef()))
+		if !s.UpstreamGone {
+			fmt.Fprintf(&sb, "# branch.ab +%d -%d\n", s.Ahead, s.Behind)
+		}
+	}
+
+	sb.WriteString(s.Status.PorcelainV2())
+	return sb.String()
+}
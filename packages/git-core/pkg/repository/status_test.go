@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// TestStatusHeaders tests the branch, upstream and operation information
+// reported alongside the file lists
+func TestStatusHeaders(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "a\n", "b\n", "c\n")
+	repo.Config.SetRemoteURL("origin", "https://example.com/repo.git")
+
+	status, err := repo.Status(index.DefaultStatusOptions())
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if status.Branch != "main" || status.Detached || !status.Head.Equals(commits[2]) {
+		t.Errorf("Unexpected HEAD state %q detached=%v head=%v", status.Branch, status.Detached, status.Head)
+	}
+	if status.Upstream != nil || status.Operation.InProgress() || !status.IsClean() {
+		t.Errorf("Expected a clean status without upstream, got %+v", status)
+	}
+
+	// The upstream has one commit of its own on top of the first commit
+	_, root, err := repo.peelToCommit(commits[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	side := object.NewCommit()
+	side.Tree = root.Tree
+	side.Parents = commits[:1]
+	side.Author = root.Author
+	side.Committer = root.Committer
+	side.Message = "Upstream\n"
+	sideHash, err := repo.ObjectDB.Put(side)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateRef("refs/remotes/origin/main", sideHash); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetUpstream("main", "origin", "main"); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err = repo.Status(index.DefaultStatusOptions())
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if status.Upstream == nil || status.Upstream.TrackingRef() != "refs/remotes/origin/main" {
+		t.Fatalf("Expected origin/main as upstream, got %+v", status.Upstream)
+	}
+	if status.Ahead != 2 || status.Behind != 1 || status.UpstreamGone {
+		t.Errorf("Expected 2 ahead and 1 behind, got %d, %d (gone=%v)", status.Ahead, status.Behind, status.UpstreamGone)
+	}
+	want := "# branch.oid " + commits[2].String() + "\n# branch.head main\n# branch.upstream origin/main\n# branch.ab +2 -1\n"
+	if got := status.PorcelainV2(); got != want {
+		t.Errorf("Expected porcelain headers %q, got %q", want, got)
+	}
+
+	// The tracking ref disappears, as after a pruning fetch
+	if err := os.Remove(filepath.Join(repo.GitDir, "refs", "remotes", "origin", "main")); err != nil {
+		t.Fatal(err)
+	}
+	status, err = repo.Status(index.DefaultStatusOptions())
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if !status.UpstreamGone || status.Ahead != 0 || status.Behind != 0 {
+		t.Errorf("Expected the upstream to be gone, got %+v", status)
+	}
+
+	// A detached HEAD in the middle of a merge
+	if err := repo.SetHEAD(commits[2].String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo.GitDir, "MERGE_HEAD"), []byte(sideHash.String()+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	status, err = repo.Status(index.DefaultStatusOptions())
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if !status.Detached || status.Branch != "" || status.Upstream != nil {
+		t.Errorf("Expected a detached HEAD, got %+v", status)
+	}
+	if status.Operation.Operation != OperationMerge {
+		t.Errorf("Expected a merge in progress, got %q", status.Operation.Operation)
+	}
+}
+
+// TestStatusUnbornBranch tests the status of a repository with no commits
+func TestStatusUnbornBranch(t *testing.T) {
+	repo, _ := setupUndoRepo(t)
+
+	status, err := repo.Status(index.DefaultStatusOptions())
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if status.Branch != "main" || status.Head != nil || status.Detached {
+		t.Errorf("Expected unborn main, got %+v", status)
+	}
+	if got := status.PorcelainV2(); got != "# branch.oid (initial)\n# branch.head main\n" {
+		t.Errorf("Unexpected porcelain headers %q", got)
+	}
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// maxSymrefDepth is how many symbolic refs are followed before giving up,
+// as in Git
+const maxSymrefDepth = 5
+
+// SymbolicRef returns the ref a symbolic ref such as HEAD or
+// refs/remotes/origin/HEAD points to, like git symbolic-ref
+func (r *Repository) SymbolicRef(name string) (string, error) {
+	if err := checkSymbolicRefName(name); err != nil {
+		return "", err
+	}
+	target, err := r.readSymbolicRef(name)
+	if err != nil {
+		return "", err
+	}
+	if target == "" {
+		return "", fmt.Errorf("ref %s is not a symbolic ref", name)
+	}
+	return target, nil
+}
+
+// SetSymbolicRef points name at target, creating the symbolic ref or
+// replacing its value. The target need not exist yet, as with HEAD on an
+// unborn branch.
+func (r *Repository) SetSymbolicRef(name, target string) error {
+	if err := checkSymbolicRefName(name); err != nil {
+		return err
+	}
+	if err := checkRefName(target); err != nil {
+		return fmt.Errorf("invalid symbolic ref target: %w", err)
+	}
+
+	tx := r.BeginRefTx()
+	if err := tx.queue(&refTxUpdate{name: name, symref: target}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteSymbolicRef deletes a symbolic ref, leaving the ref it points to
+func (r *Repository) DeleteSymbolicRef(name string) error {
+	if name == "HEAD" {
+		return fmt.Errorf("cannot delete HEAD")
+	}
+	if _, err := r.SymbolicRef(name); err != nil {
+		return err
+	}
+
+	return r.DeleteRef(name)
+}
+
+// readSymbolicRef returns the target of a ref, or "" when it holds a hash
+func (r *Repository) readSymbolicRef(name string) (string, error) {
+	content, err := r.readRef(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read ref %s: %w", name, err)
+	}
+	target, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "ref: ")
+	if !ok {
+		return "", nil
+	}
+	return target, nil
+}
+
+// followSymbolicRefs returns the ref a chain of symbolic refs starting at
+// name ends at, which may not exist yet
+func (r *Repository) followSymbolicRefs(name string) (string, error) {
+	for depth := 0; depth <= maxSymrefDepth; depth++ {
+		target, err := r.readSymbolicRef(name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return name, nil
+			}
+			return "", err
+		}
+		if target == "" {
+			return name, nil
+		}
+		name = target
+	}
+	return "", fmt.Errorf("too many levels of symbolic refs at %s", name)
+}
+
+// checkSymbolicRefName accepts HEAD and valid names under refs/
+func checkSymbolicRefName(name string) error {
+	if name == "HEAD" {
+		return nil
+	}
+	return checkRefName(name)
+}
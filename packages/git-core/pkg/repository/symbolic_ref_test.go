@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestSymbolicRef tests creating, resolving and deleting a symbolic ref
+// other than HEAD
+func TestSymbolicRef(t *testing.T) {
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	a := commitTestTree(t, repo, "A", map[string]string{"f": "a\n"})
+	b := commitTestTree(t, repo, "B", map[string]string{"f": "b\n"}, a)
+	if err := repo.UpdateRef("refs/remotes/origin/main", a); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.SetSymbolicRef("refs/remotes/origin/HEAD", "refs/remotes/origin/main"); err != nil {
+		t.Fatalf("SetSymbolicRef failed: %v", err)
+	}
+	if target, err := repo.SymbolicRef("refs/remotes/origin/HEAD"); err != nil || target != "refs/remotes/origin/main" {
+		t.Errorf("SymbolicRef = %q, %v", target, err)
+	}
+	if target, err := repo.SymbolicRef("HEAD"); err != nil || target != "refs/heads/main" {
+		t.Errorf("SymbolicRef HEAD = %q, %v", target, err)
+	}
+	if _, err := repo.SymbolicRef("refs/remotes/origin/main"); err == nil {
+		t.Error("expected an error for a ref that is not symbolic")
+	}
+
+	// Symbolic refs resolve like any other ref
+	if h, err := repo.ResolveRef("refs/remotes/origin/HEAD"); err != nil || !h.Equals(a) {
+		t.Errorf("ResolveRef = %v, %v, want A", h, err)
+	}
+	if h, err := repo.ResolveRevision("origin"); err != nil || !h.Equals(a) {
+		t.Errorf("ResolveRevision origin = %v, %v, want A", h, err)
+	}
+	refs, err := repo.ForEachRef(ForEachRefOptions{Patterns: []string{"refs/remotes/"}, Format: "%(refname:short) %(symref:short)"})
+	if err != nil {
+		t.Fatalf("ForEachRef failed: %v", err)
+	}
+	if len(refs) != 2 || refs[0].Output != "origin/HEAD origin/main" || refs[1].Output != "origin/main " {
+		t.Errorf("ForEachRef = %+v", refs)
+	}
+
+	// Updates go to the ref the symbolic ref points to
+	if err := repo.UpdateRef("refs/remotes/origin/HEAD", b); err != nil {
+		t.Fatalf("UpdateRef failed: %v", err)
+	}
+	if h, err := repo.ResolveRef("refs/remotes/origin/main"); err != nil || !h.Equals(b) {
+		t.Errorf("origin/main = %v, %v, want B", h, err)
+	}
+	if _, err := repo.SymbolicRef("refs/remotes/origin/HEAD"); err != nil {
+		t.Errorf("origin/HEAD is no longer symbolic: %v", err)
+	}
+
+	if err := repo.DeleteSymbolicRef("refs/remotes/origin/HEAD"); err != nil {
+		t.Fatalf("DeleteSymbolicRef failed: %v", err)
+	}
+	if _, err := repo.ResolveRef("refs/remotes/origin/HEAD"); err == nil {
+		t.Error("origin/HEAD still resolves")
+	}
+	if h, err := repo.ResolveRef("refs/remotes/origin/main"); err != nil || !h.Equals(b) {
+		t.Errorf("origin/main = %v, %v after deleting origin/HEAD", h, err)
+	}
+
+	if err := repo.SetSymbolicRef("refs/x", "refs/y"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetSymbolicRef("refs/y", "refs/x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.ResolveRef("refs/x"); err == nil {
+		t.Error("expected an error for a symbolic ref loop")
+	}
+	if err := repo.SetSymbolicRef("HEAD", "main"); err == nil {
+		t.Error("expected an error for a target outside refs/")
+	}
+}
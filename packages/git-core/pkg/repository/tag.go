@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// TagOptions configures CreateTag
+type TagOptions struct {
+	// Message makes an annotated tag. Empty creates a lightweight tag,
+	// unless Signer is set.
+	Message string
+	// Tagger records who created an annotated tag. Nil uses the
+	// configured user at the current time.
+	Tagger *object.Signature
+	// Signer, when set, signs the tag object, like git tag -s
+	Signer object.Signer
+	// Force replaces an existing tag, like git tag -f
+	Force bool
+}
+
+// DefaultTagOptions returns default tag options
+func DefaultTagOptions() TagOptions {
+	return TagOptions{
+		Message: "",
+		Tagger:  nil,
+		Signer:  nil,
+		Force:   false,
+	}
+}
+
+// CreateTag tags the object named by rev as refs/tags/<name>. With a
+// message or a signer an annotated tag object is written; otherwise the
+// tag is a lightweight ref to the object itself. Returns what the tag ref
+// points to.
+func (r *Repository) CreateTag(name, rev string, opts TagOptions) (hash.Hash, error) {
+	ref := "refs/tags/" + name
+	if err := checkRefName(ref); err != nil {
+		return nil, err
+	}
+	if _, err := r.ResolveRef(ref); err == nil && !opts.Force {
+		return nil, fmt.Errorf("tag %s already exists", name)
+	}
+
+	if rev == "" {
+		rev = "HEAD"
+	}
+	target, err := r.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Message == "" && opts.Signer == nil {
+		if err := r.UpdateRef(ref, target); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", ref, err)
+		}
+		return target, nil
+	}
+
+	header, err := object.GetHeader(r.ObjectDB, target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %w", shortHash(target), err)
+	}
+
+	tag := object.NewTag()
+	tag.Target = target
+	tag.TargetType = header.Type
+	tag.Name = name
+	if opts.Tagger != nil {
+		tag.Tagger = *opts.Tagger
+	} else {
+		userName, email := r.Config.GetUser()
+		tag.Tagger = object.Signature{Name: userName, Email: email, When: time.Now()}
+	}
+	tag.Message = opts.Message
+	if tag.Message != "" && !strings.HasSuffix(tag.Message, "\n") {
+		tag.Message += "\n"
+	}
+
+	if opts.Signer != nil {
+		if err := tag.Sign(opts.Signer); err != nil {
+			return nil, err
+		}
+	}
+
+	tagHash, err := r.ObjectDB.Put(tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write tag: %w", err)
+	}
+	if err := r.UpdateRef(ref, tagHash); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", ref, err)
+	}
+	return tagHash, nil
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// TestCreateTag tests lightweight and annotated tags
+func TestCreateTag(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "a\n", "b\n")
+
+	light, err := repo.CreateTag("v1", commits[0].String(), DefaultTagOptions())
+	if err != nil {
+		t.Fatalf("CreateTag failed: %v", err)
+	}
+	if !light.Equals(commits[0]) {
+		t.Error("Expected a lightweight tag to point at the commit")
+	}
+	if _, err := repo.CreateTag("v1", "HEAD", DefaultTagOptions()); err == nil {
+		t.Error("Expected an error creating an existing tag")
+	}
+	if _, err := repo.CreateTag("bad..name", "HEAD", DefaultTagOptions()); err == nil {
+		t.Error("Expected an error for an invalid tag name")
+	}
+
+	opts := DefaultTagOptions()
+	opts.Message = "Release 2"
+	opts.Force = true
+	annotated, err := repo.CreateTag("v1", "", opts)
+	if err != nil {
+		t.Fatalf("Forced CreateTag failed: %v", err)
+	}
+	obj, err := repo.ObjectDB.Get(annotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, ok := obj.(*object.Tag)
+	if !ok {
+		t.Fatalf("Expected a tag object, got %T", obj)
+	}
+	if !tag.Target.Equals(commits[1]) || tag.TargetType != object.CommitType || tag.Name != "v1" {
+		t.Errorf("Unexpected tag %+v", tag)
+	}
+	if tag.Message != "Release 2\n" || tag.GPGSignature != "" {
+		t.Errorf("Unexpected tag message %q", tag.Message)
+	}
+	if h, _, err := repo.peelToCommit(annotated); err != nil || !h.Equals(commits[1]) {
+		t.Error("Expected the tag to peel to HEAD")
+	}
+}
+
+// TestCreateSignedTag tests that a signer makes a signed annotated tag
+func TestCreateSignedTag(t *testing.T) {
+	repo, _ := setupUndoRepo(t, "a\n")
+
+	const signature = "-----BEGIN PGP SIGNATURE-----\n\nwsBcBAABCAAQ\n-----END PGP SIGNATURE-----\n"
+	var signed []byte
+	opts := DefaultTagOptions()
+	opts.Signer = object.SignerFunc(func(payload []byte) (string, error) {
+		signed = payload
+		return signature, nil
+	})
+	h, err := repo.CreateTag("v1", "HEAD", opts)
+	if err != nil {
+		t.Fatalf("CreateTag failed: %v", err)
+	}
+
+	obj, err := repo.ObjectDB.Get(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := obj.(*object.Tag)
+	if tag.GPGSignature != signature {
+		t.Errorf("Expected the signature on the tag, got %q", tag.GPGSignature)
+	}
+	payload, err := tag.SigningPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(payload) != string(signed) {
+		t.Error("Expected the stored tag's payload to be what was signed")
+	}
+}
@@ -0,0 +1,267 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// Trailer is a "Key: Value" line at the end of a commit message, such as
+// Signed-off-by or Co-authored-by
+type Trailer struct {
+	Key   string
+	Value string
+}
+
+// String formats the trailer as a message line
+func (t Trailer) String() string {
+	return t.Key + ": " + t.Value
+}
+
+// TrailerIfExists decides what AddTrailers does when a trailer with the
+// same key is already present, as git interpret-trailers --if-exists
+type TrailerIfExists string
+
+const (
+	// TrailerAddIfDifferentNeighbor adds the trailer unless the last
+	// trailer is identical. This is Git's default.
+	TrailerAddIfDifferentNeighbor TrailerIfExists = "addIfDifferentNeighbor"
+
+	// TrailerAddIfDifferent adds the trailer unless an identical one
+	// exists anywhere in the block
+	TrailerAddIfDifferent TrailerIfExists = "addIfDifferent"
+
+	// TrailerAdd always adds the trailer
+	TrailerAdd TrailerIfExists = "add"
+
+	// TrailerReplace removes trailers with the same key first
+	TrailerReplace TrailerIfExists = "replace"
+
+	// TrailerDoNothing leaves the message alone if the key is present
+	TrailerDoNothing TrailerIfExists = "doNothing"
+)
+
+// SignOffKey is the trailer git commit -s adds, certifying the Developer
+// Certificate of Origin
+const SignOffKey = "Signed-off-by"
+
+// gitGeneratedPrefixes mark lines Git itself adds to trailer blocks. A
+// block with one of them may also hold some ordinary lines.
+var gitGeneratedPrefixes = []string{SignOffKey + ": ", "(cherry picked from commit "}
+
+// trailerLine is a line of a trailer block: a trailer, with its text
+// including continuation lines, or another line kept as it is
+type trailerLine struct {
+	raw     string
+	trailer *Trailer
+}
+
+// ParseTrailers returns the trailers at the end of a commit message, like
+// git interpret-trailers --parse. Continuation lines are unfolded.
+func ParseTrailers(message string) []Trailer {
+	_, block := splitTrailers(message)
+
+	var trailers []Trailer
+	for _, line := range block {
+		if line.trailer != nil {
+			trailers = append(trailers, *line.trailer)
+		}
+	}
+	return trailers
+}
+
+// AddTrailers appends trailers to a commit message, into its existing
+// trailer block or a new one after a blank line, like git
+// interpret-trailers --trailer. ifExists decides what happens to trailers
+// whose key is already present; empty means TrailerAddIfDifferentNeighbor.
+func AddTrailers(message string, trailers []Trailer, ifExists TrailerIfExists) (string, error) {
+	if ifExists == "" {
+		ifExists = TrailerAddIfDifferentNeighbor
+	}
+
+	body, block := splitTrailers(message)
+	for _, t := range trailers {
+		t.Key, t.Value = strings.TrimSpace(t.Key), strings.TrimSpace(t.Value)
+		if !isTrailerKey(t.Key) {
+			return "", fmt.Errorf("invalid trailer key %q", t.Key)
+		}
+
+		var err error
+		if block, err = addTrailer(block, t, ifExists); err != nil {
+			return "", err
+		}
+	}
+
+	if len(block) == 0 {
+		return body, nil
+	}
+
+	var b strings.Builder
+	b.WriteString(body)
+	if body != "" && !strings.HasSuffix(body, "\n\n") {
+		b.WriteString("\n")
+	}
+	for _, line := range block {
+		b.WriteString(line.raw)
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// addTrailer applies one trailer to a trailer block
+func addTrailer(block []trailerLine, t Trailer, ifExists TrailerIfExists) ([]trailerLine, error) {
+	same := func(other *Trailer) bool {
+		return other != nil && strings.EqualFold(other.Key, t.Key)
+	}
+	identical := func(other *Trailer) bool {
+		return same(other) && other.Value == t.Value
+	}
+
+	switch ifExists {
+	case TrailerAdd:
+	case TrailerAddIfDifferentNeighbor:
+		for i := len(block) - 1; i >= 0; i-- {
+			if block[i].trailer != nil {
+				if identical(block[i].trailer) {
+					return block, nil
+				}
+				break
+			}
+		}
+	case TrailerAddIfDifferent:
+		for _, line := range block {
+			if identical(line.trailer) {
+				return block, nil
+			}
+		}
+	case TrailerDoNothing:
+		for _, line := range block {
+			if same(line.trailer) {
+				return block, nil
+			}
+		}
+	case TrailerReplace:
+		kept := block[:0:0]
+		for _, line := range block {
+			if !same(line.trailer) {
+				kept = append(kept, line)
+			}
+		}
+		block = kept
+	default:
+		return nil, fmt.Errorf("unknown if-exists action %q", ifExists)
+	}
+
+	return append(block, trailerLine{raw: t.String(), trailer: &t}), nil
+}
+
+// splitTrailers splits a message into the text before its trailer block
+// and the block itself. Following Git, the block is the last paragraph,
+// never the subject, and qualifies if every line is a trailer, or if it
+// has a line Git generates and at least a quarter of its lines are
+// trailers. Trailing blank and comment lines are dropped.
+func splitTrailers(message string) (string, []trailerLine) {
+	lines := strings.Split(message, "\n")
+	end := len(lines)
+	for end > 0 && (strings.TrimSpace(lines[end-1]) == "" || strings.HasPrefix(lines[end-1], "#")) {
+		end--
+	}
+	lines = lines[:end]
+
+	start := -1
+	for i := end - 1; i >= 0; i-- {
+		if strings.TrimSpace(lines[i]) == "" {
+			start = i + 1
+			break
+		}
+	}
+	body := strings.Join(lines, "\n")
+	if end > 0 {
+		body += "\n"
+	}
+	if start < 0 || strings.TrimSpace(strings.Join(lines[:start], "")) == "" {
+		// A lone paragraph is the subject, not trailers
+		return body, nil
+	}
+
+	var block []trailerLine
+	trailerCount, otherCount, generated := 0, 0, false
+	for _, line := range lines[start:] {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		last := len(block) - 1
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && last >= 0 && block[last].trailer != nil {
+			// A continuation of the previous trailer's value
+			block[last].raw += "\n" + line
+			block[last].trailer.Value += " " + strings.TrimSpace(line)
+			continue
+		}
+
+		for _, prefix := range gitGeneratedPrefixes {
+			if strings.HasPrefix(line, prefix) {
+				generated = true
+			}
+		}
+		if t, ok := parseTrailerLine(line); ok {
+			// Like Git, write the trailer back as "Key: Value"
+			block = append(block, trailerLine{raw: t.String(), trailer: &t})
+			trailerCount++
+		} else {
+			block = append(block, trailerLine{raw: line})
+			if strings.HasPrefix(line, "(cherry picked from commit ") {
+				trailerCount++
+			} else {
+				otherCount++
+			}
+		}
+	}
+
+	if trailerCount == 0 || (otherCount > 0 && !(generated && trailerCount*3 >= otherCount)) {
+		return body, nil
+	}
+	return strings.Join(lines[:start], "\n") + "\n", block
+}
+
+// parseTrailerLine parses a "Key: Value" line. Git also accepts spaces
+// before the colon, as in "Key : Value".
+func parseTrailerLine(line string) (Trailer, bool) {
+	i := strings.IndexByte(line, ':')
+	if i <= 0 {
+		return Trailer{}, false
+	}
+	key := strings.TrimRight(line[:i], " \t")
+	if !isTrailerKey(key) {
+		return Trailer{}, false
+	}
+	return Trailer{Key: key, Value: strings.TrimSpace(line[i+1:])}, true
+}
+
+// isTrailerKey reports whether key is made of letters, digits and
+// hyphens, as Git requires of trailer keys
+func isTrailerKey(key string) bool {
+	if key == "" || key[0] == '-' {
+		return false
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// SignOffTrailer returns the Signed-off-by trailer for a committer
+func SignOffTrailer(committer object.Signature) Trailer {
+	return Trailer{Key: SignOffKey, Value: fmt.Sprintf("%s <%s>", committer.Name, committer.Email)}
+}
+
+// AddSignOff appends the committer's Signed-off-by trailer to a message
+// unless it is already the last trailer, like git commit -s
+func AddSignOff(message string, committer object.Signature) (string, error) {
+	if committer.Name == "" && committer.Email == "" {
+		return "", fmt.Errorf("no committer identity to sign off with")
+	}
+	return AddTrailers(message, []Trailer{SignOffTrailer(committer)}, TrailerAddIfDifferentNeighbor)
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// TestParseTrailers tests finding the trailer block the way Git does
+func TestParseTrailers(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    []Trailer
+	}{
+		{"subject only", "Fixes: 123\n", nil},
+		{"no trailers", "Subject\n\nBody text\n", nil},
+		{
+			"trailer block",
+			"Subject\n\nBody\n\nSigned-off-by: A <a@x>\nCo-authored-by: B <b@x>\n",
+			[]Trailer{{"Signed-off-by", "A <a@x>"}, {"Co-authored-by", "B <b@x>"}},
+		},
+		{
+			"continuation and spaced separator",
+			"Subject\n\nKey : v\n  cont\nCo-authored-by: B <b@x>\n",
+			[]Trailer{{"Key", "v cont"}, {"Co-authored-by", "B <b@x>"}},
+		},
+		{
+			"mixed block with a sign-off",
+			"Subject\n\nsome text\nSigned-off-by: A <a@x>\n",
+			[]Trailer{{"Signed-off-by", "A <a@x>"}},
+		},
+		{
+			"mostly text",
+			"Subject\n\nsome text\nmore text\nanother\nyet more\nSigned-off-by: A <a@x>\n",
+			nil,
+		},
+		{
+			"mixed block without a generated trailer",
+			"Subject\n\nsome text\nReviewed-by: A <a@x>\n",
+			nil,
+		},
+		{
+			"trailing comments",
+			"Subject\n\nAcked-by: A <a@x>\n\n# Please enter the commit message\n",
+			[]Trailer{{"Acked-by", "A <a@x>"}},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := ParseTrailers(tt.message); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestAddTrailers tests appending trailers under each if-exists action
+func TestAddTrailers(t *testing.T) {
+	signOff := Trailer{"Signed-off-by", "A <a@x>"}
+	tests := []struct {
+		name     string
+		message  string
+		trailers []Trailer
+		ifExists TrailerIfExists
+		want     string
+	}{
+		{
+			"new block",
+			"Subject\n\nBody text\n",
+			[]Trailer{signOff},
+			"",
+			"Subject\n\nBody text\n\nSigned-off-by: A <a@x>\n",
+		},
+		{
+			"subject only",
+			"Subject",
+			[]Trailer{signOff},
+			"",
+			"Subject\n\nSigned-off-by: A <a@x>\n",
+		},
+		{
+			"existing block is normalized",
+			"Subject\n\nKey : v\n  cont\nCo-authored-by: B <b@x>\n",
+			[]Trailer{signOff},
+			"",
+			"Subject\n\nKey: v\n  cont\nCo-authored-by: B <b@x>\nSigned-off-by: A <a@x>\n",
+		},
+		{
+			"identical neighbour",
+			"Subject\n\nSigned-off-by: A <a@x>\n",
+			[]Trailer{signOff},
+			TrailerAddIfDifferentNeighbor,
+			"Subject\n\nSigned-off-by: A <a@x>\n",
+		},
+		{
+			"identical but not neighbour",
+			"Subject\n\nSigned-off-by: A <a@x>\nAcked-by: C <c@x>\n",
+			[]Trailer{signOff},
+			TrailerAddIfDifferentNeighbor,
+			"Subject\n\nSigned-off-by: A <a@x>\nAcked-by: C <c@x>\nSigned-off-by: A <a@x>\n",
+		},
+		{
+			"add if different",
+			"Subject\n\nSigned-off-by: A <a@x>\nAcked-by: C <c@x>\n",
+			[]Trailer{signOff},
+			TrailerAddIfDifferent,
+			"Subject\n\nSigned-off-by: A <a@x>\nAcked-by: C <c@x>\n",
+		},
+		{
+			"replace",
+			"Subject\n\nSigned-off-by: Z <z@x>\nAcked-by: C <c@x>\n",
+			[]Trailer{signOff},
+			TrailerReplace,
+			"Subject\n\nAcked-by: C <c@x>\nSigned-off-by: A <a@x>\n",
+		},
+		{
+			"do nothing",
+			"Subject\n\nsigned-off-by: Z <z@x>\n",
+			[]Trailer{signOff},
+			TrailerDoNothing,
+			"Subject\n\nsigned-off-by: Z <z@x>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := AddTrailers(tt.message, tt.trailers, tt.ifExists)
+		if err != nil {
+			t.Errorf("%s: AddTrailers failed: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+
+	if _, err := AddTrailers("Subject\n", []Trailer{{"Bad Key", "v"}}, ""); err == nil {
+		t.Error("Expected an error for an invalid key")
+	}
+	if _, err := AddTrailers("Subject\n", []Trailer{signOff}, "sometimes"); err == nil {
+		t.Error("Expected an error for an unknown action")
+	}
+}
+
+// TestAmendSignOff tests the automatic sign-off when amending
+func TestAmendSignOff(t *testing.T) {
+	repo, _ := setupUndoRepo(t, "a\n")
+	repo.Hooks = NewHookRegistry()
+
+	opts := DefaultAmendOptions()
+	opts.SignOff = true
+	if _, err := repo.AmendCommit(opts); err == nil {
+		t.Error("Expected an error signing off without an identity")
+	}
+
+	committer := object.Signature{Name: "Test User", Email: "test@example.com", When: time.Now()}
+	opts.Committer = &committer
+	for i := 0; i < 2; i++ {
+		result, err := repo.AmendCommit(opts)
+		if err != nil {
+			t.Fatalf("AmendCommit failed: %v", err)
+		}
+		commit, _, err := repo.GetCommit(result.Commit.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []Trailer{{"Signed-off-by", "Test User <test@example.com>"}}
+		if got := ParseTrailers(commit.Message); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected a single sign-off, got %v in %q", got, commit.Message)
+		}
+	}
+}
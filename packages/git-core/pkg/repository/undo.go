@@ -0,0 +1,359 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+const (
+	// undoPrefix starts the reflog message of an undo
+	undoPrefix = "undo: "
+	// redoPrefix starts the reflog message of a redo
+	redoPrefix = "redo: "
+)
+
+// UndoOptions configures Undo and Redo
+type UndoOptions struct {
+	// DryRun describes the action without changing anything
+	DryRun bool
+	// Force discards uncommitted changes in the working tree
+	Force bool
+}
+
+// DefaultUndoOptions returns default undo options
+func DefaultUndoOptions() UndoOptions {
+	return UndoOptions{
+		DryRun: false,
+		Force:  false,
+	}
+}
+
+// UndoAction describes what an Undo or Redo did, or would do
+type UndoAction struct {
+	// Ref is the ref that is moved ("HEAD" when detached)
+	Ref string
+	// From is the commit the ref points at before the action
+	From hash.Hash
+	// To is the commit the ref points at after the action
+	To hash.Hash
+	// Abort is the in-progress operation that is aborted instead of moving
+	// a ref, if any
+	Abort Operation
+	// Step is the reflog message of the step being undone or redone
+	Step string
+	// Description is a human-readable summary of the action
+	Description string
+}
+
+// Undo reverts the last ref-moving operation on the current branch. An
+// operation stopped part way, such as a conflicted merge, is aborted
+// instead. Undone steps are recorded in the reflog so they can be redone.
+func (r *Repository) Undo(opts UndoOptions) (*UndoAction, error) {
+	state, err := r.OperationState()
+	if err != nil {
+		return nil, err
+	}
+	if state.InProgress() {
+		return r.undoOperation(state, opts)
+	}
+
+	ref, entries, err := r.undoReflog()
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk back over pairs of steps and their undos to the newest step
+	// that is still in effect. A redo counts as a step of its own.
+	pending := 0
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Message, undoPrefix) {
+			pending++
+			continue
+		}
+		if pending > 0 {
+			pending--
+			continue
+		}
+
+		if entry.Old.IsZero() {
+			return nil, fmt.Errorf("nothing to undo: %q created %s", entry.Message, displayRef(ref))
+		}
+
+		action := &UndoAction{
+			Ref:  ref,
+			From: entry.New,
+			To:   entry.Old,
+			Step: entry.Message,
+		}
+		action.Description = fmt.Sprintf("move %s from %s back to %s, undoing %q",
+			displayRef(ref), shortHash(entry.New), shortHash(entry.Old), entry.Message)
+
+		return action, r.applyUndoAction(action, undoPrefix+entry.Message, opts)
+	}
+
+	return nil, fmt.Errorf("nothing to undo")
+}
+
+// Redo re-applies the most recent Undo, as long as the branch has not
+// moved since
+func (r *Repository) Redo(opts UndoOptions) (*UndoAction, error) {
+	ref, entries, err := r.undoReflog()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := 0
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Message, redoPrefix) {
+			pending++
+			continue
+		}
+		if !strings.HasPrefix(entry.Message, undoPrefix) {
+			// New work since the last undo replaces what could be redone
+			break
+		}
+		if pending > 0 {
+			pending--
+			continue
+		}
+
+		step := strings.TrimPrefix(entry.Message, undoPrefix)
+		action := &UndoAction{
+			Ref:  ref,
+			From: entry.New,
+			To:   entry.Old,
+			Step: step,
+		}
+		action.Description = fmt.Sprintf("move %s from %s forward to %s, redoing %q",
+			displayRef(ref), shortHash(entry.New), shortHash(entry.Old), step)
+
+		return action, r.applyUndoAction(action, redoPrefix+step, opts)
+	}
+
+	return nil, fmt.Errorf("nothing to redo")
+}
+
+// undoReflog returns the ref Undo and Redo act on and its reflog
+func (r *Repository) undoReflog() (string, []ReflogEntry, error) {
+	ref := "HEAD"
+	if branch, err := r.CurrentBranch(); err == nil {
+		ref = "refs/heads/" + branch
+	}
+
+	entries, err := r.Reflog(ref)
+	if err != nil {
+		return "", nil, err
+	}
+	return ref, entries, nil
+}
+
+// applyUndoAction moves the ref and resets the index and working tree to
+// the action's target, unless this is a dry run
+func (r *Repository) applyUndoAction(action *UndoAction, message string, opts UndoOptions) error {
+	current, err := r.ResolveRef(action.Ref)
+	if action.Ref == "HEAD" {
+		current, err = r.ResolveHEAD()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", displayRef(action.Ref), err)
+	}
+	if !current.Equals(action.From) {
+		return fmt.Errorf("%s has moved to %s since %q; refusing to undo",
+			displayRef(action.Ref), shortHash(current), action.Step)
+	}
+
+	if opts.DryRun {
+		return nil
+	}
+
+	idx, err := r.resetWorkTreeTo(action.To, opts.Force)
+	if err != nil {
+		return err
+	}
+
+	if err := r.writeOrigHead(action.From); err != nil {
+		return err
+	}
+	if err := r.UpdateHEAD(action.To, message); err != nil {
+		return fmt.Errorf("failed to update %s: %w", displayRef(action.Ref), err)
+	}
+
+	if idx != nil {
+		if err := idx.Save(filepath.Join(r.GitDir, "index")); err != nil {
+			return fmt.Errorf("failed to save index: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// resetWorkTreeTo checks out a commit's tree over the working tree, refusing
+// to discard uncommitted changes unless forced. The returned index must be
+// saved by the caller; it is nil for bare repositories.
+func (r *Repository) resetWorkTreeTo(commitHash hash.Hash, force bool) (*index.Index, error) {
+	if r.IsBare() {
+		return nil, nil
+	}
+
+	idx, err := index.Load(filepath.Join(r.GitDir, "index"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	if !force {
+		if err := r.checkUncommittedChanges(idx); err != nil {
+			return nil, fmt.Errorf("uncommitted changes would be lost; use force to discard them")
+		}
+	}
+
+	obj, err := r.ObjectDB.Get(commitHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load commit %s: %w", shortHash(commitHash), err)
+	}
+	commit, ok := obj.(*object.Commit)
+	if !ok {
+		return nil, fmt.Errorf("object %s is not a commit", shortHash(commitHash))
+	}
+
+	if err := r.updateWorkingDirectory(commit.Tree, idx); err != nil {
+		return nil, fmt.Errorf("failed to update working directory: %w", err)
+	}
+
+	return idx, nil
+}
+
+// undoOperation aborts an operation that stopped part way, restoring the
+// state from before it started
+func (r *Repository) undoOperation(state *OperationState, opts UndoOptions) (*UndoAction, error) {
+	head, err := r.ResolveHEAD()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+
+	action := &UndoAction{
+		Ref:   "HEAD",
+		From:  head,
+		To:    head,
+		Abort: state.Operation,
+		Step:  string(state.Operation),
+	}
+
+	switch state.Operation {
+	case OperationMerge:
+		action.Description = "abort the merge in progress and restore the working tree to " + shortHash(head)
+		if opts.DryRun {
+			return action, nil
+		}
+		return action, r.AbortMerge()
+
+	case OperationCherryPick, OperationRevert:
+		action.Description = fmt.Sprintf("abort the %s in progress and restore the working tree to %s", state.Operation, shortHash(head))
+		if opts.DryRun {
+			return action, nil
+		}
+
+		idx, err := r.resetWorkTreeTo(head, true)
+		if err != nil {
+			return nil, err
+		}
+		if idx != nil {
+			if err := idx.Save(filepath.Join(r.GitDir, "index")); err != nil {
+				return nil, fmt.Errorf("failed to save index: %w", err)
+			}
+		}
+		for _, name := range []string{"CHERRY_PICK_HEAD", "REVERT_HEAD", "MERGE_MSG", "MERGE_CONFLICTS", "sequencer"} {
+			os.RemoveAll(filepath.Join(r.GitDir, name))
+		}
+		return action, nil
+
+	case OperationRebase, OperationApplyMailbox:
+		return r.undoRebase(state, action, opts)
+
+	case OperationBisect:
+		start := r.readStateLine(bisectStartFile)
+		if h, err := r.ResolveRevision(start); err == nil {
+			action.To = h
+		}
+		action.Description = "end the bisect session and check out " + start
+		if opts.DryRun {
+			return action, nil
+		}
+		return action, r.BisectReset()
+
+	default:
+		return nil, fmt.Errorf("cannot undo while a %s is in progress", state.Operation)
+	}
+}
+
+// undoRebase aborts a rebase or am, moving the branch back to ORIG_HEAD
+func (r *Repository) undoRebase(state *OperationState, action *UndoAction, opts UndoOptions) (*UndoAction, error) {
+	stateDir := "rebase-merge"
+	if !dirExistsIn(r.GitDir, stateDir) {
+		stateDir = "rebase-apply"
+	}
+
+	orig := r.readStateHash(stateDir + "/orig-head")
+	if orig == nil {
+		orig = r.readStateHash("ORIG_HEAD")
+	}
+	if orig == nil {
+		return nil, fmt.Errorf("cannot undo %s: original commit not recorded", state.Operation)
+	}
+
+	action.To = orig
+	action.Description = fmt.Sprintf("abort the %s in progress and move back to %s", state.Operation, shortHash(orig))
+	if state.Branch != "" {
+		action.Ref = "refs/heads/" + state.Branch
+		action.Description = fmt.Sprintf("abort the %s in progress and move %s back to %s", state.Operation, state.Branch, shortHash(orig))
+	}
+	if opts.DryRun {
+		return action, nil
+	}
+
+	idx, err := r.resetWorkTreeTo(orig, true)
+	if err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("%s (abort): returning to %s", state.Operation, displayRef(action.Ref))
+	if state.Branch != "" {
+		if err := r.UpdateRefWithLog(action.Ref, orig, message); err != nil {
+			return nil, fmt.Errorf("failed to update %s: %w", state.Branch, err)
+		}
+		if err := r.SetHEAD("ref: " + action.Ref); err != nil {
+			return nil, fmt.Errorf("failed to update HEAD: %w", err)
+		}
+	} else if err := r.UpdateHEAD(orig, message); err != nil {
+		return nil, fmt.Errorf("failed to update HEAD: %w", err)
+	}
+
+	if idx != nil {
+		if err := idx.Save(filepath.Join(r.GitDir, "index")); err != nil {
+			return nil, fmt.Errorf("failed to save index: %w", err)
+		}
+	}
+
+	os.RemoveAll(filepath.Join(r.GitDir, stateDir))
+	os.Remove(filepath.Join(r.GitDir, "REBASE_HEAD"))
+
+	return action, nil
+}
+
+// displayRef shortens a ref name for messages
+func displayRef(ref string) string {
+	return strings.TrimPrefix(ref, "refs/heads/")
+}
+
+// shortHash abbreviates a hash for messages
+func shortHash(h hash.Hash) string {
+	s := h.String()
+	if len(s) > 7 {
+		return s[:7]
+	}
+	return s
+}
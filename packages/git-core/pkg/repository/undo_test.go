@@ -0,0 +1,247 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+)
+
+// setupUndoRepo creates a repository with one commit per content, each
+// changing file.txt, and returns the commit hashes in order
+func setupUndoRepo(t *testing.T, contents ...string) (*Repository, []hash.Hash) {
+	t.Helper()
+
+	repo, err := Create(filepath.Join(t.TempDir(), "test-repo"), DefaultInitOptions())
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	commits := []hash.Hash{}
+	for _, content := range contents {
+		commits = append(commits, commitFileContent(t, repo, content))
+	}
+
+	return repo, commits
+}
+
+// commitFileContent commits file.txt with the given content
+func commitFileContent(t *testing.T, repo *Repository, content string) hash.Hash {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(repo.Path, "file.txt"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := addFile(repo, "file.txt"); err != nil {
+		t.Fatalf("Failed to add file: %v", err)
+	}
+	h, err := createCommit(repo, "Write "+content)
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	return h
+}
+
+// expectHead checks the current commit and the content of file.txt
+func expectHead(t *testing.T, repo *Repository, commit hash.Hash, content string) {
+	t.Helper()
+
+	head, err := repo.ResolveHEAD()
+	if err != nil || !head.Equals(commit) {
+		t.Errorf("HEAD = %v, expected %s (%v)", head, commit.String(), err)
+	}
+	data, err := os.ReadFile(filepath.Join(repo.Path, "file.txt"))
+	if err != nil || string(data) != content {
+		t.Errorf("file.txt = %q, expected %q (%v)", data, content, err)
+	}
+}
+
+// TestReflog tests that commits and checkouts are recorded newest first
+func TestReflog(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "one", "two")
+
+	if err := repo.CreateBranch("feature", commits[0]); err != nil {
+		t.Fatalf("Failed to create branch: %v", err)
+	}
+	if err := repo.Checkout("feature", DefaultCheckoutOptions()); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+
+	entries, err := repo.Reflog("HEAD")
+	if err != nil {
+		t.Fatalf("Reflog failed: %v", err)
+	}
+	messages := []string{}
+	for _, entry := range entries {
+		messages = append(messages, entry.Message)
+	}
+	expected := "checkout: moving from main to feature|commit: Write two|commit: Write one"
+	if got := strings.Join(messages, "|"); got != expected {
+		t.Errorf("HEAD reflog = %q, expected %q", got, expected)
+	}
+	if !entries[0].Old.Equals(commits[1]) || !entries[0].New.Equals(commits[0]) {
+		t.Errorf("Unexpected checkout entry %s -> %s", entries[0].Old, entries[0].New)
+	}
+	if !entries[2].Old.IsZero() || entries[2].Committer.When.IsZero() {
+		t.Errorf("Unexpected initial entry %+v", entries[2])
+	}
+
+	branchLog, err := repo.Reflog("refs/heads/main")
+	if err != nil || len(branchLog) != 2 {
+		t.Errorf("Expected 2 main reflog entries, got %d (%v)", len(branchLog), err)
+	}
+
+	if entries, err := repo.Reflog("refs/heads/missing"); err != nil || len(entries) != 0 {
+		t.Errorf("Expected empty reflog, got %v (%v)", entries, err)
+	}
+}
+
+// TestUndoRedo tests undoing and redoing commits, with a dry run first
+func TestUndoRedo(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "one", "two", "three")
+
+	dryRun := DefaultUndoOptions()
+	dryRun.DryRun = true
+	action, err := repo.Undo(dryRun)
+	if err != nil {
+		t.Fatalf("Undo dry run failed: %v", err)
+	}
+	if action.Ref != "refs/heads/main" || !action.To.Equals(commits[1]) || action.Step != "commit: Write three" {
+		t.Errorf("Unexpected action %+v", action)
+	}
+	if !strings.Contains(action.Description, "undoing \"commit: Write three\"") {
+		t.Errorf("Unexpected description %q", action.Description)
+	}
+	expectHead(t, repo, commits[2], "three")
+
+	for _, i := range []int{1, 0} {
+		if _, err := repo.Undo(DefaultUndoOptions()); err != nil {
+			t.Fatalf("Undo failed: %v", err)
+		}
+		expectHead(t, repo, commits[i], []string{"one", "two"}[i])
+	}
+
+	if _, err := repo.Undo(DefaultUndoOptions()); err == nil {
+		t.Error("Expected error undoing the initial commit")
+	}
+
+	if _, err := repo.Redo(DefaultUndoOptions()); err != nil {
+		t.Fatalf("Redo failed: %v", err)
+	}
+	expectHead(t, repo, commits[1], "two")
+
+	// Undoing the redo goes back again, and redo still works afterwards
+	if _, err := repo.Undo(DefaultUndoOptions()); err != nil {
+		t.Fatalf("Undo of redo failed: %v", err)
+	}
+	expectHead(t, repo, commits[0], "one")
+	for _, i := range []int{1, 2} {
+		if _, err := repo.Redo(DefaultUndoOptions()); err != nil {
+			t.Fatalf("Redo failed: %v", err)
+		}
+		expectHead(t, repo, commits[i], []string{"", "two", "three"}[i])
+	}
+	if _, err := repo.Redo(DefaultUndoOptions()); err == nil {
+		t.Error("Expected nothing to redo")
+	}
+
+	// New work clears the redo history
+	if _, err := repo.Undo(DefaultUndoOptions()); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	commitFileContent(t, repo, "four")
+	if _, err := repo.Redo(DefaultUndoOptions()); err == nil {
+		t.Error("Expected redo to be unavailable after a new commit")
+	}
+}
+
+// TestUndoProtectsChanges tests that undo refuses to discard uncommitted work
+func TestUndoProtectsChanges(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "one", "two")
+
+	if err := os.WriteFile(filepath.Join(repo.Path, "file.txt"), []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Undo(DefaultUndoOptions()); err == nil {
+		t.Fatal("Expected undo to refuse with uncommitted changes")
+	}
+	expectHead(t, repo, commits[1], "edited")
+
+	opts := DefaultUndoOptions()
+	opts.Force = true
+	if _, err := repo.Undo(opts); err != nil {
+		t.Fatalf("Forced undo failed: %v", err)
+	}
+	expectHead(t, repo, commits[0], "one")
+
+	orig := repo.readStateHash("ORIG_HEAD")
+	if orig == nil || !orig.Equals(commits[1]) {
+		t.Errorf("ORIG_HEAD = %v, expected %s", orig, commits[1].String())
+	}
+}
+
+// TestUndoRefusesMovedRef tests that a ref moved outside the reflog is not reset
+func TestUndoRefusesMovedRef(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "one", "two")
+
+	if err := repo.UpdateRef("refs/heads/main", commits[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Undo(DefaultUndoOptions()); err == nil || !strings.Contains(err.Error(), "has moved") {
+		t.Errorf("Expected moved ref error, got %v", err)
+	}
+}
+
+// TestUndoMerge tests undoing a fast-forward merge and aborting a conflicted one
+func TestUndoMerge(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "base")
+
+	if err := repo.CreateBranch("feature", commits[0]); err != nil {
+		t.Fatalf("Failed to create branch: %v", err)
+	}
+	if err := switchBranch(repo, "feature"); err != nil {
+		t.Fatal(err)
+	}
+	feature := commitFileContent(t, repo, "feature")
+	if err := switchBranch(repo, "main"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.Merge("feature", DefaultMergeOptions()); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	expectHead(t, repo, feature, "feature")
+
+	action, err := repo.Undo(DefaultUndoOptions())
+	if err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	if action.Step != "merge feature: Fast-forward" {
+		t.Errorf("Unexpected step %q", action.Step)
+	}
+	expectHead(t, repo, commits[0], "base")
+
+	// A conflicting change on main leaves the merge stopped part way
+	mainCommit := commitFileContent(t, repo, "main")
+	result, err := repo.Merge("feature", DefaultMergeOptions())
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if result.Success {
+		t.Fatal("Expected merge conflicts")
+	}
+
+	action, err = repo.Undo(DefaultUndoOptions())
+	if err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	if action.Abort != OperationMerge {
+		t.Errorf("Expected merge to be aborted, got %+v", action)
+	}
+	if fileExistsIn(repo.GitDir, "MERGE_HEAD") {
+		t.Error("MERGE_HEAD should be removed")
+	}
+	expectHead(t, repo, mainCommit, "main")
+}
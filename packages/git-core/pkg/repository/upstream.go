@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Upstream is the branch a local branch tracks, as recorded in
+// branch.<name>.remote and branch.<name>.merge
+type Upstream struct {
+	// Remote is the remote's name, or "." when the upstream is another
+	// local branch
+	Remote string
+
+	// Merge is the upstream branch's ref on the remote, such as
+	// refs/heads/main
+	Merge string
+}
+
+// TrackingRef returns the local ref holding the upstream's last known tip:
+// its remote-tracking branch, or the branch itself for a local upstream
+func (u *Upstream) TrackingRef() string {
+	if u.Remote == "." || !strings.HasPrefix(u.Merge, "refs/heads/") {
+		return u.Merge
+	}
+	return fmt.Sprintf("refs/remotes/%s/%s", u.Remote, strings.TrimPrefix(u.Merge, "refs/heads/"))
+}
+
+// SetUpstream makes a local branch track remoteBranch on a remote, like
+// git branch --set-upstream-to. remote may be "." to track another local
+// branch.
+func (r *Repository) SetUpstream(branch, remote, remoteBranch string) error {
+	if !r.BranchExists(branch) {
+		return fmt.Errorf("branch %s does not exist", branch)
+	}
+	if remote == "" || remoteBranch == "" {
+		return fmt.Errorf("missing remote or remote branch")
+	}
+
+	remoteBranch = strings.TrimPrefix(remoteBranch, "refs/heads/")
+	if remote == "." {
+		if !r.BranchExists(remoteBranch) {
+			return fmt.Errorf("branch %s does not exist", remoteBranch)
+		}
+	} else if _, err := r.GetRemoteURL(remote); err != nil {
+		return err
+	}
+
+	r.Config.SetBranchUpstream(branch, remote, remoteBranch)
+	if err := r.Config.Save(filepath.Join(r.GitDir, "config")); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	return nil
+}
+
+// UnsetUpstream stops a local branch from tracking an upstream, like git
+// branch --unset-upstream
+func (r *Repository) UnsetUpstream(branch string) error {
+	section := fmt.Sprintf("branch.%s", branch)
+	r.Config.Unset(section, "remote")
+	r.Config.Unset(section, "merge")
+	if err := r.Config.Save(filepath.Join(r.GitDir, "config")); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	return nil
+}
+
+// GetUpstream returns the upstream a local branch tracks, or nil when it
+// has none
+func (r *Repository) GetUpstream(branch string) (*Upstream, error) {
+	if !r.BranchExists(branch) {
+		return nil, fmt.Errorf("branch %s does not exist", branch)
+	}
+
+	section := fmt.Sprintf("branch.%s", branch)
+	remote, hasRemote := r.Config.Get(section, "remote")
+	merge, hasMerge := r.Config.Get(section, "merge")
+	if !hasRemote || !hasMerge {
+		return nil, nil
+	}
+
+	return &Upstream{Remote: remote, Merge: merge}, nil
+}
+
+// setPushedUpstreams makes each pushed local branch track the branch it
+// was pushed to, like git push -u
+func (r *Repository) setPushedUpstreams(remote string, refs []refToPush) error {
+	for _, ref := range refs {
+		if isZeroHash(ref.newHash) || !strings.HasPrefix(ref.localName, "refs/heads/") || !strings.HasPrefix(ref.remoteName, "refs/heads/") {
+			continue
+		}
+		if err := r.SetUpstream(strings.TrimPrefix(ref.localName, "refs/heads/"), remote, ref.remoteName); err != nil {
+			return fmt.Errorf("failed to set upstream: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestUpstream tests setting, reading and unsetting a branch's upstream
+func TestUpstream(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "a\n")
+	repo.Config.SetRemoteURL("origin", "https://example.com/repo.git")
+
+	if upstream, err := repo.GetUpstream("main"); err != nil || upstream != nil {
+		t.Fatalf("Expected no upstream, got %+v (%v)", upstream, err)
+	}
+
+	if err := repo.SetUpstream("main", "origin", "refs/heads/trunk"); err != nil {
+		t.Fatalf("SetUpstream failed: %v", err)
+	}
+
+	// The configuration is saved
+	reopened, err := Open(repo.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream, err := reopened.GetUpstream("main")
+	if err != nil {
+		t.Fatalf("GetUpstream failed: %v", err)
+	}
+	if !reflect.DeepEqual(upstream, &Upstream{Remote: "origin", Merge: "refs/heads/trunk"}) {
+		t.Errorf("Unexpected upstream %+v", upstream)
+	}
+	if ref := upstream.TrackingRef(); ref != "refs/remotes/origin/trunk" {
+		t.Errorf("Expected the remote-tracking branch, got %s", ref)
+	}
+
+	if err := repo.CreateBranch("topic", commits[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetUpstream("topic", ".", "main"); err != nil {
+		t.Fatalf("SetUpstream failed: %v", err)
+	}
+	if upstream, _ := repo.GetUpstream("topic"); upstream == nil || upstream.TrackingRef() != "refs/heads/main" {
+		t.Errorf("Expected a local upstream, got %+v", upstream)
+	}
+
+	if err := repo.UnsetUpstream("main"); err != nil {
+		t.Fatalf("UnsetUpstream failed: %v", err)
+	}
+	if upstream, _ := repo.GetUpstream("main"); upstream != nil {
+		t.Errorf("Expected no upstream after unsetting, got %+v", upstream)
+	}
+
+	if err := repo.SetUpstream("missing", "origin", "main"); err == nil {
+		t.Error("Expected an error for an unknown branch")
+	}
+	if err := repo.SetUpstream("main", "upstream", "main"); err == nil {
+		t.Error("Expected an error for an unknown remote")
+	}
+	if err := repo.SetUpstream("main", ".", "missing"); err == nil {
+		t.Error("Expected an error for an unknown local upstream")
+	}
+}
+
+// TestSetPushedUpstreams tests that push -u tracks pushed branches only
+func TestSetPushedUpstreams(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "a\n")
+	repo.Config.SetRemoteURL("origin", "https://example.com/repo.git")
+	if err := repo.CreateBranch("topic", commits[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	zero := "0000000000000000000000000000000000000000"
+	err := repo.setPushedUpstreams("origin", []refToPush{
+		{localName: "refs/heads/main", remoteName: "refs/heads/main", oldHash: zero, newHash: commits[0].String()},
+		{localName: "refs/heads/topic", remoteName: "refs/heads/feature", oldHash: zero, newHash: commits[0].String()},
+		{localName: "", remoteName: "refs/heads/old", oldHash: commits[0].String(), newHash: zero},
+	})
+	if err != nil {
+		t.Fatalf("setPushedUpstreams failed: %v", err)
+	}
+
+	want := map[string]string{"main": "refs/heads/main", "topic": "refs/heads/feature"}
+	for branch, merge := range want {
+		upstream, err := repo.GetUpstream(branch)
+		if err != nil || upstream == nil || upstream.Remote != "origin" || upstream.Merge != merge {
+			t.Errorf("%s: expected origin %s, got %+v (%v)", branch, merge, upstream, err)
+		}
+	}
+}
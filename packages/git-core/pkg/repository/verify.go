@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/hash"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// SignatureCheck describes the signature on a commit or tag
+type SignatureCheck struct {
+	// Object is the checked commit or tag
+	Object hash.Hash
+	// Signed reports whether the object carries a signature at all
+	Signed bool
+	// Format is the signature's format: "openpgp", "x509" or "ssh"
+	Format string
+	// Signature is the signature as stored
+	Signature string
+	// Verification is the verifier's verdict, zero when unsigned
+	object.Verification
+}
+
+// Status returns a one-letter summary of the check, as in Git's %G?
+// format: "G" for a good signature, "B" for a bad one and "N" for none
+func (c *SignatureCheck) Status() string {
+	switch {
+	case !c.Signed:
+		return "N"
+	case c.Valid:
+		return "G"
+	default:
+		return "B"
+	}
+}
+
+// VerifyCommit checks the signature in the gpgsig header of the commit
+// named by rev, like git verify-commit. An unsigned commit is reported
+// with Signed false and the verifier is not called.
+func (r *Repository) VerifyCommit(rev string, verifier object.Verifier) (*SignatureCheck, error) {
+	h, err := r.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	h, _, err = r.peelToCommit(h)
+	if err != nil {
+		return nil, err
+	}
+
+	// Signatures cover the object as stored, not its replacement
+	obj, err := r.unreplacedObjects().Get(h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load commit %s: %w", shortHash(h), err)
+	}
+	commit, ok := obj.(*object.Commit)
+	if !ok {
+		return nil, fmt.Errorf("object %s is not a commit", shortHash(h))
+	}
+
+	payload, err := commit.SigningPayload()
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize commit %s: %w", shortHash(h), err)
+	}
+	return verifySignature(h, payload, commit.GPGSignature, verifier)
+}
+
+// VerifyTag checks the signature of the annotated tag named by rev, like
+// git verify-tag. An unsigned tag is reported with Signed false and the
+// verifier is not called.
+func (r *Repository) VerifyTag(rev string, verifier object.Verifier) (*SignatureCheck, error) {
+	h, err := r.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := r.unreplacedObjects().Get(h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tag %s: %w", shortHash(h), err)
+	}
+	tag, ok := obj.(*object.Tag)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an annotated tag", rev)
+	}
+
+	payload, err := tag.SigningPayload()
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize tag %s: %w", shortHash(h), err)
+	}
+	return verifySignature(h, payload, tag.GPGSignature, verifier)
+}
+
+// verifySignature runs verifier over an object's payload and signature
+func verifySignature(h hash.Hash, payload []byte, signature string, verifier object.Verifier) (*SignatureCheck, error) {
+	check := &SignatureCheck{
+		Object:    h,
+		Signed:    signature != "",
+		Format:    object.SignatureFormat(signature),
+		Signature: signature,
+	}
+	if !check.Signed {
+		return check, nil
+	}
+	if verifier == nil {
+		return nil, fmt.Errorf("no verifier for the signature on %s", shortHash(h))
+	}
+
+	verification, err := verifier.Verify(payload, signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify signature on %s: %w", shortHash(h), err)
+	}
+	check.Verification = verification
+	return check, nil
+}
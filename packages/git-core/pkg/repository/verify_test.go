@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nseba/browser-git/packages/git-core/pkg/index"
+	"github.com/nseba/browser-git/packages/git-core/pkg/object"
+)
+
+// digestSigner "signs" a payload with its SHA-256 digest, which
+// digestVerifier checks, standing in for a real key pair
+var digestSigner = object.SignerFunc(func(payload []byte) (string, error) {
+	sum := sha256.Sum256(payload)
+	return "-----BEGIN SSH SIGNATURE-----\n" + hex.EncodeToString(sum[:]) + "\n-----END SSH SIGNATURE-----\n", nil
+})
+
+var digestVerifier = object.VerifierFunc(func(payload []byte, signature string) (object.Verification, error) {
+	sum := sha256.Sum256(payload)
+	return object.Verification{
+		Valid:  strings.Contains(signature, hex.EncodeToString(sum[:])),
+		Signer: "Test User <test@example.com>",
+		KeyID:  "SHA256:test",
+	}, nil
+})
+
+// TestVerifyCommit tests verifying good, bad and missing commit signatures
+func TestVerifyCommit(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "a\n")
+
+	check, err := repo.VerifyCommit("HEAD", digestVerifier)
+	if err != nil {
+		t.Fatalf("VerifyCommit failed: %v", err)
+	}
+	if check.Signed || check.Status() != "N" {
+		t.Errorf("Expected an unsigned commit, got %+v", check)
+	}
+
+	opts := DefaultAmendOptions()
+	opts.Signer = digestSigner
+	if _, err := repo.AmendCommit(opts); err != nil {
+		t.Fatal(err)
+	}
+	check, err = repo.VerifyCommit("HEAD", digestVerifier)
+	if err != nil {
+		t.Fatalf("VerifyCommit failed: %v", err)
+	}
+	if check.Status() != "G" || check.Format != "ssh" || check.Signer != "Test User <test@example.com>" {
+		t.Errorf("Expected a good SSH signature, got %+v", check)
+	}
+
+	// A signature copied onto a different commit does not verify
+	signed, _, err := repo.GetCommit(check.Object.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := object.NewCommit()
+	forged.Tree = signed.Tree
+	forged.Author = signed.Author
+	forged.Committer = signed.Committer
+	forged.Message = "Forged\n"
+	forged.GPGSignature = signed.GPGSignature
+	forgedHash, err := repo.ObjectDB.Put(forged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check, err = repo.VerifyCommit(forgedHash.String(), digestVerifier)
+	if err != nil {
+		t.Fatalf("VerifyCommit failed: %v", err)
+	}
+	if check.Status() != "B" {
+		t.Errorf("Expected a bad signature, got %+v", check)
+	}
+
+	failing := object.VerifierFunc(func([]byte, string) (object.Verification, error) {
+		return object.Verification{}, errors.New("unknown key")
+	})
+	if _, err := repo.VerifyCommit("HEAD", failing); err == nil {
+		t.Error("Expected the verifier's error")
+	}
+	if _, err := repo.VerifyCommit(commits[0].String(), nil); err != nil {
+		t.Errorf("Expected an unsigned commit to need no verifier, got %v", err)
+	}
+}
+
+// TestVerifyTag tests verifying tag signatures
+func TestVerifyTag(t *testing.T) {
+	repo, _ := setupUndoRepo(t, "a\n")
+
+	opts := DefaultTagOptions()
+	opts.Message = "Release"
+	opts.Signer = digestSigner
+	if _, err := repo.CreateTag("signed", "HEAD", opts); err != nil {
+		t.Fatal(err)
+	}
+	check, err := repo.VerifyTag("signed", digestVerifier)
+	if err != nil {
+		t.Fatalf("VerifyTag failed: %v", err)
+	}
+	if check.Status() != "G" {
+		t.Errorf("Expected a good signature, got %+v", check)
+	}
+
+	opts.Signer = nil
+	if _, err := repo.CreateTag("unsigned", "HEAD", opts); err != nil {
+		t.Fatal(err)
+	}
+	if check, err := repo.VerifyTag("unsigned", digestVerifier); err != nil || check.Signed {
+		t.Errorf("Expected an unsigned tag, got %+v (%v)", check, err)
+	}
+
+	if _, err := repo.CreateTag("light", "HEAD", DefaultTagOptions()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.VerifyTag("light", digestVerifier); err == nil {
+		t.Error("Expected an error verifying a lightweight tag")
+	}
+}
+
+// TestVerifyCommitFromIndex tests that commits signed through the index
+// verify
+func TestVerifyCommitFromIndex(t *testing.T) {
+	repo, commits := setupUndoRepo(t, "a\n")
+
+	idx, err := index.Load(filepath.Join(repo.GitDir, "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := idx.CreateCommit(repo.Hasher, repo.ObjectDB, index.CommitOptions{
+		Message:    "Signed",
+		Parents:    commits,
+		AllowEmpty: true,
+		Signer:     digestSigner,
+	})
+	if err != nil {
+		t.Fatalf("CreateCommit failed: %v", err)
+	}
+	if check, err := repo.VerifyCommit(h.String(), digestVerifier); err != nil || check.Status() != "G" {
+		t.Errorf("Expected a good signature, got %+v (%v)", check, err)
+	}
+}
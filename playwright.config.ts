@@ -73,11 +73,19 @@ export default defineConfig({
     },
   ],
 
-  // Run a simple static server before starting the tests
-  webServer: {
-    command: "npx serve tests/browser -l 3456 --no-request-logging",
-    url: "http://localhost:3456",
-    reuseExistingServer: !process.env.CI,
-    timeout: 10 * 1000,
-  },
+  // Run a simple static server and the git fixture server before starting the tests
+  webServer: [
+    {
+      command: "npx serve tests/browser -l 3456 --no-request-logging",
+      url: "http://localhost:3456",
+      reuseExistingServer: !process.env.CI,
+      timeout: 10 * 1000,
+    },
+    {
+      command: "node tests/browser/fixtures/git-server.mjs 3457",
+      url: "http://localhost:3457/health",
+      reuseExistingServer: !process.env.CI,
+      timeout: 10 * 1000,
+    },
+  ],
 });
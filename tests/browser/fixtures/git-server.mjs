@@ -0,0 +1,148 @@
+/**
+ * Smart HTTP fixture server for the git-core WASM end-to-end tests.
+ *
+ * Builds a small fixture repository with the system git and serves it
+ * through git http-backend, adding the CORS headers the browser needs to
+ * reach it from the test page's origin.
+ *
+ * Usage: node tests/browser/fixtures/git-server.mjs [port]
+ * The repository is served at http://localhost:<port>/sample.git and
+ * http://localhost:<port>/health reports readiness.
+ */
+
+import { execFileSync, spawn } from "node:child_process";
+import { mkdtempSync, rmSync, writeFileSync } from "node:fs";
+import http from "node:http";
+import { tmpdir } from "node:os";
+import path from "node:path";
+
+const port = Number(process.argv[2] || process.env.GIT_FIXTURE_PORT || 3457);
+const root = mkdtempSync(path.join(tmpdir(), "browser-git-fixtures-"));
+
+// Fixed identities and dates keep the fixture's hashes stable
+const gitEnv = {
+  ...process.env,
+  GIT_AUTHOR_NAME: "Fixture Author",
+  GIT_AUTHOR_EMAIL: "author@example.com",
+  GIT_AUTHOR_DATE: "2024-01-01T00:00:00Z",
+  GIT_COMMITTER_NAME: "Fixture Committer",
+  GIT_COMMITTER_EMAIL: "committer@example.com",
+  GIT_COMMITTER_DATE: "2024-01-01T00:00:00Z",
+  GIT_CONFIG_NOSYSTEM: "1",
+  HOME: root,
+};
+
+function git(cwd, ...args) {
+  return execFileSync("git", args, { cwd, env: gitEnv, encoding: "utf8" });
+}
+
+/**
+ * Creates sample.git with two commits on main, a feature branch and a tag
+ */
+function createFixture() {
+  const work = path.join(root, "work");
+  git(root, "init", "--quiet", "--initial-branch=main", work);
+
+  writeFileSync(path.join(work, "README.md"), "# Sample\n");
+  git(work, "add", "README.md");
+  git(work, "commit", "--quiet", "-m", "Initial commit");
+  git(work, "tag", "v1.0");
+
+  writeFileSync(path.join(work, "hello.txt"), "hello from the fixture server\n");
+  git(work, "add", "hello.txt");
+  git(work, "commit", "--quiet", "-m", "Add hello.txt");
+
+  git(work, "branch", "feature", "HEAD~1");
+  git(root, "clone", "--quiet", "--bare", work, path.join(root, "sample.git"));
+  rmSync(work, { recursive: true, force: true });
+}
+
+function setCorsHeaders(res) {
+  res.setHeader("Access-Control-Allow-Origin", "*");
+  res.setHeader("Access-Control-Allow-Methods", "GET, POST, OPTIONS");
+  res.setHeader("Access-Control-Allow-Headers", "*");
+}
+
+/**
+ * Runs git http-backend as a CGI script for one request. The Git-Protocol
+ * header is not passed on, so the fixture always speaks protocol v0 like
+ * servers without v2 support.
+ */
+function serveGit(req, res, body) {
+  const url = new URL(req.url, `http://localhost:${port}`);
+  const backend = spawn("git", ["http-backend"], {
+    env: {
+      ...gitEnv,
+      GIT_PROJECT_ROOT: root,
+      GIT_HTTP_EXPORT_ALL: "1",
+      REQUEST_METHOD: req.method,
+      PATH_INFO: decodeURIComponent(url.pathname),
+      QUERY_STRING: url.search.slice(1),
+      CONTENT_TYPE: req.headers["content-type"] || "",
+      CONTENT_LENGTH: String(body.length),
+      REMOTE_ADDR: req.socket.remoteAddress || "127.0.0.1",
+      HTTP_CONTENT_ENCODING: req.headers["content-encoding"] || "",
+    },
+  });
+
+  const chunks = [];
+  backend.stdout.on("data", (chunk) => chunks.push(chunk));
+  backend.stderr.on("data", (chunk) => process.stderr.write(chunk));
+  backend.on("close", () => {
+    const output = Buffer.concat(chunks);
+    let split = output.indexOf("\r\n\r\n");
+    let separator = 4;
+    if (split === -1) {
+      split = output.indexOf("\n\n");
+      separator = 2;
+    }
+    if (split === -1) {
+      res.writeHead(502).end("invalid CGI response");
+      return;
+    }
+
+    let status = 200;
+    for (const line of output.subarray(0, split).toString().split(/\r?\n/)) {
+      const colon = line.indexOf(":");
+      const name = line.slice(0, colon).trim();
+      const value = line.slice(colon + 1).trim();
+      if (name.toLowerCase() === "status") {
+        status = parseInt(value, 10);
+      } else if (name) {
+        res.setHeader(name, value);
+      }
+    }
+    res.writeHead(status).end(output.subarray(split + separator));
+  });
+  backend.stdin.end(body);
+}
+
+createFixture();
+
+const server = http.createServer((req, res) => {
+  setCorsHeaders(res);
+  if (req.method === "OPTIONS") {
+    res.writeHead(204).end();
+    return;
+  }
+  if (req.url === "/health") {
+    res.writeHead(200).end("ok");
+    return;
+  }
+
+  const chunks = [];
+  req.on("data", (chunk) => chunks.push(chunk));
+  req.on("end", () => serveGit(req, res, Buffer.concat(chunks)));
+});
+
+server.listen(port, () => {
+  console.log(`git fixture server listening on http://localhost:${port}`);
+});
+
+for (const signal of ["SIGINT", "SIGTERM"]) {
+  process.on(signal, () => {
+    server.close();
+    rmSync(root, { recursive: true, force: true });
+    process.exit(0);
+  });
+}
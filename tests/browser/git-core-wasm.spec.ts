@@ -0,0 +1,190 @@
+/**
+ * End-to-end tests for the git-core WASM bindings
+ * Loads the Go-built module on top of an in-memory filesystem and drives the
+ * exported gitCore API the way the TypeScript layer does, catching binding
+ * regressions (argument parsing, result conversion) that Go tests can't see.
+ *
+ * Build the module first with `make -C packages/git-core build-e2e`, or run
+ * everything with `npm run test:browser:wasm`.
+ */
+
+import { test, expect } from "./fixtures";
+import {
+  captureConsoleErrors,
+  GIT_FIXTURE_URL,
+  isGitCoreBuilt,
+  loadGitCore,
+  setupConsoleLogging,
+} from "./helpers";
+
+test.describe("git-core WASM bindings", () => {
+  // The bindings are browser independent, so one engine is enough
+  test.skip(
+    ({ browserName }) => browserName !== "chromium",
+    "git-core WASM tests run on Chromium only",
+  );
+
+  test.beforeEach(async ({ page }) => {
+    setupConsoleLogging(page);
+    test.skip(
+      !(await isGitCoreBuilt(page)),
+      "git-core.wasm not built; run `make -C packages/git-core build-e2e`",
+    );
+    await loadGitCore(page);
+  });
+
+  test("should export the gitCore API", async ({ page }) => {
+    const api = await page.evaluate(() => {
+      const gitCore = (globalThis as any).gitCore;
+      return {
+        version: gitCore.version(),
+        repository: Object.keys(gitCore.repository).sort(),
+        hash: gitCore.hash.hashBlob("hello\n"),
+      };
+    });
+
+    expect(api.version).toMatch(/^\d+\.\d+\.\d+/);
+    for (const name of [
+      "init",
+      "open",
+      "add",
+      "commit",
+      "status",
+      "log",
+      "createBranch",
+      "listBranches",
+      "checkout",
+      "clone",
+    ]) {
+      expect(api.repository).toContain(name);
+    }
+    expect(api.hash).toBe("ce013625030ba8dba906f756967f9e9ca394464a");
+  });
+
+  test("should init, add, commit, branch and checkout", async ({ page }) => {
+    const errors = captureConsoleErrors(page);
+
+    const result = await page.evaluate(() => {
+      const repo = (globalThis as any).gitCore.repository;
+      const memfs = (globalThis as any).memfs;
+
+      const init = repo.init("/repo", { initialBranch: "main" });
+      memfs.writeFile("/repo/README.md", "# Hello\n");
+      memfs.writeFile("/repo/src/index.ts", "export {};\n");
+      const add = repo.add("/repo", ["README.md", "src/index.ts"]);
+      const status = repo.status("/repo");
+      const commit = repo.commit("/repo", "Initial commit", {
+        author: { name: "Test User", email: "test@example.com" },
+      });
+      const clean = repo.status("/repo");
+      const branch = repo.createBranch("/repo", "feature");
+      const branches = repo.listBranches("/repo");
+      const checkout = repo.checkout("/repo", "feature");
+      const current = repo.currentBranch("/repo");
+      const log = repo.log("/repo");
+
+      return {
+        init,
+        add,
+        status,
+        commit,
+        clean,
+        branch,
+        branches,
+        checkout,
+        current,
+        log,
+      };
+    });
+
+    expect(result.init).toMatchObject({ success: true, gitDir: "/repo/.git" });
+    expect(result.add).toMatchObject({ success: true, filesAdded: 2 });
+    expect(result.status.added).toEqual(["README.md", "src/index.ts"]);
+    expect(result.commit.success).toBe(true);
+    expect(result.commit.commitHash).toMatch(/^[0-9a-f]{40}$/);
+    expect(result.clean.isClean).toBe(true);
+    expect(result.branch).toMatchObject({ success: true, branchName: "feature" });
+    expect(result.branches).toMatchObject({
+      branches: ["feature", "main"],
+      currentBranch: "main",
+    });
+    expect(result.checkout).toMatchObject({ success: true, detached: false });
+    expect(result.current.branchName).toBe("feature");
+    expect(result.log.commits).toHaveLength(1);
+    expect(result.log.commits[0]).toMatchObject({
+      hash: result.commit.commitHash,
+      author: "Test User",
+      email: "test@example.com",
+      message: "Initial commit\n",
+    });
+    expect(errors).toEqual([]);
+  });
+
+  test("should clone from the fixture server", async ({ page }) => {
+    const result = await page.evaluate(async (url) => {
+      const repo = (globalThis as any).gitCore.repository;
+      const memfs = (globalThis as any).memfs;
+
+      const progress: string[] = [];
+      const clone = await repo.clone(url, "/sample", {
+        onProgress: (message: string) => progress.push(message),
+      });
+      if (!clone.success) {
+        return { clone, progress };
+      }
+
+      return {
+        clone,
+        progress,
+        files: memfs.readdir("/sample"),
+        hello: memfs.readFile("/sample/hello.txt"),
+        branches: repo.listBranches("/sample"),
+        status: repo.status("/sample"),
+      };
+    }, `${GIT_FIXTURE_URL}/sample.git`);
+
+    expect(result.clone).toMatchObject({ success: true, branch: "main" });
+    expect(result.progress).toContain("Done!");
+    expect(result.files).toEqual([".git", "README.md", "hello.txt"]);
+    expect(result.hello).toBe("hello from the fixture server\n");
+    expect(result.branches.currentBranch).toBe("main");
+    expect(result.status.isClean).toBe(true);
+  });
+
+  test("should list remote refs before cloning", async ({ page }) => {
+    const result = await page.evaluate(async (url) => {
+      const remote = (globalThis as any).gitCore.remote;
+      return {
+        all: await remote.lsRemote(url),
+        heads: await remote.lsRemote(url, { heads: true }),
+      };
+    }, `${GIT_FIXTURE_URL}/sample.git`);
+
+    expect(result.all.success).toBe(true);
+    expect(result.all.refs[0]).toMatchObject({
+      name: "HEAD",
+      target: "refs/heads/main",
+    });
+    expect(result.heads.refs.map((ref: any) => ref.name)).toEqual([
+      "refs/heads/feature",
+      "refs/heads/main",
+    ]);
+  });
+
+  test("should report errors as results instead of throwing", async ({
+    page,
+  }) => {
+    const result = await page.evaluate(async (url) => {
+      const repo = (globalThis as any).gitCore.repository;
+      return {
+        open: repo.open("/missing"),
+        add: repo.add("/missing", ["file.txt"]),
+        clone: await repo.clone(`${url}/missing.git`, "/missing-clone"),
+      };
+    }, GIT_FIXTURE_URL);
+
+    expect(result.open.error).toContain("not a git repository");
+    expect(result.add.error).toBeTruthy();
+    expect(result.clone.error).toBeTruthy();
+  });
+});
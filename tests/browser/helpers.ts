@@ -10,6 +10,41 @@ import { Page } from "@playwright/test";
  */
 export const TEST_PAGE_URL = "http://localhost:3456/test-page.html";
 
+/**
+ * Smart HTTP git server started from tests/browser/fixtures/git-server.mjs
+ */
+export const GIT_FIXTURE_URL = "http://localhost:3457";
+
+/**
+ * Checks whether the WASM module built by `make build-e2e` is being served
+ */
+export async function isGitCoreBuilt(page: Page): Promise<boolean> {
+  const response = await page.request.head(
+    new URL("/wasm/git-core.wasm", TEST_PAGE_URL).toString(),
+  );
+  return response.ok();
+}
+
+/**
+ * Loads the git-core WASM module into the page on top of the in-memory
+ * filesystem and waits for the gitCore global to be registered
+ */
+export async function loadGitCore(page: Page): Promise<void> {
+  await page.goto(TEST_PAGE_URL);
+  await page.addScriptTag({ url: "/support/memfs.js" });
+  await page.addScriptTag({ url: "/wasm/wasm_exec.js" });
+
+  await page.evaluate(async () => {
+    const go = new (globalThis as any).Go();
+    const { instance } = await WebAssembly.instantiateStreaming(
+      fetch("/wasm/git-core.wasm"),
+      go.importObject,
+    );
+    go.run(instance);
+  });
+  await page.waitForFunction(() => "gitCore" in globalThis);
+}
+
 /**
  * Creates a simple test page with browser-git loaded
  */
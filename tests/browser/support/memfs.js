@@ -0,0 +1,405 @@
+/**
+ * In-memory filesystem for running the git-core WASM module in a browser.
+ *
+ * Go's js/wasm port performs file I/O through a Node-style `globalThis.fs`,
+ * which wasm_exec.js only stubs out in browsers. Loading this script before
+ * wasm_exec.js installs a working implementation, so the repository
+ * bindings can be exercised end to end. `globalThis.memfs` exposes helpers
+ * for tests to create and inspect worktree files.
+ */
+(() => {
+  const S_IFDIR = 0o040000;
+  const S_IFREG = 0o100000;
+
+  const constants = {
+    O_RDONLY: 0,
+    O_WRONLY: 1,
+    O_RDWR: 2,
+    O_CREAT: 64,
+    O_EXCL: 128,
+    O_TRUNC: 512,
+    O_APPEND: 1024,
+    O_DIRECTORY: 65536,
+  };
+
+  const encoder = new TextEncoder();
+  const decoder = new TextDecoder("utf-8");
+
+  const fsError = (code, path) => {
+    const err = new Error(path ? `${code}: ${path}` : code);
+    err.code = code;
+    return err;
+  };
+
+  let cwd = "/";
+  let nextIno = 1;
+  let nextFd = 100;
+  const fds = new Map();
+  const nodes = new Map();
+
+  const newDir = (mode) => ({
+    type: "dir",
+    mode: mode & 0o777,
+    mtimeMs: Date.now(),
+    ino: nextIno++,
+    children: new Set(),
+  });
+
+  const newFile = (mode) => ({
+    type: "file",
+    mode: mode & 0o777,
+    mtimeMs: Date.now(),
+    ino: nextIno++,
+    data: new Uint8Array(0),
+    size: 0,
+  });
+
+  nodes.set("/", newDir(0o755));
+
+  const resolve = (path) => {
+    const parts = [];
+    const full = path.startsWith("/") ? path : `${cwd}/${path}`;
+    for (const part of full.split("/")) {
+      if (part === "" || part === ".") continue;
+      if (part === "..") parts.pop();
+      else parts.push(part);
+    }
+    return "/" + parts.join("/");
+  };
+
+  const dirname = (path) => {
+    const i = path.lastIndexOf("/");
+    return i <= 0 ? "/" : path.slice(0, i);
+  };
+
+  const basename = (path) => path.slice(path.lastIndexOf("/") + 1);
+
+  // lookupParent returns the directory that holds path, or throws
+  const lookupParent = (path) => {
+    const parent = nodes.get(dirname(path));
+    if (!parent) throw fsError("ENOENT", path);
+    if (parent.type !== "dir") throw fsError("ENOTDIR", path);
+    return parent;
+  };
+
+  const lookup = (path) => {
+    const node = nodes.get(path);
+    if (!node) {
+      lookupParent(path);
+      throw fsError("ENOENT", path);
+    }
+    return node;
+  };
+
+  const stats = (node) => ({
+    dev: 1,
+    ino: node.ino,
+    mode: (node.type === "dir" ? S_IFDIR : S_IFREG) | node.mode,
+    nlink: 1,
+    uid: 0,
+    gid: 0,
+    rdev: 0,
+    size: node.type === "dir" ? 4096 : node.size,
+    blksize: 4096,
+    blocks: Math.ceil((node.type === "dir" ? 4096 : node.size) / 512),
+    atimeMs: node.mtimeMs,
+    mtimeMs: node.mtimeMs,
+    ctimeMs: node.mtimeMs,
+    isDirectory: () => node.type === "dir",
+    isFile: () => node.type === "file",
+    isSymbolicLink: () => false,
+  });
+
+  const getFd = (fd) => {
+    const file = fds.get(fd);
+    if (!file) throw fsError("EBADF");
+    return file;
+  };
+
+  const resize = (node, size) => {
+    if (size > node.data.length) {
+      const data = new Uint8Array(Math.max(size, node.data.length * 2));
+      data.set(node.data.subarray(0, node.size));
+      node.data = data;
+    } else if (size < node.size) {
+      node.data.fill(0, size, node.size);
+    }
+    node.size = size;
+    node.mtimeMs = Date.now();
+  };
+
+  const writeAt = (node, buffer, offset, length, position) => {
+    const end = position + length;
+    if (end > node.size) resize(node, end);
+    node.data.set(buffer.subarray(offset, offset + length), position);
+    node.mtimeMs = Date.now();
+    return length;
+  };
+
+  // Console output for stdout and stderr, flushed line by line
+  let outputBuf = "";
+  const writeConsole = (buf) => {
+    outputBuf += decoder.decode(buf);
+    const nl = outputBuf.lastIndexOf("\n");
+    if (nl !== -1) {
+      console.log(outputBuf.substring(0, nl));
+      outputBuf = outputBuf.substring(nl + 1);
+    }
+    return buf.length;
+  };
+
+  // call runs op and reports its result through a Node-style callback
+  const call = (callback, op) => {
+    let result;
+    try {
+      result = op();
+    } catch (err) {
+      callback(err);
+      return;
+    }
+    callback(null, result);
+  };
+
+  const ops = {
+    open(path, flags, mode) {
+      path = resolve(path);
+      let node = nodes.get(path);
+      if (node && flags & constants.O_CREAT && flags & constants.O_EXCL) {
+        throw fsError("EEXIST", path);
+      }
+      if (!node) {
+        const parent = lookupParent(path);
+        if (!(flags & constants.O_CREAT)) throw fsError("ENOENT", path);
+        node = newFile(mode);
+        nodes.set(path, node);
+        parent.children.add(basename(path));
+      }
+      const writable = flags & (constants.O_WRONLY | constants.O_RDWR);
+      if (node.type === "dir" && writable) throw fsError("EISDIR", path);
+      if (node.type !== "dir" && flags & constants.O_DIRECTORY) {
+        throw fsError("ENOTDIR", path);
+      }
+      if (node.type === "file" && writable && flags & constants.O_TRUNC) {
+        resize(node, 0);
+      }
+      const fd = nextFd++;
+      fds.set(fd, { node, position: 0, flags });
+      return fd;
+    },
+
+    close(fd) {
+      getFd(fd);
+      fds.delete(fd);
+    },
+
+    read(fd, buffer, offset, length, position) {
+      const file = getFd(fd);
+      if (file.node.type === "dir") throw fsError("EISDIR");
+      const start = position === null ? file.position : position;
+      const n = Math.max(0, Math.min(length, file.node.size - start));
+      buffer.set(file.node.data.subarray(start, start + n), offset);
+      if (position === null) file.position += n;
+      return n;
+    },
+
+    write(fd, buffer, offset, length, position) {
+      if (fd === 1 || fd === 2) {
+        return writeConsole(buffer.subarray(offset, offset + length));
+      }
+      const file = getFd(fd);
+      const start =
+        file.flags & constants.O_APPEND
+          ? file.node.size
+          : position === null
+            ? file.position
+            : position;
+      const n = writeAt(file.node, buffer, offset, length, start);
+      if (position === null) file.position = start + n;
+      return n;
+    },
+
+    fstat(fd) {
+      return stats(getFd(fd).node);
+    },
+
+    stat(path) {
+      return stats(lookup(resolve(path)));
+    },
+
+    lstat(path) {
+      return stats(lookup(resolve(path)));
+    },
+
+    mkdir(path, perm) {
+      path = resolve(path);
+      if (nodes.has(path)) throw fsError("EEXIST", path);
+      const parent = lookupParent(path);
+      nodes.set(path, newDir(perm));
+      parent.children.add(basename(path));
+    },
+
+    readdir(path) {
+      const node = lookup(resolve(path));
+      if (node.type !== "dir") throw fsError("ENOTDIR", path);
+      return [...node.children].sort();
+    },
+
+    rename(from, to) {
+      from = resolve(from);
+      to = resolve(to);
+      const node = lookup(from);
+      const toParent = lookupParent(to);
+      if (from === to) return;
+      if (node.type === "dir" && to.startsWith(from + "/")) {
+        throw fsError("EINVAL", to);
+      }
+
+      const existing = nodes.get(to);
+      if (existing) {
+        if (existing.type === "dir" && node.type !== "dir") {
+          throw fsError("EISDIR", to);
+        }
+        if (existing.type !== "dir" && node.type === "dir") {
+          throw fsError("ENOTDIR", to);
+        }
+        if (existing.type === "dir" && existing.children.size > 0) {
+          throw fsError("ENOTEMPTY", to);
+        }
+        nodes.delete(to);
+      }
+
+      const moved = [...nodes.keys()].filter(
+        (key) => key === from || key.startsWith(from + "/"),
+      );
+      for (const key of moved) {
+        const value = nodes.get(key);
+        nodes.delete(key);
+        nodes.set(to + key.slice(from.length), value);
+      }
+      nodes.get(dirname(from)).children.delete(basename(from));
+      toParent.children.add(basename(to));
+    },
+
+    rmdir(path) {
+      path = resolve(path);
+      const node = lookup(path);
+      if (node.type !== "dir") throw fsError("ENOTDIR", path);
+      if (path === "/") throw fsError("EBUSY", path);
+      if (node.children.size > 0) throw fsError("ENOTEMPTY", path);
+      nodes.delete(path);
+      nodes.get(dirname(path)).children.delete(basename(path));
+    },
+
+    unlink(path) {
+      path = resolve(path);
+      const node = lookup(path);
+      if (node.type === "dir") throw fsError("EISDIR", path);
+      nodes.delete(path);
+      nodes.get(dirname(path)).children.delete(basename(path));
+    },
+
+    chmod(path, mode) {
+      lookup(resolve(path)).mode = mode & 0o777;
+    },
+
+    fchmod(fd, mode) {
+      getFd(fd).node.mode = mode & 0o777;
+    },
+
+    utimes(path, atime, mtime) {
+      lookup(resolve(path)).mtimeMs = mtime * 1000;
+    },
+
+    truncate(path, length) {
+      const node = lookup(resolve(path));
+      if (node.type === "dir") throw fsError("EISDIR", path);
+      resize(node, length);
+    },
+
+    ftruncate(fd, length) {
+      const file = getFd(fd);
+      if (file.node.type === "dir") throw fsError("EISDIR");
+      resize(file.node, length);
+    },
+
+    readlink(path) {
+      lookup(resolve(path));
+      throw fsError("EINVAL", path);
+    },
+  };
+
+  const fs = { constants };
+  for (const [name, op] of Object.entries(ops)) {
+    fs[name] = (...args) => {
+      const callback = args.pop();
+      call(callback, () => op(...args));
+    };
+  }
+  fs.writeSync = (fd, buf) =>
+    ops.write(fd, buf, 0, buf.length, null);
+  fs.fsync = (fd, callback) => callback(null);
+  fs.chown = (path, uid, gid, callback) => callback(null);
+  fs.fchown = (fd, uid, gid, callback) => callback(null);
+  fs.lchown = (path, uid, gid, callback) => callback(null);
+  fs.link = (path, link, callback) => callback(fsError("ENOSYS"));
+  fs.symlink = (path, link, callback) => callback(fsError("ENOSYS"));
+
+  globalThis.fs = fs;
+
+  if (!globalThis.process) {
+    globalThis.process = {
+      getuid: () => -1,
+      getgid: () => -1,
+      geteuid: () => -1,
+      getegid: () => -1,
+      getgroups: () => [],
+      pid: -1,
+      ppid: -1,
+      umask: () => 0o022,
+      cwd: () => cwd,
+      chdir: (path) => {
+        path = resolve(path);
+        if (lookup(path).type !== "dir") throw fsError("ENOTDIR", path);
+        cwd = path;
+      },
+    };
+  }
+
+  const mkdirp = (path) => {
+    path = resolve(path);
+    if (path === "/" || nodes.has(path)) return;
+    mkdirp(dirname(path));
+    ops.mkdir(path, 0o755);
+  };
+
+  globalThis.memfs = {
+    /** Writes a file, creating parent directories as needed */
+    writeFile(path, content) {
+      path = resolve(path);
+      mkdirp(dirname(path));
+      const data = typeof content === "string" ? encoder.encode(content) : content;
+      const fd = ops.open(path, constants.O_WRONLY | constants.O_CREAT | constants.O_TRUNC, 0o644);
+      ops.write(fd, data, 0, data.length, null);
+      ops.close(fd);
+    },
+
+    /** Reads a file as UTF-8 text */
+    readFile(path) {
+      const node = lookup(resolve(path));
+      if (node.type !== "file") throw fsError("EISDIR", path);
+      return decoder.decode(node.data.subarray(0, node.size));
+    },
+
+    /** Reports whether a file or directory exists */
+    exists(path) {
+      return nodes.has(resolve(path));
+    },
+
+    /** Lists the entries of a directory */
+    readdir(path) {
+      return ops.readdir(path);
+    },
+
+    mkdirp,
+  };
+})();